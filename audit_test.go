@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"photofield/internal/auth"
+	"photofield/internal/image"
+	"photofield/internal/openapi"
+)
+
+// lastAuditId returns the id of the newest audit log entry, 0 if none
+func lastAuditId(t *testing.T) int64 {
+	t.Helper()
+	entries, err := imageSource.ListAudit(image.AuditQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("unable to list audit: %v", err)
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	return entries[0].Id
+}
+
+// waitAudit waits for the audit log written in the background to have an
+// entry of the action newer than the id and returns all entries newer than
+// the id, newest first
+func waitAudit(t *testing.T, after int64, action image.AuditAction) []image.AuditEntry {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		all, err := imageSource.ListAudit(image.AuditQuery{Limit: 100})
+		if err != nil {
+			t.Fatalf("unable to list audit: %v", err)
+		}
+		entries := make([]image.AuditEntry, 0, len(all))
+		found := false
+		for _, entry := range all {
+			if entry.Id > after {
+				entries = append(entries, entry)
+				found = found || entry.Action == action
+			}
+		}
+		if found || time.Now().After(deadline) {
+			return entries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	useTestSource(t)
+	after := lastAuditId(t)
+	authenticator := auth.NewAuthenticator(auth.Config{
+		ApiKeys: []auth.ApiKey{
+			{Name: "alice", Key: "alice-key-0123456789", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeTag}},
+			{Name: "bob", Key: "bob-key-0123456789", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeTag}},
+		},
+	})
+	var api Api
+	handler := authenticator.Middleware(func(r *http.Request) auth.Scope {
+		return apiScope(r.Method, r.URL.Path)
+	})(openapi.Handler(&api))
+
+	request := func(key string, method string, path string, body string) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code >= 300 {
+			t.Fatalf("%s %s: expected success, got %d: %s", method, path, w.Code, w.Body)
+		}
+	}
+
+	request("alice-key-0123456789", http.MethodPost, "/tags/fav:r0/files", `{"op": "ADD", "file_id": 7}`)
+
+	// Entries are written in order, so reads audited by mistake would be
+	// listed once the last mutation is
+	request("alice-key-0123456789", http.MethodGet, "/tags", "")
+	request("bob-key-0123456789", http.MethodGet, "/tags/fav:r1/revisions", "")
+	request("bob-key-0123456789", http.MethodGet, "/state", "")
+
+	request("bob-key-0123456789", http.MethodPost, "/tags/fav:r1/files", `{"op": "SUBTRACT", "file_id": 7}`)
+
+	entries := waitAudit(t, after, image.AuditTagRemove)
+	if len(entries) != 2 {
+		t.Fatalf("expected only the 2 mutations to be audited, got %+v", entries)
+	}
+	expected := []struct {
+		actor  string
+		action image.AuditAction
+	}{
+		{"bob", image.AuditTagRemove},
+		{"alice", image.AuditTagAdd},
+	}
+	for i, e := range expected {
+		entry := entries[i]
+		if entry.Actor != e.actor || entry.Method != auth.MethodApiKey || entry.Action != e.action {
+			t.Errorf("expected %s %s by api key, got %s %s by %q", e.actor, e.action, entry.Actor, entry.Action, entry.Method)
+		}
+		if entry.Target != "fav" {
+			t.Errorf("expected target fav, got %q", entry.Target)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Ids == nil || entry.Ids.Find(7).IsZero() {
+			t.Errorf("expected %s to affect file 7, got %v", entry.Action, entry.Ids)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+DROP TABLE setting;
+DROP TABLE selection;
+DROP TABLE verification;
+DROP TABLE quarantine;
+DROP TABLE trip_file;
+DROP TABLE trip;
+DROP TABLE geotag;
+DROP TABLE caption;
+DROP TABLE sidecar_file;
+DROP TABLE projection;
+DROP TABLE motion_photo;
+DROP TABLE audio;
+DROP TABLE video;
+DROP TABLE panorama_file;
+DROP TABLE panorama;
+DROP TABLE search;
+DROP TABLE user_state;
+DROP TABLE audit_file;
+DROP TABLE audit;
+DROP TABLE orientation_edit;
+DROP TABLE orientation_proposal;
+DROP TABLE tag_revision_range;
+DROP TABLE tag_revision;
+DROP TABLE infos_tag;
+DROP TABLE tag;
+DROP TABLE clip_emb;
+DROP TABLE changes;
+DROP TABLE dirs;
+DROP TABLE infos;
+DROP TABLE camera;
+DROP TABLE prefix;
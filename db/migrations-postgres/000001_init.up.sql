@@ -0,0 +1,345 @@
+-- schema of the cache database on PostgreSQL, matching the one the sqlite
+-- migrations build up to, with ids generated by identity columns and times
+-- kept as unix seconds like there
+CREATE TABLE prefix (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  str TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE camera (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  make TEXT NOT NULL DEFAULT '',
+  model TEXT NOT NULL DEFAULT '',
+  serial TEXT NOT NULL DEFAULT '',
+  -- seconds added to the dates of all files taken with the camera
+  clock_offset BIGINT NOT NULL DEFAULT 0,
+  CONSTRAINT camera_unique UNIQUE (make, model, serial)
+);
+
+CREATE TABLE infos (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  path_prefix_id BIGINT REFERENCES prefix(id),
+  filename TEXT,
+  width INTEGER,
+  height INTEGER,
+  created_at_unix BIGINT,
+  -- minutes east of UTC
+  created_at_tz_offset INTEGER,
+  color BIGINT,
+  orientation INTEGER,
+  latitude DOUBLE PRECISION,
+  longitude DOUBLE PRECISION,
+  hash TEXT,
+  sha256 TEXT,
+  camera_id BIGINT,
+  indexed_at_unix BIGINT,
+  -- modification time of the file when it was hashed, so that files modified
+  -- in place are hashed again
+  hash_modified_at_unix BIGINT,
+  CONSTRAINT infos_pk UNIQUE (path_prefix_id, filename)
+);
+
+CREATE INDEX list_idx
+ON infos (
+  path_prefix_id,
+  created_at_unix ASC,
+  created_at_tz_offset,
+  width,
+  height,
+  orientation,
+  color
+);
+CREATE INDEX infos_hash_idx ON infos (hash);
+CREATE INDEX infos_camera_id_idx ON infos (camera_id);
+CREATE INDEX infos_indexed_at_unix_idx ON infos (indexed_at_unix);
+
+CREATE TABLE dirs (
+  path TEXT PRIMARY KEY,
+  indexed_at TIMESTAMPTZ
+);
+
+CREATE TABLE changes (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  file_id BIGINT NOT NULL,
+  op TEXT NOT NULL,
+  path TEXT NOT NULL,
+  changed_at_unix BIGINT NOT NULL
+);
+
+CREATE INDEX changes_file_id_idx ON changes (file_id);
+
+-- the embeddings themselves are in the embeddings store in the data dir,
+-- only their inverse norms are kept to tell which files are missing them
+CREATE TABLE clip_emb (
+  file_id BIGINT PRIMARY KEY REFERENCES infos(id),
+  inv_norm INTEGER NOT NULL
+);
+
+CREATE TABLE tag (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  revision INTEGER NOT NULL,
+  name TEXT NOT NULL UNIQUE,
+  color TEXT,
+  icon TEXT,
+  description TEXT,
+  pinned BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE infos_tag (
+  tag_id BIGINT REFERENCES tag(id) NOT NULL,
+  file_id BIGINT NOT NULL,
+  len INTEGER NOT NULL,
+  CONSTRAINT infos_tag_pk UNIQUE (tag_id, file_id, len)
+);
+
+CREATE TABLE tag_revision (
+  tag_id BIGINT REFERENCES tag(id) NOT NULL,
+  revision INTEGER NOT NULL,
+  -- operation that made the revision, ADD, SUBTRACT, INVERT or ROLLBACK
+  op TEXT NOT NULL,
+  changed_at_unix BIGINT NOT NULL,
+  -- number of files added and removed by the revision
+  added INTEGER NOT NULL,
+  removed INTEGER NOT NULL,
+  -- number of files with the tag after the revision
+  count INTEGER NOT NULL,
+  PRIMARY KEY (tag_id, revision)
+);
+
+CREATE TABLE tag_revision_range (
+  tag_id BIGINT NOT NULL,
+  revision INTEGER NOT NULL,
+  removed INTEGER NOT NULL,
+  file_id BIGINT NOT NULL,
+  len INTEGER NOT NULL
+);
+
+CREATE INDEX tag_revision_range_idx ON tag_revision_range (tag_id, revision);
+
+CREATE TABLE orientation_proposal (
+  file_id BIGINT PRIMARY KEY,
+  -- rotation to apply on top of the orientation of the file
+  orientation INTEGER NOT NULL,
+  confidence DOUBLE PRECISION NOT NULL,
+  -- pending, accepted or rejected, decided proposals are kept so that the
+  -- same file is not proposed again
+  status TEXT NOT NULL DEFAULT 'pending',
+  created_at_unix BIGINT NOT NULL
+);
+
+CREATE INDEX orientation_proposal_status_idx ON orientation_proposal (status);
+
+CREATE TABLE orientation_edit (
+  file_id BIGINT PRIMARY KEY,
+  -- rotation or flip applied on top of the orientation of the file
+  orientation INTEGER NOT NULL,
+  edited_at_unix BIGINT NOT NULL
+);
+
+CREATE TABLE audit (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  created_at_unix BIGINT NOT NULL,
+  -- name of the API key or user, empty if anonymous
+  actor TEXT NOT NULL DEFAULT '',
+  -- api_key, proxy or oidc, empty if anonymous
+  method TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,
+  -- tag, collection or camera the action was applied to
+  target TEXT NOT NULL DEFAULT '',
+  -- JSON object with details specific to the action
+  details TEXT
+);
+
+CREATE INDEX audit_action_idx ON audit (action);
+CREATE INDEX audit_actor_idx ON audit (actor);
+
+CREATE TABLE audit_file (
+  audit_id BIGINT REFERENCES audit(id) NOT NULL,
+  file_id BIGINT NOT NULL,
+  len INTEGER NOT NULL
+);
+
+CREATE INDEX audit_file_audit_id_idx ON audit_file (audit_id);
+CREATE INDEX audit_file_file_id_idx ON audit_file (file_id);
+
+CREATE TABLE user_state (
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  key TEXT NOT NULL,
+  -- JSON value set by the UI
+  value TEXT NOT NULL,
+  -- incremented on every change for optimistic concurrency
+  version BIGINT NOT NULL,
+  updated_at_unix BIGINT NOT NULL,
+  PRIMARY KEY (user_name, key)
+);
+
+CREATE TABLE search (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  collection_id TEXT NOT NULL,
+  query TEXT NOT NULL,
+  searched_at_unix BIGINT NOT NULL,
+  -- name of the smart album, null if the search is not saved
+  name TEXT,
+  CONSTRAINT search_query UNIQUE (user_name, collection_id, query)
+);
+
+CREATE INDEX search_user_searched_at_idx ON search (user_name, searched_at_unix);
+
+CREATE TABLE panorama (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  -- path of the stitched preview, null if not stitched
+  preview TEXT,
+  -- ungrouped sets are kept so that the same files are not detected again
+  rejected INTEGER NOT NULL DEFAULT 0,
+  created_at_unix BIGINT NOT NULL
+);
+
+CREATE TABLE panorama_file (
+  file_id BIGINT PRIMARY KEY,
+  panorama_id BIGINT NOT NULL,
+  -- order of the file in the sequence, starting at 0
+  position INTEGER NOT NULL
+);
+
+CREATE INDEX panorama_file_panorama_id_idx ON panorama_file (panorama_id, position);
+
+CREATE TABLE video (
+  file_id BIGINT PRIMARY KEY,
+  duration_ms BIGINT,
+  codec TEXT,
+  frame_rate DOUBLE PRECISION,
+  -- JSON array of chapters with start_ms, end_ms and title
+  chapters TEXT
+);
+
+CREATE INDEX video_duration_ms_idx ON video (duration_ms);
+
+CREATE TABLE audio (
+  file_id BIGINT PRIMARY KEY,
+  path TEXT NOT NULL,
+  duration_ms BIGINT
+);
+
+CREATE TABLE motion_photo (
+  file_id BIGINT PRIMARY KEY,
+  -- location of the video in the file in bytes
+  "offset" BIGINT NOT NULL,
+  length BIGINT NOT NULL
+);
+
+CREATE TABLE projection (
+  file_id BIGINT PRIMARY KEY,
+  type TEXT NOT NULL,
+  full_width INTEGER,
+  full_height INTEGER,
+  cropped_left INTEGER,
+  cropped_top INTEGER,
+  cropped_width INTEGER,
+  cropped_height INTEGER,
+  pose_heading DOUBLE PRECISION
+);
+
+CREATE TABLE sidecar_file (
+  path TEXT PRIMARY KEY,
+  file_id BIGINT NOT NULL,
+  -- xmp, aae or json
+  kind TEXT NOT NULL,
+  -- the metadata of the file is indexed again when this changes
+  modified_unix BIGINT NOT NULL
+);
+
+CREATE INDEX sidecar_file_file_id_idx ON sidecar_file (file_id);
+
+CREATE TABLE caption (
+  file_id BIGINT PRIMARY KEY,
+  -- from the EXIF ImageDescription, IPTC Caption-Abstract or XMP description
+  embedded TEXT,
+  -- takes precedence over the embedded caption if not null, an empty
+  -- caption clears it
+  edited TEXT,
+  edited_at_unix BIGINT,
+  -- words of the caption for full-text search, in place of the fts5 table
+  -- of sqlite
+  fts TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', coalesce(edited, embedded, ''))
+  ) STORED
+);
+
+CREATE INDEX caption_fts_idx ON caption USING GIN (fts);
+
+CREATE TABLE geotag (
+  file_id BIGINT PRIMARY KEY,
+  latitude DOUBLE PRECISION NOT NULL,
+  longitude DOUBLE PRECISION NOT NULL,
+  tagged_at_unix BIGINT NOT NULL,
+  edited BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE trip (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  collection_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  start_unix BIGINT NOT NULL,
+  end_unix BIGINT NOT NULL,
+  -- location of the most common place, null if no file has a location
+  latitude DOUBLE PRECISION,
+  longitude DOUBLE PRECISION,
+  cover_id BIGINT NOT NULL,
+  -- cleared before detecting the trips of the collection again, so that
+  -- trips not detected anymore are removed while the rest keep their ids
+  detected INTEGER NOT NULL DEFAULT 1,
+  CONSTRAINT trip_start UNIQUE (collection_id, start_unix)
+);
+
+CREATE TABLE trip_file (
+  trip_id BIGINT NOT NULL,
+  file_id BIGINT NOT NULL,
+  PRIMARY KEY (trip_id, file_id)
+);
+
+CREATE INDEX trip_file_file_id_idx ON trip_file (file_id);
+
+CREATE TABLE quarantine (
+  file_id BIGINT PRIMARY KEY,
+  -- indexing step that failed, metadata or thumbnail
+  stage TEXT NOT NULL,
+  error TEXT NOT NULL,
+  quarantined_at_unix BIGINT NOT NULL
+);
+
+CREATE TABLE verification (
+  file_id BIGINT PRIMARY KEY,
+  verified_at_unix BIGINT NOT NULL,
+  -- ok, mismatch or unreadable
+  status TEXT NOT NULL,
+  -- hash found if it did not match the stored one, or why the file could
+  -- not be read
+  detail TEXT,
+  -- modification time of the file when verified, a recent one hints at an
+  -- edit rather than corruption
+  modified_at_unix BIGINT
+);
+
+CREATE INDEX verification_verified_at_idx ON verification (verified_at_unix);
+
+CREATE TABLE selection (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  tag_id BIGINT REFERENCES tag(id) NOT NULL,
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  collection_id TEXT NOT NULL,
+  created_at_unix BIGINT NOT NULL,
+  -- extended every time the selection is changed
+  expires_at_unix BIGINT NOT NULL
+);
+
+CREATE INDEX selection_user_idx ON selection (user_name, collection_id);
+CREATE INDEX selection_expires_at_idx ON selection (expires_at_unix);
+
+CREATE TABLE setting (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
@@ -0,0 +1 @@
+DROP TABLE deepzoom_tile;
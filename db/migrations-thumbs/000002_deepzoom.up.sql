@@ -0,0 +1,9 @@
+CREATE TABLE deepzoom_tile (
+    id INTEGER NOT NULL,
+    level INTEGER NOT NULL,
+    col INTEGER NOT NULL,
+    row INTEGER NOT NULL,
+	created_at_unix INTEGER,
+    data BLOB,
+    PRIMARY KEY (id, level, col, row)
+) WITHOUT ROWID;
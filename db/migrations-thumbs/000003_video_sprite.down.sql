@@ -0,0 +1 @@
+DROP TABLE video_sprite;
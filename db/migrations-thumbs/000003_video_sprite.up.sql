@@ -0,0 +1,12 @@
+CREATE TABLE video_sprite (
+    id INTEGER PRIMARY KEY,
+    duration_ms INTEGER NOT NULL,
+    interval_ms INTEGER NOT NULL,
+    count INTEGER NOT NULL,
+    cols INTEGER NOT NULL,
+    rows INTEGER NOT NULL,
+    frame_width INTEGER NOT NULL,
+    frame_height INTEGER NOT NULL,
+    created_at_unix INTEGER,
+    data BLOB
+);
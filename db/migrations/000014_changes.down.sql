@@ -0,0 +1 @@
+DROP TABLE changes;
\ No newline at end of file
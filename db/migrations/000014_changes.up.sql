@@ -0,0 +1,16 @@
+CREATE TABLE changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id INTEGER NOT NULL,
+    op TEXT NOT NULL,
+    path TEXT NOT NULL,
+    changed_at_unix INTEGER NOT NULL
+);
+
+CREATE INDEX changes_file_id_idx ON changes (file_id);
+
+-- existing files are all considered added
+INSERT INTO changes(file_id, op, path, changed_at_unix)
+SELECT infos.id, 'ADDED', str || filename, strftime('%s', 'now')
+FROM infos
+JOIN prefix ON path_prefix_id == prefix.id
+ORDER BY infos.id;
@@ -0,0 +1,3 @@
+DROP INDEX infos_hash_idx;
+ALTER TABLE infos DROP COLUMN "sha256";
+ALTER TABLE infos DROP COLUMN "hash";
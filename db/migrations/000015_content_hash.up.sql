@@ -0,0 +1,3 @@
+ALTER TABLE infos ADD COLUMN "hash" TEXT;
+ALTER TABLE infos ADD COLUMN "sha256" TEXT;
+CREATE INDEX infos_hash_idx ON infos ("hash");
@@ -0,0 +1,5 @@
+DROP INDEX infos_camera_id_idx;
+
+ALTER TABLE infos DROP COLUMN "camera_id";
+
+DROP TABLE camera;
@@ -0,0 +1,13 @@
+CREATE TABLE camera (
+  id INTEGER PRIMARY KEY,
+  make TEXT NOT NULL DEFAULT '',
+  model TEXT NOT NULL DEFAULT '',
+  serial TEXT NOT NULL DEFAULT '',
+  -- seconds added to the dates of all files taken with the camera
+  clock_offset INTEGER NOT NULL DEFAULT 0,
+  CONSTRAINT camera_unique UNIQUE (make, model, serial)
+);
+
+ALTER TABLE infos ADD COLUMN "camera_id" INTEGER;
+
+CREATE INDEX infos_camera_id_idx ON infos ("camera_id");
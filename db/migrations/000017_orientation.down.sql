@@ -0,0 +1,5 @@
+DROP TABLE orientation_edit;
+
+DROP INDEX orientation_proposal_status_idx;
+
+DROP TABLE orientation_proposal;
@@ -0,0 +1,19 @@
+CREATE TABLE orientation_proposal (
+  file_id INTEGER PRIMARY KEY,
+  -- rotation to apply on top of the orientation of the file
+  orientation INTEGER NOT NULL,
+  confidence REAL NOT NULL,
+  -- pending, accepted or rejected, decided proposals are kept so that the
+  -- same file is not proposed again
+  status TEXT NOT NULL DEFAULT 'pending',
+  created_at_unix INTEGER NOT NULL
+);
+
+CREATE INDEX orientation_proposal_status_idx ON orientation_proposal ("status");
+
+CREATE TABLE orientation_edit (
+  file_id INTEGER PRIMARY KEY,
+  -- rotation or flip applied on top of the orientation of the file
+  orientation INTEGER NOT NULL,
+  edited_at_unix INTEGER NOT NULL
+);
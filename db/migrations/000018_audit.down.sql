@@ -0,0 +1,9 @@
+DROP INDEX audit_file_file_id_idx;
+DROP INDEX audit_file_audit_id_idx;
+
+DROP TABLE audit_file;
+
+DROP INDEX audit_action_idx;
+DROP INDEX audit_actor_idx;
+
+DROP TABLE audit;
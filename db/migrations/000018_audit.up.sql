@@ -0,0 +1,26 @@
+CREATE TABLE audit (
+  id INTEGER PRIMARY KEY,
+  created_at_unix INTEGER NOT NULL,
+  -- name of the API key or user, empty if anonymous
+  actor TEXT NOT NULL DEFAULT '',
+  -- api_key, proxy or oidc, empty if anonymous
+  method TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,
+  -- tag, collection or camera the action was applied to
+  target TEXT NOT NULL DEFAULT '',
+  -- JSON object with details specific to the action
+  details TEXT
+);
+
+CREATE INDEX audit_actor_idx ON audit ("actor");
+CREATE INDEX audit_action_idx ON audit ("action");
+
+-- affected files stored as ranges of ids like infos_tag
+CREATE TABLE audit_file (
+  audit_id INTEGER REFERENCES audit(id) NOT NULL,
+  file_id INTEGER NOT NULL,
+  len INTEGER NOT NULL
+);
+
+CREATE INDEX audit_file_audit_id_idx ON audit_file ("audit_id");
+CREATE INDEX audit_file_file_id_idx ON audit_file ("file_id");
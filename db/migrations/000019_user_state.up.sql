@@ -0,0 +1,11 @@
+CREATE TABLE user_state (
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  key TEXT NOT NULL,
+  -- JSON value set by the UI
+  value TEXT NOT NULL,
+  -- incremented on every change for optimistic concurrency
+  version INTEGER NOT NULL,
+  updated_at_unix INTEGER NOT NULL,
+  PRIMARY KEY (user_name, key)
+);
@@ -0,0 +1,2 @@
+DROP TABLE panorama_file;
+DROP TABLE panorama;
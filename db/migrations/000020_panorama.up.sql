@@ -0,0 +1,17 @@
+CREATE TABLE panorama (
+  id INTEGER PRIMARY KEY,
+  -- path of the stitched preview, null if not stitched
+  preview TEXT,
+  -- ungrouped sets are kept so that the same files are not detected again
+  rejected INTEGER NOT NULL DEFAULT 0,
+  created_at_unix INTEGER NOT NULL
+);
+
+CREATE TABLE panorama_file (
+  file_id INTEGER PRIMARY KEY,
+  panorama_id INTEGER NOT NULL,
+  -- order of the file in the sequence, starting at 0
+  position INTEGER NOT NULL
+);
+
+CREATE INDEX panorama_file_panorama_id_idx ON panorama_file (panorama_id, position);
@@ -0,0 +1,2 @@
+DROP INDEX infos_indexed_at_unix_idx;
+ALTER TABLE infos DROP COLUMN "indexed_at_unix";
@@ -0,0 +1,4 @@
+-- time the file was first indexed, null for files indexed before this column
+ALTER TABLE infos ADD COLUMN "indexed_at_unix" INTEGER;
+
+CREATE INDEX infos_indexed_at_unix_idx ON infos ("indexed_at_unix");
@@ -0,0 +1,10 @@
+CREATE TABLE video (
+  file_id INTEGER PRIMARY KEY,
+  duration_ms INTEGER,
+  codec TEXT,
+  frame_rate REAL,
+  -- JSON array of chapters with start_ms, end_ms and title
+  chapters TEXT
+);
+
+CREATE INDEX video_duration_ms_idx ON video (duration_ms);
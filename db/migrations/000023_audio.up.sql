@@ -0,0 +1,6 @@
+-- voice memo or other audio recorded alongside the file
+CREATE TABLE audio (
+  file_id INTEGER PRIMARY KEY,
+  path TEXT NOT NULL,
+  duration_ms INTEGER
+);
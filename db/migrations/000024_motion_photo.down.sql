@@ -0,0 +1 @@
+DROP TABLE motion_photo;
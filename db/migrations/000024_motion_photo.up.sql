@@ -0,0 +1,7 @@
+-- video embedded in a motion photo after the still image
+CREATE TABLE motion_photo (
+  file_id INTEGER PRIMARY KEY,
+  -- location of the video in the file in bytes
+  offset INTEGER NOT NULL,
+  length INTEGER NOT NULL
+);
@@ -0,0 +1,13 @@
+-- projection of 360° photos from their photo sphere metadata, with the
+-- area of the full panorama covered by the photo in pixels
+CREATE TABLE projection (
+  file_id INTEGER PRIMARY KEY,
+  type TEXT NOT NULL,
+  full_width INTEGER,
+  full_height INTEGER,
+  cropped_left INTEGER,
+  cropped_top INTEGER,
+  cropped_width INTEGER,
+  cropped_height INTEGER,
+  pose_heading REAL
+);
@@ -0,0 +1 @@
+DROP TABLE sidecar_file;
@@ -0,0 +1,12 @@
+-- sidecar files stored next to the files they describe, e.g. XMP metadata,
+-- Apple edits or Google Takeout JSON
+CREATE TABLE sidecar_file (
+  path TEXT PRIMARY KEY,
+  file_id INTEGER NOT NULL,
+  -- xmp, aae or json
+  kind TEXT NOT NULL,
+  -- the metadata of the file is indexed again when this changes
+  modified_unix INTEGER NOT NULL
+);
+
+CREATE INDEX sidecar_file_file_id_idx ON sidecar_file (file_id);
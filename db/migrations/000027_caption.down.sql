@@ -0,0 +1,5 @@
+DROP TRIGGER caption_fts_delete;
+DROP TRIGGER caption_fts_update;
+DROP TRIGGER caption_fts_insert;
+DROP TABLE caption_fts;
+DROP TABLE caption;
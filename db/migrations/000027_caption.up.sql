@@ -0,0 +1,27 @@
+-- captions of files, as embedded in their metadata and as edited by users
+CREATE TABLE caption (
+  file_id INTEGER PRIMARY KEY,
+  -- from the EXIF ImageDescription, IPTC Caption-Abstract or XMP description
+  embedded TEXT,
+  -- takes precedence over the embedded caption if not null, an empty
+  -- caption clears it
+  edited TEXT,
+  edited_at_unix INTEGER
+);
+
+CREATE VIRTUAL TABLE caption_fts USING fts5(text);
+
+CREATE TRIGGER caption_fts_insert AFTER INSERT ON caption BEGIN
+  INSERT INTO caption_fts(rowid, text)
+  VALUES (new.file_id, coalesce(new.edited, new.embedded, ''));
+END;
+
+CREATE TRIGGER caption_fts_update AFTER UPDATE ON caption BEGIN
+  DELETE FROM caption_fts WHERE rowid = old.file_id;
+  INSERT INTO caption_fts(rowid, text)
+  VALUES (new.file_id, coalesce(new.edited, new.embedded, ''));
+END;
+
+CREATE TRIGGER caption_fts_delete AFTER DELETE ON caption BEGIN
+  DELETE FROM caption_fts WHERE rowid = old.file_id;
+END;
@@ -0,0 +1,8 @@
+-- locations of files without GPS metadata, correlated from GPS tracks and
+-- applied again whenever their metadata is indexed
+CREATE TABLE geotag (
+  file_id INTEGER PRIMARY KEY,
+  latitude REAL NOT NULL,
+  longitude REAL NOT NULL,
+  tagged_at_unix INTEGER NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE geotag DROP COLUMN edited;
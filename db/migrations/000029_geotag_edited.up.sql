@@ -0,0 +1,3 @@
+-- locations set by hand, taking precedence over the GPS metadata of the
+-- files, unlike the ones correlated from GPS tracks
+ALTER TABLE geotag ADD COLUMN edited BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX trip_file_file_id_idx;
+DROP TABLE trip_file;
+DROP TABLE trip;
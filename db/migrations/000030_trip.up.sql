@@ -0,0 +1,25 @@
+-- trips and events detected by segmenting the timeline of a collection at
+-- long gaps in time and changes of location
+CREATE TABLE trip (
+  id INTEGER PRIMARY KEY,
+  collection_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  start_unix INTEGER NOT NULL,
+  end_unix INTEGER NOT NULL,
+  -- location of the most common place, null if no file has a location
+  latitude REAL,
+  longitude REAL,
+  cover_id INTEGER NOT NULL,
+  -- cleared before detecting the trips of the collection again, so that
+  -- trips not detected anymore are removed while the rest keep their ids
+  detected INTEGER NOT NULL DEFAULT 1,
+  CONSTRAINT trip_start UNIQUE (collection_id, start_unix)
+);
+
+CREATE TABLE trip_file (
+  trip_id INTEGER NOT NULL,
+  file_id INTEGER NOT NULL,
+  PRIMARY KEY (trip_id, file_id)
+);
+
+CREATE INDEX trip_file_file_id_idx ON trip_file (file_id);
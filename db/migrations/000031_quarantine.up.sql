@@ -0,0 +1,9 @@
+-- files that failed to decode, e.g. truncated JPEGs or corrupt videos, left
+-- out of scenes and indexing until reprocessed instead of being retried
+CREATE TABLE quarantine (
+  file_id INTEGER PRIMARY KEY,
+  -- indexing step that failed, metadata or thumbnail
+  stage TEXT NOT NULL,
+  error TEXT NOT NULL,
+  quarantined_at_unix INTEGER NOT NULL
+);
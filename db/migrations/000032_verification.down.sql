@@ -0,0 +1,2 @@
+DROP INDEX verification_verified_at_idx;
+DROP TABLE verification;
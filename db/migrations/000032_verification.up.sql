@@ -0,0 +1,16 @@
+-- results of hashing the originals again to detect silent corruption, one
+-- row per file verified since its hash was stored
+CREATE TABLE verification (
+  file_id INTEGER PRIMARY KEY,
+  verified_at_unix INTEGER NOT NULL,
+  -- ok, mismatch or unreadable
+  status TEXT NOT NULL,
+  -- hash found if it did not match the stored one, or why the file could
+  -- not be read
+  detail TEXT,
+  -- modification time of the file when verified, a recent one hints at an
+  -- edit rather than corruption
+  modified_at_unix INTEGER
+);
+
+CREATE INDEX verification_verified_at_idx ON verification (verified_at_unix);
@@ -0,0 +1,2 @@
+DROP INDEX search_user_searched_at_idx;
+DROP TABLE search;
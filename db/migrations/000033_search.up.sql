@@ -0,0 +1,15 @@
+-- queries each user searched the collections for, the recent ones as a
+-- history and the named ones saved as smart albums
+CREATE TABLE search (
+  id INTEGER PRIMARY KEY,
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  collection_id TEXT NOT NULL,
+  query TEXT NOT NULL,
+  searched_at_unix INTEGER NOT NULL,
+  -- name of the smart album, null if the search is not saved
+  name TEXT,
+  CONSTRAINT search_query UNIQUE (user_name, collection_id, query)
+);
+
+CREATE INDEX search_user_searched_at_idx ON search (user_name, searched_at_unix);
@@ -0,0 +1,3 @@
+DROP INDEX tag_revision_range_idx;
+DROP TABLE tag_revision_range;
+DROP TABLE tag_revision;
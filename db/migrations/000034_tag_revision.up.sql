@@ -0,0 +1,26 @@
+-- revisions of the files of each tag made by bulk operations, so that they
+-- can be viewed, compared and rolled back
+CREATE TABLE tag_revision (
+  tag_id INTEGER REFERENCES tag(id) NOT NULL,
+  revision INTEGER NOT NULL,
+  -- operation that made the revision, ADD, SUBTRACT, INVERT or ROLLBACK
+  op TEXT NOT NULL,
+  changed_at_unix INTEGER NOT NULL,
+  -- number of files added and removed by the revision
+  added INTEGER NOT NULL,
+  removed INTEGER NOT NULL,
+  -- number of files with the tag after the revision
+  count INTEGER NOT NULL,
+  PRIMARY KEY (tag_id, revision)
+);
+
+-- ranges of the files added or removed by each revision, same as infos_tag
+CREATE TABLE tag_revision_range (
+  tag_id INTEGER NOT NULL,
+  revision INTEGER NOT NULL,
+  removed INTEGER NOT NULL,
+  file_id INTEGER NOT NULL,
+  len INTEGER NOT NULL
+);
+
+CREATE INDEX tag_revision_range_idx ON tag_revision_range (tag_id, revision);
@@ -0,0 +1,4 @@
+ALTER TABLE tag DROP COLUMN pinned;
+ALTER TABLE tag DROP COLUMN description;
+ALTER TABLE tag DROP COLUMN icon;
+ALTER TABLE tag DROP COLUMN color;
@@ -0,0 +1,5 @@
+-- display metadata of tags, so that important ones stand out in the UI
+ALTER TABLE tag ADD COLUMN color TEXT;
+ALTER TABLE tag ADD COLUMN icon TEXT;
+ALTER TABLE tag ADD COLUMN description TEXT;
+ALTER TABLE tag ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;
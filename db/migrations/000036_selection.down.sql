@@ -0,0 +1,3 @@
+DROP INDEX selection_expires_at_idx;
+DROP INDEX selection_user_idx;
+DROP TABLE selection;
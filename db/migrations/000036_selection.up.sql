@@ -0,0 +1,16 @@
+-- selections of files kept on the server, so that selections spanning many
+-- pages of large scenes do not have to be held by the browser, holding the
+-- selected files in their tag until they expire
+CREATE TABLE selection (
+  id INTEGER PRIMARY KEY,
+  tag_id INTEGER REFERENCES tag(id) NOT NULL,
+  -- name of the API key or user, empty if anonymous
+  user_name TEXT NOT NULL,
+  collection_id TEXT NOT NULL,
+  created_at_unix INTEGER NOT NULL,
+  -- extended every time the selection is changed
+  expires_at_unix INTEGER NOT NULL
+);
+
+CREATE INDEX selection_user_idx ON selection (user_name, collection_id);
+CREATE INDEX selection_expires_at_idx ON selection (expires_at_unix);
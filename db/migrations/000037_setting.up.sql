@@ -0,0 +1,7 @@
+-- settings the database was last migrated with, e.g. whether paths are
+-- stored in lower case, so that migrating again is only needed if they
+-- change
+CREATE TABLE setting (
+  key TEXT PRIMARY KEY NOT NULL,
+  value TEXT NOT NULL
+);
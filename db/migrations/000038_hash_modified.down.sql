@@ -0,0 +1 @@
+ALTER TABLE infos DROP COLUMN hash_modified_at_unix;
@@ -0,0 +1,3 @@
+-- modification time of the file when it was hashed, so that files modified
+-- in place are hashed again
+ALTER TABLE infos ADD COLUMN hash_modified_at_unix INTEGER;
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"photofield/internal/problem"
+)
+
+type Scope string
+
+const (
+	// Browse collections, scenes and files
+	ScopeRead Scope = "read"
+	// Add and remove tags
+	ScopeTag Scope = "tag"
+	// Trigger indexing tasks
+	ScopeIndex Scope = "index"
+	// Upload files to collections with an upload dir
+	ScopeUpload Scope = "upload"
+	// Everything, including changing metadata, metrics and debugging
+	ScopeAdmin Scope = "admin"
+)
+
+var Scopes = []Scope{ScopeRead, ScopeTag, ScopeIndex, ScopeUpload, ScopeAdmin}
+
+type ApiKey struct {
+	Name   string  `json:"name"`
+	Key    string  `json:"key"`
+	Scopes []Scope `json:"scopes"`
+}
+
+type Config struct {
+	ApiKeys []ApiKey `json:"api_keys"`
+	// Scopes of requests without an API key, all scopes if not set
+	AnonymousScopes []Scope `json:"anonymous_scopes"`
+	// Scopes of all users authenticated by a proxy or OIDC, read if not set
+	UserScopes []Scope     `json:"user_scopes"`
+	Users      []User      `json:"users"`
+	Groups     []Group     `json:"groups"`
+	Proxy      ProxyConfig `json:"proxy"`
+	Oidc       OidcConfig  `json:"oidc"`
+}
+
+func (config *Config) Validate() error {
+	names := make(map[string]struct{})
+	for _, key := range config.ApiKeys {
+		if key.Name == "" {
+			return fmt.Errorf("api key without name")
+		}
+		if _, ok := names[key.Name]; ok {
+			return fmt.Errorf("api key %s: duplicate name", key.Name)
+		}
+		names[key.Name] = struct{}{}
+		if len(key.Key) < 16 {
+			return fmt.Errorf("api key %s: key too short, use at least 16 characters", key.Name)
+		}
+		if err := validateScopes(key.Scopes); err != nil {
+			return fmt.Errorf("api key %s: %w", key.Name, err)
+		}
+	}
+	if err := validateScopes(config.AnonymousScopes); err != nil {
+		return err
+	}
+	if err := validateScopes(config.UserScopes); err != nil {
+		return fmt.Errorf("user scopes: %w", err)
+	}
+	for _, u := range config.Users {
+		if err := validateScopes(u.Scopes); err != nil {
+			return fmt.Errorf("user %s: %w", u.Name, err)
+		}
+	}
+	for _, g := range config.Groups {
+		if err := validateScopes(g.Scopes); err != nil {
+			return fmt.Errorf("group %s: %w", g.Name, err)
+		}
+	}
+	if config.Proxy.Enable {
+		if len(config.Proxy.TrustedProxies) == 0 {
+			return fmt.Errorf("proxy: trusted_proxies required")
+		}
+		if _, err := parseTrustedProxies(config.Proxy.TrustedProxies); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+	}
+	return config.Oidc.validate()
+}
+
+func validateScopes(scopes []Scope) error {
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range Scopes {
+			if scope == s {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+	return nil
+}
+
+// Principal is the API key, user or anonymous user a request was made by
+type Principal struct {
+	// Name of the API key or user, empty if anonymous
+	Name string
+	// Method the principal was authenticated by, empty if anonymous
+	Method string
+	Groups []string
+	Scopes []Scope
+}
+
+func (p Principal) Anonymous() bool {
+	return p.Name == ""
+}
+
+// Has reports whether the principal was granted the scope, admin implies
+// all the other scopes
+func (p Principal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// FromContext returns the principal of the request authenticated by the
+// middleware
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+type key struct {
+	hash [sha256.Size]byte
+	ApiKey
+}
+
+type Authenticator struct {
+	keys           []key
+	anonymous      []Scope
+	identities     identities
+	proxy          ProxyConfig
+	trustedProxies []*net.IPNet
+	oidc           *oidc
+}
+
+func NewAuthenticator(config Config) *Authenticator {
+	a := &Authenticator{
+		anonymous:  config.AnonymousScopes,
+		identities: newIdentities(config),
+		proxy:      config.Proxy,
+	}
+	if a.anonymous == nil {
+		a.anonymous = Scopes
+	}
+	for _, k := range config.ApiKeys {
+		a.keys = append(a.keys, key{
+			hash:   sha256.Sum256([]byte(k.Key)),
+			ApiKey: k,
+		})
+	}
+	if config.Proxy.Enable {
+		// Validated with the config
+		a.trustedProxies, _ = parseTrustedProxies(config.Proxy.TrustedProxies)
+	}
+	if config.Oidc.Enabled() {
+		a.oidc = newOidc(config.Oidc)
+	}
+	return a
+}
+
+func requestKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	// Clients that only support basic auth, e.g. WebDAV clients, send the key
+	// as the password with any user name. Only accepted on the routes asking
+	// for it, as proxies in front may use basic auth of their own.
+	if basic, _ := r.Context().Value(basicKey{}).(bool); basic {
+		if _, password, ok := r.BasicAuth(); ok {
+			return password
+		}
+	}
+	return ""
+}
+
+type basicKey struct{}
+
+// Challenge asks clients to authenticate with basic auth if the request was
+// rejected as unauthorized, for clients that do not understand problems,
+// e.g. WebDAV clients and browsers, and accepts API keys sent as the
+// password of basic auth
+func Challenge(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), basicKey{}, true)
+		next.ServeHTTP(&challengeWriter{ResponseWriter: w}, r.WithContext(ctx))
+	})
+}
+
+type challengeWriter struct {
+	http.ResponseWriter
+}
+
+func (w *challengeWriter) WriteHeader(status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="photofield"`)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Authenticate returns the principal of the request, or false if the
+// request contains an unknown API key. API keys take precedence over the
+// user set by a trusted proxy, which takes precedence over an OIDC session.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, bool) {
+	k := requestKey(r)
+	if k == "" {
+		if p, ok := a.authenticateProxy(r); ok {
+			return p, true
+		}
+		if p, ok := a.authenticateSession(r); ok {
+			return p, true
+		}
+		return Principal{Scopes: a.anonymous}, true
+	}
+	// Compare hashes to compare in constant time regardless of length
+	hash := sha256.Sum256([]byte(k))
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			return Principal{
+				Name:   key.Name,
+				Method: MethodApiKey,
+				Scopes: key.Scopes,
+			}, true
+		}
+	}
+	return Principal{}, false
+}
+
+// Middleware rejects requests that were not granted the scope returned by
+// scopeOf
+func (a *Authenticator) Middleware(scopeOf func(r *http.Request) Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := a.Authenticate(r)
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, problem.InvalidApiKey, "Invalid API key")
+				return
+			}
+			scope := scopeOf(r)
+			if !p.Has(scope) {
+				if p.Anonymous() {
+					problem.New(http.StatusUnauthorized, problem.Unauthorized, fmt.Sprintf("Login or API key with %s scope required", scope)).
+						With("scope", scope).
+						Write(w, r)
+				} else {
+					problem.New(http.StatusForbidden, problem.Forbidden, fmt.Sprintf("Missing %s scope", scope)).
+						With("scope", scope).
+						Write(w, r)
+				}
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalKey{}, p)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Methods a principal can be authenticated by
+const (
+	MethodApiKey = "api_key"
+	MethodProxy  = "proxy"
+	MethodOidc   = "oidc"
+)
+
+// User grants scopes to a user authenticated by a proxy or OIDC
+type User struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// Group grants scopes to all users in the group
+type Group struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+}
+
+type ProxyConfig struct {
+	Enable bool `json:"enable"`
+	// Header containing the name of the user authenticated by the proxy
+	UserHeader string `json:"user_header"`
+	// Header containing the comma-separated groups of the user
+	GroupsHeader string `json:"groups_header"`
+	// Addresses or CIDR ranges of the proxies allowed to set the headers
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+func (config ProxyConfig) userHeader() string {
+	if config.UserHeader == "" {
+		return "X-Remote-User"
+	}
+	return config.UserHeader
+}
+
+func (config ProxyConfig) groupsHeader() string {
+	if config.GroupsHeader == "" {
+		return "X-Remote-Groups"
+	}
+	return config.GroupsHeader
+}
+
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", p)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// identities maps users authenticated by a proxy or OIDC to their scopes
+type identities struct {
+	defaults []Scope
+	users    map[string][]Scope
+	groups   map[string][]Scope
+}
+
+func newIdentities(config Config) identities {
+	ids := identities{
+		defaults: config.UserScopes,
+		users:    make(map[string][]Scope),
+		groups:   make(map[string][]Scope),
+	}
+	if ids.defaults == nil {
+		ids.defaults = []Scope{ScopeRead}
+	}
+	for _, u := range config.Users {
+		ids.users[u.Name] = u.Scopes
+	}
+	for _, g := range config.Groups {
+		ids.groups[g.Name] = g.Scopes
+	}
+	return ids
+}
+
+// principal returns the principal of the user with the default scopes and
+// the scopes of the user and its groups
+func (ids identities) principal(method string, name string, groups []string) Principal {
+	scopes := append([]Scope{}, ids.defaults...)
+	scopes = append(scopes, ids.users[name]...)
+	for _, g := range groups {
+		scopes = append(scopes, ids.groups[g]...)
+	}
+	return Principal{
+		Name:   name,
+		Method: method,
+		Groups: groups,
+		Scopes: scopes,
+	}
+}
+
+func splitGroups(s string) []string {
+	groups := make([]string, 0)
+	for _, g := range strings.Split(s, ",") {
+		g = strings.TrimSpace(g)
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// authenticateProxy returns the user set by a trusted proxy, headers of
+// requests from other addresses are ignored
+func (a *Authenticator) authenticateProxy(r *http.Request) (Principal, bool) {
+	if !a.proxy.Enable {
+		return Principal{}, false
+	}
+	name := strings.TrimSpace(r.Header.Get(a.proxy.userHeader()))
+	if name == "" {
+		return Principal{}, false
+	}
+	ip := remoteIP(r)
+	if ip == nil {
+		return Principal{}, false
+	}
+	trusted := false
+	for _, n := range a.trustedProxies {
+		if n.Contains(ip) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return Principal{}, false
+	}
+	groups := splitGroups(r.Header.Get(a.proxy.groupsHeader()))
+	return a.identities.principal(MethodProxy, name, groups), true
+}
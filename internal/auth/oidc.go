@@ -0,0 +1,495 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"photofield/internal/logging"
+	"photofield/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+	chirender "github.com/go-chi/render"
+)
+
+var serverLog = logging.Module("server")
+
+const sessionCookie = "photofield_session"
+const flowCookie = "photofield_oidc"
+
+// Maximum time between starting the login and the provider redirecting back
+const flowDuration = 10 * time.Minute
+
+type OidcConfig struct {
+	// URL of the provider, e.g. https://auth.example.com for Authelia or
+	// https://keycloak.example.com/realms/home for Keycloak
+	Issuer       string `json:"issuer"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Callback URL registered with the provider, the API prefix followed by
+	// /auth/callback, e.g. https://photos.example.com/api/auth/callback
+	RedirectUrl string   `json:"redirect_url"`
+	Scopes      []string `json:"scopes"`
+	// Claims of the user info containing the user name and groups
+	UsernameClaim string `json:"username_claim"`
+	GroupsClaim   string `json:"groups_claim"`
+	// Secret signing the session cookies, random on every start if empty,
+	// which logs everyone out on restart
+	SessionSecret   string `json:"session_secret"`
+	SessionDuration string `json:"session_duration"`
+}
+
+func (config OidcConfig) Enabled() bool {
+	return config.Issuer != ""
+}
+
+func (config OidcConfig) validate() error {
+	if !config.Enabled() {
+		return nil
+	}
+	if config.ClientId == "" {
+		return errors.New("oidc: client_id required")
+	}
+	u, err := url.Parse(config.RedirectUrl)
+	if err != nil || !u.IsAbs() {
+		return errors.New("oidc: absolute redirect_url required")
+	}
+	if _, err := config.sessionDuration(); err != nil {
+		return fmt.Errorf("oidc: session_duration: %w", err)
+	}
+	return nil
+}
+
+func (config OidcConfig) sessionDuration() (time.Duration, error) {
+	if config.SessionDuration == "" {
+		return 7 * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(config.SessionDuration)
+}
+
+func (config OidcConfig) scopes() string {
+	if len(config.Scopes) == 0 {
+		return "openid profile email groups"
+	}
+	return strings.Join(config.Scopes, " ")
+}
+
+func (config OidcConfig) usernameClaim() string {
+	if config.UsernameClaim == "" {
+		return "preferred_username"
+	}
+	return config.UsernameClaim
+}
+
+func (config OidcConfig) groupsClaim() string {
+	if config.GroupsClaim == "" {
+		return "groups"
+	}
+	return config.GroupsClaim
+}
+
+type discovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidc struct {
+	config   OidcConfig
+	duration time.Duration
+	signer   signer
+	client   *http.Client
+
+	discoveryMutex sync.Mutex
+	discovery      *discovery
+}
+
+func newOidc(config OidcConfig) *oidc {
+	o := &oidc{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	o.duration, _ = config.sessionDuration()
+	if config.SessionSecret != "" {
+		o.signer.key = []byte(config.SessionSecret)
+	} else {
+		o.signer.key = make([]byte, 32)
+		if _, err := rand.Read(o.signer.key); err != nil {
+			panic(err)
+		}
+	}
+	return o
+}
+
+// discover returns the endpoints of the provider, fetched once on first use
+func (o *oidc) discover() (*discovery, error) {
+	o.discoveryMutex.Lock()
+	defer o.discoveryMutex.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+	u := strings.TrimSuffix(o.config.Issuer, "/") + "/.well-known/openid-configuration"
+	res, err := o.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with %s", res.Status)
+	}
+	d := &discovery{}
+	if err := json.NewDecoder(res.Body).Decode(d); err != nil {
+		return nil, err
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.UserinfoEndpoint == "" {
+		return nil, errors.New("discovery missing endpoints")
+	}
+	o.discovery = d
+	return d, nil
+}
+
+// signer signs values stored in cookies, so that they can be trusted
+// without storing sessions on the server
+type signer struct {
+	key []byte
+}
+
+func (s signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func (s signer) sign(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)), nil
+}
+
+func (s signer) verify(token string, v any) bool {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || subtle.ConstantTimeCompare(mac, s.mac(payload)) != 1 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, v) == nil
+}
+
+type session struct {
+	Name    string   `json:"n"`
+	Groups  []string `json:"g,omitempty"`
+	Expires int64    `json:"e"`
+}
+
+type flow struct {
+	State    string `json:"s"`
+	Verifier string `json:"v"`
+	Return   string `json:"r"`
+	Expires  int64  `json:"e"`
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (o *oidc) secure() bool {
+	return strings.HasPrefix(o.config.RedirectUrl, "https://")
+}
+
+func (o *oidc) setCookie(w http.ResponseWriter, name string, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   o.secure(),
+		// Lax keeps cross-site requests from carrying the session, while
+		// still sending it on the redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (o *oidc) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.secure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// authenticateSession returns the user of a valid session cookie
+func (a *Authenticator) authenticateSession(r *http.Request) (Principal, bool) {
+	if a.oidc == nil {
+		return Principal{}, false
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return Principal{}, false
+	}
+	var s session
+	if !a.oidc.signer.verify(c.Value, &s) || time.Now().Unix() > s.Expires {
+		return Principal{}, false
+	}
+	return a.identities.principal(MethodOidc, s.Name, s.Groups), true
+}
+
+// returnPath only allows redirecting back to local paths after login
+func returnPath(r *http.Request) string {
+	p := r.URL.Query().Get("return")
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+func (a *Authenticator) login(w http.ResponseWriter, r *http.Request) {
+	o := a.oidc
+	d, err := o.discover()
+	if err != nil {
+		serverLog.Warn("oidc discovery failed", "err", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.Unavailable, "Identity provider unavailable")
+		return
+	}
+
+	f := flow{
+		State:    randomString(),
+		Verifier: randomString(),
+		Return:   returnPath(r),
+		Expires:  time.Now().Add(flowDuration).Unix(),
+	}
+	value, err := o.signer.sign(f)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	o.setCookie(w, flowCookie, value, time.Now().Add(flowDuration))
+
+	challenge := sha256.Sum256([]byte(f.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.config.ClientId)
+	q.Set("redirect_uri", o.config.RedirectUrl)
+	q.Set("scope", o.config.scopes())
+	q.Set("state", f.State)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+func (a *Authenticator) callback(w http.ResponseWriter, r *http.Request) {
+	o := a.oidc
+	q := r.URL.Query()
+
+	var f flow
+	c, err := r.Cookie(flowCookie)
+	if err != nil || !o.signer.verify(c.Value, &f) || time.Now().Unix() > f.Expires {
+		problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Login expired, please try again")
+		return
+	}
+	o.clearCookie(w, flowCookie)
+
+	if e := q.Get("error"); e != "" {
+		problem.New(http.StatusUnauthorized, problem.Unauthorized, "Login failed").
+			With("error", e).
+			With("error_description", q.Get("error_description")).
+			Write(w, r)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(f.State)) != 1 {
+		problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Invalid login state")
+		return
+	}
+
+	claims, err := o.userinfo(q.Get("code"), f.Verifier)
+	if err != nil {
+		serverLog.Warn("oidc login failed", "err", err)
+		problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Login failed")
+		return
+	}
+
+	name, _ := claims[o.config.usernameClaim()].(string)
+	if name == "" {
+		problem.New(http.StatusUnauthorized, problem.Unauthorized, "User name missing").
+			With("claim", o.config.usernameClaim()).
+			Write(w, r)
+		return
+	}
+
+	s := session{
+		Name:    name,
+		Groups:  claimStrings(claims[o.config.groupsClaim()]),
+		Expires: time.Now().Add(o.duration).Unix(),
+	}
+	value, err := o.signer.sign(s)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	o.setCookie(w, sessionCookie, value, time.Unix(s.Expires, 0))
+	http.Redirect(w, r, f.Return, http.StatusFound)
+}
+
+// userinfo exchanges the authorization code for an access token and returns
+// the claims of the user info endpoint. The user info is fetched from the
+// provider directly, so the identity does not rely on verifying the
+// signature of the ID token.
+func (o *oidc) userinfo(code string, verifier string) (map[string]any, error) {
+	d, err := o.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.config.RedirectUrl)
+	form.Set("client_id", o.config.ClientId)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientId), url.QueryEscape(o.config.ClientSecret))
+	}
+	res, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with %s", res.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response missing access token")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, d.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	res, err = o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user info failed with %s", res.Status)
+	}
+	claims := make(map[string]any)
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// claimStrings returns the groups claim, either a list or a comma-separated
+// string depending on the provider
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return splitGroups(v)
+	case []any:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	default:
+		return nil
+	}
+}
+
+func (a *Authenticator) logout(w http.ResponseWriter, r *http.Request) {
+	if a.oidc != nil {
+		a.oidc.clearCookie(w, sessionCookie)
+	}
+	http.Redirect(w, r, returnPath(r), http.StatusFound)
+}
+
+type me struct {
+	Name   string   `json:"name,omitempty"`
+	Method string   `json:"method,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Scopes []Scope  `json:"scopes"`
+	// Login is available via the login endpoint
+	Login bool `json:"login"`
+}
+
+func (a *Authenticator) me(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.Authenticate(r)
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidApiKey, "Invalid API key")
+		return
+	}
+	chirender.JSON(w, r, me{
+		Name:   p.Name,
+		Method: p.Method,
+		Groups: p.Groups,
+		Scopes: p.Scopes,
+		Login:  a.oidc != nil,
+	})
+}
+
+// Handler serves the login flow, which is available without any scope
+//
+//	GET /login?return=/path  redirects to the OIDC provider
+//	GET /callback            completes the login and redirects back
+//	GET /logout?return=/path clears the session
+//	GET /me                  returns the current principal and its scopes
+func (a *Authenticator) Handler() http.Handler {
+	r := chi.NewRouter()
+	if a.oidc != nil {
+		r.Get("/login", a.login)
+		r.Get("/callback", a.callback)
+	}
+	r.Get("/logout", a.logout)
+	r.Get("/me", a.me)
+	return r
+}
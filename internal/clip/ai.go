@@ -9,7 +9,7 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"photofield/io/archive"
 	"unsafe"
 )
 
@@ -98,7 +98,7 @@ func (a AI) EmbedImagePath(path string) (Embedding, error) {
 		return nil, ErrNotAvailable
 	}
 
-	f, err := os.Open(path)
+	f, err := archive.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,45 @@
+package clip
+
+import (
+	"errors"
+	"math"
+	"unsafe"
+
+	"github.com/x448/float16"
+)
+
+// Combine returns the sum of the normalized embeddings scaled by their
+// weights, so that it is similar to the embeddings with positive weights
+// and unlike the ones with negative weights
+func Combine(embeddings []Embedding, weights []float32) (Embedding, error) {
+	if len(embeddings) == 0 || len(embeddings) != len(weights) {
+		return nil, ErrMismatchedLength
+	}
+	var sum []float32
+	for i, e := range embeddings {
+		floats := e.Float()
+		if sum == nil {
+			sum = make([]float32, len(floats))
+		}
+		if len(floats) != len(sum) {
+			return nil, ErrMismatchedLength
+		}
+		scale := weights[i] * e.InvNormFloat32()
+		for j, f := range floats {
+			sum[j] += scale * f.Float32()
+		}
+	}
+
+	floats := make([]float16.Float16, len(sum))
+	norm := 0.
+	for i, f := range sum {
+		floats[i] = float16.Fromfloat32(f)
+		v := float64(floats[i].Float32())
+		norm += v * v
+	}
+	if norm == 0 {
+		return nil, errors.New("prompts cancel each other out")
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&floats[0])), len(floats)*2)
+	return FromRaw(b, uint16(float16.Fromfloat32(float32(1/math.Sqrt(norm))))), nil
+}
@@ -0,0 +1,40 @@
+package clip
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func similarity(a Embedding, b Embedding) float32 {
+	dot, _ := DotProductFloat32Float(a.Float32(), b.Float())
+	return dot * a.InvNormFloat32() * b.InvNormFloat32()
+}
+
+func TestCombine(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	beach := randomEmbedding(r, 512)
+	people := randomEmbedding(r, 512)
+
+	combined, err := Combine([]Embedding{beach, people}, []float32{1, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := similarity(combined, beach); s < 0.5 {
+		t.Errorf("expected combined to be similar to the positive prompt, got %f", s)
+	}
+	if s := similarity(combined, people); s > -0.5 {
+		t.Errorf("expected combined to be unlike the negative prompt, got %f", s)
+	}
+
+	single, err := Combine([]Embedding{beach}, []float32{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := similarity(single, beach); s < 0.99 {
+		t.Errorf("expected a single weighted prompt to keep its direction, got %f", s)
+	}
+
+	if _, err := Combine([]Embedding{beach, beach}, []float32{1, -1}); err == nil {
+		t.Error("expected prompts canceling out to fail")
+	}
+}
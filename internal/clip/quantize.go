@@ -0,0 +1,52 @@
+package clip
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/x448/float16"
+)
+
+// QuantizeInt8 returns the embedding with every element scaled to a signed
+// byte, and the factor that turns the dot product of the bytes with a unit
+// vector into the cosine similarity with the embedding
+func QuantizeInt8(e Embedding) ([]byte, Float) {
+	floats := e.Float32()
+	max := float32(0)
+	for _, f := range floats {
+		if a := float32(math.Abs(float64(f))); a > max {
+			max = a
+		}
+	}
+	q := make([]byte, len(floats))
+	if max == 0 {
+		return q, 0
+	}
+	for i, f := range floats {
+		q[i] = byte(int8(math.Round(float64(f / max * 127))))
+	}
+	scale := max / 127 * e.InvNormFloat32()
+	return q, Float(float16.Fromfloat32(scale))
+}
+
+// Int8 returns the bytes of a quantized embedding as signed bytes
+func Int8(b []byte) []int8 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*int8)(unsafe.Pointer(&b[0])), len(b))
+}
+
+func DotProductFloat32Int8(a []float32, b []int8) (float32, error) {
+	l := len(a)
+	if l != len(b) {
+		return 0, fmt.Errorf("slice lengths do not match, a %d b %d", l, len(b))
+	}
+
+	dot := float32(0)
+	for i := 0; i < l; i++ {
+		dot += a[i] * float32(b[i])
+	}
+	return dot, nil
+}
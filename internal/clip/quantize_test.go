@@ -0,0 +1,48 @@
+package clip
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"unsafe"
+
+	"github.com/x448/float16"
+)
+
+func randomEmbedding(r *rand.Rand, dims int) Embedding {
+	floats := make([]float16.Float16, dims)
+	norm := 0.
+	for i := range floats {
+		f := float32(r.NormFloat64())
+		floats[i] = float16.Fromfloat32(f)
+		norm += float64(floats[i].Float32()) * float64(floats[i].Float32())
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&floats[0])), dims*2)
+	return FromRaw(b, uint16(float16.Fromfloat32(float32(1/math.Sqrt(norm)))))
+}
+
+func TestQuantizeInt8(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	search := randomEmbedding(r, 512)
+	s := search.Float32()
+	for i := 0; i < 100; i++ {
+		e := randomEmbedding(r, 512)
+
+		dot, err := DotProductFloat32Float(s, e.Float())
+		if err != nil {
+			t.Fatal(err)
+		}
+		exact := dot * search.InvNormFloat32() * e.InvNormFloat32()
+
+		q, scale := QuantizeInt8(e)
+		dot, err = DotProductFloat32Int8(s, Int8(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		approx := dot * search.InvNormFloat32() * scale.Float32()
+
+		if math.Abs(float64(exact-approx)) > 0.01 {
+			t.Errorf("expected similarity %f, got %f", exact, approx)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package codec
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// Size of the thumbnails in the benchmarks, as configured for the
+// resizing sources by default
+var thumbnailSize = image.Point{X: 256, Y: 256}
+
+// original returns a 24 megapixel photo-like image encoded as a JPEG
+func original(b *testing.B) []byte {
+	b.Helper()
+	img := image.NewYCbCr(image.Rect(0, 0, 6000, 4000), image.YCbCrSubsampleRatio420)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.Y[img.YOffset(x, y)] = uint8(x ^ y)
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i] = uint8(i)
+		img.Cr[i] = uint8(i >> 8)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeJpeg(b *testing.B) {
+	data := original(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeJpeg(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeJpegScaled(b *testing.B) {
+	data := original(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeJpegScaled(bytes.NewReader(data), thumbnailSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResize(b *testing.B) {
+	img, err := DecodeJpeg(bytes.NewReader(original(b)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(img.Bounds().Dx()*img.Bounds().Dy())/1e6, "megapixels")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Resize(img, thumbnailSize.X, thumbnailSize.Y)
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	resized := Resize(img, 100, 100)
+	if size := resized.Bounds().Size(); size != (image.Point{X: 100, Y: 50}) {
+		t.Errorf("expected 100 x 50, got %v", size)
+	}
+	if c := color.RGBAModel.Convert(resized.At(50, 25)); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("expected white, got %v", c)
+	}
+}
+
+func TestDecodeJpegScaled(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 800, 600))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeJpegScaled(&buf, image.Point{X: 100, Y: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scaled down as far as possible while covering the size, if at all
+	if size := decoded.Bounds().Size(); size.X < 100 || size.Y < 100 {
+		t.Errorf("expected at least 100 x 100, got %v", size)
+	}
+}
+
+func TestEncodeJpegQuality(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 256, 256), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i * 7)
+	}
+	var full, reduced bytes.Buffer
+	if err := EncodeJpeg(&full, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeJpegQuality(&reduced, img, 30); err != nil {
+		t.Fatal(err)
+	}
+	if reduced.Len() >= full.Len() {
+		t.Errorf("expected quality 30 to be smaller than the default, got %d >= %d bytes", reduced.Len(), full.Len())
+	}
+}
+
+func TestReduce(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 1001, 801), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 200
+	}
+	for i := range img.Cb {
+		img.Cb[i] = 100
+		img.Cr[i] = 150
+	}
+	reduced := reduce(img, 100, 100)
+	// Halved as long as it still covers the size
+	if size := reduced.Bounds().Size(); size != (image.Point{X: 125, Y: 100}) {
+		t.Errorf("expected 125 x 100, got %v", size)
+	}
+	if c := reduced.At(124, 99); c != (color.YCbCr{Y: 200, Cb: 100, Cr: 150}) {
+		t.Errorf("expected the colors to be kept, got %v", c)
+	}
+}
@@ -9,12 +9,26 @@ import (
 	"io"
 )
 
+// ScaledJpeg reports whether DecodeJpegScaled saves any decoding time
+const ScaledJpeg = false
+
 func DecodeJpeg(reader io.ReadSeeker) (image.Image, error) {
 	return jpeg.Decode(reader)
 }
 
+// DecodeJpegScaled decodes the JPEG at full size, as the pure Go decoder
+// cannot skip any of the DCT coefficients, see the libjpeg build tag
+func DecodeJpegScaled(reader io.Reader, size image.Point) (image.Image, error) {
+	return jpeg.Decode(reader)
+}
+
 func EncodeJpeg(w io.Writer, image image.Image) error {
+	return EncodeJpegQuality(w, image, 80)
+}
+
+// EncodeJpegQuality encodes the image at the quality from 1 to 100
+func EncodeJpegQuality(w io.Writer, image image.Image, quality int) error {
 	return jpeg.Encode(w, image, &jpeg.Options{
-		Quality: 80,
+		Quality: quality,
 	})
 }
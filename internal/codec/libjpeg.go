@@ -10,12 +10,29 @@ import (
 	"github.com/pixiv/go-libjpeg/jpeg"
 )
 
+// ScaledJpeg reports whether DecodeJpegScaled saves any decoding time
+const ScaledJpeg = true
+
 func DecodeJpeg(reader io.ReadSeeker) (image.Image, error) {
 	return jpeg.Decode(reader, &jpeg.DecoderOptions{})
 }
 
+// DecodeJpegScaled decodes the JPEG at the smallest of 1/8 to 8/8 of its
+// size that still covers the size, scaling it down in the DCT domain with
+// the SIMD paths of libjpeg-turbo instead of decoding every pixel
+func DecodeJpegScaled(reader io.Reader, size image.Point) (image.Image, error) {
+	return jpeg.Decode(reader, &jpeg.DecoderOptions{
+		ScaleTarget: image.Rectangle{Max: size},
+	})
+}
+
 func EncodeJpeg(w io.Writer, image image.Image) error {
+	return EncodeJpegQuality(w, image, 80)
+}
+
+// EncodeJpegQuality encodes the image at the quality from 1 to 100
+func EncodeJpegQuality(w io.Writer, image image.Image, quality int) error {
 	return jpeg.Encode(w, image, &jpeg.EncoderOptions{
-		Quality: 80,
+		Quality: quality,
 	})
 }
@@ -0,0 +1,123 @@
+package codec
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Resize scales the image to fit inside the width and height, keeping its
+// aspect ratio
+func Resize(img image.Image, width, height int) image.Image {
+	origW := img.Bounds().Size().X
+	origH := img.Bounds().Size().Y
+	aspectRatio := float64(origW) / float64(origH)
+
+	desiredW := width
+	desiredH := height
+	if float64(desiredW)/float64(desiredH) > aspectRatio {
+		desiredW = int(float64(desiredH) * aspectRatio)
+	} else {
+		desiredH = int(float64(desiredW) / aspectRatio)
+	}
+	img = reduce(img, desiredW, desiredH)
+	resized := image.NewRGBA(image.Rect(0, 0, desiredW, desiredH))
+	// Less than halved after reducing, so bilinear sampling covers every
+	// source pixel instead of aliasing
+	draw.BiLinear.Scale(resized, resized.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return resized
+}
+
+// reduce halves the image with a 2x2 box filter for as long as it still
+// covers the width and height. YCbCr images, as JPEGs decode to, are
+// halved plane by plane without converting their colors. Other images are
+// returned as they are.
+func reduce(img image.Image, width, height int) image.Image {
+	for {
+		size := img.Bounds().Size()
+		if size.X < 2*width || size.Y < 2*height || img.Bounds().Min != (image.Point{}) {
+			return img
+		}
+		switch src := img.(type) {
+		case *image.YCbCr:
+			img = halveYCbCr(src)
+		case *image.RGBA:
+			dst := image.NewRGBA(image.Rect(0, 0, size.X/2, size.Y/2))
+			halvePixels(dst.Pix, dst.Stride, size.X/2, size.Y/2, src.Pix, src.Stride, size.X, size.Y, 4)
+			img = dst
+		case *image.NRGBA:
+			dst := image.NewNRGBA(image.Rect(0, 0, size.X/2, size.Y/2))
+			halvePixels(dst.Pix, dst.Stride, size.X/2, size.Y/2, src.Pix, src.Stride, size.X, size.Y, 4)
+			img = dst
+		case *image.Gray:
+			dst := image.NewGray(image.Rect(0, 0, size.X/2, size.Y/2))
+			halvePixels(dst.Pix, dst.Stride, size.X/2, size.Y/2, src.Pix, src.Stride, size.X, size.Y, 1)
+			img = dst
+		default:
+			return img
+		}
+	}
+}
+
+func halveYCbCr(src *image.YCbCr) *image.YCbCr {
+	size := src.Rect.Size()
+	dst := image.NewYCbCr(image.Rect(0, 0, size.X/2, size.Y/2), src.SubsampleRatio)
+	halvePixels(dst.Y, dst.YStride, dst.Rect.Dx(), dst.Rect.Dy(), src.Y, src.YStride, size.X, size.Y, 1)
+	dw, dh := chromaSize(dst.Rect, dst.SubsampleRatio)
+	sw, sh := chromaSize(src.Rect, src.SubsampleRatio)
+	halvePixels(dst.Cb, dst.CStride, dw, dh, src.Cb, src.CStride, sw, sh, 1)
+	halvePixels(dst.Cr, dst.CStride, dw, dh, src.Cr, src.CStride, sw, sh, 1)
+	return dst
+}
+
+// chromaSize returns the size of the chroma planes of a YCbCr image with
+// the rect starting at the origin, see image.NewYCbCr
+func chromaSize(r image.Rectangle, ratio image.YCbCrSubsampleRatio) (int, int) {
+	w, h := r.Dx(), r.Dy()
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return (w + 1) / 2, h
+	case image.YCbCrSubsampleRatio420:
+		return (w + 1) / 2, (h + 1) / 2
+	case image.YCbCrSubsampleRatio440:
+		return w, (h + 1) / 2
+	case image.YCbCrSubsampleRatio411:
+		return (w + 3) / 4, h
+	case image.YCbCrSubsampleRatio410:
+		return (w + 3) / 4, (h + 1) / 2
+	default:
+		return w, h
+	}
+}
+
+// halvePixels averages each 2x2 block of pixels with the provided number of
+// interleaved channels into one, repeating the last row and column of
+// sources with an odd size
+func halvePixels(dst []uint8, dstStride, dw, dh int, src []uint8, srcStride, sw, sh int, channels int) {
+	for y := 0; y < dh; y++ {
+		r0 := src[min(2*y, sh-1)*srcStride:]
+		r1 := src[min(2*y+1, sh-1)*srcStride:]
+		d := dst[y*dstStride:]
+		if channels == 1 {
+			// Without the channel loop for the planes of YCbCr images
+			full := min(dw, sw/2)
+			a, b := r0[:2*full], r1[:2*full]
+			for x := 0; x < full; x++ {
+				d[x] = uint8((uint(a[2*x]) + uint(a[2*x+1]) + uint(b[2*x]) + uint(b[2*x+1]) + 2) >> 2)
+			}
+			for x := full; x < dw; x++ {
+				x0, x1 := min(2*x, sw-1), min(2*x+1, sw-1)
+				d[x] = uint8((int(r0[x0]) + int(r0[x1]) + int(r1[x0]) + int(r1[x1]) + 2) / 4)
+			}
+			continue
+		}
+		for x := 0; x < dw; x++ {
+			x0 := min(2*x, sw-1) * channels
+			x1 := min(2*x+1, sw-1) * channels
+			for c := 0; c < channels; c++ {
+				sum := int(r0[x0+c]) + int(r0[x1+c]) + int(r1[x0+c]) + int(r1[x1+c])
+				d[x*channels+c] = uint8((sum + 2) / 4)
+			}
+		}
+	}
+}
@@ -1,102 +1,158 @@
-package collection
-
-import (
-	"log"
-	"os"
-	"path/filepath"
-	"photofield/internal/clip"
-	"photofield/internal/image"
-	"sort"
-	"time"
-
-	"github.com/gosimple/slug"
-)
-
-type Collection struct {
-	Id            string     `json:"id"`
-	Name          string     `json:"name"`
-	Layout        string     `json:"layout"`
-	Limit         int        `json:"limit"`
-	IndexLimit    int        `json:"index_limit"`
-	ExpandSubdirs bool       `json:"expand_subdirs"`
-	ExpandSort    string     `json:"expand_sort"`
-	Dirs          []string   `json:"dirs"`
-	IndexedAt     *time.Time `json:"indexed_at,omitempty"`
-	IndexedCount  int        `json:"indexed_count"`
-}
-
-func (collection *Collection) GenerateId() {
-	collection.Id = slug.Make(collection.Name)
-}
-
-func (collection *Collection) Expand() []Collection {
-	collections := make([]Collection, 0)
-	for _, collectionDir := range collection.Dirs {
-		dir, err := os.Open(collectionDir)
-		if err != nil {
-			log.Fatalln("Unable to expand dir", collectionDir)
-		}
-		defer dir.Close()
-
-		list, _ := dir.ReadDir(0)
-		for _, entry := range list {
-			if !entry.IsDir() {
-				continue
-			}
-			name := entry.Name()
-			child := Collection{
-				Name:       name,
-				Dirs:       []string{filepath.Join(collectionDir, name)},
-				Limit:      collection.Limit,
-				IndexLimit: collection.IndexLimit,
-			}
-			collections = append(collections, child)
-		}
-	}
-	switch collection.ExpandSort {
-	case "asc":
-		sort.Slice(collections, func(i, j int) bool {
-			return collections[i].Name < collections[j].Name
-		})
-	case "desc":
-		sort.Slice(collections, func(i, j int) bool {
-			return collections[i].Name > collections[j].Name
-		})
-	}
-	return collections
-}
-
-func (collection *Collection) UpdateStatus(source *image.Source) {
-	var earliestIndex *time.Time
-	for _, dir := range collection.Dirs {
-		info := source.GetDir(dir)
-		if !info.DateTime.IsZero() && (earliestIndex == nil || info.DateTime.Before(*earliestIndex)) {
-			earliestIndex = &info.DateTime
-		}
-	}
-	collection.IndexedAt = earliestIndex
-	collection.IndexedCount = source.GetDirsCount(collection.Dirs)
-}
-
-func (collection *Collection) GetInfos(source *image.Source, options image.ListOptions) <-chan image.SourcedInfo {
-	return source.ListInfos(collection.Dirs, options)
-}
-
-func (collection *Collection) GetSimilar(source *image.Source, embedding clip.Embedding, options image.ListOptions) <-chan image.SimilarityInfo {
-	return source.ListSimilar(collection.Dirs, embedding, options)
-}
-
-func (collection *Collection) GetIds(source *image.Source) <-chan image.ImageId {
-	limit := 0
-	if collection.IndexLimit > 0 {
-		limit = collection.IndexLimit
-	}
-	if collection.Limit > 0 {
-		limit = collection.Limit
-	}
-	return source.ListImageIds(collection.Dirs, limit)
-}
-
-func (collection *Collection) GetIdsUint32(source *image.Source) <-chan uint32 {
-	return image.IdsToUint32(collection.GetIds(source))
-}
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"photofield/internal/clip"
+	"photofield/internal/image"
+	"photofield/internal/logging"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+var serverLog = logging.Module("server")
+
+var ErrNotSubdir = errors.New("not a directory within the collection")
+
+type Collection struct {
+	Id            string           `json:"id"`
+	Name          string           `json:"name"`
+	Layout        string           `json:"layout"`
+	Limit         int              `json:"limit"`
+	IndexLimit    int              `json:"index_limit"`
+	ExpandSubdirs bool             `json:"expand_subdirs"`
+	ExpandSort    string           `json:"expand_sort"`
+	Dedup         string           `json:"dedup"`
+	Walk          image.WalkConfig `json:"walk"`
+	Ignore        []string         `json:"ignore"`
+	Dirs          []string         `json:"dirs"`
+	Upload        UploadConfig     `json:"upload"`
+	IndexedAt     *time.Time       `json:"indexed_at,omitempty"`
+	IndexedCount  int              `json:"indexed_count"`
+}
+
+func (collection *Collection) GenerateId() {
+	collection.Id = slug.Make(collection.Name)
+}
+
+func (collection *Collection) Expand() []Collection {
+	collections := make([]Collection, 0)
+	// Invalid patterns are reported once the collections are loaded
+	ignored, _ := image.CompileGlobs(collection.Ignore)
+	for _, collectionDir := range collection.Dirs {
+		dir, err := os.Open(collectionDir)
+		if err != nil {
+			serverLog.Fatal("unable to expand dir", "dir", collectionDir, "err", err)
+		}
+		defer dir.Close()
+
+		list, _ := dir.ReadDir(0)
+		for _, entry := range list {
+			if !entry.IsDir() {
+				continue
+			}
+			name := entry.Name()
+			if ignored.MatchDir(filepath.Join(collectionDir, name)) {
+				continue
+			}
+			child := Collection{
+				Name:       name,
+				Dirs:       []string{filepath.Join(collectionDir, name)},
+				Limit:      collection.Limit,
+				IndexLimit: collection.IndexLimit,
+				Dedup:      collection.Dedup,
+				Walk:       collection.Walk,
+				Ignore:     collection.Ignore,
+			}
+			collections = append(collections, child)
+		}
+	}
+	switch collection.ExpandSort {
+	case "asc":
+		sort.Slice(collections, func(i, j int) bool {
+			return collections[i].Name < collections[j].Name
+		})
+	case "desc":
+		sort.Slice(collections, func(i, j int) bool {
+			return collections[i].Name > collections[j].Name
+		})
+	}
+	return collections
+}
+
+func (collection *Collection) UpdateStatus(source *image.Source) {
+	var earliestIndex *time.Time
+	for _, dir := range collection.Dirs {
+		info := source.GetDir(dir)
+		if !info.DateTime.IsZero() && (earliestIndex == nil || info.DateTime.Before(*earliestIndex)) {
+			earliestIndex = &info.DateTime
+		}
+	}
+	collection.IndexedAt = earliestIndex
+	collection.IndexedCount = source.GetDirsCount(collection.Dirs)
+}
+
+func (collection *Collection) GetInfos(source *image.Source, options image.ListOptions) <-chan image.SourcedInfo {
+	options.Ignore = collection.Ignore
+	infos := source.ListInfos(collection.Dirs, options)
+	return source.DedupInfos(infos, image.DedupMode(collection.Dedup))
+}
+
+// GetExportIds lists the ids of the files to export up to the limit of the
+// collection, leaving out private files unless the query asks for them
+func (collection *Collection) GetExportIds(source *image.Source, options image.ListOptions) []image.ImageId {
+	options.Limit = collection.Limit
+	options.Hide = source.Private.Tags
+	ids := make([]image.ImageId, 0)
+	for info := range collection.GetInfos(source, options) {
+		ids = append(ids, info.Id)
+	}
+	return ids
+}
+
+func (collection *Collection) GetSimilar(source *image.Source, embedding clip.Embedding, options image.ListOptions) <-chan image.SimilarityInfo {
+	options.Ignore = collection.Ignore
+	infos := source.ListSimilar(collection.Dirs, embedding, options)
+	return source.DedupSimilarityInfos(infos, image.DedupMode(collection.Dedup))
+}
+
+func (collection *Collection) GetIds(source *image.Source) <-chan image.ImageId {
+	limit := 0
+	if collection.IndexLimit > 0 {
+		limit = collection.IndexLimit
+	}
+	if collection.Limit > 0 {
+		limit = collection.Limit
+	}
+	return source.ListImageIds(collection.Dirs, limit)
+}
+
+func (collection *Collection) GetIdsUint32(source *image.Source) <-chan uint32 {
+	return image.IdsToUint32(collection.GetIds(source))
+}
+
+// Subdir returns the directory at the path within one of the dirs of the
+// collection, where a relative path is relative to the dirs
+func (collection *Collection) Subdir(path string) (string, error) {
+	path = filepath.Clean(path)
+	for _, dir := range collection.Dirs {
+		dir = filepath.Clean(dir)
+		subdir := path
+		if !filepath.IsAbs(subdir) {
+			subdir = filepath.Join(dir, subdir)
+		}
+		rel, err := filepath.Rel(dir, subdir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(subdir); err == nil && info.IsDir() {
+			return subdir, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotSubdir, path)
+}
@@ -0,0 +1,109 @@
+package collection
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"photofield/internal/image"
+	"photofield/search"
+)
+
+func TestSubdir(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "photos", "2021", "Lisbon"), 0755)
+	os.MkdirAll(filepath.Join(root, "other"), 0755)
+	c := Collection{Dirs: []string{filepath.Join(root, "photos")}}
+
+	valid := map[string]string{
+		"2021/Lisbon":                         filepath.Join(root, "photos", "2021", "Lisbon"),
+		"2021/":                               filepath.Join(root, "photos", "2021"),
+		".":                                   filepath.Join(root, "photos"),
+		filepath.Join(root, "photos", "2021"): filepath.Join(root, "photos", "2021"),
+	}
+	for path, expected := range valid {
+		dir, err := c.Subdir(path)
+		if err != nil || dir != expected {
+			t.Errorf("%s: expected %s, got %s, %v", path, expected, dir, err)
+		}
+	}
+
+	invalid := []string{
+		"../other",
+		filepath.Join(root, "other"),
+		"2021/Porto",
+	}
+	for _, path := range invalid {
+		if dir, err := c.Subdir(path); !errors.Is(err, ErrNotSubdir) {
+			t.Errorf("%s: expected error, got %s, %v", path, dir, err)
+		}
+	}
+}
+
+func TestGetExportIdsPrivate(t *testing.T) {
+	thumbs := image.SourceConfig{Type: image.SourceTypeSqlite, Path: "photofield.thumbs.db"}
+	migrations := os.DirFS("../..")
+	source := image.NewSource(image.Config{
+		DataDir:      t.TempDir(),
+		SkipLoadInfo: true,
+		Sources:      image.SourceConfigs{thumbs},
+		Thumbnail:    image.ThumbnailConfig{Sink: thumbs},
+		Private:      image.PrivateConfig{Tags: []string{"private"}},
+	}, migrations, migrations)
+	defer source.Close()
+
+	dir := t.TempDir()
+	var ids []image.ImageId
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		id, err := source.IndexFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("unable to index %s: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+	for _, name := range []string{"private", "trip"} {
+		source.AddTag(name)
+		tag, ok := source.GetTag(name)
+		if !ok {
+			t.Fatalf("tag %s not found", name)
+		}
+		ch := make(chan image.ImageId, len(ids))
+		for _, id := range ids {
+			if name == "trip" || id == ids[1] {
+				ch <- id
+			}
+		}
+		close(ch)
+		if _, err := source.AddTagIds(tag.Id, ch); err != nil {
+			t.Fatalf("unable to tag: %v", err)
+		}
+	}
+
+	c := Collection{Dirs: []string{dir}}
+	tests := []struct {
+		query string
+		want  []image.ImageId
+	}{
+		{"", ids[:1]},
+		{"tag:trip", ids[:1]},
+		// Private files are only exported if asked for explicitly
+		{"tag:private", ids[1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var q *search.Query
+			if tt.query != "" {
+				var err error
+				q, err = search.Parse(tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := c.GetExportIds(source, image.ListOptions{Query: q})
+			if len(got) != len(tt.want) || got[0] != tt.want[0] {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
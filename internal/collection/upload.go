@@ -0,0 +1,162 @@
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"photofield/internal/image"
+	"strings"
+	"time"
+)
+
+var ErrUploadDisabled = errors.New("uploads are not enabled for the collection")
+var ErrInvalidName = errors.New("invalid file name")
+var ErrUnsupportedType = errors.New("unsupported file type")
+var ErrTooLarge = errors.New("file too large")
+
+const defaultUploadMaxSize = 4 << 30
+
+// UploadConfig configures uploading files to the collection, e.g. from a
+// phone upload client
+type UploadConfig struct {
+	// Dir the uploaded files are stored in, uploads are disabled if empty
+	Dir string `json:"dir"`
+	// Go time layout of the subdir of the upload dir to store the uploaded
+	// files in based on the date they were taken, e.g. "2006/01", stored in
+	// the upload dir directly if empty
+	Folders string `json:"folders"`
+	// Maximum size of an uploaded file in bytes
+	MaxSize int64 `json:"max_size"`
+}
+
+func (config UploadConfig) Enabled() bool {
+	return config.Dir != ""
+}
+
+// MaxBytes returns the maximum size of an uploaded file in bytes
+func (config UploadConfig) MaxBytes() int64 {
+	if config.MaxSize <= 0 {
+		return defaultUploadMaxSize
+	}
+	return config.MaxSize
+}
+
+// AddUploadDir adds the upload dir to the dirs of the collection, unless it
+// is already within one of them, so that uploaded files show up in it
+func (collection *Collection) AddUploadDir() {
+	if !collection.Upload.Enabled() {
+		return
+	}
+	upload := filepath.Clean(collection.Upload.Dir)
+	for _, dir := range collection.Dirs {
+		rel, err := filepath.Rel(filepath.Clean(dir), upload)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return
+		}
+	}
+	collection.Dirs = append(collection.Dirs, collection.Upload.Dir)
+}
+
+// UploadName returns the name of the uploaded file without any dirs, or an
+// error if it is hidden or not of a supported type
+func UploadName(name string, source *image.Source) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "/" || name == "." || strings.HasPrefix(name, ".") {
+		return "", ErrInvalidName
+	}
+	for _, ext := range source.ListExtensions {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+// reservePath reserves the path or the path with a numbered suffix if a
+// file already exists at the path, by creating an empty file there that
+// the uploaded file replaces. Creating it fails if the file exists, so
+// that concurrent uploads of files with the same name do not overwrite
+// each other.
+func reservePath(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return path, f.Close()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		path = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// Ingest stores the uploaded file in the upload dir, indexes it right away and
+// returns its id and path
+func (collection *Collection) Ingest(name string, r io.Reader, source *image.Source) (image.ImageId, string, error) {
+	config := collection.Upload
+	if !config.Enabled() {
+		return 0, "", ErrUploadDisabled
+	}
+	name, err := UploadName(name, source)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return 0, "", err
+	}
+	// Keep the name while uploading, so that the date can be parsed from it
+	tmpDir, err := os.MkdirTemp(config.Dir, ".upload-")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmp := filepath.Join(tmpDir, name)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, config.MaxBytes()+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if n > config.MaxBytes() {
+		return 0, "", ErrTooLarge
+	}
+
+	dir := config.Dir
+	if config.Folders != "" {
+		date := source.DecodeDate(tmp)
+		if date.IsZero() {
+			date = time.Now()
+		}
+		dir = filepath.Join(dir, date.Format(config.Folders))
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	path, err := reservePath(filepath.Join(dir, name))
+	if err != nil {
+		return 0, "", err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(path)
+		return 0, "", err
+	}
+
+	id, err := source.IndexFile(path)
+	return id, path, err
+}
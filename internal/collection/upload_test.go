@@ -0,0 +1,87 @@
+package collection
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"photofield/internal/image"
+)
+
+func TestUploadName(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+		err      error
+	}{
+		{"IMG_0001.jpg", "IMG_0001.jpg", nil},
+		{"../../etc/passwd.jpg", "passwd.jpg", nil},
+		{"C:\\Users\\me\\IMG_0002.jpg", "IMG_0002.jpg", nil},
+		{"/", "", ErrInvalidName},
+		{"..", "", ErrInvalidName},
+		{".hidden.jpg", "", ErrInvalidName},
+		{"notes.txt", "", ErrUnsupportedType},
+	}
+	source := &image.Source{Config: image.Config{ListExtensions: []string{".jpg"}}}
+	for _, c := range cases {
+		name, err := UploadName(c.name, source)
+		if name != c.expected || err != c.err {
+			t.Errorf("%s: expected %q %v, got %q %v", c.name, c.expected, c.err, name, err)
+		}
+	}
+}
+
+func TestAddUploadDir(t *testing.T) {
+	c := Collection{
+		Dirs:   []string{"/photos"},
+		Upload: UploadConfig{Dir: "/photos/uploads"},
+	}
+	c.AddUploadDir()
+	if len(c.Dirs) != 1 {
+		t.Errorf("expected upload dir within dirs not to be added, got %v", c.Dirs)
+	}
+
+	c = Collection{
+		Dirs:   []string{"/photos"},
+		Upload: UploadConfig{Dir: "/photos-uploads"},
+	}
+	c.AddUploadDir()
+	if len(c.Dirs) != 2 || c.Dirs[1] != "/photos-uploads" {
+		t.Errorf("expected upload dir to be added, got %v", c.Dirs)
+	}
+}
+
+func TestReservePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "IMG_0001.jpg")
+
+	const n = 20
+	paths := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := reservePath(path)
+			if err != nil {
+				t.Error(err)
+			}
+			paths <- p
+		}()
+	}
+	wg.Wait()
+	close(paths)
+
+	seen := make(map[string]bool)
+	for p := range paths {
+		if seen[p] {
+			t.Errorf("expected unique paths, got %s twice", p)
+		}
+		seen[p] = true
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != n {
+		t.Errorf("expected %d reserved files, got %d", n, len(entries))
+	}
+}
@@ -0,0 +1,179 @@
+// Package deepzoom splits large images into a pyramid of tiles in the Deep
+// Zoom (DZI) format, so that viewers only load the tiles of the visible
+// region at the current zoom instead of the whole image.
+package deepzoom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	goio "io"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// TileSize is the size of the tiles without the overlap, so that tiles
+	// including it are at most 256 pixels
+	TileSize = 254
+	// Overlap is the number of pixels each tile shares with its neighbors,
+	// hiding seams when viewers draw them scaled
+	Overlap = 1
+	Format  = "jpg"
+	Quality = 85
+)
+
+var ErrTileNotFound = errors.New("tile not found")
+
+// Pyramid is the layout of the tiles of an image. The highest level is the
+// image at full size and each level below it is half the size, down to
+// level 0 of a single pixel.
+type Pyramid struct {
+	Width  int
+	Height int
+}
+
+// MaxLevel returns the level of the image at full size
+func (p Pyramid) MaxLevel() int {
+	size := p.Width
+	if p.Height > size {
+		size = p.Height
+	}
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len(uint(size - 1))
+}
+
+// Size returns the size of the image at the level
+func (p Pyramid) Size(level int) (int, int) {
+	shift := p.MaxLevel() - level
+	if shift < 0 {
+		return 0, 0
+	}
+	scale := 1 << shift
+	return (p.Width + scale - 1) / scale, (p.Height + scale - 1) / scale
+}
+
+// Level returns the smallest level at least as large as the size, or the
+// full size level if the size is larger
+func (p Pyramid) Level(w, h int) int {
+	level := p.MaxLevel()
+	for level > 0 {
+		lw, lh := p.Size(level - 1)
+		if lw < w || lh < h {
+			break
+		}
+		level--
+	}
+	return level
+}
+
+// Tiles returns the number of columns and rows of tiles at the level
+func (p Pyramid) Tiles(level int) (int, int) {
+	w, h := p.Size(level)
+	return (w + TileSize - 1) / TileSize, (h + TileSize - 1) / TileSize
+}
+
+// Valid returns true if the level has a tile at the column and row
+func (p Pyramid) Valid(level, col, row int) bool {
+	if level < 0 || level > p.MaxLevel() || col < 0 || row < 0 {
+		return false
+	}
+	cols, rows := p.Tiles(level)
+	return col < cols && row < rows
+}
+
+// Rect returns the region of the level covered by the tile, including the
+// overlap with its neighbors
+func (p Pyramid) Rect(level, col, row int) image.Rectangle {
+	w, h := p.Size(level)
+	r := image.Rect(col*TileSize-Overlap, row*TileSize-Overlap, (col+1)*TileSize+Overlap, (row+1)*TileSize+Overlap)
+	return r.Intersect(image.Rect(0, 0, w, h))
+}
+
+// WriteDescriptor writes the DZI descriptor of the pyramid, which viewers
+// load the tiles by
+func (p Pyramid) WriteDescriptor(w goio.Writer) error {
+	type size struct {
+		Width  int `xml:"Width,attr"`
+		Height int `xml:"Height,attr"`
+	}
+	d := struct {
+		XMLName  xml.Name `xml:"http://schemas.microsoft.com/deepzoom/2008 Image"`
+		TileSize int      `xml:"TileSize,attr"`
+		Overlap  int      `xml:"Overlap,attr"`
+		Format   string   `xml:"Format,attr"`
+		Size     size     `xml:"Size"`
+	}{
+		TileSize: TileSize,
+		Overlap:  Overlap,
+		Format:   Format,
+		Size:     size{Width: p.Width, Height: p.Height},
+	}
+	if _, err := goio.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(d)
+}
+
+// Tile is an encoded tile of a pyramid
+type Tile struct {
+	Level int
+	Col   int
+	Row   int
+	Data  []byte
+}
+
+// Generate encodes all the tiles of the pyramid of the image, from the
+// full size level down, calling fn for each of them. The image is scaled
+// to the size of the pyramid if it differs.
+func (p Pyramid) Generate(img image.Image, fn func(t Tile) error) error {
+	if p.Width <= 0 || p.Height <= 0 {
+		return fmt.Errorf("invalid size %dx%d", p.Width, p.Height)
+	}
+
+	var b bytes.Buffer
+	for level := p.MaxLevel(); level >= 0; level-- {
+		w, h := p.Size(level)
+		img = scale(img, w, h)
+		cols, rows := p.Tiles(level)
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				r := p.Rect(level, col, row).Add(img.Bounds().Min)
+				sub := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+				draw.Draw(sub, sub.Bounds(), img, r.Min, draw.Src)
+				b.Reset()
+				if err := jpeg.Encode(&b, sub, &jpeg.Options{Quality: Quality}); err != nil {
+					return err
+				}
+				t := Tile{
+					Level: level,
+					Col:   col,
+					Row:   row,
+					Data:  append([]byte(nil), b.Bytes()...),
+				}
+				if err := fn(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scale returns the image scaled to the size, or the image itself if it
+// already has the size
+func scale(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	if b.Dx() == w && b.Dy() == h {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,92 @@
+package deepzoom
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+func TestPyramid(t *testing.T) {
+	p := Pyramid{Width: 1000, Height: 600}
+	if l := p.MaxLevel(); l != 10 {
+		t.Errorf("expected max level 10, got %d", l)
+	}
+	for _, c := range []struct {
+		level int
+		w, h  int
+		cols  int
+		rows  int
+	}{
+		{10, 1000, 600, 4, 3},
+		{9, 500, 300, 2, 2},
+		{8, 250, 150, 1, 1},
+		{0, 1, 1, 1, 1},
+	} {
+		w, h := p.Size(c.level)
+		cols, rows := p.Tiles(c.level)
+		if w != c.w || h != c.h || cols != c.cols || rows != c.rows {
+			t.Errorf("level %d: expected %dx%d in %dx%d tiles, got %dx%d in %dx%d tiles",
+				c.level, c.w, c.h, c.cols, c.rows, w, h, cols, rows)
+		}
+	}
+
+	if r := p.Rect(10, 0, 0); r != image.Rect(0, 0, 255, 255) {
+		t.Errorf("unexpected first tile %v", r)
+	}
+	if r := p.Rect(10, 1, 2); r != image.Rect(253, 507, 509, 600) {
+		t.Errorf("unexpected inner tile %v", r)
+	}
+	if p.Valid(10, 4, 0) || p.Valid(11, 0, 0) || !p.Valid(10, 3, 2) {
+		t.Errorf("unexpected valid tiles")
+	}
+
+	for _, c := range []struct {
+		w, h  int
+		level int
+	}{
+		{2000, 1200, 10},
+		{1000, 600, 10},
+		{400, 300, 9},
+		{250, 150, 8},
+		{0, 0, 0},
+	} {
+		if l := p.Level(c.w, c.h); l != c.level {
+			t.Errorf("%dx%d: expected level %d, got %d", c.w, c.h, c.level, l)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	p := Pyramid{Width: 300, Height: 200}
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	count := 0
+	err := p.Generate(img, func(tile Tile) error {
+		count++
+		conf, err := jpeg.DecodeConfig(bytes.NewReader(tile.Data))
+		if err != nil {
+			return err
+		}
+		r := p.Rect(tile.Level, tile.Col, tile.Row)
+		if conf.Width != r.Dx() || conf.Height != r.Dy() {
+			t.Errorf("tile %d/%d_%d: expected %v, got %dx%d", tile.Level, tile.Col, tile.Row, r, conf.Width, conf.Height)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two columns at the full size level and one tile each below
+	if count != 2+9 {
+		t.Errorf("expected 11 tiles, got %d", count)
+	}
+
+	var b bytes.Buffer
+	if err := p.WriteDescriptor(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<Size Width="300" Height="200"></Size>`) {
+		t.Errorf("unexpected descriptor %s", b.String())
+	}
+}
@@ -0,0 +1,376 @@
+// Package digest sends weekly emails of the photos added to the library and
+// the photos taken on the same day in earlier years over SMTP.
+package digest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/logging"
+)
+
+var serverLog = logging.Module("server")
+
+type Kind string
+
+const (
+	// Photos added to the library since the last digest
+	New Kind = "new"
+	// Photos taken on the day of the digest in earlier years
+	Memories Kind = "memories"
+)
+
+type Smtp struct {
+	Host string `json:"host"`
+	// 587 by default, STARTTLS is used if the server supports it
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+type Config struct {
+	Smtp Smtp `json:"smtp"`
+	// Recipients of the digest, disabled if empty
+	To []string `json:"to"`
+	// Day of the week and local time of day the digest is sent at
+	Weekday string `json:"weekday"`
+	Time    string `json:"time"`
+	// Public URL of Photofield that the links in the emails point to
+	BaseUrl string `json:"base_url"`
+	// Ids of the collections included, all if empty
+	Collections []string `json:"collections"`
+	// Sections included, all if empty
+	Kinds []Kind `json:"kinds"`
+	// Thumbnails attached per collection and section
+	MaxPhotos int `json:"max_photos"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func (config *Config) Enabled() bool {
+	return len(config.To) > 0
+}
+
+func (config *Config) Validate() error {
+	if !config.Enabled() {
+		return nil
+	}
+	if config.Smtp.Host == "" {
+		return fmt.Errorf("smtp.host is required")
+	}
+	if _, err := mail.ParseAddress(config.Smtp.From); err != nil {
+		return fmt.Errorf("smtp.from: %w", err)
+	}
+	for _, to := range config.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("to %s: %w", to, err)
+		}
+	}
+	if _, err := config.weekday(); err != nil {
+		return err
+	}
+	if _, _, err := config.timeOfDay(); err != nil {
+		return err
+	}
+	u, err := url.Parse(config.BaseUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("base_url: expected an http or https URL, got %q", config.BaseUrl)
+	}
+	for _, k := range config.Kinds {
+		if k != New && k != Memories {
+			return fmt.Errorf("unknown kind %s, use new or memories", k)
+		}
+	}
+	return nil
+}
+
+func (config Config) weekday() (time.Weekday, error) {
+	if config.Weekday == "" {
+		return time.Sunday, nil
+	}
+	d, ok := weekdays[strings.ToLower(config.Weekday)]
+	if !ok {
+		return 0, fmt.Errorf("weekday: unknown day %s", config.Weekday)
+	}
+	return d, nil
+}
+
+func (config Config) timeOfDay() (hour int, minute int, err error) {
+	if config.Time == "" {
+		return 9, 0, nil
+	}
+	t, err := time.Parse("15:04", config.Time)
+	if err != nil {
+		return 0, 0, fmt.Errorf("time: expected HH:MM, got %s", config.Time)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// Includes reports whether the section of the kind is sent
+func (config Config) Includes(kind Kind) bool {
+	if len(config.Kinds) == 0 {
+		return true
+	}
+	for _, k := range config.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludesCollection reports whether the collection is part of the digest
+func (config Config) IncludesCollection(id string) bool {
+	if len(config.Collections) == 0 {
+		return true
+	}
+	for _, c := range config.Collections {
+		if c == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (config Config) PhotoLimit() int {
+	if config.MaxPhotos <= 0 {
+		return 6
+	}
+	return config.MaxPhotos
+}
+
+// Next returns the first time the digest is scheduled at after now, in the
+// time zone of now
+func (config Config) Next(now time.Time) time.Time {
+	weekday, _ := config.weekday()
+	hour, minute, _ := config.timeOfDay()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	next = next.AddDate(0, 0, (int(weekday)-int(next.Weekday())+7)%7)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+type Photo struct {
+	Name string
+	// Link to the original file
+	Link string
+	// Shown below the thumbnail, e.g. 3 years ago
+	Caption string
+	// JPEG thumbnail attached to the email
+	Thumbnail []byte
+}
+
+type Section struct {
+	Title string
+	// Link to the photos of the section in Photofield
+	Link   string
+	Photos []Photo
+	// Number of photos in the section, more than the attached ones if the
+	// section was truncated
+	Count int
+}
+
+type Digest struct {
+	Subject  string
+	Sections []Section
+}
+
+// Empty reports whether the digest has no photos to send
+func (d Digest) Empty() bool {
+	for _, s := range d.Sections {
+		if len(s.Photos) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// html renders the body of the email, referring to the attached thumbnails
+// by their content ids
+func (d Digest) html() string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><body style="font-family: sans-serif">`)
+	for i, s := range d.Sections {
+		fmt.Fprintf(&b, `<h2><a href="%s">%s</a></h2>`, html.EscapeString(s.Link), html.EscapeString(s.Title))
+		b.WriteString(`<p>`)
+		for j, p := range s.Photos {
+			fmt.Fprintf(&b,
+				`<a href="%s" style="display: inline-block; margin: 4px; text-align: center"><img src="cid:%s" alt="%s" height="160"><br><small>%s</small></a>`,
+				html.EscapeString(p.Link),
+				contentId(i, j),
+				html.EscapeString(p.Name),
+				html.EscapeString(p.Caption),
+			)
+		}
+		b.WriteString(`</p>`)
+		if more := s.Count - len(s.Photos); more > 0 {
+			fmt.Fprintf(&b, `<p><a href="%s">and %d more</a></p>`, html.EscapeString(s.Link), more)
+		}
+	}
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+func contentId(section int, photo int) string {
+	return fmt.Sprintf("photo-%d-%d@photofield", section, photo)
+}
+
+// Message returns the digest as a MIME email with the thumbnails attached
+// inline
+func (d Digest) Message(from string, to []string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/related; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(part, []byte(d.html())); err != nil {
+		return nil, err
+	}
+
+	for i, s := range d.Sections {
+		for j, p := range s.Photos {
+			name := strings.TrimSuffix(p.Name, ".jpg") + ".jpg"
+			part, err := w.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {"image/jpeg"},
+				"Content-Transfer-Encoding": {"base64"},
+				"Content-Id":                {"<" + contentId(i, j) + ">"},
+				"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": name})},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeBase64(part, p.Thumbnail); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes the data base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// Build returns the digest of the photos since the previous one
+type Build func(since time.Time, now time.Time) (Digest, error)
+
+// Mailer sends the digest to the recipients on schedule
+type Mailer struct {
+	config Config
+	build  Build
+	send   func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewMailer(config Config, build Build) *Mailer {
+	return &Mailer{
+		config: config,
+		build:  build,
+		send:   smtp.SendMail,
+	}
+}
+
+// Run sends the digest on schedule until the process exits
+func (m *Mailer) Run() {
+	now := time.Now()
+	last := now.AddDate(0, 0, -7)
+	for {
+		next := m.config.Next(now)
+		serverLog.Info("digest scheduled", "next", next.Format(time.RFC1123))
+		time.Sleep(time.Until(next))
+		now = time.Now()
+		if err := m.Send(last, now); err != nil {
+			serverLog.Error("unable to send digest", "err", err)
+		}
+		last = now
+	}
+}
+
+// Send builds the digest of the photos since the time and emails it, unless
+// it is empty
+func (m *Mailer) Send(since time.Time, now time.Time) error {
+	d, err := m.build(since, now)
+	if err != nil {
+		return err
+	}
+	if d.Empty() {
+		serverLog.Info("digest has nothing new, skipping")
+		return nil
+	}
+	msg, err := d.Message(m.config.Smtp.From, m.config.To, now)
+	if err != nil {
+		return err
+	}
+
+	port := m.config.Smtp.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(m.config.Smtp.Host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if m.config.Smtp.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Smtp.Username, m.config.Smtp.Password, m.config.Smtp.Host)
+	}
+	from, _ := mail.ParseAddress(m.config.Smtp.From)
+	to := make([]string, len(m.config.To))
+	for i, t := range m.config.To {
+		a, err := mail.ParseAddress(t)
+		if err != nil {
+			return err
+		}
+		to[i] = a.Address
+	}
+	if err := m.send(addr, auth, from.Address, to, msg); err != nil {
+		return err
+	}
+	serverLog.Info("digest sent", "recipients", len(to))
+	return nil
+}
@@ -0,0 +1,150 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	config := Config{Weekday: "monday", Time: "08:30"}
+	// Wednesday
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		now  time.Time
+		next time.Time
+	}{
+		{now, time.Date(2024, 5, 13, 8, 30, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 8, 30, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 13, 8, 30, 0, 0, time.UTC), time.Date(2024, 5, 20, 8, 30, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if next := config.Next(c.now); !next.Equal(c.next) {
+			t.Errorf("%v: expected %v, got %v", c.now, c.next, next)
+		}
+	}
+	if next := (Config{}).Next(now); next.Weekday() != time.Sunday || next.Hour() != 9 {
+		t.Errorf("expected sunday 9:00 by default, got %v", next)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{
+		Smtp:    Smtp{Host: "smtp.example.com", From: "Photofield <photos@example.com>"},
+		To:      []string{"me@example.com"},
+		BaseUrl: "https://photos.example.com",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected valid, got %s", err)
+	}
+	for _, modify := range []func(c *Config){
+		func(c *Config) { c.Smtp.Host = "" },
+		func(c *Config) { c.To = []string{"nope"} },
+		func(c *Config) { c.Weekday = "someday" },
+		func(c *Config) { c.Time = "25:00" },
+		func(c *Config) { c.BaseUrl = "" },
+		func(c *Config) { c.Kinds = []Kind{"old"} },
+	} {
+		c := valid
+		modify(&c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+	if err := (&Config{}).Validate(); err != nil {
+		t.Errorf("expected disabled to be valid, got %s", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	config := Config{
+		Smtp: Smtp{Host: "smtp.example.com", From: "Photofield <photos@example.com>"},
+		To:   []string{"Me <me@example.com>"},
+	}
+	build := func(since, now time.Time) (Digest, error) {
+		return Digest{
+			Subject: "Your week in photos",
+			Sections: []Section{{
+				Title: "New in Vacation",
+				Link:  "https://photos.example.com/collections/vacation",
+				Photos: []Photo{
+					{Name: "a.jpg", Link: "https://photos.example.com/api/files/1/original/a.jpg", Thumbnail: []byte("jpeg a")},
+					{Name: "b.png", Link: "https://photos.example.com/api/files/2/original/b.png", Thumbnail: []byte("jpeg b")},
+				},
+				Count: 5,
+			}},
+		}, nil
+	}
+	m := NewMailer(config, build)
+	var sent []byte
+	m.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" {
+			t.Errorf("expected default port, got %s", addr)
+		}
+		if from != "photos@example.com" || len(to) != 1 || to[0] != "me@example.com" {
+			t.Errorf("unexpected envelope %s %v", from, to)
+		}
+		sent = msg
+		return nil
+	}
+	now := time.Date(2024, 5, 12, 9, 0, 0, 0, time.UTC)
+	if err := m.Send(now.AddDate(0, 0, -7), now); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(sent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := msg.Header.Get("Subject"); s != "Your week in photos" {
+		t.Errorf("unexpected subject %s", s)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/related" {
+		t.Fatalf("unexpected content type %s", msg.Header.Get("Content-Type"))
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var types, ids []string
+	var body string
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, p.Header.Get("Content-Type"))
+		ids = append(ids, p.Header.Get("Content-Id"))
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/html") {
+			b, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+			body = string(b)
+		}
+	}
+	if len(types) != 3 || types[1] != "image/jpeg" || ids[2] != "<photo-0-1@photofield>" {
+		t.Errorf("unexpected parts %v %v", types, ids)
+	}
+	if !strings.Contains(body, `src="cid:photo-0-0@photofield"`) || !strings.Contains(body, "and 3 more") {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestSendEmpty(t *testing.T) {
+	m := NewMailer(Config{To: []string{"me@example.com"}}, func(since, now time.Time) (Digest, error) {
+		return Digest{Sections: []Section{{Title: "Empty"}}}, nil
+	})
+	m.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		t.Errorf("expected empty digest not to be sent")
+		return nil
+	}
+	if err := m.Send(time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
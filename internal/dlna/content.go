@@ -0,0 +1,313 @@
+package dlna
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/search"
+)
+
+// maxBrowseCount limits the number of objects returned at once, renderers
+// page through the rest using the total number of matches
+const maxBrowseCount = 500
+
+// Object ids are "0" for the root, "c/<collection>" for collections, "t"
+// for the tags, "t/<tag>" for a tag and "<container>/<file>" for files.
+// Tag names are escaped, as they may contain slashes.
+const (
+	rootId = "0"
+	tagsId = "t"
+)
+
+// object is a container or a file item in the content directory
+type object struct {
+	Id       string
+	ParentId string
+	Title    string
+	// Container if nil
+	File *image.SourcedInfo
+	Path string
+}
+
+func (s *Server) contentDirectory(r *http.Request, a action) (string, []arg, error) {
+	switch a.Name {
+	case "GetSearchCapabilities":
+		return contentDirectoryType, []arg{{"SearchCaps", ""}}, nil
+	case "GetSortCapabilities":
+		return contentDirectoryType, []arg{{"SortCaps", ""}}, nil
+	case "GetSystemUpdateID":
+		return contentDirectoryType, []arg{{"Id", s.updateId()}}, nil
+	case "Browse":
+		start, err := strconv.Atoi(a.Args["StartingIndex"])
+		if err != nil || start < 0 {
+			return "", nil, errInvalidArgs
+		}
+		count, err := strconv.Atoi(a.Args["RequestedCount"])
+		if err != nil || count < 0 {
+			return "", nil, errInvalidArgs
+		}
+		if count == 0 || count > maxBrowseCount {
+			count = maxBrowseCount
+		}
+
+		var objects []object
+		total := 0
+		switch a.Args["BrowseFlag"] {
+		case "BrowseMetadata":
+			o, err := s.object(a.Args["ObjectID"])
+			if err != nil {
+				return "", nil, err
+			}
+			objects = []object{o}
+			total = 1
+		case "BrowseDirectChildren":
+			objects, total, err = s.children(a.Args["ObjectID"], start, count)
+			if err != nil {
+				return "", nil, err
+			}
+		default:
+			return "", nil, errInvalidArgs
+		}
+
+		base := fmt.Sprintf("http://%s%s", r.Host, s.prefix)
+		return contentDirectoryType, []arg{
+			{"Result", s.didl(objects, base)},
+			{"NumberReturned", strconv.Itoa(len(objects))},
+			{"TotalMatches", strconv.Itoa(total)},
+			{"UpdateID", s.updateId()},
+		}, nil
+	}
+	return "", nil, errInvalidAction
+}
+
+// updateId changes on restart, so that renderers do not keep showing
+// stale listings after the configuration changed
+func (s *Server) updateId() string {
+	return strconv.FormatUint(uint64(uint32(s.started.Unix())), 10)
+}
+
+func parseId(s string) (image.ImageId, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return image.ImageId(id), nil
+}
+
+func tagQuery(name string) *search.Query {
+	return &search.Query{
+		Terms: []*search.Term{
+			{Qualifier: &search.Qualifier{Key: "tag", Value: name}},
+		},
+	}
+}
+
+// container returns the container with the id, or the file id if the id
+// refers to a file within a container
+func (s *Server) container(id string) (object, string, error) {
+	switch {
+	case id == rootId:
+		return object{Id: rootId, ParentId: "-1", Title: s.config.name()}, "", nil
+	case id == tagsId:
+		return object{Id: tagsId, ParentId: rootId, Title: "Tags"}, "", nil
+	case strings.HasPrefix(id, "c/"):
+		cid, file, _ := strings.Cut(strings.TrimPrefix(id, "c/"), "/")
+		c := s.collection(cid)
+		if c == nil {
+			return object{}, "", errNoSuchObject
+		}
+		return object{Id: "c/" + cid, ParentId: rootId, Title: c.Name}, file, nil
+	case strings.HasPrefix(id, "t/"):
+		escaped, file, _ := strings.Cut(strings.TrimPrefix(id, "t/"), "/")
+		name, err := url.PathUnescape(escaped)
+		if err != nil {
+			return object{}, "", errNoSuchObject
+		}
+		if _, ok := s.source.GetTag(name); !ok || s.private(name) {
+			return object{}, "", errNoSuchObject
+		}
+		return object{Id: "t/" + escaped, ParentId: tagsId, Title: name}, file, nil
+	}
+	return object{}, "", errNoSuchObject
+}
+
+func (s *Server) object(id string) (object, error) {
+	c, file, err := s.container(id)
+	if err != nil || file == "" {
+		return c, err
+	}
+	fid, err := parseId(file)
+	if err != nil {
+		return object{}, errNoSuchObject
+	}
+	path, err := s.source.GetImagePath(fid)
+	if err != nil || !s.allowed(path) {
+		return object{}, errNoSuchObject
+	}
+	info := image.SourcedInfo{Id: fid, Info: s.source.GetInfo(fid)}
+	return s.fileObject(c.Id, info, path), nil
+}
+
+func (s *Server) fileObject(parent string, info image.SourcedInfo, path string) object {
+	return object{
+		Id:       fmt.Sprintf("%s/%d", parent, info.Id),
+		ParentId: parent,
+		Title:    filepath.Base(path),
+		File:     &info,
+		Path:     path,
+	}
+}
+
+func (s *Server) children(id string, start, count int) ([]object, int, error) {
+	c, file, err := s.container(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if file != "" {
+		// Files have no children
+		return nil, 0, nil
+	}
+
+	switch {
+	case id == rootId:
+		var all []object
+		for _, c := range s.exposed() {
+			all = append(all, object{Id: "c/" + c.Id, ParentId: rootId, Title: c.Name})
+		}
+		all = append(all, object{Id: tagsId, ParentId: rootId, Title: "Tags"})
+		return page(all, start, count), len(all), nil
+
+	case id == tagsId:
+		var all []object
+		for t := range s.source.ListTags("", 10000) {
+			if s.private(t.Name) {
+				continue
+			}
+			all = append(all, object{
+				Id:       "t/" + url.PathEscape(t.Name),
+				ParentId: tagsId,
+				Title:    t.Name,
+			})
+		}
+		return page(all, start, count), len(all), nil
+
+	case strings.HasPrefix(id, "c/"):
+		col := s.collection(strings.TrimPrefix(c.Id, "c/"))
+		dirs := append([]string(nil), col.Dirs...)
+		total := s.source.GetDirsCount(append([]string(nil), dirs...))
+		objects := s.files(c.Id, dirs, image.ListOptions{
+			OrderBy: image.DateDesc,
+			Limit:   start + count,
+			Ignore:  col.Ignore,
+			Hide:    s.source.Private.Tags,
+		}, start, count)
+		return objects, total, nil
+
+	default:
+		// Tags span all exposed collections and are usually small enough to
+		// be counted by listing them
+		objects := s.files(c.Id, s.dirs(), image.ListOptions{
+			OrderBy: image.DateDesc,
+			Query:   tagQuery(c.Title),
+			Hide:    s.source.Private.Tags,
+		}, 0, -1)
+		return page(objects, start, count), len(objects), nil
+	}
+}
+
+// files lists the files in the dirs as objects, skipping the first start
+// files and returning at most count files, or all if count is negative
+func (s *Server) files(parent string, dirs []string, options image.ListOptions, start, count int) []object {
+	var objects []object
+	i := 0
+	for info := range s.source.ListInfos(dirs, options) {
+		i++
+		if i <= start || (count >= 0 && len(objects) >= count) {
+			continue
+		}
+		path, err := s.source.GetImagePath(info.Id)
+		if err != nil {
+			continue
+		}
+		objects = append(objects, s.fileObject(parent, info, path))
+	}
+	return objects
+}
+
+func page(objects []object, start, count int) []object {
+	if start >= len(objects) {
+		return nil
+	}
+	objects = objects[start:]
+	if count < len(objects) {
+		objects = objects[:count]
+	}
+	return objects
+}
+
+func mimeType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".jpg", ".jpeg":
+		// Some systems register image/jpg, which renderers do not understand
+		return "image/jpeg"
+	case ".heic", ".heif":
+		return "image/heic"
+	case ".mkv":
+		return "video/x-matroska"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		t, _, _ = strings.Cut(t, ";")
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// didl returns the DIDL-Lite listing of the objects with the media linked
+// relative to the base URL
+func (s *Server) didl(objects []object, base string) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+	for _, o := range objects {
+		if o.File == nil {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" restricted="1" searchable="0">`, escape(o.Id), escape(o.ParentId))
+			fmt.Fprintf(&b, `<dc:title>%s</dc:title>`, escape(o.Title))
+			b.WriteString(`<upnp:class>object.container.storageFolder</upnp:class>`)
+			b.WriteString(`</container>`)
+			continue
+		}
+
+		class := "object.item.imageItem.photo"
+		if s.source.IsSupportedVideo(o.Path) {
+			class = "object.item.videoItem"
+		}
+		name := url.PathEscape(o.Title)
+		fileUrl := fmt.Sprintf("%s/files/%d/%s", base, o.File.Id, name)
+		thumbUrl := fmt.Sprintf("%s/thumbs/%d/%s.jpg", base, o.File.Id, name)
+
+		fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1">`, escape(o.Id), escape(o.ParentId))
+		fmt.Fprintf(&b, `<dc:title>%s</dc:title>`, escape(o.Title))
+		fmt.Fprintf(&b, `<upnp:class>%s</upnp:class>`, class)
+		// Files without metadata yet have the unix epoch as their date
+		if o.File.DateTime.After(time.Unix(0, 0)) {
+			fmt.Fprintf(&b, `<dc:date>%s</dc:date>`, o.File.DateTime.Format("2006-01-02T15:04:05"))
+		}
+		fmt.Fprintf(&b, `<upnp:albumArtURI dlna:profileID="JPEG_TN">%s</upnp:albumArtURI>`, escape(thumbUrl))
+		fmt.Fprintf(&b, `<res protocolInfo="http-get:*:%s:*"`, mimeType(o.Path))
+		if o.File.Width > 0 && o.File.Height > 0 {
+			fmt.Fprintf(&b, ` resolution="%dx%d"`, o.File.Width, o.File.Height)
+		}
+		fmt.Fprintf(&b, `>%s</res>`, escape(fileUrl))
+		fmt.Fprintf(&b, `<res protocolInfo="http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN">%s</res>`, escape(thumbUrl))
+		b.WriteString(`</item>`)
+	}
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type arg struct {
+	Name  string
+	Value string
+}
+
+// upnpError is returned to the control point as a SOAP fault
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e upnpError) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Description)
+}
+
+var (
+	errInvalidAction = upnpError{401, "Invalid Action"}
+	errInvalidArgs   = upnpError{402, "Invalid Args"}
+	errNoSuchObject  = upnpError{701, "No such object"}
+)
+
+// action is an invoked SOAP action with its arguments
+type action struct {
+	Name string
+	Args map[string]string
+}
+
+type envelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func parseAction(r *http.Request) (action, error) {
+	var env envelope
+	if err := xml.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16)).Decode(&env); err != nil {
+		return action{}, err
+	}
+	a := action{
+		Name: env.Body.Action.XMLName.Local,
+		Args: make(map[string]string, len(env.Body.Action.Args)),
+	}
+	for _, arg := range env.Body.Action.Args {
+		a.Args[arg.XMLName.Local] = arg.Value
+	}
+	return a, nil
+}
+
+// serveControl invokes the action of the SOAP request and writes the result
+// or the fault
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request, invoke func(r *http.Request, a action) (string, []arg, error)) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("Ext", "")
+
+	a, err := parseAction(r)
+	if err != nil {
+		writeFault(w, errInvalidAction)
+		return
+	}
+	serviceType, out, err := invoke(r, a)
+	if err != nil {
+		uerr, ok := err.(upnpError)
+		if !ok {
+			serverLog.Warn("dlna action failed", "action", a.Name, "err", err)
+			uerr = upnpError{501, "Action Failed"}
+		}
+		writeFault(w, uerr)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="%s">`, a.Name, serviceType)
+	for _, o := range out {
+		fmt.Fprintf(&b, "<%s>%s</%s>", o.Name, escape(o.Value), o.Name)
+	}
+	fmt.Fprintf(&b, `</u:%sResponse>`, a.Name)
+	b.WriteString(`</s:Body></s:Envelope>`)
+	w.Write([]byte(b.String()))
+}
+
+func writeFault(w http.ResponseWriter, err upnpError) {
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+		`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError>`+
+		`</detail></s:Fault></s:Body></s:Envelope>`, err.Code, escape(err.Description))
+}
+
+// protocolInfos lists the formats served, most renderers only check that
+// the server is a source at all
+var protocolInfos = []string{
+	"http-get:*:image/jpeg:*",
+	"http-get:*:image/png:*",
+	"http-get:*:image/gif:*",
+	"http-get:*:image/webp:*",
+	"http-get:*:image/heic:*",
+	"http-get:*:video/mp4:*",
+	"http-get:*:video/quicktime:*",
+	"http-get:*:video/x-matroska:*",
+	"http-get:*:video/webm:*",
+	"http-get:*:video/x-msvideo:*",
+}
+
+func (s *Server) connectionManager(r *http.Request, a action) (string, []arg, error) {
+	switch a.Name {
+	case "GetProtocolInfo":
+		return connectionManagerType, []arg{
+			{"Source", strings.Join(protocolInfos, ",")},
+			{"Sink", ""},
+		}, nil
+	case "GetCurrentConnectionIDs":
+		return connectionManagerType, []arg{
+			{"ConnectionIDs", "0"},
+		}, nil
+	case "GetCurrentConnectionInfo":
+		return connectionManagerType, []arg{
+			{"RcsID", "-1"},
+			{"AVTransportID", "-1"},
+			{"ProtocolInfo", ""},
+			{"PeerConnectionManager", ""},
+			{"PeerConnectionID", "-1"},
+			{"Direction", "Output"},
+			{"Status", "OK"},
+		}, nil
+	}
+	return "", nil, errInvalidAction
+}
@@ -0,0 +1,228 @@
+package dlna
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/internal/collection"
+	"photofield/internal/image"
+	"photofield/internal/logging"
+)
+
+var serverLog = logging.Module("server")
+
+// Config configures the DLNA / UPnP media server, which makes collections
+// and tags browsable from TVs and other renderers on the local network
+type Config struct {
+	Enable bool `json:"enable"`
+	// Name shown to the renderers, defaults to "Photofield on <hostname>"
+	Name string `json:"name"`
+	// Ids of the collections to expose, all collections if empty
+	Collections []string `json:"collections"`
+	// Thumbnail source to use for the album art
+	Thumbnail string `json:"thumbnail"`
+	// How often the server is announced on the network
+	NotifyInterval string `json:"notify_interval"`
+}
+
+func (config Config) name() string {
+	if config.Name != "" {
+		return config.Name
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "Photofield"
+	}
+	return fmt.Sprintf("Photofield on %s", hostname)
+}
+
+func (config Config) thumbnail() string {
+	if config.Thumbnail == "" {
+		return "sqlite"
+	}
+	return config.Thumbnail
+}
+
+func (config Config) notifyInterval() (time.Duration, error) {
+	if config.NotifyInterval == "" {
+		return 15 * time.Minute, nil
+	}
+	return time.ParseDuration(config.NotifyInterval)
+}
+
+func (config *Config) Validate() error {
+	if !config.Enable {
+		return nil
+	}
+	d, err := config.notifyInterval()
+	if err != nil {
+		return fmt.Errorf("notify_interval: %w", err)
+	}
+	if d < time.Minute {
+		return fmt.Errorf("notify_interval must be at least 1m")
+	}
+	return nil
+}
+
+// uuid returns a stable device UUID derived from the name, so that
+// renderers recognize the server across restarts
+func (config Config) uuid() string {
+	h := sha1.Sum([]byte("photofield-dlna:" + config.name()))
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// Server serves the device description, the ContentDirectory and
+// ConnectionManager services and the media files
+type Server struct {
+	config      Config
+	uuid        string
+	prefix      string
+	collections func() []collection.Collection
+	source      *image.Source
+	serveFile   func(w http.ResponseWriter, r *http.Request, path string)
+	started     time.Time
+	advertiser  *advertiser
+}
+
+// New returns a server with its HTTP endpoints under the prefix. Files are
+// served using serveFile, so that files inside archives work as well.
+func New(config Config, prefix string, collections func() []collection.Collection, source *image.Source, serveFile func(w http.ResponseWriter, r *http.Request, path string)) *Server {
+	return &Server{
+		config:      config,
+		uuid:        config.uuid(),
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		collections: collections,
+		source:      source,
+		serveFile:   serveFile,
+		started:     time.Now(),
+	}
+}
+
+// exposed returns the collections configured to be exposed
+func (s *Server) exposed() []collection.Collection {
+	all := s.collections()
+	if len(s.config.Collections) == 0 {
+		return all
+	}
+	exposed := make([]collection.Collection, 0, len(s.config.Collections))
+	for _, id := range s.config.Collections {
+		for _, c := range all {
+			if c.Id == id {
+				exposed = append(exposed, c)
+				break
+			}
+		}
+	}
+	return exposed
+}
+
+func (s *Server) collection(id string) *collection.Collection {
+	for _, c := range s.exposed() {
+		if c.Id == id {
+			return &c
+		}
+	}
+	return nil
+}
+
+// dirs returns the dirs of all exposed collections
+func (s *Server) dirs() []string {
+	var dirs []string
+	for _, c := range s.exposed() {
+		dirs = append(dirs, c.Dirs...)
+	}
+	return dirs
+}
+
+// allowed returns true if the file is in one of the exposed collections
+func (s *Server) allowed(path string) bool {
+	for _, dir := range s.dirs() {
+		dir = strings.TrimSuffix(s.source.Paths.Normalize(dir), string(filepath.Separator))
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// private returns true if the tag marks private files, which are left out
+// of the listings
+func (s *Server) private(name string) bool {
+	for _, t := range s.source.Private.Tags {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, s.prefix)
+	switch {
+	case p == "/device.xml":
+		s.serveXML(w, s.deviceDescription())
+	case p == "/ContentDirectory.xml":
+		s.serveXML(w, contentDirectorySCPD)
+	case p == "/ConnectionManager.xml":
+		s.serveXML(w, connectionManagerSCPD)
+	case p == "/control/ContentDirectory" && r.Method == http.MethodPost:
+		s.serveControl(w, r, s.contentDirectory)
+	case p == "/control/ConnectionManager" && r.Method == http.MethodPost:
+		s.serveControl(w, r, s.connectionManager)
+	case strings.HasPrefix(p, "/files/"):
+		s.serveMedia(w, r, strings.TrimPrefix(p, "/files/"), false)
+	case strings.HasPrefix(p, "/thumbs/"):
+		s.serveMedia(w, r, strings.TrimPrefix(p, "/thumbs/"), true)
+	case strings.HasPrefix(p, "/event/"):
+		// Eventing is not supported, but some renderers insist on subscribing
+		w.Header().Set("SID", s.uuid)
+		w.Header().Set("TIMEOUT", "Second-1800")
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveXML(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write([]byte(body))
+}
+
+// serveMedia serves the original or the thumbnail of a file, the path is
+// "<id>/<filename>" with the filename only there for the renderers
+func (s *Server) serveMedia(w http.ResponseWriter, r *http.Request, p string, thumb bool) {
+	idStr, filename, _ := strings.Cut(p, "/")
+	id, err := parseId(idStr)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := s.source.GetImagePath(id)
+	if err != nil || !s.allowed(path) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("transferMode.dlna.org", "Interactive")
+	if !thumb {
+		w.Header().Set("transferMode.dlna.org", "Streaming")
+		s.serveFile(w, r, path)
+		return
+	}
+	found := false
+	s.source.GetImageReader(id, s.config.thumbnail(), func(rs io.ReadSeeker, err error) {
+		if err != nil {
+			return
+		}
+		found = true
+		http.ServeContent(w, r, filename, time.Time{}, rs)
+	})
+	if !found {
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,203 @@
+package dlna
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"photofield/internal/collection"
+	"photofield/internal/image"
+)
+
+func browse(t *testing.T, s *Server, objectId string, flag string) (int, string) {
+	t.Helper()
+	body := `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>` + objectId + `</ObjectID><BrowseFlag>` + flag + `</BrowseFlag><Filter>*</Filter>
+<StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount><SortCriteria></SortCriteria>
+</u:Browse></s:Body></s:Envelope>`
+	req := httptest.NewRequest(http.MethodPost, "/dlna/control/ContentDirectory", strings.NewReader(body))
+	req.Header.Set("SOAPAction", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestBrowse(t *testing.T) {
+	collections := []collection.Collection{
+		{Id: "vacation", Name: "Vacation & Trips"},
+		{Id: "private", Name: "Private"},
+	}
+	s := New(Config{Name: "Test", Collections: []string{"vacation"}}, "/dlna", func() []collection.Collection {
+		return collections
+	}, nil, nil)
+
+	code, body := browse(t, s, "0", "BrowseDirectChildren")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", code, body)
+	}
+	for _, expected := range []string{
+		"<u:BrowseResponse", "<NumberReturned>2</NumberReturned>", "<TotalMatches>2</TotalMatches>",
+		// The DIDL-Lite result is escaped within the response
+		"&lt;container id=&#34;c/vacation&#34; parentID=&#34;0&#34;",
+		"Vacation &amp;amp; Trips",
+		"&lt;container id=&#34;t&#34;",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "private") {
+		t.Errorf("expected private collection not to be exposed: %s", body)
+	}
+
+	code, body = browse(t, s, "0", "BrowseMetadata")
+	if code != http.StatusOK || !strings.Contains(body, "parentID=&#34;-1&#34;") {
+		t.Errorf("expected root metadata, got %d: %s", code, body)
+	}
+
+	for _, id := range []string{"c/private", "x", "c/vacation/abc"} {
+		code, body = browse(t, s, id, "BrowseMetadata")
+		if code != http.StatusInternalServerError || !strings.Contains(body, "<errorCode>701</errorCode>") {
+			t.Errorf("expected no such object for %s, got %d: %s", id, code, body)
+		}
+	}
+
+	code, body = browse(t, s, "0", "BrowseEverything")
+	if code != http.StatusInternalServerError || !strings.Contains(body, "<errorCode>402</errorCode>") {
+		t.Errorf("expected invalid args, got %d: %s", code, body)
+	}
+}
+
+// newTestSource returns a source with a cache database in a temporary
+// dir, indexing the files with the paths without reading them
+func newTestSource(t *testing.T, config image.Config, paths ...string) (*image.Source, []image.ImageId) {
+	t.Helper()
+	config.DataDir = t.TempDir()
+	config.SkipLoadInfo = true
+	// The sink is the thumbnail database of the sources
+	thumbs := image.SourceConfig{Type: image.SourceTypeSqlite, Path: "photofield.thumbs.db"}
+	config.Sources = image.SourceConfigs{thumbs}
+	config.Thumbnail.Sink = thumbs
+	migrations := os.DirFS("../..")
+	source := image.NewSource(config, migrations, migrations)
+	t.Cleanup(source.Close)
+	ids := make([]image.ImageId, len(paths))
+	for i, path := range paths {
+		id, err := source.IndexFile(path)
+		if err != nil {
+			t.Fatalf("unable to index %s: %v", path, err)
+		}
+		ids[i] = id
+	}
+	return source, ids
+}
+
+func TestBrowsePrivate(t *testing.T) {
+	dir := t.TempDir()
+	source, ids := newTestSource(t, image.Config{
+		Private: image.PrivateConfig{Tags: []string{"private"}},
+	}, filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg"))
+
+	for _, name := range []string{"private", "fav"} {
+		source.AddTag(name)
+		tag, ok := source.GetTag(name)
+		if !ok {
+			t.Fatalf("tag %s not found", name)
+		}
+		ch := make(chan image.ImageId, len(ids))
+		for _, id := range ids {
+			if name == "fav" || id == ids[1] {
+				ch <- id
+			}
+		}
+		close(ch)
+		if _, err := source.AddTagIds(tag.Id, ch); err != nil {
+			t.Fatalf("unable to tag: %v", err)
+		}
+	}
+
+	collections := []collection.Collection{{Id: "photos", Name: "Photos", Dirs: []string{dir}}}
+	s := New(Config{Name: "Test"}, "/dlna", func() []collection.Collection {
+		return collections
+	}, source, nil)
+
+	public := fmt.Sprintf("/%d&#34;", ids[0])
+	private := fmt.Sprintf("/%d&#34;", ids[1])
+	for _, id := range []string{"c/photos", "t/fav"} {
+		code, body := browse(t, s, id, "BrowseDirectChildren")
+		if code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", id, code, body)
+		}
+		if !strings.Contains(body, public) {
+			t.Errorf("expected %s to list %d: %s", id, ids[0], body)
+		}
+		if strings.Contains(body, private) {
+			t.Errorf("expected %s not to list private %d: %s", id, ids[1], body)
+		}
+	}
+
+	_, body := browse(t, s, "t", "BrowseDirectChildren")
+	if !strings.Contains(body, "t/fav") || strings.Contains(body, "t/private") {
+		t.Errorf("expected only the fav tag to be listed: %s", body)
+	}
+	code, body := browse(t, s, "t/private", "BrowseDirectChildren")
+	if code != http.StatusInternalServerError || !strings.Contains(body, "<errorCode>701</errorCode>") {
+		t.Errorf("expected no such object for the private tag, got %d: %s", code, body)
+	}
+}
+
+func TestDeviceDescription(t *testing.T) {
+	s := New(Config{Name: "Living <Room>"}, "/dlna", nil, nil, nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dlna/device.xml", nil))
+	body := w.Body.String()
+	for _, expected := range []string{
+		"<friendlyName>Living &lt;Room&gt;</friendlyName>",
+		"<UDN>" + s.uuid + "</UDN>",
+		"<controlURL>/dlna/control/ContentDirectory</controlURL>",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in %s", expected, body)
+		}
+	}
+	if New(Config{Name: "Living <Room>"}, "/", nil, nil, nil).uuid != s.uuid {
+		t.Errorf("expected stable uuid")
+	}
+}
+
+func TestSearchResponses(t *testing.T) {
+	s := New(Config{Name: "Test"}, "/dlna", nil, nil, nil)
+	location := "http://192.168.1.2:8080/dlna/device.xml"
+
+	all := s.searchResponses("ssdp:all", location, time.Hour)
+	if len(all) != len(s.targets()) {
+		t.Errorf("expected %d responses, got %d", len(s.targets()), len(all))
+	}
+
+	responses := s.searchResponses(deviceType, location, time.Hour)
+	if len(responses) != 1 {
+		t.Fatalf("expected 1 response, got %d", len(responses))
+	}
+	for _, expected := range []string{
+		"HTTP/1.1 200 OK\r\n",
+		"CACHE-CONTROL: max-age=3600\r\n",
+		"LOCATION: " + location + "\r\n",
+		"ST: " + deviceType + "\r\n",
+		"USN: " + s.uuid + "::" + deviceType + "\r\n",
+	} {
+		if !strings.Contains(responses[0], expected) {
+			t.Errorf("expected %q in %q", expected, responses[0])
+		}
+	}
+
+	if len(s.searchResponses("urn:schemas-upnp-org:device:MediaRenderer:1", location, time.Hour)) != 0 {
+		t.Errorf("expected no response for other device types")
+	}
+}
@@ -0,0 +1,262 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+const serverHeader = "Linux/1.0 UPnP/1.0 Photofield/1.0"
+
+// advertiser answers SSDP searches and announces the server periodically,
+// so that renderers can discover it
+type advertiser struct {
+	server *Server
+	port   int
+	conn   *net.UDPConn
+	done   chan struct{}
+	closed sync.WaitGroup
+}
+
+// Advertise announces the server on the local network, with the HTTP
+// endpoints reachable on the port
+func (s *Server) Advertise(port int) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		return err
+	}
+	a := &advertiser{
+		server: s,
+		port:   port,
+		conn:   conn,
+		done:   make(chan struct{}),
+	}
+	s.advertiser = a
+	a.closed.Add(2)
+	go a.listen()
+	go a.announce()
+	return nil
+}
+
+// Close stops advertising and tells the renderers that the server is gone
+func (s *Server) Close() {
+	a := s.advertiser
+	if a == nil {
+		return
+	}
+	close(a.done)
+	a.conn.Close()
+	a.closed.Wait()
+	a.notify("ssdp:byebye")
+}
+
+// targets returns the notification types the server is discoverable by
+func (s *Server) targets() []string {
+	return []string{
+		"upnp:rootdevice",
+		s.uuid,
+		deviceType,
+		contentDirectoryType,
+		connectionManagerType,
+	}
+}
+
+func (s *Server) usn(target string) string {
+	if target == s.uuid {
+		return s.uuid
+	}
+	return s.uuid + "::" + target
+}
+
+// searchResponses returns the responses to an M-SEARCH for the target
+func (s *Server) searchResponses(target string, location string, maxAge time.Duration) []string {
+	var targets []string
+	for _, t := range s.targets() {
+		if target == "ssdp:all" || target == t {
+			targets = append(targets, t)
+		}
+	}
+	responses := make([]string, 0, len(targets))
+	for _, t := range targets {
+		responses = append(responses, "HTTP/1.1 200 OK\r\n"+
+			fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", int(maxAge.Seconds()))+
+			fmt.Sprintf("DATE: %s\r\n", time.Now().UTC().Format(http.TimeFormat))+
+			"EXT:\r\n"+
+			fmt.Sprintf("LOCATION: %s\r\n", location)+
+			fmt.Sprintf("SERVER: %s\r\n", serverHeader)+
+			fmt.Sprintf("ST: %s\r\n", t)+
+			fmt.Sprintf("USN: %s\r\n", s.usn(t))+
+			"CONTENT-LENGTH: 0\r\n\r\n")
+	}
+	return responses
+}
+
+// notifyMessages returns the NOTIFY messages for all targets
+func (s *Server) notifyMessages(nts string, location string, maxAge time.Duration) []string {
+	targets := s.targets()
+	messages := make([]string, 0, len(targets))
+	for _, t := range targets {
+		msg := "NOTIFY * HTTP/1.1\r\n" +
+			fmt.Sprintf("HOST: %s\r\n", ssdpAddr.String())
+		if nts == "ssdp:alive" {
+			msg += fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", int(maxAge.Seconds())) +
+				fmt.Sprintf("LOCATION: %s\r\n", location) +
+				fmt.Sprintf("SERVER: %s\r\n", serverHeader)
+		}
+		msg += fmt.Sprintf("NT: %s\r\n", t) +
+			fmt.Sprintf("NTS: %s\r\n", nts) +
+			fmt.Sprintf("USN: %s\r\n\r\n", s.usn(t))
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func (a *advertiser) location(ip net.IP) string {
+	return fmt.Sprintf("http://%s%s/device.xml", net.JoinHostPort(ip.String(), strconv.Itoa(a.port)), a.server.prefix)
+}
+
+// maxAge is how long renderers may cache an announcement, longer than the
+// interval so that a missed announcement does not drop the server
+func (a *advertiser) maxAge() time.Duration {
+	d, _ := a.server.config.notifyInterval()
+	return 2 * d
+}
+
+func (a *advertiser) listen() {
+	defer a.closed.Done()
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-a.done:
+				return
+			default:
+			}
+			serverLog.Warn("dlna ssdp read failed", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" {
+			continue
+		}
+		if req.Header.Get("Man") != `"ssdp:discover"` {
+			continue
+		}
+		mx, err := strconv.Atoi(req.Header.Get("Mx"))
+		if err != nil || mx < 1 {
+			mx = 1
+		}
+		if mx > 5 {
+			mx = 5
+		}
+		delay := time.Duration(rand.Int63n(int64(mx) * int64(time.Second)))
+		go a.respond(addr, req.Header.Get("St"), delay)
+	}
+}
+
+func (a *advertiser) respond(addr *net.UDPAddr, target string, delay time.Duration) {
+	// Find out which of our addresses the renderer can reach
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return
+	}
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	select {
+	case <-time.After(delay):
+	case <-a.done:
+		return
+	}
+	for _, msg := range a.server.searchResponses(target, a.location(ip), a.maxAge()) {
+		if _, err := a.conn.WriteToUDP([]byte(msg), addr); err != nil {
+			serverLog.Warn("dlna ssdp response failed", "addr", addr, "err", err)
+			return
+		}
+	}
+}
+
+func (a *advertiser) announce() {
+	defer a.closed.Done()
+	interval, _ := a.server.config.notifyInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	a.notify("ssdp:alive")
+	for {
+		select {
+		case <-ticker.C:
+			a.notify("ssdp:alive")
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// notify multicasts the messages from each local address, so that every
+// network gets a reachable location
+func (a *advertiser) notify(nts string) {
+	for _, ip := range multicastAddrs() {
+		conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: ip}, ssdpAddr)
+		if err != nil {
+			continue
+		}
+		for _, msg := range a.server.notifyMessages(nts, a.location(ip), a.maxAge()) {
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}
+}
+
+// multicastAddrs returns the IPv4 addresses of the interfaces that are up
+// and support multicast
+func multicastAddrs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// Port returns the port of a listen address like ":8080"
+func Port(addr string) (int, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(port) == "" {
+		return 0, fmt.Errorf("missing port in %s", addr)
+	}
+	return strconv.Atoi(port)
+}
@@ -0,0 +1,290 @@
+// Package feed renders lists of recently added files as Atom, RSS and JSON
+// feeds.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"time"
+)
+
+// Config configures the feeds of recently added files
+type Config struct {
+	// Thumbnail source linked as the enclosure of each file
+	Thumbnail string `json:"thumbnail"`
+}
+
+// ThumbnailSource returns the name of the thumbnail source to link
+func (config Config) ThumbnailSource() string {
+	if config.Thumbnail == "" {
+		return "sqlite"
+	}
+	return config.Thumbnail
+}
+
+type Format string
+
+const (
+	Atom Format = "atom"
+	RSS  Format = "rss"
+	JSON Format = "json"
+)
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case RSS:
+		return "application/rss+xml; charset=utf-8"
+	case JSON:
+		return "application/feed+json; charset=utf-8"
+	default:
+		return "application/atom+xml; charset=utf-8"
+	}
+}
+
+type Feed struct {
+	// Unique and stable id of the feed
+	Id    string
+	Title string
+	// Page the feed is about
+	Link string
+	// URL of the feed itself
+	Self    string
+	Updated time.Time
+	Items   []Item
+}
+
+type Item struct {
+	Id    string
+	Title string
+	// URL of the original file
+	Link     string
+	MimeType string
+	// URL of a JPEG thumbnail
+	Thumbnail string
+	Added     time.Time
+	// Time the photo was taken, zero if unknown
+	Taken  time.Time
+	Width  int
+	Height int
+}
+
+// content returns the HTML shown by feed readers for the item
+func (item Item) content() string {
+	s := fmt.Sprintf(`<a href="%s"><img src="%s" alt="%s"></a>`,
+		html.EscapeString(item.Link),
+		html.EscapeString(item.Thumbnail),
+		html.EscapeString(item.Title),
+	)
+	if !item.Taken.IsZero() {
+		s += fmt.Sprintf(`<p>Taken %s</p>`, html.EscapeString(item.Taken.Format("2 January 2006 15:04")))
+	}
+	return s
+}
+
+// Render returns the feed in the format
+func (f Feed) Render(format Format) ([]byte, error) {
+	switch format {
+	case RSS:
+		return f.rss()
+	case JSON:
+		return f.json()
+	default:
+		return f.atom()
+	}
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Id        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (f Feed) atom() ([]byte, error) {
+	feed := atomFeed{
+		Id:      f.Id,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  "Photofield",
+		Links: []atomLink{
+			{Rel: "self", Type: string(Atom.ContentType()), Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+	}
+	for _, item := range f.Items {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Id:        item.Id,
+			Title:     item.Title,
+			Updated:   item.Added.UTC().Format(time.RFC3339),
+			Published: item.Added.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Type: item.MimeType, Href: item.Link},
+				{Rel: "enclosure", Type: "image/jpeg", Href: item.Thumbnail},
+			},
+			Content: atomText{Type: "html", Body: item.content()},
+		})
+	}
+	return marshalXML(feed)
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Guid        rssGuid      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Description string       `xml:"description"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Thumbnail   rssThumbnail `xml:"media:thumbnail"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Media   string   `xml:"xmlns:media,attr"`
+	Atom    string   `xml:"xmlns:atom,attr"`
+	Channel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Self          atomLink  `xml:"atom:link"`
+		Description   string    `xml:"description"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		Items         []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+func (f Feed) rss() ([]byte, error) {
+	var feed rssFeed
+	feed.Version = "2.0"
+	feed.Media = "http://search.yahoo.com/mrss/"
+	feed.Atom = "http://www.w3.org/2005/Atom"
+	feed.Channel.Title = f.Title
+	feed.Channel.Link = f.Link
+	feed.Channel.Self = atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self}
+	feed.Channel.Description = fmt.Sprintf("Recently added to %s", f.Title)
+	feed.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	for _, item := range f.Items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Guid:        rssGuid{Value: item.Id},
+			PubDate:     item.Added.UTC().Format(time.RFC1123Z),
+			Description: item.content(),
+			// The size is unknown without reading the thumbnail, which
+			// readers tolerate for images
+			Enclosure: rssEnclosure{URL: item.Thumbnail, Type: "image/jpeg"},
+			Thumbnail: rssThumbnail{URL: item.Thumbnail},
+		})
+	}
+	return marshalXML(feed)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+type jsonAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+type jsonExtension struct {
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	TakenAt string `json:"taken_at,omitempty"`
+}
+
+type jsonItem struct {
+	Id            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Image         string           `json:"image"`
+	DatePublished string           `json:"date_published"`
+	Attachments   []jsonAttachment `json:"attachments"`
+	Photofield    jsonExtension    `json:"_photofield"`
+}
+
+type jsonFeed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url"`
+	Items       []jsonItem `json:"items"`
+}
+
+func (f Feed) json() ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.Self,
+		Items:       make([]jsonItem, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		ext := jsonExtension{
+			Width:  item.Width,
+			Height: item.Height,
+		}
+		if !item.Taken.IsZero() {
+			ext.TakenAt = item.Taken.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, jsonItem{
+			Id:            item.Id,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.content(),
+			Image:         item.Thumbnail,
+			DatePublished: item.Added.UTC().Format(time.RFC3339),
+			Attachments: []jsonAttachment{
+				{URL: item.Link, MimeType: item.MimeType},
+			},
+			Photofield: ext,
+		})
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
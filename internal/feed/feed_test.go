@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() Feed {
+	added := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Feed{
+		Id:      "http://localhost/collections/family",
+		Title:   "Family",
+		Link:    "http://localhost/collections/family",
+		Self:    "http://localhost/api/collections/family/feed",
+		Updated: added,
+		Items: []Item{
+			{
+				Id:        "http://localhost/api/files/1",
+				Title:     "a & b.jpg",
+				Link:      "http://localhost/api/files/1/original/a%20&%20b.jpg",
+				MimeType:  "image/jpeg",
+				Thumbnail: "http://localhost/api/files/1/variants/sqlite/a%20&%20b.jpg.jpg",
+				Added:     added,
+				Taken:     added.Add(-time.Hour),
+				Width:     400,
+				Height:    300,
+			},
+		},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	b, err := testFeed().Render(Atom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed atomFeed
+	if err := xml.Unmarshal(b, &parsed); err != nil {
+		t.Fatalf("invalid xml: %s\n%s", err, b)
+	}
+	if len(parsed.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(parsed.Entries))
+	}
+	e := parsed.Entries[0]
+	if e.Title != "a & b.jpg" || e.Updated != "2023-05-01T12:00:00Z" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if len(e.Links) != 2 || e.Links[1].Rel != "enclosure" || !strings.HasSuffix(e.Links[1].Href, ".jpg.jpg") {
+		t.Errorf("unexpected links %+v", e.Links)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	b, err := testFeed().Render(RSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Items []struct {
+			Title     string `xml:"title"`
+			PubDate   string `xml:"pubDate"`
+			Enclosure struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(b, &parsed); err != nil {
+		t.Fatalf("invalid xml: %s\n%s", err, b)
+	}
+	if len(parsed.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(parsed.Items))
+	}
+	item := parsed.Items[0]
+	if item.PubDate != "Mon, 01 May 2023 12:00:00 +0000" {
+		t.Errorf("unexpected date %s", item.PubDate)
+	}
+	if item.Enclosure.Type != "image/jpeg" || item.Enclosure.URL == "" {
+		t.Errorf("unexpected enclosure %+v", item.Enclosure)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	f := testFeed()
+	b, err := f.Render(JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed jsonFeed
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Version != "https://jsonfeed.org/version/1.1" || parsed.FeedURL != f.Self {
+		t.Errorf("unexpected feed %+v", parsed)
+	}
+	if len(parsed.Items) != 1 || parsed.Items[0].Image != f.Items[0].Thumbnail {
+		t.Fatalf("unexpected items %+v", parsed.Items)
+	}
+	if parsed.Items[0].Photofield.TakenAt != "2023-05-01T11:00:00Z" {
+		t.Errorf("unexpected taken at %s", parsed.Items[0].Photofield.TakenAt)
+	}
+
+	f.Items = nil
+	b, err = f.Render(JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"items": []`) {
+		t.Errorf("expected empty items, got %s", b)
+	}
+}
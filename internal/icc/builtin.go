@@ -0,0 +1,178 @@
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// sRGBCurve is the tone response curve of sRGB, also used by Display P3
+type sRGBCurve struct{}
+
+func (sRGBCurve) Linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+var builtins = map[string]struct {
+	description string
+	// D50 adapted primaries as columns
+	matrix [3][3]float64
+	// Pure power curve, the sRGB curve if zero
+	gamma float64
+}{
+	"srgb": {
+		description: "sRGB IEC61966-2.1",
+		matrix: [3][3]float64{
+			{0.4360747, 0.3850649, 0.1430804},
+			{0.2225045, 0.7168786, 0.0606169},
+			{0.0139322, 0.0971045, 0.7141733},
+		},
+	},
+	"display-p3": {
+		description: "Display P3",
+		matrix: [3][3]float64{
+			{0.5151000, 0.2919977, 0.1571286},
+			{0.2411825, 0.6922253, 0.0665922},
+			{-0.0010501, 0.0418808, 0.7842691},
+		},
+	},
+	"adobe-rgb": {
+		description: "Adobe RGB (1998)",
+		matrix: [3][3]float64{
+			{0.6097559, 0.2052401, 0.1492240},
+			{0.3111242, 0.6256560, 0.0632197},
+			{0.0194811, 0.0608902, 0.7448387},
+		},
+		gamma: 563. / 256,
+	},
+}
+
+// Builtin returns the built-in profile with the name, srgb, display-p3 or
+// adobe-rgb
+func Builtin(name string) (*Profile, error) {
+	b, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s, use srgb, display-p3 or adobe-rgb", name)
+	}
+	p := &Profile{
+		Description: b.description,
+		Matrix:      b.matrix,
+	}
+	var curve Curve = sRGBCurve{}
+	if b.gamma != 0 {
+		curve = Gamma(b.gamma)
+	}
+	p.Curves = [3]Curve{curve, curve, curve}
+	p.Data = build(p, b.gamma)
+	return p, nil
+}
+
+var srgb struct {
+	once    sync.Once
+	profile *Profile
+}
+
+// SRGB returns the sRGB profile, which is assumed for photos without a
+// profile
+func SRGB() *Profile {
+	srgb.once.Do(func() {
+		srgb.profile, _ = Builtin("srgb")
+	})
+	return srgb.profile
+}
+
+// build writes the profile as a v2 display profile, so that it is
+// understood by older software as well
+func build(p *Profile, gamma float64) []byte {
+	be := binary.BigEndian
+	xyz := func(x, y, z float64) []byte {
+		b := make([]byte, 20)
+		copy(b, "XYZ ")
+		be.PutUint32(b[8:], uint32(int32(math.Round(x*65536))))
+		be.PutUint32(b[12:], uint32(int32(math.Round(y*65536))))
+		be.PutUint32(b[16:], uint32(int32(math.Round(z*65536))))
+		return b
+	}
+
+	var curv []byte
+	if gamma != 0 {
+		curv = make([]byte, 14)
+		be.PutUint32(curv[8:], 1)
+		be.PutUint16(curv[12:], uint16(math.Round(gamma*256)))
+	} else {
+		const n = 1024
+		curv = make([]byte, 12+2*n)
+		be.PutUint32(curv[8:], n)
+		for i := 0; i < n; i++ {
+			v := sRGBCurve{}.Linear(float64(i) / (n - 1))
+			be.PutUint16(curv[12+2*i:], uint16(math.Round(v*65535)))
+		}
+	}
+	copy(curv, "curv")
+
+	desc := make([]byte, 12+len(p.Description)+1+4+4+2+1+67)
+	copy(desc, "desc")
+	be.PutUint32(desc[8:], uint32(len(p.Description)+1))
+	copy(desc[12:], p.Description)
+
+	cprt := append([]byte("text\x00\x00\x00\x00No copyright, use freely"), 0)
+
+	m := p.Matrix
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc},
+		{"cprt", cprt},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(m[0][0], m[1][0], m[2][0])},
+		{"gXYZ", xyz(m[0][1], m[1][1], m[2][1])},
+		{"bXYZ", xyz(m[0][2], m[1][2], m[2][2])},
+		{"rTRC", curv},
+		{"gTRC", curv},
+		{"bTRC", curv},
+	}
+
+	header := make([]byte, 128)
+	be.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	now := time.Now().UTC()
+	for i, v := range []int{now.Year(), int(now.Month()), now.Day(), now.Hour(), now.Minute(), now.Second()} {
+		be.PutUint16(header[24+2*i:], uint16(v))
+	}
+	copy(header[36:], "acsp")
+	// D50 illuminant of the connection space
+	copy(header[68:], xyz(0.9642, 1, 0.8249)[8:])
+
+	var table, data bytes.Buffer
+	binary.Write(&table, be, uint32(len(tags)))
+	dataStart := len(header) + 4 + 12*len(tags)
+	offsets := make(map[*byte]int)
+	for _, t := range tags {
+		// Tags with the same data share it
+		offset, ok := offsets[&t.data[0]]
+		if !ok {
+			offset = dataStart + data.Len()
+			offsets[&t.data[0]] = offset
+			data.Write(t.data)
+			// Tag data is aligned to four bytes
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, be, uint32(offset))
+		binary.Write(&table, be, uint32(len(t.data)))
+	}
+
+	b := append(header, table.Bytes()...)
+	b = append(b, data.Bytes()...)
+	be.PutUint32(b[0:], uint32(len(b)))
+	return b
+}
@@ -0,0 +1,159 @@
+package icc
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Resolution of the table converting linear values back to encoded ones,
+// fine enough to keep the shadows smooth
+const encodeSteps = 1 << 14
+
+func invert(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-9 {
+		return [3][3]float64{}, false
+	}
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv, true
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// encoder returns the table converting linear values to encoded ones with
+// the curve, by inverting it with a binary search
+func encoder(curve Curve) []uint8 {
+	t := make([]uint8, encodeSteps)
+	for i := range t {
+		target := float64(i) / (encodeSteps - 1)
+		lo, hi := 0., 1.
+		for j := 0; j < 20; j++ {
+			mid := (lo + hi) / 2
+			if curve.Linear(mid) < target {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		t[i] = uint8(math.Round((lo + hi) / 2 * 255))
+	}
+	return t
+}
+
+// Convert converts the colors of the image in place from one profile to
+// the other, with the relative colorimetric intent
+func Convert(img *image.RGBA, from *Profile, to *Profile) error {
+	inv, ok := invert(to.Matrix)
+	if !ok {
+		return ErrUnsupported
+	}
+	m := multiply(inv, from.Matrix)
+
+	var decode [3][256]float64
+	for c := 0; c < 3; c++ {
+		for i := range decode[c] {
+			decode[c][i] = from.Curves[c].Linear(float64(i) / 255)
+		}
+	}
+	// Inverting the curves is slow, so it is only done once per profile
+	to.encodeOnce.Do(func() {
+		for c := 0; c < 3; c++ {
+			to.encode[c] = encoder(to.Curves[c])
+		}
+	})
+	encode := to.encode
+
+	b := img.Bounds()
+	rows := make(chan int, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+				for x := 0; x+3 < len(row); x += 4 {
+					r := decode[0][row[x]]
+					g := decode[1][row[x+1]]
+					b := decode[2][row[x+2]]
+					for c := 0; c < 3; c++ {
+						v := m[c][0]*r + m[c][1]*g + m[c][2]*b
+						i := int(v*(encodeSteps-1) + 0.5)
+						if i < 0 {
+							i = 0
+						} else if i >= encodeSteps {
+							i = encodeSteps - 1
+						}
+						row[x+c] = encode[c][i]
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Equal returns true if both profiles convert colors the same way, within
+// what is visible in 8-bit images
+func (p *Profile) Equal(o *Profile) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(p.Matrix[i][j]-o.Matrix[i][j]) > 1e-3 {
+				return false
+			}
+		}
+		for _, v := range []float64{0.02, 0.1, 0.25, 0.5, 0.75, 1} {
+			if math.Abs(p.Curves[i].Linear(v)-o.Curves[i].Linear(v)) > 2e-3 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ConvertImage returns the image with the colors converted from one
+// profile to the other, or the image itself if the profiles are equal.
+// RGBA images are converted in place.
+func ConvertImage(img image.Image, from *Profile, to *Profile) (image.Image, error) {
+	if from.Equal(to) {
+		return img, nil
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+	if err := Convert(rgba, from, to); err != nil {
+		return nil, err
+	}
+	return rgba, nil
+}
@@ -0,0 +1,420 @@
+// Package icc reads, converts between and writes ICC color profiles, so
+// that exported photos keep their colors when printed. Only RGB
+// matrix/TRC profiles can be converted, which covers the profiles cameras
+// and editors embed in practice.
+package icc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"photofield/io/archive"
+)
+
+var ErrUnsupported = errors.New("unsupported profile")
+
+// Profile is an RGB matrix/TRC color profile
+type Profile struct {
+	// Description of the profile, e.g. "sRGB IEC61966-2.1"
+	Description string
+	// Columns convert linear RGB to the D50 XYZ connection space
+	Matrix [3][3]float64
+	// Tone response curves of the red, green and blue channels, converting
+	// encoded values to linear ones
+	Curves [3]Curve
+	// The profile as read or built
+	Data []byte
+
+	encodeOnce sync.Once
+	encode     [3][]uint8
+}
+
+// Curve converts an encoded value in [0, 1] to a linear one
+type Curve interface {
+	Linear(v float64) float64
+}
+
+// Gamma is a pure power curve
+type Gamma float64
+
+func (g Gamma) Linear(v float64) float64 {
+	return math.Pow(v, float64(g))
+}
+
+// Table is a sampled curve, linearly interpolated between the samples
+type Table []float64
+
+func (t Table) Linear(v float64) float64 {
+	if len(t) == 0 {
+		return v
+	}
+	x := v * float64(len(t)-1)
+	i := int(x)
+	if i >= len(t)-1 {
+		return t[len(t)-1]
+	}
+	if i < 0 {
+		return t[0]
+	}
+	f := x - float64(i)
+	return t[i]*(1-f) + t[i+1]*f
+}
+
+// Parametric is a parametric curve as defined by the ICC specification,
+// with unused parameters left as zero
+type Parametric struct {
+	Type                int
+	G, A, B, C, D, E, F float64
+}
+
+func (p Parametric) Linear(v float64) float64 {
+	switch p.Type {
+	case 0:
+		return math.Pow(v, p.G)
+	case 1:
+		if v >= -p.B/p.A {
+			return math.Pow(p.A*v+p.B, p.G)
+		}
+		return 0
+	case 2:
+		if v >= -p.B/p.A {
+			return math.Pow(p.A*v+p.B, p.G) + p.C
+		}
+		return p.C
+	case 3:
+		if v >= p.D {
+			return math.Pow(p.A*v+p.B, p.G)
+		}
+		return p.C * v
+	default:
+		if v >= p.D {
+			return math.Pow(p.A*v+p.B, p.G) + p.E
+		}
+		return p.C*v + p.F
+	}
+}
+
+// Parse parses the profile, returning ErrUnsupported for profiles that
+// are not RGB matrix/TRC profiles
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("invalid profile")
+	}
+	if space := string(data[16:20]); space != "RGB " {
+		return nil, fmt.Errorf("%w, color space %q", ErrUnsupported, strings.TrimSpace(space))
+	}
+	if pcs := string(data[20:24]); pcs != "XYZ " {
+		return nil, fmt.Errorf("%w, connection space %q", ErrUnsupported, strings.TrimSpace(pcs))
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, fmt.Errorf("invalid profile tag table")
+		}
+		sig := string(data[entry : entry+4])
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("invalid profile tag %q", sig)
+		}
+		tags[sig] = data[offset : offset+size]
+	}
+
+	p := &Profile{
+		Description: parseText(tags["desc"]),
+		Data:        data,
+	}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseXYZ(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%w, %s: %s", ErrUnsupported, sig, err)
+		}
+		for j := range xyz {
+			p.Matrix[j][i] = xyz[j]
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseCurve(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%w, %s: %s", ErrUnsupported, sig, err)
+		}
+		p.Curves[i] = curve
+	}
+	return p, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZ(b []byte) ([3]float64, error) {
+	if len(b) < 20 || string(b[0:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("missing")
+	}
+	return [3]float64{s15Fixed16(b[8:]), s15Fixed16(b[12:]), s15Fixed16(b[16:])}, nil
+}
+
+func parseCurve(b []byte) (Curve, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("missing")
+	}
+	switch string(b[0:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+2*n {
+			return nil, fmt.Errorf("truncated")
+		}
+		switch n {
+		case 0:
+			return Gamma(1), nil
+		case 1:
+			return Gamma(float64(binary.BigEndian.Uint16(b[12:])) / 256), nil
+		}
+		t := make(Table, n)
+		for i := range t {
+			t[i] = float64(binary.BigEndian.Uint16(b[12+2*i:])) / 65535
+		}
+		return t, nil
+	case "para":
+		fn := int(binary.BigEndian.Uint16(b[8:]))
+		params := []int{1, 3, 4, 5, 7}
+		if fn >= len(params) {
+			return nil, fmt.Errorf("unknown function %d", fn)
+		}
+		if len(b) < 12+4*params[fn] {
+			return nil, fmt.Errorf("truncated")
+		}
+		var v [7]float64
+		for i := 0; i < params[fn]; i++ {
+			v[i] = s15Fixed16(b[12+4*i:])
+		}
+		return Parametric{Type: fn, G: v[0], A: v[1], B: v[2], C: v[3], D: v[4], E: v[5], F: v[6]}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", b[0:4])
+}
+
+// parseText returns the text of a v2 textDescriptionType or the first
+// record of a v4 multiLocalizedUnicodeType
+func parseText(b []byte) string {
+	if len(b) < 12 {
+		return ""
+	}
+	switch string(b[0:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+n {
+			return ""
+		}
+		return strings.TrimRight(string(b[12:12+n]), "\x00")
+	case "mluc":
+		if len(b) < 28 || binary.BigEndian.Uint32(b[8:]) == 0 {
+			return ""
+		}
+		size := int(binary.BigEndian.Uint32(b[20:]))
+		offset := int(binary.BigEndian.Uint32(b[24:]))
+		if offset+size > len(b) {
+			return ""
+		}
+		runes := make([]rune, 0, size/2)
+		for i := offset; i+1 < offset+size; i += 2 {
+			runes = append(runes, rune(binary.BigEndian.Uint16(b[i:])))
+		}
+		return string(runes)
+	}
+	return ""
+}
+
+// iccMarker identifies the APP2 segments the profile is split into in
+// JPEG files
+const iccMarker = "ICC_PROFILE\x00"
+
+// Read returns the profile embedded in the JPEG or PNG file, which can
+// also be inside an archive, nil if there is none
+func Read(path string) ([]byte, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Extract(f)
+}
+
+// Extract returns the profile embedded in the JPEG or PNG read, nil if
+// there is none or the format is not supported
+func Extract(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return FromJPEG(br)
+	case magic[0] == 0x89 && magic[1] == 'P':
+		return FromPNG(br)
+	}
+	return nil, nil
+}
+
+// FromJPEG returns the profile embedded in the JPEG, nil if there is none
+func FromJPEG(r io.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, fmt.Errorf("not a jpeg")
+	}
+
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	var chunks []chunk
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xFF {
+			return nil, fmt.Errorf("invalid jpeg marker")
+		}
+		// Start of scan, the profile comes before the image data
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil, fmt.Errorf("invalid jpeg segment")
+		}
+		if marker[1] != 0xE2 {
+			if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+		if len(segment) > 14 && string(segment[:12]) == iccMarker {
+			chunks = append(chunks, chunk{seq: segment[12], data: segment[14:]})
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var b bytes.Buffer
+	for _, c := range chunks {
+		b.Write(c.data)
+	}
+	return b.Bytes(), nil
+}
+
+// FromPNG returns the profile of the iCCP chunk of the PNG, nil if there
+// is none
+func FromPNG(r io.Reader) ([]byte, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != "\x89PNG\r\n\x1a\n" {
+		return nil, fmt.Errorf("not a png")
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:]) {
+		case "IDAT", "IEND":
+			// The profile comes before the image data
+			return nil, nil
+		case "iCCP":
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, err
+			}
+			// Profile name, null separator and compression method
+			name := bytes.IndexByte(chunk, 0)
+			if name < 0 || name+2 > len(chunk) {
+				return nil, fmt.Errorf("invalid iCCP chunk")
+			}
+			z, err := zlib.NewReader(bytes.NewReader(chunk[name+2:]))
+			if err != nil {
+				return nil, err
+			}
+			defer z.Close()
+			return io.ReadAll(z)
+		}
+		// Data and CRC
+		if _, err := io.CopyN(io.Discard, r, size+4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxChunk is the most profile data that fits into one APP2 segment
+const maxChunk = 65535 - 2 - len(iccMarker) - 2
+
+// WriteJPEG writes the JPEG with the profile embedded, and with the
+// resolution in dots per inch if dpi is positive, replacing the JFIF
+// header if there is one
+func WriteJPEG(w io.Writer, jpeg []byte, profile []byte, dpi int) error {
+	if len(jpeg) < 2 || jpeg[0] != 0xFF || jpeg[1] != 0xD8 {
+		return fmt.Errorf("not a jpeg")
+	}
+	rest := jpeg[2:]
+	var jfif []byte
+	if len(rest) >= 4 && rest[0] == 0xFF && rest[1] == 0xE0 {
+		n := 2 + int(binary.BigEndian.Uint16(rest[2:]))
+		if n > len(rest) {
+			return fmt.Errorf("invalid jpeg segment")
+		}
+		jfif, rest = rest[:n], rest[n:]
+	}
+
+	var b bytes.Buffer
+	b.Write(jpeg[:2])
+	if dpi > 0 {
+		d := uint16(dpi)
+		b.Write([]byte{0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 2, 1, byte(d >> 8), byte(d), byte(d >> 8), byte(d), 0, 0})
+	} else {
+		// The JFIF header comes first
+		b.Write(jfif)
+	}
+	count := (len(profile) + maxChunk - 1) / maxChunk
+	if count > 255 {
+		return fmt.Errorf("profile too large")
+	}
+	for i := 0; i < count; i++ {
+		chunk := profile[i*maxChunk:]
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		size := 2 + len(iccMarker) + 2 + len(chunk)
+		b.Write([]byte{0xFF, 0xE2, byte(size >> 8), byte(size)})
+		b.WriteString(iccMarker)
+		b.Write([]byte{byte(i + 1), byte(count)})
+		b.Write(chunk)
+	}
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(rest)
+	return err
+}
@@ -0,0 +1,103 @@
+package icc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+func TestBuiltinRoundTrip(t *testing.T) {
+	for name := range builtins {
+		p, err := Builtin(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := Parse(p.Data)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if parsed.Description != p.Description {
+			t.Errorf("%s: unexpected description %q", name, parsed.Description)
+		}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				if math.Abs(parsed.Matrix[i][j]-p.Matrix[i][j]) > 1e-4 {
+					t.Errorf("%s: unexpected matrix %v", name, parsed.Matrix)
+				}
+			}
+			for _, v := range []float64{0, 0.02, 0.5, 1} {
+				if math.Abs(parsed.Curves[i].Linear(v)-p.Curves[i].Linear(v)) > 1e-3 {
+					t.Errorf("%s: unexpected curve at %f", name, v)
+				}
+			}
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{200, 100, 50, 255})
+	img.Set(1, 0, color.RGBA{255, 255, 255, 255})
+
+	same := image.NewRGBA(img.Bounds())
+	copy(same.Pix, img.Pix)
+	if err := Convert(same, SRGB(), SRGB()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(same.Pix, img.Pix) {
+		t.Errorf("expected unchanged pixels, got %v", same.Pix)
+	}
+
+	parsed, err := Parse(SRGB().Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := ConvertImage(img, parsed, SRGB()); out != image.Image(img) {
+		t.Errorf("expected equal profiles to leave the image as is")
+	}
+
+	wide, _ := Builtin("display-p3")
+	if err := Convert(img, SRGB(), wide); err != nil {
+		t.Fatal(err)
+	}
+	// Saturated colors are less saturated in a wider gamut, white is white
+	c := img.RGBAAt(0, 0)
+	if c.R >= 200 || c.B <= 50 {
+		t.Errorf("unexpected converted color %v", c)
+	}
+	if w := img.RGBAAt(1, 0); w != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("unexpected converted white %v", w)
+	}
+}
+
+func TestJPEGRoundTrip(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Larger than a segment, so that it is split
+	profile := bytes.Repeat([]byte{1, 2, 3}, 40000)
+
+	var b bytes.Buffer
+	if err := WriteJPEG(&b, encoded.Bytes(), profile, 300); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatalf("invalid jpeg: %s", err)
+	}
+	read, err := FromJPEG(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, profile) {
+		t.Errorf("expected the profile of %d bytes, got %d bytes", len(profile), len(read))
+	}
+
+	none, err := FromJPEG(bytes.NewReader(encoded.Bytes()))
+	if err != nil || none != nil {
+		t.Errorf("expected no profile, got %d bytes, %v", len(none), err)
+	}
+}
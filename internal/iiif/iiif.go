@@ -0,0 +1,407 @@
+// Package iiif implements the parameters of the IIIF Image API 3.0, which
+// request a region of an image scaled, rotated and encoded as needed, see
+// https://iiif.io/api/image/3.0/
+package iiif
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	goio "io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	Context  = "http://iiif.io/api/image/3/context.json"
+	Protocol = "http://iiif.io/api/image"
+	// ContentType of the image information, as recommended by the spec
+	ContentType = `application/ld+json;profile="` + Context + `"`
+
+	// MaxArea is the largest number of pixels of a requested image, so
+	// that upscaled requests cannot exhaust the memory
+	MaxArea = 64 * 1000 * 1000
+	// TileSize is the size of the tiles viewers are advised to request
+	TileSize = 512
+)
+
+var (
+	// ErrInvalid is returned for syntactically invalid parameters or ones
+	// requesting an empty or too large image
+	ErrInvalid = errors.New("invalid parameter")
+	// ErrUnsupported is returned for valid parameters using features that
+	// are not implemented
+	ErrUnsupported = errors.New("unsupported parameter")
+)
+
+// Formats are the supported formats with their content types
+var Formats = map[string]string{
+	"jpg": "image/jpeg",
+	"png": "image/png",
+}
+
+// Request is a parsed image request
+type Request struct {
+	// Region of the full size image
+	Region image.Rectangle
+	// Size the region is scaled to, before rotating it
+	Width  int
+	Height int
+	// Mirror horizontally before rotating
+	Mirror bool
+	// Clockwise rotation in degrees, one of 0, 90, 180 or 270
+	Rotation int
+	Quality  string
+	Format   string
+}
+
+// Parse parses the path parameters of an image request for an image of
+// the size. The last parameter is the quality followed by the format, as
+// in default.jpg.
+func Parse(region, size, rotation, qualityFormat string, width, height int) (Request, error) {
+	var r Request
+	var err error
+	if r.Region, err = parseRegion(region, width, height); err != nil {
+		return r, err
+	}
+	if r.Width, r.Height, err = parseSize(size, r.Region.Dx(), r.Region.Dy()); err != nil {
+		return r, err
+	}
+	if r.Mirror, r.Rotation, err = parseRotation(rotation); err != nil {
+		return r, err
+	}
+
+	dot := strings.LastIndexByte(qualityFormat, '.')
+	if dot == -1 {
+		return r, fmt.Errorf("%w: expected quality.format, got %s", ErrInvalid, qualityFormat)
+	}
+	r.Quality, r.Format = qualityFormat[:dot], qualityFormat[dot+1:]
+	switch r.Quality {
+	case "default", "color", "gray", "bitonal":
+	default:
+		return r, fmt.Errorf("%w: unknown quality %s", ErrInvalid, r.Quality)
+	}
+	if _, ok := Formats[r.Format]; !ok {
+		return r, fmt.Errorf("%w: format %s, use jpg or png", ErrUnsupported, r.Format)
+	}
+	return r, nil
+}
+
+func parseFloats(s string) ([4]float64, bool) {
+	var v [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return v, false
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 {
+			return v, false
+		}
+		v[i] = f
+	}
+	return v, true
+}
+
+func parseRegion(s string, width, height int) (image.Rectangle, error) {
+	full := image.Rect(0, 0, width, height)
+	var r image.Rectangle
+	switch {
+	case s == "full":
+		r = full
+	case s == "square":
+		side := width
+		if height < side {
+			side = height
+		}
+		r = image.Rect(0, 0, side, side).Add(image.Pt((width-side)/2, (height-side)/2))
+	case strings.HasPrefix(s, "pct:"):
+		v, ok := parseFloats(strings.TrimPrefix(s, "pct:"))
+		if !ok {
+			return r, fmt.Errorf("%w: region %s", ErrInvalid, s)
+		}
+		fw, fh := float64(width)/100, float64(height)/100
+		r = image.Rect(
+			int(math.Round(v[0]*fw)),
+			int(math.Round(v[1]*fh)),
+			int(math.Round((v[0]+v[2])*fw)),
+			int(math.Round((v[1]+v[3])*fh)),
+		)
+	default:
+		v, ok := parseFloats(s)
+		if !ok || v[0] != math.Trunc(v[0]) || v[1] != math.Trunc(v[1]) || v[2] != math.Trunc(v[2]) || v[3] != math.Trunc(v[3]) {
+			return r, fmt.Errorf("%w: region %s", ErrInvalid, s)
+		}
+		r = image.Rect(int(v[0]), int(v[1]), int(v[0]+v[2]), int(v[1]+v[3]))
+	}
+	r = r.Intersect(full)
+	if r.Empty() {
+		return r, fmt.Errorf("%w: region %s is outside of the image", ErrInvalid, s)
+	}
+	return r, nil
+}
+
+func parseSize(s string, width, height int) (int, int, error) {
+	upscale := strings.HasPrefix(s, "^")
+	s = strings.TrimPrefix(s, "^")
+	invalid := fmt.Errorf("%w: size %s", ErrInvalid, s)
+
+	// Largest size allowed within the area limit, keeping the aspect ratio
+	maxScale := math.Sqrt(MaxArea / (float64(width) * float64(height)))
+	if !upscale && maxScale > 1 {
+		maxScale = 1
+	}
+
+	var w, h float64
+	switch {
+	case s == "max":
+		w, h = math.Floor(float64(width)*maxScale), math.Floor(float64(height)*maxScale)
+	case strings.HasPrefix(s, "pct:"):
+		pct, err := strconv.ParseFloat(strings.TrimPrefix(s, "pct:"), 64)
+		if err != nil || pct <= 0 {
+			return 0, 0, invalid
+		}
+		w, h = float64(width)*pct/100, float64(height)*pct/100
+	default:
+		fit := strings.HasPrefix(s, "!")
+		parts := strings.Split(strings.TrimPrefix(s, "!"), ",")
+		if len(parts) != 2 {
+			return 0, 0, invalid
+		}
+		var dims [2]float64
+		for i, p := range parts {
+			if p == "" {
+				continue
+			}
+			v, err := strconv.Atoi(p)
+			if err != nil || v <= 0 {
+				return 0, 0, invalid
+			}
+			dims[i] = float64(v)
+		}
+		w, h = dims[0], dims[1]
+		switch {
+		case fit:
+			if w == 0 || h == 0 {
+				return 0, 0, invalid
+			}
+			scale := math.Min(w/float64(width), h/float64(height))
+			w, h = float64(width)*scale, float64(height)*scale
+		case w == 0 && h == 0:
+			return 0, 0, invalid
+		case w == 0:
+			w = float64(width) * h / float64(height)
+		case h == 0:
+			h = float64(height) * w / float64(width)
+		}
+	}
+
+	iw, ih := int(math.Round(w)), int(math.Round(h))
+	if iw < 1 {
+		iw = 1
+	}
+	if ih < 1 {
+		ih = 1
+	}
+	if !upscale && (iw > width || ih > height) {
+		return 0, 0, fmt.Errorf("%w: size %s is larger than the region of %dx%d, prefix it with ^ to upscale", ErrInvalid, s, width, height)
+	}
+	if iw*ih > MaxArea {
+		return 0, 0, fmt.Errorf("%w: size %s is larger than the maximum area of %d pixels", ErrInvalid, s, MaxArea)
+	}
+	return iw, ih, nil
+}
+
+func parseRotation(s string) (bool, int, error) {
+	mirror := strings.HasPrefix(s, "!")
+	deg, err := strconv.ParseFloat(strings.TrimPrefix(s, "!"), 64)
+	if err != nil || deg < 0 || deg > 360 {
+		return false, 0, fmt.Errorf("%w: rotation %s", ErrInvalid, s)
+	}
+	if deg != math.Trunc(deg) || int(deg)%90 != 0 {
+		return false, 0, fmt.Errorf("%w: rotation %s, only multiples of 90 are supported", ErrUnsupported, s)
+	}
+	return mirror, int(deg) % 360, nil
+}
+
+// LoadSize returns the size the full image of the size needs to be decoded
+// at for the request, so that small requests can be served from thumbnails
+func (r Request) LoadSize(width, height int) (int, int) {
+	scale := math.Max(
+		float64(r.Width)/float64(r.Region.Dx()),
+		float64(r.Height)/float64(r.Region.Dy()),
+	)
+	return int(math.Ceil(float64(width) * scale)), int(math.Ceil(float64(height) * scale))
+}
+
+// Render returns the requested image from an image of the full image, which
+// may be decoded at a different size than the full one, e.g. a thumbnail
+// for small requests
+func (r Request) Render(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	sx := float64(b.Dx()) / float64(width)
+	sy := float64(b.Dy()) / float64(height)
+	src := image.Rect(
+		int(math.Floor(float64(r.Region.Min.X)*sx)),
+		int(math.Floor(float64(r.Region.Min.Y)*sy)),
+		int(math.Ceil(float64(r.Region.Max.X)*sx)),
+		int(math.Ceil(float64(r.Region.Max.Y)*sy)),
+	).Add(b.Min).Intersect(b)
+
+	var dst draw.Image
+	switch r.Quality {
+	case "gray", "bitonal":
+		dst = image.NewGray(image.Rect(0, 0, r.Width, r.Height))
+	default:
+		dst = image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+
+	if r.Quality == "bitonal" {
+		gray := dst.(*image.Gray)
+		for i, v := range gray.Pix {
+			if v < 128 {
+				gray.Pix[i] = 0
+			} else {
+				gray.Pix[i] = 255
+			}
+		}
+	}
+	return transform(dst, r.Mirror, r.Rotation)
+}
+
+// transform mirrors the image horizontally and then rotates it clockwise
+func transform(img draw.Image, mirror bool, rotation int) image.Image {
+	if !mirror && rotation == 0 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var dst draw.Image
+	size := image.Rect(0, 0, w, h)
+	if rotation == 90 || rotation == 270 {
+		size = image.Rect(0, 0, h, w)
+	}
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(size)
+	} else {
+		dst = image.NewRGBA(size)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if mirror {
+				sx = w - 1 - x
+			}
+			var dx, dy int
+			switch rotation {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+sx, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// Encode writes the image in the format
+func Encode(w goio.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	case "png":
+		return png.Encode(w, img)
+	}
+	return fmt.Errorf("%w: format %s", ErrUnsupported, format)
+}
+
+// Info is the image information document describing the service of an
+// image
+type Info struct {
+	Context         string   `json:"@context"`
+	Id              string   `json:"id"`
+	Type            string   `json:"type"`
+	Protocol        string   `json:"protocol"`
+	Profile         string   `json:"profile"`
+	Width           int      `json:"width"`
+	Height          int      `json:"height"`
+	MaxArea         int      `json:"maxArea"`
+	Sizes           []Size   `json:"sizes,omitempty"`
+	Tiles           []Tiles  `json:"tiles,omitempty"`
+	ExtraQualities  []string `json:"extraQualities,omitempty"`
+	ExtraFeatures   []string `json:"extraFeatures,omitempty"`
+	PreferredFormat []string `json:"preferredFormats,omitempty"`
+}
+
+type Size struct {
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type Tiles struct {
+	Type         string `json:"type"`
+	Width        int    `json:"width"`
+	ScaleFactors []int  `json:"scaleFactors"`
+}
+
+// NewInfo returns the image information of the image of the size served at
+// the id, the URL of the image without the image request parameters
+func NewInfo(id string, width, height int) Info {
+	info := Info{
+		Context:  Context,
+		Id:       id,
+		Type:     "ImageService3",
+		Protocol: Protocol,
+		Profile:  "level2",
+		Width:    width,
+		Height:   height,
+		MaxArea:  MaxArea,
+		ExtraQualities: []string{
+			"color",
+			"gray",
+			"bitonal",
+		},
+		ExtraFeatures: []string{
+			"mirroring",
+			"regionSquare",
+			"sizeUpscaling",
+		},
+		PreferredFormat: []string{"jpg"},
+	}
+
+	tiles := Tiles{Type: "Tile", Width: TileSize}
+	for scale := 1; ; scale *= 2 {
+		tiles.ScaleFactors = append(tiles.ScaleFactors, scale)
+		if width <= TileSize*scale && height <= TileSize*scale {
+			break
+		}
+	}
+	info.Tiles = []Tiles{tiles}
+
+	// Sizes cheap to request whole, as the thumbnails usually cover them
+	for scale := 2; width/scale >= 1 && height/scale >= 1; scale *= 2 {
+		if width/scale <= 2*TileSize && height/scale <= 2*TileSize {
+			info.Sizes = append(info.Sizes, Size{Type: "Size", Width: width / scale, Height: height / scale})
+		}
+		if width/scale < 64 || height/scale < 64 {
+			break
+		}
+	}
+	// Smallest first, as recommended
+	for i, j := 0, len(info.Sizes)-1; i < j; i, j = i+1, j-1 {
+		info.Sizes[i], info.Sizes[j] = info.Sizes[j], info.Sizes[i]
+	}
+	return info
+}
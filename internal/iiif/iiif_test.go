@@ -0,0 +1,72 @@
+package iiif
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		region, size, rotation, quality string
+		rect                            image.Rectangle
+		w, h                            int
+		mirror                          bool
+		deg                             int
+		err                             error
+	}{
+		{"full", "max", "0", "default.jpg", image.Rect(0, 0, 1000, 600), 1000, 600, false, 0, nil},
+		{"square", "100,", "90", "color.png", image.Rect(200, 0, 800, 600), 100, 100, false, 90, nil},
+		{"10,20,300,200", ",100", "!180", "gray.jpg", image.Rect(10, 20, 310, 220), 150, 100, true, 180, nil},
+		{"pct:50,50,50,50", "pct:50", "0", "default.jpg", image.Rect(500, 300, 1000, 600), 250, 150, false, 0, nil},
+		{"900,500,300,300", "!50,50", "0", "default.jpg", image.Rect(900, 500, 1000, 600), 50, 50, false, 0, nil},
+		{"full", "^2000,", "0", "default.jpg", image.Rect(0, 0, 1000, 600), 2000, 1200, false, 0, nil},
+		{"full", "2000,", "0", "default.jpg", image.Rectangle{}, 0, 0, false, 0, ErrInvalid},
+		{"2000,0,10,10", "max", "0", "default.jpg", image.Rectangle{}, 0, 0, false, 0, ErrInvalid},
+		{"full", "max", "45", "default.jpg", image.Rectangle{}, 0, 0, false, 0, ErrUnsupported},
+		{"full", "max", "0", "default.webp", image.Rectangle{}, 0, 0, false, 0, ErrUnsupported},
+		{"full", "max", "0", "sepia.jpg", image.Rectangle{}, 0, 0, false, 0, ErrInvalid},
+	}
+	for _, c := range cases {
+		r, err := Parse(c.region, c.size, c.rotation, c.quality, 1000, 600)
+		name := c.region + "/" + c.size + "/" + c.rotation + "/" + c.quality
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s: expected %v, got %v", name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if r.Region != c.rect || r.Width != c.w || r.Height != c.h || r.Mirror != c.mirror || r.Rotation != c.deg {
+			t.Errorf("%s: unexpected %+v", name, r)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	// Full image of 400x200 decoded at half the size
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 100; x < 200; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	r, err := Parse("200,0,200,200", "50,", "90", "bitonal.png", 400, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := r.LoadSize(400, 200); w != 100 || h != 50 {
+		t.Errorf("unexpected load size %dx%d", w, h)
+	}
+	out := r.Render(img, 400, 200)
+	if b := out.Bounds(); b.Dx() != 50 || b.Dy() != 50 {
+		t.Errorf("unexpected size %v", b)
+	}
+	if c := color.GrayModel.Convert(out.At(25, 25)).(color.Gray); c.Y != 255 {
+		t.Errorf("expected white, got %v", c)
+	}
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/io/archive"
+	"photofield/io/ffmpeg"
+)
+
+// Audio is a voice memo or other audio recorded alongside a photo or video,
+// stored next to it with the same name, e.g. IMG_0001.WAV for IMG_0001.JPG
+type Audio struct {
+	Path string
+	// Duration of the audio, zero if unknown
+	Duration time.Duration
+}
+
+// findAudio returns the path of the audio file with the same name as the
+// file and one of the audio extensions in lower or upper case, empty if
+// there is none
+func findAudio(path string, extensions []string) string {
+	if archive.IsVirtual(path) {
+		return ""
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range extensions {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			p := base + e
+			if p == path {
+				continue
+			}
+			if stat, err := os.Stat(p); err == nil && stat.Mode().IsRegular() {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// indexAudio associates the audio recorded alongside the file with it,
+// along with its duration if ffprobe is available
+func (source *Source) indexAudio(id ImageId, path string) {
+	if len(source.Audio.Extensions) == 0 {
+		return
+	}
+	audio := Audio{
+		Path: findAudio(path, source.Audio.Extensions),
+	}
+	if audio.Path == "" {
+		if _, ok := source.database.GetAudio(id); ok {
+			source.database.WriteAudio(id, audio)
+		}
+		return
+	}
+	if source.ffprobePath != "" {
+		d, err := ffmpeg.ProbeDuration(context.TODO(), source.ffprobePath, audio.Path)
+		if err != nil {
+			indexLog.Warn("unable to probe audio", "path", audio.Path, "err", err)
+		}
+		audio.Duration = d
+	}
+	source.database.WriteAudio(id, audio)
+}
+
+// GetAudio returns the audio recorded alongside the file, false if there
+// is none
+func (source *Source) GetAudio(id ImageId) (Audio, bool) {
+	return source.database.GetAudio(id)
+}
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindAudio(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"IMG_0001.JPG", "IMG_0001.WAV", "IMG_0002.jpg", "IMG_0003.jpg", "IMG_0003.m4a", "clip.mp4", "clip.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "IMG_0004.wav"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	extensions := []string{".wav", ".m4a", ".mp3"}
+	cases := []struct {
+		name  string
+		audio string
+	}{
+		{"IMG_0001.JPG", "IMG_0001.WAV"},
+		{"IMG_0002.jpg", ""},
+		{"IMG_0003.jpg", "IMG_0003.m4a"},
+		{"IMG_0004.jpg", ""},
+		{"clip.mp4", "clip.mp3"},
+		{"clip.mp3", ""},
+	}
+	for _, c := range cases {
+		expected := ""
+		if c.audio != "" {
+			expected = filepath.Join(dir, c.audio)
+		}
+		if audio := findAudio(filepath.Join(dir, c.name), extensions); audio != expected {
+			t.Errorf("%s: expected %q, got %q", c.name, expected, audio)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"time"
+)
+
+// AuditAction is the type of a mutating operation recorded in the audit log
+type AuditAction string
+
+const (
+	AuditTagCreate         AuditAction = "TAG_CREATE"
+	AuditTagAdd            AuditAction = "TAG_ADD"
+	AuditTagRemove         AuditAction = "TAG_REMOVE"
+	AuditTagInvert         AuditAction = "TAG_INVERT"
+	AuditTagRollback       AuditAction = "TAG_ROLLBACK"
+	AuditTagUpdate         AuditAction = "TAG_UPDATE"
+	AuditTagRename         AuditAction = "TAG_RENAME"
+	AuditTagMerge          AuditAction = "TAG_MERGE"
+	AuditTask              AuditAction = "TASK"
+	AuditCameraUpdate      AuditAction = "CAMERA_UPDATE"
+	AuditCameraCalibrate   AuditAction = "CAMERA_CALIBRATE"
+	AuditOrientationEdit   AuditAction = "ORIENTATION_EDIT"
+	AuditOrientationAccept AuditAction = "ORIENTATION_ACCEPT"
+	AuditOrientationReject AuditAction = "ORIENTATION_REJECT"
+	AuditFileUpload        AuditAction = "FILE_UPLOAD"
+	AuditPanoramaReject    AuditAction = "PANORAMA_REJECT"
+	AuditCaptionEdit       AuditAction = "CAPTION_EDIT"
+	AuditGeotag            AuditAction = "GEOTAG"
+	AuditLocationEdit      AuditAction = "LOCATION_EDIT"
+	AuditFileReprocess     AuditAction = "FILE_REPROCESS"
+)
+
+// AuditEntry records who did what to which files
+type AuditEntry struct {
+	Id        int64
+	CreatedAt time.Time
+	// Name of the API key or user, empty if anonymous
+	Actor string
+	// Method the actor was authenticated by, empty if anonymous
+	Method string
+	Action AuditAction
+	// Tag, collection, camera or panorama the action was applied to
+	Target string
+	// Affected files, nil if none
+	Ids     Ids
+	Details map[string]any
+}
+
+type AuditQuery struct {
+	// Only list entries of the actor if set, empty for anonymous
+	Actor  *string
+	Action AuditAction
+	// Only list entries affecting the file if set
+	FileId ImageId
+	// Only list entries created after this time if set
+	Since time.Time
+	// Only list entries older than this id if set, for paging
+	Before int64
+	Limit  int
+}
+
+// Audit records the entry in the audit log. The entry is written in the
+// background together with other pending writes.
+func (source *Source) Audit(entry AuditEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	source.database.WriteAudit(entry)
+}
+
+// ListAudit lists the audit log entries matching the query, newest first
+func (source *Source) ListAudit(query AuditQuery) ([]AuditEntry, error) {
+	return source.database.ListAudit(query)
+}
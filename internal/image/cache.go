@@ -20,7 +20,7 @@ func (c *InfoCache) Get(id ImageId) (Info, bool) {
 }
 
 func (c *InfoCache) Set(id ImageId, info Info) error {
-	c.cache.Set((uint32)(id), info, (int64)(unsafe.Sizeof(info)))
+	c.cache.Set((uint32)(id), info, (int64)(unsafe.Sizeof(info))+int64(len(info.Description)))
 	return nil
 }
 
@@ -80,3 +80,40 @@ func newPathCache() PathCache {
 		cache: cache,
 	}
 }
+
+type HashCache struct {
+	cache *ristretto.Cache
+}
+
+func (c *HashCache) Get(id ImageId) (string, bool) {
+	value, found := c.cache.Get((uint32)(id))
+	if found {
+		return value.(string), true
+	}
+	return "", false
+}
+
+func (c *HashCache) Set(id ImageId, hash string) error {
+	c.cache.Set((uint32)(id), hash, (int64)(len(hash)))
+	return nil
+}
+
+func (c *HashCache) Delete(id ImageId) {
+	c.cache.Del((uint32)(id))
+}
+
+func newHashCache() HashCache {
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: 1e6,     // number of keys to track frequency of (1M).
+		MaxCost:     1 << 23, // maximum cost of cache (8MB).
+		BufferItems: 64,      // number of keys per Get buffer.
+		Metrics:     true,
+	})
+	if err != nil {
+		panic(err)
+	}
+	metrics.AddRistretto("hash_cache", cache)
+	return HashCache{
+		cache: cache,
+	}
+}
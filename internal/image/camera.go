@@ -0,0 +1,87 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNoCamera = errors.New("camera unknown")
+var ErrSameCamera = errors.New("files taken with the same camera")
+
+type CameraId int64
+
+// Camera identifies the camera body files were taken with. The clock
+// offset is added to the dates of all files taken with the camera to
+// correct for its clock being set incorrectly or drifting.
+type Camera struct {
+	Id          CameraId
+	Make        string
+	Model       string
+	Serial      string
+	ClockOffset time.Duration
+}
+
+func newCamera(hints dateHints) Camera {
+	return Camera{
+		Make:   strings.TrimSpace(hints.Make),
+		Model:  strings.TrimSpace(hints.Model),
+		Serial: strings.TrimSpace(hints.Serial),
+	}
+}
+
+func (camera Camera) Empty() bool {
+	return camera.Make == "" && camera.Model == "" && camera.Serial == ""
+}
+
+func (source *Source) ListCameras() []Camera {
+	return source.database.ListCameras()
+}
+
+func (source *Source) GetCamera(id CameraId) (Camera, bool) {
+	return source.database.GetCamera(id)
+}
+
+// SetCameraClockOffset sets the clock offset of the camera and updates the
+// dates of all the files taken with it
+func (source *Source) SetCameraClockOffset(id CameraId, offset time.Duration) (Camera, error) {
+	camera, ok := source.database.GetCamera(id)
+	if !ok {
+		return Camera{}, ErrNoCamera
+	}
+	err := source.database.WriteCameraClockOffset(id, offset)
+	if err != nil {
+		return Camera{}, err
+	}
+	for fileId := range source.database.ListCameraIds(id) {
+		source.imageInfoCache.Delete(fileId)
+	}
+	camera.ClockOffset = offset
+	return camera, nil
+}
+
+// CalibrateCamera adjusts the clock offset of the camera the file was taken
+// with, so that the file is dated at the same moment as the reference file
+// taken with another camera
+func (source *Source) CalibrateCamera(id ImageId, referenceId ImageId) (Camera, error) {
+	camera, ok := source.database.GetFileCamera(id)
+	if !ok {
+		return Camera{}, ErrNoCamera
+	}
+	reference, ok := source.database.GetFileCamera(referenceId)
+	if ok && reference.Id == camera.Id {
+		return Camera{}, ErrSameCamera
+	}
+
+	info, ok := source.database.Get(id)
+	if !ok || info.DateTimeNull || info.DateTime.IsZero() {
+		return Camera{}, ErrNotFound
+	}
+	referenceInfo, ok := source.database.Get(referenceId)
+	if !ok || referenceInfo.DateTimeNull || referenceInfo.DateTime.IsZero() {
+		return Camera{}, ErrNotFound
+	}
+
+	skew := referenceInfo.DateTime.Sub(info.DateTime)
+	return source.SetCameraClockOffset(camera.Id, camera.ClockOffset+skew)
+}
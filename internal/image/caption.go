@@ -0,0 +1,72 @@
+package image
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Descriptions cameras fill in by default, which are not captions
+var defaultDescriptions = map[string]struct{}{
+	"OLYMPUS DIGITAL CAMERA":     {},
+	"SONY DSC":                   {},
+	"DIGITAL CAMERA":             {},
+	"MINOLTA DIGITAL CAMERA":     {},
+	"KODAK Digital Still Camera": {},
+	"SAMSUNG":                    {},
+	"<Unknown>":                  {},
+}
+
+// parseDescription returns the caption from the description in the
+// metadata, empty if it is a default one filled in by the camera
+func parseDescription(s string) string {
+	s = strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	if _, ok := defaultDescriptions[s]; ok {
+		return ""
+	}
+	return s
+}
+
+// captionMatch returns the full-text query matching captions with words
+// starting with the value
+func captionMatch(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"*`
+}
+
+// captionTsQuery returns the PostgreSQL text search query matching captions
+// with the words of the value in sequence, the last one as a prefix, like
+// captionMatch does for the fts5 table of sqlite
+func captionTsQuery(value string) string {
+	words := strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = `'` + w + `'`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += ":*"
+	}
+	return strings.Join(words, " <-> ")
+}
+
+// SetCaption sets the caption of the file, taking precedence over the one
+// embedded in its metadata without modifying the file
+func (source *Source) SetCaption(id ImageId, caption string) error {
+	return source.writeCaption(id, &caption)
+}
+
+// ResetCaption reverts the caption of the file to the one embedded in its
+// metadata
+func (source *Source) ResetCaption(id ImageId) error {
+	return source.writeCaption(id, nil)
+}
+
+func (source *Source) writeCaption(id ImageId, caption *string) error {
+	if _, ok := source.database.GetPathFromId(id); !ok {
+		return ErrNotFound
+	}
+	if err := source.database.WriteCaption(id, caption); err != nil {
+		return err
+	}
+	source.imageInfoCache.Delete(id)
+	return nil
+}
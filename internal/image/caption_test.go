@@ -0,0 +1,44 @@
+package image
+
+import "testing"
+
+func TestParseDescription(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"  Sunset at the beach \x00\x00", "Sunset at the beach"},
+		{"OLYMPUS DIGITAL CAMERA         ", ""},
+		{"SONY DSC", ""},
+		{"Olympus trip", "Olympus trip"},
+	}
+	for _, c := range cases {
+		if out := parseDescription(c.in); out != c.out {
+			t.Errorf("%q: expected %q, got %q", c.in, c.out, out)
+		}
+	}
+}
+
+func TestCaptionMatch(t *testing.T) {
+	if m := captionMatch(`say "hi"`); m != `"say ""hi"""*` {
+		t.Errorf("unexpected match %s", m)
+	}
+}
+
+func TestCaptionTsQuery(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"sun", "'sun':*"},
+		{`say "hi" there`, "'say' <-> 'hi' <-> 'there':*"},
+		{"it's", "'it' <-> 's':*"},
+	}
+	for _, c := range cases {
+		if q := captionTsQuery(c.in); q != c.out {
+			t.Errorf("%q: expected %q, got %q", c.in, c.out, q)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package image
+
+// ChangeOp is the type of change that happened to a file
+type ChangeOp string
+
+const (
+	ChangeAdded    ChangeOp = "ADDED"
+	ChangeModified ChangeOp = "MODIFIED"
+	ChangeRemoved  ChangeOp = "REMOVED"
+)
+
+// Change is the latest change of a file since a previous cursor.
+// Info is only set for files that were not removed.
+type Change struct {
+	Cursor int64
+	Op     ChangeOp
+	Id     ImageId
+	Path   string
+	Info
+}
+
+// ListChanges lists the latest change of each file changed after the
+// provided cursor, ordered by cursor
+func (source *Source) ListChanges(dirs []string, cursor int64, limit int) <-chan Change {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	return source.database.ListChanges(dirs, cursor, limit)
+}
+
+// LatestChange returns the cursor of the latest change of the files in the
+// dirs, which changes whenever files in them are added, modified or removed
+func (source *Source) LatestChange(dirs []string) int64 {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	return source.database.LatestChange(dirs)
+}
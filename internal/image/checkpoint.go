@@ -0,0 +1,127 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Name of the file in the data dir that the indexing queues are
+// checkpointed to on shutdown
+const checkpointName = "photofield.queues.json"
+
+// queueCheckpoint holds the files left in the indexing queues, so that
+// indexing resumes where it left off after a restart instead of waiting for
+// the next rescan of the missing metadata and contents
+type queueCheckpoint struct {
+	Metadata []MissingInfo `json:"metadata"`
+	Contents []MissingInfo `json:"contents"`
+}
+
+func (c queueCheckpoint) empty() bool {
+	return len(c.Metadata) == 0 && len(c.Contents) == 0
+}
+
+func (source *Source) checkpointPath() string {
+	return filepath.Join(source.DataDir, checkpointName)
+}
+
+func readCheckpoint(path string) (queueCheckpoint, error) {
+	var c queueCheckpoint
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// writeCheckpoint replaces the checkpoint at the path by renaming a
+// complete temporary file over it, so that a crash while writing does not
+// leave a partial one behind. An empty checkpoint removes the file.
+func writeCheckpoint(path string, c queueCheckpoint) error {
+	if c.empty() {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func toMissingInfos(items []interface{}) []MissingInfo {
+	infos := make([]MissingInfo, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(MissingInfo); ok {
+			infos = append(infos, m)
+		}
+	}
+	return infos
+}
+
+func missingInfosToInterface(infos []MissingInfo) <-chan interface{} {
+	out := make(chan interface{}, len(infos))
+	for _, m := range infos {
+		out <- m
+	}
+	close(out)
+	return out
+}
+
+// resumeQueues queues the files checkpointed by the previous shutdown. The
+// checkpoint is kept until the next shutdown replaces it, so that the files
+// are not lost if the process crashes in the meantime.
+func (source *Source) resumeQueues() {
+	c, err := readCheckpoint(source.checkpointPath())
+	if err != nil {
+		indexLog.Error("unable to read queue checkpoint", "err", err)
+		return
+	}
+	if c.empty() {
+		return
+	}
+	indexLog.Info("resuming indexing", "metadata", len(c.Metadata), "contents", len(c.Contents))
+	source.metadataQueue.AppendItems(missingInfosToInterface(c.Metadata))
+	source.contentsQueue.AppendItems(missingInfosToInterface(c.Contents))
+}
+
+// checkpointQueues stops the metadata and contents queues and writes the
+// files left in them to the checkpoint
+func (source *Source) checkpointQueues() {
+	c := queueCheckpoint{
+		Metadata: toMissingInfos(source.metadataQueue.Stop()),
+		Contents: toMissingInfos(source.contentsQueue.Stop()),
+	}
+	if err := writeCheckpoint(source.checkpointPath(), c); err != nil {
+		indexLog.Error("unable to write queue checkpoint", "err", err)
+		return
+	}
+	if !c.empty() {
+		indexLog.Info("checkpointed indexing", "metadata", len(c.Metadata), "contents", len(c.Contents))
+	}
+}
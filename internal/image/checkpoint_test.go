@@ -0,0 +1,57 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), checkpointName)
+
+	c, err := readCheckpoint(path)
+	if err != nil || !c.empty() {
+		t.Fatalf("expected empty checkpoint without a file, got %v, %v", c, err)
+	}
+
+	expected := queueCheckpoint{
+		Metadata: []MissingInfo{{Id: 1, Path: "/photos/a.jpg", Missing: Missing{Metadata: true}}},
+		Contents: []MissingInfo{
+			{Id: 1, Path: "/photos/a.jpg", Missing: Missing{Color: true, Embedding: true}},
+			{Id: 2, Path: "/photos/b.jpg", Missing: Missing{Color: true}},
+		},
+	}
+	if err := writeCheckpoint(path, expected); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected temporary file to be renamed, got %v", err)
+	}
+	c, err = readCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	if err := writeCheckpoint(path, queueCheckpoint{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected empty checkpoint to remove the file, got %v", err)
+	}
+}
+
+func TestToMissingInfos(t *testing.T) {
+	items := []interface{}{
+		MissingInfo{Id: 1},
+		tripDetection{collection: "photos"},
+		MissingInfo{Id: 2},
+	}
+	infos := toMissingInfos(items)
+	if len(infos) != 2 || infos[0].Id != 1 || infos[1].Id != 2 {
+		t.Errorf("expected files 1 and 2, got %v", infos)
+	}
+}
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"math"
+	"sync"
+
+	"photofield/internal/clip"
+)
+
+// promptEmbeddings embeds the texts files are classified by once they are
+// first needed, trying again on the next use if the AI server is
+// unavailable
+type promptEmbeddings struct {
+	mutex      sync.Mutex
+	embeddings []clip.Embedding
+}
+
+// get returns the embeddings of the texts in order, which have to be the
+// same on every call
+func (p *promptEmbeddings) get(c clip.Clip, texts []string) ([]clip.Embedding, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.embeddings != nil {
+		return p.embeddings, nil
+	}
+	embeddings := make([]clip.Embedding, len(texts))
+	for i, text := range texts {
+		e, err := c.EmbedText(text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = e
+	}
+	p.embeddings = embeddings
+	return embeddings, nil
+}
+
+// classify returns the confidence of the embedding matching each of the
+// prompts, the softmax of the similarities scaled like CLIP logits
+func classify(embedding clip.Embedding, prompts []clip.Embedding) ([]float32, error) {
+	search := embedding.Float32()
+	searchInvNorm := embedding.InvNormFloat32()
+
+	similarities := make([]float64, len(prompts))
+	best := 0
+	for i, prompt := range prompts {
+		dot, err := clip.DotProductFloat32Float(search, prompt.Float())
+		if err != nil {
+			return nil, err
+		}
+		similarities[i] = float64(dot * searchInvNorm * prompt.InvNormFloat32())
+		if similarities[i] > similarities[best] {
+			best = i
+		}
+	}
+
+	sum := 0.
+	exps := make([]float64, len(prompts))
+	for i, s := range similarities {
+		exps[i] = math.Exp(100 * (s - similarities[best]))
+		sum += exps[i]
+	}
+	confidences := make([]float32, len(prompts))
+	for i, e := range exps {
+		confidences[i] = float32(e / sum)
+	}
+	return confidences, nil
+}
@@ -0,0 +1,57 @@
+package image
+
+import (
+	"math"
+	"testing"
+	"unsafe"
+
+	"photofield/internal/clip"
+
+	"github.com/x448/float16"
+)
+
+func testEmbedding(values ...float32) clip.Embedding {
+	floats := make([]float16.Float16, len(values))
+	norm := 0.
+	for i, v := range values {
+		floats[i] = float16.Fromfloat32(v)
+		norm += float64(v) * float64(v)
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&floats[0])), len(floats)*2)
+	return clip.FromRaw(b, uint16(float16.Fromfloat32(float32(1/math.Sqrt(norm)))))
+}
+
+func TestClassify(t *testing.T) {
+	prompts := []clip.Embedding{
+		testEmbedding(1, 0, 0),
+		testEmbedding(0, 1, 0),
+		testEmbedding(0, 0, 1),
+	}
+
+	confidences, err := classify(testEmbedding(1, 0.2, 0), prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := float32(0)
+	for _, c := range confidences {
+		sum += c
+	}
+	if math.Abs(float64(sum-1)) > 1e-3 {
+		t.Errorf("expected confidences to sum up to 1, got %f", sum)
+	}
+	if confidences[0] < 0.99 {
+		t.Errorf("expected the most similar prompt to be confident, got %f", confidences[0])
+	}
+
+	confidences, err = classify(testEmbedding(1, 1, 0), prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(confidences[0]-confidences[1])) > 1e-3 || confidences[0] > 0.51 {
+		t.Errorf("expected equally similar prompts to share the confidence, got %v", confidences)
+	}
+
+	if _, err := classify(testEmbedding(1, 0), prompts); err == nil {
+		t.Error("expected mismatched dimensions to fail")
+	}
+}
@@ -0,0 +1,34 @@
+package image
+
+import (
+	"fmt"
+
+	"photofield/internal/icc"
+)
+
+type ColorConfig struct {
+	// Color space originals are converted to when decoded, according to
+	// their embedded profile, srgb or display-p3, or none to leave them
+	// as they are
+	Space string `json:"space"`
+}
+
+// Profile returns the profile of the color space, nil if colors are not
+// managed
+func (config ColorConfig) Profile() (*icc.Profile, error) {
+	switch config.Space {
+	case "none":
+		return nil, nil
+	case "", "srgb":
+		return icc.SRGB(), nil
+	case "display-p3":
+		return icc.Builtin(config.Space)
+	}
+	return nil, fmt.Errorf("unsupported color space %s, use srgb, display-p3 or none", config.Space)
+}
+
+// ColorProfile returns the profile of the colors of decoded originals, nil
+// if they are left as decoded
+func (source *Source) ColorProfile() *icc.Profile {
+	return source.colorProfile
+}
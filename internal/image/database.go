@@ -1,19 +1,21 @@
 package image
 
 import (
-	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"math"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"photofield/internal/clip"
 	"photofield/internal/metrics"
+	"photofield/io/gpano"
 	"photofield/search"
 	"photofield/tag"
 
@@ -40,13 +42,73 @@ type ListOptions struct {
 	OrderBy ListOrder
 	Limit   int
 	Query   *search.Query
+	// Glob patterns of files to leave out of the listing
+	Ignore []string
+	// Tags of files to leave out of the listing unless the query filters by
+	// them, e.g. private ones
+	Hide []string
+
+	ignored func(path string) bool
 }
 
+// Connections in the pool of the database
+const poolSize = 10
+
 type Database struct {
-	path             string
-	pool             *sqlitex.Pool
-	pending          chan *InfoWrite
-	transactionMutex sync.RWMutex
+	writeQueue
+	path   string
+	pool   *sqlitex.Pool
+	events events
+	// Set if another process writes the database
+	readOnly bool
+	embeddingStore
+	config DatabaseConfig
+}
+
+// DatabaseConfig tunes how the writer batches the queued writes into
+// transactions
+type DatabaseConfig struct {
+	// sqlite for the cache database file in the data dir, or postgres for
+	// the database at the url
+	Driver string `json:"driver"`
+	// Connection string of the postgres database
+	Url string `json:"url"`
+	// Connection string of the postgres database as a role that can only
+	// read, required for SQL queries against postgres
+	QueryUrl string `json:"query_url"`
+	// Longest time a write transaction is kept open before it is committed
+	CommitIntervalMs int `json:"commit_interval_ms"`
+	// Writes after which the transaction is committed early, 0 to only
+	// commit on the interval
+	TransactionSize int `json:"transaction_size"`
+	// Writes that can be queued before writers block
+	QueueSize int `json:"queue_size"`
+	// New files indexed with a single write
+	BulkInsert int `json:"bulk_insert"`
+	// SQLite synchronous mode of the writer, e.g. normal or full, unused
+	// with postgres
+	Synchronous string `json:"synchronous"`
+	// Revisions of the files of each tag kept to view and roll back, none
+	// if 0
+	TagRevisions int `json:"tag_revisions"`
+}
+
+// DatabaseStats is the state of the cache database, for diagnostics
+type DatabaseStats struct {
+	Path string `json:"path"`
+	// Size of the database file and its write-ahead log in bytes
+	Size    int64 `json:"size"`
+	WalSize int64 `json:"wal_size"`
+	Pool    int   `json:"pool"`
+	// Writes queued for the writer and how many can be queued before
+	// writers block
+	PendingWrites int  `json:"pending_writes"`
+	MaxWrites     int  `json:"max_writes"`
+	InTransaction bool `json:"in_transaction"`
+	ReadOnly      bool `json:"read_only"`
+	// Size of the embeddings store in bytes and the embeddings in it
+	EmbeddingsSize int64 `json:"embeddings_size"`
+	Embeddings     int   `json:"embeddings"`
 }
 
 type InfoWriteType int32
@@ -64,15 +126,97 @@ const (
 	RemoveTagIds  InfoWriteType = iota
 	InvertTagIds  InfoWriteType = iota
 	CompactTagIds InfoWriteType = iota
+	UpdateHash    InfoWriteType = iota
+	MovePath      InfoWriteType = iota
+	UpdateCamera  InfoWriteType = iota
+
+	// Reverts the files of the tag to the ones it had at the Revision
+	RollbackTagIds InfoWriteType = iota
+	// Sets the display metadata of the tag to the TagMeta
+	UpdateTagMeta InfoWriteType = iota
+	// Renames the tag to the Path
+	RenameTag InfoWriteType = iota
+	// Moves the files of the tag to the MergeInto tag and deletes it
+	MergeTag InfoWriteType = iota
+
+	WriteSelection  InfoWriteType = iota
+	TouchSelection  InfoWriteType = iota
+	DeleteSelection InfoWriteType = iota
+
+	UpdateOrientationProposal       InfoWriteType = iota
+	UpdateOrientationProposalStatus InfoWriteType = iota
+	UpdateOrientationEdit           InfoWriteType = iota
+	UpdateDimensions                InfoWriteType = iota
+
+	WriteAudit InfoWriteType = iota
+
+	UpdateUserState InfoWriteType = iota
+	WriteSearch     InfoWriteType = iota
+	SaveSearch      InfoWriteType = iota
+	DeleteSearch    InfoWriteType = iota
+
+	WritePanorama         InfoWriteType = iota
+	UpdatePanoramaPreview InfoWriteType = iota
+	RejectPanorama        InfoWriteType = iota
+
+	UpdateVideo InfoWriteType = iota
+	UpdateAudio InfoWriteType = iota
+
+	UpdateMotionPhoto InfoWriteType = iota
+	UpdateProjection  InfoWriteType = iota
+	UpdateSidecars    InfoWriteType = iota
+	UpdateCaption     InfoWriteType = iota
+	UpdateGeotag      InfoWriteType = iota
+	ResetGeotag       InfoWriteType = iota
+	UpdateTrips       InfoWriteType = iota
+
+	QuarantineFile InfoWriteType = iota
+	ReleaseFile    InfoWriteType = iota
+
+	UpdateVerification InfoWriteType = iota
+
+	// Appends the NewPaths of the write in one go
+	AppendPaths InfoWriteType = iota
+
+	// Signals that all the previous writes were applied
+	Flush InfoWriteType = iota
 )
 
 type InfoWrite struct {
-	Path      string
-	Id        int64
-	Embedding clip.Embedding
-	Type      InfoWriteType
-	Ids       Ids
-	Done      chan any
+	Path       string
+	NewPaths   []NewPath
+	Id         int64
+	Embedding  clip.Embedding
+	Type       InfoWriteType
+	Ids        Ids
+	Done       chan any
+	Hash       ContentHash
+	Camera     Camera
+	Proposal   OrientationProposal
+	Audit      AuditEntry
+	User       string
+	State      UserState
+	Search     Search
+	Panorama   Panorama
+	Video      Video
+	Audio      Audio
+	Motion     MotionPhoto
+	Projection gpano.Projection
+	Sidecars   []SidecarFile
+	// Edited caption, nil to revert to the embedded one
+	Caption *string
+	Geotag  Geotag
+	// Revision of the tag RollbackTagIds reverts to
+	Revision int
+	TagMeta  tag.Meta
+	// Tag the files of the tag are moved to by MergeTag
+	MergeInto tag.Id
+	Selection Selection
+	// Collection of the trips of UpdateTrips
+	Collection   string
+	Trips        []Trip
+	Quarantine   Quarantined
+	Verification Verification
 	Info
 }
 
@@ -94,6 +238,12 @@ type InfoListResult struct {
 	InfoExistence
 }
 
+// NewPath is a newly found file to be appended with AppendPaths
+type NewPath struct {
+	Path string
+	Hash ContentHash
+}
+
 type EmbeddingsResult struct {
 	Id ImageId
 	clip.Embedding
@@ -122,21 +272,51 @@ func (info *InfoExistence) NeedsColor() bool {
 	return info.ColorNull
 }
 
-func NewDatabase(path string, migrations embed.FS) *Database {
+// NewDatabase opens the cache database at path, migrating it and starting
+// its writer unless it is read-only, in which case the writes are rejected
+// with ErrReadOnly
+func NewDatabase(path string, migrations fs.FS, readOnly bool, config DatabaseConfig, embeddings EmbeddingsConfig) *Database {
 
 	var err error
 
 	source := Database{}
 	source.path = path
-	source.migrate(migrations)
+	source.readOnly = readOnly
+	source.config = config
+	if source.config.CommitIntervalMs <= 0 {
+		source.config.CommitIntervalMs = 200
+	}
+	if source.config.QueueSize <= 0 {
+		source.config.QueueSize = 10000
+	}
+	if !readOnly {
+		source.migrate(migrations)
+	}
+
+	source.pool, err = sqlitex.Open(source.path, 0, poolSize)
+	if err != nil {
+		panic(err)
+	}
 
-	source.pool, err = sqlitex.Open(source.path, 0, 10)
+	source.vectors, err = openEmbeddings(filepath.Dir(path), readOnly)
 	if err != nil {
 		panic(err)
 	}
+	if !readOnly {
+		if err := source.moveEmbeddings(); err != nil {
+			panic(err)
+		}
+	}
+	if err := source.openQuantizedEmbeddings(filepath.Dir(path), readOnly, embeddings); err != nil {
+		panic(err)
+	}
 
-	source.pending = make(chan *InfoWrite, 10000)
-	go source.writePendingInfosSqlite()
+	source.pending = make(chan *InfoWrite, source.config.QueueSize)
+	if readOnly {
+		go source.rejectPendingWrites()
+	} else {
+		go source.writePendingInfosSqlite()
+	}
 
 	return &source
 }
@@ -149,17 +329,171 @@ func (source *Database) open() *sqlite.Conn {
 	return conn
 }
 
-func (source *Database) vacuum() error {
+// Stats returns the size of the database and the state of its writer
+func (source *Database) Stats() DatabaseStats {
+	stats := DatabaseStats{
+		Path:          source.path,
+		Pool:          poolSize,
+		PendingWrites: len(source.pending),
+		MaxWrites:     cap(source.pending),
+		InTransaction: source.writing.Load(),
+		ReadOnly:      source.readOnly,
+		Embeddings:    source.vectors.Len(),
+	}
+	if fi, err := os.Stat(source.path); err == nil {
+		stats.Size = fi.Size()
+	}
+	if fi, err := os.Stat(source.path + "-wal"); err == nil {
+		stats.WalSize = fi.Size()
+	}
+	if fi, err := os.Stat(filepath.Join(filepath.Dir(source.path), embeddingsName)); err == nil {
+		stats.EmbeddingsSize = fi.Size()
+	}
+	return stats
+}
+
+func (source *Database) Vacuum() error {
 	conn := source.open()
 	defer conn.Close()
 
-	log.Println("database vacuuming")
+	dbLog.Info("database vacuuming")
 	defer metrics.Elapsed("database vacuum")()
 
 	return sqlitex.Execute(conn, "VACUUM;", nil)
 }
 
-func (source *Database) migrate(migrations embed.FS) {
+// ExportFile maps a file in this database to its path in an exported one
+type ExportFile struct {
+	Id   ImageId
+	Path string
+}
+
+// Export copies the rows of the provided files, including their metadata,
+// cameras, captions, locations, orientation edits, embeddings and
+// non-system tags, into the database at dstPath, keeping their ids, but
+// using their new paths.
+func (source *Database) Export(dstPath string, migrations fs.FS, files []ExportFile) (err error) {
+	dst := Database{path: dstPath}
+	dst.migrate(migrations)
+
+	conn := source.open()
+	defer conn.Close()
+
+	defer metrics.Elapsed("database export")()
+
+	err = sqlitex.Execute(conn, "ATTACH DATABASE ? AS dst;", &sqlitex.ExecOptions{
+		Args: []interface{}{dstPath},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to attach %s: %w", dstPath, err)
+	}
+	defer sqlitex.Execute(conn, "DETACH DATABASE dst;", nil)
+
+	err = sqlitex.ExecuteScript(conn, `
+		CREATE TEMP TABLE export (
+			id INTEGER PRIMARY KEY,
+			dir TEXT NOT NULL,
+			filename TEXT NOT NULL
+		);`, nil)
+	if err != nil {
+		return err
+	}
+	defer sqlitex.Execute(conn, "DROP TABLE temp.export;", nil)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	insert := conn.Prep(`
+		INSERT OR REPLACE INTO temp.export(id, dir, filename)
+		VALUES (?, ?, ?);`)
+	for _, file := range files {
+		dir, filename := filepath.Split(file.Path)
+		insert.BindInt64(1, int64(file.Id))
+		insert.BindText(2, dir)
+		insert.BindText(3, filename)
+		_, err = insert.Step()
+		if err != nil {
+			return fmt.Errorf("unable to add file %d: %w", file.Id, err)
+		}
+		err = insert.Reset()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = sqlitex.ExecuteScript(conn, `
+		INSERT OR IGNORE INTO dst.prefix(str)
+		SELECT DISTINCT dir
+		FROM temp.export;
+
+		INSERT OR REPLACE INTO dst.infos(
+			id, path_prefix_id, filename,
+			width, height, created_at_unix, created_at_tz_offset,
+			color, orientation, latitude, longitude, hash, sha256,
+			hash_modified_at_unix, camera_id
+		)
+		SELECT
+			infos.id, prefix.id, export.filename,
+			width, height, created_at_unix, created_at_tz_offset,
+			color, orientation, latitude, longitude, hash, sha256,
+			hash_modified_at_unix, camera_id
+		FROM temp.export
+		JOIN main.infos ON infos.id = export.id
+		JOIN dst.prefix ON prefix.str = export.dir;
+
+		INSERT OR REPLACE INTO dst.camera(id, make, model, serial, clock_offset)
+		SELECT id, make, model, serial, clock_offset
+		FROM main.camera
+		WHERE id IN (SELECT DISTINCT camera_id FROM dst.infos);
+
+		INSERT OR REPLACE INTO dst.caption(file_id, embedded, edited, edited_at_unix)
+		SELECT file_id, embedded, edited, edited_at_unix
+		FROM main.caption
+		JOIN temp.export ON export.id = caption.file_id;
+
+		INSERT OR REPLACE INTO dst.geotag(file_id, latitude, longitude, tagged_at_unix, edited)
+		SELECT file_id, latitude, longitude, tagged_at_unix, edited
+		FROM main.geotag
+		JOIN temp.export ON export.id = geotag.file_id;
+
+		INSERT OR REPLACE INTO dst.orientation_edit(file_id, orientation, edited_at_unix)
+		SELECT file_id, orientation, edited_at_unix
+		FROM main.orientation_edit
+		JOIN temp.export ON export.id = orientation_edit.file_id;
+
+		INSERT OR REPLACE INTO dst.clip_emb(file_id, inv_norm, embedding)
+		SELECT file_id, inv_norm, x''
+		FROM main.clip_emb
+		JOIN temp.export ON export.id = clip_emb.file_id;
+
+		INSERT OR IGNORE INTO dst.infos_tag(tag_id, file_id, len)
+		SELECT infos_tag.tag_id, export.id, 0
+		FROM temp.export
+		JOIN main.infos_tag
+		ON export.id >= infos_tag.file_id AND export.id <= infos_tag.file_id + infos_tag.len
+		JOIN main.tag ON tag.id = infos_tag.tag_id
+		WHERE tag.name NOT LIKE 'sys:%';
+
+		INSERT OR REPLACE INTO dst.tag(id, revision, name, color, icon, description, pinned)
+		SELECT id, revision, name, color, icon, description, pinned
+		FROM main.tag
+		WHERE id IN (SELECT DISTINCT tag_id FROM dst.infos_tag);
+
+		INSERT INTO dst.changes(file_id, op, path, changed_at_unix)
+		SELECT id, 'ADDED', dir || filename, strftime('%s', 'now')
+		FROM temp.export
+		WHERE id IN (SELECT id FROM dst.infos)
+		ORDER BY id;`, nil)
+	if err != nil {
+		return err
+	}
+	return source.exportEmbeddings(dstPath, files)
+}
+
+func (source *Database) migrate(migrations fs.FS) {
 	dbsource, err := httpfs.New(http.FS(migrations), "db/migrations")
 	if err != nil {
 		panic(err)
@@ -183,7 +517,7 @@ func (source *Database) migrate(migrations embed.FS) {
 	if dirty {
 		dirtystr = " (dirty)"
 	}
-	log.Printf("cache database version %v%s, migrating if needed", version, dirtystr)
+	dbLog.Info("cache database migrating if needed", "version", version, "dirty", dirtystr)
 
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
@@ -203,24 +537,42 @@ func (source *Database) writePendingInfosSqlite() {
 	conn := source.open()
 	defer conn.Close()
 
+	switch sync := strings.ToLower(source.config.Synchronous); sync {
+	case "":
+	case "off", "normal", "full", "extra":
+		err := sqlitex.ExecuteTransient(conn, "PRAGMA synchronous = "+sync+";", nil)
+		if err != nil {
+			dbLog.Error("unable to set synchronous mode", "synchronous", sync, "err", err)
+		}
+	default:
+		dbLog.Warn("unknown synchronous mode", "synchronous", source.config.Synchronous)
+	}
+
 	upsertPrefix := conn.Prep(`
 		INSERT OR IGNORE INTO prefix(str)
 		VALUES (?);`)
 	defer upsertPrefix.Finalize()
 
+	upsertCamera := conn.Prep(`
+		INSERT OR IGNORE INTO camera(make, model, serial)
+		VALUES (?, ?, ?);`)
+	defer upsertCamera.Finalize()
+
 	updateMeta := conn.Prep(`
-		INSERT INTO infos(path_prefix_id, filename, width, height, orientation, created_at_unix, created_at_tz_offset, latitude, longitude)
+		INSERT INTO infos(path_prefix_id, filename, width, height, orientation, created_at_unix, created_at_tz_offset, latitude, longitude, camera_id)
 		SELECT
-			id as path_prefix_id,
+			prefix.id as path_prefix_id,
 			? as filename,
 			? as width,
 			? as height,
 			? orientation,
-			? as created_at_unix,
+			? + coalesce(camera.clock_offset, 0) as created_at_unix,
 			? as created_at_tz_offset,
 			? as latitude,
-			? as longitude
+			? as longitude,
+			camera.id as camera_id
 		FROM prefix
+		LEFT JOIN camera ON make == ? AND model == ? AND serial == ?
 		WHERE str == ?
 		ON CONFLICT(path_prefix_id, filename) DO UPDATE SET
 			width=excluded.width,
@@ -229,9 +581,368 @@ func (source *Database) writePendingInfosSqlite() {
 			latitude=excluded.latitude,
 			longitude=excluded.longitude,
 			created_at_unix=excluded.created_at_unix,
-			created_at_tz_offset=excluded.created_at_tz_offset;`)
+			created_at_tz_offset=excluded.created_at_tz_offset,
+			camera_id=excluded.camera_id;`)
 	defer updateMeta.Finalize()
 
+	updateCameraInfos := conn.Prep(`
+		UPDATE infos
+		SET created_at_unix = created_at_unix + ? - (
+			SELECT clock_offset
+			FROM camera
+			WHERE id == ?
+		)
+		WHERE camera_id == ?;`)
+	defer updateCameraInfos.Finalize()
+
+	updateCamera := conn.Prep(`
+		UPDATE camera
+		SET clock_offset = ?
+		WHERE id == ?;`)
+	defer updateCamera.Finalize()
+
+	insertChangeByCamera := conn.Prep(`
+		INSERT INTO changes(file_id, op, path, changed_at_unix)
+		SELECT infos.id, ?, str || filename, ?
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE camera_id == ?;`)
+	defer insertChangeByCamera.Finalize()
+
+	insertOrientationProposal := conn.Prep(`
+		INSERT OR IGNORE INTO orientation_proposal(file_id, orientation, confidence, status, created_at_unix)
+		VALUES (?, ?, ?, ?, ?);`)
+	defer insertOrientationProposal.Finalize()
+
+	updateOrientationProposalStatus := conn.Prep(`
+		UPDATE orientation_proposal
+		SET status = ?
+		WHERE file_id == ?;`)
+	defer updateOrientationProposalStatus.Finalize()
+
+	insertAudit := conn.Prep(`
+		INSERT INTO audit(created_at_unix, actor, method, action, target, details)
+		VALUES (?, ?, ?, ?, ?, ?);`)
+	defer insertAudit.Finalize()
+
+	insertAuditRange := conn.Prep(`
+		INSERT INTO audit_file(audit_id, file_id, len)
+		VALUES (?, ?, ?);`)
+	defer insertAuditRange.Finalize()
+
+	getTagName := conn.Prep(`
+		SELECT name
+		FROM tag
+		WHERE id == ?;`)
+	defer getTagName.Finalize()
+
+	tagName := func(id tag.Id) string {
+		getTagName.BindInt64(1, int64(id))
+		exists, err := getTagName.Step()
+		name := ""
+		if err == nil && exists {
+			name = getTagName.ColumnText(0)
+		}
+		err = getTagName.Reset()
+		if err != nil {
+			panic(err)
+		}
+		return name
+	}
+
+	getUserState := conn.Prep(`
+		SELECT value, version, updated_at_unix
+		FROM user_state
+		WHERE user_name == ? AND key == ?;`)
+	defer getUserState.Finalize()
+
+	countUserState := conn.Prep(`
+		SELECT COUNT(*)
+		FROM user_state
+		WHERE user_name == ?;`)
+	defer countUserState.Finalize()
+
+	upsertUserState := conn.Prep(`
+		INSERT INTO user_state(user_name, key, value, version, updated_at_unix)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_name, key) DO UPDATE SET
+			value=excluded.value,
+			version=excluded.version,
+			updated_at_unix=excluded.updated_at_unix;`)
+	defer upsertUserState.Finalize()
+
+	deleteUserState := conn.Prep(`
+		DELETE FROM user_state
+		WHERE user_name == ? AND key == ?;`)
+	defer deleteUserState.Finalize()
+
+	getLatestSearch := conn.Prep(`
+		SELECT id, query, searched_at_unix, name
+		FROM search
+		WHERE user_name == ? AND collection_id == ?
+		ORDER BY searched_at_unix DESC, id DESC
+		LIMIT 1;`)
+	defer getLatestSearch.Finalize()
+
+	upsertSearch := conn.Prep(`
+		INSERT INTO search(user_name, collection_id, query, searched_at_unix)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_name, collection_id, query) DO UPDATE SET
+			searched_at_unix = excluded.searched_at_unix;`)
+	defer upsertSearch.Finalize()
+
+	upsertSavedSearch := conn.Prep(`
+		INSERT INTO search(user_name, collection_id, query, searched_at_unix, name)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_name, collection_id, query) DO UPDATE SET
+			name = excluded.name
+		RETURNING id, searched_at_unix;`)
+	defer upsertSavedSearch.Finalize()
+
+	deleteSearch := conn.Prep(`
+		DELETE FROM search
+		WHERE id == ? AND user_name == ?;`)
+	defer deleteSearch.Finalize()
+
+	pruneSearches := conn.Prep(`
+		DELETE FROM search
+		WHERE user_name == ?1 AND name IS NULL AND id NOT IN (
+			SELECT id
+			FROM search
+			WHERE user_name == ?1 AND name IS NULL
+			ORDER BY searched_at_unix DESC, id DESC
+			LIMIT ?2
+		);`)
+	defer pruneSearches.Finalize()
+
+	insertPanorama := conn.Prep(`
+		INSERT INTO panorama(created_at_unix)
+		VALUES (?);`)
+	defer insertPanorama.Finalize()
+
+	insertPanoramaFile := conn.Prep(`
+		INSERT OR IGNORE INTO panorama_file(file_id, panorama_id, position)
+		VALUES (?, ?, ?);`)
+	defer insertPanoramaFile.Finalize()
+
+	updatePanoramaPreview := conn.Prep(`
+		UPDATE panorama
+		SET preview = ?
+		WHERE id == ?;`)
+	defer updatePanoramaPreview.Finalize()
+
+	upsertVideo := conn.Prep(`
+		INSERT OR REPLACE INTO video(file_id, duration_ms, codec, frame_rate, chapters)
+		VALUES (?, ?, ?, ?, ?);`)
+	defer upsertVideo.Finalize()
+
+	deleteVideo := conn.Prep(`
+		DELETE FROM video
+		WHERE file_id == ?;`)
+	defer deleteVideo.Finalize()
+
+	upsertAudio := conn.Prep(`
+		INSERT OR REPLACE INTO audio(file_id, path, duration_ms)
+		VALUES (?, ?, ?);`)
+	defer upsertAudio.Finalize()
+
+	deleteAudio := conn.Prep(`
+		DELETE FROM audio
+		WHERE file_id == ?;`)
+	defer deleteAudio.Finalize()
+
+	upsertMotionPhoto := conn.Prep(`
+		INSERT OR REPLACE INTO motion_photo(file_id, offset, length)
+		VALUES (?, ?, ?);`)
+	defer upsertMotionPhoto.Finalize()
+
+	deleteMotionPhoto := conn.Prep(`
+		DELETE FROM motion_photo
+		WHERE file_id == ?;`)
+	defer deleteMotionPhoto.Finalize()
+
+	upsertProjection := conn.Prep(`
+		INSERT OR REPLACE INTO projection(file_id, type, full_width, full_height, cropped_left, cropped_top, cropped_width, cropped_height, pose_heading)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`)
+	defer upsertProjection.Finalize()
+
+	deleteProjection := conn.Prep(`
+		DELETE FROM projection
+		WHERE file_id == ?;`)
+	defer deleteProjection.Finalize()
+
+	insertSidecarFile := conn.Prep(`
+		INSERT OR REPLACE INTO sidecar_file(path, file_id, kind, modified_unix)
+		VALUES (?, ?, ?, ?);`)
+	defer insertSidecarFile.Finalize()
+
+	deleteSidecarFiles := conn.Prep(`
+		DELETE FROM sidecar_file
+		WHERE file_id == ?;`)
+	defer deleteSidecarFiles.Finalize()
+
+	upsertEmbeddedCaption := conn.Prep(`
+		INSERT INTO caption(file_id, embedded)
+		VALUES (?, ?)
+		ON CONFLICT(file_id) DO UPDATE SET
+			embedded = excluded.embedded
+		WHERE embedded IS NOT excluded.embedded;`)
+	defer upsertEmbeddedCaption.Finalize()
+
+	clearEmbeddedCaption := conn.Prep(`
+		UPDATE caption
+		SET embedded = NULL
+		WHERE file_id == ? AND embedded IS NOT NULL;`)
+	defer clearEmbeddedCaption.Finalize()
+
+	upsertEditedCaption := conn.Prep(`
+		INSERT INTO caption(file_id, edited, edited_at_unix)
+		VALUES (?, ?, ?)
+		ON CONFLICT(file_id) DO UPDATE SET
+			edited = excluded.edited,
+			edited_at_unix = excluded.edited_at_unix;`)
+	defer upsertEditedCaption.Finalize()
+
+	clearEditedCaption := conn.Prep(`
+		UPDATE caption
+		SET edited = NULL, edited_at_unix = NULL
+		WHERE file_id == ?;`)
+	defer clearEditedCaption.Finalize()
+
+	deleteEmptyCaption := conn.Prep(`
+		DELETE FROM caption
+		WHERE file_id == ? AND embedded IS NULL AND edited IS NULL;`)
+	defer deleteEmptyCaption.Finalize()
+
+	deleteCaption := conn.Prep(`
+		DELETE FROM caption
+		WHERE file_id == ?;`)
+	defer deleteCaption.Finalize()
+
+	upsertGeotag := conn.Prep(`
+		INSERT OR REPLACE INTO geotag(file_id, latitude, longitude, tagged_at_unix, edited)
+		VALUES (?, ?, ?, ?, ?);`)
+	defer upsertGeotag.Finalize()
+
+	updateLocation := conn.Prep(`
+		UPDATE infos
+		SET latitude = ?, longitude = ?
+		WHERE id == ?;`)
+	defer updateLocation.Finalize()
+
+	deleteGeotag := conn.Prep(`
+		DELETE FROM geotag
+		WHERE file_id == ?;`)
+	defer deleteGeotag.Finalize()
+
+	clearTripsDetected := conn.Prep(`
+		UPDATE trip
+		SET detected = 0
+		WHERE collection_id == ?;`)
+	defer clearTripsDetected.Finalize()
+
+	upsertTrip := conn.Prep(`
+		INSERT INTO trip(collection_id, name, start_unix, end_unix, latitude, longitude, cover_id, detected)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(collection_id, start_unix) DO UPDATE SET
+			name = excluded.name,
+			end_unix = excluded.end_unix,
+			latitude = excluded.latitude,
+			longitude = excluded.longitude,
+			cover_id = excluded.cover_id,
+			detected = 1
+		RETURNING id;`)
+	defer upsertTrip.Finalize()
+
+	deleteTripFiles := conn.Prep(`
+		DELETE FROM trip_file
+		WHERE trip_id == ?;`)
+	defer deleteTripFiles.Finalize()
+
+	insertTripFile := conn.Prep(`
+		INSERT OR IGNORE INTO trip_file(trip_id, file_id)
+		VALUES (?, ?);`)
+	defer insertTripFile.Finalize()
+
+	deleteUndetectedTrips := conn.Prep(`
+		DELETE FROM trip
+		WHERE collection_id == ? AND detected == 0;`)
+	defer deleteUndetectedTrips.Finalize()
+
+	deleteOrphanTripFiles := conn.Prep(`
+		DELETE FROM trip_file
+		WHERE trip_id NOT IN (SELECT id FROM trip);`)
+	defer deleteOrphanTripFiles.Finalize()
+
+	deleteFileTrips := conn.Prep(`
+		DELETE FROM trip_file
+		WHERE file_id == ?;`)
+	defer deleteFileTrips.Finalize()
+
+	upsertQuarantine := conn.Prep(`
+		INSERT OR REPLACE INTO quarantine(file_id, stage, error, quarantined_at_unix)
+		VALUES (?, ?, ?, ?);`)
+	defer upsertQuarantine.Finalize()
+
+	deleteQuarantine := conn.Prep(`
+		DELETE FROM quarantine
+		WHERE file_id == ?;`)
+	defer deleteQuarantine.Finalize()
+
+	upsertVerification := conn.Prep(`
+		INSERT OR REPLACE INTO verification(file_id, verified_at_unix, status, detail, modified_at_unix)
+		VALUES (?, ?, ?, ?, ?);`)
+	defer upsertVerification.Finalize()
+
+	deleteVerification := conn.Prep(`
+		DELETE FROM verification
+		WHERE file_id == ?;`)
+	defer deleteVerification.Finalize()
+
+	rejectPanorama := conn.Prep(`
+		UPDATE panorama
+		SET rejected = 1, preview = NULL
+		WHERE id == ? AND rejected == 0;`)
+	defer rejectPanorama.Finalize()
+
+	resolveOrientationProposal := conn.Prep(`
+		UPDATE orientation_proposal
+		SET status = CASE WHEN orientation == ? THEN 'accepted' ELSE 'rejected' END
+		WHERE file_id == ? AND status == 'pending';`)
+	defer resolveOrientationProposal.Finalize()
+
+	getOrientationEdit := conn.Prep(`
+		SELECT infos.orientation, coalesce(orientation_edit.orientation, 1)
+		FROM infos
+		LEFT JOIN orientation_edit ON orientation_edit.file_id == infos.id
+		WHERE infos.id == ?;`)
+	defer getOrientationEdit.Finalize()
+
+	updateOrientation := conn.Prep(`
+		UPDATE infos
+		SET
+			orientation = CASE WHEN orientation IS NULL THEN NULL ELSE ? END,
+			width = CASE WHEN ? THEN height ELSE width END,
+			height = CASE WHEN ? THEN width ELSE height END
+		WHERE id == ?;`)
+	defer updateOrientation.Finalize()
+
+	updateDimensions := conn.Prep(`
+		UPDATE infos
+		SET width = ?, height = ?, orientation = ?
+		WHERE id == ?;`)
+	defer updateDimensions.Finalize()
+
+	upsertOrientationEdit := conn.Prep(`
+		INSERT OR REPLACE INTO orientation_edit(file_id, orientation, edited_at_unix)
+		VALUES (?, ?, ?);`)
+	defer upsertOrientationEdit.Finalize()
+
+	deleteOrientationEdit := conn.Prep(`
+		DELETE FROM orientation_edit
+		WHERE file_id == ?;`)
+	defer deleteOrientationEdit.Finalize()
+
 	updateColor := conn.Prep(`
 		INSERT INTO infos(path_prefix_id, filename, color)
 		SELECT
@@ -244,20 +955,48 @@ func (source *Database) writePendingInfosSqlite() {
 			color=excluded.color;`)
 	defer updateColor.Finalize()
 
+	// The embedding itself is in the embeddings store
 	updateAI := conn.Prep(`
 		INSERT OR REPLACE INTO clip_emb(file_id, inv_norm, embedding)
-		VALUES (?, ?, ?);`)
+		VALUES (?, ?, x'');`)
 	defer updateAI.Finalize()
 
+	deleteAI := conn.Prep(`
+		DELETE FROM clip_emb
+		WHERE file_id = ?;`)
+	defer deleteAI.Finalize()
+
 	appendPath := conn.Prep(`
-		INSERT OR IGNORE INTO infos(path_prefix_id, filename)
+		INSERT OR IGNORE INTO infos(path_prefix_id, filename, hash, sha256, hash_modified_at_unix, indexed_at_unix)
 		SELECT
 			id as path_prefix_id,
-			? as filename
+			? as filename,
+			? as hash,
+			? as sha256,
+			? as hash_modified_at_unix,
+			? as indexed_at_unix
 		FROM prefix
 		WHERE str == ?`)
 	defer appendPath.Finalize()
 
+	updateHash := conn.Prep(`
+		UPDATE infos
+		SET hash = ?, sha256 = coalesce(?, sha256), hash_modified_at_unix = ?
+		WHERE id == ?;`)
+	defer updateHash.Finalize()
+
+	movePath := conn.Prep(`
+		UPDATE infos
+		SET
+			path_prefix_id = (
+				SELECT id
+				FROM prefix
+				WHERE str == ?
+			),
+			filename = ?
+		WHERE id == ?;`)
+	defer movePath.Finalize()
+
 	delete := conn.Prep(`
 		DELETE
 		FROM infos
@@ -295,6 +1034,52 @@ func (source *Database) writePendingInfosSqlite() {
 		VALUES (?, ?, ?);`)
 	defer insertTagRange.Finalize()
 
+	insertChangeByPath := conn.Prep(`
+		INSERT INTO changes(file_id, op, path, changed_at_unix)
+		SELECT infos.id, ?, str || filename, ?
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE str == ? AND filename == ?;`)
+	defer insertChangeByPath.Finalize()
+
+	insertChangeById := conn.Prep(`
+		INSERT INTO changes(file_id, op, path, changed_at_unix)
+		SELECT infos.id, ?, str || filename, ?
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE infos.id == ?;`)
+	defer insertChangeById.Finalize()
+
+	writeChangeByPath := func(op ChangeOp, path string) {
+		dir, file := filepath.Split(path)
+		insertChangeByPath.BindText(1, string(op))
+		insertChangeByPath.BindInt64(2, time.Now().Unix())
+		insertChangeByPath.BindText(3, dir)
+		insertChangeByPath.BindText(4, file)
+		_, err := insertChangeByPath.Step()
+		if err != nil {
+			dbLog.Error("unable to insert change", "path", path, "err", err)
+		}
+		err = insertChangeByPath.Reset()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	writeChangeById := func(op ChangeOp, id ImageId) {
+		insertChangeById.BindText(1, string(op))
+		insertChangeById.BindInt64(2, time.Now().Unix())
+		insertChangeById.BindInt64(3, int64(id))
+		_, err := insertChangeById.Step()
+		if err != nil {
+			dbLog.Error("unable to insert change", "id", id, "err", err)
+		}
+		err = insertChangeById.Reset()
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	incrementTagRevision := conn.Prep(`
 		UPDATE tag
 		SET revision = revision + 1
@@ -302,21 +1087,356 @@ func (source *Database) writePendingInfosSqlite() {
 		RETURNING revision;`)
 	defer incrementTagRevision.Finalize()
 
+	insertTagRevision := conn.Prep(`
+		INSERT OR REPLACE INTO tag_revision (tag_id, revision, op, changed_at_unix, added, removed, count)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`)
+	defer insertTagRevision.Finalize()
+
+	insertTagRevisionRange := conn.Prep(`
+		INSERT INTO tag_revision_range (tag_id, revision, removed, file_id, len)
+		VALUES (?, ?, ?, ?, ?);`)
+	defer insertTagRevisionRange.Finalize()
+
+	deleteTagRevisions := conn.Prep(`
+		DELETE FROM tag_revision
+		WHERE tag_id == ? AND revision <= ?;`)
+	defer deleteTagRevisions.Finalize()
+
+	deleteTagRevisionRanges := conn.Prep(`
+		DELETE FROM tag_revision_range
+		WHERE tag_id == ? AND revision <= ?;`)
+	defer deleteTagRevisionRanges.Finalize()
+
+	renameTag := conn.Prep(`
+		UPDATE tag
+		SET name = ?
+		WHERE id == ?;`)
+	defer renameTag.Finalize()
+
+	deleteTag := conn.Prep(`
+		DELETE FROM tag
+		WHERE id == ?;`)
+	defer deleteTag.Finalize()
+
+	insertSelection := conn.Prep(`
+		INSERT INTO selection (tag_id, user_name, collection_id, created_at_unix, expires_at_unix)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id;`)
+	defer insertSelection.Finalize()
+
+	getSelectionTagId := conn.Prep(`
+		SELECT tag_id
+		FROM selection
+		WHERE id == ? AND user_name == ?;`)
+	defer getSelectionTagId.Finalize()
+
+	listExpiredSelections := conn.Prep(`
+		SELECT id, tag_id
+		FROM selection
+		WHERE expires_at_unix <= ?;`)
+	defer listExpiredSelections.Finalize()
+
+	touchSelection := conn.Prep(`
+		UPDATE selection
+		SET expires_at_unix = ?
+		WHERE id == ? AND user_name == ? AND expires_at_unix > ?;`)
+	defer touchSelection.Finalize()
+
+	deleteSelection := conn.Prep(`
+		DELETE FROM selection
+		WHERE id == ?;`)
+	defer deleteSelection.Finalize()
+
+	updateTagMeta := conn.Prep(`
+		UPDATE tag
+		SET color = NULLIF(?, ''), icon = NULLIF(?, ''), description = NULLIF(?, ''), pinned = ?
+		WHERE id == ?;`)
+	defer updateTagMeta.Finalize()
+
+	// writeTagIds replaces the files of the tag with the ids, returning the
+	// incremented revision of the tag
+	writeTagIds := func(id tag.Id, ids Ids) (int, error) {
+		// Delete all tag ranges
+		deleteTagRanges.BindInt64(1, int64(id))
+		_, err := deleteTagRanges.Step()
+		if err != nil {
+			dbLog.Error("unable to delete tag ranges", "tag_id", id, "err", err)
+			return 0, err
+		}
+		err = deleteTagRanges.Reset()
+		if err != nil {
+			panic(err)
+		}
+
+		// Insert new tag ranges
+		for r := range ids.RangeChan() {
+			min := r.Low
+			len := r.High - r.Low
+			insertTagRange.BindInt64(1, int64(id))
+			insertTagRange.BindInt64(2, int64(min))
+			insertTagRange.BindInt64(3, int64(len))
+			_, err := insertTagRange.Step()
+			if err != nil {
+				dbLog.Error("unable to insert tag range", "tag_id", id, "err", err)
+				continue
+			}
+			err = insertTagRange.Reset()
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		// Increment tag revision
+		incrementTagRevision.BindInt64(1, int64(id))
+		ok, err := incrementTagRevision.Step()
+		if err != nil {
+			dbLog.Error("unable to increment tag revision", "tag_id", id, "err", err)
+			return 0, err
+		}
+		if !ok {
+			panic("Unable to increment tag revision, returned false")
+		}
+		rev := incrementTagRevision.ColumnInt(0)
+		err = incrementTagRevision.Reset()
+		if err != nil {
+			panic(err)
+		}
+		return rev, nil
+	}
+
+	// removeTag deletes the tag along with its files and history
+	removeTag := func(id tag.Id) error {
+		deleteTagRanges.BindInt64(1, int64(id))
+		deleteTagRevisions.BindInt64(1, int64(id))
+		deleteTagRevisions.BindInt64(2, math.MaxInt64)
+		deleteTagRevisionRanges.BindInt64(1, int64(id))
+		deleteTagRevisionRanges.BindInt64(2, math.MaxInt64)
+		deleteTag.BindInt64(1, int64(id))
+		for _, stmt := range []*sqlite.Stmt{deleteTagRanges, deleteTagRevisions, deleteTagRevisionRanges, deleteTag} {
+			_, err := stmt.Step()
+			if rerr := stmt.Reset(); err == nil {
+				err = rerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// removeSelection deletes the selection along with its tag
+	removeSelection := func(id int64, tagId tag.Id) error {
+		deleteSelection.BindInt64(1, id)
+		_, err := deleteSelection.Step()
+		if rerr := deleteSelection.Reset(); err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return err
+		}
+		return removeTag(tagId)
+	}
+
+	// removeExpiredSelections deletes the selections that expired by now
+	removeExpiredSelections := func(now time.Time) error {
+		type expired struct {
+			id    int64
+			tagId tag.Id
+		}
+		var selections []expired
+		listExpiredSelections.BindInt64(1, now.Unix())
+		for {
+			exists, err := listExpiredSelections.Step()
+			if err != nil {
+				listExpiredSelections.Reset()
+				return err
+			}
+			if !exists {
+				break
+			}
+			selections = append(selections, expired{
+				id:    listExpiredSelections.ColumnInt64(0),
+				tagId: tag.Id(listExpiredSelections.ColumnInt64(1)),
+			})
+		}
+		if err := listExpiredSelections.Reset(); err != nil {
+			return err
+		}
+		for _, e := range selections {
+			if err := removeSelection(e.id, e.tagId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// writeTagRevision records the files added and removed by the revision
+	// of the tag, dropping the revisions older than the ones kept
+	writeTagRevision := func(id tag.Id, rev int, op string, before Ids, after Ids) {
+		added := after.Clone()
+		added.SubtractTree(before)
+		removed := before.Clone()
+		removed.SubtractTree(after)
+
+		insertTagRevision.BindInt64(1, int64(id))
+		insertTagRevision.BindInt64(2, int64(rev))
+		insertTagRevision.BindText(3, op)
+		insertTagRevision.BindInt64(4, time.Now().Unix())
+		insertTagRevision.BindInt64(5, int64(countIds(added)))
+		insertTagRevision.BindInt64(6, int64(countIds(removed)))
+		insertTagRevision.BindInt64(7, int64(countIds(after)))
+		_, err := insertTagRevision.Step()
+		if err != nil {
+			dbLog.Error("unable to insert tag revision", "tag_id", id, "err", err)
+		}
+		err = insertTagRevision.Reset()
+		if err != nil {
+			panic(err)
+		}
+
+		for removedFlag, ids := range []Ids{added, removed} {
+			for _, r := range ids.Slice() {
+				insertTagRevisionRange.BindInt64(1, int64(id))
+				insertTagRevisionRange.BindInt64(2, int64(rev))
+				insertTagRevisionRange.BindInt64(3, int64(removedFlag))
+				insertTagRevisionRange.BindInt64(4, int64(r.Low))
+				insertTagRevisionRange.BindInt64(5, int64(r.High-r.Low))
+				_, err := insertTagRevisionRange.Step()
+				if err != nil {
+					dbLog.Error("unable to insert tag revision range", "tag_id", id, "err", err)
+				}
+				err = insertTagRevisionRange.Reset()
+				if err != nil {
+					panic(err)
+				}
+			}
+		}
+
+		for _, stmt := range []*sqlite.Stmt{deleteTagRevisions, deleteTagRevisionRanges} {
+			stmt.BindInt64(1, int64(id))
+			stmt.BindInt64(2, int64(rev-source.config.TagRevisions))
+			_, err := stmt.Step()
+			if err != nil {
+				dbLog.Error("unable to delete tag revisions", "tag_id", id, "err", err)
+			}
+			err = stmt.Reset()
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
 	lastOptimize := time.Time{}
 	inTransaction := false
 
 	pendingCompactionTags := tagSet{}
 
+	// Published once committed, so that listeners can read the changes
+	pendingEvents := make([]Event, 0)
+
 	defer func() {
 		err := sqlitex.Execute(conn, "COMMIT;", nil)
 		source.transactionMutex.Unlock()
 		if err != nil {
 			panic(err)
 		}
+		source.events.publish(pendingEvents)
 	}()
 
 	commitTicker := &time.Ticker{}
-	commitInterval := 200 * time.Millisecond
+	commitInterval := time.Duration(source.config.CommitIntervalMs) * time.Millisecond
+	transactionWrites := 0
+
+	commit := func() {
+		committed := metrics.ObserveQuery("commit")
+		err := sqlitex.Execute(conn, "COMMIT;", nil)
+		if err != nil {
+			panic(err)
+		}
+		committed()
+		source.writing.Store(false)
+		commitTicker.Stop()
+
+		if time.Since(lastOptimize).Hours() >= 1 {
+			lastOptimize = time.Now()
+			dbLog.Info("database optimizing")
+			optimizeDone := metrics.Elapsed("database optimize")
+			err = sqlitex.Execute(conn, "PRAGMA optimize;", nil)
+			if err != nil {
+				panic(err)
+			}
+			optimizeDone()
+
+			// Only the latest change per file is relevant for readers
+			compactDone := metrics.Elapsed("database compact changes")
+			err = sqlitex.Execute(conn, `
+				DELETE FROM changes
+				WHERE id NOT IN (
+					SELECT MAX(id)
+					FROM changes
+					GROUP BY file_id
+				);`, nil)
+			if err != nil {
+				dbLog.Error("unable to compact changes", "err", err)
+			}
+			compactDone()
+		}
+
+		source.transactionMutex.Unlock()
+		inTransaction = false
+		transactionWrites = 0
+
+		if len(pendingEvents) > 0 {
+			source.events.publish(pendingEvents)
+			pendingEvents = pendingEvents[:0]
+		}
+	}
+
+	lastDir := ""
+	appendFile := func(path string, hash ContentHash) {
+		dir, file := filepath.Split(path)
+
+		// Consecutive files mostly share the dir, so the prefix is only
+		// inserted once for all of them
+		if dir != lastDir {
+			upsertPrefix.BindText(1, dir)
+			_, err := upsertPrefix.Step()
+			if err != nil {
+				dbLog.Error("unable to insert path prefix", "dir", dir, "err", err)
+				return
+			}
+			err = upsertPrefix.Reset()
+			if err != nil {
+				panic(err)
+			}
+			lastDir = dir
+		}
+
+		appendPath.BindText(1, file)
+		bindTextOrNull(appendPath, 2, hash.Fast)
+		bindTextOrNull(appendPath, 3, hash.Sha256)
+		bindTimeOrNull(appendPath, 4, hash.Modified)
+		appendPath.BindInt64(5, time.Now().Unix())
+		appendPath.BindText(6, dir)
+		_, err := appendPath.Step()
+		if err != nil {
+			dbLog.Error("unable to insert path filename", "file", file, "err", err)
+			return
+		}
+		err = appendPath.Reset()
+		if err != nil {
+			panic(err)
+		}
+		if conn.Changes() > 0 {
+			pendingEvents = append(pendingEvents, Event{
+				Type: EventFileIndexed,
+				Time: time.Now(),
+				Id:   ImageId(conn.LastInsertRowID()),
+				Path: path,
+			})
+			writeChangeByPath(ChangeAdded, path)
+		}
+	}
 
 	for {
 		select {
@@ -334,27 +1454,17 @@ func (source *Database) writePendingInfosSqlite() {
 				continue
 			}
 
-			err := sqlitex.Execute(conn, "COMMIT;", nil)
-			if err != nil {
-				panic(err)
+			commit()
+
+		case imageInfo := <-source.pending:
+
+			// Large transactions are committed early, so that the
+			// write-ahead log does not grow without bounds on bulk writes
+			size := source.config.TransactionSize
+			if inTransaction && size > 0 && transactionWrites >= size && pendingCompactionTags.Len() == 0 {
+				commit()
 			}
 
-			if time.Since(lastOptimize).Hours() >= 1 {
-				lastOptimize = time.Now()
-				log.Println("database optimizing")
-				optimizeDone := metrics.Elapsed("database optimize")
-				err = sqlitex.Execute(conn, "PRAGMA optimize;", nil)
-				if err != nil {
-					panic(err)
-				}
-				optimizeDone()
-			}
-
-			source.transactionMutex.Unlock()
-			inTransaction = false
-
-		case imageInfo := <-source.pending:
-
 			if !inTransaction {
 				source.transactionMutex.Lock()
 				err := sqlitex.Execute(conn, "BEGIN TRANSACTION;", nil)
@@ -362,39 +1472,40 @@ func (source *Database) writePendingInfosSqlite() {
 					panic(err)
 				}
 				inTransaction = true
+				source.writing.Store(true)
 				commitTicker = time.NewTicker(commitInterval)
 			}
+			transactionWrites += max(1, len(imageInfo.NewPaths))
 
 			switch imageInfo.Type {
-			case AppendPath:
-				dir, file := filepath.Split(imageInfo.Path)
+			case Flush:
+				close(imageInfo.Done)
 
-				upsertPrefix.BindText(1, dir)
-				_, err := upsertPrefix.Step()
-				if err != nil {
-					log.Printf("Unable to insert path prefix %s: %s\n", dir, err.Error())
-					continue
-				}
-				err = upsertPrefix.Reset()
-				if err != nil {
-					panic(err)
-				}
+			case AppendPath:
+				appendFile(imageInfo.Path, imageInfo.Hash)
 
-				appendPath.BindText(1, file)
-				appendPath.BindText(2, dir)
-				_, err = appendPath.Step()
-				if err != nil {
-					log.Printf("Unable to insert path filename %s: %s\n", file, err.Error())
-					continue
-				}
-				err = appendPath.Reset()
-				if err != nil {
-					panic(err)
+			case AppendPaths:
+				for _, np := range imageInfo.NewPaths {
+					appendFile(np.Path, np.Hash)
 				}
 			case UpdateMeta:
 				dir, file := filepath.Split(imageInfo.Path)
 				_, timezoneOffsetSeconds := imageInfo.DateTime.Zone()
 
+				if !imageInfo.Camera.Empty() {
+					upsertCamera.BindText(1, imageInfo.Camera.Make)
+					upsertCamera.BindText(2, imageInfo.Camera.Model)
+					upsertCamera.BindText(3, imageInfo.Camera.Serial)
+					_, err := upsertCamera.Step()
+					if err != nil {
+						dbLog.Error("unable to insert camera", "path", imageInfo.Path, "err", err)
+					}
+					err = upsertCamera.Reset()
+					if err != nil {
+						panic(err)
+					}
+				}
+
 				updateMeta.BindText(1, file)
 				updateMeta.BindInt64(2, (int64)(imageInfo.Width))
 				updateMeta.BindInt64(3, (int64)(imageInfo.Height))
@@ -408,17 +1519,49 @@ func (source *Database) writePendingInfosSqlite() {
 					updateMeta.BindFloat(7, imageInfo.LatLng.Lat.Degrees())
 					updateMeta.BindFloat(8, imageInfo.LatLng.Lng.Degrees())
 				}
-				updateMeta.BindText(9, dir)
+				updateMeta.BindText(9, imageInfo.Camera.Make)
+				updateMeta.BindText(10, imageInfo.Camera.Model)
+				updateMeta.BindText(11, imageInfo.Camera.Serial)
+				updateMeta.BindText(12, dir)
 
 				_, err := updateMeta.Step()
 				if err != nil {
-					log.Printf("Unable to insert image info meta for %s: %s\n", imageInfo.Path, err.Error())
+					dbLog.Error("unable to insert image info meta", "path", imageInfo.Path, "err", err)
 					continue
 				}
 				err = updateMeta.Reset()
 				if err != nil {
 					panic(err)
 				}
+				if imageInfo.Id != 0 {
+					var stmts []*sqlite.Stmt
+					if imageInfo.Description != "" {
+						upsertEmbeddedCaption.BindInt64(1, imageInfo.Id)
+						upsertEmbeddedCaption.BindText(2, imageInfo.Description)
+						stmts = append(stmts, upsertEmbeddedCaption)
+					} else {
+						clearEmbeddedCaption.BindInt64(1, imageInfo.Id)
+						deleteEmptyCaption.BindInt64(1, imageInfo.Id)
+						stmts = append(stmts, clearEmbeddedCaption, deleteEmptyCaption)
+					}
+					for _, stmt := range stmts {
+						_, err = stmt.Step()
+						if rerr := stmt.Reset(); err == nil {
+							err = rerr
+						}
+						if err != nil {
+							dbLog.Error("unable to update caption", "path", imageInfo.Path, "err", err)
+							break
+						}
+					}
+				}
+				writeChangeByPath(ChangeModified, imageInfo.Path)
+				pendingEvents = append(pendingEvents, Event{
+					Type: EventMetadataIndexed,
+					Time: time.Now(),
+					Id:   ImageId(imageInfo.Id),
+					Path: imageInfo.Path,
+				})
 			case UpdateColor:
 				dir, file := filepath.Split(imageInfo.Path)
 
@@ -428,7 +1571,7 @@ func (source *Database) writePendingInfosSqlite() {
 
 				_, err := updateColor.Step()
 				if err != nil {
-					log.Printf("Unable to insert image info meta for %s: %s\n", imageInfo.Path, err.Error())
+					dbLog.Error("unable to insert image info meta", "path", imageInfo.Path, "err", err)
 					continue
 				}
 				err = updateColor.Reset()
@@ -437,19 +1580,29 @@ func (source *Database) writePendingInfosSqlite() {
 				}
 
 			case UpdateAI:
+				err := source.putEmbedding(ImageId(imageInfo.Id), imageInfo.Embedding)
+				if err != nil {
+					dbLog.Error("unable to store embedding", "id", imageInfo.Id, "err", err)
+					continue
+				}
+
 				updateAI.BindInt64(1, int64(imageInfo.Id))
 				updateAI.BindInt64(2, int64(imageInfo.Embedding.InvNormUint16())-clip.InvNormMean)
-				updateAI.BindBytes(3, imageInfo.Embedding.Byte())
 
-				_, err := updateAI.Step()
+				_, err = updateAI.Step()
 				if err != nil {
-					log.Printf("Unable to insert image info ai for %d: %s\n", imageInfo.Id, err.Error())
+					dbLog.Error("unable to insert image info ai", "id", imageInfo.Id, "err", err)
 					continue
 				}
 				err = updateAI.Reset()
 				if err != nil {
 					panic(err)
 				}
+				pendingEvents = append(pendingEvents, Event{
+					Type: EventEmbeddingIndexed,
+					Time: time.Now(),
+					Id:   ImageId(imageInfo.Id),
+				})
 
 			case Delete:
 				id := ImageId(imageInfo.Id)
@@ -467,7 +1620,7 @@ func (source *Database) writePendingInfosSqlite() {
 					deleteTagRange.BindInt64(3, int64(len))
 					_, err := deleteTagRange.Step()
 					if err != nil {
-						log.Printf("Unable to delete tag range %d: %s\n", r.Id, err.Error())
+						dbLog.Error("unable to delete tag range", "id", r.Id, "err", err)
 						continue
 					}
 					err = deleteTagRange.Reset()
@@ -483,7 +1636,7 @@ func (source *Database) writePendingInfosSqlite() {
 						insertTagRange.BindInt64(3, int64(len))
 						_, err := insertTagRange.Step()
 						if err != nil {
-							log.Printf("Unable to insert tag range %d: %s\n", r.Id, err.Error())
+							dbLog.Error("unable to insert tag range", "id", r.Id, "err", err)
 							continue
 						}
 						err = insertTagRange.Reset()
@@ -493,11 +1646,115 @@ func (source *Database) writePendingInfosSqlite() {
 					}
 				}
 
+				writeChangeById(ChangeRemoved, id)
+
+				deleteVideo.BindInt64(1, int64(id))
+				_, err := deleteVideo.Step()
+				if rerr := deleteVideo.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete video", "id", id, "err", err)
+				}
+
+				deleteAudio.BindInt64(1, int64(id))
+				_, err = deleteAudio.Step()
+				if rerr := deleteAudio.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete audio", "id", id, "err", err)
+				}
+
+				deleteMotionPhoto.BindInt64(1, int64(id))
+				_, err = deleteMotionPhoto.Step()
+				if rerr := deleteMotionPhoto.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete motion photo", "id", id, "err", err)
+				}
+
+				deleteProjection.BindInt64(1, int64(id))
+				_, err = deleteProjection.Step()
+				if rerr := deleteProjection.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete projection", "id", id, "err", err)
+				}
+
+				deleteSidecarFiles.BindInt64(1, int64(id))
+				_, err = deleteSidecarFiles.Step()
+				if rerr := deleteSidecarFiles.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete sidecars", "id", id, "err", err)
+				}
+
+				deleteCaption.BindInt64(1, int64(id))
+				_, err = deleteCaption.Step()
+				if rerr := deleteCaption.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete caption", "id", id, "err", err)
+				}
+
+				deleteGeotag.BindInt64(1, int64(id))
+				_, err = deleteGeotag.Step()
+				if rerr := deleteGeotag.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete geotag", "id", id, "err", err)
+				}
+
+				deleteFileTrips.BindInt64(1, int64(id))
+				_, err = deleteFileTrips.Step()
+				if rerr := deleteFileTrips.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete trips", "id", id, "err", err)
+				}
+
+				deleteQuarantine.BindInt64(1, int64(id))
+				_, err = deleteQuarantine.Step()
+				if rerr := deleteQuarantine.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete quarantine", "id", id, "err", err)
+				}
+
+				deleteVerification.BindInt64(1, int64(id))
+				_, err = deleteVerification.Step()
+				if rerr := deleteVerification.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete verification", "id", id, "err", err)
+				}
+
+				deleteAI.BindInt64(1, int64(id))
+				_, err = deleteAI.Step()
+				if rerr := deleteAI.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil {
+					err = source.deleteEmbedding(id)
+				}
+				if err != nil {
+					dbLog.Error("unable to delete embedding", "id", id, "err", err)
+				}
+
 				// Delete image info
 				delete.BindInt64(1, int64(id))
-				_, err := delete.Step()
+				_, err = delete.Step()
 				if err != nil {
-					log.Printf("Unable to delete path %s: %s\n", imageInfo.Path, err.Error())
+					dbLog.Error("unable to delete path", "path", imageInfo.Path, "err", err)
 					continue
 				}
 				err = delete.Reset()
@@ -505,818 +1762,3045 @@ func (source *Database) writePendingInfosSqlite() {
 					panic(err)
 				}
 
-			case Index:
-				upsertIndex.BindText(1, imageInfo.Path)
-				upsertIndex.BindText(2, imageInfo.DateTime.Format(dateFormat))
-				_, err := upsertIndex.Step()
+			case UpdateHash:
+				updateHash.BindText(1, imageInfo.Hash.Fast)
+				bindTextOrNull(updateHash, 2, imageInfo.Hash.Sha256)
+				bindTimeOrNull(updateHash, 3, imageInfo.Hash.Modified)
+				updateHash.BindInt64(4, imageInfo.Id)
+				_, err := updateHash.Step()
 				if err != nil {
-					log.Printf("Unable to set dir to indexed %s: %s\n", imageInfo.Path, err.Error())
+					dbLog.Error("unable to update hash", "id", imageInfo.Id, "err", err)
 					continue
 				}
-				err = upsertIndex.Reset()
+				err = updateHash.Reset()
 				if err != nil {
 					panic(err)
 				}
 
-			case AddTag:
-				tagName := imageInfo.Path
-				upsertTag.BindText(1, tagName)
-				_, err := upsertTag.Step()
+				// Verified against the new hash from now on
+				deleteVerification.BindInt64(1, imageInfo.Id)
+				_, err = deleteVerification.Step()
+				if rerr := deleteVerification.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to delete verification", "id", imageInfo.Id, "err", err)
+				}
+
+			case MovePath:
+				dir, file := filepath.Split(imageInfo.Path)
+
+				upsertPrefix.BindText(1, dir)
+				_, err := upsertPrefix.Step()
 				if err != nil {
-					log.Printf("Unable upsert tag %s: %s\n", tagName, err.Error())
+					dbLog.Error("unable to insert path prefix", "dir", dir, "err", err)
 					continue
 				}
-				err = upsertTag.Reset()
+				err = upsertPrefix.Reset()
 				if err != nil {
 					panic(err)
 				}
-				close(imageInfo.Done)
 
-			case AddTagId:
-				tagName := imageInfo.Path
-				upsertTag.BindText(1, tagName)
-				_, err := upsertTag.Step()
+				movePath.BindText(1, dir)
+				movePath.BindText(2, file)
+				movePath.BindInt64(3, imageInfo.Id)
+				_, err = movePath.Step()
 				if err != nil {
-					log.Printf("Unable upsert tag %s: %s\n", tagName, err.Error())
+					dbLog.Error("unable to move", "id", imageInfo.Id, "path", imageInfo.Path, "err", err)
 					continue
 				}
-				err = upsertTag.Reset()
+				err = movePath.Reset()
 				if err != nil {
 					panic(err)
 				}
+				writeChangeByPath(ChangeModified, imageInfo.Path)
+
+			case UpdateCamera:
+				id := int64(imageInfo.Camera.Id)
+				offset := int64(imageInfo.Camera.ClockOffset.Seconds())
+
+				updateCameraInfos.BindInt64(1, offset)
+				updateCameraInfos.BindInt64(2, id)
+				updateCameraInfos.BindInt64(3, id)
+				_, err := updateCameraInfos.Step()
+				if err == nil {
+					err = updateCameraInfos.Reset()
+				}
 
-				// Get tag id
-				getTagId.BindText(1, tagName)
-				ok, err := getTagId.Step()
-				if err != nil {
-					log.Printf("Unable to get tag id for %s: %s\n", tagName, err.Error())
-					continue
+				if err == nil {
+					updateCamera.BindInt64(1, offset)
+					updateCamera.BindInt64(2, id)
+					_, err = updateCamera.Step()
+					if err == nil {
+						err = updateCamera.Reset()
+					}
 				}
-				if !ok {
-					log.Printf("Unable to get tag id for %s, returned false\n", tagName)
-					continue
+
+				if err == nil {
+					insertChangeByCamera.BindText(1, string(ChangeModified))
+					insertChangeByCamera.BindInt64(2, time.Now().Unix())
+					insertChangeByCamera.BindInt64(3, id)
+					_, err = insertChangeByCamera.Step()
+					if err == nil {
+						err = insertChangeByCamera.Reset()
+					}
 				}
-				tagId := tag.Id(getTagId.ColumnInt64(0))
-				err = getTagId.Reset()
+
 				if err != nil {
-					panic(err)
+					dbLog.Error("unable to update camera", "id", id, "err", err)
 				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
 
-				// Add tag range
-				min := imageInfo.Id
-				len := 0
-				insertTagRange.BindInt64(1, int64(tagId))
-				insertTagRange.BindInt64(2, int64(min))
-				insertTagRange.BindInt64(3, int64(len))
-				_, err = insertTagRange.Step()
+			case UpdateOrientationProposal:
+				p := imageInfo.Proposal
+				insertOrientationProposal.BindInt64(1, int64(p.Id))
+				insertOrientationProposal.BindInt64(2, int64(p.Orientation))
+				insertOrientationProposal.BindFloat(3, float64(p.Confidence))
+				insertOrientationProposal.BindText(4, string(p.Status))
+				insertOrientationProposal.BindInt64(5, p.CreatedAt.Unix())
+				_, err := insertOrientationProposal.Step()
 				if err != nil {
-					log.Printf("Unable to insert tag %s: %s\n", tagName, err.Error())
+					dbLog.Error("unable to insert orientation proposal", "id", p.Id, "err", err)
 					continue
 				}
-				err = insertTagRange.Reset()
+				err = insertOrientationProposal.Reset()
 				if err != nil {
 					panic(err)
 				}
-				pendingCompactionTags.Add(tagId)
-
-			case AddTagIds, RemoveTagIds, InvertTagIds, CompactTagIds:
-				tagId := tag.Id(imageInfo.Id)
 
-				ids := source.getTagImageIdsWithConn(conn, tagId)
-				switch imageInfo.Type {
-				case AddTagIds:
-					ids.AddTree(imageInfo.Ids)
-				case RemoveTagIds:
-					ids.SubtractTree(imageInfo.Ids)
-				case InvertTagIds:
-					ids.InvertTree(imageInfo.Ids)
-				case CompactTagIds:
-					// Tags being compacted do not change
-				default:
-					panic("Unknown tag id diff type")
+			case WriteAudit:
+				a := imageInfo.Audit
+				insertAudit.BindInt64(1, a.CreatedAt.Unix())
+				insertAudit.BindText(2, a.Actor)
+				insertAudit.BindText(3, a.Method)
+				insertAudit.BindText(4, string(a.Action))
+				insertAudit.BindText(5, a.Target)
+				if len(a.Details) > 0 {
+					details, err := json.Marshal(a.Details)
+					if err != nil {
+						dbLog.Error("unable to encode audit details", "err", err)
+					}
+					insertAudit.BindBytes(6, details)
+				} else {
+					insertAudit.BindNull(6)
 				}
-
-				// Delete all tag ranges
-				deleteTagRanges.BindInt64(1, int64(tagId))
-				_, err := deleteTagRanges.Step()
+				_, err := insertAudit.Step()
 				if err != nil {
-					log.Printf("Unable to delete tag ranges %d: %s\n", tagId, err.Error())
+					dbLog.Error("unable to insert audit", "action", a.Action, "err", err)
 					continue
 				}
-				err = deleteTagRanges.Reset()
+				err = insertAudit.Reset()
 				if err != nil {
 					panic(err)
 				}
-
-				// Insert new tag ranges
-				for r := range ids.RangeChan() {
-					min := r.Low
-					len := r.High - r.Low
-					insertTagRange.BindInt64(1, int64(tagId))
-					insertTagRange.BindInt64(2, int64(min))
-					insertTagRange.BindInt64(3, int64(len))
-					_, err := insertTagRange.Step()
+				if a.Ids == nil {
+					continue
+				}
+				auditId := conn.LastInsertRowID()
+				for r := range a.Ids.RangeChan() {
+					insertAuditRange.BindInt64(1, auditId)
+					insertAuditRange.BindInt64(2, int64(r.Low))
+					insertAuditRange.BindInt64(3, int64(r.High-r.Low))
+					_, err := insertAuditRange.Step()
 					if err != nil {
-						log.Printf("Unable to insert tag range %d: %s\n", tagId, err.Error())
+						dbLog.Error("unable to insert audit range", "audit_id", auditId, "err", err)
 						continue
 					}
-					err = insertTagRange.Reset()
+					err = insertAuditRange.Reset()
 					if err != nil {
 						panic(err)
 					}
 				}
 
-				// Increment tag revision
-				incrementTagRevision.BindInt64(1, int64(tagId))
-				ok, err := incrementTagRevision.Step()
-				if err != nil {
-					log.Printf("Unable to increment tag revision %d: %s\n", tagId, err.Error())
-					continue
-				}
-				if !ok {
-					panic("Unable to increment tag revision, returned false")
+			case UpdateUserState:
+				user := imageInfo.User
+				state := imageInfo.State
+
+				current := UserState{Key: state.Key}
+				getUserState.BindText(1, user)
+				getUserState.BindText(2, state.Key)
+				exists, err := getUserState.Step()
+				if err == nil && exists {
+					current.Value = []byte(getUserState.ColumnText(0))
+					current.Version = getUserState.ColumnInt64(1)
+					current.UpdatedAt = time.Unix(getUserState.ColumnInt64(2), 0)
 				}
-				rev := incrementTagRevision.ColumnInt(0)
-				err = incrementTagRevision.Reset()
-				if err != nil {
-					panic(err)
+				if rerr := getUserState.Reset(); err == nil {
+					err = rerr
 				}
 
-				imageInfo.Done <- rev
-				close(imageInfo.Done)
-			}
-		}
+				if err == nil && state.Version != AnyVersion && state.Version != current.Version {
+					err = &VersionConflictError{Current: current}
+				}
 
-	}
-}
+				if err == nil && state.Value == nil {
+					if current.Version == 0 {
+						err = ErrNotFound
+					} else {
+						deleteUserState.BindText(1, user)
+						deleteUserState.BindText(2, state.Key)
+						_, err = deleteUserState.Step()
+						if rerr := deleteUserState.Reset(); err == nil {
+							err = rerr
+						}
+					}
+				} else if err == nil {
+					if current.Version == 0 {
+						countUserState.BindText(1, user)
+						_, err = countUserState.Step()
+						if err == nil && countUserState.ColumnInt(0) >= MaxUserStateKeys {
+							err = ErrTooManyKeys
+						}
+						if rerr := countUserState.Reset(); err == nil {
+							err = rerr
+						}
+					}
+					if err == nil {
+						state.Version = current.Version + 1
+						state.UpdatedAt = time.Now()
+						upsertUserState.BindText(1, user)
+						upsertUserState.BindText(2, state.Key)
+						upsertUserState.BindBytes(3, state.Value)
+						upsertUserState.BindInt64(4, state.Version)
+						upsertUserState.BindInt64(5, state.UpdatedAt.Unix())
+						_, err = upsertUserState.Step()
+						if rerr := upsertUserState.Reset(); err == nil {
+							err = rerr
+						}
+					}
+				}
 
-func (source *Database) GetPathFromId(id ImageId) (string, bool) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+				if err != nil {
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- state
+				}
+				close(imageInfo.Done)
 
-	stmt := conn.Prep(`
-		SELECT str || filename as path
-		FROM infos
-		JOIN prefix ON path_prefix_id == prefix.id
-		WHERE infos.id == ?;`)
-	defer stmt.Reset()
+			case WriteSearch:
+				user := imageInfo.User
+				search := imageInfo.Search
+				step := func(stmt *sqlite.Stmt) error {
+					_, err := stmt.Step()
+					if rerr := stmt.Reset(); err == nil {
+						err = rerr
+					}
+					return err
+				}
 
-	stmt.BindInt64(1, (int64)(id))
+				var previous Search
+				getLatestSearch.BindText(1, user)
+				getLatestSearch.BindText(2, search.CollectionId)
+				exists, err := getLatestSearch.Step()
+				if err == nil && exists {
+					previous.Id = getLatestSearch.ColumnInt64(0)
+					previous.Query = getLatestSearch.ColumnText(1)
+					previous.SearchedAt = time.Unix(getLatestSearch.ColumnInt64(2), 0)
+					previous.Name = getLatestSearch.ColumnText(3)
+				}
+				if rerr := getLatestSearch.Reset(); err == nil {
+					err = rerr
+				}
 
-	exists, _ := stmt.Step()
-	if !exists {
-		return "", false
-	}
+				if err == nil && exists && replacesSearch(previous, search.Query, search.SearchedAt) {
+					deleteSearch.BindInt64(1, previous.Id)
+					deleteSearch.BindText(2, user)
+					err = step(deleteSearch)
+				}
+				if err == nil {
+					upsertSearch.BindText(1, user)
+					upsertSearch.BindText(2, search.CollectionId)
+					upsertSearch.BindText(3, search.Query)
+					upsertSearch.BindInt64(4, search.SearchedAt.Unix())
+					err = step(upsertSearch)
+				}
+				if err == nil {
+					pruneSearches.BindText(1, user)
+					pruneSearches.BindInt64(2, MaxSearchHistory)
+					err = step(pruneSearches)
+				}
+				if err != nil {
+					dbLog.Error("unable to write search", "query", search.Query, "err", err)
+				}
 
-	return stmt.ColumnText(0), true
-}
+			case SaveSearch:
+				search := imageInfo.Search
+				upsertSavedSearch.BindText(1, imageInfo.User)
+				upsertSavedSearch.BindText(2, search.CollectionId)
+				upsertSavedSearch.BindText(3, search.Query)
+				upsertSavedSearch.BindInt64(4, search.SearchedAt.Unix())
+				upsertSavedSearch.BindText(5, search.Name)
+				exists, err := upsertSavedSearch.Step()
+				if err == nil && exists {
+					search.Id = upsertSavedSearch.ColumnInt64(0)
+					search.SearchedAt = time.Unix(upsertSavedSearch.ColumnInt64(1), 0)
+				}
+				if rerr := upsertSavedSearch.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- search
+				}
+				close(imageInfo.Done)
 
-func (source *Database) Get(id ImageId) (InfoResult, bool) {
+			case DeleteSearch:
+				deleteSearch.BindInt64(1, imageInfo.Search.Id)
+				deleteSearch.BindText(2, imageInfo.User)
+				_, err := deleteSearch.Step()
+				if rerr := deleteSearch.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && conn.Changes() == 0 {
+					err = ErrNotFound
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
 
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+			case WritePanorama:
+				p := imageInfo.Panorama
+				insertPanorama.BindInt64(1, p.CreatedAt.Unix())
+				_, err := insertPanorama.Step()
+				if rerr := insertPanorama.Reset(); err == nil {
+					err = rerr
+				}
+				id := conn.LastInsertRowID()
+				for i, fileId := range p.Files {
+					if err != nil {
+						break
+					}
+					insertPanoramaFile.BindInt64(1, int64(fileId))
+					insertPanoramaFile.BindInt64(2, id)
+					insertPanoramaFile.BindInt64(3, int64(i))
+					_, err = insertPanoramaFile.Step()
+					if rerr := insertPanoramaFile.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to insert panorama", "err", err)
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- id
+				}
+				close(imageInfo.Done)
 
-	stmt := conn.Prep(`
-		SELECT width, height, orientation, color, created_at, latitude, longitude
-		FROM infos
-		WHERE id == ?;`)
-	defer stmt.Reset()
+			case UpdateVideo:
+				v := imageInfo.Video
+				chapters, err := marshalChapters(v.Chapters)
+				if err == nil {
+					upsertVideo.BindInt64(1, imageInfo.Id)
+					upsertVideo.BindInt64(2, v.Duration.Milliseconds())
+					bindTextOrNull(upsertVideo, 3, v.Codec)
+					upsertVideo.BindFloat(4, v.FrameRate)
+					upsertVideo.BindText(5, string(chapters))
+					_, err = upsertVideo.Step()
+					if rerr := upsertVideo.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write video", "id", imageInfo.Id, "err", err)
+				}
 
-	stmt.BindInt64(1, (int64)(id))
+			case UpdateAudio:
+				a := imageInfo.Audio
+				var err error
+				if a.Path == "" {
+					deleteAudio.BindInt64(1, imageInfo.Id)
+					_, err = deleteAudio.Step()
+					if rerr := deleteAudio.Reset(); err == nil {
+						err = rerr
+					}
+				} else {
+					upsertAudio.BindInt64(1, imageInfo.Id)
+					upsertAudio.BindText(2, a.Path)
+					upsertAudio.BindInt64(3, a.Duration.Milliseconds())
+					_, err = upsertAudio.Step()
+					if rerr := upsertAudio.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write audio", "id", imageInfo.Id, "err", err)
+				}
 
-	var info InfoResult
+			case UpdateMotionPhoto:
+				m := imageInfo.Motion
+				var err error
+				if m.Length == 0 {
+					deleteMotionPhoto.BindInt64(1, imageInfo.Id)
+					_, err = deleteMotionPhoto.Step()
+					if rerr := deleteMotionPhoto.Reset(); err == nil {
+						err = rerr
+					}
+				} else {
+					upsertMotionPhoto.BindInt64(1, imageInfo.Id)
+					upsertMotionPhoto.BindInt64(2, m.Offset)
+					upsertMotionPhoto.BindInt64(3, m.Length)
+					_, err = upsertMotionPhoto.Step()
+					if rerr := upsertMotionPhoto.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write motion photo", "id", imageInfo.Id, "err", err)
+				}
 
-	exists, _ := stmt.Step()
-	if !exists {
+			case UpdateProjection:
+				p := imageInfo.Projection
+				var err error
+				if p.Type == "" {
+					deleteProjection.BindInt64(1, imageInfo.Id)
+					_, err = deleteProjection.Step()
+					if rerr := deleteProjection.Reset(); err == nil {
+						err = rerr
+					}
+				} else {
+					upsertProjection.BindInt64(1, imageInfo.Id)
+					upsertProjection.BindText(2, p.Type)
+					upsertProjection.BindInt64(3, int64(p.FullWidth))
+					upsertProjection.BindInt64(4, int64(p.FullHeight))
+					upsertProjection.BindInt64(5, int64(p.CroppedLeft))
+					upsertProjection.BindInt64(6, int64(p.CroppedTop))
+					upsertProjection.BindInt64(7, int64(p.CroppedWidth))
+					upsertProjection.BindInt64(8, int64(p.CroppedHeight))
+					upsertProjection.BindFloat(9, p.PoseHeading)
+					_, err = upsertProjection.Step()
+					if rerr := upsertProjection.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write projection", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateSidecars:
+				deleteSidecarFiles.BindInt64(1, imageInfo.Id)
+				_, err := deleteSidecarFiles.Step()
+				if rerr := deleteSidecarFiles.Reset(); err == nil {
+					err = rerr
+				}
+				for _, f := range imageInfo.Sidecars {
+					if err != nil {
+						break
+					}
+					insertSidecarFile.BindText(1, f.Path)
+					insertSidecarFile.BindInt64(2, imageInfo.Id)
+					insertSidecarFile.BindText(3, f.Kind)
+					insertSidecarFile.BindInt64(4, f.Modified.Unix())
+					_, err = insertSidecarFile.Step()
+					if rerr := insertSidecarFile.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write sidecars", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateCaption:
+				var stmts []*sqlite.Stmt
+				if imageInfo.Caption != nil {
+					upsertEditedCaption.BindInt64(1, imageInfo.Id)
+					upsertEditedCaption.BindText(2, *imageInfo.Caption)
+					upsertEditedCaption.BindInt64(3, time.Now().Unix())
+					stmts = append(stmts, upsertEditedCaption)
+				} else {
+					clearEditedCaption.BindInt64(1, imageInfo.Id)
+					deleteEmptyCaption.BindInt64(1, imageInfo.Id)
+					stmts = append(stmts, clearEditedCaption, deleteEmptyCaption)
+				}
+				var err error
+				for _, stmt := range stmts {
+					_, err = stmt.Step()
+					if rerr := stmt.Reset(); err == nil {
+						err = rerr
+					}
+					if err != nil {
+						break
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to update caption", "id", imageInfo.Id, "err", err)
+				} else {
+					writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateGeotag, ResetGeotag:
+				var err error
+				latlng := imageInfo.Geotag.LatLng
+				if imageInfo.Type == UpdateGeotag {
+					upsertGeotag.BindInt64(1, imageInfo.Id)
+					upsertGeotag.BindFloat(2, latlng.Lat.Degrees())
+					upsertGeotag.BindFloat(3, latlng.Lng.Degrees())
+					upsertGeotag.BindInt64(4, time.Now().Unix())
+					upsertGeotag.BindBool(5, imageInfo.Geotag.Edited)
+					_, err = upsertGeotag.Step()
+					if rerr := upsertGeotag.Reset(); err == nil {
+						err = rerr
+					}
+				} else {
+					// Back to the location from the metadata of the file
+					latlng = imageInfo.LatLng
+					deleteGeotag.BindInt64(1, imageInfo.Id)
+					_, err = deleteGeotag.Step()
+					if rerr := deleteGeotag.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err == nil {
+					if IsNaNLatLng(latlng) {
+						updateLocation.BindNull(1)
+						updateLocation.BindNull(2)
+					} else {
+						updateLocation.BindFloat(1, latlng.Lat.Degrees())
+						updateLocation.BindFloat(2, latlng.Lng.Degrees())
+					}
+					updateLocation.BindInt64(3, imageInfo.Id)
+					_, err = updateLocation.Step()
+					if rerr := updateLocation.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write geotag", "id", imageInfo.Id, "err", err)
+				} else {
+					writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+					pendingEvents = append(pendingEvents, Event{
+						Type: EventMetadataIndexed,
+						Time: time.Now(),
+						Id:   ImageId(imageInfo.Id),
+					})
+				}
+				if imageInfo.Done != nil {
+					imageInfo.Done <- err
+					close(imageInfo.Done)
+				}
+
+			case UpdateTrips:
+				step := func(stmt *sqlite.Stmt) error {
+					_, err := stmt.Step()
+					if rerr := stmt.Reset(); err == nil {
+						err = rerr
+					}
+					return err
+				}
+				clearTripsDetected.BindText(1, imageInfo.Collection)
+				err := step(clearTripsDetected)
+				for _, t := range imageInfo.Trips {
+					if err != nil {
+						break
+					}
+					upsertTrip.BindText(1, imageInfo.Collection)
+					upsertTrip.BindText(2, t.Name)
+					upsertTrip.BindInt64(3, t.Start.Unix())
+					upsertTrip.BindInt64(4, t.End.Unix())
+					if IsNaNLatLng(t.LatLng) {
+						upsertTrip.BindNull(5)
+						upsertTrip.BindNull(6)
+					} else {
+						upsertTrip.BindFloat(5, t.LatLng.Lat.Degrees())
+						upsertTrip.BindFloat(6, t.LatLng.Lng.Degrees())
+					}
+					upsertTrip.BindInt64(7, int64(t.Cover))
+					var exists bool
+					exists, err = upsertTrip.Step()
+					var id int64
+					if exists {
+						id = upsertTrip.ColumnInt64(0)
+					}
+					if rerr := upsertTrip.Reset(); err == nil {
+						err = rerr
+					}
+					if err != nil {
+						break
+					}
+					deleteTripFiles.BindInt64(1, id)
+					err = step(deleteTripFiles)
+					for _, fileId := range t.Files {
+						if err != nil {
+							break
+						}
+						insertTripFile.BindInt64(1, id)
+						insertTripFile.BindInt64(2, int64(fileId))
+						err = step(insertTripFile)
+					}
+				}
+				if err == nil {
+					deleteUndetectedTrips.BindText(1, imageInfo.Collection)
+					err = step(deleteUndetectedTrips)
+				}
+				if err == nil {
+					err = step(deleteOrphanTripFiles)
+				}
+				if err != nil {
+					dbLog.Error("unable to write trips", "collection", imageInfo.Collection, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdatePanoramaPreview:
+				p := imageInfo.Panorama
+				updatePanoramaPreview.BindText(1, p.Preview)
+				updatePanoramaPreview.BindInt64(2, p.Id)
+				_, err := updatePanoramaPreview.Step()
+				if rerr := updatePanoramaPreview.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to update panorama preview", "id", p.Id, "err", err)
+				}
+
+			case UpdateVerification:
+				v := imageInfo.Verification
+				upsertVerification.BindInt64(1, int64(v.Id))
+				upsertVerification.BindInt64(2, v.VerifiedAt.Unix())
+				upsertVerification.BindText(3, string(v.Status))
+				bindTextOrNull(upsertVerification, 4, v.Detail)
+				if v.ModifiedAt.IsZero() {
+					upsertVerification.BindNull(5)
+				} else {
+					upsertVerification.BindInt64(5, v.ModifiedAt.Unix())
+				}
+				_, err := upsertVerification.Step()
+				if rerr := upsertVerification.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to write verification", "id", v.Id, "err", err)
+				}
+
+			case QuarantineFile:
+				q := imageInfo.Quarantine
+				upsertQuarantine.BindInt64(1, int64(q.Id))
+				upsertQuarantine.BindText(2, string(q.Stage))
+				upsertQuarantine.BindText(3, q.Error)
+				upsertQuarantine.BindInt64(4, q.QuarantinedAt.Unix())
+				_, err := upsertQuarantine.Step()
+				if rerr := upsertQuarantine.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to quarantine file", "id", q.Id, "err", err)
+				} else {
+					writeChangeById(ChangeModified, q.Id)
+				}
+
+			case ReleaseFile:
+				deleteQuarantine.BindInt64(1, imageInfo.Id)
+				_, err := deleteQuarantine.Step()
+				if rerr := deleteQuarantine.Reset(); err == nil {
+					err = rerr
+				}
+				if err != nil {
+					dbLog.Error("unable to release file", "id", imageInfo.Id, "err", err)
+				} else if conn.Changes() > 0 {
+					writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+
+			case RejectPanorama:
+				id := imageInfo.Panorama.Id
+				rejectPanorama.BindInt64(1, id)
+				_, err := rejectPanorama.Step()
+				if rerr := rejectPanorama.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && conn.Changes() == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to reject panorama", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateOrientationProposalStatus:
+				p := imageInfo.Proposal
+				updateOrientationProposalStatus.BindText(1, string(p.Status))
+				updateOrientationProposalStatus.BindInt64(2, int64(p.Id))
+				_, err := updateOrientationProposalStatus.Step()
+				if err == nil {
+					err = updateOrientationProposalStatus.Reset()
+				}
+				if err != nil {
+					dbLog.Error("unable to update orientation proposal", "id", p.Id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateDimensions:
+				updateDimensions.BindInt64(1, int64(imageInfo.Width))
+				updateDimensions.BindInt64(2, int64(imageInfo.Height))
+				updateDimensions.BindInt64(3, int64(imageInfo.Orientation))
+				updateDimensions.BindInt64(4, imageInfo.Id)
+				_, err := updateDimensions.Step()
+				if err == nil {
+					err = updateDimensions.Reset()
+				}
+				if err != nil {
+					dbLog.Error("unable to update dimensions", "id", imageInfo.Id, "err", err)
+				} else {
+					writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+
+			case UpdateOrientationEdit:
+				id := imageInfo.Id
+				edit := imageInfo.Orientation
+
+				// The stored orientation includes the previous edit, which
+				// is undone before applying the new one
+				getOrientationEdit.BindInt64(1, id)
+				exists, err := getOrientationEdit.Step()
+				var orientation, previous Orientation
+				if err == nil && !exists {
+					err = ErrNotFound
+				}
+				if err == nil {
+					orientation = Orientation(getOrientationEdit.ColumnInt(0))
+					previous = Orientation(getOrientationEdit.ColumnInt(1))
+				}
+				if rerr := getOrientationEdit.Reset(); err == nil {
+					err = rerr
+				}
+
+				if err == nil {
+					swap := previous.SwapsDimensions() != edit.SwapsDimensions()
+					updateOrientation.BindInt64(1, int64(orientation.Compose(previous.Inverse()).Compose(edit)))
+					updateOrientation.BindBool(2, swap)
+					updateOrientation.BindBool(3, swap)
+					updateOrientation.BindInt64(4, id)
+					_, err = updateOrientation.Step()
+					if err == nil {
+						err = updateOrientation.Reset()
+					}
+				}
+
+				if err == nil && edit == Normal {
+					deleteOrientationEdit.BindInt64(1, id)
+					_, err = deleteOrientationEdit.Step()
+					if err == nil {
+						err = deleteOrientationEdit.Reset()
+					}
+				} else if err == nil {
+					upsertOrientationEdit.BindInt64(1, id)
+					upsertOrientationEdit.BindInt64(2, int64(edit))
+					upsertOrientationEdit.BindInt64(3, time.Now().Unix())
+					_, err = upsertOrientationEdit.Step()
+					if err == nil {
+						err = upsertOrientationEdit.Reset()
+					}
+				}
+
+				if err == nil {
+					// Proposals are applied on top of the previous edit
+					resolveOrientationProposal.BindInt64(1, int64(editDelta(previous, edit)))
+					resolveOrientationProposal.BindInt64(2, id)
+					_, err = resolveOrientationProposal.Step()
+					if err == nil {
+						err = resolveOrientationProposal.Reset()
+					}
+				}
+
+				if err != nil {
+					dbLog.Error("unable to update orientation edit", "id", id, "err", err)
+				} else {
+					writeChangeById(ChangeModified, ImageId(id))
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case Index:
+				upsertIndex.BindText(1, imageInfo.Path)
+				upsertIndex.BindText(2, imageInfo.DateTime.Format(dateFormat))
+				_, err := upsertIndex.Step()
+				if err != nil {
+					dbLog.Error("unable to set dir to indexed", "path", imageInfo.Path, "err", err)
+					continue
+				}
+				err = upsertIndex.Reset()
+				if err != nil {
+					panic(err)
+				}
+
+			case UpdateTagMeta:
+				m := imageInfo.TagMeta
+				updateTagMeta.BindText(1, m.Color)
+				updateTagMeta.BindText(2, m.Icon)
+				updateTagMeta.BindText(3, m.Description)
+				updateTagMeta.BindBool(4, m.Pinned)
+				updateTagMeta.BindInt64(5, imageInfo.Id)
+				_, err := updateTagMeta.Step()
+				if rerr := updateTagMeta.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && conn.Changes() == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to update tag meta", "tag_id", imageInfo.Id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case RenameTag:
+				getTagId.BindText(1, imageInfo.Path)
+				exists, err := getTagId.Step()
+				if rerr := getTagId.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && exists {
+					err = ErrTagExists
+				}
+				if err == nil {
+					renameTag.BindText(1, imageInfo.Path)
+					renameTag.BindInt64(2, imageInfo.Id)
+					_, err = renameTag.Step()
+					if rerr := renameTag.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err == nil && conn.Changes() == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound && err != ErrTagExists {
+					dbLog.Error("unable to rename tag", "tag_id", imageInfo.Id, "name", imageInfo.Path, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case MergeTag:
+				from := tag.Id(imageInfo.Id)
+				into := imageInfo.MergeInto
+
+				merged := source.getTagImageIdsWithConn(conn, from)
+				ids := source.getTagImageIdsWithConn(conn, into)
+				before := ids.Clone()
+				ids.AddTree(merged)
+
+				// The name of the merged tag is gone once it is removed
+				events := appendTagEvents(nil, tagName, from, merged, NewIds())
+				events = appendTagEvents(events, tagName, into, before, ids)
+
+				// Rolled back as a whole on failure, so that the files do
+				// not end up in both tags or in neither
+				release := sqlitex.Save(conn)
+				rev, err := writeTagIds(into, ids)
+				if err == nil && source.config.TagRevisions > 0 {
+					writeTagRevision(into, rev, TagOpMerge, before, ids)
+				}
+				if err == nil {
+					err = removeTag(from)
+				}
+				release(&err)
+				if err != nil {
+					dbLog.Error("unable to merge tag", "tag_id", from, "into", into, "err", err)
+					imageInfo.Done <- err
+				} else {
+					pendingEvents = append(pendingEvents, events...)
+					imageInfo.Done <- rev
+				}
+				close(imageInfo.Done)
+
+			case WriteSelection:
+				sel := imageInfo.Selection
+				err := removeExpiredSelections(sel.CreatedAt)
+				if err == nil {
+					upsertTag.BindText(1, sel.Tag.Name)
+					_, err = upsertTag.Step()
+					if rerr := upsertTag.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err == nil {
+					getTagId.BindText(1, sel.Tag.Name)
+					var exists bool
+					exists, err = getTagId.Step()
+					if err == nil && exists {
+						sel.Tag.Id = tag.Id(getTagId.ColumnInt64(0))
+					}
+					if rerr := getTagId.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err == nil {
+					insertSelection.BindInt64(1, int64(sel.Tag.Id))
+					insertSelection.BindText(2, imageInfo.User)
+					insertSelection.BindText(3, sel.CollectionId)
+					insertSelection.BindInt64(4, sel.CreatedAt.Unix())
+					insertSelection.BindInt64(5, sel.ExpiresAt.Unix())
+					var exists bool
+					exists, err = insertSelection.Step()
+					if err == nil && exists {
+						sel.Id = insertSelection.ColumnInt64(0)
+					}
+					if rerr := insertSelection.Reset(); err == nil {
+						err = rerr
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write selection", "err", err)
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- sel
+				}
+				close(imageInfo.Done)
+
+			case TouchSelection:
+				sel := imageInfo.Selection
+				touchSelection.BindInt64(1, sel.ExpiresAt.Unix())
+				touchSelection.BindInt64(2, sel.Id)
+				touchSelection.BindText(3, imageInfo.User)
+				touchSelection.BindInt64(4, time.Now().Unix())
+				_, err := touchSelection.Step()
+				if rerr := touchSelection.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && conn.Changes() == 0 {
+					err = ErrNotFound
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case DeleteSelection:
+				id := imageInfo.Selection.Id
+				getSelectionTagId.BindInt64(1, id)
+				getSelectionTagId.BindText(2, imageInfo.User)
+				exists, err := getSelectionTagId.Step()
+				var tagId tag.Id
+				if err == nil && exists {
+					tagId = tag.Id(getSelectionTagId.ColumnInt64(0))
+				}
+				if rerr := getSelectionTagId.Reset(); err == nil {
+					err = rerr
+				}
+				if err == nil && !exists {
+					err = ErrNotFound
+				}
+				if err == nil {
+					err = removeSelection(id, tagId)
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to delete selection", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case AddTag:
+				tagName := imageInfo.Path
+				upsertTag.BindText(1, tagName)
+				_, err := upsertTag.Step()
+				if err != nil {
+					dbLog.Error("unable to upsert tag", "tag", tagName, "err", err)
+					continue
+				}
+				err = upsertTag.Reset()
+				if err != nil {
+					panic(err)
+				}
+				close(imageInfo.Done)
+
+			case AddTagId:
+				tagName := imageInfo.Path
+				upsertTag.BindText(1, tagName)
+				_, err := upsertTag.Step()
+				if err != nil {
+					dbLog.Error("unable to upsert tag", "tag", tagName, "err", err)
+					continue
+				}
+				err = upsertTag.Reset()
+				if err != nil {
+					panic(err)
+				}
+
+				// Get tag id
+				getTagId.BindText(1, tagName)
+				ok, err := getTagId.Step()
+				if err != nil {
+					dbLog.Error("unable to get tag id", "tag", tagName, "err", err)
+					continue
+				}
+				if !ok {
+					dbLog.Error("unable to get tag id", "tag", tagName)
+					continue
+				}
+				tagId := tag.Id(getTagId.ColumnInt64(0))
+				err = getTagId.Reset()
+				if err != nil {
+					panic(err)
+				}
+
+				// Add tag range
+				min := imageInfo.Id
+				len := 0
+				insertTagRange.BindInt64(1, int64(tagId))
+				insertTagRange.BindInt64(2, int64(min))
+				insertTagRange.BindInt64(3, int64(len))
+				_, err = insertTagRange.Step()
+				if err != nil {
+					dbLog.Error("unable to insert tag", "tag", tagName, "err", err)
+					continue
+				}
+				err = insertTagRange.Reset()
+				if err != nil {
+					panic(err)
+				}
+				pendingCompactionTags.Add(tagId)
+
+			case AddTagIds, RemoveTagIds, InvertTagIds, CompactTagIds, RollbackTagIds:
+				tagId := tag.Id(imageInfo.Id)
+
+				ids := source.getTagImageIdsWithConn(conn, tagId)
+				before := ids.Clone()
+				switch imageInfo.Type {
+				case AddTagIds:
+					ids.AddTree(imageInfo.Ids)
+				case RemoveTagIds:
+					ids.SubtractTree(imageInfo.Ids)
+				case InvertTagIds:
+					ids.InvertTree(imageInfo.Ids)
+				case CompactTagIds:
+					// Tags being compacted do not change
+				case RollbackTagIds:
+					added, removed := composeTagChanges(listTagChangesWithConn(conn, tagId, imageInfo.Revision, math.MaxInt))
+					ids.SubtractTree(added)
+					ids.AddTree(removed)
+				default:
+					panic("Unknown tag id diff type")
+				}
+
+				rev, err := writeTagIds(tagId, ids)
+				if err != nil {
+					continue
+				}
+
+				if imageInfo.Type != CompactTagIds {
+					pendingEvents = appendTagEvents(pendingEvents, tagName, tagId, before, ids)
+					if source.config.TagRevisions > 0 {
+						writeTagRevision(tagId, rev, tagWriteOps[imageInfo.Type], before, ids)
+					}
+				}
+
+				imageInfo.Done <- rev
+				close(imageInfo.Done)
+			}
+		}
+
+	}
+}
+
+// appendTagEvents appends the events of the files added to and removed
+// from the tag
+func appendTagEvents(events []Event, tagName func(tag.Id) string, id tag.Id, before Ids, after Ids) []Event {
+	added := after.Clone()
+	added.SubtractTree(before)
+	removed := before.Clone()
+	removed.SubtractTree(after)
+	if added.Len() == 0 && removed.Len() == 0 {
+		return events
+	}
+
+	name := tagName(id)
+	now := time.Now()
+	if added.Len() > 0 {
+		events = append(events, Event{
+			Type: EventTagAdded,
+			Time: now,
+			Tag:  name,
+			Ids:  added,
+		})
+	}
+	if removed.Len() > 0 {
+		events = append(events, Event{
+			Type: EventTagRemoved,
+			Time: now,
+			Tag:  name,
+			Ids:  removed,
+		})
+	}
+	return events
+}
+
+func bindTextOrNull(stmt *sqlite.Stmt, param int, value string) {
+	if value == "" {
+		stmt.BindNull(param)
+	} else {
+		stmt.BindText(param, value)
+	}
+}
+
+func bindTimeOrNull(stmt *sqlite.Stmt, param int, value time.Time) {
+	if value.IsZero() {
+		stmt.BindNull(param)
+	} else {
+		stmt.BindInt64(param, value.Unix())
+	}
+}
+
+func (source *Database) GetPathFromId(id ImageId) (string, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT str || filename as path
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE infos.id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, (int64)(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return "", false
+	}
+
+	return stmt.ColumnText(0), true
+}
+
+func (source *Database) GetIdFromPath(path string) (ImageId, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT infos.id
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE str == ? AND filename == ?;`)
+	defer stmt.Reset()
+
+	dir, file := filepath.Split(path)
+	stmt.BindText(1, dir)
+	stmt.BindText(2, file)
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return 0, false
+	}
+
+	return ImageId(stmt.ColumnInt64(0)), true
+}
+
+// ListPrefixes lists the path prefixes of all stored files
+func (source *Database) ListPrefixes() []string {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT str
+		FROM prefix
+		WHERE EXISTS (
+			SELECT 1
+			FROM infos
+			WHERE path_prefix_id == prefix.id
+		);`)
+	defer stmt.Reset()
+
+	prefixes := make([]string, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing prefixes", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		prefixes = append(prefixes, stmt.ColumnText(0))
+	}
+	return prefixes
+}
+
+// RenameDirs renames the indexed dirs using the provided function
+func (source *Database) RenameDirs(rename func(string) string) (err error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	paths := make([]string, 0)
+	err = sqlitex.Execute(conn, `SELECT path FROM dirs;`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			paths = append(paths, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	defer sqlitex.Save(conn)(&err)
+	for _, path := range paths {
+		renamed := rename(path)
+		if renamed == path {
+			continue
+		}
+		err = sqlitex.Execute(conn, `
+			INSERT OR IGNORE INTO dirs(path, indexed_at)
+			SELECT ?, indexed_at
+			FROM dirs
+			WHERE path == ?;`, &sqlitex.ExecOptions{
+			Args: []interface{}{renamed, path},
+		})
+		if err != nil {
+			return err
+		}
+		err = sqlitex.Execute(conn, `DELETE FROM dirs WHERE path == ?;`, &sqlitex.ExecOptions{
+			Args: []interface{}{path},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCamera(stmt *sqlite.Stmt) Camera {
+	return Camera{
+		Id:          CameraId(stmt.ColumnInt64(0)),
+		Make:        stmt.ColumnText(1),
+		Model:       stmt.ColumnText(2),
+		Serial:      stmt.ColumnText(3),
+		ClockOffset: time.Duration(stmt.ColumnInt64(4)) * time.Second,
+	}
+}
+
+func (source *Database) ListCameras() []Camera {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT id, make, model, serial, clock_offset
+		FROM camera
+		ORDER BY make, model, serial;`)
+	defer stmt.Reset()
+
+	cameras := make([]Camera, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing cameras", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		cameras = append(cameras, readCamera(stmt))
+	}
+	return cameras
+}
+
+func (source *Database) GetCamera(id CameraId) (Camera, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT id, make, model, serial, clock_offset
+		FROM camera
+		WHERE id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return Camera{}, false
+	}
+	return readCamera(stmt), true
+}
+
+func readOrientationProposal(stmt *sqlite.Stmt) OrientationProposal {
+	return OrientationProposal{
+		Id:          ImageId(stmt.ColumnInt64(0)),
+		Orientation: Orientation(stmt.ColumnInt(1)),
+		Confidence:  float32(stmt.ColumnFloat(2)),
+		Status:      OrientationStatus(stmt.ColumnText(3)),
+		CreatedAt:   time.Unix(stmt.ColumnInt64(4), 0),
+	}
+}
+
+func (source *Database) GetOrientationProposal(id ImageId) (OrientationProposal, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT file_id, orientation, confidence, status, created_at_unix
+		FROM orientation_proposal
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return OrientationProposal{}, false
+	}
+	return readOrientationProposal(stmt), true
+}
+
+// ListOrientationProposals lists the pending proposals of files in the
+// dirs, most confident first
+func (source *Database) ListOrientationProposals(dirs []string, limit int) []OrientationProposal {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := `
+		SELECT file_id, orientation_proposal.orientation, confidence, status, created_at_unix
+		FROM orientation_proposal
+		JOIN infos ON infos.id == file_id
+		WHERE status == 'pending' AND path_prefix_id IN (
+			SELECT id
+			FROM prefix
+			WHERE
+	`
+
+	for i := range dirs {
+		sql += `str LIKE ? `
+		if i < len(dirs)-1 {
+			sql += "OR "
+		}
+	}
+
+	sql += `
+		)
+		ORDER BY confidence DESC
+	`
+
+	if limit > 0 {
+		sql += `LIMIT ? `
+	}
+
+	sql += ";"
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+
+	bindIndex := 1
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+
+	if limit > 0 {
+		stmt.BindInt64(bindIndex, (int64)(limit))
+	}
+
+	proposals := make([]OrientationProposal, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing orientation proposals", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		proposals = append(proposals, readOrientationProposal(stmt))
+	}
+	return proposals
+}
+
+// ListOrientationCandidates lists the files in the dirs with an unknown or
+// normal orientation that were not taken with a known camera, which record
+// their orientation, and were not detected or edited before
+func (source *Database) ListOrientationCandidates(dirs []string, limit int) <-chan IdPath {
+	out := make(chan IdPath, 1000)
+	go func() {
+		defer metrics.Elapsed("list orientation candidates sqlite")()
+		defer close(out)
+
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
+
+		sql := `
+			SELECT infos.id, str || filename as path
+			FROM infos
+			INNER JOIN prefix ON prefix.id = path_prefix_id
+			LEFT JOIN orientation_proposal ON orientation_proposal.file_id = infos.id
+			LEFT JOIN orientation_edit ON orientation_edit.file_id = infos.id
+			WHERE
+				infos.orientation IN (0, 1) AND
+				camera_id IS NULL AND
+				orientation_proposal.file_id IS NULL AND
+				orientation_edit.file_id IS NULL AND
+				path_prefix_id IN (
+					SELECT id
+					FROM prefix
+					WHERE
+		`
+
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
+
+		sql += `
+			)
+		`
+
+		if limit > 0 {
+			sql += `LIMIT ? `
+		}
+
+		sql += ";"
+
+		stmt := conn.Prep(sql)
+		defer stmt.Reset()
+
+		bindIndex := 1
+		for _, dir := range dirs {
+			stmt.BindText(bindIndex, dir+"%")
+			bindIndex++
+		}
+
+		if limit > 0 {
+			stmt.BindInt64(bindIndex, (int64)(limit))
+		}
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing orientation candidates", "err", err)
+				break
+			} else if !exists {
+				break
+			}
+			out <- IdPath{
+				Id:   ImageId(stmt.ColumnInt64(0)),
+				Path: stmt.ColumnText(1),
+			}
+		}
+	}()
+	return out
+}
+
+// ListOrientationEdits returns the edits of all edited files
+func (source *Database) ListOrientationEdits() map[ImageId]Orientation {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT file_id, orientation
+		FROM orientation_edit;`)
+	defer stmt.Reset()
+
+	edits := make(map[ImageId]Orientation)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing orientation edits", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		edits[ImageId(stmt.ColumnInt64(0))] = Orientation(stmt.ColumnInt(1))
+	}
+	return edits
+}
+
+// GetFileCamera returns the camera the file was taken with
+func (source *Database) GetFileCamera(id ImageId) (Camera, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT camera.id, make, model, serial, clock_offset
+		FROM infos
+		JOIN camera ON camera_id == camera.id
+		WHERE infos.id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return Camera{}, false
+	}
+	return readCamera(stmt), true
+}
+
+// GetVideo returns the probed format of the video, false if it has not been
+// probed
+func (source *Database) GetVideo(id ImageId) (Video, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT duration_ms, codec, frame_rate, chapters
+		FROM video
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return Video{}, false
+	}
+	v := Video{
+		Duration:  time.Duration(stmt.ColumnInt64(0)) * time.Millisecond,
+		Codec:     stmt.ColumnText(1),
+		FrameRate: stmt.ColumnFloat(2),
+	}
+	if chapters := stmt.ColumnText(3); chapters != "" {
+		var err error
+		v.Chapters, err = unmarshalChapters([]byte(chapters))
+		if err != nil {
+			dbLog.Error("unable to read chapters of video", "id", id, "err", err)
+		}
+	}
+	return v, true
+}
+
+// GetAudio returns the audio recorded alongside the file, false if there
+// is none
+func (source *Database) GetAudio(id ImageId) (Audio, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT path, duration_ms
+		FROM audio
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return Audio{}, false
+	}
+	return Audio{
+		Path:     stmt.ColumnText(0),
+		Duration: time.Duration(stmt.ColumnInt64(1)) * time.Millisecond,
+	}, true
+}
+
+// GetMotionPhoto returns the location of the video embedded in the motion
+// photo, false if it is not one
+func (source *Database) GetMotionPhoto(id ImageId) (MotionPhoto, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT offset, length
+		FROM motion_photo
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return MotionPhoto{}, false
+	}
+	return MotionPhoto{
+		Offset: stmt.ColumnInt64(0),
+		Length: stmt.ColumnInt64(1),
+	}, true
+}
+
+// GetProjection returns the projection of the 360° photo, false if it is
+// not one
+func (source *Database) GetProjection(id ImageId) (gpano.Projection, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT type, full_width, full_height, cropped_left, cropped_top, cropped_width, cropped_height, pose_heading
+		FROM projection
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return gpano.Projection{}, false
+	}
+	return gpano.Projection{
+		Type:          stmt.ColumnText(0),
+		FullWidth:     stmt.ColumnInt(1),
+		FullHeight:    stmt.ColumnInt(2),
+		CroppedLeft:   stmt.ColumnInt(3),
+		CroppedTop:    stmt.ColumnInt(4),
+		CroppedWidth:  stmt.ColumnInt(5),
+		CroppedHeight: stmt.ColumnInt(6),
+		PoseHeading:   stmt.ColumnFloat(7),
+	}, true
+}
+
+// GetSidecarFile returns the sidecar file at the path, false if it is not
+// associated with a file
+func (source *Database) GetSidecarFile(path string) (SidecarFile, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT path, file_id, kind, modified_unix
+		FROM sidecar_file
+		WHERE path == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, path)
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return SidecarFile{}, false
+	}
+	return readSidecarFile(stmt), true
+}
+
+// ListSidecarFiles lists the sidecar files associated with the file
+func (source *Database) ListSidecarFiles(id ImageId) []SidecarFile {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT path, file_id, kind, modified_unix
+		FROM sidecar_file
+		WHERE file_id == ?
+		ORDER BY path;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	var files []SidecarFile
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing sidecar files", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		files = append(files, readSidecarFile(stmt))
+	}
+	return files
+}
+
+func readSidecarFile(stmt *sqlite.Stmt) SidecarFile {
+	return SidecarFile{
+		Path:     stmt.ColumnText(0),
+		Id:       ImageId(stmt.ColumnInt64(1)),
+		Kind:     stmt.ColumnText(2),
+		Modified: time.Unix(stmt.ColumnInt64(3), 0),
+	}
+}
+
+// GetGeotag returns the location of the file correlated from a GPS track
+// or set by hand, false if it was not geotagged
+func (source *Database) GetGeotag(id ImageId) (Geotag, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT latitude, longitude, edited
+		FROM geotag
+		WHERE file_id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return Geotag{LatLng: NaNLatLng()}, false
+	}
+	return Geotag{
+		LatLng: s2.LatLngFromDegrees(stmt.ColumnFloat(0), stmt.ColumnFloat(1)),
+		Edited: stmt.ColumnBool(2),
+	}, true
+}
+
+const tripColumns = `
+	SELECT id, collection_id, name, start_unix, end_unix, latitude, longitude, cover_id,
+		(SELECT count(*) FROM trip_file WHERE trip_id == trip.id)
+	FROM trip
+`
+
+func readTrip(stmt *sqlite.Stmt) Trip {
+	t := Trip{
+		Id:         stmt.ColumnInt64(0),
+		Collection: stmt.ColumnText(1),
+		Name:       stmt.ColumnText(2),
+		Start:      time.Unix(stmt.ColumnInt64(3), 0),
+		End:        time.Unix(stmt.ColumnInt64(4), 0),
+		LatLng:     NaNLatLng(),
+		Cover:      ImageId(stmt.ColumnInt64(7)),
+		Count:      stmt.ColumnInt(8),
+	}
+	if stmt.ColumnType(5) != sqlite.TypeNull && stmt.ColumnType(6) != sqlite.TypeNull {
+		t.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(5), stmt.ColumnFloat(6))
+	}
+	return t
+}
+
+// ListTrips lists the trips detected in the collection, newest first
+func (source *Database) ListTrips(collection string, limit int) []Trip {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := tripColumns + `
+		WHERE collection_id == ?
+		ORDER BY start_unix DESC`
+	if limit > 0 {
+		sql += `
+		LIMIT ?`
+	}
+	stmt := conn.Prep(sql + ";")
+	defer stmt.Reset()
+
+	stmt.BindText(1, collection)
+	if limit > 0 {
+		stmt.BindInt64(2, int64(limit))
+	}
+
+	trips := make([]Trip, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing trips", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		trips = append(trips, readTrip(stmt))
+	}
+	return trips
+}
+
+func (source *Database) GetTrip(id int64) (Trip, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(tripColumns + `
+		WHERE id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, id)
+
+	exists, err := stmt.Step()
+	if err != nil {
+		dbLog.Error("error getting trip", "id", id, "err", err)
+		return Trip{}, false
+	}
+	if !exists {
+		return Trip{}, false
+	}
+	return readTrip(stmt), true
+}
+
+// ListCameraIds lists the ids of the files taken with the camera
+func (source *Database) ListCameraIds(id CameraId) <-chan ImageId {
+	out := make(chan ImageId, 1000)
+	go func() {
+		defer close(out)
+
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
+
+		stmt := conn.Prep(`
+			SELECT id
+			FROM infos
+			WHERE camera_id == ?;`)
+		defer stmt.Reset()
+
+		stmt.BindInt64(1, int64(id))
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing camera files", "err", err)
+				break
+			} else if !exists {
+				break
+			}
+			out <- ImageId(stmt.ColumnInt64(0))
+		}
+	}()
+	return out
+}
+
+// GetSetting returns the value of the setting the database was last
+// migrated with, false if it was never written
+func (source *Database) GetSetting(key string) (string, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT value
+		FROM setting
+		WHERE key == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, key)
+	exists, _ := stmt.Step()
+	if !exists {
+		return "", false
+	}
+	return stmt.ColumnText(0), true
+}
+
+// WriteSetting writes the value of the setting the database was migrated
+// with
+func (source *Database) WriteSetting(key string, value string) error {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	return sqlitex.Execute(conn, `
+		INSERT INTO setting(key, value)
+		VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value;`, &sqlitex.ExecOptions{
+		Args: []interface{}{key, value},
+	})
+}
+
+func (source *Database) Get(id ImageId) (InfoResult, bool) {
+	defer metrics.ObserveQuery("get")()
+
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT width, height, orientation, color, created_at, latitude, longitude,
+			coalesce(caption.edited, caption.embedded, '')
+		FROM infos
+		LEFT JOIN caption ON caption.file_id == infos.id
+		WHERE id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, (int64)(id))
+
+	var info InfoResult
+
+	exists, _ := stmt.Step()
+	if !exists {
 		return info, false
 	}
 
-	info.Width = stmt.ColumnInt(0)
-	info.Height = stmt.ColumnInt(1)
-	info.SizeNull = stmt.ColumnType(0) == sqlite.TypeNull || stmt.ColumnType(1) == sqlite.TypeNull
+	info.Width = stmt.ColumnInt(0)
+	info.Height = stmt.ColumnInt(1)
+	info.SizeNull = stmt.ColumnType(0) == sqlite.TypeNull || stmt.ColumnType(1) == sqlite.TypeNull
+
+	info.Orientation = Orientation(stmt.ColumnInt(2))
+	info.OrientationNull = stmt.ColumnType(2) == sqlite.TypeNull
+
+	info.Color = (uint32)(stmt.ColumnInt64(3))
+	info.ColorNull = stmt.ColumnType(3) == sqlite.TypeNull
+
+	info.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(4))
+	info.DateTimeNull = stmt.ColumnType(4) == sqlite.TypeNull
+
+	info.LatLngNull = stmt.ColumnType(5) == sqlite.TypeNull || stmt.ColumnType(6) == sqlite.TypeNull
+	if info.LatLngNull {
+		info.LatLng = NaNLatLng()
+	} else {
+		info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(5), stmt.ColumnFloat(6))
+	}
+
+	info.Description = stmt.ColumnText(7)
+
+	return info, true
+}
+
+func (source *Database) GetBatch(ids []ImageId) <-chan InfoListResult {
+	out := make(chan InfoListResult, 1000)
+	go func() {
+		defer metrics.ObserveQuery("get_batch")()
+
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
+
+		sql := `
+		SELECT id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+		FROM infos
+		WHERE id IN (`
+
+		length := len(ids)
+		if length > 1 {
+			sql += strings.Repeat("?, ", length-1)
+		}
+		sql += `?);`
+
+		stmt := conn.Prep(sql)
+		defer stmt.Reset()
+
+		for i, id := range ids {
+			stmt.BindInt64(1+i, (int64)(id))
+		}
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing files", "err", err)
+			} else if !exists {
+				break
+			}
+
+			var info InfoListResult
+			info.Id = (ImageId)(stmt.ColumnInt64(0))
+
+			info.Width = stmt.ColumnInt(1)
+			info.Height = stmt.ColumnInt(2)
+			info.SizeNull = stmt.ColumnType(1) == sqlite.TypeNull || stmt.ColumnType(2) == sqlite.TypeNull
+
+			info.Orientation = Orientation(stmt.ColumnInt(3))
+			info.OrientationNull = stmt.ColumnType(3) == sqlite.TypeNull
+
+			info.Color = (uint32)(stmt.ColumnInt64(4))
+			info.ColorNull = stmt.ColumnType(4) == sqlite.TypeNull
+
+			unix := stmt.ColumnInt64(5)
+			timezoneOffset := stmt.ColumnInt(6)
+
+			info.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
+			info.DateTimeNull = stmt.ColumnType(5) == sqlite.TypeNull
+
+			info.LatLngNull = stmt.ColumnType(7) == sqlite.TypeNull || stmt.ColumnType(8) == sqlite.TypeNull
+			if info.LatLngNull {
+				info.LatLng = NaNLatLng()
+			} else {
+				info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(7), stmt.ColumnFloat(8))
+			}
+
+			out <- info
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (source *Database) GetDir(dir string) (InfoResult, bool) {
+
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT indexed_at FROM dirs
+		WHERE path = ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, dir)
+
+	var imageInfo InfoResult
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return imageInfo, false
+	}
+
+	imageInfo.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(0))
+	imageInfo.DateTimeNull = stmt.ColumnType(0) == sqlite.TypeNull
+
+	return imageInfo, true
+}
+
+func (source *Database) GetDirsCount(dirs []string) (int, bool) {
+
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := `
+	SELECT COUNT(id)
+	FROM infos
+	WHERE path_prefix_id IN (
+		SELECT id
+		FROM prefix
+		WHERE
+	`
+
+	for i := range dirs {
+		sql += `str LIKE ? `
+		if i < len(dirs)-1 {
+			sql += "OR "
+		}
+	}
+
+	sql += `
+		)
+	`
+
+	stmt := conn.Prep(sql)
+	bindIndex := 1
+	defer stmt.Reset()
+
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+
+	if exists, err := stmt.Step(); err != nil {
+		dbLog.Error("error listing files", "err", err)
+	} else if !exists {
+		return 0, false
+	}
+
+	return stmt.ColumnInt(0), true
+}
+
+func readUserState(stmt *sqlite.Stmt) UserState {
+	return UserState{
+		Key:       stmt.ColumnText(0),
+		Value:     []byte(stmt.ColumnText(1)),
+		Version:   stmt.ColumnInt64(2),
+		UpdatedAt: time.Unix(stmt.ColumnInt64(3), 0),
+	}
+}
+
+func (source *Database) ListUserState(user string) ([]UserState, error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT key, value, version, updated_at_unix
+		FROM user_state
+		WHERE user_name == ?
+		ORDER BY key;`)
+	defer stmt.Reset()
+	stmt.BindText(1, user)
+
+	states := make([]UserState, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			return nil, err
+		} else if !exists {
+			break
+		}
+		states = append(states, readUserState(stmt))
+	}
+	return states, nil
+}
+
+func (source *Database) GetUserState(user string, key string) (UserState, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT key, value, version, updated_at_unix
+		FROM user_state
+		WHERE user_name == ? AND key == ?;`)
+	defer stmt.Reset()
+	stmt.BindText(1, user)
+	stmt.BindText(2, key)
+
+	exists, err := stmt.Step()
+	if err != nil {
+		dbLog.Error("unable to get user state", "key", key, "err", err)
+		return UserState{}, false
+	}
+	if !exists {
+		return UserState{}, false
+	}
+	return readUserState(stmt), true
+}
+
+func (source *Database) ListSearches(user string, saved bool, limit int) ([]Search, error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT id, collection_id, query, searched_at_unix, name
+		FROM search
+		WHERE user_name == ? AND (? == 0 OR name IS NOT NULL)
+		ORDER BY searched_at_unix DESC, id DESC
+		LIMIT ?;`)
+	defer stmt.Reset()
+	stmt.BindText(1, user)
+	stmt.BindBool(2, saved)
+	stmt.BindInt64(3, int64(limit))
+
+	searches := make([]Search, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			return nil, err
+		} else if !exists {
+			break
+		}
+		searches = append(searches, Search{
+			Id:           stmt.ColumnInt64(0),
+			CollectionId: stmt.ColumnText(1),
+			Query:        stmt.ColumnText(2),
+			SearchedAt:   time.Unix(stmt.ColumnInt64(3), 0),
+			Name:         stmt.ColumnText(4),
+		})
+	}
+	return searches, nil
+}
+
+func (source *Database) ListAudit(query AuditQuery) ([]AuditEntry, error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := `
+		SELECT id, created_at_unix, actor, method, action, target, details
+		FROM audit
+		WHERE 1
+	`
+	if query.Actor != nil {
+		sql += `AND actor == ? `
+	}
+	if query.Action != "" {
+		sql += `AND action == ? `
+	}
+	if query.FileId != 0 {
+		sql += `AND id IN (
+			SELECT audit_id
+			FROM audit_file
+			WHERE file_id <= ? AND file_id + len >= ?
+		) `
+	}
+	if !query.Since.IsZero() {
+		sql += `AND created_at_unix >= ? `
+	}
+	if query.Before > 0 {
+		sql += `AND id < ? `
+	}
+	sql += `
+		ORDER BY id DESC
+	`
+	if query.Limit > 0 {
+		sql += `LIMIT ? `
+	}
+	sql += ";"
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
 
-	info.Orientation = Orientation(stmt.ColumnInt(2))
-	info.OrientationNull = stmt.ColumnType(2) == sqlite.TypeNull
+	bindIndex := 1
+	if query.Actor != nil {
+		stmt.BindText(bindIndex, *query.Actor)
+		bindIndex++
+	}
+	if query.Action != "" {
+		stmt.BindText(bindIndex, string(query.Action))
+		bindIndex++
+	}
+	if query.FileId != 0 {
+		stmt.BindInt64(bindIndex, int64(query.FileId))
+		bindIndex++
+		stmt.BindInt64(bindIndex, int64(query.FileId))
+		bindIndex++
+	}
+	if !query.Since.IsZero() {
+		stmt.BindInt64(bindIndex, query.Since.Unix())
+		bindIndex++
+	}
+	if query.Before > 0 {
+		stmt.BindInt64(bindIndex, query.Before)
+		bindIndex++
+	}
+	if query.Limit > 0 {
+		stmt.BindInt64(bindIndex, int64(query.Limit))
+	}
 
-	info.Color = (uint32)(stmt.ColumnInt64(3))
-	info.ColorNull = stmt.ColumnType(3) == sqlite.TypeNull
+	entries := make([]AuditEntry, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			return nil, err
+		} else if !exists {
+			break
+		}
+		e := AuditEntry{
+			Id:        stmt.ColumnInt64(0),
+			CreatedAt: time.Unix(stmt.ColumnInt64(1), 0),
+			Actor:     stmt.ColumnText(2),
+			Method:    stmt.ColumnText(3),
+			Action:    AuditAction(stmt.ColumnText(4)),
+			Target:    stmt.ColumnText(5),
+		}
+		if details := stmt.ColumnText(6); details != "" {
+			if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+				dbLog.Error("unable to decode audit details", "id", e.Id, "err", err)
+			}
+		}
+		entries = append(entries, e)
+	}
 
-	info.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(4))
-	info.DateTimeNull = stmt.ColumnType(4) == sqlite.TypeNull
+	ranges := conn.Prep(`
+		SELECT file_id, len
+		FROM audit_file
+		WHERE audit_id == ?;`)
+	for i := range entries {
+		ranges.BindInt64(1, entries[i].Id)
+		for {
+			if exists, err := ranges.Step(); err != nil {
+				return nil, err
+			} else if !exists {
+				break
+			}
+			if entries[i].Ids == nil {
+				entries[i].Ids = NewIds()
+			}
+			min := ranges.ColumnInt(0)
+			len := ranges.ColumnInt(1)
+			entries[i].Ids.Add(IdFromTo(min, min+len))
+		}
+		if err := ranges.Reset(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
 
-	info.LatLngNull = stmt.ColumnType(5) == sqlite.TypeNull || stmt.ColumnType(6) == sqlite.TypeNull
-	if info.LatLngNull {
-		info.LatLng = NaNLatLng()
-	} else {
-		info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(5), stmt.ColumnFloat(6))
+func (source *Database) GetHash(id ImageId) (ContentHash, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT hash, sha256
+		FROM infos
+		WHERE id == ? AND hash IS NOT NULL;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, (int64)(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return ContentHash{}, false
 	}
 
-	return info, true
+	return ContentHash{
+		Fast:   stmt.ColumnText(0),
+		Sha256: stmt.ColumnText(1),
+	}, true
 }
 
-func (source *Database) GetBatch(ids []ImageId) <-chan InfoListResult {
-	out := make(chan InfoListResult, 1000)
-	go func() {
+func (source *Database) ListIdPathsByHash(hash string) []IdPath {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT infos.id, str || filename as path, hash, sha256
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		WHERE hash == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, hash)
+
+	var ips []IdPath
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing files by hash", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		ips = append(ips, IdPath{
+			Id:   ImageId(stmt.ColumnInt64(0)),
+			Path: stmt.ColumnText(1),
+			Hash: ContentHash{
+				Fast:   stmt.ColumnText(2),
+				Sha256: stmt.ColumnText(3),
+			},
+		})
+	}
+	return ips
+}
+
+func (source *Database) AddTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(AddTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Database) RemoveTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(RemoveTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Database) InvertTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(InvertTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Database) GetTagImageIds(id tag.Id) Ids {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+	return source.getTagImageIdsWithConn(conn, id)
+}
+
+func (source *Database) getTagImageIdsWithConn(conn *sqlite.Conn, id tag.Id) Ids {
+	stmt := conn.Prep(`
+	SELECT infos_tag.file_id, infos_tag.len
+	FROM infos_tag
+	JOIN tag ON infos_tag.tag_id = tag.id
+	WHERE tag.id = ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	ids := NewIds()
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing files", "err", err)
+		} else if !exists {
+			break
+		}
+		min := stmt.ColumnInt(0)
+		len := stmt.ColumnInt(1)
+		ids.Add(IdFromTo(min, min+len))
+	}
+	return ids
+}
 
+func (source *Database) ListTagRanges(id tag.Id) <-chan IdRange {
+	out := make(chan IdRange, 100)
+	go func() {
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
-		sql := `
-		SELECT id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
-		FROM infos
-		WHERE id IN (`
+		stmt := conn.Prep(`
+		SELECT infos_tag.file_id, infos_tag.len
+		FROM infos_tag
+		JOIN tag ON infos_tag.tag_id = tag.id
+		WHERE tag.id = ?;`)
+		defer stmt.Reset()
 
-		length := len(ids)
-		if length > 1 {
-			sql += strings.Repeat("?, ", length-1)
+		stmt.BindInt64(1, int64(id))
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing files", "err", err)
+			} else if !exists {
+				break
+			}
+			min := stmt.ColumnInt(0)
+			len := stmt.ColumnInt(1)
+			out <- IdFromTo(min, min+len)
 		}
-		sql += `?);`
+		close(out)
+	}()
+	return out
+}
 
-		stmt := conn.Prep(sql)
+func (source *Database) ListImageTagRanges(id ImageId) <-chan TagIdRange {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+	return source.listImageTagRangesWithConn(conn, id)
+}
+
+func (source *Database) listImageTagRangesWithConn(conn *sqlite.Conn, id ImageId) <-chan TagIdRange {
+	out := make(chan TagIdRange, 100)
+	go func() {
+		stmt := conn.Prep(`
+		SELECT tag_id, file_id, len
+		FROM infos_tag
+		WHERE :file_id >= file_id AND :file_id <= file_id + len;`)
 		defer stmt.Reset()
 
-		for i, id := range ids {
-			stmt.BindInt64(1+i, (int64)(id))
-		}
+		stmt.BindInt64(1, int64(id))
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
+				dbLog.Error("error listing files", "err", err)
 			} else if !exists {
 				break
 			}
+			tagId := tag.Id(stmt.ColumnInt(0))
+			min := stmt.ColumnInt(1)
+			len := stmt.ColumnInt(2)
+			out <- TagIdRange{
+				Id:      tagId,
+				IdRange: IdFromTo(min, min+len),
+			}
+		}
+		close(out)
+	}()
+	return out
+}
 
-			var info InfoListResult
-			info.Id = (ImageId)(stmt.ColumnInt64(0))
+func (source *Database) GetTagByName(name string) (tag.Tag, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-			info.Width = stmt.ColumnInt(1)
-			info.Height = stmt.ColumnInt(2)
-			info.SizeNull = stmt.ColumnType(1) == sqlite.TypeNull || stmt.ColumnType(2) == sqlite.TypeNull
+	stmt := conn.Prep(`
+	SELECT id, name, revision, ` + tagMetaColumns + `
+	FROM tag
+	WHERE name = ?;`)
+	defer stmt.Reset()
 
-			info.Orientation = Orientation(stmt.ColumnInt(3))
-			info.OrientationNull = stmt.ColumnType(3) == sqlite.TypeNull
+	stmt.BindText(1, name)
 
-			info.Color = (uint32)(stmt.ColumnInt64(4))
-			info.ColorNull = stmt.ColumnType(4) == sqlite.TypeNull
+	exists, _ := stmt.Step()
+	if !exists {
+		return tag.Tag{}, false
+	}
 
-			unix := stmt.ColumnInt64(5)
-			timezoneOffset := stmt.ColumnInt(6)
+	return columnTag(stmt), true
+}
 
-			info.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
-			info.DateTimeNull = stmt.ColumnType(5) == sqlite.TypeNull
+func (source *Database) GetTagId(name string) (tag.Id, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-			info.LatLngNull = stmt.ColumnType(7) == sqlite.TypeNull || stmt.ColumnType(8) == sqlite.TypeNull
-			if info.LatLngNull {
-				info.LatLng = NaNLatLng()
-			} else {
-				info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(7), stmt.ColumnFloat(8))
-			}
+	stmt := conn.Prep(`
+	SELECT id
+	FROM tag
+	WHERE name = ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, name)
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return 0, false
+	}
+
+	return tag.Id(stmt.ColumnInt(0)), true
+}
+
+func (source *Database) GetTagName(id tag.Id) (string, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+	SELECT name
+	FROM tag
+	WHERE id = ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+
+	exists, _ := stmt.Step()
+	if !exists {
+		return "", false
+	}
 
-			out <- info
-		}
-		close(out)
-	}()
-	return out
+	return stmt.ColumnText(0), true
 }
 
-func (source *Database) GetDir(dir string) (InfoResult, bool) {
-
+func (source *Database) GetTagRevision(id tag.Id) (int, error) {
 	conn := source.pool.Get(nil)
 	defer source.pool.Put(conn)
 
 	stmt := conn.Prep(`
-		SELECT indexed_at FROM dirs
-		WHERE path = ?;`)
+	SELECT revision
+	FROM tag
+	WHERE id = ?;`)
 	defer stmt.Reset()
 
-	stmt.BindText(1, dir)
-
-	var imageInfo InfoResult
+	stmt.BindInt64(1, int64(id))
 
 	exists, _ := stmt.Step()
 	if !exists {
-		return imageInfo, false
+		return 0, errors.New("tag not found")
 	}
 
-	imageInfo.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(0))
-	imageInfo.DateTimeNull = stmt.ColumnType(0) == sqlite.TypeNull
+	return stmt.ColumnInt(0), nil
+}
 
-	return imageInfo, true
+// tagMetaColumns are the columns of the display metadata of tags read by
+// columnTag after the id, name and revision
+const tagMetaColumns string = `color, icon, description, pinned`
+
+// columnTag returns the tag of the current row of the statement selecting
+// the id, name, revision and tagMetaColumns of tags
+func columnTag(stmt *sqlite.Stmt) tag.Tag {
+	return tag.Tag{
+		Id:       tag.Id(stmt.ColumnInt(0)),
+		Name:     stmt.ColumnText(1),
+		Revision: stmt.ColumnInt(2),
+		Meta: tag.Meta{
+			Color:       stmt.ColumnText(3),
+			Icon:        stmt.ColumnText(4),
+			Description: stmt.ColumnText(5),
+			Pinned:      stmt.ColumnBool(6),
+		},
+	}
 }
 
-func (source *Database) GetDirsCount(dirs []string) (int, bool) {
+// defaultTagConditions hide the tags of selections, while the rest of the
+// system tags are listed, so that the files they flag can be found
+const defaultTagConditions string = `
+	AND name NOT LIKE 'sys:select:%'
+`
 
+// ListTagsWithPrefix lists all the tags with names starting with the prefix
+func (source *Database) ListTagsWithPrefix(prefix string) []tag.Tag {
 	conn := source.pool.Get(nil)
 	defer source.pool.Put(conn)
 
-	sql := `
-	SELECT COUNT(id)
-	FROM infos
-	WHERE path_prefix_id IN (
-		SELECT id
-		FROM prefix
-		WHERE
-	`
+	stmt := conn.Prep(`
+		SELECT id, name, revision, ` + tagMetaColumns + `
+		FROM tag
+		WHERE substr(name, 1, ?) = ?
+		ORDER BY name ASC;`)
+	defer stmt.Reset()
 
-	for i := range dirs {
-		sql += `str LIKE ? `
-		if i < len(dirs)-1 {
-			sql += "OR "
+	stmt.BindInt64(1, int64(len(prefix)))
+	stmt.BindText(2, prefix)
+
+	var tags []tag.Tag
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing tags", "err", err)
+			break
+		} else if !exists {
+			break
 		}
+		tags = append(tags, columnTag(stmt))
 	}
+	return tags
+}
 
-	sql += `
-		)
-	`
+func (source *Database) ListImageTags(id ImageId) <-chan tag.Tag {
+	out := make(chan tag.Tag, 100)
+	go func() {
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
 
-	stmt := conn.Prep(sql)
-	bindIndex := 1
-	defer stmt.Reset()
+		sql := `
+		SELECT id, name, revision, ` + tagMetaColumns + `
+		FROM infos_tag
+		JOIN tag ON infos_tag.tag_id = tag.id
+		WHERE :file_id >= file_id AND :file_id <= file_id + len
+		`
 
-	for _, dir := range dirs {
-		stmt.BindText(bindIndex, dir+"%")
-		bindIndex++
-	}
+		sql += defaultTagConditions
 
-	if exists, err := stmt.Step(); err != nil {
-		log.Printf("error listing files: %s\n", err.Error())
-	} else if !exists {
-		return 0, false
-	}
+		sql += `
+		ORDER BY pinned DESC, length(name) ASC, name ASC;`
 
-	return stmt.ColumnInt(0), true
-}
+		stmt := conn.Prep(sql)
+		defer stmt.Reset()
 
-func (source *Database) Write(path string, info Info, writeType InfoWriteType) error {
-	source.pending <- &InfoWrite{
-		Path: path,
-		Info: info,
-		Type: writeType,
-	}
-	return nil
-}
+		stmt.BindInt64(1, int64(id))
 
-func (source *Database) CompactTag(id tag.Id) <-chan struct{} {
-	done := make(chan struct{})
-	go func() {
-		d := make(chan any)
-		source.pending <- &InfoWrite{
-			Id:   int64(id),
-			Type: CompactTagIds,
-			Done: d,
-		}
-		<-d
-		close(done)
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing tags", "err", err)
+			} else if !exists {
+				break
+			}
+			out <- columnTag(stmt)
+		}
+		close(out)
 	}()
-	return done
+	return out
 }
 
-func (source *Database) WriteTags(id ImageId, tags []tag.Tag) error {
-	for _, t := range tags {
-		source.pending <- &InfoWrite{
-			Id:   int64(id),
-			Type: AddTagId,
-			Path: t.Name,
-		}
-	}
-	return nil
-}
+func (source *Database) ListTags(q string, limit int) <-chan tag.Tag {
+	out := make(chan tag.Tag, 100)
+	go func() {
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
 
-func (source *Database) Delete(id ImageId) error {
-	source.pending <- &InfoWrite{
-		Id:   int64(id),
-		Type: Delete,
-	}
-	return nil
-}
+		sql := `
+		SELECT id, name, revision, ` + tagMetaColumns + `
+		FROM tag
+		WHERE name LIKE ?
+		`
 
-func (source *Database) WriteAI(id ImageId, embedding clip.Embedding) error {
-	source.pending <- &InfoWrite{
-		Id:        int64(id),
-		Type:      UpdateAI,
-		Embedding: embedding,
-	}
-	return nil
+		sql += defaultTagConditions
+
+		sql += `
+		ORDER BY pinned DESC, name ASC
+		LIMIT ?;`
+
+		stmt := conn.Prep(sql)
+		defer stmt.Reset()
+
+		stmt.BindText(1, "%"+q+"%")
+		stmt.BindInt64(2, int64(limit))
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing tags", "err", err)
+			} else if !exists {
+				break
+			}
+			out <- columnTag(stmt)
+		}
+		close(out)
+	}()
+	return out
 }
 
-func (source *Database) AddTag(name string) (<-chan struct{}, error) {
-	d := make(chan any)
-	done := make(chan struct{})
-	source.pending <- &InfoWrite{
-		Path: name,
-		Type: AddTag,
-		Done: d,
-	}
+func (source *Database) ListNonexistent(dir string, paths map[string]struct{}) <-chan IdPath {
+	source.WaitForCommit()
+	out := make(chan IdPath, 1000)
 	go func() {
-		<-d
-		source.WaitForCommit()
-		close(done)
+		for ip := range source.ListIdPaths([]string{dir}, 0) {
+			_, exists := paths[ip.Path]
+			if !exists {
+				out <- ip
+			}
+		}
+		close(out)
 	}()
-	return done, nil
+	return out
 }
 
-func (source *Database) AddTagIds(id tag.Id, ids Ids) (int, error) {
-	if ids.Len() == 0 {
-		return source.GetTagRevision(id)
-	}
-	done := make(chan any)
-	source.pending <- &InfoWrite{
-		Id:   int64(id),
-		Ids:  ids,
-		Type: AddTagIds,
-		Done: done,
-	}
-	rev := (<-done).(int)
-	if rev == 0 {
-		return source.GetTagRevision(id)
-	} else {
-		source.WaitForCommit()
-		return rev, nil
-	}
-}
+func (source *Database) List(dirs []string, options ListOptions) <-chan InfoListResult {
+	out := make(chan InfoListResult, 1000)
+	go func() {
+		defer metrics.Elapsed("list infos sqlite")()
+		defer metrics.ObserveQuery("list")()
 
-func (source *Database) RemoveTagIds(id tag.Id, ids Ids) (int, error) {
-	if ids.Len() == 0 {
-		return source.GetTagRevision(id)
-	}
-	done := make(chan any)
-	source.pending <- &InfoWrite{
-		Id:   int64(id),
-		Ids:  ids,
-		Type: RemoveTagIds,
-		Done: done,
-	}
-	rev := (<-done).(int)
-	if rev == 0 {
-		return source.GetTagRevision(id)
-	} else {
-		source.WaitForCommit()
-		return rev, nil
-	}
-}
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
 
-func (source *Database) InvertTagIds(id tag.Id, ids Ids) (int, error) {
-	if ids.Len() == 0 {
-		return source.GetTagRevision(id)
-	}
-	done := make(chan any)
-	source.pending <- &InfoWrite{
-		Id:   int64(id),
-		Ids:  ids,
-		Type: InvertTagIds,
-		Done: done,
-	}
-	rev := (<-done).(int)
-	if rev == 0 {
-		return source.GetTagRevision(id)
-	} else {
-		source.WaitForCommit()
-		return rev, nil
-	}
-}
+		sql := ""
 
-func (source *Database) GetTagImageIds(id tag.Id) Ids {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
-	return source.getTagImageIdsWithConn(conn, id)
-}
+		tags := options.Query.QualifierValues("tag")
 
-func (source *Database) getTagImageIdsWithConn(conn *sqlite.Conn, id tag.Id) Ids {
-	stmt := conn.Prep(`
-	SELECT infos_tag.file_id, infos_tag.len
-	FROM infos_tag
-	JOIN tag ON infos_tag.tag_id = tag.id
-	WHERE tag.id = ?;`)
-	defer stmt.Reset()
+		var durations []DurationFilter
+		for _, value := range options.Query.QualifierValues("duration") {
+			f, err := ParseDurationFilter(value)
+			if err != nil {
+				dbLog.Warn("ignoring invalid duration filter", "err", err)
+				continue
+			}
+			durations = append(durations, f)
+		}
 
-	stmt.BindInt64(1, int64(id))
+		captions := options.Query.QualifierValues("caption")
 
-	ids := NewIds()
-	for {
-		if exists, err := stmt.Step(); err != nil {
-			log.Printf("Error listing files: %s\n", err.Error())
-		} else if !exists {
-			break
+		var trips []int64
+		for _, value := range options.Query.QualifierValues("trip") {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				dbLog.Warn("ignoring invalid trip", "value", value)
+				continue
+			}
+			trips = append(trips, id)
+		}
+
+		if len(tags) > 0 {
+			sql += `
+			WITH
+			`
+			for i := range tags {
+				if i > 0 {
+					sql += ","
+				}
+				sql += `
+				tag` + strconv.Itoa(i) + ` AS (
+					SELECT file_id, len
+					FROM infos_tag
+					WHERE tag_id IN (
+						SELECT id
+						FROM tag
+						WHERE name = ?
+					)
+				)
+				`
+			}
+		}
+
+		sql += `
+			SELECT infos.id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+		`
+
+		if options.ignored != nil {
+			sql += `,
+				(SELECT str FROM prefix WHERE prefix.id = path_prefix_id) || filename
+			`
+		}
+
+		sql += `
+			FROM infos
+		`
+
+		if len(tags) > 0 {
+			for i := range tags {
+				sql += fmt.Sprintf(`
+					JOIN tag%[1]d ON id BETWEEN tag%[1]d.file_id AND tag%[1]d.file_id+tag%[1]d.len
+				`, i)
+			}
+		}
+
+		sql += `
+			WHERE path_prefix_id IN (
+				SELECT id
+				FROM prefix
+				WHERE `
+
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
 		}
-		min := stmt.ColumnInt(0)
-		len := stmt.ColumnInt(1)
-		ids.Add(IdFromTo(min, min+len))
-	}
-	return ids
-}
 
-func (source *Database) ListTagRanges(id tag.Id) <-chan IdRange {
-	out := make(chan IdRange, 100)
-	go func() {
-		conn := source.pool.Get(nil)
-		defer source.pool.Put(conn)
+		sql += `
+			)
+		`
 
-		stmt := conn.Prep(`
-		SELECT infos_tag.file_id, infos_tag.len
-		FROM infos_tag
-		JOIN tag ON infos_tag.tag_id = tag.id
-		WHERE tag.id = ?;`)
-		defer stmt.Reset()
+		// Files that failed to decode would only render as broken tiles
+		sql += `
+			AND infos.id NOT IN (
+				SELECT file_id
+				FROM quarantine
+			)
+		`
 
-		stmt.BindInt64(1, int64(id))
+		hidden := options.hiddenTags()
+		sql += hiddenTagsSql(len(hidden))
 
-		for {
-			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
-			} else if !exists {
-				break
-			}
-			min := stmt.ColumnInt(0)
-			len := stmt.ColumnInt(1)
-			out <- IdFromTo(min, min+len)
+		for _, f := range durations {
+			sql += `
+				AND infos.id IN (
+					SELECT file_id
+					FROM video
+					WHERE duration_ms ` + f.Op + ` ?
+				)
+			`
 		}
-		close(out)
-	}()
-	return out
-}
 
-func (source *Database) ListImageTagRanges(id ImageId) <-chan TagIdRange {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
-	return source.listImageTagRangesWithConn(conn, id)
-}
+		for range captions {
+			sql += `
+				AND infos.id IN (
+					SELECT rowid
+					FROM caption_fts
+					WHERE caption_fts MATCH ?
+				)
+			`
+		}
 
-func (source *Database) listImageTagRangesWithConn(conn *sqlite.Conn, id ImageId) <-chan TagIdRange {
-	out := make(chan TagIdRange, 100)
-	go func() {
-		stmt := conn.Prep(`
-		SELECT tag_id, file_id, len
-		FROM infos_tag
-		WHERE :file_id >= file_id AND :file_id <= file_id + len;`)
-		defer stmt.Reset()
+		for range trips {
+			sql += `
+				AND infos.id IN (
+					SELECT file_id
+					FROM trip_file
+					WHERE trip_id == ?
+				)
+			`
+		}
 
-		stmt.BindInt64(1, int64(id))
+		switch options.OrderBy {
+		case None:
+		case DateAsc:
+			sql += `
+			ORDER BY created_at_unix ASC
+			`
+		case DateDesc:
+			sql += `
+			ORDER BY created_at_unix DESC
+			`
+		default:
+			panic("Unsupported listing order")
+		}
 
-		for {
-			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
-			} else if !exists {
-				break
-			}
-			tagId := tag.Id(stmt.ColumnInt(0))
-			min := stmt.ColumnInt(1)
-			len := stmt.ColumnInt(2)
-			out <- TagIdRange{
-				Id:      tagId,
-				IdRange: IdFromTo(min, min+len),
-			}
+		// Ignored files are filtered out after the query, so the limit
+		// needs to be applied afterwards as well
+		sqlLimit := options.Limit > 0 && options.ignored == nil
+		if sqlLimit {
+			sql += `
+				LIMIT ?
+			`
 		}
-		close(out)
-	}()
-	return out
-}
 
-func (source *Database) GetTagByName(name string) (tag.Tag, bool) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+		sql += ";"
 
-	stmt := conn.Prep(`
-	SELECT id, revision
-	FROM tag
-	WHERE name = ?;`)
-	defer stmt.Reset()
+		stmt := conn.Prep(sql)
+		defer stmt.Reset()
 
-	stmt.BindText(1, name)
+		bindIndex := 1
 
-	exists, _ := stmt.Step()
-	if !exists {
-		return tag.Tag{}, false
-	}
+		for _, tag := range tags {
+			stmt.BindText(bindIndex, tag)
+			bindIndex++
+		}
 
-	return tag.Tag{
-		Id:       tag.Id(stmt.ColumnInt(0)),
-		Name:     name,
-		Revision: stmt.ColumnInt(1),
-	}, true
-}
+		for _, dir := range dirs {
+			stmt.BindText(bindIndex, dir+"%")
+			bindIndex++
+		}
 
-func (source *Database) GetTagId(name string) (tag.Id, bool) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+		for _, tag := range hidden {
+			stmt.BindText(bindIndex, tag)
+			bindIndex++
+		}
 
-	stmt := conn.Prep(`
-	SELECT id
-	FROM tag
-	WHERE name = ?;`)
-	defer stmt.Reset()
+		for _, f := range durations {
+			stmt.BindInt64(bindIndex, f.Value.Milliseconds())
+			bindIndex++
+		}
 
-	stmt.BindText(1, name)
+		for _, c := range captions {
+			stmt.BindText(bindIndex, captionMatch(c))
+			bindIndex++
+		}
 
-	exists, _ := stmt.Step()
-	if !exists {
-		return 0, false
-	}
+		for _, id := range trips {
+			stmt.BindInt64(bindIndex, id)
+			bindIndex++
+		}
 
-	return tag.Id(stmt.ColumnInt(0)), true
-}
+		if sqlLimit {
+			stmt.BindInt64(bindIndex, (int64)(options.Limit))
+		}
 
-func (source *Database) GetTagName(id tag.Id) (string, bool) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+		count := 0
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				dbLog.Error("error listing files", "err", err)
+			} else if !exists {
+				break
+			}
 
-	stmt := conn.Prep(`
-	SELECT name
-	FROM tag
-	WHERE id = ?;`)
-	defer stmt.Reset()
+			if options.ignored != nil {
+				if options.ignored(stmt.ColumnText(9)) {
+					continue
+				}
+				if options.Limit > 0 && count >= options.Limit {
+					break
+				}
+			}
+			count++
 
-	stmt.BindInt64(1, int64(id))
+			var info InfoListResult
+			info.Id = (ImageId)(stmt.ColumnInt64(0))
 
-	exists, _ := stmt.Step()
-	if !exists {
-		return "", false
-	}
+			info.Width = stmt.ColumnInt(1)
+			info.Height = stmt.ColumnInt(2)
+			info.SizeNull = stmt.ColumnType(1) == sqlite.TypeNull || stmt.ColumnType(2) == sqlite.TypeNull
 
-	return stmt.ColumnText(0), true
-}
+			info.Orientation = Orientation(stmt.ColumnInt(3))
+			info.OrientationNull = stmt.ColumnType(3) == sqlite.TypeNull
 
-func (source *Database) GetTagRevision(id tag.Id) (int, error) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
+			info.Color = (uint32)(stmt.ColumnInt64(4))
+			info.ColorNull = stmt.ColumnType(4) == sqlite.TypeNull
 
-	stmt := conn.Prep(`
-	SELECT revision
-	FROM tag
-	WHERE id = ?;`)
-	defer stmt.Reset()
+			unix := stmt.ColumnInt64(5)
+			timezoneOffset := stmt.ColumnInt(6)
 
-	stmt.BindInt64(1, int64(id))
+			info.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
+			info.DateTimeNull = stmt.ColumnType(5) == sqlite.TypeNull
 
-	exists, _ := stmt.Step()
-	if !exists {
-		return 0, errors.New("tag not found")
-	}
+			info.LatLngNull = stmt.ColumnType(7) == sqlite.TypeNull || stmt.ColumnType(8) == sqlite.TypeNull
+			if info.LatLngNull {
+				info.LatLng = NaNLatLng()
+			} else {
+				info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(7), stmt.ColumnFloat(8))
+			}
 
-	return stmt.ColumnInt(0), nil
-}
+			out <- info
+		}
 
-const defaultTagConditions string = `
-	AND name NOT LIKE 'sys:%'
-`
+		close(out)
+	}()
+	return out
+}
 
-func (source *Database) ListImageTags(id ImageId) <-chan tag.Tag {
-	out := make(chan tag.Tag, 100)
+func (source *Database) ListPaths(dirs []string, limit int) <-chan string {
+	out := make(chan string, 10000)
 	go func() {
+		defer metrics.Elapsed("list paths sqlite")()
+
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
 		sql := `
-		SELECT id, name, revision
-		FROM infos_tag
-		JOIN tag ON infos_tag.tag_id = tag.id
-		WHERE :file_id >= file_id AND :file_id <= file_id + len
+			SELECT str || filename as path
+			FROM infos
+			JOIN prefix ON path_prefix_id == prefix.id
+			WHERE path_prefix_id IN (
+				SELECT id
+				FROM prefix
+				WHERE
 		`
 
-		sql += defaultTagConditions
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
 
 		sql += `
-		ORDER BY length(name) ASC, name ASC;`
+			)
+		`
+
+		if limit > 0 {
+			sql += `LIMIT ? `
+		}
+
+		sql += ";"
 
 		stmt := conn.Prep(sql)
+		bindIndex := 1
 		defer stmt.Reset()
 
-		stmt.BindInt64(1, int64(id))
+		for _, dir := range dirs {
+			stmt.BindText(bindIndex, dir+"%")
+			bindIndex++
+		}
+
+		if limit > 0 {
+			stmt.BindInt64(bindIndex, (int64)(limit))
+		}
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing tags: %s\n", err.Error())
+				dbLog.Error("error listing files", "err", err)
 			} else if !exists {
 				break
 			}
-			out <- tag.Tag{
-				Id:       tag.Id(stmt.ColumnInt(0)),
-				Name:     stmt.ColumnText(1),
-				Revision: stmt.ColumnInt(2),
-			}
+			out <- stmt.ColumnText(0)
 		}
+
 		close(out)
 	}()
 	return out
 }
-
-func (source *Database) ListTags(q string, limit int) <-chan tag.Tag {
-	out := make(chan tag.Tag, 100)
+
+func (source *Database) ListIdPaths(dirs []string, limit int) <-chan IdPath {
+	out := make(chan IdPath, 10000)
 	go func() {
+		defer metrics.Elapsed("list id paths sqlite")()
+
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
 		sql := `
-		SELECT id, name, revision
-		FROM tag
-		WHERE name LIKE ?
+			SELECT infos.id, str || filename as path, hash, sha256, hash_modified_at_unix
+			FROM infos
+			JOIN prefix ON path_prefix_id == prefix.id
+			WHERE path_prefix_id IN (
+				SELECT id
+				FROM prefix
+				WHERE
 		`
 
-		sql += defaultTagConditions
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
 
 		sql += `
-		ORDER BY name ASC
-		LIMIT ?;`
+			)
+		`
+
+		if limit > 0 {
+			sql += `LIMIT ? `
+		}
+
+		sql += ";"
 
 		stmt := conn.Prep(sql)
+		bindIndex := 1
 		defer stmt.Reset()
 
-		stmt.BindText(1, "%"+q+"%")
-		stmt.BindInt64(2, int64(limit))
+		for _, dir := range dirs {
+			stmt.BindText(bindIndex, dir+"%")
+			bindIndex++
+		}
+
+		if limit > 0 {
+			stmt.BindInt64(bindIndex, (int64)(limit))
+		}
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing tags: %s\n", err.Error())
+				dbLog.Error("error listing files", "err", err)
 			} else if !exists {
 				break
 			}
-			out <- tag.Tag{
-				Id:       tag.Id(stmt.ColumnInt(0)),
-				Name:     stmt.ColumnText(1),
-				Revision: stmt.ColumnInt(2),
+			ip := IdPath{
+				Id:   ImageId(stmt.ColumnInt64(0)),
+				Path: stmt.ColumnText(1),
+				Hash: ContentHash{
+					Fast:   stmt.ColumnText(2),
+					Sha256: stmt.ColumnText(3),
+				},
 			}
+			if stmt.ColumnType(4) != sqlite.TypeNull {
+				ip.Hash.Modified = time.Unix(stmt.ColumnInt64(4), 0)
+			}
+			out <- ip
 		}
+
 		close(out)
 	}()
 	return out
 }
 
-func (source *Database) WaitForCommit() {
-	source.transactionMutex.RLock()
-	defer source.transactionMutex.RUnlock()
-}
+// ListDirFiles lists the indexed files directly in the dir, excluding
+// subdirs, with their stored metadata, hashes and cameras
+func (source *Database) ListDirFiles(dir string) []DirFile {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-func (source *Database) ListNonexistent(dir string, paths map[string]struct{}) <-chan IdPath {
-	source.WaitForCommit()
-	out := make(chan IdPath, 1000)
-	go func() {
-		for ip := range source.ListIdPaths([]string{dir}, 0) {
-			_, exists := paths[ip.Path]
-			if !exists {
-				out <- ip
-			}
-		}
-		close(out)
-	}()
-	return out
-}
+	stmt := conn.Prep(`
+		SELECT
+			infos.id, filename, hash, sha256,
+			width, height, orientation, created_at, latitude, longitude,
+			make, model, serial, clock_offset, caption.embedded
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		LEFT JOIN camera ON camera_id == camera.id
+		LEFT JOIN caption ON caption.file_id == infos.id
+		WHERE prefix.str == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindText(1, dir)
 
-func (source *Database) SetIndexed(dir string) {
-	source.Write(dir, Info{
-		DateTime: time.Now(),
-	}, Index)
+	var files []DirFile
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing dir files", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		f := DirFile{
+			Id:   ImageId(stmt.ColumnInt64(0)),
+			Name: stmt.ColumnText(1),
+			Hash: ContentHash{
+				Fast:   stmt.ColumnText(2),
+				Sha256: stmt.ColumnText(3),
+			},
+			Camera: Camera{
+				Make:   stmt.ColumnText(10),
+				Model:  stmt.ColumnText(11),
+				Serial: stmt.ColumnText(12),
+				// Included in the stored dates
+				ClockOffset: time.Duration(stmt.ColumnInt64(13)) * time.Second,
+			},
+		}
+		f.Width = stmt.ColumnInt(4)
+		f.Height = stmt.ColumnInt(5)
+		f.SizeNull = stmt.ColumnType(4) == sqlite.TypeNull || stmt.ColumnType(5) == sqlite.TypeNull
+		f.Orientation = Orientation(stmt.ColumnInt(6))
+		f.OrientationNull = stmt.ColumnType(6) == sqlite.TypeNull
+		f.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(7))
+		f.DateTimeNull = stmt.ColumnType(7) == sqlite.TypeNull
+		f.LatLngNull = stmt.ColumnType(8) == sqlite.TypeNull || stmt.ColumnType(9) == sqlite.TypeNull
+		if f.LatLngNull {
+			f.LatLng = NaNLatLng()
+		} else {
+			f.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(8), stmt.ColumnFloat(9))
+		}
+		// The embedded caption, as edits are stored separately
+		f.Description = stmt.ColumnText(14)
+		files = append(files, f)
+	}
+	return files
 }
 
-func (source *Database) List(dirs []string, options ListOptions) <-chan InfoListResult {
-	out := make(chan InfoListResult, 1000)
+func (source *Database) ListIds(dirs []string, limit int, missingEmbedding bool) <-chan ImageId {
+	out := make(chan ImageId, 10000)
 	go func() {
-		defer metrics.Elapsed("list infos sqlite")()
+		defer metrics.Elapsed("list ids sqlite")()
 
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
-		sql := ""
+		sql := `
+			SELECT id
+			FROM infos
+		`
 
-		tags := options.Query.QualifierValues("tag")
-		if len(tags) > 0 {
-			sql += `
-			WITH
-			`
-			for i := range tags {
-				if i > 0 {
-					sql += ","
-				}
-				sql += `
-				tag` + strconv.Itoa(i) + ` AS (
-					SELECT file_id, len
-					FROM infos_tag
-					WHERE tag_id IN (
-						SELECT id
-						FROM tag
-						WHERE name = ?
-					)
-				)
-				`
-			}
+		if missingEmbedding {
+			sql += `LEFT JOIN clip_emb ON clip_emb.file_id = id`
 		}
 
 		sql += `
-			SELECT infos.id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
-			FROM infos
+			WHERE
 		`
 
-		if len(tags) > 0 {
-			for i := range tags {
-				sql += fmt.Sprintf(`
-					JOIN tag%[1]d ON id BETWEEN tag%[1]d.file_id AND tag%[1]d.file_id+tag%[1]d.len
-				`, i)
-			}
+		if missingEmbedding {
+			sql += `file_id is NULL AND`
 		}
 
 		sql += `
-			WHERE path_prefix_id IN (
+			path_prefix_id IN (
 				SELECT id
 				FROM prefix
-				WHERE `
+				WHERE
+		`
 
 		for i := range dirs {
 			sql += `str LIKE ? `
@@ -1329,81 +4813,32 @@ func (source *Database) List(dirs []string, options ListOptions) <-chan InfoList
 			)
 		`
 
-		switch options.OrderBy {
-		case None:
-		case DateAsc:
-			sql += `
-			ORDER BY created_at_unix ASC
-			`
-		case DateDesc:
-			sql += `
-			ORDER BY created_at_unix DESC
-			`
-		default:
-			panic("Unsupported listing order")
-		}
-
-		if options.Limit > 0 {
-			sql += `
-				LIMIT ?
-			`
+		if limit > 0 {
+			sql += `LIMIT ? `
 		}
 
 		sql += ";"
 
 		stmt := conn.Prep(sql)
-		defer stmt.Reset()
-
 		bindIndex := 1
-
-		for _, tag := range tags {
-			stmt.BindText(bindIndex, tag)
-			bindIndex++
-		}
+		defer stmt.Reset()
 
 		for _, dir := range dirs {
 			stmt.BindText(bindIndex, dir+"%")
 			bindIndex++
 		}
 
-		if options.Limit > 0 {
-			stmt.BindInt64(bindIndex, (int64)(options.Limit))
+		if limit > 0 {
+			stmt.BindInt64(bindIndex, (int64)(limit))
 		}
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
+				dbLog.Error("error listing files", "err", err)
 			} else if !exists {
 				break
 			}
-
-			var info InfoListResult
-			info.Id = (ImageId)(stmt.ColumnInt64(0))
-
-			info.Width = stmt.ColumnInt(1)
-			info.Height = stmt.ColumnInt(2)
-			info.SizeNull = stmt.ColumnType(1) == sqlite.TypeNull || stmt.ColumnType(2) == sqlite.TypeNull
-
-			info.Orientation = Orientation(stmt.ColumnInt(3))
-			info.OrientationNull = stmt.ColumnType(3) == sqlite.TypeNull
-
-			info.Color = (uint32)(stmt.ColumnInt64(4))
-			info.ColorNull = stmt.ColumnType(4) == sqlite.TypeNull
-
-			unix := stmt.ColumnInt64(5)
-			timezoneOffset := stmt.ColumnInt(6)
-
-			info.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
-			info.DateTimeNull = stmt.ColumnType(5) == sqlite.TypeNull
-
-			info.LatLngNull = stmt.ColumnType(7) == sqlite.TypeNull || stmt.ColumnType(8) == sqlite.TypeNull
-			if info.LatLngNull {
-				info.LatLng = NaNLatLng()
-			} else {
-				info.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(7), stmt.ColumnFloat(8))
-			}
-
-			out <- info
+			out <- (ImageId)(stmt.ColumnInt64(0))
 		}
 
 		close(out)
@@ -1411,49 +4846,73 @@ func (source *Database) List(dirs []string, options ListOptions) <-chan InfoList
 	return out
 }
 
-func (source *Database) GetImageEmbedding(id ImageId) (clip.Embedding, error) {
-	conn := source.pool.Get(nil)
-	defer source.pool.Put(conn)
-
-	stmt := conn.Prep(`
-		SELECT inv_norm, embedding
-		FROM clip_emb
-		WHERE file_id = ?;`)
-	defer stmt.Reset()
-
-	stmt.BindInt64(1, int64(id))
+func (source *Database) ListMissing(dirs []string, limit int, opts Missing) <-chan MissingInfo {
+	out := make(chan MissingInfo, 1000)
+	go func() {
+		defer metrics.Elapsed("list missing sqlite")()
 
-	if exists, err := stmt.Step(); err != nil {
-		return nil, err
-	} else if !exists {
-		return nil, nil
-	}
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
 
-	invnorm := uint16(clip.InvNormMean + stmt.ColumnInt64(0))
+		sql := `
+			SELECT infos.id, str || filename as path`
 
-	size := stmt.ColumnLen(1)
-	bytes := make([]byte, size)
-	read := stmt.ColumnBytes(1, bytes)
-	if read != size {
-		return nil, fmt.Errorf("error reading embedding: buffer underrun, expected %d actual %d bytes", size, read)
-	}
+		type condition struct {
+			inputs []string
+			output string
+		}
 
-	return clip.FromRaw(bytes, invnorm), nil
-}
+		conds := make([]condition, 0)
+		if opts.Metadata {
+			conds = append(conds, condition{
+				inputs: []string{
+					"width",
+					"height",
+					"orientation",
+					"created_at_unix",
+				},
+				output: "missing_metadata",
+			})
+		}
+		if opts.Color {
+			conds = append(conds, condition{
+				inputs: []string{"color"},
+				output: "missing_color",
+			})
+		}
+		if opts.Embedding {
+			conds = append(conds, condition{
+				inputs: []string{"file_id"},
+				output: "missing_embedding",
+			})
+		}
 
-func (source *Database) ListEmbeddings(dirs []string, options ListOptions) <-chan EmbeddingsResult {
-	out := make(chan EmbeddingsResult, 100)
-	go func() {
-		defer metrics.Elapsed("list embeddings sqlite")()
+		for _, c := range conds {
+			sql += `,
+			`
+			for i, input := range c.inputs {
+				sql += fmt.Sprintf("%s IS NULL ", input)
+				if i < len(c.inputs)-1 {
+					sql += "OR "
+				}
+			}
+			sql += fmt.Sprintf("AS %s", c.output)
+		}
 
-		conn := source.pool.Get(nil)
-		defer source.pool.Put(conn)
+		sql += `
+			FROM infos
+			INNER JOIN prefix ON prefix.id = path_prefix_id
+		`
 
-		sql := `
-			SELECT id, inv_norm, embedding
-			FROM infos
-			INNER JOIN clip_emb ON clip_emb.file_id = id
-			WHERE path_prefix_id IN (
+		if opts.Embedding {
+			sql += `
+				LEFT JOIN clip_emb ON clip_emb.file_id = infos.id
+			`
+		}
+
+		sql += `
+			WHERE
+			path_prefix_id IN (
 				SELECT id
 				FROM prefix
 				WHERE
@@ -1468,49 +4927,81 @@ func (source *Database) ListEmbeddings(dirs []string, options ListOptions) <-cha
 
 		sql += `
 			)
+			AND infos.id NOT IN (
+				SELECT file_id
+				FROM quarantine
+			)
 		`
 
-		if options.Limit > 0 {
+		if len(conds) > 0 {
+			sql += `
+				AND (
+			`
+
+			for i, c := range conds {
+				sql += fmt.Sprintf("%s ", c.output)
+				if i < len(conds)-1 {
+					sql += `OR 
+					`
+				}
+			}
+			// for i, c := range conds {
+			// 	for j, input := range c.inputs {
+			// 		sql += fmt.Sprintf("%s IS NULL ", input)
+			// 		if j < len(c.inputs)-1 {
+			// 			sql += "OR "
+			// 		}
+			// 	}
+			// 	if i < len(conds)-1 {
+			// 		sql += "OR "
+			// 	}
+			// 	sql += `
+			// 	`
+			// }
+			sql += `
+				)
+			`
+		}
+
+		if limit > 0 {
 			sql += `LIMIT ? `
 		}
 
 		sql += ";"
 
 		stmt := conn.Prep(sql)
+		bindIndex := 1
 		defer stmt.Reset()
 
-		bindIndex := 1
 		for _, dir := range dirs {
 			stmt.BindText(bindIndex, dir+"%")
 			bindIndex++
 		}
 
-		if options.Limit > 0 {
-			stmt.BindInt64(bindIndex, (int64)(options.Limit))
+		if limit > 0 {
+			stmt.BindInt64(bindIndex, (int64)(limit))
 		}
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing embeddings: %s\n", err.Error())
+				dbLog.Error("error listing files", "err", err)
 			} else if !exists {
 				break
 			}
-
-			id := (ImageId)(stmt.ColumnInt64(0))
-			invnorm := uint16(clip.InvNormMean + stmt.ColumnInt64(1))
-
-			size := stmt.ColumnLen(2)
-			bytes := make([]byte, size)
-			read := stmt.ColumnBytes(2, bytes)
-			if read != size {
-				log.Printf("Error reading embedding: buffer underrun, expected %d actual %d bytes\n", size, read)
-				continue
+			r := MissingInfo{
+				Id:   (ImageId)(stmt.ColumnInt64(0)),
+				Path: stmt.ColumnText(1),
 			}
-
-			out <- EmbeddingsResult{
-				Id:        id,
-				Embedding: clip.FromRaw(bytes, invnorm),
+			i := 2
+			if opts.Color {
+				r.Color = stmt.ColumnBool(i)
+				i++
+			}
+			if opts.Embedding {
+				r.Embedding = stmt.ColumnBool(i)
+				i++
 			}
+			out <- r
 		}
 
 		close(out)
@@ -1518,33 +5009,43 @@ func (source *Database) ListEmbeddings(dirs []string, options ListOptions) <-cha
 	return out
 }
 
-func (source *Database) ListPaths(dirs []string, limit int) <-chan string {
-	out := make(chan string, 10000)
+func (source *Database) ListChanges(dirs []string, cursor int64, limit int) <-chan Change {
+	out := make(chan Change, 1000)
 	go func() {
-		defer metrics.Elapsed("list paths sqlite")()
+		defer metrics.Elapsed("list changes sqlite")()
 
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
 		sql := `
-			SELECT str || filename as path
-			FROM infos
-			JOIN prefix ON path_prefix_id == prefix.id
-			WHERE path_prefix_id IN (
-				SELECT id
-				FROM prefix
-				WHERE
+			SELECT changes.id, op, file_id, path, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+			FROM changes
+			LEFT JOIN infos ON infos.id == file_id AND op != 'REMOVED'
+			WHERE changes.id IN (
+				SELECT MAX(id)
+				FROM changes
+				WHERE id > ?
+				GROUP BY file_id
+			)
 		`
 
-		for i := range dirs {
-			sql += `str LIKE ? `
-			if i < len(dirs)-1 {
-				sql += "OR "
+		if len(dirs) > 0 {
+			sql += `
+			AND (
+			`
+			for i := range dirs {
+				sql += `path LIKE ? `
+				if i < len(dirs)-1 {
+					sql += "OR "
+				}
 			}
+			sql += `
+			)
+			`
 		}
 
 		sql += `
-			)
+			ORDER BY changes.id ASC
 		`
 
 		if limit > 0 {
@@ -1557,6 +5058,9 @@ func (source *Database) ListPaths(dirs []string, limit int) <-chan string {
 		bindIndex := 1
 		defer stmt.Reset()
 
+		stmt.BindInt64(bindIndex, cursor)
+		bindIndex++
+
 		for _, dir := range dirs {
 			stmt.BindText(bindIndex, dir+"%")
 			bindIndex++
@@ -1568,11 +5072,37 @@ func (source *Database) ListPaths(dirs []string, limit int) <-chan string {
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
+				dbLog.Error("error listing changes", "err", err)
 			} else if !exists {
 				break
 			}
-			out <- stmt.ColumnText(0)
+
+			var c Change
+			c.Cursor = stmt.ColumnInt64(0)
+			c.Op = ChangeOp(stmt.ColumnText(1))
+			c.Id = (ImageId)(stmt.ColumnInt64(2))
+			c.Path = stmt.ColumnText(3)
+
+			if c.Op != ChangeRemoved {
+				c.Width = stmt.ColumnInt(4)
+				c.Height = stmt.ColumnInt(5)
+				c.Orientation = Orientation(stmt.ColumnInt(6))
+				c.Color = (uint32)(stmt.ColumnInt64(7))
+
+				if stmt.ColumnType(8) != sqlite.TypeNull {
+					unix := stmt.ColumnInt64(8)
+					timezoneOffset := stmt.ColumnInt(9)
+					c.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
+				}
+
+				if stmt.ColumnType(10) == sqlite.TypeNull || stmt.ColumnType(11) == sqlite.TypeNull {
+					c.LatLng = NaNLatLng()
+				} else {
+					c.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(10), stmt.ColumnFloat(11))
+				}
+			}
+
+			out <- c
 		}
 
 		close(out)
@@ -1580,36 +5110,92 @@ func (source *Database) ListPaths(dirs []string, limit int) <-chan string {
 	return out
 }
 
-func (source *Database) ListIdPaths(dirs []string, limit int) <-chan IdPath {
-	out := make(chan IdPath, 10000)
+// LatestChange returns the cursor of the latest change of the files in the
+// dirs, 0 if there are none
+func (source *Database) LatestChange(dirs []string) int64 {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := `
+		SELECT MAX(id)
+		FROM changes
+	`
+
+	if len(dirs) > 0 {
+		sql += `
+		WHERE
+		`
+		for i := range dirs {
+			sql += `path LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
+	}
+
+	sql += ";"
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+
+	for i, dir := range dirs {
+		stmt.BindText(i+1, dir+"%")
+	}
+
+	if exists, err := stmt.Step(); err != nil {
+		dbLog.Error("error getting latest change", "err", err)
+		return 0
+	} else if !exists {
+		return 0
+	}
+	return stmt.ColumnInt64(0)
+}
+
+// ListRecentlyAdded lists the files in the dirs, most recently indexed
+// first. Files indexed before the index time was recorded are not listed.
+// Only the Limit and Ignore options are supported.
+func (source *Database) ListRecentlyAdded(dirs []string, options ListOptions) <-chan AddedInfo {
+	out := make(chan AddedInfo, 100)
 	go func() {
-		defer metrics.Elapsed("list id paths sqlite")()
+		defer metrics.Elapsed("list recently added sqlite")()
+		defer metrics.ObserveQuery("list_recently_added")()
 
 		conn := source.pool.Get(nil)
 		defer source.pool.Put(conn)
 
 		sql := `
-			SELECT infos.id, str || filename as path
+			SELECT infos.id, str || filename, indexed_at_unix, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
 			FROM infos
 			JOIN prefix ON path_prefix_id == prefix.id
-			WHERE path_prefix_id IN (
-				SELECT id
-				FROM prefix
-				WHERE
+			WHERE indexed_at_unix IS NOT NULL
 		`
 
-		for i := range dirs {
-			sql += `str LIKE ? `
-			if i < len(dirs)-1 {
-				sql += "OR "
+		if len(dirs) > 0 {
+			sql += `
+			AND (
+			`
+			for i := range dirs {
+				sql += `str LIKE ? `
+				if i < len(dirs)-1 {
+					sql += "OR "
+				}
 			}
+			sql += `
+			)
+			`
 		}
 
+		hidden := options.hiddenTags()
+		sql += hiddenTagsSql(len(hidden))
+
 		sql += `
-			)
+			ORDER BY indexed_at_unix DESC, infos.id DESC
 		`
 
-		if limit > 0 {
+		// Ignored files are filtered out after the query, so the limit
+		// needs to be applied afterwards as well
+		sqlLimit := options.Limit > 0 && options.ignored == nil
+		if sqlLimit {
 			sql += `LIMIT ? `
 		}
 
@@ -1624,21 +5210,56 @@ func (source *Database) ListIdPaths(dirs []string, limit int) <-chan IdPath {
 			bindIndex++
 		}
 
-		if limit > 0 {
-			stmt.BindInt64(bindIndex, (int64)(limit))
+		for _, tag := range hidden {
+			stmt.BindText(bindIndex, tag)
+			bindIndex++
 		}
 
+		if sqlLimit {
+			stmt.BindInt64(bindIndex, (int64)(options.Limit))
+		}
+
+		count := 0
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
+				dbLog.Error("error listing recently added", "err", err)
+				break
 			} else if !exists {
 				break
 			}
-			ip := IdPath{
-				Id:   ImageId(stmt.ColumnInt64(0)),
-				Path: stmt.ColumnText(1),
+
+			var f AddedInfo
+			f.Id = (ImageId)(stmt.ColumnInt64(0))
+			f.Path = stmt.ColumnText(1)
+			if options.ignored != nil {
+				if options.ignored(f.Path) {
+					continue
+				}
+				if options.Limit > 0 && count >= options.Limit {
+					break
+				}
 			}
-			out <- ip
+			count++
+
+			f.AddedAt = time.Unix(stmt.ColumnInt64(2), 0)
+			f.Width = stmt.ColumnInt(3)
+			f.Height = stmt.ColumnInt(4)
+			f.Orientation = Orientation(stmt.ColumnInt(5))
+			f.Color = (uint32)(stmt.ColumnInt64(6))
+
+			if stmt.ColumnType(7) != sqlite.TypeNull {
+				unix := stmt.ColumnInt64(7)
+				timezoneOffset := stmt.ColumnInt(8)
+				f.DateTime = time.Unix(unix, 0).In(time.FixedZone("tz_offset", timezoneOffset*60))
+			}
+
+			if stmt.ColumnType(9) == sqlite.TypeNull || stmt.ColumnType(10) == sqlite.TypeNull {
+				f.LatLng = NaNLatLng()
+			} else {
+				f.LatLng = s2.LatLngFromDegrees(stmt.ColumnFloat(9), stmt.ColumnFloat(10))
+			}
+
+			out <- f
 		}
 
 		close(out)
@@ -1646,237 +5267,435 @@ func (source *Database) ListIdPaths(dirs []string, limit int) <-chan IdPath {
 	return out
 }
 
-func (source *Database) ListIds(dirs []string, limit int, missingEmbedding bool) <-chan ImageId {
-	out := make(chan ImageId, 10000)
-	go func() {
-		defer metrics.Elapsed("list ids sqlite")()
+// ListQuarantine lists the quarantined files in the dirs, or in all dirs
+// if none, the most recently quarantined first
+func (source *Database) ListQuarantine(dirs []string, limit int) []Quarantined {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-		conn := source.pool.Get(nil)
-		defer source.pool.Put(conn)
+	sql := `
+		SELECT file_id, str || filename, stage, error, quarantined_at_unix
+		FROM quarantine
+		INNER JOIN infos ON infos.id == quarantine.file_id
+		INNER JOIN prefix ON prefix.id == infos.path_prefix_id
+	`
+	if len(dirs) > 0 {
+		sql += `
+		WHERE `
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
+	}
+	sql += `
+		ORDER BY quarantined_at_unix DESC, file_id`
+	if limit > 0 {
+		sql += `
+		LIMIT ?`
+	}
+	stmt := conn.Prep(sql + ";")
+	defer stmt.Reset()
 
-		sql := `
-			SELECT id
-			FROM infos
-		`
+	bindIndex := 1
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+	if limit > 0 {
+		stmt.BindInt64(bindIndex, int64(limit))
+	}
 
-		if missingEmbedding {
-			sql += `LEFT JOIN clip_emb ON clip_emb.file_id = id`
+	files := make([]Quarantined, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing quarantine", "err", err)
+			break
+		} else if !exists {
+			break
 		}
+		files = append(files, Quarantined{
+			Id:            ImageId(stmt.ColumnInt64(0)),
+			Path:          stmt.ColumnText(1),
+			Stage:         QuarantineStage(stmt.ColumnText(2)),
+			Error:         stmt.ColumnText(3),
+			QuarantinedAt: time.Unix(stmt.ColumnInt64(4), 0),
+		})
+	}
+	return files
+}
+
+// ListUnverified lists the files in the dirs, or in all dirs if none, that
+// have a stored hash, the never verified ones first followed by the least
+// recently verified ones
+func (source *Database) ListUnverified(dirs []string, limit int) []IdPath {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
+	sql := `
+		SELECT infos.id, str || filename, hash, sha256
+		FROM infos
+		INNER JOIN prefix ON prefix.id == infos.path_prefix_id
+		LEFT JOIN verification ON verification.file_id == infos.id
+		WHERE hash IS NOT NULL
+	`
+	if len(dirs) > 0 {
 		sql += `
-			WHERE
-		`
+		AND (`
+		for i := range dirs {
+			sql += `str LIKE ? `
+			if i < len(dirs)-1 {
+				sql += "OR "
+			}
+		}
+		sql += `)`
+	}
+	sql += `
+		ORDER BY verified_at_unix IS NOT NULL, verified_at_unix, infos.id`
+	if limit > 0 {
+		sql += `
+		LIMIT ?`
+	}
+	stmt := conn.Prep(sql + ";")
+	defer stmt.Reset()
 
-		if missingEmbedding {
-			sql += `file_id is NULL AND`
+	bindIndex := 1
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+	if limit > 0 {
+		stmt.BindInt64(bindIndex, int64(limit))
+	}
+
+	var ips []IdPath
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing unverified files", "err", err)
+			break
+		} else if !exists {
+			break
 		}
+		ips = append(ips, IdPath{
+			Id:   ImageId(stmt.ColumnInt64(0)),
+			Path: stmt.ColumnText(1),
+			Hash: ContentHash{
+				Fast:   stmt.ColumnText(2),
+				Sha256: stmt.ColumnText(3),
+			},
+		})
+	}
+	return ips
+}
 
-		sql += `
-			path_prefix_id IN (
-				SELECT id
-				FROM prefix
-				WHERE
-		`
+// ListVerificationIssues lists the files in the dirs that did not match
+// their stored hash or could not be read when last verified, the most
+// recently verified first
+func (source *Database) ListVerificationIssues(dirs []string, limit int) []Verification {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
+	sql := `
+		SELECT file_id, str || filename, status, verified_at_unix, detail, modified_at_unix
+		FROM verification
+		INNER JOIN infos ON infos.id == verification.file_id
+		INNER JOIN prefix ON prefix.id == infos.path_prefix_id
+		WHERE status != ?
+	`
+	if len(dirs) > 0 {
+		sql += `
+		AND (`
 		for i := range dirs {
 			sql += `str LIKE ? `
 			if i < len(dirs)-1 {
 				sql += "OR "
 			}
 		}
-
+		sql += `)`
+	}
+	sql += `
+		ORDER BY verified_at_unix DESC, file_id`
+	if limit > 0 {
 		sql += `
-			)
-		`
+		LIMIT ?`
+	}
+	stmt := conn.Prep(sql + ";")
+	defer stmt.Reset()
 
-		if limit > 0 {
-			sql += `LIMIT ? `
+	stmt.BindText(1, string(VerificationOk))
+	bindIndex := 2
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+	if limit > 0 {
+		stmt.BindInt64(bindIndex, int64(limit))
+	}
+
+	issues := make([]Verification, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing verification issues", "err", err)
+			break
+		} else if !exists {
+			break
 		}
+		v := Verification{
+			Id:         ImageId(stmt.ColumnInt64(0)),
+			Path:       stmt.ColumnText(1),
+			Status:     VerificationStatus(stmt.ColumnText(2)),
+			VerifiedAt: time.Unix(stmt.ColumnInt64(3), 0),
+			Detail:     stmt.ColumnText(4),
+		}
+		if stmt.ColumnType(5) != sqlite.TypeNull {
+			v.ModifiedAt = time.Unix(stmt.ColumnInt64(5), 0)
+		}
+		issues = append(issues, v)
+	}
+	return issues
+}
 
-		sql += ";"
+// dirsCondition returns the condition matching the files in the dirs,
+// with one parameter per dir
+func dirsCondition(dirs []string) string {
+	sql := `
+		path_prefix_id IN (
+			SELECT id
+			FROM prefix
+			WHERE `
+	for i := range dirs {
+		sql += `str LIKE ? `
+		if i < len(dirs)-1 {
+			sql += "OR "
+		}
+	}
+	sql += `
+		)`
+	return sql
+}
 
-		stmt := conn.Prep(sql)
-		bindIndex := 1
-		defer stmt.Reset()
+// ListLibraryFiles lists what the library statistics need to know about
+// the files in the dirs
+func (source *Database) ListLibraryFiles(dirs []string) <-chan LibraryFile {
+	out := make(chan LibraryFile, 1000)
+	go func() {
+		defer metrics.Elapsed("list library files sqlite")()
+		defer close(out)
 
-		for _, dir := range dirs {
-			stmt.BindText(bindIndex, dir+"%")
-			bindIndex++
-		}
+		conn := source.pool.Get(nil)
+		defer source.pool.Put(conn)
 
-		if limit > 0 {
-			stmt.BindInt64(bindIndex, (int64)(limit))
+		stmt := conn.Prep(`
+			SELECT infos.id, filename, width, height, created_at_unix, created_at_tz_offset,
+				camera_id, color IS NOT NULL, clip_emb.file_id IS NOT NULL, video.duration_ms
+			FROM infos
+			LEFT JOIN clip_emb ON clip_emb.file_id == infos.id
+			LEFT JOIN video ON video.file_id == infos.id
+			WHERE ` + dirsCondition(dirs) + `;`)
+		defer stmt.Reset()
+
+		for i, dir := range dirs {
+			stmt.BindText(i+1, dir+"%")
 		}
 
 		for {
 			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
+				dbLog.Error("error listing library files", "err", err)
+				return
 			} else if !exists {
-				break
+				return
 			}
-			out <- (ImageId)(stmt.ColumnInt64(0))
+			f := LibraryFile{
+				Id:        ImageId(stmt.ColumnInt64(0)),
+				Filename:  stmt.ColumnText(1),
+				Width:     stmt.ColumnInt(2),
+				Height:    stmt.ColumnInt(3),
+				Camera:    CameraId(stmt.ColumnInt64(6)),
+				Metadata:  stmt.ColumnType(2) != sqlite.TypeNull && stmt.ColumnType(4) != sqlite.TypeNull,
+				Color:     stmt.ColumnBool(7),
+				Embedding: stmt.ColumnBool(8),
+				Duration:  time.Duration(stmt.ColumnInt64(9)) * time.Millisecond,
+			}
+			if stmt.ColumnType(4) != sqlite.TypeNull {
+				offset := stmt.ColumnInt(5)
+				f.DateTime = time.Unix(stmt.ColumnInt64(4), 0).In(time.FixedZone("tz_offset", offset*60))
+			}
+			out <- f
 		}
-
-		close(out)
 	}()
 	return out
 }
 
-func (source *Database) ListMissing(dirs []string, limit int, opts Missing) <-chan MissingInfo {
-	out := make(chan MissingInfo, 1000)
-	go func() {
-		defer metrics.Elapsed("list missing sqlite")()
+// ListTagCounts lists the tags of the files in the dirs with the number of
+// files with each, the most files first, excluding selections
+func (source *Database) ListTagCounts(dirs []string) []TagCount {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-		conn := source.pool.Get(nil)
-		defer source.pool.Put(conn)
+	stmt := conn.Prep(`
+		SELECT tag.name, COUNT(DISTINCT infos.id) AS count
+		FROM infos
+		JOIN infos_tag ON infos.id BETWEEN infos_tag.file_id AND infos_tag.file_id + infos_tag.len
+		JOIN tag ON tag.id == infos_tag.tag_id
+		WHERE tag.name NOT LIKE 'sys:select:%' AND ` + dirsCondition(dirs) + `
+		GROUP BY tag.id
+		ORDER BY count DESC, tag.name;`)
+	defer stmt.Reset()
 
-		sql := `
-			SELECT infos.id, str || filename as path`
+	for i, dir := range dirs {
+		stmt.BindText(i+1, dir+"%")
+	}
 
-		type condition struct {
-			inputs []string
-			output string
+	counts := make([]TagCount, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing tag counts", "err", err)
+			break
+		} else if !exists {
+			break
 		}
+		counts = append(counts, TagCount{
+			Name:  stmt.ColumnText(0),
+			Count: stmt.ColumnInt(1),
+		})
+	}
+	return counts
+}
 
-		conds := make([]condition, 0)
-		if opts.Metadata {
-			conds = append(conds, condition{
-				inputs: []string{
-					"width",
-					"height",
-					"orientation",
-					"created_at_unix",
-				},
-				output: "missing_metadata",
-			})
-		}
-		if opts.Color {
-			conds = append(conds, condition{
-				inputs: []string{"color"},
-				output: "missing_color",
-			})
-		}
-		if opts.Embedding {
-			conds = append(conds, condition{
-				inputs: []string{"file_id"},
-				output: "missing_embedding",
-			})
-		}
+// ListPanoramaFrames lists the dated files directly in the dir that are not
+// part of a panorama yet, oldest first
+func (source *Database) ListPanoramaFrames(dir string) []panoramaFrame {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-		for _, c := range conds {
-			sql += `,
-			`
-			for i, input := range c.inputs {
-				sql += fmt.Sprintf("%s IS NULL ", input)
-				if i < len(c.inputs)-1 {
-					sql += "OR "
-				}
-			}
-			sql += fmt.Sprintf("AS %s", c.output)
-		}
+	stmt := conn.Prep(`
+		SELECT
+			infos.id, str || filename as path,
+			width, height, orientation, created_at, coalesce(camera_id, 0)
+		FROM infos
+		JOIN prefix ON path_prefix_id == prefix.id
+		LEFT JOIN panorama_file ON panorama_file.file_id == infos.id
+		WHERE
+			prefix.str == ? AND
+			panorama_file.file_id IS NULL AND
+			created_at IS NOT NULL AND
+			width IS NOT NULL AND
+			height IS NOT NULL
+		ORDER BY created_at, filename;`)
+	defer stmt.Reset()
 
-		sql += `
-			FROM infos
-			INNER JOIN prefix ON prefix.id = path_prefix_id
-		`
+	stmt.BindText(1, dir)
 
-		if opts.Embedding {
-			sql += `
-				LEFT JOIN clip_emb ON clip_emb.file_id = infos.id
-			`
+	var frames []panoramaFrame
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing panorama frames", "err", err)
+			break
+		} else if !exists {
+			break
 		}
-
-		sql += `
-			WHERE
-			path_prefix_id IN (
-				SELECT id
-				FROM prefix
-				WHERE
-		`
-
-		for i := range dirs {
-			sql += `str LIKE ? `
-			if i < len(dirs)-1 {
-				sql += "OR "
-			}
+		f := panoramaFrame{
+			Id:          ImageId(stmt.ColumnInt64(0)),
+			Path:        stmt.ColumnText(1),
+			Width:       stmt.ColumnInt(2),
+			Height:      stmt.ColumnInt(3),
+			Orientation: Orientation(stmt.ColumnInt(4)),
+			CameraId:    stmt.ColumnInt64(6),
 		}
+		f.DateTime, _ = time.Parse(dateFormat, stmt.ColumnText(5))
+		frames = append(frames, f)
+	}
+	return frames
+}
 
-		sql += `
-			)
-		`
-
-		if len(conds) > 0 {
-			sql += `
-				AND (
-			`
+// ListPanoramas lists the panoramas starting with a file in the dirs,
+// newest first
+func (source *Database) ListPanoramas(dirs []string, limit int) []Panorama {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
 
-			for i, c := range conds {
-				sql += fmt.Sprintf("%s ", c.output)
-				if i < len(conds)-1 {
-					sql += `OR 
-					`
-				}
-			}
-			// for i, c := range conds {
-			// 	for j, input := range c.inputs {
-			// 		sql += fmt.Sprintf("%s IS NULL ", input)
-			// 		if j < len(c.inputs)-1 {
-			// 			sql += "OR "
-			// 		}
-			// 	}
-			// 	if i < len(conds)-1 {
-			// 		sql += "OR "
-			// 	}
-			// 	sql += `
-			// 	`
-			// }
-			sql += `
-				)
-			`
-		}
+	sql := `
+		SELECT panorama.id, coalesce(preview, ''), created_at_unix, file_id
+		FROM panorama
+		JOIN panorama_file ON panorama_file.panorama_id == panorama.id
+		WHERE rejected == 0 AND panorama.id IN (
+			SELECT panorama_id
+			FROM panorama_file
+			JOIN infos ON infos.id == panorama_file.file_id
+			JOIN prefix ON prefix.id == infos.path_prefix_id
+			WHERE position == 0 AND (
+	`
 
-		if limit > 0 {
-			sql += `LIMIT ? `
+	for i := range dirs {
+		sql += `str LIKE ? `
+		if i < len(dirs)-1 {
+			sql += "OR "
 		}
+	}
 
-		sql += ";"
+	sql += `
+			)
+		)
+		ORDER BY panorama.id DESC, position;`
 
-		stmt := conn.Prep(sql)
-		bindIndex := 1
-		defer stmt.Reset()
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
 
-		for _, dir := range dirs {
-			stmt.BindText(bindIndex, dir+"%")
-			bindIndex++
-		}
+	for i, dir := range dirs {
+		stmt.BindText(i+1, dir+"%")
+	}
 
-		if limit > 0 {
-			stmt.BindInt64(bindIndex, (int64)(limit))
+	panoramas := make([]Panorama, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing panoramas", "err", err)
+			break
+		} else if !exists {
+			break
 		}
-
-		for {
-			if exists, err := stmt.Step(); err != nil {
-				log.Printf("Error listing files: %s\n", err.Error())
-			} else if !exists {
+		id := stmt.ColumnInt64(0)
+		if len(panoramas) == 0 || panoramas[len(panoramas)-1].Id != id {
+			if limit > 0 && len(panoramas) >= limit {
 				break
 			}
-			r := MissingInfo{
-				Id:   (ImageId)(stmt.ColumnInt64(0)),
-				Path: stmt.ColumnText(1),
-			}
-			i := 2
-			if opts.Color {
-				r.Color = stmt.ColumnBool(i)
-				i++
-			}
-			if opts.Embedding {
-				r.Embedding = stmt.ColumnBool(i)
-				i++
-			}
-			out <- r
+			panoramas = append(panoramas, Panorama{
+				Id:        id,
+				Preview:   stmt.ColumnText(1),
+				CreatedAt: time.Unix(stmt.ColumnInt64(2), 0),
+			})
 		}
+		p := &panoramas[len(panoramas)-1]
+		p.Files = append(p.Files, ImageId(stmt.ColumnInt64(3)))
+	}
+	return panoramas
+}
 
-		close(out)
-	}()
-	return out
+func (source *Database) GetPanorama(id int64) (Panorama, bool) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT coalesce(preview, ''), created_at_unix, file_id
+		FROM panorama
+		JOIN panorama_file ON panorama_file.panorama_id == panorama.id
+		WHERE panorama.id == ? AND rejected == 0
+		ORDER BY position;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, id)
+
+	p := Panorama{Id: id}
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error getting panorama", "id", id, "err", err)
+			return Panorama{}, false
+		} else if !exists {
+			break
+		}
+		p.Preview = stmt.ColumnText(0)
+		p.CreatedAt = time.Unix(stmt.ColumnInt64(1), 0)
+		p.Files = append(p.Files, ImageId(stmt.ColumnInt64(2)))
+	}
+	return p, len(p.Files) > 0
 }
@@ -5,7 +5,7 @@ import (
 	goimage "image"
 	"image/jpeg"
 	"io"
-	"log"
+	"photofield/io/archive"
 	"photofield/tag"
 	"strconv"
 	"time"
@@ -14,22 +14,24 @@ import (
 type Decoder struct {
 	loader       metadataLoader
 	goexifLoader *GoExifRwcarlsenLoader
+	timezones    *timezoneResolver
 }
 
 type metadataLoader interface {
-	DecodeInfo(path string, info *Info) ([]tag.Tag, error)
+	DecodeInfo(path string, info *Info, hints *dateHints) ([]tag.Tag, error)
 	DecodeBytes(path string, tagName string) ([]byte, error)
 	Close()
 }
 
-func NewDecoder(exifToolCount int) *Decoder {
+func NewDecoder(exifToolCount int, timezones *timezoneResolver) *Decoder {
 	decoder := Decoder{}
+	decoder.timezones = timezones
 	decoder.goexifLoader = NewGoExifRwcarlsenLoader()
 	if exifToolCount > 0 {
 		var err error
 		decoder.loader, err = NewExifToolMostlyGeekLoader(exifToolCount)
 		if err != nil {
-			log.Printf("unable to use exiftool, defaulting to goexif - no video metadata support (%v)\n", err.Error())
+			decodeLog.Warn("unable to use exiftool, defaulting to goexif without video metadata support", "err", err)
 			decoder.loader = decoder.goexifLoader
 		}
 	} else {
@@ -70,18 +72,33 @@ func parseDateTime(value string) (t time.Time, hasTimezone bool, hasSubsec bool,
 	return
 }
 
-func (decoder *Decoder) DecodeInfo(path string, info *Info) ([]tag.Tag, error) {
-	return decoder.loader.DecodeInfo(path, info)
+// loaderFor returns the loader able to read the file, as exiftool cannot
+// read files inside archives
+func (decoder *Decoder) loaderFor(path string) metadataLoader {
+	if archive.IsVirtual(path) {
+		return decoder.goexifLoader
+	}
+	return decoder.loader
+}
+
+func (decoder *Decoder) DecodeInfo(path string, info *Info, camera *Camera) ([]tag.Tag, error) {
+	hints := newDateHints()
+	tags, err := decoder.loaderFor(path).DecodeInfo(path, info, &hints)
+	info.DateTime = decoder.timezones.resolve(info.DateTime, hints)
+	*camera = newCamera(hints)
+	return tags, err
 }
 
 func (decoder *Decoder) DecodeImage(path string, tagName string) (goimage.Image, Info, error) {
-	imageBytes, err := decoder.loader.DecodeBytes(path, tagName)
+	imageBytes, err := decoder.loaderFor(path).DecodeBytes(path, tagName)
 	if err != nil {
 		return nil, Info{}, err
 	}
 	info := Info{}
 	r := bytes.NewReader(imageBytes)
-	decoder.goexifLoader.DecodeInfoReader(r, &info)
+	hints := newDateHints()
+	decoder.goexifLoader.DecodeInfoReader(r, &info, &hints)
+	info.DateTime = decoder.timezones.resolve(info.DateTime, hints)
 
 	r.Seek(0, io.SeekStart)
 	img, err := jpeg.Decode(r)
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DedupMode defines how files that appear multiple times in a listing are
+// recognized as the same photo
+type DedupMode string
+
+const (
+	DedupNone DedupMode = ""
+	DedupPath DedupMode = "PATH"
+	DedupHash DedupMode = "HASH"
+)
+
+func DedupModeFromString(s string) (DedupMode, error) {
+	mode := DedupMode(strings.ToUpper(s))
+	switch mode {
+	case DedupNone, DedupPath, DedupHash:
+		return mode, nil
+	default:
+		return DedupNone, fmt.Errorf("unknown dedup mode: %s", s)
+	}
+}
+
+func canonicalPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+	return resolved
+}
+
+func (source *Source) dedupKey(id ImageId, mode DedupMode) (string, bool) {
+	switch mode {
+	case DedupPath:
+		path, err := source.GetImagePath(id)
+		if err != nil {
+			return "", false
+		}
+		return canonicalPath(path), true
+	case DedupHash:
+		hash, err := source.GetFileHash(id)
+		if err != nil {
+			return "", false
+		}
+		return hash, true
+	default:
+		return "", false
+	}
+}
+
+// DedupInfos filters out infos that refer to a file already seen earlier
+// in the listing, e.g. in case of collections with overlapping dirs
+func (source *Source) DedupInfos(infos <-chan SourcedInfo, mode DedupMode) <-chan SourcedInfo {
+	if mode == DedupNone {
+		return infos
+	}
+	out := make(chan SourcedInfo, 1000)
+	go func() {
+		seen := make(map[string]struct{})
+		for info := range infos {
+			key, ok := source.dedupKey(info.Id, mode)
+			if ok {
+				if _, exists := seen[key]; exists {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			out <- info
+		}
+		close(out)
+	}()
+	return out
+}
+
+// DedupSimilarityInfos is the same as DedupInfos, but for similarity listings
+func (source *Source) DedupSimilarityInfos(infos <-chan SimilarityInfo, mode DedupMode) <-chan SimilarityInfo {
+	if mode == DedupNone {
+		return infos
+	}
+	out := make(chan SimilarityInfo, 1000)
+	go func() {
+		seen := make(map[string]struct{})
+		for info := range infos {
+			key, ok := source.dedupKey(info.Id, mode)
+			if ok {
+				if _, exists := seen[key]; exists {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			out <- info
+		}
+		close(out)
+	}()
+	return out
+}
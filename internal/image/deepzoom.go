@@ -0,0 +1,164 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	goimage "image"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"strconv"
+	"time"
+
+	"photofield/internal/deepzoom"
+	"photofield/io/sqlite"
+)
+
+// Number of tiles written to the thumbnail database at once while
+// generating a pyramid, so that tiles already generated can be served
+const deepZoomBatch = 256
+
+// DeepZoomPyramid returns the tile pyramid of the photo at full size
+func (source *Source) DeepZoomPyramid(id ImageId) (deepzoom.Pyramid, error) {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return deepzoom.Pyramid{}, err
+	}
+	if !source.IsSupportedImage(path) {
+		return deepzoom.Pyramid{}, ErrNotAnImage
+	}
+	info := source.GetInfo(id)
+	if info.Width == 0 || info.Height == 0 {
+		return deepzoom.Pyramid{}, ErrUnavailable
+	}
+	return deepzoom.Pyramid{Width: info.Width, Height: info.Height}, nil
+}
+
+// DeepZoomTile returns the encoded tile of the pyramid of the photo, or
+// deepzoom.ErrTileNotFound if the pyramid has no such tile. The pyramid is generated
+// and stored in the thumbnail database on the first request, so that the
+// original is only decoded once.
+func (source *Source) DeepZoomTile(ctx context.Context, id ImageId, level, col, row int) ([]byte, error) {
+	pyramid, err := source.DeepZoomPyramid(id)
+	if err != nil {
+		return nil, err
+	}
+	if !pyramid.Valid(level, col, row) {
+		return nil, deepzoom.ErrTileNotFound
+	}
+
+	b, err := source.thumbnailSink.GetTile(ctx, uint32(id), level, col, row)
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return b, err
+	}
+
+	key := strconv.FormatUint(uint64(id), 10)
+	_, err, _ = source.deepZoomLoading.Do(key, func() (interface{}, error) {
+		return nil, source.generateDeepZoom(id, pyramid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return source.thumbnailSink.GetTile(ctx, uint32(id), level, col, row)
+}
+
+// Region is a part of a photo in fractions of its size
+type Region struct {
+	X, Y, W, H float64
+}
+
+// LoadRegion returns the region of the photo displayed upright at the
+// size, assembled from the tiles of its deep zoom pyramid covering it, so
+// that zooming into large originals only decodes the small tiles in view
+// instead of the whole original. It also returns the region covered by
+// the image, which is the region expanded to whole pixels. If the pyramid
+// is not generated yet, it returns ErrUnavailable and generates it in the
+// background.
+func (source *Source) LoadRegion(ctx context.Context, id ImageId, size Size, region Region) (goimage.Image, Region, error) {
+	pyramid, err := source.DeepZoomPyramid(id)
+	if err != nil {
+		return nil, Region{}, err
+	}
+
+	level := pyramid.Level(size.X, size.Y)
+	lw, lh := pyramid.Size(level)
+	r := goimage.Rect(
+		int(math.Floor(region.X*float64(lw))),
+		int(math.Floor(region.Y*float64(lh))),
+		int(math.Ceil((region.X+region.W)*float64(lw))),
+		int(math.Ceil((region.Y+region.H)*float64(lh))),
+	).Intersect(goimage.Rect(0, 0, lw, lh))
+	if r.Empty() {
+		return nil, Region{}, ErrUnavailable
+	}
+
+	img := goimage.NewRGBA(goimage.Rect(0, 0, r.Dx(), r.Dy()))
+	for row := r.Min.Y / deepzoom.TileSize; row <= (r.Max.Y-1)/deepzoom.TileSize; row++ {
+		for col := r.Min.X / deepzoom.TileSize; col <= (r.Max.X-1)/deepzoom.TileSize; col++ {
+			b, err := source.thumbnailSink.GetTile(ctx, uint32(id), level, col, row)
+			if errors.Is(err, sqlite.ErrNotFound) {
+				go source.deepZoomLoading.Do(strconv.FormatUint(uint64(id), 10), func() (interface{}, error) {
+					return nil, source.generateDeepZoom(id, pyramid)
+				})
+				return nil, Region{}, ErrUnavailable
+			}
+			if err != nil {
+				return nil, Region{}, err
+			}
+			tile, err := jpeg.Decode(bytes.NewReader(b))
+			if err != nil {
+				return nil, Region{}, err
+			}
+			tr := pyramid.Rect(level, col, row)
+			draw.Draw(img, tr.Sub(r.Min), tile, tile.Bounds().Min, draw.Src)
+		}
+	}
+	covered := Region{
+		X: float64(r.Min.X) / float64(lw),
+		Y: float64(r.Min.Y) / float64(lh),
+		W: float64(r.Dx()) / float64(lw),
+		H: float64(r.Dy()) / float64(lh),
+	}
+	return img, covered, nil
+}
+
+func (source *Source) generateDeepZoom(id ImageId, pyramid deepzoom.Pyramid) error {
+	// Not canceled with the request, as other requests wait for it
+	ctx := context.Background()
+
+	source.deepZoomGenerating <- struct{}{}
+	defer func() { <-source.deepZoomGenerating }()
+
+	start := time.Now()
+	img, err := source.LoadImage(ctx, id, Size{})
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	if b.Dx() < pyramid.Width || b.Dy() < pyramid.Height {
+		return fmt.Errorf("unable to generate deep zoom tiles of %d: decoded %dx%d instead of %dx%d", id, b.Dx(), b.Dy(), pyramid.Width, pyramid.Height)
+	}
+
+	count := 0
+	tiles := make([]deepzoom.Tile, 0, deepZoomBatch)
+	err = pyramid.Generate(img, func(t deepzoom.Tile) error {
+		tiles = append(tiles, t)
+		count++
+		if len(tiles) < deepZoomBatch {
+			return nil
+		}
+		err := source.thumbnailSink.WriteTiles(uint32(id), tiles)
+		tiles = tiles[:0]
+		return err
+	})
+	if err == nil {
+		err = source.thumbnailSink.WriteTiles(uint32(id), tiles)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to generate deep zoom tiles of %d: %w", id, err)
+	}
+	decodeLog.Info("deep zoom generated", "id", id, "tiles", count, "width", pyramid.Width, "height", pyramid.Height, "elapsed", time.Since(start).Round(time.Millisecond))
+	return nil
+}
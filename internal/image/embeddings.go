@@ -0,0 +1,375 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"photofield/internal/clip"
+	"photofield/internal/metrics"
+	"photofield/internal/vector"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Name of the embeddings store next to the cache database. The database
+// only keeps the inverse norms, so that it can tell which files are missing
+// embeddings.
+const embeddingsName = "photofield.embeddings"
+
+// Name of the quantized copy of the embeddings store
+const quantizedEmbeddingsName = "photofield.embeddings.int8"
+
+const (
+	QuantizeFloat16 = "float16"
+	QuantizeInt8    = "int8"
+)
+
+type EmbeddingsConfig struct {
+	// float16 to search the embeddings as stored, int8 to search a quantized
+	// copy a quarter of the size of single-precision floats
+	Quantization string `json:"quantization"`
+	// Most similar files of a quantized search that are scored again with the
+	// stored embeddings, so that the top results are ordered exactly
+	Rescore int `json:"rescore"`
+}
+
+// QuantizedEmbedding is an embedding with every element scaled to a byte
+type QuantizedEmbedding struct {
+	Id     ImageId
+	Vector []int8
+	// Turns the dot product with a unit vector into the cosine similarity
+	Scale float32
+}
+
+// embeddingStore keeps the embeddings of the files in the data dir, for
+// all the database backends alike
+type embeddingStore struct {
+	// Embeddings by file id and their quantized copy, nil unless enabled
+	vectors   *vector.Store
+	quantized *vector.Store
+}
+
+func openEmbeddings(dir string, readOnly bool) (*vector.Store, error) {
+	return vector.Open(filepath.Join(dir, embeddingsName), vector.Float16, readOnly)
+}
+
+// openQuantizedEmbeddings opens the quantized copy of the embeddings in the
+// dir if enabled, removing the stale one otherwise
+func (source *embeddingStore) openQuantizedEmbeddings(dir string, readOnly bool, config EmbeddingsConfig) error {
+	path := filepath.Join(dir, quantizedEmbeddingsName)
+	if config.Quantization != QuantizeInt8 {
+		if readOnly {
+			return nil
+		}
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	var err error
+	source.quantized, err = vector.Open(path, vector.Int8, readOnly)
+	if err != nil || readOnly {
+		return err
+	}
+	return source.quantizeEmbeddings()
+}
+
+// quantizeEmbeddings adds the missing embeddings to the quantized copy and
+// removes the ones that were deleted
+func (source *embeddingStore) quantizeEmbeddings() error {
+	if source.quantized.Len() == source.vectors.Len() {
+		return nil
+	}
+	defer metrics.Elapsed("quantize embeddings")()
+
+	ids := source.vectors.Ids()
+	exists := make(map[uint32]struct{}, len(ids))
+	added := 0
+	for _, id := range ids {
+		exists[id] = struct{}{}
+		if _, _, ok := source.quantized.Get(id); ok {
+			continue
+		}
+		bytes, invnorm, ok := source.vectors.Get(id)
+		if !ok {
+			continue
+		}
+		q, scale := clip.QuantizeInt8(clip.FromRaw(bytes, invnorm))
+		if err := source.quantized.Put(id, q, uint16(scale)); err != nil {
+			return err
+		}
+		added++
+	}
+	for _, id := range source.quantized.Ids() {
+		if _, ok := exists[id]; ok {
+			continue
+		}
+		if err := source.quantized.Delete(id); err != nil {
+			return err
+		}
+	}
+	dbLog.Info("quantized embeddings", "count", added)
+	return nil
+}
+
+// putEmbedding stores the embedding and its quantized copy
+func (source *embeddingStore) putEmbedding(id ImageId, embedding clip.Embedding) error {
+	err := source.vectors.Put(uint32(id), embedding.Byte(), embedding.InvNormUint16())
+	if err != nil || source.quantized == nil {
+		return err
+	}
+	q, scale := clip.QuantizeInt8(embedding)
+	return source.quantized.Put(uint32(id), q, uint16(scale))
+}
+
+// deleteEmbedding removes the embedding and its quantized copy
+func (source *embeddingStore) deleteEmbedding(id ImageId) error {
+	err := source.vectors.Delete(uint32(id))
+	if err != nil || source.quantized == nil {
+		return err
+	}
+	return source.quantized.Delete(uint32(id))
+}
+
+// moveEmbeddings moves the embeddings stored in the cache database by
+// previous versions into the embeddings store
+func (source *Database) moveEmbeddings() error {
+	conn := source.open()
+	defer conn.Close()
+
+	moved := 0
+	err := sqlitex.Execute(conn, `
+		SELECT file_id, inv_norm, embedding
+		FROM clip_emb
+		WHERE length(embedding) > 0;`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			bytes := make([]byte, stmt.ColumnLen(2))
+			stmt.ColumnBytes(2, bytes)
+			invnorm := uint16(clip.InvNormMean + stmt.ColumnInt64(1))
+			if err := source.vectors.Put(uint32(stmt.ColumnInt64(0)), bytes, invnorm); err != nil {
+				return err
+			}
+			moved++
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if moved == 0 {
+		return nil
+	}
+	if err := source.vectors.Sync(); err != nil {
+		return err
+	}
+	err = sqlitex.Execute(conn, `
+		UPDATE clip_emb
+		SET embedding = x''
+		WHERE length(embedding) > 0;`, nil)
+	if err != nil {
+		return err
+	}
+	dbLog.Info("moved embeddings to the embeddings store, vacuum the database to reclaim the space", "count", moved)
+	return nil
+}
+
+func (source *embeddingStore) GetImageEmbedding(id ImageId) (clip.Embedding, error) {
+	bytes, invnorm, ok := source.vectors.Get(uint32(id))
+	if !ok {
+		return nil, nil
+	}
+	return clip.FromRaw(bytes, invnorm), nil
+}
+
+// ScanEmbeddings calls fn with the embeddings of the files in the dirs. The
+// embedding is only valid during the call, as it is read from the
+// embeddings store directly instead of being copied.
+func (source *Database) ScanEmbeddings(dirs []string, options ListOptions, fn func(EmbeddingsResult)) {
+	defer metrics.Elapsed("scan embeddings")()
+
+	source.scanEmbeddings(source.listEmbeddingIds(dirs, options), fn)
+}
+
+// ScanQuantizedEmbeddings calls fn with the quantized embeddings of the
+// files in the dirs, false if there is no complete quantized copy of the
+// embeddings to scan instead of the embeddings themselves. The embedding is
+// only valid during the call.
+func (source *Database) ScanQuantizedEmbeddings(dirs []string, options ListOptions, fn func(QuantizedEmbedding)) bool {
+	if !source.quantizedComplete() {
+		return false
+	}
+
+	defer metrics.Elapsed("scan quantized embeddings")()
+
+	source.scanQuantizedEmbeddings(source.listEmbeddingIds(dirs, options), fn)
+	return true
+}
+
+// scanEmbeddings calls fn with the embeddings of the files with the ids
+func (source *embeddingStore) scanEmbeddings(ids []uint32, fn func(EmbeddingsResult)) {
+	source.vectors.Range(ids, func(id uint32, bytes []byte, invnorm uint16) bool {
+		fn(EmbeddingsResult{
+			Id:        ImageId(id),
+			Embedding: clip.FromRaw(bytes, invnorm),
+		})
+		return true
+	})
+}
+
+// quantizedComplete returns true if the quantized copy has all the
+// embeddings, it is incomplete while being built or if the writer does not
+// quantize
+func (source *embeddingStore) quantizedComplete() bool {
+	return source.quantized != nil && source.quantized.Len() >= source.vectors.Len()
+}
+
+// scanQuantizedEmbeddings calls fn with the quantized embeddings of the
+// files with the ids
+func (source *embeddingStore) scanQuantizedEmbeddings(ids []uint32, fn func(QuantizedEmbedding)) {
+	source.quantized.Range(ids, func(id uint32, bytes []byte, scale uint16) bool {
+		fn(QuantizedEmbedding{
+			Id:     ImageId(id),
+			Vector: clip.Int8(bytes),
+			Scale:  clip.Float(scale).Float32(),
+		})
+		return true
+	})
+}
+
+// listEmbeddingIds returns the ids of the files in the dirs with embeddings
+func (source *Database) listEmbeddingIds(dirs []string, options ListOptions) []uint32 {
+	defer metrics.Elapsed("list embedding ids sqlite")()
+
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	sql := `
+		SELECT id
+	`
+
+	if options.ignored != nil {
+		sql += `,
+			(SELECT str FROM prefix WHERE prefix.id = path_prefix_id) || filename
+		`
+	}
+
+	sql += `
+		FROM infos
+		INNER JOIN clip_emb ON clip_emb.file_id = id
+		WHERE path_prefix_id IN (
+			SELECT id
+			FROM prefix
+			WHERE
+	`
+
+	for i := range dirs {
+		sql += `str LIKE ? `
+		if i < len(dirs)-1 {
+			sql += "OR "
+		}
+	}
+
+	sql += `
+		)
+	`
+
+	hidden := options.hiddenTags()
+	sql += hiddenTagsSql(len(hidden))
+
+	sqlLimit := options.Limit > 0 && options.ignored == nil
+	if sqlLimit {
+		sql += `LIMIT ? `
+	}
+
+	sql += ";"
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+
+	bindIndex := 1
+	for _, dir := range dirs {
+		stmt.BindText(bindIndex, dir+"%")
+		bindIndex++
+	}
+
+	for _, tag := range hidden {
+		stmt.BindText(bindIndex, tag)
+		bindIndex++
+	}
+
+	if sqlLimit {
+		stmt.BindInt64(bindIndex, (int64)(options.Limit))
+	}
+
+	ids := make([]uint32, 0, 1000)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("error listing embeddings", "err", err)
+			break
+		} else if !exists {
+			break
+		}
+
+		if options.ignored != nil {
+			if options.ignored(stmt.ColumnText(1)) {
+				continue
+			}
+			if options.Limit > 0 && len(ids) >= options.Limit {
+				break
+			}
+		}
+
+		ids = append(ids, uint32(stmt.ColumnInt64(0)))
+	}
+	return ids
+}
+
+// RefreshEmbeddings picks up the embeddings another process added to the
+// embeddings store of a read-only database
+func (source *embeddingStore) RefreshEmbeddings() error {
+	err := source.vectors.Refresh()
+	if err != nil || source.quantized == nil {
+		return err
+	}
+	return source.quantized.Refresh()
+}
+
+// exportEmbeddings copies the embeddings of the files to the embeddings
+// store next to the database at dstPath
+func (source *embeddingStore) exportEmbeddings(dstPath string, files []ExportFile) error {
+	dst, err := openEmbeddings(filepath.Dir(dstPath), false)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint32, len(files))
+	for i, file := range files {
+		ids[i] = uint32(file.Id)
+	}
+	source.vectors.Range(ids, func(id uint32, bytes []byte, invnorm uint16) bool {
+		err = dst.Put(id, bytes, invnorm)
+		return err == nil
+	})
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to export embeddings: %w", err)
+	}
+	return nil
+}
+
+// Close commits the embeddings store to disk
+func (source *embeddingStore) Close() error {
+	err := source.vectors.Close()
+	if source.quantized == nil {
+		return err
+	}
+	if qerr := source.quantized.Close(); err == nil {
+		err = qerr
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an event published after it was committed to
+// the database
+type EventType string
+
+const (
+	// A new file was found
+	EventFileIndexed EventType = "file.indexed"
+	// The metadata of a file was extracted
+	EventMetadataIndexed EventType = "file.metadata"
+	// The AI embedding of a file was computed
+	EventEmbeddingIndexed EventType = "file.embedding"
+	// A new file has the same contents as files that were already indexed
+	EventDuplicateFound EventType = "file.duplicate"
+	// A file does not match its stored hash anymore when verified
+	EventChecksumMismatch EventType = "file.checksum_mismatch"
+	EventTagAdded         EventType = "tag.added"
+	EventTagRemoved       EventType = "tag.removed"
+)
+
+var EventTypes = []EventType{
+	EventFileIndexed,
+	EventMetadataIndexed,
+	EventEmbeddingIndexed,
+	EventDuplicateFound,
+	EventChecksumMismatch,
+	EventTagAdded,
+	EventTagRemoved,
+}
+
+type Event struct {
+	Type EventType
+	Time time.Time
+	// File the event is about, zero for tag events and duplicates, as the
+	// duplicate is not indexed yet
+	Id   ImageId
+	Path string
+	// Name of the tag of tag events
+	Tag string
+	// Files of tag events
+	Ids Ids
+	// Previously indexed files with the same contents of duplicates
+	Duplicates []IdPath
+}
+
+type events struct {
+	mutex     sync.RWMutex
+	listeners []func(Event)
+}
+
+// Subscribe calls the listener for every event. Listeners are called from
+// the database writer and must not block.
+func (source *Source) Subscribe(listener func(Event)) {
+	source.database.Subscribe(listener)
+}
+
+// Subscribe calls the listener for every event committed to the database
+func (source *Database) Subscribe(listener func(Event)) {
+	source.events.mutex.Lock()
+	defer source.events.mutex.Unlock()
+	source.events.listeners = append(source.events.listeners, listener)
+}
+
+// Publish calls the listeners for events that are not committed with a
+// write, e.g. the ones found while verifying files
+func (source *Database) Publish(events []Event) {
+	source.events.publish(events)
+}
+
+func (e *events) publish(events []Event) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, event := range events {
+		for _, listener := range e.listeners {
+			listener(event)
+		}
+	}
+}
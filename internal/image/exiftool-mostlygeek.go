@@ -8,7 +8,6 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/golang/geo/s2"
 	"github.com/mostlygeek/go-exiftool"
@@ -37,6 +36,11 @@ func NewExifToolMostlyGeekLoader(exifToolCount int) (*ExifToolMostlyGeekLoader,
 		"-Rotation#",
 		"-ImageWidth#",
 		"-ImageHeight#",
+		"-SerialNumber",
+		// First available will be used
+		"-XMP:Description",
+		"-Caption-Abstract",
+		"-ImageDescription",
 	)
 	decoder.flags = append(decoder.flags, tag.ExifFlags...)
 	decoder.flags = append(decoder.flags,
@@ -59,7 +63,7 @@ func NewExifToolMostlyGeekLoader(exifToolCount int) (*ExifToolMostlyGeekLoader,
 	return decoder, err
 }
 
-func (decoder *ExifToolMostlyGeekLoader) DecodeInfo(path string, info *Info) ([]tag.Tag, error) {
+func (decoder *ExifToolMostlyGeekLoader) DecodeInfo(path string, info *Info, hints *dateHints) ([]tag.Tag, error) {
 
 	if decoder == nil {
 		return nil, errors.New("unable to decode, exiftool missing")
@@ -78,8 +82,6 @@ func (decoder *ExifToolMostlyGeekLoader) DecodeInfo(path string, info *Info) ([]
 	latitude := ""
 	longitude := ""
 
-	// var gpsTime time.Time
-
 	output := string(bytes)
 	scanner := bufio.NewScanner(strings.NewReader(output))
 	for scanner.Scan() {
@@ -104,21 +106,41 @@ func (decoder *ExifToolMostlyGeekLoader) DecodeInfo(path string, info *Info) ([]
 			latitude = value
 		case "GPSLongitude":
 			longitude = value
-
-		// case "GPSDateTime":
-		// 	gpsTime, _ = parseDateTime(value)
+		case "SerialNumber":
+			hints.Serial = value
+		case "Description", "Caption-Abstract", "ImageDescription":
+			if info.Description == "" {
+				info.Description = parseDescription(value)
+			}
+		case "GPSDateTime":
+			// Always UTC, used to infer the timezone of the local time
+			t, _, _, err := parseDateTime(value)
+			if err == nil {
+				hints.GpsTime = t
+				if info.DateTime.IsZero() {
+					info.DateTime = t
+					hints.HasTimezone = true
+				}
+			}
 		default:
-			if name, ok := tag.ExifTagToName[name]; ok {
-				tags = append(tags, tag.NewExif(name, value))
+			if slug, ok := tag.ExifTagToName[name]; ok {
+				tags = append(tags, tag.NewExif(slug, value))
+			}
+			switch name {
+			case "Make":
+				hints.Make = value
+			case "Model":
+				hints.Model = value
 			}
 			if strings.Contains(name, "Date") || strings.Contains(name, "Time") {
 				if info.DateTime.IsZero() {
-					info.DateTime, _, _, _ = parseDateTime(value)
+					info.DateTime, hints.HasTimezone, _, _ = parseDateTime(value)
 				} else if name != "FileModifyDate" && name != "FileCreateDate" {
 					// Prefer time with timezone if available
 					t, hasTimezone, _, _ := parseDateTime(value)
-					if hasTimezone && info.DateTime.Location() == time.UTC {
+					if hasTimezone && !hints.HasTimezone {
 						info.DateTime = t
+						hints.HasTimezone = true
 					}
 				}
 			} else if strings.HasSuffix(name, "Image") {
@@ -172,6 +194,7 @@ func (decoder *ExifToolMostlyGeekLoader) DecodeInfo(path string, info *Info) ([]
 	} else {
 		info.LatLng = NaNLatLng()
 	}
+	hints.LatLng = info.LatLng
 
 	if info.Orientation.SwapsDimensions() {
 		info.Width, info.Height = info.Height, info.Width
@@ -0,0 +1,130 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractOptions configure how a subset of the library is extracted into
+// a new data dir
+type ExtractOptions struct {
+	// Data dir to extract into, photos are placed in its "photos" subdir
+	Dir string
+	// Hard link files instead of copying them where possible
+	Link bool
+}
+
+func extractRelPath(dirs []string, path string) (string, error) {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(dirs) > 1 {
+			base := filepath.Base(filepath.Clean(dir))
+			if base == "." || base == string(filepath.Separator) {
+				base = ""
+			}
+			rel = filepath.Join(base, rel)
+		}
+		return rel, nil
+	}
+	return "", fmt.Errorf("%s is not in any of the dirs", path)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func extractFile(src string, dst string, link bool) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	if link {
+		err = os.Link(src, dst)
+		if err == nil {
+			return nil
+		}
+		indexLog.Warn("extract unable to link, copying instead", "src", src, "err", err)
+	}
+	return copyFile(src, dst)
+}
+
+// Extract copies or links the files of the provided ids together with their
+// database rows, tags and thumbnails into a new self-contained data dir.
+// The paths of the extracted files are kept relative to the provided dirs.
+// Returns the absolute path of the dir containing the extracted photos.
+func (source *Source) Extract(dirs []string, ids []ImageId, options ExtractOptions, migrations fs.FS, migrationsThumbs fs.FS) (string, error) {
+	photosDir, err := filepath.Abs(filepath.Join(options.Dir, "photos"))
+	if err != nil {
+		return "", err
+	}
+
+	files := make([]ExportFile, 0, len(ids))
+	thumbIds := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		path, err := source.GetImagePath(id)
+		if err != nil {
+			indexLog.Error("extract unable to get path", "id", id, "err", err)
+			continue
+		}
+		rel, err := extractRelPath(dirs, path)
+		if err != nil {
+			indexLog.Warn("extract skipping", "id", id, "err", err)
+			continue
+		}
+		dst := filepath.Join(photosDir, rel)
+		err = extractFile(path, dst, options.Link)
+		if err != nil {
+			indexLog.Error("extract unable to copy", "path", path, "err", err)
+			continue
+		}
+		files = append(files, ExportFile{
+			Id:   id,
+			Path: dst,
+		})
+		thumbIds = append(thumbIds, uint32(id))
+	}
+	indexLog.Info("extract files", "count", len(files), "photos_dir", photosDir)
+
+	source.database.WaitForCommit()
+	err = source.database.Export(filepath.Join(options.Dir, "photofield.cache.db"), migrations, files)
+	if err != nil {
+		return "", fmt.Errorf("unable to export database: %w", err)
+	}
+
+	thumbsPath, err := filepath.Rel(source.DataDir, source.thumbnailSink.Path())
+	if err != nil {
+		thumbsPath = filepath.Base(source.thumbnailSink.Path())
+	}
+	err = source.thumbnailSink.Export(filepath.Join(options.Dir, thumbsPath), migrationsThumbs, thumbIds)
+	if err != nil {
+		return "", fmt.Errorf("unable to export thumbnails: %w", err)
+	}
+
+	return photosDir, nil
+}
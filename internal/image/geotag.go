@@ -0,0 +1,251 @@
+package image
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/io/archive"
+	"photofield/io/track"
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+)
+
+// Geotag is a location of a file stored apart from its metadata, either
+// correlated from a GPS track or set by hand
+type Geotag struct {
+	LatLng s2.LatLng
+	// Set by hand, taking precedence over the location in the metadata of
+	// the file instead of only filling it in
+	Edited bool
+}
+
+// GeotagOptions configure how photos are correlated with a GPS track
+type GeotagOptions struct {
+	// Added to the capture time of the photos before looking them up on
+	// the track, e.g. to correct for a camera set to the wrong timezone
+	TimeOffset time.Duration
+	// Largest time between two track points to interpolate between them, or
+	// between a photo and the nearest point otherwise
+	MaxGap time.Duration
+	// Replace the location of photos that already have one, except for
+	// locations set by hand
+	Overwrite bool
+	// Write the location to new XMP sidecars next to the photos, skipping
+	// photos that already have one
+	WriteXmp bool
+	// Only report what would be geotagged
+	DryRun bool
+}
+
+// GeotagResult reports how photos were correlated with a GPS track
+type GeotagResult struct {
+	// Photos taken while the track was recorded with a location found
+	Geotagged []ImageId
+	// Photos taken while the track was recorded that already had a location
+	Located int
+	// Photos taken while the track was recorded with no point close enough
+	Unmatched int
+	// XMP sidecars written
+	XmpWritten int
+}
+
+// hasLocation reports whether the location is known, as files without a
+// location are read as 0, 0 by goexif
+func hasLocation(latlng s2.LatLng) bool {
+	return !IsNaNLatLng(latlng) && (latlng.Lat != 0 || latlng.Lng != 0)
+}
+
+// Geotag backfills the locations of the photos in the dirs taken while the
+// track was recorded, going by their capture time
+func (source *Source) Geotag(dirs []string, t track.Track, options GeotagOptions) (GeotagResult, error) {
+	var result GeotagResult
+	if len(t) == 0 {
+		return result, track.ErrNoPoints
+	}
+	if options.MaxGap <= 0 {
+		options.MaxGap = 5 * time.Minute
+	}
+	start := t.Start().Add(-options.MaxGap)
+	end := t.End().Add(options.MaxGap)
+
+	for info := range source.ListInfos(dirs, ListOptions{OrderBy: DateAsc}) {
+		if info.DateTime.IsZero() {
+			continue
+		}
+		tm := info.DateTime.Add(options.TimeOffset)
+		if tm.Before(start) || tm.After(end) {
+			continue
+		}
+		if hasLocation(info.LatLng) && !options.Overwrite {
+			result.Located++
+			continue
+		}
+		if g, ok := source.database.GetGeotag(info.Id); ok && g.Edited {
+			result.Located++
+			continue
+		}
+		p, ok := t.Locate(tm, options.MaxGap)
+		if !ok {
+			result.Unmatched++
+			continue
+		}
+		result.Geotagged = append(result.Geotagged, info.Id)
+		if options.DryRun {
+			continue
+		}
+		latlng := s2.LatLngFromDegrees(p.Lat, p.Lng)
+		if err := source.database.WriteGeotag(info.Id, Geotag{LatLng: latlng}); err != nil {
+			return result, err
+		}
+		source.imageInfoCache.Delete(info.Id)
+		source.indexPlaces(info.Id, latlng)
+		source.flagFile(info.Id, tag.NoGps, false)
+		path, err := source.GetImagePath(info.Id)
+		if err != nil {
+			continue
+		}
+		source.sidecars.changed(path)
+		if options.WriteXmp {
+			written, err := source.writeXmpLocation(path, latlng)
+			if err != nil {
+				return result, err
+			}
+			if written {
+				result.XmpWritten++
+			}
+		}
+	}
+	if !options.DryRun {
+		source.database.Flush()
+	}
+	return result, nil
+}
+
+// SetLocation sets the location of the files by hand, taking precedence
+// over their GPS metadata without modifying them. It returns the files that
+// were found and updated.
+func (source *Source) SetLocation(ids []ImageId, latlng s2.LatLng) ([]ImageId, error) {
+	if !latlng.IsValid() || IsNaNLatLng(latlng) {
+		return nil, fmt.Errorf("invalid location %v", latlng)
+	}
+	var updated []ImageId
+	for _, id := range ids {
+		path, ok := source.database.GetPathFromId(id)
+		if !ok {
+			continue
+		}
+		err := source.database.WriteGeotag(id, Geotag{LatLng: latlng, Edited: true})
+		if err != nil {
+			return updated, err
+		}
+		source.imageInfoCache.Delete(id)
+		source.indexPlaces(id, latlng)
+		source.flagFile(id, tag.NoGps, false)
+		source.sidecars.changed(path)
+		updated = append(updated, id)
+	}
+	source.database.Flush()
+	return updated, nil
+}
+
+// ResetLocation removes the location set by hand or correlated from a GPS
+// track, going back to the one in the metadata of the file. It returns the
+// location the file is left with, NaN if it has none.
+func (source *Source) ResetLocation(id ImageId) (s2.LatLng, error) {
+	path, ok := source.database.GetPathFromId(id)
+	if !ok {
+		return NaNLatLng(), ErrNotFound
+	}
+	// Read from the file itself, as the sidecars may hold the geotag
+	var info Info
+	var camera Camera
+	if _, err := source.decoder.DecodeInfo(path, &info, &camera); err != nil {
+		return NaNLatLng(), err
+	}
+	latlng := info.LatLng
+	if !hasLocation(latlng) {
+		latlng = NaNLatLng()
+	}
+	if err := source.database.ResetGeotag(id, latlng); err != nil {
+		return NaNLatLng(), err
+	}
+	source.database.Flush()
+	source.imageInfoCache.Delete(id)
+	source.indexPlaces(id, latlng)
+	source.flagFile(id, tag.NoGps, !hasLocation(latlng))
+	source.sidecars.changed(path)
+	return latlng, nil
+}
+
+// applyGeotag sets the location correlated from a GPS track on freshly
+// decoded metadata without one and the location set by hand on any, so that
+// geotags survive rescanning
+func (source *Source) applyGeotag(id ImageId, info *Info) {
+	g, ok := source.database.GetGeotag(id)
+	if !ok {
+		return
+	}
+	if g.Edited || !hasLocation(info.LatLng) {
+		info.LatLng = g.LatLng
+	}
+}
+
+// writeXmpLocation writes the location to a new XMP sidecar next to the
+// file, false if the file already has one or is in an archive
+func (source *Source) writeXmpLocation(path string, latlng s2.LatLng) (bool, error) {
+	if archive.IsVirtual(path) {
+		return false, nil
+	}
+	for _, f := range source.findSidecarFiles(path) {
+		if f.Kind == SidecarXmp {
+			return false, nil
+		}
+	}
+	xmpPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+	xmp := fmt.Sprintf(`<?xpacket begin="`+"\uFEFF"+`" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+   exif:GPSVersionID="2.3.0.0"
+   exif:GPSLatitude="%s"
+   exif:GPSLongitude="%s"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`, xmpCoordinate(latlng.Lat.Degrees(), "N", "S"), xmpCoordinate(latlng.Lng.Degrees(), "E", "W"))
+	f, err := os.OpenFile(xmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = f.WriteString(xmp)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(xmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+// xmpCoordinate formats the coordinate in degrees as XMP GPS coordinates
+// do, e.g. 46,3.123456N
+func xmpCoordinate(degrees float64, positive string, negative string) string {
+	ref := positive
+	if degrees < 0 {
+		ref = negative
+		degrees = -degrees
+	}
+	whole := math.Floor(degrees)
+	minutes := (degrees - whole) * 60
+	return fmt.Sprintf("%d,%.6f%s", int(whole), minutes, ref)
+}
@@ -0,0 +1,19 @@
+package image
+
+import "testing"
+
+func TestXmpCoordinate(t *testing.T) {
+	cases := []struct {
+		degrees float64
+		out     string
+	}{
+		{46.05, "46,3.000000N"},
+		{-33.8568, "33,51.408000S"},
+		{0, "0,0.000000N"},
+	}
+	for _, c := range cases {
+		if out := xmpCoordinate(c.degrees, "N", "S"); out != c.out {
+			t.Errorf("%v: expected %s, got %s", c.degrees, c.out, out)
+		}
+	}
+}
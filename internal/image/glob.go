@@ -0,0 +1,134 @@
+package image
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Globs match file paths against a list of glob patterns. Patterns match
+// the end of the path, so `*.tmp` matches any file ending with ".tmp" and
+// `.thumbnails/**` matches any file within any ".thumbnails" dir.
+//
+// Supported syntax:
+//
+//   - any sequence of characters except the path separator
+//     ?      any single character except the path separator
+//     **     any sequence of characters including the path separator
+//     [abc]  any character in the class, [!abc] for negation
+//     /re/   a regular expression matching anywhere in the path
+type Globs struct {
+	files []*regexp.Regexp
+	dirs  []*regexp.Regexp
+}
+
+func globToRegexp(pattern string) (string, error) {
+	var b strings.Builder
+	b.WriteString("(?:^|/)")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// compileGlob compiles a single glob pattern matching the end of the path,
+// or the entire path if anchored
+func compileGlob(pattern string, anchored bool) (*regexp.Regexp, error) {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if anchored {
+		re = "^" + strings.TrimPrefix(re, "(?:^|/)")
+	}
+	return regexp.Compile(re)
+}
+
+// CompileGlobs compiles the provided glob patterns
+func CompileGlobs(patterns []string) (Globs, error) {
+	globs := Globs{}
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			files, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return Globs{}, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			}
+			globs.files = append(globs.files, files)
+			continue
+		}
+		files, err := compileGlob(pattern, false)
+		if err != nil {
+			return Globs{}, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		globs.files = append(globs.files, files)
+
+		// Patterns ending with /** exclude entire dirs, so they can be
+		// skipped while walking without checking every file within
+		if dir := strings.TrimSuffix(pattern, "/**"); dir != pattern && dir != "" {
+			dirs, err := compileGlob(dir, false)
+			if err != nil {
+				return Globs{}, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			}
+			globs.dirs = append(globs.dirs, dirs)
+		}
+	}
+	return globs, nil
+}
+
+func (globs Globs) Empty() bool {
+	return len(globs.files) == 0
+}
+
+// Match reports whether the file at path matches any of the patterns
+func (globs Globs) Match(path string) bool {
+	path = filepath.ToSlash(path)
+	for _, re := range globs.files {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchDir reports whether all files within the dir at path match
+func (globs Globs) MatchDir(path string) bool {
+	path = strings.TrimSuffix(filepath.ToSlash(path), "/")
+	for _, re := range globs.dirs {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package image
+
+import "testing"
+
+func TestGlobsMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"**/.thumbnails/**", "/photos/2020/.thumbnails/a.jpg", true},
+		{"**/.thumbnails/**", ".thumbnails/a.jpg", true},
+		{"**/.thumbnails/**", "/photos/thumbnails/a.jpg", false},
+		{"**/*_edited.jpg", "/photos/2020/a_edited.jpg", true},
+		{"**/*_edited.jpg", "/photos/2020/a_edited.jpg.bak", false},
+		{"*.tmp", "/photos/a/b.tmp", true},
+		{"2020/*.jpg", "/photos/2020/a.jpg", true},
+		{"2020/*.jpg", "/photos/2020/b/a.jpg", false},
+		{"2020/**.jpg", "/photos/2020/b/a.jpg", true},
+		{"IMG_????.jpg", "/photos/IMG_0001.jpg", true},
+		{"IMG_????.jpg", "/photos/IMG_01.jpg", false},
+		{"[!a]*.jpg", "/photos/b.jpg", true},
+		{"[!a]*.jpg", "/photos/a.jpg", false},
+		{`/(^|/)\./`, "/photos/.hidden/a.jpg", true},
+		{`/(^|/)\./`, "/photos/a.jpg", false},
+	}
+	for _, c := range cases {
+		globs, err := CompileGlobs([]string{c.pattern})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if globs.Match(c.path) != c.match {
+			t.Errorf("expected %s to match %s: %v", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestGlobsMatchDir(t *testing.T) {
+	globs, err := CompileGlobs([]string{"**/.thumbnails/**", "*.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !globs.MatchDir("/photos/.thumbnails") {
+		t.Error("expected .thumbnails dir to match")
+	}
+	if globs.MatchDir("/photos/2020") {
+		t.Error("expected 2020 dir not to match")
+	}
+}
+
+func TestGlobsInvalid(t *testing.T) {
+	_, err := CompileGlobs([]string{"[abc"})
+	if err == nil {
+		t.Error("expected error for unterminated class")
+	}
+	_, err = CompileGlobs([]string{"/(abc/"})
+	if err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
@@ -3,9 +3,12 @@ package image
 import (
 	"image"
 	"io"
-	"os"
+	"photofield/io/archive"
+	"photofield/io/xmp"
 	"photofield/tag"
+	"time"
 
+	"github.com/golang/geo/s2"
 	"github.com/rwcarlsen/goexif/exif"
 )
 
@@ -29,19 +32,52 @@ func getOrientationFromExif(x *exif.Exif) string {
 	return "1"
 }
 
-func (decoder *GoExifRwcarlsenLoader) DecodeInfo(path string, info *Info) ([]tag.Tag, error) {
-	file, err := os.Open(path)
+func getStringFromExif(x *exif.Exif, name exif.FieldName) string {
+	t, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	s, err := t.StringVal()
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+func (decoder *GoExifRwcarlsenLoader) DecodeInfo(path string, info *Info, hints *dateHints) ([]tag.Tag, error) {
+	file, err := archive.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	return nil, decoder.DecodeInfoReader(file, info)
+	return nil, decoder.DecodeInfoReader(file, info, hints)
 }
 
-func (decoder *GoExifRwcarlsenLoader) DecodeInfoReader(r io.ReadSeeker, info *Info) error {
+func (decoder *GoExifRwcarlsenLoader) DecodeInfoReader(r io.ReadSeeker, info *Info, hints *dateHints) error {
 	x, err := exif.Decode(r)
 	if err == nil {
+		if tz, _ := x.TimeZone(); tz != nil {
+			hints.HasTimezone = true
+		}
 		info.DateTime, _ = x.DateTime()
+		if !hints.HasTimezone && !info.DateTime.IsZero() {
+			// Dates without timezone are parsed in the local timezone,
+			// reinterpret them as UTC wall clock time same as exiftool
+			info.DateTime = withLocation(info.DateTime, time.UTC)
+		}
+		if lat, lng, err := x.LatLong(); err == nil {
+			hints.LatLng = s2.LatLngFromDegrees(lat, lng)
+		}
+		hints.Make = getStringFromExif(x, exif.Make)
+		hints.Model = getStringFromExif(x, exif.Model)
+		info.Description = parseDescription(getStringFromExif(x, exif.ImageDescription))
+	}
+
+	if info.Description == "" {
+		r.Seek(0, io.SeekStart)
+		if m, ok, _ := xmp.Read(r); ok {
+			info.Description = parseDescription(m.Description)
+		}
 	}
 
 	orientation := parseOrientation(getOrientationFromExif(x))
@@ -63,7 +99,7 @@ func (decoder *GoExifRwcarlsenLoader) DecodeInfoReader(r io.ReadSeeker, info *In
 }
 
 func (decoder *GoExifRwcarlsenLoader) DecodeBytes(path string, tagName string) ([]byte, error) {
-	file, err := os.Open(path)
+	file, err := archive.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,351 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"photofield/io/archive"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+type ContentHashConfig struct {
+	Enable     bool  `json:"enable"`
+	PrefixSize int64 `json:"prefix_size"`
+	Sha256     bool  `json:"sha256"`
+}
+
+// ContentHash identifies a file by its contents instead of its path
+type ContentHash struct {
+	// Size of the file and the xxhash of the first few bytes of the file
+	Fast string
+	// Optional SHA-256 hash of the entire file
+	Sha256 string
+	// Modification time of the file when it was hashed
+	Modified time.Time
+}
+
+const defaultHashPrefixSize = 64 * 1024
+
+// fileHash returns a fast content hash of the file at path, consisting of
+// the file size and the xxhash of the first prefixSize bytes of the file
+func fileHash(path string, prefixSize int64) (string, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if prefixSize <= 0 {
+		prefixSize = defaultHashPrefixSize
+	}
+
+	h := xxhash.New()
+	_, err = io.CopyN(h, f, prefixSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%016x", stat.Size(), h.Sum64()), nil
+}
+
+// hashSize returns the file size stored in a fast content hash
+func hashSize(fast string) (int64, bool) {
+	hex, _, ok := strings.Cut(fast, "-")
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(hex, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hashFile returns the content hash of the file at path, only including the
+// SHA-256 hash if full, as it needs to read the entire file
+func (source *Source) hashFile(path string, full bool) (ContentHash, error) {
+	stat, err := archive.Stat(path)
+	if err != nil {
+		return ContentHash{}, err
+	}
+	sha256 := full && source.ContentHash.Sha256
+	if hash, ok := source.sidecars.hash(path, sha256); ok {
+		hash.Modified = stat.ModTime()
+		return hash, nil
+	}
+	hash := ContentHash{Modified: stat.ModTime()}
+	hash.Fast, err = fileHash(path, source.ContentHash.PrefixSize)
+	if err != nil {
+		return hash, err
+	}
+	if sha256 {
+		hash.Sha256, err = fileSha256(path)
+		if err != nil {
+			return hash, err
+		}
+	}
+	return hash, nil
+}
+
+// GetStoredFileHash returns the fast content hash of a file if it was
+// hashed before, without reading the file
+func (source *Source) GetStoredFileHash(id ImageId) (string, bool) {
+	hash, ok := source.hashCache.Get(id)
+	if ok {
+		return hash, true
+	}
+	stored, ok := source.database.GetHash(id)
+	if ok && stored.Fast != "" {
+		source.hashCache.Set(id, stored.Fast)
+		return stored.Fast, true
+	}
+	return "", false
+}
+
+// GetFileHash returns the fast content hash of a file, see fileHash
+func (source *Source) GetFileHash(id ImageId) (string, error) {
+	if hash, ok := source.GetStoredFileHash(id); ok {
+		return hash, nil
+	}
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return "", err
+	}
+	hash, err := fileHash(path, source.ContentHash.PrefixSize)
+	if err != nil {
+		return "", err
+	}
+	source.hashCache.Set(id, hash)
+	return hash, nil
+}
+
+// ETag returns a strong entity tag of the file at path with the provided
+// info. It is the SHA-256 or if missing the fast content hash of the
+// indexed file and its modification time, or its size and modification
+// time if the file was not hashed or changed in size since. The
+// modification time is included as files modified in place keep their
+// size and stored hash until they are hashed again.
+func (source *Source) ETag(path string, info fs.FileInfo) string {
+	modified := info.ModTime().UnixNano()
+	if id, ok := source.database.GetIdFromPath(path); ok {
+		hash, ok := source.database.GetHash(id)
+		if size, sized := hashSize(hash.Fast); ok && sized && size == info.Size() {
+			if hash.Sha256 != "" {
+				return fmt.Sprintf(`"%s-%x"`, hash.Sha256, modified)
+			}
+			return fmt.Sprintf(`"%s-%x"`, hash.Fast, modified)
+		}
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), modified)
+}
+
+// findMovedFile returns a previously indexed file with the same contents as
+// the provided hash, if it no longer exists at its original path
+func (source *Source) findMovedFile(hash ContentHash, claimed map[ImageId]struct{}) (IdPath, bool) {
+	for _, ip := range source.database.ListIdPathsByHash(hash.Fast) {
+		if _, ok := claimed[ip.Id]; ok {
+			continue
+		}
+		if hash.Sha256 != "" && ip.Hash.Sha256 != "" && hash.Sha256 != ip.Hash.Sha256 {
+			continue
+		}
+		if _, err := archive.Stat(ip.Path); !os.IsNotExist(err) {
+			continue
+		}
+		return ip, true
+	}
+	return IdPath{}, false
+}
+
+// pathBatch collects newly found files, so that they are appended to the
+// database with a single write instead of one write each
+type pathBatch struct {
+	database Store
+	size     int
+	paths    []NewPath
+	// Fast hashes of the collected files, as they cannot be found in the
+	// database until appended
+	hashes map[string]struct{}
+}
+
+func newPathBatch(database Store, size int) *pathBatch {
+	return &pathBatch{
+		database: database,
+		size:     max(1, size),
+		hashes:   make(map[string]struct{}),
+	}
+}
+
+func (b *pathBatch) append(path string, hash ContentHash) {
+	if b.size == 1 {
+		b.database.AppendPathWithHash(path, hash)
+		return
+	}
+	b.paths = append(b.paths, NewPath{Path: path, Hash: hash})
+	if hash.Fast != "" {
+		b.hashes[hash.Fast] = struct{}{}
+	}
+	if len(b.paths) >= b.size {
+		b.flush()
+	}
+}
+
+// pending returns true if a collected file has the provided fast hash
+func (b *pathBatch) pending(hash string) bool {
+	_, ok := b.hashes[hash]
+	return ok
+}
+
+func (b *pathBatch) flush() {
+	if len(b.paths) == 0 {
+		return
+	}
+	b.database.AppendPaths(b.paths)
+	b.paths = nil
+	clear(b.hashes)
+}
+
+// indexNewFile adds a newly found file to the database, or in case it was
+// moved or renamed, updates the path of the existing file, so that it keeps
+// its id and everything that refers to it (tags, embeddings, thumbnails).
+// Only the fast hash is needed to find moved files, so it returns true if
+// the SHA-256 hash of the file is still missing and is to be queued.
+func (source *Source) indexNewFile(path string, claimed map[ImageId]struct{}, batch *pathBatch) bool {
+	if !source.ContentHash.Enable {
+		batch.append(path, ContentHash{})
+		return false
+	}
+
+	hash, err := source.hashFile(path, false)
+	if err != nil {
+		indexLog.Error("unable to hash", "path", path, "err", err)
+		batch.append(path, ContentHash{})
+		return false
+	}
+
+	moved, ok := source.findMovedFile(hash, claimed)
+	if ok {
+		indexLog.Info("moved", "from", moved.Path, "to", path)
+		claimed[moved.Id] = struct{}{}
+		source.database.Move(moved.Id, path)
+		source.database.WriteHash(moved.Id, hash)
+		source.pathCache.Delete(moved.Id)
+		return source.ContentHash.Sha256 && hash.Sha256 == "" && moved.Hash.Sha256 == ""
+	}
+
+	// Duplicates of files still in the batch are only found once appended
+	if batch.pending(hash.Fast) {
+		batch.flush()
+		source.database.Flush()
+	}
+	if duplicates := source.findDuplicates(hash); len(duplicates) > 0 {
+		source.database.Publish([]Event{{
+			Type:       EventDuplicateFound,
+			Time:       time.Now(),
+			Path:       path,
+			Duplicates: duplicates,
+		}})
+	}
+
+	batch.append(path, hash)
+	source.sidecars.changed(path)
+	return source.ContentHash.Sha256 && hash.Sha256 == ""
+}
+
+// findDuplicates returns the previously indexed files with the same contents
+// as the provided hash that still exist
+func (source *Source) findDuplicates(hash ContentHash) []IdPath {
+	var duplicates []IdPath
+	for _, ip := range source.database.ListIdPathsByHash(hash.Fast) {
+		if hash.Sha256 != "" && ip.Hash.Sha256 != "" && hash.Sha256 != ip.Hash.Sha256 {
+			continue
+		}
+		if _, err := archive.Stat(ip.Path); err != nil {
+			continue
+		}
+		duplicates = append(duplicates, ip)
+	}
+	return duplicates
+}
+
+// indexFileHash stores the hash of an already indexed file, e.g. one indexed
+// before content hashes were supported
+func (source *Source) indexFileHash(ip IdPath) {
+	if !source.ContentHash.Enable {
+		return
+	}
+	hash, err := source.hashFile(ip.Path, true)
+	if err != nil {
+		indexLog.Error("unable to hash", "path", ip.Path, "err", err)
+		return
+	}
+	source.database.WriteHash(ip.Id, hash)
+	source.hashCache.Set(ip.Id, hash.Fast)
+	source.sidecars.changed(ip.Path)
+}
+
+// hashStale returns true if the indexed file is missing any of the enabled
+// hashes, or changed in size or modification time since it was hashed.
+// Files within archives are only hashed once, as they are not modified in
+// place.
+func (source *Source) hashStale(ip IdPath) bool {
+	if !source.ContentHash.Enable {
+		return false
+	}
+	if ip.Hash.Fast == "" || (source.ContentHash.Sha256 && ip.Hash.Sha256 == "") {
+		return true
+	}
+	if archive.IsVirtual(ip.Path) {
+		return false
+	}
+	info, err := os.Stat(ip.Path)
+	if err != nil {
+		return false
+	}
+	size, ok := hashSize(ip.Hash.Fast)
+	return !ok || size != info.Size() || info.ModTime().Unix() != ip.Hash.Modified.Unix()
+}
+
+// hashFiles hashes the queued files off the walk, see indexFileHash
+func (source *Source) hashFiles(in <-chan interface{}) {
+	for elem := range in {
+		source.indexFileHash(elem.(IdPath))
+	}
+}
+
+// queueHashes queues the files to be hashed by hashFiles
+func (source *Source) queueHashes(ips []IdPath) {
+	if len(ips) == 0 {
+		return
+	}
+	items := make(chan interface{}, len(ips))
+	for _, ip := range ips {
+		items <- ip
+	}
+	close(items)
+	source.hashQueue.AppendItems(items)
+}
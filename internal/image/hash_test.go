@@ -0,0 +1,53 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(path, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	fast, err := fileHash(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &Source{}
+	source.ContentHash.Enable = true
+	cases := []struct {
+		name   string
+		hash   ContentHash
+		sha256 bool
+		stale  bool
+	}{
+		{"hashed", ContentHash{Fast: fast, Modified: modified}, false, false},
+		{"not hashed", ContentHash{}, false, true},
+		{"missing sha256", ContentHash{Fast: fast, Modified: modified}, true, true},
+		{"modified", ContentHash{Fast: fast, Modified: modified.Add(-time.Hour)}, false, true},
+		{"resized", ContentHash{Fast: "4-0000000000000000", Modified: modified}, false, true},
+		// Hashed before modification times were stored
+		{"unknown modification", ContentHash{Fast: fast}, false, true},
+	}
+	for _, c := range cases {
+		source.ContentHash.Sha256 = c.sha256
+		stale := source.hashStale(IdPath{Id: 1, Path: path, Hash: c.hash})
+		if stale != c.stale {
+			t.Errorf("%s: expected stale %v, got %v", c.name, c.stale, stale)
+		}
+	}
+
+	source.ContentHash.Enable = false
+	if source.hashStale(IdPath{Id: 1, Path: path}) {
+		t.Errorf("expected no hashing if disabled")
+	}
+}
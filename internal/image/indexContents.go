@@ -3,15 +3,46 @@ package image
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	goio "io"
-	"log"
 	"photofield/internal/clip"
 	"photofield/io"
+	"sort"
 	"time"
 )
 
+// readEstimator is implemented by sources measuring their latency
+type readEstimator interface {
+	GetReadEstimate() (time.Duration, bool)
+}
+
+// thumbnailSourcesByLatency returns the thumbnail sources ordered by their
+// measured time per thumbnail read, with the ones not measured yet first
+// in their configured order, so that they are measured as well
+func (source *Source) thumbnailSourcesByLatency() []io.ReadDecoder {
+	type measured struct {
+		src io.ReadDecoder
+		d   time.Duration
+	}
+	ms := make([]measured, len(source.thumbnailSources))
+	for i, src := range source.thumbnailSources {
+		ms[i].src = src
+		if e, ok := src.(readEstimator); ok {
+			ms[i].d, _ = e.GetReadEstimate()
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].d < ms[j].d
+	})
+	srcs := make([]io.ReadDecoder, len(ms))
+	for i, m := range ms {
+		srcs[i] = m.src
+	}
+	return srcs
+}
+
 func (source *Source) indexContents(in <-chan interface{}) {
 	ctx := context.TODO()
 	for elem := range in {
@@ -25,14 +56,15 @@ func (source *Source) indexContents(in <-chan interface{}) {
 		path := m.Path
 
 		done := false
-		for _, src := range source.thumbnailSources {
+		for _, src := range source.thumbnailSourcesByLatency() {
 			src.Reader(ctx, id, path, func(rs goio.ReadSeeker, err error) {
 				if err != nil {
 					return
 				}
 
 				// log.Printf("index contents source %s path %s\n", src.(io.Source).Name(), path)
-				source.indexContentsReader(ctx, m, src, nil, rs)
+				colorErr, embeddingErr := source.indexContentsReader(ctx, m, src, nil, rs)
+				source.logContentsErrors(m, colorErr, embeddingErr)
 				done = true
 			})
 			if done {
@@ -45,30 +77,50 @@ func (source *Source) indexContents(in <-chan interface{}) {
 			// log.Printf("index contents generate %s\n", path)
 			img, rs, err := source.indexContentsGenerate(ctx, id, path)
 			if err != nil {
-				log.Println("Unable to generate image thumbnail", err)
+				indexLog.Error("unable to generate image thumbnail", "err", err)
+				source.quarantineGenerate(m.Id, path, err)
 				continue
 			}
-			source.indexContentsReader(ctx, m, nil, img, rs)
+			colorErr, embeddingErr := source.indexContentsReader(ctx, m, nil, img, rs)
+			source.logContentsErrors(m, colorErr, embeddingErr)
 		}
 	}
 }
 
-func (source *Source) indexContentsReader(ctx context.Context, m MissingInfo, src io.ReadDecoder, img image.Image, rs goio.ReadSeeker) {
-	var err error
+// quarantineGenerate quarantines the file if generating its thumbnail
+// failed because it is corrupt
+func (source *Source) quarantineGenerate(id ImageId, path string, err error) bool {
+	var gerr *generateError
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	return source.quarantineIfCorrupt(id, path, QuarantineThumbnail, gerr.errs...)
+}
+
+func (source *Source) logContentsErrors(m MissingInfo, colorErr error, embeddingErr error) {
+	if colorErr != nil {
+		indexLog.Error("unable to extract image color", "err", colorErr, "path", m.Path)
+	}
+	if embeddingErr != nil && embeddingErr != clip.ErrNotAvailable {
+		indexLog.Error("unable to get image embedding", "err", embeddingErr, "path", m.Path)
+	}
+}
+
+// indexContentsReader extracts the color and the AI embedding of the image
+// if missing, from the decoded image or the encoded thumbnail. The embedding
+// error is clip.ErrNotAvailable if AI is not configured.
+func (source *Source) indexContentsReader(ctx context.Context, m MissingInfo, src io.ReadDecoder, img image.Image, rs goio.ReadSeeker) (colorErr error, embeddingErr error) {
 	if m.Color {
 		// Decode image if needed
 		if img == nil && rs != nil {
-			img, err = source.indexContentsDecode(ctx, src, rs)
-			if err != nil {
-				log.Println("Unable to decode image thumbnail", err)
-			}
+			img, colorErr = source.indexContentsDecode(ctx, src, rs)
 		}
 
 		// Extract colors
 		if img != nil {
 			color, err := extractProminentColor(img)
 			if err != nil {
-				log.Println("Unable to extract image color", err, m.Path)
+				colorErr = err
 			} else {
 				info := Info{}
 				info.SetColorRGBA(color)
@@ -81,17 +133,26 @@ func (source *Source) indexContentsReader(ctx context.Context, m MissingInfo, sr
 	// Extract AI embedding
 	if m.Embedding && rs != nil {
 		embedding, err := source.Clip.EmbedImageReader(rs)
-		if err != clip.ErrNotAvailable {
-			if err != nil {
-				fmt.Println("Unable to get image embedding", err, m.Path)
-			} else {
-				source.database.WriteAI(m.Id, embedding)
-			}
+		if err != nil {
+			embeddingErr = err
+			embedding = nil
+		} else {
+			source.database.WriteAI(m.Id, embedding)
+			source.autoApplyTags(m.Id, embedding)
+			source.flagNsfw(m.Id, embedding)
+		}
+		// Also without AI, as screenshots are recognized by name as well
+		if source.Kinds.Detect {
+			source.indexKind(m.Id, m.Path, source.GetInfo(m.Id), embedding)
 		}
 	}
+	return
 }
 
 func (source *Source) indexContentsGenerate(ctx context.Context, id io.ImageId, path string) (image.Image, *bytes.Reader, error) {
+	if len(source.thumbnailGenerators) == 0 {
+		return nil, nil, fmt.Errorf("no thumbnail generators configured: %s", path)
+	}
 	errs := make([]error, 0)
 	for _, gen := range source.thumbnailGenerators {
 		// Generate thumbnail
@@ -113,11 +174,28 @@ func (source *Source) indexContentsGenerate(ctx context.Context, id io.ImageId,
 		return r.Image, rd, nil
 	}
 
-	e := ""
-	for _, err := range errs {
-		e += err.Error() + " "
+	return nil, nil, &generateError{path: path, errs: errs}
+}
+
+// generateError is returned if all thumbnail generators failed, with the
+// error of each
+type generateError struct {
+	path string
+	errs []error
+}
+
+func (e *generateError) Error() string {
+	msg := ""
+	for _, err := range e.errs {
+		if err != nil {
+			msg += err.Error() + " "
+		}
 	}
-	return nil, nil, fmt.Errorf("all generators failed: %s: %s", e, path)
+	return fmt.Sprintf("all generators failed: %s: %s", msg, e.path)
+}
+
+func (e *generateError) Unwrap() []error {
+	return e.errs
 }
 
 func (source *Source) indexContentsDecode(ctx context.Context, d io.Decoder, rs goio.ReadSeeker) (image.Image, error) {
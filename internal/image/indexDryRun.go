@@ -0,0 +1,86 @@
+package image
+
+// IndexChanges counts the files of one kind of change found by a dry run,
+// with the paths of the first few as samples
+type IndexChanges struct {
+	Count   int
+	Samples []string
+}
+
+func (c *IndexChanges) add(path string, samples int) {
+	c.Count++
+	if len(c.Samples) < samples {
+		c.Samples = append(c.Samples, path)
+	}
+}
+
+// IndexReport lists what indexing the dirs of a collection would change
+type IndexReport struct {
+	// Files found with a listed extension and not ignored
+	Found int
+	// Files found that are not indexed yet
+	Added IndexChanges
+	// Indexed files that were not found anymore, including moved ones that
+	// would be matched to their new paths by their contents
+	Removed IndexChanges
+	// Indexed files without a content hash, which would be hashed again
+	Rehashed IndexChanges
+	// Indexed files found again missing metadata, which would be read again
+	Metadata IndexChanges
+	// Indexed files found again missing a thumbnail, color or embedding,
+	// which would be processed again
+	Contents IndexChanges
+}
+
+// DryRunIndex walks the dirs like IndexFiles followed by IndexMetadata and
+// IndexContents would, but only reports what they would add, remove and
+// process again without writing anything, e.g. to check the extensions and
+// ignore patterns of a huge library first.
+func (source *Source) DryRunIndex(dirs []string, max int, walk WalkConfig, ignore []string, samples int) IndexReport {
+	var report IndexReport
+	ignored := source.newIgnoreFilter(ignore)
+	ignoredDir := source.newIgnoreDirFilter(ignore)
+	extensions := append([]string{}, source.ListExtensions...)
+
+	source.database.WaitForCommit()
+	normalized := make([]string, len(dirs))
+	removed := make(map[ImageId]struct{})
+	for i, dir := range dirs {
+		dir = source.Paths.Normalize(dir)
+		normalized[i] = dir
+
+		existing := make(map[string]IdPath)
+		for ip := range source.database.ListIdPaths([]string{dir}, 0) {
+			existing[ip.Path] = ip
+		}
+
+		found := make(map[string]struct{})
+		for path := range walkFiles(dir, extensions, max, walk, ignored, ignoredDir) {
+			path = source.Paths.Normalize(path)
+			report.Found++
+			found[path] = struct{}{}
+			ip, exists := existing[path]
+			if !exists {
+				report.Added.add(path, samples)
+			} else if ip.Hash.Fast == "" {
+				report.Rehashed.add(path, samples)
+			}
+		}
+		for ip := range source.database.ListNonexistent(dir, found) {
+			report.Removed.add(ip.Path, samples)
+			removed[ip.Id] = struct{}{}
+		}
+	}
+
+	for m := range source.ListMissingMetadata(append([]string{}, normalized...), max, Missing{}) {
+		if _, ok := removed[m.Id]; !ok {
+			report.Metadata.add(m.Path, samples)
+		}
+	}
+	for m := range source.ListMissingContents(append([]string{}, normalized...), max, Missing{}) {
+		if _, ok := removed[m.Id]; !ok {
+			report.Contents.add(m.Path, samples)
+		}
+	}
+	return report
+}
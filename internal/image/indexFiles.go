@@ -3,9 +3,9 @@ package image
 import (
 	"errors"
 	"fmt"
-	"log"
 	"path/filepath"
 	"photofield/internal/metrics"
+	"photofield/io/archive"
 	"strings"
 	"time"
 
@@ -14,21 +14,95 @@ import (
 
 var ErrSkip = errors.New("skipping the rest")
 
-func walkFiles(dir string, extensions []string, maxFiles int) <-chan string {
+func walkFiles(dir string, extensions []string, maxFiles int, config WalkConfig, ignored func(path string) bool, ignoredDir func(path string) bool) <-chan string {
 	out := make(chan string)
 	go func() {
 		finished := metrics.Elapsed(fmt.Sprintf("index %s", dir))
 		defer finished()
 
+		_, rootDev, rootDevOk := getFileKey(dir)
+		visited := make(map[interface{}]struct{})
+		ignores := make(ignoreFiles)
+
 		lastLogTime := time.Now()
 		files := 0
 		err := godirwalk.Walk(dir, &godirwalk.Options{
-			Unsorted: true,
+			Unsorted:            true,
+			FollowSymbolicLinks: config.FollowSymlinks,
 			Callback: func(path string, walk_dir *godirwalk.Dirent) error {
 				if strings.Contains(path, "@eaDir") {
 					return filepath.SkipDir
 				}
 
+				isDir := walk_dir.IsDir()
+				if config.FollowSymlinks && walk_dir.IsSymlink() {
+					isDir, _ = walk_dir.IsDirOrSymlinkToDir()
+				}
+
+				if ignores.ignored(path, isDir) {
+					if isDir {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+
+				if isDir {
+					if ignoredDir != nil && ignoredDir(path) {
+						return filepath.SkipDir
+					}
+					if hasNoMedia(path) {
+						indexLog.Debug("skipping dir with a .nomedia file", "path", path)
+						return filepath.SkipDir
+					}
+					key, dev, ok := getFileKey(path)
+					if !ok {
+						return nil
+					}
+					if _, seen := visited[key]; seen {
+						indexLog.Debug("skipping already indexed dir", "path", path)
+						return filepath.SkipDir
+					}
+					visited[key] = struct{}{}
+					if config.OneFilesystem && rootDevOk && dev != rootDev {
+						indexLog.Info("skipping dir on another filesystem", "path", path)
+						return filepath.SkipDir
+					}
+					ignores.load(path)
+					return nil
+				}
+
+				emit := func(path string) error {
+					if ignored != nil && ignored(path) {
+						return nil
+					}
+
+					files++
+					now := time.Now()
+					if now.Sub(lastLogTime) > 1*time.Second {
+						lastLogTime = now
+						indexLog.Info("indexing files", "dir", dir, "files", files)
+					}
+					out <- path
+					if maxFiles > 0 && files >= maxFiles {
+						return ErrSkip
+					}
+					return nil
+				}
+
+				if config.Archives && archive.IsArchive(path) {
+					paths, err := archive.List(path, extensions)
+					if err != nil {
+						indexLog.Error("error indexing archive", "path", path, "err", err)
+						return nil
+					}
+					for _, p := range paths {
+						if err := emit(p); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+
 				suffix := ""
 				for _, ext := range extensions {
 					if strings.HasSuffix(strings.ToLower(path), ext) {
@@ -40,21 +114,18 @@ func walkFiles(dir string, extensions []string, maxFiles int) <-chan string {
 					return nil
 				}
 
-				files++
-				now := time.Now()
-				if now.Sub(lastLogTime) > 1*time.Second {
-					lastLogTime = now
-					log.Printf("indexing %s %d files\n", dir, files)
-				}
-				out <- path
-				if maxFiles > 0 && files >= maxFiles {
-					return ErrSkip
+				return emit(path)
+			},
+			ErrorCallback: func(path string, err error) godirwalk.ErrorAction {
+				if err == ErrSkip {
+					return godirwalk.Halt
 				}
-				return nil
+				indexLog.Error("error indexing", "path", path, "err", err)
+				return godirwalk.SkipNode
 			},
 		})
 		if err != nil && err != ErrSkip {
-			log.Printf("Error indexing files: %s\n", err.Error())
+			indexLog.Error("error indexing files", "err", err)
 		}
 
 		close(out)
@@ -1,25 +1,64 @@
 package image
 
-import (
-	"fmt"
-)
-
 func (source *Source) indexMetadata(in <-chan interface{}) {
 	for elem := range in {
 		m := elem.(MissingInfo)
-		id := m.Id
-		path := m.Path
-
-		var info Info
-		tags, err := source.decoder.DecodeInfo(path, &info)
-		if err != nil {
-			fmt.Println("Unable to load image info meta", err, path)
-			continue
+		if err := source.indexMetadataFile(m.Id, m.Path); err != nil {
+			indexLog.Error("unable to load image info meta", "err", err, "path", m.Path)
+			source.quarantineIfCorrupt(m.Id, m.Path, QuarantineMetadata, err)
 		}
-		source.database.Write(path, info, UpdateMeta)
-		if source.Config.TagConfig.Exif.Enable {
-			source.database.WriteTags(id, tags)
+	}
+}
+
+// indexMetadataFile reads the metadata of the file from its sidecar or the
+// file itself and writes it to the database
+func (source *Source) indexMetadataFile(id ImageId, path string) error {
+	// Exif tags are not stored in sidecars
+	if !source.Config.TagConfig.Exif.Enable {
+		if f, ok := source.sidecars.lookup(path); ok && f.hasMeta() {
+			info, camera := f.info()
+			source.applyOrientationEdit(id, &info)
+			source.applyGeotag(id, &info)
+			source.database.WriteMeta(id, path, info, camera)
+			source.indexMedia(id, path)
+			source.indexPlaces(id, info.LatLng)
+			source.indexSystemTags(id, info)
+			source.imageInfoCache.Delete(id)
+			source.hashCache.Delete(id)
+			return nil
 		}
-		source.imageInfoCache.Delete(id)
 	}
+
+	var info Info
+	var camera Camera
+	tags, err := source.decoder.DecodeInfo(path, &info, &camera)
+	if err != nil {
+		return err
+	}
+	source.applyOrientationEdit(id, &info)
+	source.applyGeotag(id, &info)
+	source.database.WriteMeta(id, path, info, camera)
+	source.indexMedia(id, path)
+	source.indexPlaces(id, info.LatLng)
+	source.indexSystemTags(id, info)
+	if source.Config.TagConfig.Exif.Enable {
+		source.database.WriteTags(id, tags)
+	}
+	source.imageInfoCache.Delete(id)
+	source.hashCache.Delete(id)
+	source.sidecars.changed(path)
+	return nil
+}
+
+// indexMedia indexes the metadata of the file that is not stored with the
+// rest of its info, like the format of videos, voice memos recorded
+// alongside, motion photo videos, 360° projections, sidecar files and
+// embedded keywords
+func (source *Source) indexMedia(id ImageId, path string) {
+	source.indexVideo(id, path)
+	source.indexAudio(id, path)
+	source.indexMotionPhoto(id, path)
+	source.indexProjection(id, path)
+	source.indexSidecarFiles(id, path)
+	source.indexKeywords(id, path)
 }
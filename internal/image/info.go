@@ -19,6 +19,8 @@ type Info struct {
 	Color         uint32
 	Orientation   Orientation
 	LatLng        s2.LatLng
+	// Caption of the file, the edited one if there is one
+	Description string
 }
 
 const earthRadiusKm = 6371.01
@@ -144,6 +146,59 @@ func (orientation Orientation) Rotate270() Orientation {
 	}
 }
 
+// transform decomposes the orientation into an optional horizontal mirror
+// followed by a number of clockwise quarter turns
+func (orientation Orientation) transform() (mirror bool, turns int) {
+	switch orientation {
+	case MirrorHorizontal:
+		return true, 0
+	case Rotate180:
+		return false, 2
+	case MirrorVertical:
+		return true, 2
+	case MirrorHorizontalRotate270:
+		return true, 3
+	case Rotate90:
+		return false, 1
+	case MirrorHorizontalRotate90:
+		return true, 1
+	case Rotate270:
+		return false, 3
+	default:
+		return false, 0
+	}
+}
+
+func orientationFromTransform(mirror bool, turns int) Orientation {
+	turns = (turns%4 + 4) % 4
+	if mirror {
+		return [...]Orientation{MirrorHorizontal, MirrorHorizontalRotate90, MirrorVertical, MirrorHorizontalRotate270}[turns]
+	}
+	return [...]Orientation{Normal, Rotate90, Rotate180, Rotate270}[turns]
+}
+
+// Compose returns the orientation of applying the edit after the
+// orientation, e.g. Rotate90 composed with Rotate90 is Rotate180
+func (orientation Orientation) Compose(edit Orientation) Orientation {
+	mirror, turns := orientation.transform()
+	editMirror, editTurns := edit.transform()
+	if editMirror {
+		// Mirroring reverses the direction of the previous turns
+		turns = -turns
+	}
+	return orientationFromTransform(mirror != editMirror, turns+editTurns)
+}
+
+// Inverse returns the orientation undoing the orientation
+func (orientation Orientation) Inverse() Orientation {
+	mirror, turns := orientation.transform()
+	if mirror {
+		// Mirrored orientations are their own inverse
+		return orientation
+	}
+	return orientationFromTransform(false, -turns)
+}
+
 func (orientation Orientation) String() string {
 	switch orientation {
 	case Normal:
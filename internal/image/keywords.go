@@ -0,0 +1,72 @@
+package image
+
+import (
+	"io"
+
+	"photofield/io/archive"
+	"photofield/io/iptc"
+	"photofield/io/xmp"
+	"photofield/tag"
+)
+
+// readKeywords reads the IPTC keywords and XMP subjects embedded in the
+// file as tags, keeping the levels of hierarchical keywords
+func readKeywords(r io.ReadSeeker) ([]tag.Tag, error) {
+	var tags []tag.Tag
+	seen := make(map[string]struct{})
+	add := func(t tag.Tag) {
+		if t.Name == tag.KeywordPrefix {
+			return
+		}
+		if _, ok := seen[t.Name]; ok {
+			return
+		}
+		seen[t.Name] = struct{}{}
+		tags = append(tags, t)
+	}
+
+	keywords, err := iptc.ReadKeywords(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keywords {
+		add(tag.NewKeyword(k))
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	m, _, err := xmp.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range m.Keywords {
+		add(tag.NewKeyword(k))
+	}
+	for _, levels := range m.Hierarchical {
+		if len(levels) > 1 {
+			add(tag.NewKeyword(levels...))
+		}
+	}
+	return tags, nil
+}
+
+// indexKeywords tags the file with the keywords embedded in it, replacing
+// the keyword tags it had before
+func (source *Source) indexKeywords(id ImageId, path string) {
+	if !source.Config.TagConfig.Keywords.Enable || !source.IsSupportedImage(path) {
+		return
+	}
+	f, err := archive.Open(path)
+	if err != nil {
+		indexLog.Warn("unable to read keywords", "path", path, "err", err)
+		return
+	}
+	defer f.Close()
+	tags, err := readKeywords(f)
+	if err != nil {
+		indexLog.Warn("unable to read keywords", "path", path, "err", err)
+		return
+	}
+	source.replaceTags(id, tag.KeywordPrefix, tags)
+}
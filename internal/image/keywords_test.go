@@ -0,0 +1,44 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadKeywords(t *testing.T) {
+	// APP13 with a single IPTC keyword
+	iptc := []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00\x00\x00\x00\x0a\x1c\x02\x19\x00\x05Beach")
+	app13 := append([]byte{0xff, 0xed, 0, byte(len(iptc) + 2)}, iptc...)
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+	 <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:lr="http://ns.adobe.com/lightroom/1.0/">
+	  <dc:subject><rdf:Bag><rdf:li>beach</rdf:li><rdf:li>Old Town</rdf:li></rdf:Bag></dc:subject>
+	  <lr:hierarchicalSubject><rdf:Bag><rdf:li>Places|Spain|Old Town</rdf:li></rdf:Bag></lr:hierarchicalSubject>
+	 </rdf:Description>
+	</rdf:RDF></x:xmpmeta>`)
+	app1 := append([]byte{0xff, 0xe1, byte((len(xmp) + 31) >> 8), byte(len(xmp) + 31)}, "http://ns.adobe.com/xap/1.0/\x00"...)
+	app1 = append(app1, xmp...)
+
+	file := []byte{0xff, 0xd8}
+	file = append(file, app13...)
+	file = append(file, app1...)
+	file = append(file, 0xff, 0xda, 0, 2)
+
+	tags, err := readKeywords(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tg := range tags {
+		names = append(names, tg.Name)
+	}
+	expected := []string{"kw:beach", "kw:old-town", "kw:places:spain:old-town"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, names)
+			break
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package image
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/tag"
+)
+
+const (
+	KindScreenshot = "screenshot"
+	KindDocument   = "document"
+)
+
+// KindConfig configures the classification of files into screenshots and
+// scanned documents, tagged as kind:screenshot and kind:document
+type KindConfig struct {
+	// Classify new files as their contents are indexed
+	Detect bool `json:"detect"`
+	// Parts of the names of screenshots in lower case, e.g. "screenshot"
+	ScreenshotNames []string `json:"screenshot_names"`
+	// Texts the AI embeddings of the files are compared to for each kind
+	Prompts struct {
+		Screenshot string `json:"screenshot"`
+		Document   string `json:"document"`
+		Photo      string `json:"photo"`
+	} `json:"prompts"`
+	// Minimum confidence between 0 and 1 of the AI embedding of a file
+	// matching a kind, halved for files shaped like one
+	MinConfidence float32 `json:"min_confidence"`
+	// Tags of the files left out of memories and the highlights and
+	// timeline layouts unless searched for by tag, e.g. kind:screenshot
+	Hide []string `json:"hide"`
+}
+
+// Aspect ratios of paper sheets, A4 and US letter
+var paperAspects = []float64{math.Sqrt2, 11 / 8.5}
+
+// Shortest aspect ratio of phone screens, which are taller than the 16:9 of
+// camera sensors, e.g. 19.5:9
+const minPhoneAspect = 1.9
+
+// kindHints is what the metadata of a file tells about its kind
+type kindHints struct {
+	// Named like a screenshot, e.g. "Screenshot 2023-05-01.png"
+	ScreenshotName bool
+	// Taken with a camera according to its metadata
+	Camera bool
+	// Shaped like a phone screen or a lossless PNG
+	Screen bool
+	// Shaped like a sheet of paper
+	Paper bool
+}
+
+func (config KindConfig) hints(path string, info Info, camera bool) kindHints {
+	name := strings.ToLower(filepath.Base(path))
+	h := kindHints{Camera: camera}
+	for _, n := range config.ScreenshotNames {
+		if n != "" && strings.Contains(name, n) {
+			h.ScreenshotName = true
+			break
+		}
+	}
+	if info.Width > 0 && info.Height > 0 {
+		aspect := float64(max(info.Width, info.Height)) / float64(min(info.Width, info.Height))
+		h.Screen = aspect >= minPhoneAspect
+		for _, a := range paperAspects {
+			if math.Abs(aspect-a) < 0.02 {
+				h.Paper = true
+			}
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		h.Screen = true
+	}
+	return h
+}
+
+// classifyKind returns the kind of the file, empty if it is a photo. The
+// confidences are those of the screenshot, document and photo prompts, nil
+// if the file has no AI embedding, in which case only files named like
+// screenshots are classified.
+func classifyKind(h kindHints, confidences []float32, minConfidence float32) string {
+	if h.ScreenshotName {
+		return KindScreenshot
+	}
+	if confidences == nil {
+		return ""
+	}
+	screenshot, document := confidences[0], confidences[1]
+	// Screens photographed with a camera are photos
+	if !h.Camera && screenshot >= document {
+		if screenshot >= minConfidence || h.Screen && screenshot >= minConfidence/2 {
+			return KindScreenshot
+		}
+	}
+	if document >= minConfidence || h.Paper && document >= minConfidence/2 {
+		return KindDocument
+	}
+	return ""
+}
+
+func (source *Source) getKindPrompts() ([]clip.Embedding, error) {
+	p := source.Kinds.Prompts
+	return source.kindPrompts.get(source.Clip, []string{p.Screenshot, p.Document, p.Photo})
+}
+
+// indexKind tags the file with its kind, replacing the kind tag it had
+// before. The embedding is read from the database if nil.
+func (source *Source) indexKind(id ImageId, path string, info Info, embedding clip.Embedding) {
+	config := source.Kinds
+	_, camera := source.database.GetFileCamera(id)
+	h := config.hints(path, info, camera)
+
+	if embedding == nil {
+		embedding, _ = source.database.GetImageEmbedding(id)
+	}
+	var confidences []float32
+	if embedding != nil && source.AI.Available() {
+		prompts, err := source.getKindPrompts()
+		if err == nil {
+			confidences, err = classify(embedding, prompts)
+		}
+		if err != nil {
+			indexLog.Error("unable to classify kind", "id", id, "err", err)
+			confidences = nil
+		}
+	}
+
+	var tags []tag.Tag
+	if kind := classifyKind(h, confidences, config.MinConfidence); kind != "" {
+		tags = append(tags, tag.NewKind(kind))
+	}
+	source.replaceTags(id, tag.KindPrefix, tags)
+}
+
+// DetectKinds queues the files in the dirs to be classified into
+// screenshots and documents
+func (source *Source) DetectKinds(dirs []string) {
+	normalized := make([]string, len(dirs))
+	for i := range dirs {
+		normalized[i] = source.Paths.Normalize(dirs[i])
+	}
+	out := make(chan interface{}, 1)
+	out <- strings.Join(normalized, "\n")
+	close(out)
+	source.kindQueue.AppendItems(out)
+}
+
+func (source *Source) detectKinds(in <-chan interface{}) {
+	for elem := range in {
+
+		for source.contentsQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		dirs := strings.Split(elem.(string), "\n")
+		count := 0
+		for info := range source.ListInfos(dirs, ListOptions{}) {
+			path, ok := source.database.GetPathFromId(info.Id)
+			if !ok {
+				continue
+			}
+			source.indexKind(info.Id, path, info.Info, nil)
+			count++
+		}
+		indexLog.Info("detected kinds", "files", count)
+	}
+}
@@ -0,0 +1,56 @@
+package image
+
+import "testing"
+
+func TestKindHints(t *testing.T) {
+	config := KindConfig{ScreenshotNames: []string{"screenshot", "bildschirmfoto"}}
+	tests := []struct {
+		name   string
+		path   string
+		info   Info
+		camera bool
+		want   kindHints
+	}{
+		{"named", "/a/Screenshot 2023-05-01 at 10.00.00.jpg", Info{Width: 1920, Height: 1080}, false, kindHints{ScreenshotName: true}},
+		{"named other language", "/a/Bildschirmfoto.jpg", Info{}, false, kindHints{ScreenshotName: true}},
+		{"phone", "/a/IMG_0001.jpg", Info{Width: 1170, Height: 2532}, false, kindHints{Screen: true}},
+		{"png", "/a/image.PNG", Info{Width: 800, Height: 600}, false, kindHints{Screen: true}},
+		{"a4", "/a/scan.jpg", Info{Width: 2480, Height: 3508}, false, kindHints{Paper: true}},
+		{"letter", "/a/scan.jpg", Info{Width: 2550, Height: 3300}, false, kindHints{Paper: true}},
+		{"camera", "/a/DSC_0001.jpg", Info{Width: 6000, Height: 4000}, true, kindHints{Camera: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.hints(tt.path, tt.info, tt.camera)
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyKind(t *testing.T) {
+	tests := []struct {
+		name        string
+		hints       kindHints
+		confidences []float32
+		want        string
+	}{
+		{"named", kindHints{ScreenshotName: true, Camera: true}, nil, KindScreenshot},
+		{"no embedding", kindHints{Screen: true}, nil, ""},
+		{"screenshot", kindHints{}, []float32{0.8, 0.1, 0.1}, KindScreenshot},
+		{"screen shaped", kindHints{Screen: true}, []float32{0.4, 0.1, 0.5}, KindScreenshot},
+		{"unsure", kindHints{}, []float32{0.4, 0.1, 0.5}, ""},
+		{"photographed screen", kindHints{Camera: true}, []float32{0.9, 0.05, 0.05}, ""},
+		{"document", kindHints{Camera: true}, []float32{0.1, 0.8, 0.1}, KindDocument},
+		{"paper shaped", kindHints{Paper: true}, []float32{0.1, 0.4, 0.5}, KindDocument},
+		{"photo", kindHints{}, []float32{0.1, 0.1, 0.8}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyKind(tt.hints, tt.confidences, 0.6); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
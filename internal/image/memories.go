@@ -0,0 +1,90 @@
+package image
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Memory is a file taken on the same calendar day in an earlier year
+type Memory struct {
+	SourcedInfo
+	YearsAgo int
+}
+
+// OnThisDay lists the files in the dirs taken on the calendar day of the
+// date in earlier years, sorted by date, leaving out the private ones and
+// the kinds hidden from memories
+func (source *Source) OnThisDay(dirs []string, date time.Time) []SourcedInfo {
+	options := ListOptions{
+		OrderBy: DateAsc,
+		Hide:    append(append([]string(nil), source.Private.Tags...), source.Kinds.Hide...),
+	}
+	var infos []SourcedInfo
+	for info := range source.ListInfos(dirs, options) {
+		if isOnThisDay(info.DateTime, date) {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// isOnThisDay reports whether t was taken on the calendar day of the date in
+// an earlier year, in the time zone it was taken in. Files without metadata
+// yet have the unix epoch as their date and are left out.
+func isOnThisDay(t time.Time, date time.Time) bool {
+	if t.IsZero() || t.Unix() == 0 || t.Year() >= date.Year() {
+		return false
+	}
+	return t.Month() == date.Month() && t.Day() == date.Day()
+}
+
+// PickMemories picks up to limit of the files taken on this day, spread
+// evenly across the years. The selection is stable for the date and rotates
+// from day to day. The picked files are sorted by how many years ago they
+// were taken and then by date.
+func PickMemories(infos []SourcedInfo, date time.Time, limit int) []Memory {
+	rnd := rand.New(rand.NewSource(int64(date.Year()*1000 + date.YearDay())))
+
+	byYear := make(map[int][]SourcedInfo)
+	var years []int
+	for _, info := range infos {
+		year := info.DateTime.Year()
+		if _, ok := byYear[year]; !ok {
+			years = append(years, year)
+		}
+		byYear[year] = append(byYear[year], info)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(years)))
+	for _, year := range years {
+		files := byYear[year]
+		rnd.Shuffle(len(files), func(i, j int) {
+			files[i], files[j] = files[j], files[i]
+		})
+	}
+
+	if limit <= 0 || limit > len(infos) {
+		limit = len(infos)
+	}
+	memories := make([]Memory, 0, limit)
+	for round := 0; len(memories) < limit; round++ {
+		for _, year := range years {
+			files := byYear[year]
+			if round >= len(files) || len(memories) >= limit {
+				continue
+			}
+			memories = append(memories, Memory{
+				SourcedInfo: files[round],
+				YearsAgo:    date.Year() - year,
+			})
+		}
+	}
+
+	sort.SliceStable(memories, func(i, j int) bool {
+		if memories[i].YearsAgo != memories[j].YearsAgo {
+			return memories[i].YearsAgo < memories[j].YearsAgo
+		}
+		return memories[i].DateTime.Before(memories[j].DateTime)
+	})
+	return memories
+}
@@ -0,0 +1,64 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsOnThisDay(t *testing.T) {
+	date := time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+	plus2 := time.FixedZone("tz_offset", 2*60*60)
+	cases := []struct {
+		t  time.Time
+		ok bool
+	}{
+		{time.Date(2020, 5, 10, 23, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 5, 10, 7, 0, 0, 0, time.UTC), false},
+		{time.Date(2020, 5, 11, 0, 30, 0, 0, plus2), false},
+		{time.Date(2020, 5, 10, 0, 30, 0, 0, plus2), true},
+		{time.Date(2020, 6, 10, 12, 0, 0, 0, time.UTC), false},
+		{time.Time{}, false},
+	}
+	for _, c := range cases {
+		if ok := isOnThisDay(c.t, date); ok != c.ok {
+			t.Errorf("%v: expected %v, got %v", c.t, c.ok, ok)
+		}
+	}
+	if isOnThisDay(time.Unix(0, 0).UTC(), time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected files without a date to be left out")
+	}
+}
+
+func TestPickMemories(t *testing.T) {
+	date := time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+	var infos []SourcedInfo
+	for year, count := range map[int]int{2019: 6, 2021: 1, 2023: 4} {
+		for i := 0; i < count; i++ {
+			info := SourcedInfo{Id: ImageId(year*10 + i)}
+			info.DateTime = time.Date(year, 5, 10, 10+i, 0, 0, 0, time.UTC)
+			infos = append(infos, info)
+		}
+	}
+
+	memories := PickMemories(infos, date, 5)
+	years := make(map[int]int)
+	for i, m := range memories {
+		years[m.YearsAgo]++
+		if i > 0 && m.YearsAgo < memories[i-1].YearsAgo {
+			t.Errorf("expected sorted by years ago, got %d after %d", m.YearsAgo, memories[i-1].YearsAgo)
+		}
+	}
+	if expected := map[int]int{1: 2, 3: 1, 5: 2}; !reflect.DeepEqual(years, expected) {
+		t.Errorf("expected %v per years ago, got %v", expected, years)
+	}
+
+	again := PickMemories(infos, date, 5)
+	if !reflect.DeepEqual(memories, again) {
+		t.Errorf("expected the same pick for the same day")
+	}
+
+	if all := PickMemories(infos, date, 0); len(all) != len(infos) {
+		t.Errorf("expected all %d without a limit, got %d", len(infos), len(all))
+	}
+}
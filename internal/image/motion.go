@@ -0,0 +1,91 @@
+package image
+
+import (
+	goio "io"
+	"time"
+
+	"photofield/io/archive"
+	"photofield/io/motion"
+)
+
+// MotionPhoto is the location of the short video embedded in a motion
+// photo after the still image
+type MotionPhoto struct {
+	Offset int64
+	Length int64
+}
+
+// indexMotionPhoto detects whether the image is a motion photo and stores
+// the location of its video
+func (source *Source) indexMotionPhoto(id ImageId, path string) {
+	if !source.IsSupportedImage(path) {
+		return
+	}
+	v, found, err := findMotionVideo(path)
+	if err != nil {
+		indexLog.Warn("unable to detect motion photo", "path", path, "err", err)
+		return
+	}
+	if !found {
+		if _, ok := source.database.GetMotionPhoto(id); ok {
+			source.database.WriteMotionPhoto(id, MotionPhoto{})
+		}
+		return
+	}
+	source.database.WriteMotionPhoto(id, MotionPhoto{
+		Offset: v.Offset,
+		Length: v.Length,
+	})
+}
+
+func findMotionVideo(path string) (motion.Video, bool, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return motion.Video{}, false, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return motion.Video{}, false, err
+	}
+	r, ok := f.(goio.ReaderAt)
+	if !ok {
+		return motion.Video{}, false, nil
+	}
+	return motion.Find(r, stat.Size())
+}
+
+// GetMotionPhoto returns the location of the video embedded in the motion
+// photo, false if it is not one
+func (source *Source) GetMotionPhoto(id ImageId) (MotionPhoto, bool) {
+	return source.database.GetMotionPhoto(id)
+}
+
+// OpenMotionVideo opens the video embedded in the motion photo, along with
+// the time the file was modified. The returned closer closes the file.
+func (source *Source) OpenMotionVideo(id ImageId) (goio.ReadSeeker, time.Time, goio.Closer, error) {
+	m, ok := source.database.GetMotionPhoto(id)
+	if !ok {
+		return nil, time.Time{}, nil, ErrNotFound
+	}
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	f, err := archive.Open(path)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, nil, err
+	}
+	r, ok := f.(goio.ReaderAt)
+	if !ok || m.Offset+m.Length > stat.Size() {
+		// Changed since it was indexed
+		f.Close()
+		return nil, time.Time{}, nil, ErrNotFound
+	}
+	return goio.NewSectionReader(r, m.Offset, m.Length), stat.ModTime(), f, nil
+}
@@ -0,0 +1,344 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	goio "io"
+	"math"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/io"
+)
+
+type OrientationConfig struct {
+	// Detect the orientation of new files after indexing collections
+	Detect bool `json:"detect"`
+	// Text the rotated images are compared against using the AI server
+	Prompt string `json:"prompt"`
+	// Minimum confidence between 0 and 1 of a rotation to be proposed
+	MinConfidence float32 `json:"min_confidence"`
+	// Audit the orientation of files displayed sideways compared to their
+	// stored dimensions
+	Verify bool `json:"verify"`
+}
+
+type OrientationStatus string
+
+const (
+	OrientationPending  OrientationStatus = "pending"
+	OrientationAccepted OrientationStatus = "accepted"
+	OrientationRejected OrientationStatus = "rejected"
+	// Detected as upright or not confident enough to propose a rotation
+	OrientationNone OrientationStatus = "none"
+)
+
+// OrientationProposal is a detected rotation of a file without orientation
+// metadata, e.g. a scanned photo, applied as an edit if accepted
+type OrientationProposal struct {
+	Id          ImageId
+	Orientation Orientation
+	Confidence  float32
+	Status      OrientationStatus
+	CreatedAt   time.Time
+}
+
+// GetOrientationEdit returns the rotation or flip applied on top of the
+// orientation of the file, Normal if the file was not edited
+func (source *Source) GetOrientationEdit(id ImageId) Orientation {
+	edit, ok := source.orientationEdits.Load(id)
+	if !ok {
+		return Normal
+	}
+	return edit.(Orientation)
+}
+
+// SetOrientationEdit applies the edit on top of the orientation of the
+// file, replacing any previous edit. The file itself is not modified and
+// setting the edit to Normal reverts it.
+func (source *Source) SetOrientationEdit(id ImageId, edit Orientation) error {
+	if edit.IsZero() {
+		edit = Normal
+	}
+	if edit < Normal || edit > Rotate270 {
+		return fmt.Errorf("invalid orientation %d", edit)
+	}
+	if _, ok := source.database.GetPathFromId(id); !ok {
+		return ErrNotFound
+	}
+	err := source.database.WriteOrientationEdit(id, edit)
+	if err != nil {
+		return err
+	}
+	if edit == Normal {
+		source.orientationEdits.Delete(id)
+	} else {
+		source.orientationEdits.Store(id, edit)
+	}
+	source.imageInfoCache.Delete(id)
+	return nil
+}
+
+// editDelta returns the rotation or flip that replacing the previous edit
+// with the new one applies on top of it, as proposals are composed with
+// the previous edit when accepted
+func editDelta(previous Orientation, edit Orientation) Orientation {
+	return previous.Inverse().Compose(edit)
+}
+
+// applyOrientationEdit applies the edit of the file to freshly decoded
+// metadata, so that edits survive rescanning
+func (source *Source) applyOrientationEdit(id ImageId, info *Info) {
+	edit := source.GetOrientationEdit(id)
+	if edit == Normal {
+		return
+	}
+	info.Orientation = info.Orientation.Compose(edit)
+	if edit.SwapsDimensions() {
+		info.Width, info.Height = info.Height, info.Width
+	}
+}
+
+func (source *Source) ListOrientationProposals(dirs []string, limit int) []OrientationProposal {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	return source.database.ListOrientationProposals(dirs, limit)
+}
+
+// AcceptOrientationProposals applies the pending proposals of the files as
+// edits, returning the accepted proposals
+func (source *Source) AcceptOrientationProposals(ids []ImageId) ([]OrientationProposal, error) {
+	accepted := make([]OrientationProposal, 0, len(ids))
+	for _, id := range ids {
+		p, ok := source.database.GetOrientationProposal(id)
+		if !ok || p.Status != OrientationPending {
+			continue
+		}
+		edit := source.GetOrientationEdit(id).Compose(p.Orientation)
+		err := source.SetOrientationEdit(id, edit)
+		if err != nil {
+			return accepted, err
+		}
+		p.Status = OrientationAccepted
+		accepted = append(accepted, p)
+	}
+	return accepted, nil
+}
+
+// RejectOrientationProposals rejects the pending proposals of the files,
+// returning the rejected proposals
+func (source *Source) RejectOrientationProposals(ids []ImageId) ([]OrientationProposal, error) {
+	rejected := make([]OrientationProposal, 0, len(ids))
+	for _, id := range ids {
+		p, ok := source.database.GetOrientationProposal(id)
+		if !ok || p.Status != OrientationPending {
+			continue
+		}
+		err := source.database.WriteOrientationProposalStatus(id, OrientationRejected)
+		if err != nil {
+			return rejected, err
+		}
+		p.Status = OrientationRejected
+		rejected = append(rejected, p)
+	}
+	return rejected, nil
+}
+
+// DetectOrientation queues the files in the dirs that have no orientation
+// metadata, edit or previous proposal for orientation detection
+func (source *Source) DetectOrientation(dirs []string, maxPhotos int) {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	out := make(chan MissingInfo)
+	go func() {
+		for ip := range source.database.ListOrientationCandidates(dirs, maxPhotos) {
+			if !source.IsSupportedImage(ip.Path) {
+				continue
+			}
+			out <- MissingInfo{
+				Id:   ip.Id,
+				Path: ip.Path,
+			}
+		}
+		close(out)
+	}()
+	source.orientationQueue.AppendItems(MissingInfoToInterface(out))
+}
+
+func (source *Source) detectOrientation(in <-chan interface{}) {
+	ctx := context.TODO()
+	var prompt clip.Embedding
+	for elem := range in {
+
+		for source.contentsQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		m := elem.(MissingInfo)
+
+		if prompt == nil {
+			var err error
+			prompt, err = source.Clip.EmbedText(source.Orientation.Prompt)
+			if err != nil {
+				indexLog.Warn("detect orientation unable to embed prompt", "err", err)
+				continue
+			}
+		}
+
+		img, err := source.loadThumbnail(ctx, m.Id, m.Path)
+		if err != nil {
+			indexLog.Warn("detect orientation unable to load", "path", m.Path, "err", err)
+			continue
+		}
+
+		p, err := source.proposeOrientation(img, prompt)
+		if err != nil {
+			indexLog.Warn("detect orientation failed", "path", m.Path, "err", err)
+			continue
+		}
+		p.Id = m.Id
+
+		// Kept even if nothing is proposed, so that the file is not
+		// detected again
+		if p.Orientation == Normal || p.Confidence < source.Orientation.MinConfidence {
+			p.Status = OrientationNone
+		}
+		source.database.WriteOrientationProposal(p)
+	}
+}
+
+func (source *Source) loadThumbnail(ctx context.Context, id ImageId, path string) (image.Image, error) {
+	var img image.Image
+	for _, src := range source.thumbnailSourcesByLatency() {
+		src.Reader(ctx, io.ImageId(id), path, func(rs goio.ReadSeeker, err error) {
+			if err != nil {
+				return
+			}
+			img, err = source.indexContentsDecode(ctx, src, rs)
+			if err != nil {
+				img = nil
+			}
+		})
+		if img != nil {
+			return img, nil
+		}
+	}
+	img, _, err := source.indexContentsGenerate(ctx, io.ImageId(id), path)
+	return img, err
+}
+
+// proposeOrientation compares the image rotated by each quarter turn to
+// the prompt, proposing the most similar rotation. The confidence is the
+// softmax of the similarities scaled like CLIP logits.
+func (source *Source) proposeOrientation(img image.Image, prompt clip.Embedding) (OrientationProposal, error) {
+	search := prompt.Float32()
+	searchInvNorm := prompt.InvNormFloat32()
+
+	var similarities [4]float64
+	for turns := range similarities {
+		var b bytes.Buffer
+		err := jpeg.Encode(&b, rotateImage(img, turns), &jpeg.Options{Quality: 90})
+		if err != nil {
+			return OrientationProposal{}, err
+		}
+		emb, err := source.Clip.EmbedImageReader(&b)
+		if err != nil {
+			return OrientationProposal{}, err
+		}
+		dot, err := clip.DotProductFloat32Float(search, emb.Float())
+		if err != nil {
+			return OrientationProposal{}, err
+		}
+		similarities[turns] = float64(dot * searchInvNorm * emb.InvNormFloat32())
+	}
+
+	best := 0
+	for turns, s := range similarities {
+		if s > similarities[best] {
+			best = turns
+		}
+	}
+	sum := 0.
+	for _, s := range similarities {
+		sum += math.Exp(100 * (s - similarities[best]))
+	}
+
+	return OrientationProposal{
+		Orientation: orientationFromTransform(false, best),
+		Confidence:  float32(1 / sum),
+		Status:      OrientationPending,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// rotateImage returns the image rotated clockwise by the number of quarter
+// turns
+func rotateImage(img image.Image, turns int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	turns = (turns%4 + 4) % 4
+	if turns == 0 {
+		return src
+	}
+
+	dw, dh := w, h
+	if turns%2 == 1 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch turns {
+			case 1:
+				dx, dy = h-1-y, x
+			case 2:
+				dx, dy = w-1-x, h-1-y
+			case 3:
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// mirrorImage returns the image mirrored horizontally
+func mirrorImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(src.Bounds())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(w-1-x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// OrientImage returns the image transformed to be displayed upright
+func OrientImage(img image.Image, orientation Orientation) image.Image {
+	mirror, turns := orientation.transform()
+	if mirror {
+		img = mirrorImage(img)
+	}
+	if turns == 0 {
+		return img
+	}
+	return rotateImage(img, turns)
+}
@@ -0,0 +1,161 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"photofield/io/archive"
+	"photofield/io/ffmpeg"
+)
+
+// AuditOrientation re-verifies the orientation and dimensions of the
+// already indexed files in the dirs, including the rotation of videos,
+// correcting the stored ones and regenerating the thumbnails of files
+// that were indexed with the wrong orientation
+func (source *Source) AuditOrientation(dirs []string, maxPhotos int) {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	source.orientationAuditQueue.AppendItems(MissingInfoToInterface(source.database.ListMissing(dirs, maxPhotos, Missing{})))
+}
+
+func (source *Source) auditOrientation(in <-chan interface{}) {
+	for elem := range in {
+		m := elem.(MissingInfo)
+		if _, err := source.correctOrientation(m.Id, m.Path); err != nil {
+			indexLog.Warn("orientation audit unable to verify", "path", m.Path, "err", err)
+		}
+	}
+}
+
+// decodeOrientation decodes the orientation and dimensions of the file
+// again, as displayed and without the orientation edit
+func (source *Source) decodeOrientation(path string) (Info, error) {
+	var info Info
+	if source.IsSupportedVideo(path) {
+		// Rotation metadata of videos is only read by exiftool, which may
+		// not have been available when the video was indexed
+		if p, err := ffmpeg.Probe(context.TODO(), source.ffprobePath, path); err == nil {
+			info.Orientation = getOrientationFromRotation(strconv.Itoa(p.Rotation))
+			info.Width, info.Height = p.Width, p.Height
+			if info.Orientation.SwapsDimensions() {
+				info.Width, info.Height = info.Height, info.Width
+			}
+			return info, nil
+		}
+	}
+
+	var camera Camera
+	if _, err := source.decoder.DecodeInfo(path, &info, &camera); err != nil {
+		return info, err
+	}
+	if info.Orientation.IsZero() {
+		info.Orientation = Normal
+	}
+	if !source.IsSupportedImage(path) {
+		return info, nil
+	}
+
+	// The size reported by the metadata can disagree with the size of the
+	// actual image, e.g. for edited files with stale metadata
+	f, err := archive.Open(path)
+	if err != nil {
+		return info, nil
+	}
+	defer f.Close()
+	conf, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return info, nil
+	}
+	if info.Orientation.SwapsDimensions() {
+		conf.Width, conf.Height = conf.Height, conf.Width
+	}
+	info.Width, info.Height = conf.Width, conf.Height
+	return info, nil
+}
+
+// correctOrientation corrects the stored orientation and dimensions of the
+// file if they differ from the decoded ones, returning true if they did
+func (source *Source) correctOrientation(id ImageId, path string) (bool, error) {
+	decoded, err := source.decodeOrientation(path)
+	if err != nil {
+		return false, err
+	}
+	if decoded.Width == 0 || decoded.Height == 0 {
+		return false, fmt.Errorf("unknown dimensions")
+	}
+	source.applyOrientationEdit(id, &decoded)
+
+	stored, found := source.database.Get(id)
+	if !found {
+		return false, ErrNotFound
+	}
+	orientation := stored.Orientation
+	if orientation.IsZero() {
+		orientation = Normal
+	}
+	if orientation == decoded.Orientation && stored.Width == decoded.Width && stored.Height == decoded.Height {
+		return false, nil
+	}
+
+	indexLog.Info(
+		"orientation audit correcting",
+		"path", path,
+		"from", fmt.Sprintf("%dx%d %v", stored.Width, stored.Height, orientation),
+		"to", fmt.Sprintf("%dx%d %v", decoded.Width, decoded.Height, decoded.Orientation),
+	)
+	if err := source.database.WriteDimensions(id, decoded); err != nil {
+		return false, err
+	}
+	source.imageInfoCache.Delete(id)
+	// Regenerated with the right orientation on the next request
+	source.thumbnailSink.Delete(uint32(id))
+	return true, nil
+}
+
+// VerifyOrientation queues the file for an orientation audit if the
+// image, after applying the orientation, is sideways compared to the
+// stored dimensions, e.g. because the orientation was missed when it was
+// indexed. Each file is only queued once.
+func (source *Source) VerifyOrientation(id ImageId, path string, img image.Image, orientation Orientation) {
+	if !source.Orientation.Verify {
+		return
+	}
+	info := source.GetInfo(id)
+	size := img.Bounds().Size()
+	if orientation.SwapsDimensions() {
+		size.X, size.Y = size.Y, size.X
+	}
+	if !transposed(size.X, size.Y, info.Width, info.Height) {
+		return
+	}
+	if _, queued := source.orientationVerified.LoadOrStore(id, true); queued {
+		return
+	}
+	indexLog.Info("orientation audit queued", "path", path, "displayed", fmt.Sprintf("%dx%d", size.X, size.Y), "stored", fmt.Sprintf("%dx%d", info.Width, info.Height))
+	source.orientationAuditQueue.AppendItems(MissingInfoToInterface(singleMissingInfo(id, path)))
+}
+
+func singleMissingInfo(id ImageId, path string) <-chan MissingInfo {
+	out := make(chan MissingInfo, 1)
+	out <- MissingInfo{Id: id, Path: path}
+	close(out)
+	return out
+}
+
+// transposed returns true if the first size has about the aspect ratio of
+// the second one turned sideways, ignoring square sizes
+func transposed(w, h, expectedW, expectedH int) bool {
+	if w <= 0 || h <= 0 || expectedW <= 0 || expectedH <= 0 {
+		return false
+	}
+	aspect := float64(w) / float64(h)
+	expected := float64(expectedW) / float64(expectedH)
+	if math.Abs(math.Log(aspect)) < 0.05 || math.Abs(math.Log(expected)) < 0.05 {
+		return false
+	}
+	return math.Abs(math.Log(aspect*expected)) < 0.05
+}
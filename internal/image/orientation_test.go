@@ -0,0 +1,147 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrientationCompose(t *testing.T) {
+	cases := []struct {
+		orientation Orientation
+		edit        Orientation
+		expected    Orientation
+	}{
+		{0, Rotate90, Rotate90},
+		{Normal, Normal, Normal},
+		{Normal, Rotate270, Rotate270},
+		{Rotate90, Rotate90, Rotate180},
+		{Rotate90, Rotate270, Normal},
+		{Rotate180, Rotate180, Normal},
+		{MirrorHorizontal, MirrorHorizontal, Normal},
+		{MirrorHorizontal, Rotate180, MirrorVertical},
+		{Rotate90, MirrorHorizontal, MirrorHorizontalRotate270},
+		{MirrorHorizontal, Rotate90, MirrorHorizontalRotate90},
+	}
+	for _, c := range cases {
+		t.Run(c.orientation.String()+" "+c.edit.String(), func(t *testing.T) {
+			got := c.orientation.Compose(c.edit)
+			if got != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestOrientationComposeRotate270(t *testing.T) {
+	for o := Normal; o <= Rotate270; o++ {
+		if got, expected := o.Compose(Rotate270), o.Rotate270(); got != expected {
+			t.Errorf("%s: expected %s, got %s", o, expected, got)
+		}
+	}
+}
+
+func TestOrientationInverse(t *testing.T) {
+	for o := Normal; o <= Rotate270; o++ {
+		if got := o.Compose(o.Inverse()); got != Normal {
+			t.Errorf("%s: expected Normal, got %s", o, got)
+		}
+	}
+}
+
+func TestEditDelta(t *testing.T) {
+	for previous := Normal; previous <= Rotate270; previous++ {
+		for proposal := Normal; proposal <= Rotate270; proposal++ {
+			if got := editDelta(previous, previous.Compose(proposal)); got != proposal {
+				t.Errorf("%s %s: expected %s, got %s", previous, proposal, proposal, got)
+			}
+		}
+	}
+}
+
+func TestRotateImage(t *testing.T) {
+	// 2x1 image with a red left and a blue right pixel
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	cases := []struct {
+		turns  int
+		size   image.Point
+		redAt  image.Point
+		blueAt image.Point
+	}{
+		{0, image.Pt(2, 1), image.Pt(0, 0), image.Pt(1, 0)},
+		{1, image.Pt(1, 2), image.Pt(0, 0), image.Pt(0, 1)},
+		{2, image.Pt(2, 1), image.Pt(1, 0), image.Pt(0, 0)},
+		{3, image.Pt(1, 2), image.Pt(0, 1), image.Pt(0, 0)},
+	}
+	for _, c := range cases {
+		rotated := rotateImage(img, c.turns)
+		if size := rotated.Bounds().Size(); size != c.size {
+			t.Errorf("%d turns: expected size %v, got %v", c.turns, c.size, size)
+			continue
+		}
+		if got := rotated.At(c.redAt.X, c.redAt.Y); got != red {
+			t.Errorf("%d turns: expected red at %v, got %v", c.turns, c.redAt, got)
+		}
+		if got := rotated.At(c.blueAt.X, c.blueAt.Y); got != blue {
+			t.Errorf("%d turns: expected blue at %v, got %v", c.turns, c.blueAt, got)
+		}
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// 2x2 image with a red top left and a blue top right pixel
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	cases := []struct {
+		orientation Orientation
+		redAt       image.Point
+		blueAt      image.Point
+	}{
+		{Normal, image.Pt(0, 0), image.Pt(1, 0)},
+		{MirrorHorizontal, image.Pt(1, 0), image.Pt(0, 0)},
+		{Rotate180, image.Pt(1, 1), image.Pt(0, 1)},
+		{MirrorVertical, image.Pt(0, 1), image.Pt(1, 1)},
+		{MirrorHorizontalRotate270, image.Pt(0, 0), image.Pt(0, 1)},
+		{Rotate90, image.Pt(1, 0), image.Pt(1, 1)},
+		{MirrorHorizontalRotate90, image.Pt(1, 1), image.Pt(1, 0)},
+		{Rotate270, image.Pt(0, 1), image.Pt(0, 0)},
+	}
+	for _, c := range cases {
+		oriented := OrientImage(img, c.orientation)
+		if got := oriented.At(c.redAt.X, c.redAt.Y); got != red {
+			t.Errorf("%s: expected red at %v, got %v", c.orientation, c.redAt, got)
+		}
+		if got := oriented.At(c.blueAt.X, c.blueAt.Y); got != blue {
+			t.Errorf("%s: expected blue at %v, got %v", c.orientation, c.blueAt, got)
+		}
+	}
+}
+
+func TestTransposed(t *testing.T) {
+	cases := []struct {
+		w, h, expectedW, expectedH int
+		expected                   bool
+	}{
+		{300, 200, 200, 300, true},
+		{299, 200, 4000, 6000, true},
+		{300, 200, 300, 200, false},
+		{200, 200, 200, 300, false},
+		{300, 200, 300, 300, false},
+		{400, 300, 200, 300, false},
+		{300, 200, 0, 0, false},
+	}
+	for _, c := range cases {
+		if got := transposed(c.w, c.h, c.expectedW, c.expectedH); got != c.expected {
+			t.Errorf("transposed(%d, %d, %d, %d) = %v, expected %v", c.w, c.h, c.expectedW, c.expectedH, got, c.expected)
+		}
+	}
+}
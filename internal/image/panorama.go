@@ -0,0 +1,437 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/io/archive"
+
+	"golang.org/x/image/draw"
+)
+
+type PanoramaConfig struct {
+	// Also detect panoramas in new files after indexing collections
+	Detect bool `json:"detect"`
+	// Maximum time between consecutive shots of a sequence
+	MaxGap string `json:"max_gap"`
+	// Minimum number of shots of a sequence
+	MinFrames int `json:"min_frames"`
+	// Minimum similarity between 0 and 1 of the overlapping edges of
+	// consecutive shots
+	MinOverlap float64 `json:"min_overlap"`
+	// Maximum difference between 0 and 1 of the mean brightness of
+	// consecutive shots
+	MaxExposureDiff float64      `json:"max_exposure_diff"`
+	Stitch          StitchConfig `json:"stitch"`
+}
+
+// StitchConfig configures an external command producing a stitched preview
+// of each detected panorama
+type StitchConfig struct {
+	// Command and arguments, an argument of {inputs} is replaced by the paths
+	// of the shots in order and {output} by the path of the JPEG preview to
+	// write. Stitching is disabled if empty.
+	Command []string `json:"command"`
+	Timeout string   `json:"timeout"`
+}
+
+// Panorama is a detected sequence of shots likely taken to be stitched
+// into a panorama
+type Panorama struct {
+	Id int64
+	// Files of the sequence in order
+	Files []ImageId
+	// Path of the stitched preview, empty if not stitched
+	Preview   string
+	CreatedAt time.Time
+}
+
+var ErrStitchDisabled = errors.New("stitching disabled")
+
+// Size of the grayscale thumbnails the shots are compared by
+const panoramaFeatureSize = 64
+
+type panoramaFrame struct {
+	Id          ImageId
+	Path        string
+	DateTime    time.Time
+	Width       int
+	Height      int
+	Orientation Orientation
+	CameraId    int64
+}
+
+type panoramaFeatures struct {
+	gray *image.Gray
+	// Mean brightness between 0 and 1
+	mean float64
+}
+
+// Direction the next shot of a sequence continues the previous one in
+type panoramaDirection int
+
+const (
+	panRight panoramaDirection = iota
+	panLeft
+	panDown
+	panUp
+)
+
+func (config *PanoramaConfig) Validate() error {
+	if _, err := config.maxGap(); err != nil {
+		return fmt.Errorf("max_gap: %w", err)
+	}
+	if _, err := config.Stitch.timeout(); err != nil {
+		return fmt.Errorf("stitch timeout: %w", err)
+	}
+	return nil
+}
+
+func (config PanoramaConfig) maxGap() (time.Duration, error) {
+	if config.MaxGap == "" {
+		return 5 * time.Second, nil
+	}
+	return time.ParseDuration(config.MaxGap)
+}
+
+func (config StitchConfig) timeout() (time.Duration, error) {
+	if config.Timeout == "" {
+		return 5 * time.Minute, nil
+	}
+	return time.ParseDuration(config.Timeout)
+}
+
+func (config StitchConfig) Enabled() bool {
+	return len(config.Command) > 0
+}
+
+func (source *Source) ListPanoramas(dirs []string, limit int) []Panorama {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	return source.database.ListPanoramas(dirs, limit)
+}
+
+func (source *Source) GetPanorama(id int64) (Panorama, bool) {
+	return source.database.GetPanorama(id)
+}
+
+// RejectPanorama ungroups the files of the panorama, e.g. if it was
+// detected by mistake. The files are not detected again.
+func (source *Source) RejectPanorama(id int64) error {
+	p, ok := source.database.GetPanorama(id)
+	if !ok {
+		return ErrNotFound
+	}
+	err := source.database.RejectPanorama(id)
+	if err != nil {
+		return err
+	}
+	if p.Preview != "" {
+		os.Remove(p.Preview)
+	}
+	return nil
+}
+
+// DetectPanoramas queues the dirs for detection of sequences of shots that
+// are likely to be stitched into a panorama
+func (source *Source) DetectPanoramas(dirs []string) {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	out := make(chan interface{})
+	go func() {
+		for _, prefix := range source.database.ListPrefixes() {
+			for _, dir := range dirs {
+				if strings.HasPrefix(prefix, dir) {
+					out <- prefix
+					break
+				}
+			}
+		}
+		close(out)
+	}()
+	source.panoramaQueue.AppendItems(out)
+}
+
+func (source *Source) detectPanoramas(in <-chan interface{}) {
+	ctx := context.TODO()
+	maxGap, _ := source.Panorama.maxGap()
+	for elem := range in {
+
+		for source.contentsQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		dir := elem.(string)
+		frames := source.database.ListPanoramaFrames(dir)
+		images := frames[:0]
+		for _, f := range frames {
+			if source.IsSupportedImage(f.Path) {
+				images = append(images, f)
+			}
+		}
+
+		for _, run := range splitPanoramaRuns(images, maxGap, source.Panorama.MinFrames) {
+			features := make([]panoramaFeatures, len(run))
+			ok := true
+			for i, f := range run {
+				img, err := source.loadThumbnail(ctx, f.Id, f.Path)
+				if err != nil {
+					indexLog.Warn("detect panoramas unable to load", "path", f.Path, "err", err)
+					ok = false
+					break
+				}
+				features[i] = newPanoramaFeatures(img)
+			}
+			if !ok {
+				continue
+			}
+
+			for _, seq := range linkPanoramaFrames(features, source.Panorama) {
+				files := make([]ImageId, len(seq))
+				paths := make([]string, len(seq))
+				for i, index := range seq {
+					files[i] = run[index].Id
+					paths[i] = run[index].Path
+				}
+				id, err := source.database.WritePanorama(files)
+				if err != nil {
+					continue
+				}
+				indexLog.Info("detect panoramas found shots", "count", len(files), "path", paths[0])
+				if !source.Panorama.Stitch.Enabled() {
+					continue
+				}
+				preview, err := source.stitchPanorama(ctx, id, paths)
+				if err != nil {
+					indexLog.Warn("detect panoramas unable to stitch", "id", id, "err", err)
+					continue
+				}
+				source.database.WritePanoramaPreview(id, preview)
+			}
+		}
+	}
+}
+
+// splitPanoramaRuns splits the frames sorted by date into runs of at least
+// min consecutive frames of the same camera, size and orientation taken
+// within maxGap of each other
+func splitPanoramaRuns(frames []panoramaFrame, maxGap time.Duration, min int) [][]panoramaFrame {
+	if min < 2 {
+		min = 2
+	}
+	runs := make([][]panoramaFrame, 0)
+	start := 0
+	for i := 1; i <= len(frames); i++ {
+		if i < len(frames) {
+			prev, f := frames[i-1], frames[i]
+			if f.CameraId == prev.CameraId &&
+				f.Width == prev.Width &&
+				f.Height == prev.Height &&
+				f.Orientation == prev.Orientation &&
+				f.DateTime.Sub(prev.DateTime) <= maxGap {
+				continue
+			}
+		}
+		if i-start >= min {
+			runs = append(runs, frames[start:i])
+		}
+		start = i
+	}
+	return runs
+}
+
+func newPanoramaFeatures(img image.Image) panoramaFeatures {
+	gray := image.NewGray(image.Rect(0, 0, panoramaFeatureSize, panoramaFeatureSize))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+	sum := 0
+	for _, v := range gray.Pix {
+		sum += int(v)
+	}
+	return panoramaFeatures{
+		gray: gray,
+		mean: float64(sum) / float64(len(gray.Pix)) / 255,
+	}
+}
+
+// linkPanoramaFrames splits the consecutive frames into sequences where
+// each frame continues the previous one in the same direction, returning
+// the indices of the sequences of at least MinFrames frames
+func linkPanoramaFrames(features []panoramaFeatures, config PanoramaConfig) [][]int {
+	min := config.MinFrames
+	if min < 2 {
+		min = 2
+	}
+	seqs := make([][]int, 0)
+	seq := []int{0}
+	var dir panoramaDirection
+	flush := func(next int) {
+		if len(seq) >= min {
+			seqs = append(seqs, seq)
+		}
+		seq = []int{next}
+	}
+	for i := 1; i < len(features); i++ {
+		a, b := features[i-1], features[i]
+		if math.Abs(a.mean-b.mean) > config.MaxExposureDiff {
+			flush(i)
+			continue
+		}
+		d, overlap := bestEdgeOverlap(a.gray, b.gray)
+		// Bursts of the same view also overlap, but not as well as they
+		// match without shifting
+		if overlap < config.MinOverlap || overlap <= correlation(a.gray, b.gray, 0, 0, 0, panoramaFeatureSize) {
+			flush(i)
+			continue
+		}
+		if len(seq) >= 2 && d != dir {
+			flush(i)
+			continue
+		}
+		dir = d
+		seq = append(seq, i)
+	}
+	flush(0)
+	return seqs
+}
+
+// bestEdgeOverlap returns the direction b continues a in and how well the
+// overlapping edges match
+func bestEdgeOverlap(a, b *image.Gray) (panoramaDirection, float64) {
+	at, bt := transposeGray(a), transposeGray(b)
+	candidates := []struct {
+		dir  panoramaDirection
+		a, b *image.Gray
+	}{
+		{panRight, a, b},
+		{panLeft, b, a},
+		{panDown, at, bt},
+		{panUp, bt, at},
+	}
+	best := panRight
+	bestOverlap := math.Inf(-1)
+	for _, c := range candidates {
+		overlap := edgeOverlap(c.a, c.b)
+		if overlap > bestOverlap {
+			best = c.dir
+			bestOverlap = overlap
+		}
+	}
+	return best, bestOverlap
+}
+
+// edgeOverlap returns the best correlation of the right edge of a with the
+// left edge of b over overlaps of 10% to 60% and small vertical shifts
+func edgeOverlap(a, b *image.Gray) float64 {
+	w := a.Bounds().Dx()
+	best := math.Inf(-1)
+	for percent := 10; percent <= 60; percent += 5 {
+		ow := w * percent / 100
+		for dy := -3; dy <= 3; dy++ {
+			c := correlation(a, b, w-ow, 0, dy, ow)
+			if c > best {
+				best = c
+			}
+		}
+	}
+	return best
+}
+
+// correlation returns the normalized cross-correlation of the columns of a
+// starting at ax with the columns of b starting at bx, shifted down by dy,
+// 0 if either is flat
+func correlation(a, b *image.Gray, ax, bx, dy, width int) float64 {
+	h := a.Bounds().Dy()
+	var sa, sb, saa, sbb, sab float64
+	n := 0
+	for y := 0; y < h; y++ {
+		by := y + dy
+		if by < 0 || by >= h {
+			continue
+		}
+		for x := 0; x < width; x++ {
+			va := float64(a.Pix[a.PixOffset(ax+x, y)])
+			vb := float64(b.Pix[b.PixOffset(bx+x, by)])
+			sa += va
+			sb += vb
+			saa += va * va
+			sbb += vb * vb
+			sab += va * vb
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	fn := float64(n)
+	cov := sab - sa*sb/fn
+	va := saa - sa*sa/fn
+	vb := sbb - sb*sb/fn
+	// Flat areas like the sky match anything
+	if va < fn || vb < fn {
+		return 0
+	}
+	return cov / math.Sqrt(va*vb)
+}
+
+func transposeGray(img *image.Gray) *image.Gray {
+	b := img.Bounds()
+	t := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			t.Pix[t.PixOffset(y, x)] = img.Pix[img.PixOffset(x, y)]
+		}
+	}
+	return t
+}
+
+// stitchPanorama runs the stitch command on the shots, returning the path
+// of the written preview
+func (source *Source) stitchPanorama(ctx context.Context, id int64, paths []string) (string, error) {
+	config := source.Panorama.Stitch
+	if !config.Enabled() {
+		return "", ErrStitchDisabled
+	}
+	for _, path := range paths {
+		if archive.IsVirtual(path) {
+			return "", fmt.Errorf("unable to stitch archived file %s", path)
+		}
+	}
+
+	dir := filepath.Join(source.DataDir, "panoramas")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	output := filepath.Join(dir, fmt.Sprintf("%d.jpg", id))
+
+	args := make([]string, 0, len(config.Command)+len(paths))
+	for _, arg := range config.Command {
+		if arg == "{inputs}" {
+			args = append(args, paths...)
+			continue
+		}
+		args = append(args, strings.ReplaceAll(arg, "{output}", output))
+	}
+
+	timeout, _ := config.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if _, err := os.Stat(output); err != nil {
+		return "", fmt.Errorf("stitch command did not write %s", output)
+	}
+	return output, nil
+}
@@ -0,0 +1,121 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// panoramaScene returns a smooth random scene to take shots from
+func panoramaScene(seed int64, width, height int) *image.Gray {
+	r := rand.New(rand.NewSource(seed))
+	coarse := image.NewGray(image.Rect(0, 0, width/10, height/10))
+	r.Read(coarse.Pix)
+	scene := image.NewGray(image.Rect(0, 0, width, height))
+	draw.BiLinear.Scale(scene, scene.Bounds(), coarse, coarse.Bounds(), draw.Src, nil)
+	return scene
+}
+
+func panoramaShot(scene *image.Gray, x int, brightness int) panoramaFeatures {
+	shot := image.NewGray(image.Rect(0, 0, 200, 200))
+	draw.Copy(shot, image.Point{}, scene, image.Rect(x, 0, x+200, 200), draw.Src, nil)
+	for i, v := range shot.Pix {
+		b := int(v) + brightness
+		if b > 255 {
+			b = 255
+		}
+		shot.Pix[i] = uint8(b)
+	}
+	return newPanoramaFeatures(shot)
+}
+
+func TestLinkPanoramaFrames(t *testing.T) {
+	scene := panoramaScene(1, 1000, 200)
+	other := panoramaScene(2, 1000, 200)
+	config := PanoramaConfig{
+		MinFrames:       3,
+		MinOverlap:      0.7,
+		MaxExposureDiff: 0.1,
+	}
+
+	shots := func(xs ...int) []panoramaFeatures {
+		features := make([]panoramaFeatures, len(xs))
+		for i, x := range xs {
+			features[i] = panoramaShot(scene, x, 0)
+		}
+		return features
+	}
+
+	cases := []struct {
+		name     string
+		features []panoramaFeatures
+		expected [][]int
+	}{
+		{"pan right", shots(0, 120, 240, 360), [][]int{{0, 1, 2, 3}}},
+		{"pan left", shots(360, 240, 120, 0), [][]int{{0, 1, 2, 3}}},
+		{"too few", shots(0, 120), [][]int{}},
+		{"burst", shots(0, 0, 0, 0), [][]int{}},
+		{"burst after pan", shots(0, 120, 240, 240), [][]int{{0, 1, 2}}},
+		{"direction change", shots(0, 120, 240, 120, 0), [][]int{{0, 1, 2}}},
+		{"unrelated", append(shots(0, 120, 240), panoramaShot(other, 360, 0)), [][]int{{0, 1, 2}}},
+		{"exposure change", []panoramaFeatures{
+			panoramaShot(scene, 0, 0),
+			panoramaShot(scene, 120, 0),
+			panoramaShot(scene, 240, 0),
+			panoramaShot(scene, 360, 60),
+			panoramaShot(scene, 480, 60),
+			panoramaShot(scene, 600, 60),
+		}, [][]int{{0, 1, 2}, {3, 4, 5}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := linkPanoramaFrames(c.features, config)
+			if fmt.Sprint(got) != fmt.Sprint(c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestSplitPanoramaRuns(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	frame := func(id ImageId, seconds int, camera int64) panoramaFrame {
+		return panoramaFrame{
+			Id:          id,
+			DateTime:    start.Add(time.Duration(seconds) * time.Second),
+			Width:       4000,
+			Height:      3000,
+			Orientation: Normal,
+			CameraId:    camera,
+		}
+	}
+	frames := []panoramaFrame{
+		frame(1, 0, 1),
+		frame(2, 2, 1),
+		frame(3, 4, 1),
+		// Too long after the previous shot
+		frame(4, 60, 1),
+		frame(5, 62, 1),
+		// Different camera
+		frame(6, 63, 2),
+		frame(7, 64, 2),
+		frame(8, 65, 2),
+	}
+	frames[7].Width = 3000
+
+	runs := splitPanoramaRuns(frames, 5*time.Second, 2)
+	got := make([][]ImageId, len(runs))
+	for i, run := range runs {
+		for _, f := range run {
+			got[i] = append(got[i], f.Id)
+		}
+	}
+	expected := [][]ImageId{{1, 2, 3}, {4, 5}, {6, 7}}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
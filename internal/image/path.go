@@ -0,0 +1,140 @@
+package image
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"photofield/internal/metrics"
+)
+
+// Setting holding whether the stored paths were migrated to lower case
+const caseInsensitiveSetting = "paths.case_insensitive"
+
+type PathConfig struct {
+	// Treat paths as case-insensitive, storing them in lower case
+	CaseInsensitive bool `json:"case_insensitive"`
+}
+
+// Normalize returns the canonical form of the path as stored in the
+// database, so that the same file reached via differently written paths,
+// e.g. a network share mounted two ways, is only stored once.
+func (config PathConfig) Normalize(path string) string {
+	return normalizePath(path, runtime.GOOS == "windows", config.CaseInsensitive)
+}
+
+// normalizePath returns the canonical form of the path
+//
+// Windows paths use backslash separators, upper case drive letters and
+// lower case UNC server and share names, which are case-insensitive. The
+// extended-length prefix \\?\ is removed. Other paths are left as-is apart
+// from the optional lower casing.
+func normalizePath(path string, windows bool, caseInsensitive bool) string {
+	if windows {
+		path = normalizeWindowsPath(path)
+	}
+	if caseInsensitive {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+func normalizeWindowsPath(path string) string {
+	path = strings.ReplaceAll(path, "/", `\`)
+
+	if strings.HasPrefix(path, `\\?\UNC\`) {
+		path = `\\` + path[len(`\\?\UNC\`):]
+	} else if strings.HasPrefix(path, `\\?\`) {
+		path = path[len(`\\?\`):]
+	}
+
+	if strings.HasPrefix(path, `\\`) {
+		// \\server\share\rest
+		parts := strings.SplitN(path[2:], `\`, 3)
+		for i := 0; i < len(parts) && i < 2; i++ {
+			parts[i] = strings.ToLower(parts[i])
+		}
+		return `\\` + collapseSeparators(strings.Join(parts, `\`))
+	}
+
+	if len(path) >= 2 && path[1] == ':' && isDriveLetter(path[0]) {
+		path = strings.ToUpper(path[:1]) + path[1:]
+	}
+	return collapseSeparators(path)
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func collapseSeparators(path string) string {
+	for strings.Contains(path, `\\`) {
+		path = strings.ReplaceAll(path, `\\`, `\`)
+	}
+	return path
+}
+
+// normalizePaths migrates the paths stored in the database to their
+// canonical form. Files stored under several paths that normalize to the
+// same one are deduplicated by keeping the one already in canonical form.
+func (source *Source) normalizePaths() {
+	normalize := source.Paths.Normalize
+
+	canonical := true
+	for _, prefix := range source.database.ListPrefixes() {
+		if normalize(prefix) != prefix {
+			canonical = false
+			break
+		}
+	}
+	// Filenames can only change by case, which only needs a migration if
+	// case-insensitive paths were turned on since the last one
+	caseInsensitive := strconv.FormatBool(source.Paths.CaseInsensitive)
+	migrated, _ := source.database.GetSetting(caseInsensitiveSetting)
+	if canonical && (!source.Paths.CaseInsensitive || migrated == caseInsensitive) {
+		if migrated != caseInsensitive {
+			source.writeCaseInsensitiveSetting(caseInsensitive)
+		}
+		return
+	}
+
+	defer metrics.Elapsed("normalize paths")()
+
+	moved := make(map[string]ImageId)
+	moves := 0
+	deletes := 0
+	for ip := range source.database.ListIdPaths([]string{""}, 0) {
+		path := normalize(ip.Path)
+		if path == ip.Path {
+			continue
+		}
+		_, taken := moved[path]
+		if !taken {
+			_, taken = source.database.GetIdFromPath(path)
+		}
+		if taken {
+			source.database.Delete(ip.Id)
+			source.thumbnailSink.Delete(uint32(ip.Id))
+			deletes++
+			continue
+		}
+		source.database.Move(ip.Id, path)
+		moved[path] = ip.Id
+		moves++
+	}
+
+	err := source.database.RenameDirs(normalize)
+	if err != nil {
+		indexLog.Error("normalize paths unable to rename dirs", "err", err)
+	}
+
+	source.database.WaitForCommit()
+	source.writeCaseInsensitiveSetting(caseInsensitive)
+	indexLog.Info("normalize paths done", "moved", moves, "duplicates", deletes)
+}
+
+func (source *Source) writeCaseInsensitiveSetting(value string) {
+	if err := source.database.WriteSetting(caseInsensitiveSetting, value); err != nil {
+		indexLog.Error("normalize paths unable to write setting", "err", err)
+	}
+}
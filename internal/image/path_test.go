@@ -0,0 +1,33 @@
+package image
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		path            string
+		windows         bool
+		caseInsensitive bool
+		expected        string
+	}{
+		{"/photos/A.jpg", false, false, "/photos/A.jpg"},
+		{"/photos/A.jpg", false, true, "/photos/a.jpg"},
+		{`/photos/a\b.jpg`, false, false, `/photos/a\b.jpg`},
+		{`c:\Photos\A.jpg`, true, false, `C:\Photos\A.jpg`},
+		{`c:/Photos//A.jpg`, true, false, `C:\Photos\A.jpg`},
+		{`C:\Photos\A.jpg`, true, true, `c:\photos\a.jpg`},
+		{`\\NAS\Photos\2020\A.jpg`, true, false, `\\nas\photos\2020\A.jpg`},
+		{`//nas/Photos/2020/A.jpg`, true, false, `\\nas\photos\2020\A.jpg`},
+		{`\\?\UNC\NAS\Photos\A.jpg`, true, false, `\\nas\photos\A.jpg`},
+		{`\\?\D:\Photos\`, true, false, `D:\Photos\`},
+		{`\\NAS\Photos\`, true, false, `\\nas\photos\`},
+		{`\\NAS`, true, false, `\\nas`},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			got := normalizePath(c.path, c.windows, c.caseInsensitive)
+			if got != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
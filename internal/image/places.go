@@ -0,0 +1,168 @@
+package image
+
+import (
+	"sort"
+	"strings"
+
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+	"github.com/sams96/rgeo"
+)
+
+const (
+	PlaceCountry = "COUNTRY"
+	// City, or province if the location is not within a city
+	PlaceCity = "CITY"
+)
+
+// Place groups the photos taken in a country or city, named by reverse
+// geocoding their location
+type Place struct {
+	// Tag of the photos taken at the place, e.g. place:germany:berlin
+	Tag     string
+	Kind    string
+	Name    string
+	Country string
+	// Photos taken at the place
+	Count int
+	// Latest photo taken at the place
+	Cover  ImageId
+	LatLng s2.LatLng
+}
+
+// reverseGeocodeLocation returns the country, province and city of the
+// location, false if reverse geocoding is disabled or it is not in a country
+func (source *Source) reverseGeocodeLocation(latlng s2.LatLng) (rgeo.Location, bool) {
+	if source.rg == nil || !hasLocation(latlng) {
+		return rgeo.Location{}, false
+	}
+	loc, err := source.rg.ReverseGeocode([]float64{latlng.Lng.Degrees(), latlng.Lat.Degrees()})
+	if err != nil || loc.Country == "" {
+		return rgeo.Location{}, false
+	}
+	return loc, true
+}
+
+// placeTags returns the tags of the country and the city or province of the
+// location
+func placeTags(loc rgeo.Location) []tag.Tag {
+	if loc.Country == "" {
+		return nil
+	}
+	tags := []tag.Tag{tag.NewPlace(loc.Country)}
+	if local := placeLocalName(loc); local != "" {
+		tags = append(tags, tag.NewPlace(loc.Country, local))
+	}
+	return tags
+}
+
+// isPlaceTag reports whether the tag is one of the place tags of the location
+func isPlaceTag(loc rgeo.Location, name string) bool {
+	for _, t := range placeTags(loc) {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func placeLocalName(loc rgeo.Location) string {
+	if loc.City != "" {
+		return loc.City
+	}
+	return loc.Province
+}
+
+// indexPlaces tags the file with the places at the location, replacing the
+// place tags it had before
+func (source *Source) indexPlaces(id ImageId, latlng s2.LatLng) {
+	if !source.Config.TagConfig.Places.Enable || source.rg == nil {
+		return
+	}
+	var tags []tag.Tag
+	if loc, ok := source.reverseGeocodeLocation(latlng); ok {
+		tags = placeTags(loc)
+	}
+	source.replaceTags(id, tag.PlacePrefix, tags)
+}
+
+// ListPlaces lists the places the photos in the dirs were taken at, with the
+// most photos first. Only places with names containing q are listed if set.
+func (source *Source) ListPlaces(dirs []string, q string, limit int) []Place {
+	tags := source.database.ListTagsWithPrefix(tag.PlacePrefix)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	type file struct {
+		id     ImageId
+		latlng s2.LatLng
+	}
+	// Newest first, so that the first file of each place is its cover
+	var files []file
+	index := make(map[ImageId]int)
+	for info := range source.ListInfos(dirs, ListOptions{OrderBy: DateDesc}) {
+		index[info.Id] = len(files)
+		files = append(files, file{id: info.Id, latlng: info.LatLng})
+	}
+
+	q = strings.ToLower(q)
+	places := make([]Place, 0, len(tags))
+	for _, t := range tags {
+		count := 0
+		cover := -1
+		for r := range source.database.ListTagRanges(t.Id) {
+			for id := r.Low; id <= r.High; id++ {
+				i, ok := index[ImageId(id)]
+				if !ok {
+					continue
+				}
+				count++
+				if cover < 0 || i < cover {
+					cover = i
+				}
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		f := files[cover]
+		p := Place{
+			Tag:    t.Name,
+			Kind:   PlaceCountry,
+			Count:  count,
+			Cover:  f.id,
+			LatLng: f.latlng,
+		}
+		if strings.Count(strings.TrimPrefix(t.Name, tag.PlacePrefix), ":") > 0 {
+			p.Kind = PlaceCity
+		}
+		if loc, ok := source.reverseGeocodeLocation(f.latlng); ok && isPlaceTag(loc, t.Name) {
+			p.Country = loc.Country
+			p.Name = loc.Country
+			if p.Kind == PlaceCity {
+				p.Name = placeLocalName(loc)
+			}
+		} else {
+			// Named after the tag if the cover was moved since it was tagged
+			levels := strings.Split(t.Name, ":")
+			p.Name = levels[len(levels)-1]
+		}
+		if q != "" && !strings.Contains(strings.ToLower(p.Name), q) && !strings.Contains(t.Name, q) {
+			continue
+		}
+		places = append(places, p)
+	}
+
+	sort.SliceStable(places, func(i, j int) bool {
+		if places[i].Count != places[j].Count {
+			return places[i].Count > places[j].Count
+		}
+		return places[i].Name < places[j].Name
+	})
+	if limit > 0 && len(places) > limit {
+		places = places[:limit]
+	}
+	return places
+}
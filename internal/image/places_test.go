@@ -0,0 +1,35 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sams96/rgeo"
+)
+
+func TestPlaceTags(t *testing.T) {
+	cases := []struct {
+		loc  rgeo.Location
+		tags []string
+	}{
+		{rgeo.Location{Country: "Germany", Province: "Berlin", City: "Berlin"}, []string{"place:germany", "place:germany:berlin"}},
+		{rgeo.Location{Country: "United States of America", Province: "New York", City: "New York"}, []string{"place:united-states-of-america", "place:united-states-of-america:new-york"}},
+		{rgeo.Location{Country: "Spain", Province: "Valencia"}, []string{"place:spain", "place:spain:valencia"}},
+		{rgeo.Location{Country: "Slovenia"}, []string{"place:slovenia"}},
+		{rgeo.Location{}, nil},
+	}
+	for _, c := range cases {
+		var names []string
+		for _, tag := range placeTags(c.loc) {
+			names = append(names, tag.Name)
+		}
+		if !reflect.DeepEqual(names, c.tags) {
+			t.Errorf("%+v: expected %v, got %v", c.loc, c.tags, names)
+		}
+		for _, name := range c.tags {
+			if !isPlaceTag(c.loc, name) {
+				t.Errorf("%+v: expected %s to be a place tag", c.loc, name)
+			}
+		}
+	}
+}
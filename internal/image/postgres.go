@@ -0,0 +1,741 @@
+package image
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/metrics"
+	"photofield/tag"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Postgres is the cache database on a PostgreSQL server, so that it can be
+// shared and backed up along with other databases. The embeddings are still
+// kept in the data dir, same as with the sqlite Database.
+type Postgres struct {
+	writeQueue
+	url  string
+	dir  string
+	pool *pgxpool.Pool
+	// Connections of the role SQL queries run as, nil if not configured
+	queryPool *pgxpool.Pool
+	// Connections in the pool
+	poolSize int
+	events   events
+	// Set if another process writes the database
+	readOnly bool
+	embeddingStore
+	config DatabaseConfig
+}
+
+var _ Store = (*Postgres)(nil)
+
+// NewPostgres connects to the cache database at the url, migrating it and
+// starting its writer unless it is read-only, in which case the writes are
+// rejected with ErrReadOnly. The embeddings are kept in the dir.
+func NewPostgres(url string, migrations fs.FS, readOnly bool, config DatabaseConfig, embeddings EmbeddingsConfig, dir string) *Postgres {
+
+	var err error
+
+	source := Postgres{}
+	source.url = url
+	source.dir = dir
+	source.readOnly = readOnly
+	source.config = config
+	if source.config.CommitIntervalMs <= 0 {
+		source.config.CommitIntervalMs = 200
+	}
+	if source.config.QueueSize <= 0 {
+		source.config.QueueSize = 10000
+	}
+	if !readOnly {
+		source.migrate(migrations)
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		panic(err)
+	}
+	if poolConfig.MaxConns < poolSize {
+		poolConfig.MaxConns = poolSize
+	}
+	source.poolSize = int(poolConfig.MaxConns)
+	source.pool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	if config.QueryUrl != "" {
+		queryConfig, err := pgxpool.ParseConfig(config.QueryUrl)
+		if err != nil {
+			panic(err)
+		}
+		// Connected on the first query, so that a missing role only fails
+		// the queries
+		queryConfig.LazyConnect = true
+		source.queryPool, err = pgxpool.ConnectConfig(context.Background(), queryConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	source.vectors, err = openEmbeddings(dir, readOnly)
+	if err != nil {
+		panic(err)
+	}
+	if err := source.openQuantizedEmbeddings(dir, readOnly, embeddings); err != nil {
+		panic(err)
+	}
+
+	source.pending = make(chan *InfoWrite, source.config.QueueSize)
+	if readOnly {
+		go source.rejectPendingWrites()
+	} else {
+		go source.writePendingInfosPostgres()
+	}
+
+	return &source
+}
+
+func (source *Postgres) migrate(migrations fs.FS) {
+	dbsource, err := httpfs.New(http.FS(migrations), "db/migrations-postgres")
+	if err != nil {
+		panic(err)
+	}
+	// The pgx driver of migrate is registered for its own scheme
+	url := source.url
+	for _, scheme := range []string{"postgres://", "postgresql://"} {
+		if strings.HasPrefix(url, scheme) {
+			url = "pgx://" + strings.TrimPrefix(url, scheme)
+		}
+	}
+	m, err := migrate.NewWithSourceInstance(
+		"migrations",
+		dbsource,
+		url,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		panic(err)
+	}
+
+	dirtystr := ""
+	if dirty {
+		dirtystr = " (dirty)"
+	}
+	dbLog.Info("cache database migrating if needed", "version", version, "dirty", dirtystr)
+
+	err = m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		panic(err)
+	}
+
+	serr, derr := m.Close()
+	if serr != nil {
+		panic(serr)
+	}
+	if derr != nil {
+		panic(derr)
+	}
+}
+
+// Stats returns the size of the database and the state of its writer. The
+// path is the server and database, leaving out the credentials.
+func (source *Postgres) Stats() DatabaseStats {
+	conn := source.pool.Config().ConnConfig
+	stats := DatabaseStats{
+		Path:          fmt.Sprintf("postgres://%s/%s", conn.Host+":"+strconv.Itoa(int(conn.Port)), conn.Database),
+		Pool:          source.poolSize,
+		PendingWrites: len(source.pending),
+		MaxWrites:     cap(source.pending),
+		InTransaction: source.writing.Load(),
+		ReadOnly:      source.readOnly,
+		Embeddings:    source.vectors.Len(),
+	}
+	row, exists, err := pgQueryRow(source.pool, `SELECT pg_database_size(current_database());`)
+	if err != nil {
+		dbLog.Error("unable to get database size", "err", err)
+	} else if exists {
+		stats.Size = row.Int64(0)
+	}
+	if fi, err := os.Stat(filepath.Join(source.dir, embeddingsName)); err == nil {
+		stats.EmbeddingsSize = fi.Size()
+	}
+	return stats
+}
+
+func (source *Postgres) Vacuum() error {
+	dbLog.Info("database vacuuming")
+	defer metrics.Elapsed("database vacuum")()
+
+	_, err := source.pool.Exec(context.Background(), "VACUUM (ANALYZE);")
+	return err
+}
+
+// Export copies the rows of the provided files, including their metadata,
+// cameras, captions, locations, orientation edits, embeddings and
+// non-system tags, into the sqlite database at dstPath, keeping their ids,
+// but using their new paths.
+func (source *Postgres) Export(dstPath string, migrations fs.FS, files []ExportFile) (err error) {
+	dst := Database{path: dstPath}
+	dst.migrate(migrations)
+
+	conn, err := sqlite.OpenConn(dstPath, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	defer metrics.Elapsed("database export")()
+
+	paths := make(map[ImageId]string, len(files))
+	ids := make([]int64, 0, len(files))
+	for _, file := range files {
+		if _, ok := paths[file.Id]; !ok {
+			ids = append(ids, int64(file.Id))
+		}
+		paths[file.Id] = file.Path
+	}
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	exec := func(sql string, args ...interface{}) error {
+		return sqlitex.Execute(conn, sql, &sqlitex.ExecOptions{Args: args})
+	}
+
+	exported := make([]int64, 0, len(ids))
+	err = pgQuery(source.pool, `
+		SELECT
+			id, width, height, created_at_unix, created_at_tz_offset,
+			color, orientation, latitude, longitude, hash, sha256,
+			hash_modified_at_unix, camera_id
+		FROM infos
+		WHERE id = ANY(?)
+		ORDER BY id;`, []interface{}{ids}, func(row pgRow) error {
+		id := ImageId(row.Int64(0))
+		dir, filename := filepath.Split(paths[id])
+		err := exec(`
+			INSERT OR IGNORE INTO prefix(str)
+			VALUES (?);`, dir)
+		if err != nil {
+			return err
+		}
+		err = exec(`
+			INSERT OR REPLACE INTO infos(
+				id, path_prefix_id, filename,
+				width, height, created_at_unix, created_at_tz_offset,
+				color, orientation, latitude, longitude, hash, sha256,
+				hash_modified_at_unix, camera_id
+			)
+			SELECT ?, prefix.id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+			FROM prefix
+			WHERE str == ?;`,
+			int64(id), filename,
+			row[1], row[2], row[3], row[4], row[5], row[6], row[7], row[8], row[9], row[10], row[11], row[12],
+			dir,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to add file %d: %w", id, err)
+		}
+		exported = append(exported, int64(id))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT id, make, model, serial, clock_offset
+		FROM camera
+		WHERE id IN (
+			SELECT camera_id
+			FROM infos
+			WHERE id = ANY(?)
+		);`, []interface{}{exported}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO camera(id, make, model, serial, clock_offset)
+			VALUES (?, ?, ?, ?, ?);`, row.Int64(0), row.Text(1), row.Text(2), row.Text(3), row.Int64(4))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT file_id, embedded, edited, edited_at_unix
+		FROM caption
+		WHERE file_id = ANY(?);`, []interface{}{exported}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO caption(file_id, embedded, edited, edited_at_unix)
+			VALUES (?, ?, ?, ?);`, row.Int64(0), row[1], row[2], row[3])
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT file_id, latitude, longitude, tagged_at_unix, edited
+		FROM geotag
+		WHERE file_id = ANY(?);`, []interface{}{exported}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO geotag(file_id, latitude, longitude, tagged_at_unix, edited)
+			VALUES (?, ?, ?, ?, ?);`, row.Int64(0), row.Float(1), row.Float(2), row.Int64(3), row.Bool(4))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT file_id, orientation, edited_at_unix
+		FROM orientation_edit
+		WHERE file_id = ANY(?);`, []interface{}{exported}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO orientation_edit(file_id, orientation, edited_at_unix)
+			VALUES (?, ?, ?);`, row.Int64(0), row.Int64(1), row.Int64(2))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT file_id, inv_norm
+		FROM clip_emb
+		WHERE file_id = ANY(?);`, []interface{}{exported}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO clip_emb(file_id, inv_norm, embedding)
+			VALUES (?, ?, x'');`, row.Int64(0), row.Int64(1))
+	})
+	if err != nil {
+		return err
+	}
+
+	tags := make([]int64, 0)
+	tagged := make(map[int64]struct{})
+	err = pgQuery(source.pool, `
+		SELECT DISTINCT infos_tag.tag_id, export.id
+		FROM unnest(?::bigint[]) AS export(id)
+		JOIN infos_tag
+		ON export.id >= infos_tag.file_id AND export.id <= infos_tag.file_id + infos_tag.len
+		JOIN tag ON tag.id = infos_tag.tag_id
+		WHERE tag.name NOT LIKE 'sys:%';`, []interface{}{exported}, func(row pgRow) error {
+		if _, ok := tagged[row.Int64(0)]; !ok {
+			tagged[row.Int64(0)] = struct{}{}
+			tags = append(tags, row.Int64(0))
+		}
+		return exec(`
+			INSERT OR IGNORE INTO infos_tag(tag_id, file_id, len)
+			VALUES (?, ?, 0);`, row.Int64(0), row.Int64(1))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pgQuery(source.pool, `
+		SELECT id, revision, name, color, icon, description, pinned
+		FROM tag
+		WHERE id = ANY(?);`, []interface{}{tags}, func(row pgRow) error {
+		return exec(`
+			INSERT OR REPLACE INTO tag(id, revision, name, color, icon, description, pinned)
+			VALUES (?, ?, ?, ?, ?, ?, ?);`, row.Int64(0), row.Int64(1), row.Text(2), row[3], row[4], row[5], row.Bool(6))
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, id := range exported {
+		err = exec(`
+			INSERT INTO changes(file_id, op, path, changed_at_unix)
+			VALUES (?, ?, ?, ?);`, id, string(ChangeAdded), paths[ImageId(id)], now)
+		if err != nil {
+			return err
+		}
+	}
+	return source.exportEmbeddings(dstPath, files)
+}
+
+// ErrQueryRole is returned by SQL queries against postgres unless they can
+// run as a role that can only read the database
+var ErrQueryRole = errors.New("SQL queries against postgres need database.query_url to connect as a role that can only read")
+
+// pgServerFunctions read or write files of the server, run programs or
+// connect to other servers. Queries are rejected if their role can call any
+// of them, as a read-only transaction does not prevent that.
+var pgServerFunctions = []string{
+	"pg_read_file", "pg_read_binary_file", "pg_stat_file",
+	"pg_ls_dir", "pg_ls_logdir", "pg_ls_waldir", "pg_ls_tmpdir", "pg_ls_archive_statusdir",
+	"lo_import", "lo_export",
+	"dblink", "dblink_connect", "dblink_connect_u", "dblink_exec", "dblink_open", "dblink_send_query",
+}
+
+// checkQueryRole returns ErrQueryRole if the current role of the
+// transaction is a superuser, can access server files or programs, or can
+// call any of pgServerFunctions
+func checkQueryRole(tx pgx.Tx) error {
+	row, exists, err := pgQueryRow(tx, `
+		SELECT
+			current_user,
+			rolsuper
+				OR pg_has_role(current_user, 'pg_read_server_files', 'MEMBER')
+				OR pg_has_role(current_user, 'pg_write_server_files', 'MEMBER')
+				OR pg_has_role(current_user, 'pg_execute_server_program', 'MEMBER'),
+			coalesce((
+				SELECT string_agg(DISTINCT proname, ', ')
+				FROM pg_proc
+				WHERE proname::text = ANY(?::text[]) AND has_function_privilege(pg_proc.oid, 'EXECUTE')
+			), '')
+		FROM pg_roles
+		WHERE rolname = current_user;`, pgServerFunctions)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrQueryRole
+	}
+	if row.Bool(1) {
+		return fmt.Errorf("%w, %s can access the server", ErrQueryRole, row.Text(0))
+	}
+	if functions := row.Text(2); functions != "" {
+		return fmt.Errorf("%w, %s can call %s", ErrQueryRole, row.Text(0), functions)
+	}
+	return nil
+}
+
+// Query runs the read-only SQL statement against the cache database in a
+// read-only transaction as the role of database.query_url, calling columns
+// with the column names and then row with the values of each row, until
+// maxRows rows were returned or the context is done. Returns true if there
+// were more rows.
+func (source *Postgres) Query(ctx context.Context, sql string, maxRows int, columns func(names []string) error, row func(values []any) error) (bool, error) {
+	if err := checkReadOnlyQuery(sql); err != nil {
+		return false, err
+	}
+
+	// The writer role is never used, as functions like set_config could
+	// switch back to it from any role it is a member of
+	if source.queryPool == nil {
+		return false, ErrQueryRole
+	}
+	tx, err := source.queryPool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := checkQueryRole(tx); err != nil {
+		return false, err
+	}
+
+	// Prepared, so that more than one statement is rejected by the server
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ErrQueryInterrupted
+		}
+		return false, err
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = string(f.Name)
+	}
+
+	// Read once before reporting the columns, so that most errors are
+	// reported before any rows
+	exists := rows.Next()
+	for n := 0; ; n++ {
+		if err := rows.Err(); err != nil {
+			if ctx.Err() != nil {
+				return false, ErrQueryInterrupted
+			}
+			return false, err
+		}
+		if n == 0 {
+			if err := columns(names); err != nil {
+				return false, err
+			}
+		}
+		if !exists {
+			return false, nil
+		}
+		if n >= maxRows {
+			return true, nil
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return false, err
+		}
+		for i, v := range values {
+			values[i] = pgValue(v)
+		}
+		if err := row(values); err != nil {
+			return false, err
+		}
+		exists = rows.Next()
+	}
+}
+
+// Subscribe calls the listener for every event committed to the database
+func (source *Postgres) Subscribe(listener func(Event)) {
+	source.events.mutex.Lock()
+	defer source.events.mutex.Unlock()
+	source.events.listeners = append(source.events.listeners, listener)
+}
+
+// Publish calls the listeners for events that are not committed with a
+// write, e.g. the ones found while verifying files
+func (source *Postgres) Publish(events []Event) {
+	source.events.publish(events)
+}
+
+func (source *Postgres) AddTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(AddTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Postgres) RemoveTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(RemoveTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Postgres) InvertTagIds(id tag.Id, ids Ids) (int, error) {
+	return source.writeTagIds(InvertTagIds, id, ids, source.GetTagRevision)
+}
+
+func (source *Postgres) MergeTag(from tag.Id, into tag.Id) (int, error) {
+	if from == into {
+		return 0, ErrMergeIntoItself
+	}
+	if _, ok := source.GetTagName(from); !ok {
+		return 0, ErrNotFound
+	}
+	if _, ok := source.GetTagName(into); !ok {
+		return 0, ErrNotFound
+	}
+
+	return source.mergeTag(from, into)
+}
+
+func (source *Postgres) RollbackTagIds(id tag.Id, revision int) (int, error) {
+	current, err := source.GetTagRevision(id)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	err = pgCheckTagRevisions(source.pool, id, revision, current)
+	if err != nil {
+		return 0, err
+	}
+	if revision == current {
+		return current, nil
+	}
+
+	return source.rollbackTagIds(id, revision)
+}
+
+func (source *Postgres) ScanEmbeddings(dirs []string, options ListOptions, fn func(EmbeddingsResult)) {
+	defer metrics.Elapsed("scan embeddings")()
+
+	source.scanEmbeddings(source.listEmbeddingIds(dirs, options), fn)
+}
+
+func (source *Postgres) ScanQuantizedEmbeddings(dirs []string, options ListOptions, fn func(QuantizedEmbedding)) bool {
+	if !source.quantizedComplete() {
+		return false
+	}
+
+	defer metrics.Elapsed("scan quantized embeddings")()
+
+	source.scanQuantizedEmbeddings(source.listEmbeddingIds(dirs, options), fn)
+	return true
+}
+
+// pgQuerier runs statements on the pool or in a transaction
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// pgRow is a row of decoded values, read with the zero values for NULL
+// like the column getters of sqlite statements
+type pgRow []interface{}
+
+func (row pgRow) Null(i int) bool {
+	return row[i] == nil
+}
+
+func (row pgRow) Int64(i int) int64 {
+	switch v := row[i].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (row pgRow) Int(i int) int {
+	return int(row.Int64(i))
+}
+
+func (row pgRow) Float(i int) float64 {
+	switch v := row[i].(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+func (row pgRow) Bool(i int) bool {
+	if v, ok := row[i].(bool); ok {
+		return v
+	}
+	return row.Int64(i) != 0
+}
+
+func (row pgRow) Text(i int) string {
+	switch v := row[i].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// pgValue widens the decoded value to the types sqlite columns are read as,
+// int64, float64, string or []byte, keeping booleans and times as they are
+func pgValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, int64, float64, string, []byte, bool, time.Time:
+		return v
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return nil
+		}
+		return pgValue(value)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// rebind numbers the ? placeholders of the statement as $1, $2 and so on,
+// so that the statements can be written the same as for sqlite
+func rebind(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql) + 16)
+	n := 0
+	quoted := false
+	for _, r := range sql {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// pgLimit returns the LIMIT parameter of the limit, NULL for no limit if it
+// is negative like sqlite allows
+func pgLimit(limit int) interface{} {
+	if limit < 0 {
+		return nil
+	}
+	return int64(limit)
+}
+
+// errPgDone is returned by the row functions of pgQuery to stop reading
+// rows early without failing
+var errPgDone = errors.New("done")
+
+// pgQuery calls fn with every row of the statement, until it returns
+// errPgDone or another error
+func pgQuery(q pgQuerier, sql string, args []interface{}, fn func(row pgRow) error) error {
+	rows, err := q.Query(context.Background(), rebind(sql), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			values[i] = pgValue(v)
+		}
+		if err := fn(values); err == errPgDone {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// pgQueryRow returns the first row of the statement, false if there is none
+func pgQueryRow(q pgQuerier, sql string, args ...interface{}) (pgRow, bool, error) {
+	var row pgRow
+	err := pgQuery(q, sql, args, func(r pgRow) error {
+		if row == nil {
+			row = r
+		}
+		return nil
+	})
+	return row, row != nil, err
+}
+
+// pgExec runs the statement, returning the number of rows it changed
+func pgExec(q pgQuerier, sql string, args ...interface{}) (int64, error) {
+	tag, err := q.Exec(context.Background(), rebind(sql), args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
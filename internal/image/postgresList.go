@@ -0,0 +1,1486 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/metrics"
+	"photofield/io/gpano"
+
+	"github.com/golang/geo/s2"
+)
+
+// pgDirArgs returns the arguments of dirsCondition for the dirs
+func pgDirArgs(dirs []string) []interface{} {
+	args := make([]interface{}, 0, len(dirs))
+	for _, dir := range dirs {
+		args = append(args, dir+"%")
+	}
+	return args
+}
+
+// pgDateTime returns the capture time stored as unix seconds and a timezone
+// offset in minutes at the columns, true if it is null
+func pgDateTime(row pgRow, unix int, offset int) (time.Time, bool) {
+	t := time.Unix(row.Int64(unix), 0).In(time.FixedZone("tz_offset", row.Int(offset)*60))
+	return t, row.Null(unix)
+}
+
+// pgLatLng returns the location at the latitude and longitude columns, NaN
+// and true if either is null
+func pgLatLng(row pgRow, lat int, lng int) (s2.LatLng, bool) {
+	if row.Null(lat) || row.Null(lng) {
+		return NaNLatLng(), true
+	}
+	return s2.LatLngFromDegrees(row.Float(lat), row.Float(lng)), false
+}
+
+func (source *Postgres) GetPathFromId(id ImageId) (string, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT str || filename as path
+		FROM infos
+		JOIN prefix ON path_prefix_id = prefix.id
+		WHERE infos.id = ?;`, int64(id))
+	if err != nil || !exists {
+		return "", false
+	}
+	return row.Text(0), true
+}
+
+func (source *Postgres) GetIdFromPath(path string) (ImageId, bool) {
+	dir, file := filepath.Split(path)
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT infos.id
+		FROM infos
+		JOIN prefix ON path_prefix_id = prefix.id
+		WHERE str = ? AND filename = ?;`, dir, file)
+	if err != nil || !exists {
+		return 0, false
+	}
+	return ImageId(row.Int64(0)), true
+}
+
+func (source *Postgres) ListPrefixes() []string {
+	prefixes := make([]string, 0)
+	err := pgQuery(source.pool, `
+		SELECT str
+		FROM prefix
+		WHERE EXISTS (
+			SELECT 1
+			FROM infos
+			WHERE path_prefix_id = prefix.id
+		);`, nil, func(row pgRow) error {
+		prefixes = append(prefixes, row.Text(0))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing prefixes", "err", err)
+	}
+	return prefixes
+}
+
+func (source *Postgres) RenameDirs(rename func(string) string) (err error) {
+	paths := make([]string, 0)
+	err = pgQuery(source.pool, `SELECT path FROM dirs;`, nil, func(row pgRow) error {
+		paths = append(paths, row.Text(0))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := source.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, path := range paths {
+		renamed := rename(path)
+		if renamed == path {
+			continue
+		}
+		_, err = pgExec(tx, `
+			INSERT INTO dirs(path, indexed_at)
+			SELECT ?, indexed_at
+			FROM dirs
+			WHERE path = ?
+			ON CONFLICT DO NOTHING;`, renamed, path)
+		if err != nil {
+			return err
+		}
+		_, err = pgExec(tx, `DELETE FROM dirs WHERE path = ?;`, path)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func pgCamera(row pgRow) Camera {
+	return Camera{
+		Id:          CameraId(row.Int64(0)),
+		Make:        row.Text(1),
+		Model:       row.Text(2),
+		Serial:      row.Text(3),
+		ClockOffset: time.Duration(row.Int64(4)) * time.Second,
+	}
+}
+
+func (source *Postgres) ListCameras() []Camera {
+	cameras := make([]Camera, 0)
+	err := pgQuery(source.pool, `
+		SELECT id, make, model, serial, clock_offset
+		FROM camera
+		ORDER BY make, model, serial;`, nil, func(row pgRow) error {
+		cameras = append(cameras, pgCamera(row))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing cameras", "err", err)
+	}
+	return cameras
+}
+
+func (source *Postgres) GetCamera(id CameraId) (Camera, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT id, make, model, serial, clock_offset
+		FROM camera
+		WHERE id = ?;`, int64(id))
+	if err != nil || !exists {
+		return Camera{}, false
+	}
+	return pgCamera(row), true
+}
+
+func (source *Postgres) GetFileCamera(id ImageId) (Camera, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT camera.id, make, model, serial, clock_offset
+		FROM infos
+		JOIN camera ON camera_id = camera.id
+		WHERE infos.id = ?;`, int64(id))
+	if err != nil || !exists {
+		return Camera{}, false
+	}
+	return pgCamera(row), true
+}
+
+func (source *Postgres) ListCameraIds(id CameraId) <-chan ImageId {
+	out := make(chan ImageId, 1000)
+	go func() {
+		defer close(out)
+
+		err := pgQuery(source.pool, `
+			SELECT id
+			FROM infos
+			WHERE camera_id = ?;`, []interface{}{int64(id)}, func(row pgRow) error {
+			out <- ImageId(row.Int64(0))
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing camera files", "err", err)
+		}
+	}()
+	return out
+}
+
+func pgOrientationProposal(row pgRow) OrientationProposal {
+	return OrientationProposal{
+		Id:          ImageId(row.Int64(0)),
+		Orientation: Orientation(row.Int(1)),
+		Confidence:  float32(row.Float(2)),
+		Status:      OrientationStatus(row.Text(3)),
+		CreatedAt:   time.Unix(row.Int64(4), 0),
+	}
+}
+
+func (source *Postgres) GetOrientationProposal(id ImageId) (OrientationProposal, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT file_id, orientation, confidence, status, created_at_unix
+		FROM orientation_proposal
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return OrientationProposal{}, false
+	}
+	return pgOrientationProposal(row), true
+}
+
+func (source *Postgres) ListOrientationProposals(dirs []string, limit int) []OrientationProposal {
+	sql := `
+		SELECT file_id, orientation_proposal.orientation, confidence, status, created_at_unix
+		FROM orientation_proposal
+		JOIN infos ON infos.id = file_id
+		WHERE status = 'pending' AND ` + dirsCondition(dirs) + `
+		ORDER BY confidence DESC
+		LIMIT ?;`
+	if limit <= 0 {
+		limit = -1
+	}
+	args := append(pgDirArgs(dirs), pgLimit(limit))
+
+	proposals := make([]OrientationProposal, 0)
+	err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+		proposals = append(proposals, pgOrientationProposal(row))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing orientation proposals", "err", err)
+	}
+	return proposals
+}
+
+func (source *Postgres) ListOrientationCandidates(dirs []string, limit int) <-chan IdPath {
+	out := make(chan IdPath, 1000)
+	go func() {
+		defer metrics.Elapsed("list orientation candidates postgres")()
+		defer close(out)
+
+		sql := `
+			SELECT infos.id, str || filename as path
+			FROM infos
+			INNER JOIN prefix ON prefix.id = path_prefix_id
+			LEFT JOIN orientation_proposal ON orientation_proposal.file_id = infos.id
+			LEFT JOIN orientation_edit ON orientation_edit.file_id = infos.id
+			WHERE
+				infos.orientation IN (0, 1) AND
+				camera_id IS NULL AND
+				orientation_proposal.file_id IS NULL AND
+				orientation_edit.file_id IS NULL AND
+				` + dirsCondition(dirs) + `
+			LIMIT ?;`
+		if limit <= 0 {
+			limit = -1
+		}
+		args := append(pgDirArgs(dirs), pgLimit(limit))
+
+		err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+			out <- IdPath{
+				Id:   ImageId(row.Int64(0)),
+				Path: row.Text(1),
+			}
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing orientation candidates", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListOrientationEdits() map[ImageId]Orientation {
+	edits := make(map[ImageId]Orientation)
+	err := pgQuery(source.pool, `
+		SELECT file_id, orientation
+		FROM orientation_edit;`, nil, func(row pgRow) error {
+		edits[ImageId(row.Int64(0))] = Orientation(row.Int(1))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing orientation edits", "err", err)
+	}
+	return edits
+}
+
+func (source *Postgres) GetVideo(id ImageId) (Video, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT duration_ms, codec, frame_rate, chapters
+		FROM video
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return Video{}, false
+	}
+	v := Video{
+		Duration:  time.Duration(row.Int64(0)) * time.Millisecond,
+		Codec:     row.Text(1),
+		FrameRate: row.Float(2),
+	}
+	if chapters := row.Text(3); chapters != "" {
+		v.Chapters, err = unmarshalChapters([]byte(chapters))
+		if err != nil {
+			dbLog.Error("unable to read chapters of video", "id", id, "err", err)
+		}
+	}
+	return v, true
+}
+
+func (source *Postgres) GetAudio(id ImageId) (Audio, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT path, duration_ms
+		FROM audio
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return Audio{}, false
+	}
+	return Audio{
+		Path:     row.Text(0),
+		Duration: time.Duration(row.Int64(1)) * time.Millisecond,
+	}, true
+}
+
+func (source *Postgres) GetMotionPhoto(id ImageId) (MotionPhoto, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT "offset", length
+		FROM motion_photo
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return MotionPhoto{}, false
+	}
+	return MotionPhoto{
+		Offset: row.Int64(0),
+		Length: row.Int64(1),
+	}, true
+}
+
+func (source *Postgres) GetProjection(id ImageId) (gpano.Projection, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT type, full_width, full_height, cropped_left, cropped_top, cropped_width, cropped_height, pose_heading
+		FROM projection
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return gpano.Projection{}, false
+	}
+	return gpano.Projection{
+		Type:          row.Text(0),
+		FullWidth:     row.Int(1),
+		FullHeight:    row.Int(2),
+		CroppedLeft:   row.Int(3),
+		CroppedTop:    row.Int(4),
+		CroppedWidth:  row.Int(5),
+		CroppedHeight: row.Int(6),
+		PoseHeading:   row.Float(7),
+	}, true
+}
+
+func pgSidecarFile(row pgRow) SidecarFile {
+	return SidecarFile{
+		Path:     row.Text(0),
+		Id:       ImageId(row.Int64(1)),
+		Kind:     row.Text(2),
+		Modified: time.Unix(row.Int64(3), 0),
+	}
+}
+
+func (source *Postgres) GetSidecarFile(path string) (SidecarFile, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT path, file_id, kind, modified_unix
+		FROM sidecar_file
+		WHERE path = ?;`, path)
+	if err != nil || !exists {
+		return SidecarFile{}, false
+	}
+	return pgSidecarFile(row), true
+}
+
+func (source *Postgres) ListSidecarFiles(id ImageId) []SidecarFile {
+	var files []SidecarFile
+	err := pgQuery(source.pool, `
+		SELECT path, file_id, kind, modified_unix
+		FROM sidecar_file
+		WHERE file_id = ?
+		ORDER BY path;`, []interface{}{int64(id)}, func(row pgRow) error {
+		files = append(files, pgSidecarFile(row))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing sidecar files", "err", err)
+	}
+	return files
+}
+
+func (source *Postgres) GetGeotag(id ImageId) (Geotag, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT latitude, longitude, edited
+		FROM geotag
+		WHERE file_id = ?;`, int64(id))
+	if err != nil || !exists {
+		return Geotag{LatLng: NaNLatLng()}, false
+	}
+	return Geotag{
+		LatLng: s2.LatLngFromDegrees(row.Float(0), row.Float(1)),
+		Edited: row.Bool(2),
+	}, true
+}
+
+const pgTripColumns = `
+	SELECT id, collection_id, name, start_unix, end_unix, latitude, longitude, cover_id,
+		(SELECT count(*) FROM trip_file WHERE trip_id = trip.id)
+	FROM trip
+`
+
+func pgTrip(row pgRow) Trip {
+	t := Trip{
+		Id:         row.Int64(0),
+		Collection: row.Text(1),
+		Name:       row.Text(2),
+		Start:      time.Unix(row.Int64(3), 0),
+		End:        time.Unix(row.Int64(4), 0),
+		Cover:      ImageId(row.Int64(7)),
+		Count:      row.Int(8),
+	}
+	t.LatLng, _ = pgLatLng(row, 5, 6)
+	return t
+}
+
+func (source *Postgres) ListTrips(collection string, limit int) []Trip {
+	if limit <= 0 {
+		limit = -1
+	}
+	trips := make([]Trip, 0)
+	err := pgQuery(source.pool, pgTripColumns+`
+		WHERE collection_id = ?
+		ORDER BY start_unix DESC
+		LIMIT ?;`, []interface{}{collection, pgLimit(limit)}, func(row pgRow) error {
+		trips = append(trips, pgTrip(row))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing trips", "err", err)
+	}
+	return trips
+}
+
+func (source *Postgres) GetTrip(id int64) (Trip, bool) {
+	row, exists, err := pgQueryRow(source.pool, pgTripColumns+`
+		WHERE id = ?;`, id)
+	if err != nil {
+		dbLog.Error("error getting trip", "id", id, "err", err)
+		return Trip{}, false
+	}
+	if !exists {
+		return Trip{}, false
+	}
+	return pgTrip(row), true
+}
+
+func (source *Postgres) GetSetting(key string) (string, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT value
+		FROM setting
+		WHERE key = ?;`, key)
+	if err != nil || !exists {
+		return "", false
+	}
+	return row.Text(0), true
+}
+
+func (source *Postgres) WriteSetting(key string, value string) error {
+	_, err := pgExec(source.pool, `
+		INSERT INTO setting(key, value)
+		VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value;`, key, value)
+	return err
+}
+
+func (source *Postgres) Get(id ImageId) (InfoResult, bool) {
+	defer metrics.ObserveQuery("get")()
+
+	var info InfoResult
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude,
+			coalesce(caption.edited, caption.embedded, '')
+		FROM infos
+		LEFT JOIN caption ON caption.file_id = infos.id
+		WHERE id = ?;`, int64(id))
+	if err != nil || !exists {
+		return info, false
+	}
+
+	info.Width = row.Int(0)
+	info.Height = row.Int(1)
+	info.SizeNull = row.Null(0) || row.Null(1)
+
+	info.Orientation = Orientation(row.Int(2))
+	info.OrientationNull = row.Null(2)
+
+	info.Color = uint32(row.Int64(3))
+	info.ColorNull = row.Null(3)
+
+	info.DateTime, info.DateTimeNull = pgDateTime(row, 4, 5)
+	info.DateTimeNull = info.DateTimeNull || row.Null(5)
+
+	info.LatLng, info.LatLngNull = pgLatLng(row, 6, 7)
+
+	info.Description = row.Text(8)
+
+	return info, true
+}
+
+func (source *Postgres) GetBatch(ids []ImageId) <-chan InfoListResult {
+	out := make(chan InfoListResult, 1000)
+	go func() {
+		defer metrics.ObserveQuery("get_batch")()
+		defer close(out)
+
+		args := make([]int64, len(ids))
+		for i, id := range ids {
+			args[i] = int64(id)
+		}
+		err := pgQuery(source.pool, `
+			SELECT id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+			FROM infos
+			WHERE id = ANY(?);`, []interface{}{args}, func(row pgRow) error {
+			var info InfoListResult
+			info.Id = ImageId(row.Int64(0))
+
+			info.Width = row.Int(1)
+			info.Height = row.Int(2)
+			info.SizeNull = row.Null(1) || row.Null(2)
+
+			info.Orientation = Orientation(row.Int(3))
+			info.OrientationNull = row.Null(3)
+
+			info.Color = uint32(row.Int64(4))
+			info.ColorNull = row.Null(4)
+
+			info.DateTime, info.DateTimeNull = pgDateTime(row, 5, 6)
+
+			info.LatLng, info.LatLngNull = pgLatLng(row, 7, 8)
+
+			out <- info
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) GetDir(dir string) (InfoResult, bool) {
+	var imageInfo InfoResult
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT indexed_at FROM dirs
+		WHERE path = ?;`, dir)
+	if err != nil || !exists {
+		return imageInfo, false
+	}
+	imageInfo.DateTime, _ = row[0].(time.Time)
+	imageInfo.DateTimeNull = row.Null(0)
+	return imageInfo, true
+}
+
+func (source *Postgres) GetDirsCount(dirs []string) (int, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT COUNT(id)
+		FROM infos
+		WHERE `+dirsCondition(dirs)+`;`, pgDirArgs(dirs)...)
+	if err != nil {
+		dbLog.Error("error listing files", "err", err)
+	}
+	if !exists {
+		return 0, false
+	}
+	return row.Int(0), true
+}
+
+func (source *Postgres) GetHash(id ImageId) (ContentHash, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT hash, sha256
+		FROM infos
+		WHERE id = ? AND hash IS NOT NULL;`, int64(id))
+	if err != nil || !exists {
+		return ContentHash{}, false
+	}
+	return ContentHash{
+		Fast:   row.Text(0),
+		Sha256: row.Text(1),
+	}, true
+}
+
+func (source *Postgres) ListIdPathsByHash(hash string) []IdPath {
+	var ips []IdPath
+	err := pgQuery(source.pool, `
+		SELECT infos.id, str || filename as path, hash, sha256
+		FROM infos
+		JOIN prefix ON path_prefix_id = prefix.id
+		WHERE hash = ?;`, []interface{}{hash}, func(row pgRow) error {
+		ips = append(ips, IdPath{
+			Id:   ImageId(row.Int64(0)),
+			Path: row.Text(1),
+			Hash: ContentHash{
+				Fast:   row.Text(2),
+				Sha256: row.Text(3),
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing files by hash", "err", err)
+	}
+	return ips
+}
+
+func (source *Postgres) ListNonexistent(dir string, paths map[string]struct{}) <-chan IdPath {
+	source.WaitForCommit()
+	out := make(chan IdPath, 1000)
+	go func() {
+		for ip := range source.ListIdPaths([]string{dir}, 0) {
+			_, exists := paths[ip.Path]
+			if !exists {
+				out <- ip
+			}
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (source *Postgres) List(dirs []string, options ListOptions) <-chan InfoListResult {
+	out := make(chan InfoListResult, 1000)
+	go func() {
+		defer metrics.Elapsed("list infos postgres")()
+		defer metrics.ObserveQuery("list")()
+		defer close(out)
+
+		sql := ""
+		var args []interface{}
+
+		tags := options.Query.QualifierValues("tag")
+
+		var durations []DurationFilter
+		for _, value := range options.Query.QualifierValues("duration") {
+			f, err := ParseDurationFilter(value)
+			if err != nil {
+				dbLog.Warn("ignoring invalid duration filter", "err", err)
+				continue
+			}
+			durations = append(durations, f)
+		}
+
+		captions := options.Query.QualifierValues("caption")
+
+		var trips []int64
+		for _, value := range options.Query.QualifierValues("trip") {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				dbLog.Warn("ignoring invalid trip", "value", value)
+				continue
+			}
+			trips = append(trips, id)
+		}
+
+		if len(tags) > 0 {
+			sql += `
+			WITH
+			`
+			for i, tag := range tags {
+				if i > 0 {
+					sql += ","
+				}
+				sql += `
+				tag` + strconv.Itoa(i) + ` AS (
+					SELECT file_id, len
+					FROM infos_tag
+					WHERE tag_id IN (
+						SELECT id
+						FROM tag
+						WHERE name = ?
+					)
+				)
+				`
+				args = append(args, tag)
+			}
+		}
+
+		sql += `
+			SELECT infos.id, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+		`
+
+		if options.ignored != nil {
+			sql += `,
+				(SELECT str FROM prefix WHERE prefix.id = path_prefix_id) || filename
+			`
+		}
+
+		sql += `
+			FROM infos
+		`
+
+		for i := range tags {
+			sql += fmt.Sprintf(`
+				JOIN tag%[1]d ON id BETWEEN tag%[1]d.file_id AND tag%[1]d.file_id+tag%[1]d.len
+			`, i)
+		}
+
+		sql += `
+			WHERE ` + dirsCondition(dirs)
+		args = append(args, pgDirArgs(dirs)...)
+
+		// Files that failed to decode would only render as broken tiles
+		sql += `
+			AND infos.id NOT IN (
+				SELECT file_id
+				FROM quarantine
+			)
+		`
+
+		hidden := options.hiddenTags()
+		sql += hiddenTagsSql(len(hidden))
+		for _, tag := range hidden {
+			args = append(args, tag)
+		}
+
+		for _, f := range durations {
+			sql += `
+				AND infos.id IN (
+					SELECT file_id
+					FROM video
+					WHERE duration_ms ` + f.Op + ` ?
+				)
+			`
+			args = append(args, f.Value.Milliseconds())
+		}
+
+		for _, c := range captions {
+			sql += `
+				AND infos.id IN (
+					SELECT file_id
+					FROM caption
+					WHERE fts @@ to_tsquery('simple', ?)
+				)
+			`
+			args = append(args, captionTsQuery(c))
+		}
+
+		for _, id := range trips {
+			sql += `
+				AND infos.id IN (
+					SELECT file_id
+					FROM trip_file
+					WHERE trip_id = ?
+				)
+			`
+			args = append(args, id)
+		}
+
+		// Undated files are listed first when ascending like in sqlite
+		switch options.OrderBy {
+		case None:
+		case DateAsc:
+			sql += `
+			ORDER BY created_at_unix ASC NULLS FIRST
+			`
+		case DateDesc:
+			sql += `
+			ORDER BY created_at_unix DESC NULLS LAST
+			`
+		default:
+			panic("Unsupported listing order")
+		}
+
+		// Ignored files are filtered out after the query, so the limit
+		// needs to be applied afterwards as well
+		sqlLimit := options.Limit > 0 && options.ignored == nil
+		if sqlLimit {
+			sql += `
+				LIMIT ?
+			`
+			args = append(args, int64(options.Limit))
+		}
+
+		sql += ";"
+
+		count := 0
+		err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+			if options.ignored != nil {
+				if options.ignored(row.Text(9)) {
+					return nil
+				}
+				if options.Limit > 0 && count >= options.Limit {
+					return errPgDone
+				}
+			}
+			count++
+
+			var info InfoListResult
+			info.Id = ImageId(row.Int64(0))
+
+			info.Width = row.Int(1)
+			info.Height = row.Int(2)
+			info.SizeNull = row.Null(1) || row.Null(2)
+
+			info.Orientation = Orientation(row.Int(3))
+			info.OrientationNull = row.Null(3)
+
+			info.Color = uint32(row.Int64(4))
+			info.ColorNull = row.Null(4)
+
+			info.DateTime, info.DateTimeNull = pgDateTime(row, 5, 6)
+
+			info.LatLng, info.LatLngNull = pgLatLng(row, 7, 8)
+
+			out <- info
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+// listLimit returns the LIMIT clause and its arguments of the limit, none
+// if it is not positive
+func listLimit(limit int) (string, []interface{}) {
+	if limit <= 0 {
+		return "", nil
+	}
+	return `
+		LIMIT ?`, []interface{}{int64(limit)}
+}
+
+func (source *Postgres) ListPaths(dirs []string, limit int) <-chan string {
+	out := make(chan string, 10000)
+	go func() {
+		defer metrics.Elapsed("list paths postgres")()
+		defer close(out)
+
+		limitSql, limitArgs := listLimit(limit)
+		err := pgQuery(source.pool, `
+			SELECT str || filename as path
+			FROM infos
+			JOIN prefix ON path_prefix_id = prefix.id
+			WHERE `+dirsCondition(dirs)+limitSql+`;`, append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+			out <- row.Text(0)
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListIdPaths(dirs []string, limit int) <-chan IdPath {
+	out := make(chan IdPath, 10000)
+	go func() {
+		defer metrics.Elapsed("list id paths postgres")()
+		defer close(out)
+
+		limitSql, limitArgs := listLimit(limit)
+		err := pgQuery(source.pool, `
+			SELECT infos.id, str || filename as path, hash, sha256, hash_modified_at_unix
+			FROM infos
+			JOIN prefix ON path_prefix_id = prefix.id
+			WHERE `+dirsCondition(dirs)+limitSql+`;`, append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+			ip := IdPath{
+				Id:   ImageId(row.Int64(0)),
+				Path: row.Text(1),
+				Hash: ContentHash{
+					Fast:   row.Text(2),
+					Sha256: row.Text(3),
+				},
+			}
+			if !row.Null(4) {
+				ip.Hash.Modified = time.Unix(row.Int64(4), 0)
+			}
+			out <- ip
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListDirFiles(dir string) []DirFile {
+	var files []DirFile
+	err := pgQuery(source.pool, `
+		SELECT
+			infos.id, filename, hash, sha256,
+			width, height, orientation, created_at_unix, created_at_tz_offset, latitude, longitude,
+			make, model, serial, clock_offset, caption.embedded
+		FROM infos
+		JOIN prefix ON path_prefix_id = prefix.id
+		LEFT JOIN camera ON camera_id = camera.id
+		LEFT JOIN caption ON caption.file_id = infos.id
+		WHERE prefix.str = ?;`, []interface{}{dir}, func(row pgRow) error {
+		f := DirFile{
+			Id:   ImageId(row.Int64(0)),
+			Name: row.Text(1),
+			Hash: ContentHash{
+				Fast:   row.Text(2),
+				Sha256: row.Text(3),
+			},
+			Camera: Camera{
+				Make:   row.Text(11),
+				Model:  row.Text(12),
+				Serial: row.Text(13),
+				// Included in the stored dates
+				ClockOffset: time.Duration(row.Int64(14)) * time.Second,
+			},
+		}
+		f.Width = row.Int(4)
+		f.Height = row.Int(5)
+		f.SizeNull = row.Null(4) || row.Null(5)
+		f.Orientation = Orientation(row.Int(6))
+		f.OrientationNull = row.Null(6)
+		f.DateTime, f.DateTimeNull = pgDateTime(row, 7, 8)
+		f.LatLng, f.LatLngNull = pgLatLng(row, 9, 10)
+		// The embedded caption, as edits are stored separately
+		f.Description = row.Text(15)
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing dir files", "err", err)
+	}
+	return files
+}
+
+func (source *Postgres) ListIds(dirs []string, limit int, missingEmbedding bool) <-chan ImageId {
+	out := make(chan ImageId, 10000)
+	go func() {
+		defer metrics.Elapsed("list ids postgres")()
+		defer close(out)
+
+		sql := `
+			SELECT infos.id
+			FROM infos
+		`
+		if missingEmbedding {
+			sql += `
+			LEFT JOIN clip_emb ON clip_emb.file_id = infos.id
+			WHERE clip_emb.file_id IS NULL AND `
+		} else {
+			sql += `
+			WHERE `
+		}
+		limitSql, limitArgs := listLimit(limit)
+		sql += dirsCondition(dirs) + limitSql + ";"
+
+		err := pgQuery(source.pool, sql, append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+			out <- ImageId(row.Int64(0))
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListMissing(dirs []string, limit int, opts Missing) <-chan MissingInfo {
+	out := make(chan MissingInfo, 1000)
+	go func() {
+		defer metrics.Elapsed("list missing postgres")()
+		defer close(out)
+
+		// Column aliases cannot be used in the conditions, so the
+		// expressions are repeated there
+		var conds []string
+		if opts.Metadata {
+			conds = append(conds, `(width IS NULL OR height IS NULL OR orientation IS NULL OR created_at_unix IS NULL)`)
+		}
+		if opts.Color {
+			conds = append(conds, `(color IS NULL)`)
+		}
+		if opts.Embedding {
+			conds = append(conds, `(clip_emb.file_id IS NULL)`)
+		}
+
+		sql := `
+			SELECT infos.id, str || filename as path`
+		for _, c := range conds {
+			sql += `,
+				` + c
+		}
+		sql += `
+			FROM infos
+			INNER JOIN prefix ON prefix.id = path_prefix_id
+		`
+		if opts.Embedding {
+			sql += `
+			LEFT JOIN clip_emb ON clip_emb.file_id = infos.id
+			`
+		}
+		sql += `
+			WHERE ` + dirsCondition(dirs) + `
+			AND infos.id NOT IN (
+				SELECT file_id
+				FROM quarantine
+			)
+		`
+		if len(conds) > 0 {
+			sql += `
+			AND (` + strings.Join(conds, ` OR `) + `)
+			`
+		}
+		limitSql, limitArgs := listLimit(limit)
+		sql += limitSql + ";"
+
+		err := pgQuery(source.pool, sql, append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+			r := MissingInfo{
+				Id:   ImageId(row.Int64(0)),
+				Path: row.Text(1),
+			}
+			i := 2
+			if opts.Metadata {
+				r.Metadata = row.Bool(i)
+				i++
+			}
+			if opts.Color {
+				r.Color = row.Bool(i)
+				i++
+			}
+			if opts.Embedding {
+				r.Embedding = row.Bool(i)
+				i++
+			}
+			out <- r
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+// pathsCondition returns the condition matching the changes of the files in
+// the dirs, with one parameter per dir
+func pathsCondition(dirs []string) string {
+	conds := make([]string, len(dirs))
+	for i := range dirs {
+		conds[i] = `path LIKE ?`
+	}
+	return `(` + strings.Join(conds, ` OR `) + `)`
+}
+
+func (source *Postgres) ListChanges(dirs []string, cursor int64, limit int) <-chan Change {
+	out := make(chan Change, 1000)
+	go func() {
+		defer metrics.Elapsed("list changes postgres")()
+		defer close(out)
+
+		sql := `
+			SELECT changes.id, op, file_id, path, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+			FROM changes
+			LEFT JOIN infos ON infos.id = file_id AND op != 'REMOVED'
+			WHERE changes.id IN (
+				SELECT MAX(id)
+				FROM changes
+				WHERE id > ?
+				GROUP BY file_id
+			)
+		`
+		args := []interface{}{cursor}
+		if len(dirs) > 0 {
+			sql += `
+			AND ` + pathsCondition(dirs)
+			args = append(args, pgDirArgs(dirs)...)
+		}
+		sql += `
+			ORDER BY changes.id ASC`
+		limitSql, limitArgs := listLimit(limit)
+		sql += limitSql + ";"
+		args = append(args, limitArgs...)
+
+		err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+			var c Change
+			c.Cursor = row.Int64(0)
+			c.Op = ChangeOp(row.Text(1))
+			c.Id = ImageId(row.Int64(2))
+			c.Path = row.Text(3)
+
+			if c.Op != ChangeRemoved {
+				c.Width = row.Int(4)
+				c.Height = row.Int(5)
+				c.Orientation = Orientation(row.Int(6))
+				c.Color = uint32(row.Int64(7))
+
+				if !row.Null(8) {
+					c.DateTime, _ = pgDateTime(row, 8, 9)
+				}
+				c.LatLng, _ = pgLatLng(row, 10, 11)
+			}
+
+			out <- c
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing changes", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) LatestChange(dirs []string) int64 {
+	sql := `
+		SELECT coalesce(MAX(id), 0)
+		FROM changes
+	`
+	if len(dirs) > 0 {
+		sql += `
+		WHERE ` + pathsCondition(dirs)
+	}
+	row, exists, err := pgQueryRow(source.pool, sql+";", pgDirArgs(dirs)...)
+	if err != nil {
+		dbLog.Error("error getting latest change", "err", err)
+		return 0
+	}
+	if !exists {
+		return 0
+	}
+	return row.Int64(0)
+}
+
+func (source *Postgres) ListRecentlyAdded(dirs []string, options ListOptions) <-chan AddedInfo {
+	out := make(chan AddedInfo, 100)
+	go func() {
+		defer metrics.Elapsed("list recently added postgres")()
+		defer metrics.ObserveQuery("list_recently_added")()
+		defer close(out)
+
+		sql := `
+			SELECT infos.id, str || filename, indexed_at_unix, width, height, orientation, color, created_at_unix, created_at_tz_offset, latitude, longitude
+			FROM infos
+			JOIN prefix ON path_prefix_id = prefix.id
+			WHERE indexed_at_unix IS NOT NULL
+		`
+		args := pgDirArgs(dirs)
+		if len(dirs) > 0 {
+			sql += `
+			AND ` + dirsCondition(dirs)
+		}
+
+		hidden := options.hiddenTags()
+		sql += hiddenTagsSql(len(hidden))
+		for _, tag := range hidden {
+			args = append(args, tag)
+		}
+
+		sql += `
+			ORDER BY indexed_at_unix DESC, infos.id DESC
+		`
+
+		// Ignored files are filtered out after the query, so the limit
+		// needs to be applied afterwards as well
+		sqlLimit := options.Limit > 0 && options.ignored == nil
+		if sqlLimit {
+			sql += `LIMIT ? `
+			args = append(args, int64(options.Limit))
+		}
+
+		sql += ";"
+
+		count := 0
+		err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+			var f AddedInfo
+			f.Id = ImageId(row.Int64(0))
+			f.Path = row.Text(1)
+			if options.ignored != nil {
+				if options.ignored(f.Path) {
+					return nil
+				}
+				if options.Limit > 0 && count >= options.Limit {
+					return errPgDone
+				}
+			}
+			count++
+
+			f.AddedAt = time.Unix(row.Int64(2), 0)
+			f.Width = row.Int(3)
+			f.Height = row.Int(4)
+			f.Orientation = Orientation(row.Int(5))
+			f.Color = uint32(row.Int64(6))
+
+			if !row.Null(7) {
+				f.DateTime, _ = pgDateTime(row, 7, 8)
+			}
+			f.LatLng, _ = pgLatLng(row, 9, 10)
+
+			out <- f
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing recently added", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListQuarantine(dirs []string, limit int) []Quarantined {
+	sql := `
+		SELECT file_id, str || filename, stage, error, quarantined_at_unix
+		FROM quarantine
+		INNER JOIN infos ON infos.id = quarantine.file_id
+		INNER JOIN prefix ON prefix.id = infos.path_prefix_id
+	`
+	if len(dirs) > 0 {
+		sql += `
+		WHERE ` + dirsCondition(dirs)
+	}
+	sql += `
+		ORDER BY quarantined_at_unix DESC, file_id`
+	limitSql, limitArgs := listLimit(limit)
+
+	files := make([]Quarantined, 0)
+	err := pgQuery(source.pool, sql+limitSql+";", append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+		files = append(files, Quarantined{
+			Id:            ImageId(row.Int64(0)),
+			Path:          row.Text(1),
+			Stage:         QuarantineStage(row.Text(2)),
+			Error:         row.Text(3),
+			QuarantinedAt: time.Unix(row.Int64(4), 0),
+		})
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing quarantine", "err", err)
+	}
+	return files
+}
+
+func (source *Postgres) ListUnverified(dirs []string, limit int) []IdPath {
+	sql := `
+		SELECT infos.id, str || filename, hash, sha256
+		FROM infos
+		INNER JOIN prefix ON prefix.id = infos.path_prefix_id
+		LEFT JOIN verification ON verification.file_id = infos.id
+		WHERE hash IS NOT NULL
+	`
+	if len(dirs) > 0 {
+		sql += `
+		AND ` + dirsCondition(dirs)
+	}
+	sql += `
+		ORDER BY verified_at_unix IS NOT NULL, verified_at_unix, infos.id`
+	limitSql, limitArgs := listLimit(limit)
+
+	var ips []IdPath
+	err := pgQuery(source.pool, sql+limitSql+";", append(pgDirArgs(dirs), limitArgs...), func(row pgRow) error {
+		ips = append(ips, IdPath{
+			Id:   ImageId(row.Int64(0)),
+			Path: row.Text(1),
+			Hash: ContentHash{
+				Fast:   row.Text(2),
+				Sha256: row.Text(3),
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing unverified files", "err", err)
+	}
+	return ips
+}
+
+func (source *Postgres) ListVerificationIssues(dirs []string, limit int) []Verification {
+	sql := `
+		SELECT file_id, str || filename, status, verified_at_unix, detail, modified_at_unix
+		FROM verification
+		INNER JOIN infos ON infos.id = verification.file_id
+		INNER JOIN prefix ON prefix.id = infos.path_prefix_id
+		WHERE status != ?
+	`
+	args := []interface{}{string(VerificationOk)}
+	if len(dirs) > 0 {
+		sql += `
+		AND ` + dirsCondition(dirs)
+		args = append(args, pgDirArgs(dirs)...)
+	}
+	sql += `
+		ORDER BY verified_at_unix DESC, file_id`
+	limitSql, limitArgs := listLimit(limit)
+	args = append(args, limitArgs...)
+
+	issues := make([]Verification, 0)
+	err := pgQuery(source.pool, sql+limitSql+";", args, func(row pgRow) error {
+		v := Verification{
+			Id:         ImageId(row.Int64(0)),
+			Path:       row.Text(1),
+			Status:     VerificationStatus(row.Text(2)),
+			VerifiedAt: time.Unix(row.Int64(3), 0),
+			Detail:     row.Text(4),
+		}
+		if !row.Null(5) {
+			v.ModifiedAt = time.Unix(row.Int64(5), 0)
+		}
+		issues = append(issues, v)
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing verification issues", "err", err)
+	}
+	return issues
+}
+
+func (source *Postgres) ListLibraryFiles(dirs []string) <-chan LibraryFile {
+	out := make(chan LibraryFile, 1000)
+	go func() {
+		defer metrics.Elapsed("list library files postgres")()
+		defer close(out)
+
+		err := pgQuery(source.pool, `
+			SELECT infos.id, filename, width, height, created_at_unix, created_at_tz_offset,
+				camera_id, color IS NOT NULL, clip_emb.file_id IS NOT NULL, video.duration_ms
+			FROM infos
+			LEFT JOIN clip_emb ON clip_emb.file_id = infos.id
+			LEFT JOIN video ON video.file_id = infos.id
+			WHERE `+dirsCondition(dirs)+`;`, pgDirArgs(dirs), func(row pgRow) error {
+			f := LibraryFile{
+				Id:        ImageId(row.Int64(0)),
+				Filename:  row.Text(1),
+				Width:     row.Int(2),
+				Height:    row.Int(3),
+				Camera:    CameraId(row.Int64(6)),
+				Metadata:  !row.Null(2) && !row.Null(4),
+				Color:     row.Bool(7),
+				Embedding: row.Bool(8),
+				Duration:  time.Duration(row.Int64(9)) * time.Millisecond,
+			}
+			if !row.Null(4) {
+				f.DateTime, _ = pgDateTime(row, 4, 5)
+			}
+			out <- f
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing library files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListPanoramaFrames(dir string) []panoramaFrame {
+	var frames []panoramaFrame
+	err := pgQuery(source.pool, `
+		SELECT
+			infos.id, str || filename as path,
+			width, height, orientation, created_at_unix, created_at_tz_offset, coalesce(camera_id, 0)
+		FROM infos
+		JOIN prefix ON path_prefix_id = prefix.id
+		LEFT JOIN panorama_file ON panorama_file.file_id = infos.id
+		WHERE
+			prefix.str = ? AND
+			panorama_file.file_id IS NULL AND
+			created_at_unix IS NOT NULL AND
+			width IS NOT NULL AND
+			height IS NOT NULL
+		ORDER BY created_at_unix, filename;`, []interface{}{dir}, func(row pgRow) error {
+		f := panoramaFrame{
+			Id:          ImageId(row.Int64(0)),
+			Path:        row.Text(1),
+			Width:       row.Int(2),
+			Height:      row.Int(3),
+			Orientation: Orientation(row.Int(4)),
+			CameraId:    row.Int64(7),
+		}
+		f.DateTime, _ = pgDateTime(row, 5, 6)
+		frames = append(frames, f)
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing panorama frames", "err", err)
+	}
+	return frames
+}
+
+func (source *Postgres) ListPanoramas(dirs []string, limit int) []Panorama {
+	panoramas := make([]Panorama, 0)
+	err := pgQuery(source.pool, `
+		SELECT panorama.id, coalesce(preview, ''), created_at_unix, file_id
+		FROM panorama
+		JOIN panorama_file ON panorama_file.panorama_id = panorama.id
+		WHERE rejected = 0 AND panorama.id IN (
+			SELECT panorama_id
+			FROM panorama_file
+			JOIN infos ON infos.id = panorama_file.file_id
+			WHERE position = 0 AND `+dirsCondition(dirs)+`
+		)
+		ORDER BY panorama.id DESC, position;`, pgDirArgs(dirs), func(row pgRow) error {
+		id := row.Int64(0)
+		if len(panoramas) == 0 || panoramas[len(panoramas)-1].Id != id {
+			if limit > 0 && len(panoramas) >= limit {
+				return errPgDone
+			}
+			panoramas = append(panoramas, Panorama{
+				Id:        id,
+				Preview:   row.Text(1),
+				CreatedAt: time.Unix(row.Int64(2), 0),
+			})
+		}
+		p := &panoramas[len(panoramas)-1]
+		p.Files = append(p.Files, ImageId(row.Int64(3)))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing panoramas", "err", err)
+	}
+	return panoramas
+}
+
+func (source *Postgres) GetPanorama(id int64) (Panorama, bool) {
+	p := Panorama{Id: id}
+	err := pgQuery(source.pool, `
+		SELECT coalesce(preview, ''), created_at_unix, file_id
+		FROM panorama
+		JOIN panorama_file ON panorama_file.panorama_id = panorama.id
+		WHERE panorama.id = ? AND rejected = 0
+		ORDER BY position;`, []interface{}{id}, func(row pgRow) error {
+		p.Preview = row.Text(0)
+		p.CreatedAt = time.Unix(row.Int64(1), 0)
+		p.Files = append(p.Files, ImageId(row.Int64(2)))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error getting panorama", "id", id, "err", err)
+		return Panorama{}, false
+	}
+	return p, len(p.Files) > 0
+}
+
+// listEmbeddingIds returns the ids of the files in the dirs with embeddings
+func (source *Postgres) listEmbeddingIds(dirs []string, options ListOptions) []uint32 {
+	defer metrics.Elapsed("list embedding ids postgres")()
+
+	sql := `
+		SELECT id
+	`
+	if options.ignored != nil {
+		sql += `,
+			(SELECT str FROM prefix WHERE prefix.id = path_prefix_id) || filename
+		`
+	}
+	sql += `
+		FROM infos
+		INNER JOIN clip_emb ON clip_emb.file_id = id
+		WHERE ` + dirsCondition(dirs)
+	args := pgDirArgs(dirs)
+
+	hidden := options.hiddenTags()
+	sql += hiddenTagsSql(len(hidden))
+	for _, tag := range hidden {
+		args = append(args, tag)
+	}
+
+	sqlLimit := options.Limit > 0 && options.ignored == nil
+	if sqlLimit {
+		sql += `LIMIT ? `
+		args = append(args, int64(options.Limit))
+	}
+
+	ids := make([]uint32, 0, 1000)
+	err := pgQuery(source.pool, sql+";", args, func(row pgRow) error {
+		if options.ignored != nil {
+			if options.ignored(row.Text(1)) {
+				return nil
+			}
+			if options.Limit > 0 && len(ids) >= options.Limit {
+				return errPgDone
+			}
+		}
+		ids = append(ids, uint32(row.Int64(0)))
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing embeddings", "err", err)
+	}
+	return ids
+}
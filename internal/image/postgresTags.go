@@ -0,0 +1,526 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"photofield/tag"
+)
+
+// pgTag returns the tag of the row selecting the id, name, revision and
+// tagMetaColumns of tags
+func pgTag(row pgRow) tag.Tag {
+	return tag.Tag{
+		Id:       tag.Id(row.Int(0)),
+		Name:     row.Text(1),
+		Revision: row.Int(2),
+		Meta: tag.Meta{
+			Color:       row.Text(3),
+			Icon:        row.Text(4),
+			Description: row.Text(5),
+			Pinned:      row.Bool(6),
+		},
+	}
+}
+
+func (source *Postgres) GetTagImageIds(id tag.Id) Ids {
+	ids, err := pgTagImageIds(source.pool, id)
+	if err != nil {
+		dbLog.Error("error listing files", "err", err)
+	}
+	return ids
+}
+
+// pgTagImageIds returns the files with the tag
+func pgTagImageIds(q pgQuerier, id tag.Id) (Ids, error) {
+	ids := NewIds()
+	err := pgQuery(q, `
+		SELECT file_id, len
+		FROM infos_tag
+		WHERE tag_id = ?;`, []interface{}{int64(id)}, func(row pgRow) error {
+		min := row.Int(0)
+		len := row.Int(1)
+		ids.Add(IdFromTo(min, min+len))
+		return nil
+	})
+	return ids, err
+}
+
+func (source *Postgres) ListTagRanges(id tag.Id) <-chan IdRange {
+	out := make(chan IdRange, 100)
+	go func() {
+		defer close(out)
+		err := pgQuery(source.pool, `
+			SELECT file_id, len
+			FROM infos_tag
+			WHERE tag_id = ?;`, []interface{}{int64(id)}, func(row pgRow) error {
+			min := row.Int(0)
+			len := row.Int(1)
+			out <- IdFromTo(min, min+len)
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListImageTagRanges(id ImageId) <-chan TagIdRange {
+	out := make(chan TagIdRange, 100)
+	go func() {
+		defer close(out)
+		err := pgQuery(source.pool, `
+			SELECT tag_id, file_id, len
+			FROM infos_tag
+			WHERE ? >= file_id AND ? <= file_id + len;`, []interface{}{int64(id), int64(id)}, func(row pgRow) error {
+			min := row.Int(1)
+			len := row.Int(2)
+			out <- TagIdRange{
+				Id:      tag.Id(row.Int(0)),
+				IdRange: IdFromTo(min, min+len),
+			}
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing files", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) GetTagByName(name string) (tag.Tag, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT id, name, revision, `+tagMetaColumns+`
+		FROM tag
+		WHERE name = ?;`, name)
+	if err != nil || !exists {
+		return tag.Tag{}, false
+	}
+	return pgTag(row), true
+}
+
+func (source *Postgres) GetTagId(name string) (tag.Id, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT id
+		FROM tag
+		WHERE name = ?;`, name)
+	if err != nil || !exists {
+		return 0, false
+	}
+	return tag.Id(row.Int(0)), true
+}
+
+func (source *Postgres) GetTagName(id tag.Id) (string, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT name
+		FROM tag
+		WHERE id = ?;`, int64(id))
+	if err != nil || !exists {
+		return "", false
+	}
+	return row.Text(0), true
+}
+
+func (source *Postgres) GetTagRevision(id tag.Id) (int, error) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT revision
+		FROM tag
+		WHERE id = ?;`, int64(id))
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, errors.New("tag not found")
+	}
+	return row.Int(0), nil
+}
+
+// listTags returns the tags selected by the statement
+func (source *Postgres) listTags(sql string, args ...interface{}) ([]tag.Tag, error) {
+	var tags []tag.Tag
+	err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+		tags = append(tags, pgTag(row))
+		return nil
+	})
+	return tags, err
+}
+
+func (source *Postgres) ListTagsWithPrefix(prefix string) []tag.Tag {
+	tags, err := source.listTags(`
+		SELECT id, name, revision, `+tagMetaColumns+`
+		FROM tag
+		WHERE left(name, ?::integer) = ?
+		ORDER BY name ASC;`, int64(len([]rune(prefix))), prefix)
+	if err != nil {
+		dbLog.Error("error listing tags", "err", err)
+	}
+	return tags
+}
+
+func (source *Postgres) ListImageTags(id ImageId) <-chan tag.Tag {
+	out := make(chan tag.Tag, 100)
+	go func() {
+		defer close(out)
+		err := pgQuery(source.pool, `
+			SELECT id, name, revision, `+tagMetaColumns+`
+			FROM infos_tag
+			JOIN tag ON infos_tag.tag_id = tag.id
+			WHERE ? >= file_id AND ? <= file_id + len
+			`+defaultTagConditions+`
+			ORDER BY pinned DESC, length(name) ASC, name ASC;`, []interface{}{int64(id), int64(id)}, func(row pgRow) error {
+			out <- pgTag(row)
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing tags", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListTags(q string, limit int) <-chan tag.Tag {
+	out := make(chan tag.Tag, 100)
+	go func() {
+		defer close(out)
+		// ILIKE matches regardless of case like LIKE does in sqlite
+		err := pgQuery(source.pool, `
+			SELECT id, name, revision, `+tagMetaColumns+`
+			FROM tag
+			WHERE name ILIKE ?
+			`+defaultTagConditions+`
+			ORDER BY pinned DESC, name ASC
+			LIMIT ?;`, []interface{}{"%" + q + "%", pgLimit(limit)}, func(row pgRow) error {
+			out <- pgTag(row)
+			return nil
+		})
+		if err != nil {
+			dbLog.Error("error listing tags", "err", err)
+		}
+	}()
+	return out
+}
+
+func (source *Postgres) ListTagCounts(dirs []string) []TagCount {
+	counts := make([]TagCount, 0)
+	err := pgQuery(source.pool, `
+		SELECT tag.name, COUNT(DISTINCT infos.id) AS count
+		FROM infos
+		JOIN infos_tag ON infos.id BETWEEN infos_tag.file_id AND infos_tag.file_id + infos_tag.len
+		JOIN tag ON tag.id = infos_tag.tag_id
+		WHERE tag.name NOT LIKE 'sys:select:%' AND `+dirsCondition(dirs)+`
+		GROUP BY tag.id
+		ORDER BY count DESC, tag.name;`, pgDirArgs(dirs), func(row pgRow) error {
+		counts = append(counts, TagCount{
+			Name:  row.Text(0),
+			Count: row.Int(1),
+		})
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("error listing tag counts", "err", err)
+	}
+	return counts
+}
+
+func (source *Postgres) ListTagRevisions(id tag.Id, limit int) []TagRevision {
+	if limit <= 0 {
+		limit = -1
+	}
+	var revisions []TagRevision
+	err := pgQuery(source.pool, `
+		SELECT revision, op, changed_at_unix, added, removed, count
+		FROM tag_revision
+		WHERE tag_id = ?
+		ORDER BY revision DESC
+		LIMIT ?;`, []interface{}{int64(id), pgLimit(limit)}, func(row pgRow) error {
+		revisions = append(revisions, TagRevision{
+			Revision:  row.Int(0),
+			Op:        row.Text(1),
+			ChangedAt: time.Unix(row.Int64(2), 0),
+			Added:     row.Int(3),
+			Removed:   row.Int(4),
+			Count:     row.Int(5),
+		})
+		return nil
+	})
+	if err != nil {
+		dbLog.Error("unable to list tag revisions", "tag_id", id, "err", err)
+	}
+	return revisions
+}
+
+func (source *Postgres) DiffTagRevisions(id tag.Id, from int, to int) (TagDiff, error) {
+	low, high := min(from, to), max(from, to)
+	if err := pgCheckTagRevisions(source.pool, id, low, high); err != nil {
+		return TagDiff{}, err
+	}
+	changes, err := pgTagChanges(source.pool, id, low, high)
+	if err != nil {
+		return TagDiff{}, err
+	}
+	added, removed := composeTagChanges(changes)
+	if from > to {
+		added, removed = removed, added
+	}
+	return TagDiff{
+		From:    from,
+		To:      to,
+		Added:   added,
+		Removed: removed,
+	}, nil
+}
+
+// pgCheckTagRevisions returns ErrRevisionUnavailable unless the changes of
+// all the revisions of the tag after low up to high are kept
+func pgCheckTagRevisions(q pgQuerier, id tag.Id, low int, high int) error {
+	row, exists, err := pgQueryRow(q, `
+		SELECT tag.revision, MIN(tag_revision.revision)
+		FROM tag
+		LEFT JOIN tag_revision ON tag_revision.tag_id = tag.id
+		WHERE tag.id = ?
+		GROUP BY tag.revision;`, int64(id))
+	if err != nil {
+		return err
+	}
+	if !exists || row.Null(0) {
+		return ErrNotFound
+	}
+	current := row.Int(0)
+	if low < 0 || high > current {
+		return ErrRevisionUnavailable
+	}
+	if low == high {
+		return nil
+	}
+	if row.Null(1) || low < row.Int(1)-1 {
+		return ErrRevisionUnavailable
+	}
+	return nil
+}
+
+// pgTagChanges returns the changes of the revisions of the tag after low up
+// to high, oldest first
+func pgTagChanges(q pgQuerier, id tag.Id, low int, high int) ([]tagChange, error) {
+	var changes []tagChange
+	err := pgQuery(q, `
+		SELECT revision, removed, file_id, len
+		FROM tag_revision_range
+		WHERE tag_id = ? AND revision > ?::bigint AND revision <= ?::bigint
+		ORDER BY revision ASC;`, []interface{}{int64(id), int64(low), int64(high)}, func(row pgRow) error {
+		revision := row.Int(0)
+		if len(changes) == 0 || changes[len(changes)-1].Revision != revision {
+			changes = append(changes, tagChange{
+				Revision: revision,
+				Added:    NewIds(),
+				Removed:  NewIds(),
+			})
+		}
+		c := &changes[len(changes)-1]
+		min := row.Int(2)
+		len := row.Int(3)
+		if row.Int(1) != 0 {
+			c.Removed.Add(IdFromTo(min, min+len))
+		} else {
+			c.Added.Add(IdFromTo(min, min+len))
+		}
+		return nil
+	})
+	return changes, err
+}
+
+func (source *Postgres) GetSelection(user string, id int64) (Selection, error) {
+	selections, err := source.listSelections(user, id, "")
+	if err != nil {
+		return Selection{}, err
+	}
+	if len(selections) == 0 {
+		return Selection{}, ErrNotFound
+	}
+	return selections[0], nil
+}
+
+func (source *Postgres) ListSelections(user string, collectionId string) ([]Selection, error) {
+	return source.listSelections(user, 0, collectionId)
+}
+
+// listSelections lists the selections of the user that did not expire yet,
+// only the one with the id if not 0 and only the ones of the collection if
+// not empty
+func (source *Postgres) listSelections(user string, id int64, collectionId string) ([]Selection, error) {
+	selections := make([]Selection, 0)
+	err := pgQuery(source.pool, `
+		SELECT selection.id, collection_id, created_at_unix, expires_at_unix,
+			tag.id, tag.name, tag.revision
+		FROM selection
+		JOIN tag ON tag.id = selection.tag_id
+		WHERE user_name = ? AND expires_at_unix > ?
+			AND (?::bigint = 0 OR selection.id = ?)
+			AND (?::text = '' OR collection_id = ?)
+		ORDER BY created_at_unix DESC, selection.id DESC;`, []interface{}{
+		user, time.Now().Unix(), id, id, collectionId, collectionId,
+	}, func(row pgRow) error {
+		selections = append(selections, Selection{
+			Id:           row.Int64(0),
+			CollectionId: row.Text(1),
+			CreatedAt:    time.Unix(row.Int64(2), 0),
+			ExpiresAt:    time.Unix(row.Int64(3), 0),
+			Tag: tag.Tag{
+				Id:       tag.Id(row.Int64(4)),
+				Name:     row.Text(5),
+				Revision: row.Int(6),
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selections, nil
+}
+
+func pgUserState(row pgRow) UserState {
+	return UserState{
+		Key:       row.Text(0),
+		Value:     []byte(row.Text(1)),
+		Version:   row.Int64(2),
+		UpdatedAt: time.Unix(row.Int64(3), 0),
+	}
+}
+
+func (source *Postgres) ListUserState(user string) ([]UserState, error) {
+	states := make([]UserState, 0)
+	err := pgQuery(source.pool, `
+		SELECT key, value, version, updated_at_unix
+		FROM user_state
+		WHERE user_name = ?
+		ORDER BY key;`, []interface{}{user}, func(row pgRow) error {
+		states = append(states, pgUserState(row))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (source *Postgres) GetUserState(user string, key string) (UserState, bool) {
+	row, exists, err := pgQueryRow(source.pool, `
+		SELECT key, value, version, updated_at_unix
+		FROM user_state
+		WHERE user_name = ? AND key = ?;`, user, key)
+	if err != nil {
+		dbLog.Error("unable to get user state", "key", key, "err", err)
+		return UserState{}, false
+	}
+	if !exists {
+		return UserState{}, false
+	}
+	return pgUserState(row), true
+}
+
+func (source *Postgres) ListSearches(user string, saved bool, limit int) ([]Search, error) {
+	searches := make([]Search, 0)
+	err := pgQuery(source.pool, `
+		SELECT id, collection_id, query, searched_at_unix, name
+		FROM search
+		WHERE user_name = ? AND (?::boolean = false OR name IS NOT NULL)
+		ORDER BY searched_at_unix DESC, id DESC
+		LIMIT ?;`, []interface{}{user, saved, pgLimit(limit)}, func(row pgRow) error {
+		searches = append(searches, Search{
+			Id:           row.Int64(0),
+			CollectionId: row.Text(1),
+			Query:        row.Text(2),
+			SearchedAt:   time.Unix(row.Int64(3), 0),
+			Name:         row.Text(4),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (source *Postgres) ListAudit(query AuditQuery) ([]AuditEntry, error) {
+	sql := `
+		SELECT id, created_at_unix, actor, method, action, target, details
+		FROM audit
+		WHERE TRUE
+	`
+	var args []interface{}
+	if query.Actor != nil {
+		sql += `AND actor = ? `
+		args = append(args, *query.Actor)
+	}
+	if query.Action != "" {
+		sql += `AND action = ? `
+		args = append(args, string(query.Action))
+	}
+	if query.FileId != 0 {
+		sql += `AND id IN (
+			SELECT audit_id
+			FROM audit_file
+			WHERE file_id <= ? AND file_id + len >= ?
+		) `
+		args = append(args, int64(query.FileId), int64(query.FileId))
+	}
+	if !query.Since.IsZero() {
+		sql += `AND created_at_unix >= ? `
+		args = append(args, query.Since.Unix())
+	}
+	if query.Before > 0 {
+		sql += `AND id < ? `
+		args = append(args, query.Before)
+	}
+	sql += `
+		ORDER BY id DESC
+	`
+	if query.Limit > 0 {
+		sql += `LIMIT ? `
+		args = append(args, int64(query.Limit))
+	}
+	sql += ";"
+
+	entries := make([]AuditEntry, 0)
+	err := pgQuery(source.pool, sql, args, func(row pgRow) error {
+		e := AuditEntry{
+			Id:        row.Int64(0),
+			CreatedAt: time.Unix(row.Int64(1), 0),
+			Actor:     row.Text(2),
+			Method:    row.Text(3),
+			Action:    AuditAction(row.Text(4)),
+			Target:    row.Text(5),
+		}
+		if details := row.Text(6); details != "" {
+			if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+				dbLog.Error("unable to decode audit details", "id", e.Id, "err", err)
+			}
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		err := pgQuery(source.pool, `
+			SELECT file_id, len
+			FROM audit_file
+			WHERE audit_id = ?;`, []interface{}{entries[i].Id}, func(row pgRow) error {
+			if entries[i].Ids == nil {
+				entries[i].Ids = NewIds()
+			}
+			min := row.Int(0)
+			len := row.Int(1)
+			entries[i].Ids.Add(IdFromTo(min, min+len))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
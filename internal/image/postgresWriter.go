@@ -0,0 +1,1563 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/internal/metrics"
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+	"github.com/jackc/pgx/v4"
+)
+
+// pgRanges returns the starts and lengths of the ranges of the ids, to be
+// inserted at once with unnest
+func pgRanges(ids Ids) (lows []int64, lens []int64) {
+	for _, r := range ids.Slice() {
+		lows = append(lows, int64(r.Low))
+		lens = append(lens, int64(r.High-r.Low))
+	}
+	return lows, lens
+}
+
+func nullText(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func nullUnix(value time.Time) interface{} {
+	if value.IsZero() {
+		return nil
+	}
+	return value.Unix()
+}
+
+func nullDegrees(latlng s2.LatLng) (interface{}, interface{}) {
+	if IsNaNLatLng(latlng) {
+		return nil, nil
+	}
+	return latlng.Lat.Degrees(), latlng.Lng.Degrees()
+}
+
+// writePendingInfosPostgres writes the queued writes in batched
+// transactions the same as the sqlite writer. Each write runs in its own
+// savepoint, so that a failed statement only rolls back the write it is
+// part of, instead of aborting the whole transaction.
+func (source *Postgres) writePendingInfosPostgres() {
+	ctx := context.Background()
+
+	var tx pgx.Tx
+	// Savepoint of the write being made
+	var sp pgx.Tx
+
+	exec := func(sql string, args ...interface{}) (int64, error) {
+		return pgExec(sp, sql, args...)
+	}
+	queryRow := func(sql string, args ...interface{}) (pgRow, bool, error) {
+		return pgQueryRow(sp, sql, args...)
+	}
+
+	tagName := func(id tag.Id) string {
+		row, exists, err := queryRow(`
+			SELECT name
+			FROM tag
+			WHERE id = ?;`, int64(id))
+		if err != nil {
+			dbLog.Error("unable to get tag name", "tag_id", id, "err", err)
+		}
+		if !exists {
+			return ""
+		}
+		return row.Text(0)
+	}
+
+	writeChangeByPath := func(op ChangeOp, path string) error {
+		dir, file := filepath.Split(path)
+		_, err := exec(`
+			INSERT INTO changes(file_id, op, path, changed_at_unix)
+			SELECT infos.id, ?::text, str || filename, ?::bigint
+			FROM infos
+			JOIN prefix ON path_prefix_id = prefix.id
+			WHERE str = ? AND filename = ?;`, string(op), time.Now().Unix(), dir, file)
+		if err != nil {
+			dbLog.Error("unable to insert change", "path", path, "err", err)
+		}
+		return err
+	}
+
+	writeChangeById := func(op ChangeOp, id ImageId) error {
+		_, err := exec(`
+			INSERT INTO changes(file_id, op, path, changed_at_unix)
+			SELECT infos.id, ?::text, str || filename, ?::bigint
+			FROM infos
+			JOIN prefix ON path_prefix_id = prefix.id
+			WHERE infos.id = ?;`, string(op), time.Now().Unix(), int64(id))
+		if err != nil {
+			dbLog.Error("unable to insert change", "id", id, "err", err)
+		}
+		return err
+	}
+
+	insertTagRanges := func(id tag.Id, ids Ids) error {
+		lows, lens := pgRanges(ids)
+		if len(lows) == 0 {
+			return nil
+		}
+		_, err := exec(`
+			INSERT INTO infos_tag (tag_id, file_id, len)
+			SELECT ?::bigint, file_id, len
+			FROM unnest(?::bigint[], ?::bigint[]) AS r(file_id, len)
+			ON CONFLICT DO NOTHING;`, int64(id), lows, lens)
+		return err
+	}
+
+	// writeTagIds replaces the files of the tag with the ids, returning the
+	// incremented revision of the tag
+	writeTagIds := func(id tag.Id, ids Ids) (int, error) {
+		_, err := exec(`
+			DELETE FROM infos_tag
+			WHERE tag_id = ?;`, int64(id))
+		if err != nil {
+			dbLog.Error("unable to delete tag ranges", "tag_id", id, "err", err)
+			return 0, err
+		}
+
+		err = insertTagRanges(id, ids)
+		if err != nil {
+			dbLog.Error("unable to insert tag ranges", "tag_id", id, "err", err)
+			return 0, err
+		}
+
+		row, exists, err := queryRow(`
+			UPDATE tag
+			SET revision = revision + 1
+			WHERE id = ?
+			RETURNING revision;`, int64(id))
+		if err != nil {
+			dbLog.Error("unable to increment tag revision", "tag_id", id, "err", err)
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrNotFound
+		}
+		return row.Int(0), nil
+	}
+
+	// removeTag deletes the tag along with its files and history
+	removeTag := func(id tag.Id) error {
+		for _, table := range []string{"infos_tag", "tag_revision", "tag_revision_range"} {
+			_, err := exec(`
+				DELETE FROM `+table+`
+				WHERE tag_id = ?;`, int64(id))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := exec(`
+			DELETE FROM tag
+			WHERE id = ?;`, int64(id))
+		return err
+	}
+
+	// removeSelection deletes the selection along with its tag
+	removeSelection := func(id int64, tagId tag.Id) error {
+		_, err := exec(`
+			DELETE FROM selection
+			WHERE id = ?;`, id)
+		if err != nil {
+			return err
+		}
+		return removeTag(tagId)
+	}
+
+	// removeExpiredSelections deletes the selections that expired by now
+	removeExpiredSelections := func(now time.Time) error {
+		type expired struct {
+			id    int64
+			tagId tag.Id
+		}
+		var selections []expired
+		err := pgQuery(sp, `
+			SELECT id, tag_id
+			FROM selection
+			WHERE expires_at_unix <= ?;`, []interface{}{now.Unix()}, func(row pgRow) error {
+			selections = append(selections, expired{
+				id:    row.Int64(0),
+				tagId: tag.Id(row.Int64(1)),
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range selections {
+			if err := removeSelection(e.id, e.tagId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// writeTagRevision records the files added and removed by the revision
+	// of the tag, dropping the revisions older than the ones kept
+	writeTagRevision := func(id tag.Id, rev int, op string, before Ids, after Ids) error {
+		added := after.Clone()
+		added.SubtractTree(before)
+		removed := before.Clone()
+		removed.SubtractTree(after)
+
+		_, err := exec(`
+			INSERT INTO tag_revision (tag_id, revision, op, changed_at_unix, added, removed, count)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (tag_id, revision) DO UPDATE SET
+				op = excluded.op,
+				changed_at_unix = excluded.changed_at_unix,
+				added = excluded.added,
+				removed = excluded.removed,
+				count = excluded.count;`,
+			int64(id), int64(rev), op, time.Now().Unix(),
+			int64(countIds(added)), int64(countIds(removed)), int64(countIds(after)))
+		if err != nil {
+			dbLog.Error("unable to insert tag revision", "tag_id", id, "err", err)
+			return err
+		}
+
+		for removedFlag, ids := range []Ids{added, removed} {
+			lows, lens := pgRanges(ids)
+			if len(lows) == 0 {
+				continue
+			}
+			_, err := exec(`
+				INSERT INTO tag_revision_range (tag_id, revision, removed, file_id, len)
+				SELECT ?::bigint, ?::integer, ?::integer, file_id, len
+				FROM unnest(?::bigint[], ?::bigint[]) AS r(file_id, len);`,
+				int64(id), int64(rev), int64(removedFlag), lows, lens)
+			if err != nil {
+				dbLog.Error("unable to insert tag revision ranges", "tag_id", id, "err", err)
+				return err
+			}
+		}
+
+		for _, table := range []string{"tag_revision", "tag_revision_range"} {
+			_, err := exec(`
+				DELETE FROM `+table+`
+				WHERE tag_id = ? AND revision <= ?;`, int64(id), int64(rev-source.config.TagRevisions))
+			if err != nil {
+				dbLog.Error("unable to delete tag revisions", "tag_id", id, "err", err)
+				return err
+			}
+		}
+		return nil
+	}
+
+	lastCompact := time.Time{}
+	inTransaction := false
+
+	pendingCompactionTags := tagSet{}
+
+	// Published once committed, so that listeners can read the changes
+	pendingEvents := make([]Event, 0)
+
+	defer func() {
+		var err error
+		if inTransaction {
+			err = tx.Commit(ctx)
+			source.transactionMutex.Unlock()
+		}
+		if err != nil {
+			panic(err)
+		}
+		source.events.publish(pendingEvents)
+	}()
+
+	commitTicker := &time.Ticker{}
+	commitInterval := time.Duration(source.config.CommitIntervalMs) * time.Millisecond
+	transactionWrites := 0
+
+	commit := func() {
+		committed := metrics.ObserveQuery("commit")
+		err := tx.Commit(ctx)
+		if err != nil {
+			panic(err)
+		}
+		committed()
+		source.writing.Store(false)
+		commitTicker.Stop()
+
+		if time.Since(lastCompact).Hours() >= 1 {
+			lastCompact = time.Now()
+
+			// Only the latest change per file is relevant for readers
+			compactDone := metrics.Elapsed("database compact changes")
+			_, err = pgExec(source.pool, `
+				DELETE FROM changes
+				WHERE id NOT IN (
+					SELECT MAX(id)
+					FROM changes
+					GROUP BY file_id
+				);`)
+			if err != nil {
+				dbLog.Error("unable to compact changes", "err", err)
+			}
+			compactDone()
+		}
+
+		source.transactionMutex.Unlock()
+		inTransaction = false
+		transactionWrites = 0
+
+		if len(pendingEvents) > 0 {
+			source.events.publish(pendingEvents)
+			pendingEvents = pendingEvents[:0]
+		}
+	}
+
+	// appendFiles adds the files that are not in the database yet in one
+	// round trip
+	appendFiles := func(paths []NewPath) error {
+		batch := &pgx.Batch{}
+		dirs := make(map[string]struct{})
+		for _, np := range paths {
+			dir, _ := filepath.Split(np.Path)
+			if _, ok := dirs[dir]; ok {
+				continue
+			}
+			dirs[dir] = struct{}{}
+			batch.Queue(rebind(`
+				INSERT INTO prefix(str)
+				VALUES (?)
+				ON CONFLICT DO NOTHING;`), dir)
+		}
+		now := time.Now().Unix()
+		for _, np := range paths {
+			dir, file := filepath.Split(np.Path)
+			batch.Queue(rebind(`
+				WITH inserted AS (
+					INSERT INTO infos(path_prefix_id, filename, hash, sha256, hash_modified_at_unix, indexed_at_unix)
+					SELECT id, ?::text, ?::text, ?::text, ?::bigint, ?::bigint
+					FROM prefix
+					WHERE str = ?
+					ON CONFLICT DO NOTHING
+					RETURNING id
+				), change AS (
+					INSERT INTO changes(file_id, op, path, changed_at_unix)
+					SELECT id, ?::text, ?::text, ?::bigint
+					FROM inserted
+				)
+				SELECT id
+				FROM inserted;`),
+				file, nullText(np.Hash.Fast), nullText(np.Hash.Sha256), nullUnix(np.Hash.Modified), now, dir,
+				string(ChangeAdded), np.Path, now,
+			)
+		}
+
+		results := sp.SendBatch(ctx, batch)
+		defer results.Close()
+		for range dirs {
+			if _, err := results.Exec(); err != nil {
+				dbLog.Error("unable to insert path prefix", "err", err)
+				return err
+			}
+		}
+		for _, np := range paths {
+			var id int64
+			err := results.QueryRow().Scan(&id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				dbLog.Error("unable to insert path filename", "path", np.Path, "err", err)
+				return err
+			}
+			pendingEvents = append(pendingEvents, Event{
+				Type: EventFileIndexed,
+				Time: time.Now(),
+				Id:   ImageId(id),
+				Path: np.Path,
+			})
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-commitTicker.C:
+			if !inTransaction {
+				commitTicker.Stop()
+				continue
+			}
+
+			if pendingCompactionTags.Len() > 0 {
+				for id := range pendingCompactionTags {
+					source.CompactTag(id)
+				}
+				pendingCompactionTags = tagSet{}
+				continue
+			}
+
+			commit()
+
+		case imageInfo := <-source.pending:
+
+			// Large transactions are committed early, so that bulk writes
+			// do not hold back readers of the changes for too long
+			size := source.config.TransactionSize
+			if inTransaction && size > 0 && transactionWrites >= size && pendingCompactionTags.Len() == 0 {
+				commit()
+			}
+
+			if !inTransaction {
+				source.transactionMutex.Lock()
+				var err error
+				tx, err = source.pool.Begin(ctx)
+				if err != nil {
+					panic(err)
+				}
+				inTransaction = true
+				source.writing.Store(true)
+				commitTicker = time.NewTicker(commitInterval)
+			}
+			transactionWrites += max(1, len(imageInfo.NewPaths))
+
+			var err error
+			sp, err = tx.Begin(ctx)
+			if err != nil {
+				panic(err)
+			}
+			eventCount := len(pendingEvents)
+
+			switch imageInfo.Type {
+			case Flush:
+				close(imageInfo.Done)
+
+			case AppendPath:
+				appendFiles([]NewPath{{Path: imageInfo.Path, Hash: imageInfo.Hash}})
+
+			case AppendPaths:
+				appendFiles(imageInfo.NewPaths)
+
+			case UpdateMeta:
+				dir, file := filepath.Split(imageInfo.Path)
+				_, timezoneOffsetSeconds := imageInfo.DateTime.Zone()
+				lat, lng := nullDegrees(imageInfo.LatLng)
+
+				var err error
+				if !imageInfo.Camera.Empty() {
+					_, err = exec(`
+						INSERT INTO camera(make, model, serial)
+						VALUES (?, ?, ?)
+						ON CONFLICT DO NOTHING;`,
+						imageInfo.Camera.Make, imageInfo.Camera.Model, imageInfo.Camera.Serial)
+				}
+				if err == nil {
+					_, err = exec(`
+						INSERT INTO infos(path_prefix_id, filename, width, height, orientation, created_at_unix, created_at_tz_offset, latitude, longitude, camera_id)
+						SELECT
+							prefix.id,
+							?::text,
+							?::integer,
+							?::integer,
+							?::integer,
+							?::bigint + coalesce(camera.clock_offset, 0),
+							?::integer,
+							?::double precision,
+							?::double precision,
+							camera.id
+						FROM prefix
+						LEFT JOIN camera ON make = ? AND model = ? AND serial = ?
+						WHERE str = ?
+						ON CONFLICT (path_prefix_id, filename) DO UPDATE SET
+							width = excluded.width,
+							height = excluded.height,
+							orientation = excluded.orientation,
+							latitude = excluded.latitude,
+							longitude = excluded.longitude,
+							created_at_unix = excluded.created_at_unix,
+							created_at_tz_offset = excluded.created_at_tz_offset,
+							camera_id = excluded.camera_id;`,
+						file,
+						int64(imageInfo.Width),
+						int64(imageInfo.Height),
+						int64(imageInfo.Orientation),
+						imageInfo.DateTime.Unix(),
+						int64(timezoneOffsetSeconds/60),
+						lat, lng,
+						imageInfo.Camera.Make, imageInfo.Camera.Model, imageInfo.Camera.Serial,
+						dir,
+					)
+				}
+				if err == nil && imageInfo.Id != 0 {
+					if imageInfo.Description != "" {
+						_, err = exec(`
+							INSERT INTO caption(file_id, embedded)
+							VALUES (?, ?)
+							ON CONFLICT (file_id) DO UPDATE SET
+								embedded = excluded.embedded
+							WHERE caption.embedded IS DISTINCT FROM excluded.embedded;`,
+							imageInfo.Id, imageInfo.Description)
+					} else {
+						_, err = exec(`
+							UPDATE caption
+							SET embedded = NULL
+							WHERE file_id = ? AND embedded IS NOT NULL;`, imageInfo.Id)
+						if err == nil {
+							_, err = exec(`
+								DELETE FROM caption
+								WHERE file_id = ? AND embedded IS NULL AND edited IS NULL;`, imageInfo.Id)
+						}
+					}
+				}
+				if err == nil {
+					err = writeChangeByPath(ChangeModified, imageInfo.Path)
+				}
+				if err != nil {
+					dbLog.Error("unable to insert image info meta", "path", imageInfo.Path, "err", err)
+					break
+				}
+				pendingEvents = append(pendingEvents, Event{
+					Type: EventMetadataIndexed,
+					Time: time.Now(),
+					Id:   ImageId(imageInfo.Id),
+					Path: imageInfo.Path,
+				})
+
+			case UpdateColor:
+				dir, file := filepath.Split(imageInfo.Path)
+				_, err := exec(`
+					INSERT INTO infos(path_prefix_id, filename, color)
+					SELECT id, ?::text, ?::bigint
+					FROM prefix
+					WHERE str = ?
+					ON CONFLICT (path_prefix_id, filename) DO UPDATE SET
+						color = excluded.color;`, file, int64(imageInfo.Color), dir)
+				if err != nil {
+					dbLog.Error("unable to insert image info meta", "path", imageInfo.Path, "err", err)
+				}
+
+			case UpdateAI:
+				err := source.putEmbedding(ImageId(imageInfo.Id), imageInfo.Embedding)
+				if err != nil {
+					dbLog.Error("unable to store embedding", "id", imageInfo.Id, "err", err)
+					break
+				}
+
+				// The embedding itself is in the embeddings store
+				_, err = exec(`
+					INSERT INTO clip_emb(file_id, inv_norm)
+					VALUES (?, ?)
+					ON CONFLICT (file_id) DO UPDATE SET
+						inv_norm = excluded.inv_norm;`,
+					imageInfo.Id, int64(imageInfo.Embedding.InvNormUint16())-clip.InvNormMean)
+				if err != nil {
+					dbLog.Error("unable to insert image info ai", "id", imageInfo.Id, "err", err)
+					break
+				}
+				pendingEvents = append(pendingEvents, Event{
+					Type: EventEmbeddingIndexed,
+					Time: time.Now(),
+					Id:   ImageId(imageInfo.Id),
+				})
+
+			case Delete:
+				id := ImageId(imageInfo.Id)
+
+				// Delete image tags
+				var ranges []TagIdRange
+				err := pgQuery(sp, `
+					SELECT tag_id, file_id, len
+					FROM infos_tag
+					WHERE ? >= file_id AND ? <= file_id + len;`, []interface{}{int64(id), int64(id)}, func(row pgRow) error {
+					min := row.Int(1)
+					ranges = append(ranges, TagIdRange{
+						Id:      tag.Id(row.Int64(0)),
+						IdRange: IdFromTo(min, min+row.Int(2)),
+					})
+					return nil
+				})
+				for _, r := range ranges {
+					if err != nil {
+						break
+					}
+					ids := NewIds()
+					ids.Add(r.IdRange)
+					ids.SubtractInt(int(id))
+					_, err = exec(`
+						DELETE FROM infos_tag
+						WHERE tag_id = ? AND file_id = ? AND len = ?;`,
+						int64(r.Id), int64(r.Low), int64(r.High-r.Low))
+					if err == nil {
+						err = insertTagRanges(r.Id, ids)
+					}
+				}
+
+				if err == nil {
+					err = writeChangeById(ChangeRemoved, id)
+				}
+
+				for _, table := range []string{
+					"video", "audio", "motion_photo", "projection", "sidecar_file",
+					"caption", "geotag", "trip_file", "quarantine", "verification",
+					"clip_emb",
+				} {
+					if err != nil {
+						break
+					}
+					_, err = exec(`
+						DELETE FROM `+table+`
+						WHERE file_id = ?;`, int64(id))
+				}
+
+				// Delete image info
+				if err == nil {
+					_, err = exec(`
+						DELETE FROM infos
+						WHERE id = ?;`, int64(id))
+				}
+				if err != nil {
+					dbLog.Error("unable to delete path", "path", imageInfo.Path, "err", err)
+					break
+				}
+
+				err = source.deleteEmbedding(id)
+				if err != nil {
+					dbLog.Error("unable to delete embedding", "id", id, "err", err)
+				}
+
+			case UpdateHash:
+				_, err := exec(`
+					UPDATE infos
+					SET hash = ?, sha256 = coalesce(?, sha256), hash_modified_at_unix = ?
+					WHERE id = ?;`,
+					imageInfo.Hash.Fast, nullText(imageInfo.Hash.Sha256), nullUnix(imageInfo.Hash.Modified), imageInfo.Id)
+				if err == nil {
+					// Verified against the new hash from now on
+					_, err = exec(`
+						DELETE FROM verification
+						WHERE file_id = ?;`, imageInfo.Id)
+				}
+				if err != nil {
+					dbLog.Error("unable to update hash", "id", imageInfo.Id, "err", err)
+				}
+
+			case MovePath:
+				dir, file := filepath.Split(imageInfo.Path)
+				_, err := exec(`
+					INSERT INTO prefix(str)
+					VALUES (?)
+					ON CONFLICT DO NOTHING;`, dir)
+				if err == nil {
+					_, err = exec(`
+						UPDATE infos
+						SET
+							path_prefix_id = (
+								SELECT id
+								FROM prefix
+								WHERE str = ?
+							),
+							filename = ?
+						WHERE id = ?;`, dir, file, imageInfo.Id)
+				}
+				if err == nil {
+					err = writeChangeByPath(ChangeModified, imageInfo.Path)
+				}
+				if err != nil {
+					dbLog.Error("unable to move", "id", imageInfo.Id, "path", imageInfo.Path, "err", err)
+				}
+
+			case UpdateCamera:
+				id := int64(imageInfo.Camera.Id)
+				offset := int64(imageInfo.Camera.ClockOffset.Seconds())
+
+				_, err := exec(`
+					UPDATE infos
+					SET created_at_unix = created_at_unix + ? - (
+						SELECT clock_offset
+						FROM camera
+						WHERE id = ?
+					)
+					WHERE camera_id = ?;`, offset, id, id)
+				if err == nil {
+					_, err = exec(`
+						UPDATE camera
+						SET clock_offset = ?
+						WHERE id = ?;`, offset, id)
+				}
+				if err == nil {
+					_, err = exec(`
+						INSERT INTO changes(file_id, op, path, changed_at_unix)
+						SELECT infos.id, ?::text, str || filename, ?::bigint
+						FROM infos
+						JOIN prefix ON path_prefix_id = prefix.id
+						WHERE camera_id = ?;`, string(ChangeModified), time.Now().Unix(), id)
+				}
+				if err != nil {
+					dbLog.Error("unable to update camera", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateOrientationProposal:
+				p := imageInfo.Proposal
+				_, err := exec(`
+					INSERT INTO orientation_proposal(file_id, orientation, confidence, status, created_at_unix)
+					VALUES (?, ?, ?, ?, ?)
+					ON CONFLICT DO NOTHING;`,
+					int64(p.Id), int64(p.Orientation), float64(p.Confidence), string(p.Status), p.CreatedAt.Unix())
+				if err != nil {
+					dbLog.Error("unable to insert orientation proposal", "id", p.Id, "err", err)
+				}
+
+			case WriteAudit:
+				a := imageInfo.Audit
+				var details interface{}
+				if len(a.Details) > 0 {
+					b, err := json.Marshal(a.Details)
+					if err != nil {
+						dbLog.Error("unable to encode audit details", "err", err)
+					}
+					details = string(b)
+				}
+				row, _, err := queryRow(`
+					INSERT INTO audit(created_at_unix, actor, method, action, target, details)
+					VALUES (?, ?, ?, ?, ?, ?)
+					RETURNING id;`,
+					a.CreatedAt.Unix(), a.Actor, a.Method, string(a.Action), a.Target, details)
+				if err != nil {
+					dbLog.Error("unable to insert audit", "action", a.Action, "err", err)
+					break
+				}
+				if a.Ids == nil {
+					break
+				}
+				auditId := row.Int64(0)
+				lows, lens := pgRanges(a.Ids)
+				_, err = exec(`
+					INSERT INTO audit_file(audit_id, file_id, len)
+					SELECT ?::bigint, file_id, len
+					FROM unnest(?::bigint[], ?::bigint[]) AS r(file_id, len);`, auditId, lows, lens)
+				if err != nil {
+					dbLog.Error("unable to insert audit ranges", "audit_id", auditId, "err", err)
+				}
+
+			case UpdateUserState:
+				user := imageInfo.User
+				state := imageInfo.State
+
+				current := UserState{Key: state.Key}
+				row, exists, err := queryRow(`
+					SELECT value, version, updated_at_unix
+					FROM user_state
+					WHERE user_name = ? AND key = ?;`, user, state.Key)
+				if err == nil && exists {
+					current.Value = []byte(row.Text(0))
+					current.Version = row.Int64(1)
+					current.UpdatedAt = time.Unix(row.Int64(2), 0)
+				}
+
+				if err == nil && state.Version != AnyVersion && state.Version != current.Version {
+					err = &VersionConflictError{Current: current}
+				}
+
+				if err == nil && state.Value == nil {
+					if current.Version == 0 {
+						err = ErrNotFound
+					} else {
+						_, err = exec(`
+							DELETE FROM user_state
+							WHERE user_name = ? AND key = ?;`, user, state.Key)
+					}
+				} else if err == nil {
+					if current.Version == 0 {
+						var count pgRow
+						count, _, err = queryRow(`
+							SELECT COUNT(*)
+							FROM user_state
+							WHERE user_name = ?;`, user)
+						if err == nil && count.Int(0) >= MaxUserStateKeys {
+							err = ErrTooManyKeys
+						}
+					}
+					if err == nil {
+						state.Version = current.Version + 1
+						state.UpdatedAt = time.Now()
+						_, err = exec(`
+							INSERT INTO user_state(user_name, key, value, version, updated_at_unix)
+							VALUES (?, ?, ?, ?, ?)
+							ON CONFLICT (user_name, key) DO UPDATE SET
+								value = excluded.value,
+								version = excluded.version,
+								updated_at_unix = excluded.updated_at_unix;`,
+							user, state.Key, string(state.Value), state.Version, state.UpdatedAt.Unix())
+					}
+				}
+
+				if err != nil {
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- state
+				}
+				close(imageInfo.Done)
+
+			case WriteSearch:
+				user := imageInfo.User
+				search := imageInfo.Search
+
+				var previous Search
+				row, exists, err := queryRow(`
+					SELECT id, query, searched_at_unix, name
+					FROM search
+					WHERE user_name = ? AND collection_id = ?
+					ORDER BY searched_at_unix DESC, id DESC
+					LIMIT 1;`, user, search.CollectionId)
+				if err == nil && exists {
+					previous.Id = row.Int64(0)
+					previous.Query = row.Text(1)
+					previous.SearchedAt = time.Unix(row.Int64(2), 0)
+					previous.Name = row.Text(3)
+				}
+
+				if err == nil && exists && replacesSearch(previous, search.Query, search.SearchedAt) {
+					_, err = exec(`
+						DELETE FROM search
+						WHERE id = ? AND user_name = ?;`, previous.Id, user)
+				}
+				if err == nil {
+					_, err = exec(`
+						INSERT INTO search(user_name, collection_id, query, searched_at_unix)
+						VALUES (?, ?, ?, ?)
+						ON CONFLICT (user_name, collection_id, query) DO UPDATE SET
+							searched_at_unix = excluded.searched_at_unix;`,
+						user, search.CollectionId, search.Query, search.SearchedAt.Unix())
+				}
+				if err == nil {
+					_, err = exec(`
+						DELETE FROM search
+						WHERE user_name = ? AND name IS NULL AND id NOT IN (
+							SELECT id
+							FROM search
+							WHERE user_name = ? AND name IS NULL
+							ORDER BY searched_at_unix DESC, id DESC
+							LIMIT ?
+						);`, user, user, int64(MaxSearchHistory))
+				}
+				if err != nil {
+					dbLog.Error("unable to write search", "query", search.Query, "err", err)
+				}
+
+			case SaveSearch:
+				search := imageInfo.Search
+				row, exists, err := queryRow(`
+					INSERT INTO search(user_name, collection_id, query, searched_at_unix, name)
+					VALUES (?, ?, ?, ?, ?)
+					ON CONFLICT (user_name, collection_id, query) DO UPDATE SET
+						name = excluded.name
+					RETURNING id, searched_at_unix;`,
+					imageInfo.User, search.CollectionId, search.Query, search.SearchedAt.Unix(), search.Name)
+				if err == nil && exists {
+					search.Id = row.Int64(0)
+					search.SearchedAt = time.Unix(row.Int64(1), 0)
+				}
+				if err != nil {
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- search
+				}
+				close(imageInfo.Done)
+
+			case DeleteSearch:
+				n, err := exec(`
+					DELETE FROM search
+					WHERE id = ? AND user_name = ?;`, imageInfo.Search.Id, imageInfo.User)
+				if err == nil && n == 0 {
+					err = ErrNotFound
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case WritePanorama:
+				p := imageInfo.Panorama
+				row, _, err := queryRow(`
+					INSERT INTO panorama(created_at_unix)
+					VALUES (?)
+					RETURNING id;`, p.CreatedAt.Unix())
+				var id int64
+				if err == nil {
+					id = row.Int64(0)
+				}
+				for i, fileId := range p.Files {
+					if err != nil {
+						break
+					}
+					_, err = exec(`
+						INSERT INTO panorama_file(file_id, panorama_id, position)
+						VALUES (?, ?, ?)
+						ON CONFLICT DO NOTHING;`, int64(fileId), id, int64(i))
+				}
+				if err != nil {
+					dbLog.Error("unable to insert panorama", "err", err)
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- id
+				}
+				close(imageInfo.Done)
+
+			case UpdateVideo:
+				v := imageInfo.Video
+				chapters, err := marshalChapters(v.Chapters)
+				if err == nil {
+					_, err = exec(`
+						INSERT INTO video(file_id, duration_ms, codec, frame_rate, chapters)
+						VALUES (?, ?, ?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							duration_ms = excluded.duration_ms,
+							codec = excluded.codec,
+							frame_rate = excluded.frame_rate,
+							chapters = excluded.chapters;`,
+						imageInfo.Id, v.Duration.Milliseconds(), nullText(v.Codec), v.FrameRate, string(chapters))
+				}
+				if err != nil {
+					dbLog.Error("unable to write video", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateAudio:
+				a := imageInfo.Audio
+				var err error
+				if a.Path == "" {
+					_, err = exec(`
+						DELETE FROM audio
+						WHERE file_id = ?;`, imageInfo.Id)
+				} else {
+					_, err = exec(`
+						INSERT INTO audio(file_id, path, duration_ms)
+						VALUES (?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							path = excluded.path,
+							duration_ms = excluded.duration_ms;`,
+						imageInfo.Id, a.Path, a.Duration.Milliseconds())
+				}
+				if err != nil {
+					dbLog.Error("unable to write audio", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateMotionPhoto:
+				m := imageInfo.Motion
+				var err error
+				if m.Length == 0 {
+					_, err = exec(`
+						DELETE FROM motion_photo
+						WHERE file_id = ?;`, imageInfo.Id)
+				} else {
+					_, err = exec(`
+						INSERT INTO motion_photo(file_id, "offset", length)
+						VALUES (?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							"offset" = excluded."offset",
+							length = excluded.length;`,
+						imageInfo.Id, m.Offset, m.Length)
+				}
+				if err != nil {
+					dbLog.Error("unable to write motion photo", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateProjection:
+				p := imageInfo.Projection
+				var err error
+				if p.Type == "" {
+					_, err = exec(`
+						DELETE FROM projection
+						WHERE file_id = ?;`, imageInfo.Id)
+				} else {
+					_, err = exec(`
+						INSERT INTO projection(file_id, type, full_width, full_height, cropped_left, cropped_top, cropped_width, cropped_height, pose_heading)
+						VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							type = excluded.type,
+							full_width = excluded.full_width,
+							full_height = excluded.full_height,
+							cropped_left = excluded.cropped_left,
+							cropped_top = excluded.cropped_top,
+							cropped_width = excluded.cropped_width,
+							cropped_height = excluded.cropped_height,
+							pose_heading = excluded.pose_heading;`,
+						imageInfo.Id, p.Type,
+						int64(p.FullWidth), int64(p.FullHeight),
+						int64(p.CroppedLeft), int64(p.CroppedTop),
+						int64(p.CroppedWidth), int64(p.CroppedHeight),
+						p.PoseHeading)
+				}
+				if err != nil {
+					dbLog.Error("unable to write projection", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateSidecars:
+				_, err := exec(`
+					DELETE FROM sidecar_file
+					WHERE file_id = ?;`, imageInfo.Id)
+				for _, f := range imageInfo.Sidecars {
+					if err != nil {
+						break
+					}
+					_, err = exec(`
+						INSERT INTO sidecar_file(path, file_id, kind, modified_unix)
+						VALUES (?, ?, ?, ?)
+						ON CONFLICT (path) DO UPDATE SET
+							file_id = excluded.file_id,
+							kind = excluded.kind,
+							modified_unix = excluded.modified_unix;`,
+						f.Path, imageInfo.Id, f.Kind, f.Modified.Unix())
+				}
+				if err != nil {
+					dbLog.Error("unable to write sidecars", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateCaption:
+				var err error
+				if imageInfo.Caption != nil {
+					_, err = exec(`
+						INSERT INTO caption(file_id, edited, edited_at_unix)
+						VALUES (?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							edited = excluded.edited,
+							edited_at_unix = excluded.edited_at_unix;`,
+						imageInfo.Id, *imageInfo.Caption, time.Now().Unix())
+				} else {
+					_, err = exec(`
+						UPDATE caption
+						SET edited = NULL, edited_at_unix = NULL
+						WHERE file_id = ?;`, imageInfo.Id)
+					if err == nil {
+						_, err = exec(`
+							DELETE FROM caption
+							WHERE file_id = ? AND embedded IS NULL AND edited IS NULL;`, imageInfo.Id)
+					}
+				}
+				if err == nil {
+					err = writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+				if err != nil {
+					dbLog.Error("unable to update caption", "id", imageInfo.Id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateGeotag, ResetGeotag:
+				var err error
+				latlng := imageInfo.Geotag.LatLng
+				if imageInfo.Type == UpdateGeotag {
+					_, err = exec(`
+						INSERT INTO geotag(file_id, latitude, longitude, tagged_at_unix, edited)
+						VALUES (?, ?, ?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							latitude = excluded.latitude,
+							longitude = excluded.longitude,
+							tagged_at_unix = excluded.tagged_at_unix,
+							edited = excluded.edited;`,
+						imageInfo.Id, latlng.Lat.Degrees(), latlng.Lng.Degrees(), time.Now().Unix(), imageInfo.Geotag.Edited)
+				} else {
+					// Back to the location from the metadata of the file
+					latlng = imageInfo.LatLng
+					_, err = exec(`
+						DELETE FROM geotag
+						WHERE file_id = ?;`, imageInfo.Id)
+				}
+				if err == nil {
+					lat, lng := nullDegrees(latlng)
+					_, err = exec(`
+						UPDATE infos
+						SET latitude = ?, longitude = ?
+						WHERE id = ?;`, lat, lng, imageInfo.Id)
+				}
+				if err == nil {
+					err = writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+				if err != nil {
+					dbLog.Error("unable to write geotag", "id", imageInfo.Id, "err", err)
+				} else {
+					pendingEvents = append(pendingEvents, Event{
+						Type: EventMetadataIndexed,
+						Time: time.Now(),
+						Id:   ImageId(imageInfo.Id),
+					})
+				}
+				if imageInfo.Done != nil {
+					imageInfo.Done <- err
+					close(imageInfo.Done)
+				}
+
+			case UpdateTrips:
+				_, err := exec(`
+					UPDATE trip
+					SET detected = 0
+					WHERE collection_id = ?;`, imageInfo.Collection)
+				for _, t := range imageInfo.Trips {
+					if err != nil {
+						break
+					}
+					lat, lng := nullDegrees(t.LatLng)
+					var row pgRow
+					row, _, err = queryRow(`
+						INSERT INTO trip(collection_id, name, start_unix, end_unix, latitude, longitude, cover_id, detected)
+						VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+						ON CONFLICT (collection_id, start_unix) DO UPDATE SET
+							name = excluded.name,
+							end_unix = excluded.end_unix,
+							latitude = excluded.latitude,
+							longitude = excluded.longitude,
+							cover_id = excluded.cover_id,
+							detected = 1
+						RETURNING id;`,
+						imageInfo.Collection, t.Name, t.Start.Unix(), t.End.Unix(), lat, lng, int64(t.Cover))
+					if err != nil {
+						break
+					}
+					id := row.Int64(0)
+					_, err = exec(`
+						DELETE FROM trip_file
+						WHERE trip_id = ?;`, id)
+					if err == nil && len(t.Files) > 0 {
+						files := make([]int64, len(t.Files))
+						for i, fileId := range t.Files {
+							files[i] = int64(fileId)
+						}
+						_, err = exec(`
+							INSERT INTO trip_file(trip_id, file_id)
+							SELECT ?::bigint, file_id
+							FROM unnest(?::bigint[]) AS f(file_id)
+							ON CONFLICT DO NOTHING;`, id, files)
+					}
+				}
+				if err == nil {
+					_, err = exec(`
+						DELETE FROM trip
+						WHERE collection_id = ? AND detected = 0;`, imageInfo.Collection)
+				}
+				if err == nil {
+					_, err = exec(`
+						DELETE FROM trip_file
+						WHERE trip_id NOT IN (SELECT id FROM trip);`)
+				}
+				if err != nil {
+					dbLog.Error("unable to write trips", "collection", imageInfo.Collection, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdatePanoramaPreview:
+				p := imageInfo.Panorama
+				_, err := exec(`
+					UPDATE panorama
+					SET preview = ?
+					WHERE id = ?;`, p.Preview, p.Id)
+				if err != nil {
+					dbLog.Error("unable to update panorama preview", "id", p.Id, "err", err)
+				}
+
+			case UpdateVerification:
+				v := imageInfo.Verification
+				_, err := exec(`
+					INSERT INTO verification(file_id, verified_at_unix, status, detail, modified_at_unix)
+					VALUES (?, ?, ?, ?, ?)
+					ON CONFLICT (file_id) DO UPDATE SET
+						verified_at_unix = excluded.verified_at_unix,
+						status = excluded.status,
+						detail = excluded.detail,
+						modified_at_unix = excluded.modified_at_unix;`,
+					int64(v.Id), v.VerifiedAt.Unix(), string(v.Status), nullText(v.Detail), nullUnix(v.ModifiedAt))
+				if err != nil {
+					dbLog.Error("unable to write verification", "id", v.Id, "err", err)
+				}
+
+			case QuarantineFile:
+				q := imageInfo.Quarantine
+				_, err := exec(`
+					INSERT INTO quarantine(file_id, stage, error, quarantined_at_unix)
+					VALUES (?, ?, ?, ?)
+					ON CONFLICT (file_id) DO UPDATE SET
+						stage = excluded.stage,
+						error = excluded.error,
+						quarantined_at_unix = excluded.quarantined_at_unix;`,
+					int64(q.Id), string(q.Stage), q.Error, q.QuarantinedAt.Unix())
+				if err == nil {
+					err = writeChangeById(ChangeModified, q.Id)
+				}
+				if err != nil {
+					dbLog.Error("unable to quarantine file", "id", q.Id, "err", err)
+				}
+
+			case ReleaseFile:
+				n, err := exec(`
+					DELETE FROM quarantine
+					WHERE file_id = ?;`, imageInfo.Id)
+				if err == nil && n > 0 {
+					err = writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+				if err != nil {
+					dbLog.Error("unable to release file", "id", imageInfo.Id, "err", err)
+				}
+
+			case RejectPanorama:
+				id := imageInfo.Panorama.Id
+				n, err := exec(`
+					UPDATE panorama
+					SET rejected = 1, preview = NULL
+					WHERE id = ? AND rejected = 0;`, id)
+				if err == nil && n == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to reject panorama", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateOrientationProposalStatus:
+				p := imageInfo.Proposal
+				_, err := exec(`
+					UPDATE orientation_proposal
+					SET status = ?
+					WHERE file_id = ?;`, string(p.Status), int64(p.Id))
+				if err != nil {
+					dbLog.Error("unable to update orientation proposal", "id", p.Id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case UpdateDimensions:
+				_, err := exec(`
+					UPDATE infos
+					SET width = ?, height = ?, orientation = ?
+					WHERE id = ?;`,
+					int64(imageInfo.Width), int64(imageInfo.Height), int64(imageInfo.Orientation), imageInfo.Id)
+				if err == nil {
+					err = writeChangeById(ChangeModified, ImageId(imageInfo.Id))
+				}
+				if err != nil {
+					dbLog.Error("unable to update dimensions", "id", imageInfo.Id, "err", err)
+				}
+
+			case UpdateOrientationEdit:
+				id := imageInfo.Id
+				edit := imageInfo.Orientation
+
+				// The stored orientation includes the previous edit, which
+				// is undone before applying the new one
+				row, exists, err := queryRow(`
+					SELECT infos.orientation, coalesce(orientation_edit.orientation, 1)
+					FROM infos
+					LEFT JOIN orientation_edit ON orientation_edit.file_id = infos.id
+					WHERE infos.id = ?;`, id)
+				if err == nil && !exists {
+					err = ErrNotFound
+				}
+				var orientation, previous Orientation
+				if err == nil {
+					orientation = Orientation(row.Int(0))
+					previous = Orientation(row.Int(1))
+				}
+
+				if err == nil {
+					swap := previous.SwapsDimensions() != edit.SwapsDimensions()
+					_, err = exec(`
+						UPDATE infos
+						SET
+							orientation = CASE WHEN orientation IS NULL THEN NULL ELSE ?::integer END,
+							width = CASE WHEN ?::boolean THEN height ELSE width END,
+							height = CASE WHEN ?::boolean THEN width ELSE height END
+						WHERE id = ?;`,
+						int64(orientation.Compose(previous.Inverse()).Compose(edit)), swap, swap, id)
+				}
+
+				if err == nil && edit == Normal {
+					_, err = exec(`
+						DELETE FROM orientation_edit
+						WHERE file_id = ?;`, id)
+				} else if err == nil {
+					_, err = exec(`
+						INSERT INTO orientation_edit(file_id, orientation, edited_at_unix)
+						VALUES (?, ?, ?)
+						ON CONFLICT (file_id) DO UPDATE SET
+							orientation = excluded.orientation,
+							edited_at_unix = excluded.edited_at_unix;`,
+						id, int64(edit), time.Now().Unix())
+				}
+
+				if err == nil {
+					// Proposals are applied on top of the previous edit
+					_, err = exec(`
+						UPDATE orientation_proposal
+						SET status = CASE WHEN orientation = ? THEN 'accepted' ELSE 'rejected' END
+						WHERE file_id = ? AND status = 'pending';`, int64(editDelta(previous, edit)), id)
+				}
+
+				if err == nil {
+					err = writeChangeById(ChangeModified, ImageId(id))
+				}
+				if err != nil {
+					dbLog.Error("unable to update orientation edit", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case Index:
+				_, err := exec(`
+					INSERT INTO dirs(path, indexed_at)
+					VALUES (?, ?)
+					ON CONFLICT (path) DO UPDATE SET
+						indexed_at = excluded.indexed_at;`, imageInfo.Path, imageInfo.DateTime)
+				if err != nil {
+					dbLog.Error("unable to set dir to indexed", "path", imageInfo.Path, "err", err)
+				}
+
+			case UpdateTagMeta:
+				m := imageInfo.TagMeta
+				n, err := exec(`
+					UPDATE tag
+					SET color = NULLIF(?, ''), icon = NULLIF(?, ''), description = NULLIF(?, ''), pinned = ?
+					WHERE id = ?;`, m.Color, m.Icon, m.Description, m.Pinned, imageInfo.Id)
+				if err == nil && n == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to update tag meta", "tag_id", imageInfo.Id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case RenameTag:
+				_, exists, err := queryRow(`
+					SELECT id
+					FROM tag
+					WHERE name = ?;`, imageInfo.Path)
+				if err == nil && exists {
+					err = ErrTagExists
+				}
+				var n int64
+				if err == nil {
+					n, err = exec(`
+						UPDATE tag
+						SET name = ?
+						WHERE id = ?;`, imageInfo.Path, imageInfo.Id)
+				}
+				if err == nil && n == 0 {
+					err = ErrNotFound
+				}
+				if err != nil && err != ErrNotFound && err != ErrTagExists {
+					dbLog.Error("unable to rename tag", "tag_id", imageInfo.Id, "name", imageInfo.Path, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case MergeTag:
+				from := tag.Id(imageInfo.Id)
+				into := imageInfo.MergeInto
+
+				merged, err := pgTagImageIds(sp, from)
+				var ids Ids
+				if err == nil {
+					ids, err = pgTagImageIds(sp, into)
+				}
+				var rev int
+				if err == nil {
+					before := ids.Clone()
+					ids.AddTree(merged)
+
+					rev, err = writeTagIds(into, ids)
+					if err == nil {
+						pendingEvents = appendTagEvents(pendingEvents, tagName, from, merged, NewIds())
+						pendingEvents = appendTagEvents(pendingEvents, tagName, into, before, ids)
+						if source.config.TagRevisions > 0 {
+							err = writeTagRevision(into, rev, TagOpMerge, before, ids)
+						}
+					}
+				}
+				if err == nil {
+					err = removeTag(from)
+				}
+				if err != nil {
+					dbLog.Error("unable to merge tag", "tag_id", from, "into", into, "err", err)
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- rev
+				}
+				close(imageInfo.Done)
+
+			case WriteSelection:
+				sel := imageInfo.Selection
+				err := removeExpiredSelections(sel.CreatedAt)
+				if err == nil {
+					_, err = exec(`
+						INSERT INTO tag(name, revision)
+						VALUES (?, 1)
+						ON CONFLICT DO NOTHING;`, sel.Tag.Name)
+				}
+				if err == nil {
+					var row pgRow
+					var exists bool
+					row, exists, err = queryRow(`
+						SELECT id
+						FROM tag
+						WHERE name = ?;`, sel.Tag.Name)
+					if err == nil && exists {
+						sel.Tag.Id = tag.Id(row.Int64(0))
+					}
+				}
+				if err == nil {
+					var row pgRow
+					var exists bool
+					row, exists, err = queryRow(`
+						INSERT INTO selection (tag_id, user_name, collection_id, created_at_unix, expires_at_unix)
+						VALUES (?, ?, ?, ?, ?)
+						RETURNING id;`,
+						int64(sel.Tag.Id), imageInfo.User, sel.CollectionId, sel.CreatedAt.Unix(), sel.ExpiresAt.Unix())
+					if err == nil && exists {
+						sel.Id = row.Int64(0)
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write selection", "err", err)
+					imageInfo.Done <- err
+				} else {
+					imageInfo.Done <- sel
+				}
+				close(imageInfo.Done)
+
+			case TouchSelection:
+				sel := imageInfo.Selection
+				n, err := exec(`
+					UPDATE selection
+					SET expires_at_unix = ?
+					WHERE id = ? AND user_name = ? AND expires_at_unix > ?;`,
+					sel.ExpiresAt.Unix(), sel.Id, imageInfo.User, time.Now().Unix())
+				if err == nil && n == 0 {
+					err = ErrNotFound
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case DeleteSelection:
+				id := imageInfo.Selection.Id
+				row, exists, err := queryRow(`
+					SELECT tag_id
+					FROM selection
+					WHERE id = ? AND user_name = ?;`, id, imageInfo.User)
+				if err == nil && !exists {
+					err = ErrNotFound
+				}
+				if err == nil {
+					err = removeSelection(id, tag.Id(row.Int64(0)))
+				}
+				if err != nil && err != ErrNotFound {
+					dbLog.Error("unable to delete selection", "id", id, "err", err)
+				}
+				imageInfo.Done <- err
+				close(imageInfo.Done)
+
+			case AddTag:
+				_, err := exec(`
+					INSERT INTO tag(name, revision)
+					VALUES (?, 1)
+					ON CONFLICT DO NOTHING;`, imageInfo.Path)
+				if err != nil {
+					dbLog.Error("unable to upsert tag", "tag", imageInfo.Path, "err", err)
+				}
+				close(imageInfo.Done)
+
+			case AddTagId:
+				name := imageInfo.Path
+				_, err := exec(`
+					INSERT INTO tag(name, revision)
+					VALUES (?, 1)
+					ON CONFLICT DO NOTHING;`, name)
+				var row pgRow
+				exists := false
+				if err == nil {
+					row, exists, err = queryRow(`
+						SELECT id
+						FROM tag
+						WHERE name = ?;`, name)
+				}
+				if err == nil && !exists {
+					err = ErrNotFound
+				}
+				if err == nil {
+					tagId := tag.Id(row.Int64(0))
+					_, err = exec(`
+						INSERT INTO infos_tag (tag_id, file_id, len)
+						VALUES (?, ?, 0)
+						ON CONFLICT DO NOTHING;`, int64(tagId), imageInfo.Id)
+					if err == nil {
+						pendingCompactionTags.Add(tagId)
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to insert tag", "tag", name, "err", err)
+				}
+
+			case AddTagIds, RemoveTagIds, InvertTagIds, CompactTagIds, RollbackTagIds:
+				tagId := tag.Id(imageInfo.Id)
+
+				ids, err := pgTagImageIds(sp, tagId)
+				var before Ids
+				if err == nil {
+					before = ids.Clone()
+					switch imageInfo.Type {
+					case AddTagIds:
+						ids.AddTree(imageInfo.Ids)
+					case RemoveTagIds:
+						ids.SubtractTree(imageInfo.Ids)
+					case InvertTagIds:
+						ids.InvertTree(imageInfo.Ids)
+					case CompactTagIds:
+						// Tags being compacted do not change
+					case RollbackTagIds:
+						var changes []tagChange
+						changes, err = pgTagChanges(sp, tagId, imageInfo.Revision, math.MaxInt)
+						added, removed := composeTagChanges(changes)
+						ids.SubtractTree(added)
+						ids.AddTree(removed)
+					default:
+						panic("Unknown tag id diff type")
+					}
+				}
+
+				var rev int
+				if err == nil {
+					rev, err = writeTagIds(tagId, ids)
+				}
+				if err == nil && imageInfo.Type != CompactTagIds {
+					pendingEvents = appendTagEvents(pendingEvents, tagName, tagId, before, ids)
+					if source.config.TagRevisions > 0 {
+						err = writeTagRevision(tagId, rev, tagWriteOps[imageInfo.Type], before, ids)
+					}
+				}
+				if err != nil {
+					dbLog.Error("unable to write tag ids", "tag_id", tagId, "err", err)
+					rev = 0
+				}
+
+				// The current revision is read by the caller on failure
+				imageInfo.Done <- rev
+				close(imageInfo.Done)
+			}
+
+			// A failed statement aborts the transaction until the savepoint
+			// of its write is rolled back, dropping the events of the write
+			if tx.Conn().PgConn().TxStatus() == 'E' {
+				if err := sp.Rollback(ctx); err != nil {
+					panic(err)
+				}
+				pendingEvents = pendingEvents[:eventCount]
+			} else if err := sp.Commit(ctx); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
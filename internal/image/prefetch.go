@@ -0,0 +1,138 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"photofield/io"
+	"photofield/io/goimage"
+
+	"golang.org/x/image/draw"
+)
+
+// Prefetch loads the photo with the provided id from the cheapest source
+// able to provide it at the provided size, so that a render likely to
+// follow, e.g. the next photo in the lightbox, can be served from the
+// image cache. A zero size assumes the original size of the photo.
+func (source *Source) Prefetch(ctx context.Context, id ImageId, size Size) error {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return err
+	}
+
+	info := source.GetInfo(id)
+	original := io.Size(info.Size())
+	target := original
+	if size.X > 0 && size.Y > 0 {
+		target = io.Size(size).Fit(original, io.FitInside)
+	}
+
+	sources := source.Sources.EstimateCost(original, target)
+	sources.Sort()
+
+	var errs []error
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r := s.Get(ctx, io.ImageId(id), path)
+		if r.Image != nil && r.Error == nil {
+			return nil
+		}
+		if r.Error != nil {
+			errs = append(errs, r.Error)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to prefetch %d: %w", id, errors.Join(errs...))
+	}
+	return fmt.Errorf("unable to prefetch %d: no source available", id)
+}
+
+// LoadImage returns the photo with the provided id from the cheapest source
+// able to provide it at the provided size, transformed to be displayed
+// upright including any orientation edit. A zero size assumes the original
+// size of the photo.
+func (source *Source) LoadImage(ctx context.Context, id ImageId, size Size) (image.Image, error) {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := source.GetInfo(id)
+	original := io.Size(info.Size())
+	target := original
+	if size.X > 0 && size.Y > 0 {
+		target = io.Size(size).Fit(original, io.FitInside)
+	}
+
+	sources := source.Sources.EstimateCost(original, target)
+	sources.Sort()
+
+	var errs []error
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		r := s.Get(ctx, io.ImageId(id), path)
+		if r.Image == nil || r.Error != nil {
+			if r.Error != nil {
+				errs = append(errs, r.Error)
+			}
+			continue
+		}
+		orientation := Orientation(r.Orientation)
+		if r.Orientation == io.SourceInfoOrientation {
+			// Includes the orientation edit
+			orientation = info.Orientation
+		} else {
+			orientation = orientation.Compose(source.GetOrientationEdit(id))
+		}
+		return OrientImage(r.Image, orientation), nil
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("unable to load %d: %w", id, errors.Join(errs...))
+	}
+	return nil, fmt.Errorf("unable to load %d: no source available", id)
+}
+
+// LoadOriginal decodes the original file of the photo at full resolution
+// and in its own colors, for exports that handle its color profile
+// themselves
+func (source *Source) LoadOriginal(ctx context.Context, id ImageId) (image.Image, error) {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return nil, err
+	}
+	r := goimage.Image{}.Get(ctx, io.ImageId(id), path)
+	if r.Error != nil {
+		return nil, fmt.Errorf("unable to load %d: %w", id, r.Error)
+	}
+	// Includes the orientation edit
+	return OrientImage(r.Image, source.GetInfo(id).Orientation), nil
+}
+
+// FitInside scales the image down to fit inside the size, keeping images
+// that already fit as they are
+func FitInside(img image.Image, size Size) image.Image {
+	b := img.Bounds()
+	scale := float64(size.X) / float64(b.Dx())
+	if s := float64(size.Y) / float64(b.Dy()); s < scale {
+		scale = s
+	}
+	if scale >= 1 {
+		return img
+	}
+	w := int(float64(b.Dx())*scale + 0.5)
+	h := int(float64(b.Dy())*scale + 0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
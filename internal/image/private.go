@@ -0,0 +1,166 @@
+package image
+
+import (
+	"strings"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/tag"
+)
+
+// PrivateConfig configures the files that are left out of shared links,
+// the kiosk and scenes unless they are requested explicitly
+type PrivateConfig struct {
+	// Tags of the private files, e.g. nsfw
+	Tags []string   `json:"tags"`
+	Nsfw NsfwConfig `json:"nsfw"`
+}
+
+// NsfwConfig configures the scoring of files for content not safe for work
+// by comparing their AI embeddings to prompts describing it
+type NsfwConfig struct {
+	// Score new files as their AI embeddings are indexed
+	Detect bool `json:"detect"`
+	// Texts describing content not safe for work
+	Prompts []string `json:"prompts"`
+	// Text describing content safe for work
+	Safe string `json:"safe"`
+	// Minimum score between 0 and 1 of a file to be tagged
+	MinScore float32 `json:"min_score"`
+	// Tag of the files scoring at least the minimum score
+	Tag string `json:"tag"`
+}
+
+// hiddenTags returns the tags of the files left out of the listing, except
+// the ones the query filters by, as those files are requested explicitly
+func (options ListOptions) hiddenTags() []string {
+	if len(options.Hide) == 0 {
+		return nil
+	}
+	requested := options.Query.QualifierValues("tag")
+	hidden := make([]string, 0, len(options.Hide))
+	for _, t := range options.Hide {
+		found := false
+		for _, r := range requested {
+			if r == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			hidden = append(hidden, t)
+		}
+	}
+	return hidden
+}
+
+// hiddenTagsSql returns the conditions leaving out the files with any of
+// the count tags bound in order
+func hiddenTagsSql(count int) string {
+	sql := ""
+	for i := 0; i < count; i++ {
+		sql += `
+			AND NOT EXISTS (
+				SELECT 1
+				FROM infos_tag
+				WHERE tag_id IN (
+					SELECT id
+					FROM tag
+					WHERE name = ?
+				)
+				AND infos.id BETWEEN infos_tag.file_id AND infos_tag.file_id+infos_tag.len
+			)
+		`
+	}
+	return sql
+}
+
+// nsfwScore returns the share of the confidence of the embedding matching
+// the prompts, which are followed by the safe prompt
+func nsfwScore(embedding clip.Embedding, prompts []clip.Embedding) (float32, error) {
+	confidences, err := classify(embedding, prompts)
+	if err != nil {
+		return 0, err
+	}
+	score := float32(0)
+	for _, c := range confidences[:len(prompts)-1] {
+		score += c
+	}
+	return score, nil
+}
+
+func (source *Source) getNsfwPrompts() ([]clip.Embedding, error) {
+	config := source.Private.Nsfw
+	texts := append(append([]string(nil), config.Prompts...), config.Safe)
+	return source.nsfwPrompts.get(source.Clip, texts)
+}
+
+// flagNsfw tags the file if its embedding scores at least the minimum
+// score, if detection is enabled
+func (source *Source) flagNsfw(id ImageId, embedding clip.Embedding) {
+	config := source.Private.Nsfw
+	if !config.Detect || len(config.Prompts) == 0 || config.Tag == "" {
+		return
+	}
+	prompts, err := source.getNsfwPrompts()
+	if err != nil {
+		indexLog.Error("unable to embed nsfw prompts", "err", err)
+		return
+	}
+	score, err := nsfwScore(embedding, prompts)
+	if err != nil {
+		indexLog.Error("unable to score nsfw", "id", id, "err", err)
+		return
+	}
+	if score >= config.MinScore {
+		source.database.WriteTags(id, []tag.Tag{{Name: config.Tag}})
+	}
+}
+
+// DetectNsfw queues the files in the dirs with AI embeddings for scoring,
+// tagging the ones scoring at least the minimum score
+func (source *Source) DetectNsfw(dirs []string) {
+	normalized := make([]string, len(dirs))
+	for i := range dirs {
+		normalized[i] = source.Paths.Normalize(dirs[i])
+	}
+	out := make(chan interface{}, 1)
+	out <- strings.Join(normalized, "\n")
+	close(out)
+	source.nsfwQueue.AppendItems(out)
+}
+
+func (source *Source) detectNsfw(in <-chan interface{}) {
+	config := source.Private.Nsfw
+	for elem := range in {
+
+		for source.contentsQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		prompts, err := source.getNsfwPrompts()
+		if err != nil {
+			indexLog.Error("unable to embed nsfw prompts", "err", err)
+			continue
+		}
+
+		dirs := strings.Split(elem.(string), "\n")
+		var flagged []ImageId
+		scored := 0
+		source.database.ScanEmbeddings(dirs, ListOptions{}, func(r EmbeddingsResult) {
+			score, err := nsfwScore(r.Embedding, prompts)
+			if err != nil {
+				return
+			}
+			scored++
+			if score >= config.MinScore {
+				flagged = append(flagged, r.Id)
+			}
+		})
+		t := []tag.Tag{{Name: config.Tag}}
+		for _, id := range flagged {
+			source.database.WriteTags(id, t)
+		}
+		indexLog.Info("detected nsfw", "scored", scored, "flagged", len(flagged))
+	}
+}
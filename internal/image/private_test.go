@@ -0,0 +1,60 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"photofield/internal/clip"
+	"photofield/search"
+)
+
+func TestHiddenTags(t *testing.T) {
+	q, err := search.Parse("tag:nsfw beach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    []string
+	}{
+		{"none", ListOptions{}, nil},
+		{"all", ListOptions{Hide: []string{"nsfw", "private"}}, []string{"nsfw", "private"}},
+		{"requested", ListOptions{Hide: []string{"nsfw", "private"}, Query: q}, []string{"private"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.options.hiddenTags()
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNsfwScore(t *testing.T) {
+	prompts := []clip.Embedding{
+		testEmbedding(1, 0, 0),
+		testEmbedding(0, 1, 0),
+		testEmbedding(0, 0, 1),
+	}
+
+	score, err := nsfwScore(testEmbedding(0.5, 0.5, 0), prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score < 0.99 {
+		t.Errorf("expected the prompts to share the score, got %f", score)
+	}
+
+	score, err = nsfwScore(testEmbedding(0, 0.1, 1), prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score > 0.01 {
+		t.Errorf("expected the safe prompt to win, got %f", score)
+	}
+}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	goimage "image"
+	"math"
+
+	"photofield/io/archive"
+	"photofield/io/gpano"
+)
+
+// indexProjection reads the photo sphere metadata of 360° photos and
+// stores their projection
+func (source *Source) indexProjection(id ImageId, path string) {
+	if !source.IsSupportedImage(path) {
+		return
+	}
+	f, err := archive.Open(path)
+	if err != nil {
+		indexLog.Warn("unable to read projection", "path", path, "err", err)
+		return
+	}
+	p, found, err := gpano.Read(f)
+	f.Close()
+	if err != nil {
+		indexLog.Warn("unable to read projection", "path", path, "err", err)
+		return
+	}
+	if !found {
+		if _, ok := source.database.GetProjection(id); ok {
+			source.database.WriteProjection(id, gpano.Projection{})
+		}
+		return
+	}
+	source.database.WriteProjection(id, p)
+}
+
+// GetProjection returns the projection of the 360° photo, false if it is
+// not one
+func (source *Source) GetProjection(id ImageId) (gpano.Projection, bool) {
+	return source.database.GetProjection(id)
+}
+
+// RenderProjectionView renders a flat perspective view of the 360° photo
+// of the size, loading the photo at a resolution matching the field of view
+func (source *Source) RenderProjectionView(ctx context.Context, id ImageId, view gpano.View, width, height int) (goimage.Image, error) {
+	p, ok := source.database.GetProjection(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if p.Type != gpano.Equirectangular {
+		return nil, fmt.Errorf("unsupported projection %s: %w", p.Type, ErrUnavailable)
+	}
+
+	info := source.GetInfo(id)
+	p.Normalize(info.Width, info.Height)
+
+	// Enough pixels of the photo for one per pixel of the view
+	scale := float64(width) * 360 / view.Fov / float64(p.FullWidth)
+	size := Size{
+		X: int(math.Ceil(float64(info.Width) * scale)),
+		Y: int(math.Ceil(float64(info.Height) * scale)),
+	}
+	img, err := source.LoadImage(ctx, id, size)
+	if err != nil {
+		return nil, err
+	}
+	return gpano.Perspective(img, p, view, width, height), nil
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"context"
+	"errors"
+	goimage "image"
+	"io/fs"
+	"os/exec"
+	"photofield/io/ffmpeg"
+	"photofield/tag"
+	"time"
+)
+
+// QuarantineStage is the indexing step a quarantined file failed at
+type QuarantineStage string
+
+const (
+	QuarantineMetadata  QuarantineStage = "metadata"
+	QuarantineThumbnail QuarantineStage = "thumbnail"
+)
+
+// Quarantined is a file that failed to decode, e.g. a truncated JPEG or a
+// corrupt video. It is left out of scenes and indexing instead of being
+// retried and rendered as a broken tile, until it is reprocessed.
+type Quarantined struct {
+	Id            ImageId
+	Path          string
+	Stage         QuarantineStage
+	Error         string
+	QuarantinedAt time.Time
+}
+
+// corrupt reports whether decoding the file failed because of its
+// contents, given the errors of the decoders tried. Formats a decoder does
+// not support are left to the others, while a missing file or decoder
+// means that the file may well be fine.
+func corrupt(errs ...error) bool {
+	failed := false
+	for _, err := range errs {
+		switch {
+		case err == nil, errors.Is(err, goimage.ErrFormat):
+		case errors.Is(err, fs.ErrNotExist),
+			errors.Is(err, fs.ErrPermission),
+			errors.Is(err, ffmpeg.ErrMissingBinary),
+			errors.Is(err, exec.ErrNotFound),
+			errors.Is(err, context.Canceled),
+			errors.Is(err, context.DeadlineExceeded):
+			return false
+		default:
+			failed = true
+		}
+	}
+	return failed
+}
+
+// quarantineIfCorrupt quarantines the file if the errors show that it is
+// corrupt, reporting whether it did
+func (source *Source) quarantineIfCorrupt(id ImageId, path string, stage QuarantineStage, errs ...error) bool {
+	if !corrupt(errs...) {
+		return false
+	}
+	err := errors.Join(errs...)
+	indexLog.Warn("quarantining file", "id", id, "path", path, "stage", stage, "err", err)
+	source.database.Quarantine(Quarantined{
+		Id:            id,
+		Path:          path,
+		Stage:         stage,
+		Error:         err.Error(),
+		QuarantinedAt: time.Now(),
+	})
+	source.flagFile(id, tag.DecodeError, true)
+	return true
+}
+
+// ListQuarantine lists the files that failed to decode in the dirs, or in
+// all dirs if none, the most recently quarantined first
+func (source *Source) ListQuarantine(dirs []string, limit int) []Quarantined {
+	normalized := make([]string, len(dirs))
+	for i, dir := range dirs {
+		normalized[i] = source.Paths.Normalize(dir)
+	}
+	source.database.WaitForCommit()
+	return source.database.ListQuarantine(normalized, limit)
+}
@@ -0,0 +1,35 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	goimage "image"
+	"io/fs"
+	"photofield/io/ffmpeg"
+	"testing"
+)
+
+func TestCorrupt(t *testing.T) {
+	truncated := errors.New("unexpected EOF")
+	cases := []struct {
+		name    string
+		errs    []error
+		corrupt bool
+	}{
+		{"none", nil, false},
+		{"decoded", []error{nil}, false},
+		{"truncated", []error{truncated}, true},
+		{"wrapped", []error{fmt.Errorf("unable to decode: %w", truncated)}, true},
+		{"unsupported", []error{goimage.ErrFormat}, false},
+		{"unsupported by one", []error{goimage.ErrFormat, truncated}, true},
+		{"missing file", []error{fs.ErrNotExist}, false},
+		{"missing decoder", []error{ffmpeg.ErrMissingBinary, truncated}, false},
+		{"canceled", []error{context.Canceled}, false},
+	}
+	for _, c := range cases {
+		if corrupt(c.errs...) != c.corrupt {
+			t.Errorf("%s: expected corrupt %v", c.name, c.corrupt)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// QueryConfig configures the read-only SQL queries against the cache
+// database
+type QueryConfig struct {
+	Enable bool `json:"enable"`
+	// Maximum number of rows returned by a query
+	MaxRows int `json:"max_rows"`
+	// Maximum time a query runs for before it is interrupted
+	Timeout string `json:"timeout"`
+}
+
+func (config QueryConfig) timeout() (time.Duration, error) {
+	if config.Timeout == "" {
+		return 10 * time.Second, nil
+	}
+	return time.ParseDuration(config.Timeout)
+}
+
+// Duration returns the maximum time a query runs for
+func (config QueryConfig) Duration() time.Duration {
+	d, _ := config.timeout()
+	return d
+}
+
+// Rows returns the maximum number of rows a query returns
+func (config QueryConfig) Rows() int {
+	if config.MaxRows <= 0 {
+		return 10000
+	}
+	return config.MaxRows
+}
+
+func (config *QueryConfig) Validate() error {
+	if _, err := config.timeout(); err != nil {
+		return fmt.Errorf("timeout: %w", err)
+	}
+	return nil
+}
+
+var ErrQueryNotReadOnly = errors.New("only a single SELECT statement is allowed")
+var ErrQueryInterrupted = errors.New("query interrupted")
+
+// checkReadOnlyQuery rejects anything but a single SELECT statement. The
+// connection is read-only as well, this only gives a friendlier error.
+func checkReadOnlyQuery(sql string) error {
+	s := strings.TrimSpace(sql)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	switch strings.ToUpper(s[:end]) {
+	case "SELECT", "WITH", "VALUES":
+		return nil
+	}
+	return ErrQueryNotReadOnly
+}
+
+// Query runs the read-only SQL statement against the cache database,
+// calling columns with the column names and then row with the values of
+// each row, until maxRows rows were returned or the context is done.
+// Returns true if there were more rows.
+func (source *Database) Query(ctx context.Context, sql string, maxRows int, columns func(names []string) error, row func(values []any) error) (bool, error) {
+	if err := checkReadOnlyQuery(sql); err != nil {
+		return false, err
+	}
+
+	conn, err := sqlite.OpenConn(source.path, sqlite.OpenReadOnly, sqlite.OpenWAL)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if err := sqlitex.ExecuteTransient(conn, "PRAGMA query_only = ON;", nil); err != nil {
+		return false, err
+	}
+	conn.SetInterrupt(ctx.Done())
+
+	stmt, trailing, err := conn.PrepareTransient(sql)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Finalize()
+	if rest := strings.TrimSpace(sql[len(sql)-trailing:]); rest != "" && rest != ";" {
+		return false, ErrQueryNotReadOnly
+	}
+
+	names := make([]string, stmt.ColumnCount())
+	for i := range names {
+		names[i] = stmt.ColumnName(i)
+	}
+	values := make([]any, len(names))
+
+	// Step once before reporting the columns, so that writes and most
+	// other errors are reported before any rows
+	exists, err := stmt.Step()
+	for n := 0; ; n++ {
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, ErrQueryInterrupted
+			}
+			return false, err
+		}
+		if n == 0 {
+			if err := columns(names); err != nil {
+				return false, err
+			}
+		}
+		if !exists {
+			return false, nil
+		}
+		if n >= maxRows {
+			return true, nil
+		}
+		for i := range values {
+			switch stmt.ColumnType(i) {
+			case sqlite.TypeInteger:
+				values[i] = stmt.ColumnInt64(i)
+			case sqlite.TypeFloat:
+				values[i] = stmt.ColumnFloat(i)
+			case sqlite.TypeText:
+				values[i] = stmt.ColumnText(i)
+			case sqlite.TypeBlob:
+				b := make([]byte, stmt.ColumnLen(i))
+				stmt.ColumnBytes(i, b)
+				values[i] = b
+			default:
+				values[i] = nil
+			}
+		}
+		if err := row(values); err != nil {
+			return false, err
+		}
+		exists, err = stmt.Step()
+	}
+}
+
+func (source *Source) Query(ctx context.Context, sql string, maxRows int, columns func(names []string) error, row func(values []any) error) (bool, error) {
+	return source.database.Query(ctx, sql, maxRows, columns, row)
+}
@@ -0,0 +1,27 @@
+package image
+
+import "testing"
+
+func TestCheckReadOnlyQuery(t *testing.T) {
+	cases := []struct {
+		sql string
+		ok  bool
+	}{
+		{"SELECT * FROM infos", true},
+		{"  select count(*) from infos;", true},
+		{"SELECT\n\tid FROM infos", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"VALUES (1), (2)", true},
+		{"DELETE FROM infos", false},
+		{"PRAGMA query_only = OFF", false},
+		{"ATTACH DATABASE 'x.db' AS x", false},
+		{"SELECTED", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		err := checkReadOnlyQuery(c.sql)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: expected ok %v, got %v", c.sql, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"time"
+)
+
+// How often a read-only source picks up the changes of the writer
+const followInterval = 5 * time.Second
+
+// rejectPendingWrites replaces the writer of a read-only database, failing
+// the writes waited for with ErrReadOnly and dropping the rest
+func (queue *writeQueue) rejectPendingWrites() {
+	warned := false
+	for w := range queue.pending {
+		if w.Type != Flush && !warned {
+			dbLog.Warn("dropping writes to read-only database, indexing and edits are made by the writer instance")
+			warned = true
+		}
+		if w.Done == nil {
+			continue
+		}
+		if w.Type == Flush {
+			close(w.Done)
+			continue
+		}
+		go func(done chan any) {
+			done <- ErrReadOnly
+			close(done)
+		}(w.Done)
+	}
+}
+
+// loadOrientationEdits replaces the cached orientation edits with the ones
+// in the database
+func (source *Source) loadOrientationEdits() {
+	edits := source.database.ListOrientationEdits()
+	source.orientationEdits.Range(func(key, value any) bool {
+		if _, ok := edits[key.(ImageId)]; !ok {
+			source.orientationEdits.Delete(key)
+		}
+		return true
+	})
+	for id, edit := range edits {
+		source.orientationEdits.Store(id, edit)
+	}
+}
+
+// followChanges keeps the caches of a read-only source in sync with the
+// files the writer sharing the database adds, modifies and removes
+func (source *Source) followChanges() {
+	cursor := source.database.LatestChange(nil)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		changed := false
+		for c := range source.database.ListChanges(nil, cursor, 0) {
+			source.imageInfoCache.Delete(c.Id)
+			source.pathCache.Delete(c.Id)
+			source.hashCache.Delete(c.Id)
+			source.forget(c.Id)
+			cursor = c.Cursor
+			changed = true
+		}
+		if changed {
+			source.loadOrientationEdits()
+		}
+		// Embeddings are added without recording a change
+		if err := source.database.RefreshEmbeddings(); err != nil {
+			dbLog.Warn("unable to refresh embeddings", "err", err)
+		}
+	}
+}
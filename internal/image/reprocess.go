@@ -0,0 +1,94 @@
+package image
+
+import (
+	"context"
+	"photofield/internal/clip"
+	"photofield/io"
+	"photofield/tag"
+)
+
+// ReprocessStep is the outcome of one step of reprocessing a file. A step
+// that is neither done nor failed was skipped.
+type ReprocessStep struct {
+	Done bool
+	Err  error
+}
+
+func reprocessStep(err error) ReprocessStep {
+	return ReprocessStep{Done: err == nil, Err: err}
+}
+
+// Reprocessed reports the steps of reprocessing a file
+type Reprocessed struct {
+	Metadata  ReprocessStep
+	Thumbnail ReprocessStep
+	Color     ReprocessStep
+	Embedding ReprocessStep
+}
+
+// Reprocess reads the metadata of the file again and regenerates its
+// thumbnail, color and AI embedding right away instead of queueing them,
+// e.g. after the original was replaced or rotated by another program. The
+// steps run even if earlier ones fail, ErrNotFound is only returned for
+// unknown ids. A quarantined file is released, unless it still fails to
+// decode.
+func (source *Source) Reprocess(ctx context.Context, id ImageId) (Reprocessed, error) {
+	var r Reprocessed
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return r, err
+	}
+
+	// Released first, so that it is quarantined again if still corrupt
+	source.database.ReleaseQuarantine(id)
+	source.flagFile(id, tag.DecodeError, false)
+
+	err = source.indexMetadataFile(id, path)
+	r.Metadata = reprocessStep(err)
+	if err != nil {
+		source.quarantineIfCorrupt(id, path, QuarantineMetadata, err)
+	}
+	source.hashCache.Delete(id)
+	source.indexFileHash(IdPath{Id: id, Path: path})
+
+	// Drop the stored thumbnail, tiles and sprites and any decoded images,
+	// so that nothing of the previous contents is served again
+	if err := source.thumbnailSink.Delete(uint32(id)); err != nil {
+		indexLog.Warn("unable to delete thumbnail", "id", id, "err", err)
+	}
+	source.forget(id)
+
+	img, rs, err := source.indexContentsGenerate(ctx, io.ImageId(id), path)
+	r.Thumbnail = reprocessStep(err)
+	if err != nil {
+		source.quarantineGenerate(id, path, err)
+	} else {
+		m := MissingInfo{
+			Id:   id,
+			Path: path,
+			Missing: Missing{
+				Color:     true,
+				Embedding: source.AI.Available(),
+			},
+		}
+		colorErr, embeddingErr := source.indexContentsReader(ctx, m, nil, img, rs)
+		r.Color = reprocessStep(colorErr)
+		if m.Embedding && embeddingErr != clip.ErrNotAvailable {
+			r.Embedding = reprocessStep(embeddingErr)
+		}
+	}
+
+	source.database.Flush()
+	source.imageInfoCache.Delete(id)
+	source.forget(id)
+	return r, nil
+}
+
+// forget drops the decoded images of the file cached by the sources
+func (source *Source) forget(id ImageId) {
+	for _, s := range source.Sources {
+		if f, ok := s.(io.Forgetter); ok {
+			f.Forget(io.ImageId(id))
+		}
+	}
+}
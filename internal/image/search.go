@@ -1,8 +1,6 @@
 package image
 
 import (
-	"log"
-	"path/filepath"
 	"photofield/internal/clip"
 	"photofield/internal/metrics"
 	"sort"
@@ -28,7 +26,7 @@ func (source *Source) getSimilarityInfos(list []similar) []SimilarityInfo {
 	for info := range source.database.GetBatch(ids) {
 		index, ok := idToIndex.Load(uint32(info.Id))
 		if !ok {
-			log.Printf("Unable to look up similarity index for %d\n", info.Id)
+			indexLog.Warn("unable to look up similarity index", "id", info.Id)
 			continue
 		}
 		infos[index] = SimilarityInfo{
@@ -56,10 +54,30 @@ func (w similarityBatchWorker) close() {
 	close(w.input)
 }
 
+// rescore scores the most similar files of a quantized search again with
+// their stored embeddings and orders them by the exact similarity
+func (source *Source) rescore(top []similar, search []float32, searchInvNorm float32) {
+	for i := range top {
+		emb, err := source.database.GetImageEmbedding(top[i].id)
+		if err != nil || emb == nil {
+			continue
+		}
+		dot, err := clip.DotProductFloat32Float(search, emb.Float())
+		if err != nil {
+			continue
+		}
+		top[i].similarity = dot * searchInvNorm * emb.InvNormFloat32()
+	}
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].similarity > top[j].similarity
+	})
+}
+
 func (source *Source) ListSimilar(dirs []string, embedding clip.Embedding, options ListOptions) <-chan SimilarityInfo {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
+	options.ignored = source.newIgnoreFilter(options.Ignore)
 	out := make(chan SimilarityInfo, 1000)
 	go func() {
 		defer metrics.Elapsed("list similar")()
@@ -74,20 +92,34 @@ func (source *Source) ListSimilar(dirs []string, embedding clip.Embedding, optio
 		search := embedding.Float32()
 		searchInvNorm := embedding.InvNormFloat32()
 
-		// List all related embeddings and compute their similarity
+		// List all related embeddings and compute their similarity, from the
+		// quantized copy if there is one
 		done := metrics.Elapsed("list similar embeddings")
-		embeddings := source.database.ListEmbeddings(dirs, options)
-		for emb := range embeddings {
-			dot, err := clip.DotProductFloat32Float(search, emb.Float())
+		quantized := source.database.ScanQuantizedEmbeddings(dirs, options, func(emb QuantizedEmbedding) {
+			dot, err := clip.DotProductFloat32Int8(search, emb.Vector)
 			if err != nil {
-				log.Printf("Unable to compute dot product for %d: %s", emb.Id, err.Error())
-				continue
+				indexLog.Warn("unable to compute dot product", "id", emb.Id, "err", err)
+				return
 			}
 
-			similarity := dot * searchInvNorm * emb.InvNormFloat32()
 			similars = append(similars, similar{
 				id:         emb.Id,
-				similarity: similarity,
+				similarity: dot * searchInvNorm * emb.Scale,
+			})
+		})
+		if !quantized {
+			source.database.ScanEmbeddings(dirs, options, func(emb EmbeddingsResult) {
+				dot, err := clip.DotProductFloat32Float(search, emb.Float())
+				if err != nil {
+					indexLog.Warn("unable to compute dot product", "id", emb.Id, "err", err)
+					return
+				}
+
+				similarity := dot * searchInvNorm * emb.InvNormFloat32()
+				similars = append(similars, similar{
+					id:         emb.Id,
+					similarity: similarity,
+				})
 			})
 		}
 		done()
@@ -99,6 +131,12 @@ func (source *Source) ListSimilar(dirs []string, embedding clip.Embedding, optio
 		})
 		done()
 
+		if quantized && source.Embeddings.Rescore > 0 {
+			done = metrics.Elapsed("list similar rescore")
+			source.rescore(similars[:min(len(similars), source.Embeddings.Rescore)], search, searchInvNorm)
+			done()
+		}
+
 		// Get image info for the sorted embeddings in batches
 		done = metrics.Elapsed("list similar batches")
 		list := similars
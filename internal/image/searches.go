@@ -0,0 +1,79 @@
+package image
+
+import (
+	"strings"
+	"time"
+)
+
+// Maximum number of recent searches kept per user, saved searches are kept
+// regardless
+const MaxSearchHistory = 100
+
+// Searches made this soon after the previous one of a collection replace it
+// if they only extend or shorten its query, so that the history keeps the
+// query searched for in the end instead of every one while typing
+const searchTypingWindow = time.Minute
+
+// Search is a query a user searched a collection for, saved as a smart
+// album if it is named
+type Search struct {
+	Id           int64
+	CollectionId string
+	Query        string
+	SearchedAt   time.Time
+	// Name of the smart album, empty if the search is not saved
+	Name string
+}
+
+// Saved reports whether the search is saved as a smart album
+func (s Search) Saved() bool {
+	return s.Name != ""
+}
+
+// replacesSearch reports whether searching for the query after the
+// previous search replaces it in the history
+func replacesSearch(previous Search, query string, at time.Time) bool {
+	if previous.Saved() || previous.Query == query {
+		return false
+	}
+	if at.Sub(previous.SearchedAt) > searchTypingWindow {
+		return false
+	}
+	return strings.HasPrefix(query, previous.Query) || strings.HasPrefix(previous.Query, query)
+}
+
+// RecordSearch adds the query to the search history of the user
+func (source *Source) RecordSearch(user string, collectionId string, query string) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return
+	}
+	source.database.WriteSearch(user, Search{
+		CollectionId: collectionId,
+		Query:        query,
+		SearchedAt:   time.Now(),
+	})
+}
+
+// ListSearches returns up to limit searches of the user, the most recent
+// first, only the saved ones if saved is true
+func (source *Source) ListSearches(user string, saved bool, limit int) ([]Search, error) {
+	return source.database.ListSearches(user, saved, limit)
+}
+
+// SaveSearch saves the query as a smart album with the name, renaming it
+// if it is saved already
+func (source *Source) SaveSearch(user string, collectionId string, query string, name string) (Search, error) {
+	return source.database.SaveSearch(user, Search{
+		CollectionId: collectionId,
+		Query:        strings.TrimSpace(query),
+		SearchedAt:   time.Now(),
+		Name:         name,
+	})
+}
+
+// DeleteSearch removes the search from the history or the smart albums of
+// the user, ErrNotFound if the user has no search with the id
+func (source *Source) DeleteSearch(user string, id int64) error {
+	return source.database.DeleteSearch(user, id)
+}
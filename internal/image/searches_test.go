@@ -0,0 +1,32 @@
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplacesSearch(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	previous := Search{Query: "sun", SearchedAt: at}
+	tests := []struct {
+		name     string
+		previous Search
+		query    string
+		at       time.Time
+		want     bool
+	}{
+		{"extended while typing", previous, "sunset", at.Add(time.Second), true},
+		{"shortened while typing", previous, "su", at.Add(time.Second), true},
+		{"same query", previous, "sun", at.Add(time.Second), false},
+		{"different query", previous, "beach", at.Add(time.Second), false},
+		{"searched again later", previous, "sunset", at.Add(2 * time.Minute), false},
+		{"saved", Search{Query: "sun", SearchedAt: at, Name: "Sun"}, "sunset", at.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replacesSearch(tt.previous, tt.query, tt.at); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
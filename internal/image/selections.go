@@ -0,0 +1,234 @@
+package image
+
+import (
+	"errors"
+	"time"
+
+	"photofield/tag"
+)
+
+// Selection is a selection of files kept on the server, so that selections
+// spanning many pages of a large scene do not have to be held by the
+// browser. The files are held in a selection tag, which is deleted along
+// with the selection once it expires.
+type Selection struct {
+	Id           int64
+	CollectionId string
+	Tag          tag.Tag
+	CreatedAt    time.Time
+	// Extended every time the selection is changed
+	ExpiresAt time.Time
+	// Number of selected files
+	Count int
+}
+
+// CreateSelection creates an empty selection of files of the collection
+// for the user, deleting the selections that expired
+func (source *Source) CreateSelection(user string, collectionId string) (Selection, error) {
+	t, err := tag.NewSelection(collectionId)
+	if err != nil {
+		return Selection{}, err
+	}
+	now := time.Now()
+	return source.database.WriteSelection(user, Selection{
+		CollectionId: collectionId,
+		Tag:          t,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(source.TagConfig.Selections.TTL()),
+	})
+}
+
+// GetSelection returns the selection of the user, ErrNotFound if the user
+// has no selection with the id or it expired
+func (source *Source) GetSelection(user string, id int64) (Selection, error) {
+	sel, err := source.database.GetSelection(user, id)
+	if err != nil {
+		return sel, err
+	}
+	sel.Count = countIds(source.database.GetTagImageIds(sel.Tag.Id))
+	return sel, nil
+}
+
+// ListSelections lists the selections of the user of the collection, or of
+// all collections if empty, the most recent first
+func (source *Source) ListSelections(user string, collectionId string) ([]Selection, error) {
+	selections, err := source.database.ListSelections(user, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range selections {
+		selections[i].Count = countIds(source.database.GetTagImageIds(selections[i].Tag.Id))
+	}
+	return selections, nil
+}
+
+// SelectFiles adds the files to the selection, removes them from it or
+// inverts them depending on the op, extending how long it is kept
+func (source *Source) SelectFiles(user string, id int64, op string, ch <-chan ImageId) (Selection, error) {
+	ids := NewIds()
+	for id := range ch {
+		ids.AddInt(int(id))
+	}
+	sel, err := source.database.GetSelection(user, id)
+	if err != nil {
+		return sel, err
+	}
+	switch op {
+	case TagOpAdd:
+		sel.Tag.Revision, err = source.database.AddTagIds(sel.Tag.Id, ids)
+	case TagOpSubtract:
+		sel.Tag.Revision, err = source.database.RemoveTagIds(sel.Tag.Id, ids)
+	case TagOpInvert:
+		sel.Tag.Revision, err = source.database.InvertTagIds(sel.Tag.Id, ids)
+	default:
+		err = errors.New("unsupported op " + op)
+	}
+	if err != nil {
+		return sel, err
+	}
+	if err := source.touchSelection(user, &sel); err != nil {
+		return sel, err
+	}
+	sel.Count = countIds(source.database.GetTagImageIds(sel.Tag.Id))
+	return sel, nil
+}
+
+// TagSelection adds the selected files to the tag with the name, creating
+// it if needed, and returns the tag with its new revision
+func (source *Source) TagSelection(user string, id int64, name string) (tag.Tag, error) {
+	sel, err := source.database.GetSelection(user, id)
+	if err != nil {
+		return tag.Tag{}, err
+	}
+	source.AddTag(name)
+	t, ok := source.GetTag(name)
+	if !ok {
+		return tag.Tag{}, errors.New("unable to create tag")
+	}
+	t.Revision, err = source.database.AddTagIds(t.Id, source.database.GetTagImageIds(sel.Tag.Id))
+	if err != nil {
+		return tag.Tag{}, err
+	}
+	return t, source.touchSelection(user, &sel)
+}
+
+// DeleteSelection deletes the selection of the user along with its tag,
+// ErrNotFound if the user has no selection with the id
+func (source *Source) DeleteSelection(user string, id int64) error {
+	return source.database.DeleteSelection(user, id)
+}
+
+// touchSelection extends how long the selection is kept
+func (source *Source) touchSelection(user string, sel *Selection) error {
+	sel.ExpiresAt = time.Now().Add(source.TagConfig.Selections.TTL())
+	return source.database.TouchSelection(user, *sel)
+}
+
+func (queue *writeQueue) WriteSelection(user string, sel Selection) (Selection, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User:      user,
+		Selection: sel,
+		Type:      WriteSelection,
+		Done:      done,
+	}
+	switch result := (<-done).(type) {
+	case error:
+		return Selection{}, result
+	case Selection:
+		queue.WaitForCommit()
+		return result, nil
+	}
+	return Selection{}, errors.New("unable to write selection")
+}
+
+func (queue *writeQueue) TouchSelection(user string, sel Selection) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User:      user,
+		Selection: sel,
+		Type:      TouchSelection,
+		Done:      done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (queue *writeQueue) DeleteSelection(user string, id int64) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User:      user,
+		Selection: Selection{Id: id},
+		Type:      DeleteSelection,
+		Done:      done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (source *Database) GetSelection(user string, id int64) (Selection, error) {
+	selections, err := source.listSelections(user, id, "")
+	if err != nil {
+		return Selection{}, err
+	}
+	if len(selections) == 0 {
+		return Selection{}, ErrNotFound
+	}
+	return selections[0], nil
+}
+
+func (source *Database) ListSelections(user string, collectionId string) ([]Selection, error) {
+	return source.listSelections(user, 0, collectionId)
+}
+
+// listSelections lists the selections of the user that did not expire yet,
+// only the one with the id if not 0 and only the ones of the collection if
+// not empty
+func (source *Database) listSelections(user string, id int64, collectionId string) ([]Selection, error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT selection.id, collection_id, created_at_unix, expires_at_unix,
+			tag.id, tag.name, tag.revision
+		FROM selection
+		JOIN tag ON tag.id == selection.tag_id
+		WHERE user_name == ? AND expires_at_unix > ?
+			AND (? == 0 OR selection.id == ?)
+			AND (? == '' OR collection_id == ?)
+		ORDER BY created_at_unix DESC, selection.id DESC;`)
+	defer stmt.Reset()
+	stmt.BindText(1, user)
+	stmt.BindInt64(2, time.Now().Unix())
+	stmt.BindInt64(3, id)
+	stmt.BindInt64(4, id)
+	stmt.BindText(5, collectionId)
+	stmt.BindText(6, collectionId)
+
+	selections := make([]Selection, 0)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			return nil, err
+		} else if !exists {
+			break
+		}
+		selections = append(selections, Selection{
+			Id:           stmt.ColumnInt64(0),
+			CollectionId: stmt.ColumnText(1),
+			CreatedAt:    time.Unix(stmt.ColumnInt64(2), 0),
+			ExpiresAt:    time.Unix(stmt.ColumnInt64(3), 0),
+			Tag: tag.Tag{
+				Id:       tag.Id(stmt.ColumnInt64(4)),
+				Name:     stmt.ColumnText(5),
+				Revision: stmt.ColumnInt(6),
+			},
+		})
+	}
+	return selections, nil
+}
@@ -0,0 +1,162 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"photofield/tag"
+)
+
+func newTestSelectionSource(t *testing.T) *Source {
+	t.Helper()
+	source := &Source{database: newTestDatabase(t)}
+	source.TagConfig.Selections.TTLHours = 1
+	return source
+}
+
+// selectIds sends the ids from..to-1 to the selection
+func selectIds(source *Source, id int64, op string, from int, to int) (Selection, error) {
+	ch := make(chan ImageId)
+	go func() {
+		for i := from; i < to; i++ {
+			ch <- ImageId(i)
+		}
+		close(ch)
+	}()
+	return source.SelectFiles("alice", id, op, ch)
+}
+
+func TestSelectionCreate(t *testing.T) {
+	source := newTestSelectionSource(t)
+	before := time.Now().Add(-time.Second)
+	sel, err := source.CreateSelection("alice", "photos")
+	if err != nil {
+		t.Fatalf("unable to create selection: %v", err)
+	}
+	if sel.Id == 0 || sel.Tag.Id == 0 || !strings.HasPrefix(sel.Tag.Name, tag.SelectionPrefix) {
+		t.Errorf("expected selection with a selection tag, got %+v", sel)
+	}
+	if sel.ExpiresAt.Before(before.Add(time.Hour)) {
+		t.Errorf("expected selection to expire after the ttl, got %v", sel.ExpiresAt)
+	}
+
+	sel, err = selectIds(source, sel.Id, TagOpAdd, 1, 11)
+	if err != nil {
+		t.Fatalf("unable to select files: %v", err)
+	}
+	if sel.Count != 10 {
+		t.Errorf("expected 10 selected files, got %d", sel.Count)
+	}
+
+	selections, err := source.ListSelections("alice", "photos")
+	if err != nil {
+		t.Fatalf("unable to list selections: %v", err)
+	}
+	if len(selections) != 1 || selections[0].Id != sel.Id || selections[0].Count != 10 {
+		t.Errorf("expected the selection, got %+v", selections)
+	}
+	if selections, _ := source.ListSelections("alice", "other"); len(selections) != 0 {
+		t.Errorf("expected no selections of another collection, got %+v", selections)
+	}
+	if selections, _ := source.ListSelections("bob", ""); len(selections) != 0 {
+		t.Errorf("expected no selections of another user, got %+v", selections)
+	}
+	ch := make(chan ImageId)
+	close(ch)
+	if _, err := source.SelectFiles("bob", sel.Id, TagOpAdd, ch); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the selection of another user to be not found, got %v", err)
+	}
+}
+
+func TestSelectionExpiry(t *testing.T) {
+	source := newTestSelectionSource(t)
+	expired, err := tag.NewSelection("photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sel, err := source.database.WriteSelection("alice", Selection{
+		CollectionId: "photos",
+		Tag:          expired,
+		CreatedAt:    now.Add(-2 * time.Hour),
+		ExpiresAt:    now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unable to write selection: %v", err)
+	}
+
+	if _, err := source.GetSelection("alice", sel.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired selection to be not found, got %v", err)
+	}
+	if selections, _ := source.ListSelections("alice", ""); len(selections) != 0 {
+		t.Errorf("expected expired selection not to be listed, got %+v", selections)
+	}
+	ch := make(chan ImageId)
+	close(ch)
+	if _, err := source.SelectFiles("alice", sel.Id, TagOpAdd, ch); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired selection not to be extended, got %v", err)
+	}
+
+	// Expired selections are deleted along with their tags once the next
+	// one is created
+	if _, ok := source.database.GetTagByName(expired.Name); !ok {
+		t.Fatal("expected the tag of the expired selection to be kept until then")
+	}
+	if _, err := source.CreateSelection("alice", "photos"); err != nil {
+		t.Fatalf("unable to create selection: %v", err)
+	}
+	if _, ok := source.database.GetTagByName(expired.Name); ok {
+		t.Error("expected the tag of the expired selection to be deleted")
+	}
+}
+
+func TestSelectionConcurrent(t *testing.T) {
+	source := newTestSelectionSource(t)
+	sel, err := source.CreateSelection("alice", "photos")
+	if err != nil {
+		t.Fatalf("unable to create selection: %v", err)
+	}
+	if _, err := selectIds(source, sel.Id, TagOpAdd, 1001, 2001); err != nil {
+		t.Fatalf("unable to select files: %v", err)
+	}
+
+	// Adds 1-1000 and removes 1001-2000 in disjoint batches at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		from := 1 + i*100
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := selectIds(source, sel.Id, TagOpAdd, from, from+100)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := selectIds(source, sel.Id, TagOpSubtract, 1000+from, 1000+from+100)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unable to change selection: %v", err)
+		}
+	}
+
+	sel, err = source.GetSelection("alice", sel.Id)
+	if err != nil {
+		t.Fatalf("unable to get selection: %v", err)
+	}
+	if sel.Count != 1000 {
+		t.Errorf("expected 1000 selected files, got %d", sel.Count)
+	}
+	ranges := source.database.GetTagImageIds(sel.Tag.Id).Slice()
+	if len(ranges) != 1 || ranges[0].Low != 1 || ranges[0].High != 1000 {
+		t.Errorf("expected files 1-1000 to be selected, got %v", ranges)
+	}
+}
@@ -0,0 +1,320 @@
+package image
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"photofield/io/archive"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+const sidecarVersion = 1
+
+// How long changes are collected before the sidecars of the changed dirs
+// are written
+const sidecarWriteDelay = 10 * time.Second
+
+// SidecarConfig configures the per-dir sidecar index files, which store the
+// derived metadata alongside the files, so that a fresh install can ingest
+// them instead of reading every file again
+type SidecarConfig struct {
+	// Write a sidecar to every dir with indexed files
+	Write bool `json:"write"`
+	// Use the sidecars instead of reading the files if they are unchanged
+	Read bool `json:"read"`
+	// File name of the sidecars
+	Name string `json:"name"`
+}
+
+func (config SidecarConfig) name() string {
+	if config.Name == "" {
+		return ".photofield.json"
+	}
+	return config.Name
+}
+
+// DirFile is an indexed file in a dir
+type DirFile struct {
+	Id   ImageId
+	Name string
+	Hash ContentHash
+	InfoResult
+	Camera Camera
+}
+
+type sidecarFile struct {
+	// Size and modification time of the file the entry was derived from
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+
+	Hash   string `json:"hash,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+
+	Width       int         `json:"width,omitempty"`
+	Height      int         `json:"height,omitempty"`
+	Orientation Orientation `json:"orientation,omitempty"`
+	Date        *time.Time  `json:"date,omitempty"`
+	Latitude    *float64    `json:"latitude,omitempty"`
+	Longitude   *float64    `json:"longitude,omitempty"`
+
+	Make   string `json:"make,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Serial string `json:"serial,omitempty"`
+
+	Description string `json:"description,omitempty"`
+}
+
+type sidecar struct {
+	Version int `json:"version"`
+	// Prefix size of the fast hashes, see fileHash
+	HashPrefixSize int64                  `json:"hash_prefix_size"`
+	Files          map[string]sidecarFile `json:"files"`
+}
+
+// matches reports whether the entry was derived from the file as it is now
+func (f sidecarFile) matches(info os.FileInfo) bool {
+	return f.Size == info.Size() && f.Modified.Unix() == info.ModTime().Unix()
+}
+
+func (f sidecarFile) hasMeta() bool {
+	return f.Width > 0 && f.Height > 0
+}
+
+func (f sidecarFile) info() (Info, Camera) {
+	info := Info{
+		Width:       f.Width,
+		Height:      f.Height,
+		Orientation: f.Orientation,
+		LatLng:      NaNLatLng(),
+		Description: f.Description,
+	}
+	if info.Orientation == 0 {
+		info.Orientation = Normal
+	}
+	if f.Date != nil {
+		info.DateTime = *f.Date
+	}
+	if f.Latitude != nil && f.Longitude != nil {
+		info.LatLng = s2.LatLngFromDegrees(*f.Latitude, *f.Longitude)
+	}
+	camera := Camera{
+		Make:   f.Make,
+		Model:  f.Model,
+		Serial: f.Serial,
+	}
+	return info, camera
+}
+
+type loadedSidecar struct {
+	modified time.Time
+	sidecar  sidecar
+}
+
+type sidecars struct {
+	config         SidecarConfig
+	hashPrefixSize int64
+
+	mutex  sync.Mutex
+	loaded map[string]loadedSidecar
+	dirty  map[string]struct{}
+	timer  *time.Timer
+	write  func(dirs []string)
+}
+
+func newSidecars(config SidecarConfig, hashPrefixSize int64, write func(dirs []string)) *sidecars {
+	if hashPrefixSize <= 0 {
+		hashPrefixSize = defaultHashPrefixSize
+	}
+	return &sidecars{
+		config:         config,
+		hashPrefixSize: hashPrefixSize,
+		loaded:         make(map[string]loadedSidecar),
+		dirty:          make(map[string]struct{}),
+		write:          write,
+	}
+}
+
+// lookup returns the sidecar entry of the file if it is still up to date
+func (s *sidecars) lookup(path string) (sidecarFile, bool) {
+	if !s.config.Read || archive.IsVirtual(path) {
+		return sidecarFile{}, false
+	}
+	dir, name := filepath.Split(path)
+	sidecarPath := filepath.Join(dir, s.config.name())
+	stat, err := os.Stat(sidecarPath)
+	if err != nil {
+		return sidecarFile{}, false
+	}
+
+	s.mutex.Lock()
+	loaded, ok := s.loaded[dir]
+	if !ok || !loaded.modified.Equal(stat.ModTime()) {
+		loaded = loadedSidecar{modified: stat.ModTime()}
+		b, err := os.ReadFile(sidecarPath)
+		if err == nil {
+			err = json.Unmarshal(b, &loaded.sidecar)
+		}
+		if err != nil {
+			indexLog.Warn("ignoring invalid sidecar", "path", sidecarPath, "err", err)
+		}
+		s.loaded[dir] = loaded
+	}
+	s.mutex.Unlock()
+
+	if loaded.sidecar.Version != sidecarVersion {
+		return sidecarFile{}, false
+	}
+	f, ok := loaded.sidecar.Files[name]
+	if !ok {
+		return sidecarFile{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !f.matches(info) {
+		return sidecarFile{}, false
+	}
+	if loaded.sidecar.HashPrefixSize != s.hashPrefixSize {
+		f.Hash, f.Sha256 = "", ""
+	}
+	return f, true
+}
+
+// hash returns the content hash of the file from its sidecar if it is up to
+// date and has all the required hashes
+func (s *sidecars) hash(path string, sha256 bool) (ContentHash, bool) {
+	f, ok := s.lookup(path)
+	if !ok || f.Hash == "" || (sha256 && f.Sha256 == "") {
+		return ContentHash{}, false
+	}
+	return ContentHash{Fast: f.Hash, Sha256: f.Sha256}, true
+}
+
+// close writes the pending sidecars
+func (s *sidecars) close() {
+	s.mutex.Lock()
+	pending := s.timer != nil && s.timer.Stop()
+	s.mutex.Unlock()
+	if pending {
+		s.flush()
+	}
+}
+
+// changed schedules the sidecar of the dir of the file to be written
+func (s *sidecars) changed(path string) {
+	if !s.config.Write || archive.IsVirtual(path) {
+		return
+	}
+	dir, _ := filepath.Split(path)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dirty[dir] = struct{}{}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(sidecarWriteDelay, s.flush)
+	}
+}
+
+func (s *sidecars) flush() {
+	s.mutex.Lock()
+	dirs := make([]string, 0, len(s.dirty))
+	for dir := range s.dirty {
+		dirs = append(dirs, dir)
+	}
+	s.dirty = make(map[string]struct{})
+	s.timer = nil
+	s.mutex.Unlock()
+	s.write(dirs)
+}
+
+// writeSidecars writes the sidecars of the dirs from the indexed files
+func (source *Source) writeSidecars(dirs []string) {
+	source.database.WaitForCommit()
+	for _, dir := range dirs {
+		err := source.writeSidecar(dir)
+		if err != nil {
+			indexLog.Warn("unable to read sidecars", "dir", dir, "err", err)
+		}
+	}
+}
+
+// sidecarEntry returns the entry of the file with the metadata as read
+// from the file, as the orientation edit and the camera clock offset are
+// applied on top when it is ingested again
+func sidecarEntry(f DirFile, edit Orientation) sidecarFile {
+	e := sidecarFile{
+		Hash:   f.Hash.Fast,
+		Sha256: f.Hash.Sha256,
+	}
+	if f.SizeNull {
+		return e
+	}
+	e.Width, e.Height = f.Width, f.Height
+	e.Orientation = f.Orientation
+	if edit != Normal {
+		e.Orientation = e.Orientation.Compose(edit.Inverse())
+		if edit.SwapsDimensions() {
+			e.Width, e.Height = e.Height, e.Width
+		}
+	}
+	e.Make, e.Model, e.Serial = f.Camera.Make, f.Camera.Model, f.Camera.Serial
+	e.Description = f.Description
+	if !f.DateTimeNull && !f.DateTime.IsZero() {
+		date := f.DateTime.Add(-f.Camera.ClockOffset)
+		e.Date = &date
+	}
+	if !f.LatLngNull && !IsNaNLatLng(f.LatLng) {
+		lat, lng := f.LatLng.Lat.Degrees(), f.LatLng.Lng.Degrees()
+		// Files without a location are read as 0, 0 by goexif
+		if lat != 0 || lng != 0 {
+			e.Latitude, e.Longitude = &lat, &lng
+		}
+	}
+	return e
+}
+
+func (source *Source) writeSidecar(dir string) error {
+	sc := sidecar{
+		Version:        sidecarVersion,
+		HashPrefixSize: source.sidecars.hashPrefixSize,
+		Files:          make(map[string]sidecarFile),
+	}
+	for _, f := range source.database.ListDirFiles(dir) {
+		stat, err := os.Stat(filepath.Join(dir, f.Name))
+		if err != nil {
+			continue
+		}
+		e := sidecarEntry(f, source.GetOrientationEdit(f.Id))
+		e.Size = stat.Size()
+		e.Modified = stat.ModTime().UTC().Truncate(time.Second)
+		if e.Hash == "" && !e.hasMeta() {
+			continue
+		}
+		sc.Files[f.Name] = e
+	}
+	if len(sc.Files) == 0 {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, source.Sidecar.name())
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Avoid reading back the sidecar that was just written
+	if stat, err := os.Stat(path); err == nil {
+		source.sidecars.mutex.Lock()
+		source.sidecars.loaded[dir] = loadedSidecar{modified: stat.ModTime(), sidecar: sc}
+		source.sidecars.mutex.Unlock()
+	}
+	return nil
+}
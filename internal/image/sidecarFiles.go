@@ -0,0 +1,242 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/io/archive"
+	"photofield/io/xmp"
+	"photofield/tag"
+)
+
+// SidecarFile is a file stored next to a photo or video describing it, like
+// IMG_0001.XMP with ratings and keywords, IMG_0001.AAE with Apple edits or
+// IMG_0001.JPG.json from Google Takeout
+type SidecarFile struct {
+	Path string
+	// Id of the file the sidecar describes
+	Id   ImageId
+	Kind string
+	// Modification time of the sidecar as of when it was last indexed
+	Modified time.Time
+}
+
+const (
+	SidecarXmp  = "xmp"
+	SidecarAae  = "aae"
+	SidecarJson = "json"
+)
+
+var sidecarFileExtensions = []string{".xmp", ".aae", ".json"}
+
+// sidecarFileKind returns the kind of the sidecar at the path, empty if it
+// is not one
+func sidecarFileKind(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range sidecarFileExtensions {
+		if ext == e {
+			return strings.TrimPrefix(e, ".")
+		}
+	}
+	return ""
+}
+
+// sidecarFileCandidates lists the paths the sidecars of the file could be
+// at, both with the extension appended and replaced, in lower and upper case
+func sidecarFileCandidates(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	var paths []string
+	for _, ext := range sidecarFileExtensions {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			paths = append(paths, path+e, base+e)
+		}
+	}
+	// Google Takeout
+	paths = append(paths, path+".supplemental-metadata.json")
+	return paths
+}
+
+// findSidecarFiles returns the sidecars stored next to the file
+func (source *Source) findSidecarFiles(path string) []SidecarFile {
+	if archive.IsVirtual(path) {
+		return nil
+	}
+	indexSidecar := source.Sidecar.name()
+	seen := make(map[string]struct{})
+	var files []SidecarFile
+	for _, p := range sidecarFileCandidates(path) {
+		if _, ok := seen[p]; ok || p == path || filepath.Base(p) == indexSidecar {
+			continue
+		}
+		seen[p] = struct{}{}
+		stat, err := os.Stat(p)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, SidecarFile{
+			Path:     p,
+			Kind:     sidecarFileKind(p),
+			Modified: stat.ModTime(),
+		})
+	}
+	return files
+}
+
+// indexSidecarFiles associates the sidecars stored next to the file with
+// it and tags it with the rating, label and keywords of its XMP sidecar
+func (source *Source) indexSidecarFiles(id ImageId, path string) {
+	files := source.findSidecarFiles(path)
+	if len(files) > 0 || len(source.database.ListSidecarFiles(id)) > 0 {
+		source.database.WriteSidecarFiles(id, files)
+	}
+	if !source.Config.TagConfig.Xmp.Enable {
+		return
+	}
+	var tags []tag.Tag
+	for _, f := range files {
+		if f.Kind != SidecarXmp {
+			continue
+		}
+		tags = source.readXmpTags(f.Path)
+		break
+	}
+	source.replaceTags(id, tag.XmpPrefix, tags)
+}
+
+func (source *Source) readXmpTags(path string) []tag.Tag {
+	f, err := os.Open(path)
+	if err != nil {
+		indexLog.Error("unable to read sidecar", "path", path, "err", err)
+		return nil
+	}
+	defer f.Close()
+	m, err := xmp.Parse(f)
+	if err != nil {
+		indexLog.Error("unable to parse sidecar", "path", path, "err", err)
+		return nil
+	}
+	var tags []tag.Tag
+	if m.Rating != 0 {
+		tags = append(tags, tag.NewXmp("rating", strconv.Itoa(m.Rating)))
+	}
+	if m.Label != "" {
+		tags = append(tags, tag.NewXmp("label", m.Label))
+	}
+	for _, k := range m.Keywords {
+		tags = append(tags, tag.NewXmp("keyword", k))
+	}
+	return tags
+}
+
+// replaceTags removes the tags of the file with the prefix that are not
+// among the tags and adds the rest
+func (source *Source) replaceTags(id ImageId, prefix string, tags []tag.Tag) {
+	source.replaceTagsFunc(id, func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	}, tags)
+}
+
+// replaceTagsFunc removes the tags of the file matching the function that
+// are not among the tags and adds the rest
+func (source *Source) replaceTagsFunc(id ImageId, match func(name string) bool, tags []tag.Tag) {
+	keep := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		keep[t.Name] = struct{}{}
+	}
+	var stale []tag.Id
+	for t := range source.database.ListImageTags(id) {
+		if !match(t.Name) {
+			continue
+		}
+		if _, ok := keep[t.Name]; ok {
+			delete(keep, t.Name)
+			continue
+		}
+		stale = append(stale, t.Id)
+	}
+	for _, tid := range stale {
+		ids := NewIds()
+		ids.AddInt(int(id))
+		if _, err := source.database.RemoveTagIds(tid, ids); err != nil {
+			indexLog.Error("unable to remove tag", "tag_id", tid, "id", id, "err", err)
+		}
+	}
+	var added []tag.Tag
+	for _, t := range tags {
+		if _, ok := keep[t.Name]; ok {
+			added = append(added, t)
+		}
+	}
+	source.database.WriteTags(id, added)
+}
+
+// checkSidecarFile queues the metadata of the file the sidecar describes
+// to be indexed again if the sidecar is new or has changed since
+func (source *Source) checkSidecarFile(path string) {
+	if archive.IsVirtual(path) || filepath.Base(path) == source.Sidecar.name() {
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	f, known := source.database.GetSidecarFile(path)
+	if known && f.Modified.Unix() == stat.ModTime().Unix() {
+		return
+	}
+	id, filePath, ok := ImageId(0), "", false
+	if known {
+		id = f.Id
+		filePath, ok = source.database.GetPathFromId(id)
+	}
+	if !ok {
+		id, filePath, ok = source.findSidecarOwner(path)
+	}
+	if !ok {
+		return
+	}
+	items := make(chan interface{}, 1)
+	items <- MissingInfo{
+		Id:   id,
+		Path: filePath,
+		Missing: Missing{
+			Metadata: true,
+		},
+	}
+	close(items)
+	source.metadataQueue.AppendItems(items)
+}
+
+// findSidecarOwner returns the indexed file the sidecar at the path
+// describes, going by its name
+func (source *Source) findSidecarOwner(path string) (ImageId, string, bool) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	base = strings.TrimSuffix(base, ".supplemental-metadata")
+	if id, ok := source.database.GetIdFromPath(base); ok {
+		return id, base, true
+	}
+	for _, ext := range source.ListExtensions {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			p := base + e
+			if id, ok := source.database.GetIdFromPath(p); ok {
+				return id, p, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// isListed reports whether files at the path are indexed as photos or
+// videos rather than only as sidecars
+func (source *Source) isListed(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range source.ListExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
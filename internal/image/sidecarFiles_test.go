@@ -0,0 +1,48 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindSidecarFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"IMG_0001.JPG", "IMG_0001.XMP", "IMG_0001.AAE",
+		"IMG_0002.jpg", "IMG_0002.jpg.xmp", "IMG_0002.jpg.supplemental-metadata.json",
+		"IMG_0003.jpg",
+		"photo.json", "photo.jpg", ".photofield.json",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := &Source{}
+	cases := []struct {
+		name     string
+		sidecars []string
+	}{
+		{"IMG_0001.JPG", []string{"IMG_0001.XMP", "IMG_0001.AAE"}},
+		{"IMG_0002.jpg", []string{"IMG_0002.jpg.xmp", "IMG_0002.jpg.supplemental-metadata.json"}},
+		{"IMG_0003.jpg", nil},
+		{"photo.jpg", []string{"photo.json"}},
+	}
+	for _, c := range cases {
+		var expected []string
+		for _, s := range c.sidecars {
+			expected = append(expected, filepath.Join(dir, s))
+		}
+		var paths []string
+		for _, f := range source.findSidecarFiles(filepath.Join(dir, c.name)) {
+			paths = append(paths, f.Path)
+			if f.Kind != sidecarFileKind(f.Path) {
+				t.Errorf("%s: unexpected kind %q of %s", c.name, f.Kind, f.Path)
+			}
+		}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, expected, paths)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSidecarLookup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(path, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := os.Stat(path)
+
+	b, _ := json.Marshal(sidecar{
+		Version:        sidecarVersion,
+		HashPrefixSize: defaultHashPrefixSize,
+		Files: map[string]sidecarFile{
+			"a.jpg": {
+				Size:     stat.Size(),
+				Modified: stat.ModTime().Truncate(time.Second),
+				Hash:     "8-0123456789abcdef",
+				Width:    40,
+				Height:   20,
+			},
+		},
+	})
+	os.WriteFile(filepath.Join(dir, ".photofield.json"), b, 0644)
+
+	s := newSidecars(SidecarConfig{Read: true}, 0, nil)
+	f, ok := s.lookup(path)
+	if !ok || !f.hasMeta() {
+		t.Fatalf("expected sidecar entry, got %+v %v", f, ok)
+	}
+	if hash, ok := s.hash(path, false); !ok || hash.Fast != "8-0123456789abcdef" {
+		t.Errorf("expected hash, got %+v %v", hash, ok)
+	}
+	if _, ok := s.hash(path, true); ok {
+		t.Errorf("expected missing sha256 to require hashing")
+	}
+
+	s = newSidecars(SidecarConfig{Read: true}, 1024, nil)
+	if _, ok := s.hash(path, false); ok {
+		t.Errorf("expected hash with another prefix size to be ignored")
+	}
+
+	os.WriteFile(path, []byte("changed contents"), 0644)
+	if _, ok := s.lookup(path); ok {
+		t.Errorf("expected changed file to be ignored")
+	}
+}
+
+func TestSidecarEntry(t *testing.T) {
+	date := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	f := DirFile{
+		Camera: Camera{
+			Make:        "Canon",
+			ClockOffset: time.Hour,
+		},
+	}
+	f.Width, f.Height = 40, 20
+	f.Orientation = Normal
+	f.DateTime = date.Add(time.Hour)
+	f.LatLng = NaNLatLng()
+
+	e := sidecarEntry(f, Rotate90)
+	if e.Date == nil || !e.Date.Equal(date) {
+		t.Errorf("expected date without clock offset %s, got %v", date, e.Date)
+	}
+	info, _ := e.info()
+	if info.Orientation.Compose(Rotate90) != Normal {
+		t.Errorf("expected orientation without edit, got %s", info.Orientation)
+	}
+	if e.Width != 20 || e.Height != 40 {
+		t.Errorf("expected dimensions without edit, got %dx%d", e.Width, e.Height)
+	}
+}
@@ -2,20 +2,25 @@ package image
 
 import (
 	"context"
-	"embed"
 	"errors"
 	"fmt"
-	"log"
+	"io/fs"
 	"path/filepath"
+	"photofield/internal/logging"
 	"strings"
+	"sync"
+	"time"
 
 	goio "io"
 
 	"photofield/internal/clip"
+	"photofield/internal/icc"
 	"photofield/internal/metrics"
 	"photofield/internal/queue"
 	"photofield/io"
+	"photofield/io/diskcache"
 	"photofield/io/ffmpeg"
+	"photofield/io/limited"
 	"photofield/io/ristretto"
 	"photofield/io/sqlite"
 	"photofield/tag"
@@ -24,6 +29,7 @@ import (
 	"github.com/golang/geo/s2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/sams96/rgeo"
 )
@@ -31,6 +37,14 @@ import (
 var ErrNotFound = errors.New("not found")
 var ErrNotAnImage = errors.New("not a supported image extension, might be video")
 var ErrUnavailable = errors.New("unavailable")
+var ErrNotAVideo = errors.New("not a supported video extension")
+var ErrReadOnly = errors.New("read-only, writes are made by the writer instance")
+
+var (
+	indexLog  = logging.Module("indexer")
+	decodeLog = logging.Module("decode")
+	dbLog     = logging.Module("db")
+)
 
 type ImageId uint32
 
@@ -61,6 +75,15 @@ type SourcedInfo struct {
 	Info
 }
 
+// AddedInfo is the info of a file with its path and the time it was
+// first indexed
+type AddedInfo struct {
+	Id      ImageId
+	Path    string
+	AddedAt time.Time
+	Info
+}
+
 type Missing struct {
 	Metadata  bool
 	Color     bool
@@ -70,6 +93,7 @@ type Missing struct {
 type IdPath struct {
 	Id   ImageId
 	Path string
+	Hash ContentHash
 }
 
 type MissingInfo struct {
@@ -106,8 +130,49 @@ func (config *CacheConfig) MaxSizeBytes() int64 {
 	return value
 }
 
+// DecodeConfig limits the images decoded while rendering at the same time,
+// as decoding large originals takes a lot of memory
+type DecodeConfig struct {
+	// Maximum number of images decoded at the same time, unlimited if 0
+	Concurrency int `json:"concurrency"`
+	// Memory the images decoded at the same time are estimated to take
+	// from their dimensions, unlimited if empty
+	MemoryBudget string `json:"memory_budget"`
+}
+
+func (config *DecodeConfig) MemoryBudgetBytes() int64 {
+	if config.MemoryBudget == "" {
+		return 0
+	}
+	value, err := units.FromHumanSize(config.MemoryBudget)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// DiskCacheConfig configures the second tier of the image cache, stored
+// in the data dir
+type DiskCacheConfig struct {
+	// Store decoded images that were slow to load, so that they load faster
+	// again, also after a restart
+	Enable  bool   `json:"enable"`
+	MaxSize string `json:"max_size"`
+	// Images loading faster than this are not stored
+	MinLoadMs int `json:"min_load_ms"`
+}
+
+func (config *DiskCacheConfig) MaxSizeBytes() int64 {
+	value, err := units.FromHumanSize(config.MaxSize)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
 type Caches struct {
 	Image CacheConfig
+	Disk  DiskCacheConfig `json:"disk"`
 }
 
 type Geo struct {
@@ -119,6 +184,9 @@ type Config struct {
 	AI        clip.AI
 	Geo       Geo
 	TagConfig tag.Config `json:"-"`
+	// Serve a database written by another process sharing the data dir
+	// without indexing or writing to it, implies SkipLoadInfo
+	ReadOnly bool `json:"-"`
 
 	ExifToolCount        int  `json:"exif_tool_count"`
 	SkipLoadInfo         bool `json:"skip_load_info"`
@@ -126,19 +194,38 @@ type Config struct {
 	ConcurrentColorLoads int  `json:"concurrent_color_loads"`
 	ConcurrentAILoads    int  `json:"concurrent_ai_loads"`
 
-	ListExtensions []string        `json:"extensions"`
-	DateFormats    []string        `json:"date_formats"`
-	Images         FileConfig      `json:"images"`
-	Videos         FileConfig      `json:"videos"`
-	SourceTypes    SourceTypeMap   `json:"source_types"`
-	Sources        SourceConfigs   `json:"sources"`
-	Thumbnail      ThumbnailConfig `json:"thumbnail"`
-
-	Caches Caches `json:"caches"`
+	ListExtensions []string          `json:"extensions"`
+	DateFormats    []string          `json:"date_formats"`
+	Timezone       TimezoneConfig    `json:"timezone"`
+	Paths          PathConfig        `json:"paths"`
+	Orientation    OrientationConfig `json:"orientation"`
+	Panorama       PanoramaConfig    `json:"panorama"`
+	Trips          TripConfig        `json:"trips"`
+	Private        PrivateConfig     `json:"private"`
+	Kinds          KindConfig        `json:"kinds"`
+	Subjects       SubjectConfig     `json:"subjects"`
+	Color          ColorConfig       `json:"color"`
+	Images         FileConfig        `json:"images"`
+	Videos         FileConfig        `json:"videos"`
+	Audio          FileConfig        `json:"audio"`
+	SourceTypes    SourceTypeMap     `json:"source_types"`
+	Sources        SourceConfigs     `json:"sources"`
+	Thumbnail      ThumbnailConfig   `json:"thumbnail"`
+
+	ContentHash ContentHashConfig `json:"content_hash"`
+	Verify      VerifyConfig      `json:"verify"`
+	Embeddings  EmbeddingsConfig  `json:"embeddings"`
+	Database    DatabaseConfig    `json:"database"`
+	Sidecar     SidecarConfig     `json:"sidecar"`
+
+	Caches        Caches              `json:"caches"`
+	Decode        DecodeConfig        `json:"decode"`
+	SourceLatency SourceLatencyConfig `json:"source_latency"`
 }
 
 type FileConfig struct {
 	Extensions []string `json:"extensions"`
+	Ignore     []string `json:"ignore"`
 }
 
 type Source struct {
@@ -150,39 +237,117 @@ type Source struct {
 	SourcePerOriginalMegapixelLatencyHistogram *prometheus.HistogramVec
 	SourcePerResizedMegapixelLatencyHistogram  *prometheus.HistogramVec
 
-	decoder  *Decoder
-	database *Database
-	rg       *rgeo.Rgeo
+	decoder   *Decoder
+	database  Store
+	rg        *rgeo.Rgeo
+	timezones *timezoneResolver
 
 	imageInfoCache InfoCache
 	pathCache      PathCache
-
-	metadataQueue queue.Queue
-	contentsQueue queue.Queue
+	hashCache      HashCache
+
+	ignoreImages Globs
+	ignoreVideos Globs
+
+	metadataQueue    queue.Queue
+	contentsQueue    queue.Queue
+	hashQueue        queue.Queue
+	orientationQueue queue.Queue
+	panoramaQueue    queue.Queue
+	tripQueue        queue.Queue
+	nsfwQueue        queue.Queue
+	kindQueue        queue.Queue
+	subjectQueue     queue.Queue
+	verifyQueue      queue.Queue
+
+	orientationEdits sync.Map
+
+	// Embeddings of the texts the files are classified by
+	labelPrompts   promptEmbeddings
+	nsfwPrompts    promptEmbeddings
+	kindPrompts    promptEmbeddings
+	subjectPrompts promptEmbeddings
+
+	subjects detectedSubjects
+
+	orientationAuditQueue queue.Queue
+	// Files already queued for an orientation audit while rendering
+	orientationVerified sync.Map
+	ffprobePath         string
+	ffmpegPath          string
 
 	thumbnailSources    []io.ReadDecoder
 	thumbnailGenerators io.Sources
 	thumbnailSink       *sqlite.Source
 
+	sidecars *sidecars
+
+	colorProfile *icc.Profile
+
+	deepZoomLoading singleflight.Group
+	// Limits the originals decoded at once for deep zoom pyramids, as
+	// large panoramas take gigabytes of memory
+	deepZoomGenerating chan struct{}
+
+	spriteLoading singleflight.Group
+	// Limits the videos decoded at once for scrubbing sprites
+	spriteGenerating chan struct{}
+
 	Clip clip.Clip
 }
 
-func NewSource(config Config, migrations embed.FS, migrationsThumbs embed.FS) *Source {
+func NewSource(config Config, migrations fs.FS, migrationsThumbs fs.FS) *Source {
 	source := Source{}
+	if config.ReadOnly {
+		config.SkipLoadInfo = true
+	}
 	source.Config = config
-	source.decoder = NewDecoder(config.ExifToolCount)
-	source.database = NewDatabase(filepath.Join(config.DataDir, "photofield.cache.db"), migrations)
+
+	var err error
+	source.timezones, err = newTimezoneResolver(config.Timezone)
+	if err != nil {
+		indexLog.Warn("ignoring invalid timezone", "err", err)
+	}
+
+	source.decoder = NewDecoder(config.ExifToolCount, source.timezones)
+	switch config.Embeddings.Quantization {
+	case "", QuantizeFloat16, QuantizeInt8:
+	default:
+		indexLog.Warn("ignoring unknown embeddings quantization", "quantization", config.Embeddings.Quantization)
+	}
+	switch config.Database.Driver {
+	case "", "sqlite":
+		source.database = NewDatabase(filepath.Join(config.DataDir, "photofield.cache.db"), migrations, config.ReadOnly, config.Database, config.Embeddings)
+	case "postgres":
+		source.database = NewPostgres(config.Database.Url, migrations, config.ReadOnly, config.Database, config.Embeddings, config.DataDir)
+	default:
+		dbLog.Fatal("unsupported database driver, use sqlite or postgres", "driver", config.Database.Driver)
+	}
 	source.imageInfoCache = newInfoCache()
 	source.pathCache = newPathCache()
+	source.hashCache = newHashCache()
+	source.sidecars = newSidecars(config.Sidecar, config.ContentHash.PrefixSize, source.writeSidecars)
+
+	source.ignoreImages, err = CompileGlobs(config.Images.Ignore)
+	if err != nil {
+		indexLog.Warn("ignoring invalid images ignore patterns", "err", err)
+	}
+	source.ignoreVideos, err = CompileGlobs(config.Videos.Ignore)
+	if err != nil {
+		indexLog.Warn("ignoring invalid videos ignore patterns", "err", err)
+	}
 
 	if config.Geo.ReverseGeocode {
-		log.Println("rgeo loading")
+		indexLog.Info("rgeo loading")
 		r, err := rgeo.New(rgeo.Provinces10, rgeo.Cities10)
 		if err != nil {
-			log.Fatalf("failed to initialize rgeo: %s", err)
+			indexLog.Fatal("failed to initialize rgeo", "err", err)
 		}
 		source.rg = r
 	}
+	if config.TagConfig.Places.Enable && source.rg == nil {
+		indexLog.Info("places: geo.reverse_geocode is disabled, not tagging places")
+	}
 
 	source.SourceLatencyHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: metrics.Namespace,
@@ -216,54 +381,92 @@ func NewSource(config Config, migrations embed.FS, migrationsThumbs embed.FS) *S
 		[]string{"source"},
 	)
 
+	color, err := config.Color.Profile()
+	if err != nil {
+		indexLog.Warn("not managing colors", "err", err)
+	}
+	source.colorProfile = color
+
 	env := SourceEnvironment{
-		SourceTypes: config.SourceTypes,
-		FFmpegPath:  ffmpeg.FindPath(),
-		Migrations:  migrationsThumbs,
-		ImageCache:  ristretto.New(),
-		DataDir:     config.DataDir,
+		ColorProfile: color,
+		SourceTypes:  config.SourceTypes,
+		FFmpegPath:   ffmpeg.FindPath(),
+		Migrations:   migrationsThumbs,
+		ImageCache:   ristretto.New(),
+		DataDir:      config.DataDir,
+		Original: func(id io.ImageId) io.Size {
+			info := source.GetInfo(ImageId(id))
+			return io.Size(info.Size())
+		},
+		Latency: config.SourceLatency,
+	}
+	if config.Caches.Disk.Enable {
+		env.DiskCache = diskcache.New(
+			filepath.Join(config.DataDir, "images"),
+			config.Caches.Disk.MaxSizeBytes(),
+			time.Duration(config.Caches.Disk.MinLoadMs)*time.Millisecond,
+		)
+	}
+	if config.Decode.Concurrency > 0 || config.Decode.MemoryBudget != "" {
+		env.Limiter = limited.NewLimiter(config.Decode.Concurrency, config.Decode.MemoryBudgetBytes())
 	}
 
 	// Sources used for rendering
 	srcs, err := config.Sources.NewSources(&env)
 	if err != nil {
-		log.Fatalf("failed to create sources: %s", err)
+		decodeLog.Fatal("failed to create sources", "err", err)
 	}
 	source.Sources = srcs
+	source.ffmpegPath = env.FFmpegPath
+	source.ffprobePath = ffmpeg.ProbePath(env.FFmpegPath)
+	source.deepZoomGenerating = make(chan struct{}, 1)
+	source.spriteGenerating = make(chan struct{}, 2)
 
-	// Further sources should not be cached
+	// Further sources should not be cached or limited
 	env.ImageCache = nil
+	env.DiskCache = nil
+	env.Limiter = nil
 
 	tsrcs, err := config.Thumbnail.Sources.NewSources(&env)
 	if err != nil {
-		log.Fatalf("failed to create thumbnail sources: %s", err)
+		decodeLog.Fatal("failed to create thumbnail sources", "err", err)
 	}
 	for _, s := range tsrcs {
 		rd, ok := s.(io.ReadDecoder)
 		if !ok {
-			log.Fatalf("source %s does not implement io.ReadDecoder", s.Name())
+			decodeLog.Fatal("source does not implement io.ReadDecoder", "source", s.Name())
 		}
 		source.thumbnailSources = append(source.thumbnailSources, rd)
 	}
 
 	gens, err := config.Thumbnail.Generators.NewSources(&env)
 	if err != nil {
-		log.Fatalf("failed to create thumbnail generators: %s", err)
+		decodeLog.Fatal("failed to create thumbnail generators", "err", err)
 	}
 	source.thumbnailGenerators = gens
 
 	sink, err := config.Thumbnail.Sink.NewSource(&env)
 	if err != nil {
-		log.Fatalf("failed to create thumbnail sink: %s", err)
+		decodeLog.Fatal("failed to create thumbnail sink", "err", err)
 	}
 	sqliteSink, ok := sink.(*sqlite.Source)
 	if !ok {
-		log.Fatalf("thumbnail sink %s is not a sqlite source", sink.Name())
+		decodeLog.Fatal("thumbnail sink is not a sqlite source", "source", sink.Name())
 	}
 	source.thumbnailSink = sqliteSink
 
+	if !config.ReadOnly {
+		source.normalizePaths()
+	}
+
+	source.loadOrientationEdits()
+
+	if config.ReadOnly {
+		go source.followChanges()
+	}
+
 	if config.SkipLoadInfo {
-		log.Printf("skipping load info")
+		indexLog.Info("skipping load info")
 	} else {
 
 		source.metadataQueue = queue.Queue{
@@ -285,6 +488,82 @@ func NewSource(config Config, migrations embed.FS, migrationsThumbs embed.FS) *S
 		}
 		go source.contentsQueue.Run()
 
+		source.hashQueue = queue.Queue{
+			ID:          "index_hashes",
+			Name:        "index hashes",
+			Worker:      source.hashFiles,
+			WorkerCount: 1,
+		}
+		go source.hashQueue.Run()
+
+		source.orientationQueue = queue.Queue{
+			ID:          "detect_orientation",
+			Name:        "detect orientation",
+			Worker:      source.detectOrientation,
+			WorkerCount: 1,
+		}
+		go source.orientationQueue.Run()
+
+		source.panoramaQueue = queue.Queue{
+			ID:          "detect_panoramas",
+			Name:        "detect panoramas",
+			Worker:      source.detectPanoramas,
+			WorkerCount: 1,
+		}
+		go source.panoramaQueue.Run()
+
+		source.tripQueue = queue.Queue{
+			ID:          "detect_trips",
+			Name:        "detect trips",
+			Worker:      source.detectTrips,
+			WorkerCount: 1,
+		}
+		go source.tripQueue.Run()
+
+		source.nsfwQueue = queue.Queue{
+			ID:          "detect_nsfw",
+			Name:        "detect nsfw",
+			Worker:      source.detectNsfw,
+			WorkerCount: 1,
+		}
+		go source.nsfwQueue.Run()
+
+		source.kindQueue = queue.Queue{
+			ID:          "detect_kinds",
+			Name:        "detect kinds",
+			Worker:      source.detectKinds,
+			WorkerCount: 1,
+		}
+		go source.kindQueue.Run()
+
+		source.subjectQueue = queue.Queue{
+			ID:          "detect_subjects",
+			Name:        "detect subjects",
+			Worker:      source.detectSubjects,
+			WorkerCount: 1,
+		}
+		go source.subjectQueue.Run()
+
+		source.orientationAuditQueue = queue.Queue{
+			ID:          "audit_orientation",
+			Name:        "audit orientation",
+			Worker:      source.auditOrientation,
+			WorkerCount: 2,
+		}
+		go source.orientationAuditQueue.Run()
+
+		source.verifyQueue = queue.Queue{
+			ID:          "verify_checksums",
+			Name:        "verify checksums",
+			Worker:      source.verifyChecksums,
+			WorkerCount: 1,
+		}
+		go source.verifyQueue.Run()
+		if source.Verify.Enable && source.ContentHash.Enable {
+			go source.scheduleVerification()
+		}
+
+		source.resumeQueues()
 	}
 
 	return &source
@@ -313,12 +592,30 @@ func (source *Source) ReverseGeocode(l s2.LatLng) (string, error) {
 	return loc, nil
 }
 
+// DatabaseStats returns the state of the cache database
+func (source *Source) DatabaseStats() DatabaseStats {
+	return source.database.Stats()
+}
+
 func (source *Source) Vacuum() error {
-	return source.database.vacuum()
+	return source.database.Vacuum()
 }
 
+// Close checkpoints the indexing queues, commits the pending writes and
+// closes the thumbnail database
 func (source *Source) Close() {
+	if !source.SkipLoadInfo {
+		source.checkpointQueues()
+	}
+	source.sidecars.close()
 	source.decoder.Close()
+	source.database.Flush()
+	if err := source.database.Close(); err != nil {
+		dbLog.Error("unable to close embeddings", "err", err)
+	}
+	if err := source.thumbnailSink.Close(); err != nil {
+		dbLog.Error("unable to close thumbnail database", "err", err)
+	}
 }
 
 func (source *Source) IsSupportedImage(path string) bool {
@@ -343,30 +640,63 @@ func (source *Source) IsSupportedVideo(path string) bool {
 	return false
 }
 
+// newIgnoreFilter returns a function reporting whether a file is ignored
+// either by the provided patterns or the ignore patterns of its file type,
+// or nil if no files are ignored
+func (source *Source) newIgnoreFilter(patterns []string) func(path string) bool {
+	globs, err := CompileGlobs(patterns)
+	if err != nil {
+		indexLog.Warn("ignoring invalid ignore patterns", "err", err)
+	}
+	if globs.Empty() && source.ignoreImages.Empty() && source.ignoreVideos.Empty() {
+		return nil
+	}
+	return func(path string) bool {
+		if globs.Match(path) {
+			return true
+		}
+		if source.IsSupportedImage(path) && source.ignoreImages.Match(path) {
+			return true
+		}
+		if source.IsSupportedVideo(path) && source.ignoreVideos.Match(path) {
+			return true
+		}
+		return false
+	}
+}
+
+func (source *Source) newIgnoreDirFilter(patterns []string) func(path string) bool {
+	globs, _ := CompileGlobs(patterns)
+	if globs.Empty() {
+		return nil
+	}
+	return globs.MatchDir
+}
+
 func (source *Source) ListImages(dirs []string, maxPhotos int) <-chan string {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	return source.database.ListPaths(dirs, maxPhotos)
 }
 
 func (source *Source) ListImageIds(dirs []string, maxPhotos int) <-chan ImageId {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	return source.database.ListIds(dirs, maxPhotos, false)
 }
 
 func (source *Source) ListMissingEmbeddingIds(dirs []string, maxPhotos int) <-chan ImageId {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	return source.database.ListIds(dirs, maxPhotos, true)
 }
 
 func (source *Source) ListMissingMetadata(dirs []string, maxPhotos int, force Missing) <-chan MissingInfo {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	opts := Missing{
 		Metadata: true,
@@ -387,7 +717,7 @@ func (source *Source) ListMissingMetadata(dirs []string, maxPhotos int, force Mi
 
 func (source *Source) ListMissingContents(dirs []string, maxPhotos int, force Missing) <-chan MissingInfo {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	opts := Missing{
 		Color:     true,
@@ -410,8 +740,9 @@ func (source *Source) ListMissingContents(dirs []string, maxPhotos int, force Mi
 
 func (source *Source) ListInfos(dirs []string, options ListOptions) <-chan SourcedInfo {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
+	options.ignored = source.newIgnoreFilter(options.Ignore)
 	out := make(chan SourcedInfo, 1000)
 	go func() {
 		defer metrics.Elapsed("list infos")()
@@ -428,10 +759,21 @@ func (source *Source) ListInfos(dirs []string, options ListOptions) <-chan Sourc
 	return out
 }
 
+// ListRecentlyAdded lists the files in the dirs, most recently indexed
+// first, supporting only the Limit and Ignore options
+func (source *Source) ListRecentlyAdded(dirs []string, options ListOptions) <-chan AddedInfo {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	options.ignored = source.newIgnoreFilter(options.Ignore)
+	return source.database.ListRecentlyAdded(dirs, options)
+}
+
 func (source *Source) ListInfosWithExistence(dirs []string, options ListOptions) <-chan SourcedInfo {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
+	options.ignored = source.newIgnoreFilter(options.Ignore)
 	out := make(chan SourcedInfo, 1000)
 	go func() {
 		defer metrics.Elapsed("list infos")()
@@ -467,41 +809,214 @@ func (source *Source) GetImageEmbedding(id ImageId) (clip.Embedding, error) {
 	return source.database.GetImageEmbedding(id)
 }
 
-func (source *Source) IndexFiles(dir string, max int, counter chan<- int) {
-	dir = filepath.FromSlash(dir)
+func (source *Source) IndexFiles(dir string, max int, walk WalkConfig, ignore []string, counter chan<- int) {
+	source.IndexFilesMatching(dir, max, walk, ignore, Globs{}, counter)
+}
+
+// IndexFilesMatching indexes the files within the dir like IndexFiles, but
+// only the ones matching the include patterns if there are any, leaving the
+// other indexed files within the dir as they are
+func (source *Source) IndexFilesMatching(dir string, max int, walk WalkConfig, ignore []string, include Globs, counter chan<- int) {
+	dir = source.Paths.Normalize(dir)
+	ignored := source.newIgnoreFilter(ignore)
+	ignoredDir := source.newIgnoreDirFilter(ignore)
+	if !include.Empty() {
+		ignoredOther := ignored
+		ignored = func(path string) bool {
+			return !include.Match(path) || (ignoredOther != nil && ignoredOther(path))
+		}
+	}
+
+	source.database.WaitForCommit()
+	existing := make(map[string]IdPath)
+	for ip := range source.database.ListIdPaths([]string{dir}, 0) {
+		existing[ip.Path] = ip
+	}
+
 	indexed := make(map[string]struct{})
-	for path := range walkFiles(dir, source.ListExtensions, max) {
-		source.database.Write(path, Info{}, AppendPath)
+	claimed := make(map[ImageId]struct{})
+	batch := newPathBatch(source.database, source.Database.BulkInsert)
+	// Hashed in the hash queue instead, so that the walk only reads the
+	// first few bytes of new files
+	var stale []IdPath
+	var unhashed []string
+	extensions := append([]string{}, source.ListExtensions...)
+	extensions = append(extensions, sidecarFileExtensions...)
+	for path := range walkFiles(dir, extensions, max, walk, ignored, ignoredDir) {
+		path = source.Paths.Normalize(path)
+		if sidecarFileKind(path) != "" && !source.isListed(path) {
+			source.checkSidecarFile(path)
+			continue
+		}
+		ip, exists := existing[path]
+		if !exists {
+			if source.indexNewFile(path, claimed, batch) {
+				unhashed = append(unhashed, path)
+			}
+		} else if source.hashStale(ip) {
+			stale = append(stale, ip)
+		}
 		indexed[path] = struct{}{}
 		// Uncomment to test slow indexing
 		// time.Sleep(10 * time.Millisecond)
 		counter <- 1
 	}
+	batch.flush()
 	for ip := range source.database.ListNonexistent(dir, indexed) {
+		if _, moved := claimed[ip.Id]; moved {
+			continue
+		}
+		if !include.Empty() && !include.Match(ip.Path) {
+			continue
+		}
 		source.database.Delete(ip.Id)
 		source.thumbnailSink.Delete(uint32(ip.Id))
 	}
 	source.database.SetIndexed(dir)
 	source.database.WaitForCommit()
+
+	for _, path := range unhashed {
+		if id, ok := source.database.GetIdFromPath(path); ok {
+			stale = append(stale, IdPath{Id: id, Path: path})
+		}
+	}
+	source.queueHashes(stale)
+}
+
+// IndexFile indexes a single new file right away, e.g. an uploaded one,
+// and queues its metadata and contents to be indexed
+func (source *Source) IndexFile(path string) (ImageId, error) {
+	path = source.Paths.Normalize(path)
+	unhashed := source.indexNewFile(path, make(map[ImageId]struct{}), newPathBatch(source.database, 1))
+	source.database.Flush()
+	id, ok := source.database.GetIdFromPath(path)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if unhashed {
+		source.queueHashes([]IdPath{{Id: id, Path: path}})
+	}
+	for _, q := range []*queue.Queue{&source.metadataQueue, &source.contentsQueue} {
+		items := make(chan interface{}, 1)
+		items <- MissingInfo{
+			Id:   id,
+			Path: path,
+			Missing: Missing{
+				Metadata:  true,
+				Color:     true,
+				Embedding: source.AI.Available(),
+			},
+		}
+		close(items)
+		q.AppendItems(items)
+	}
+	return id, nil
+}
+
+// indexedAt lists the indexed file at the path or all indexed files within
+// the dir at the path
+func (source *Source) indexedAt(path string) []IdPath {
+	path = source.Paths.Normalize(path)
+	var ips []IdPath
+	if id, ok := source.database.GetIdFromPath(path); ok {
+		ips = append(ips, IdPath{Id: id, Path: path})
+	}
+	dir := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	for ip := range source.database.ListIdPaths([]string{dir}, 0) {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// RemoveFiles removes the file or all files within the dir at the path
+// from the index right away, e.g. after they were deleted
+func (source *Source) RemoveFiles(path string) {
+	for _, ip := range source.indexedAt(path) {
+		source.database.Delete(ip.Id)
+		source.thumbnailSink.Delete(uint32(ip.Id))
+		source.pathCache.Delete(ip.Id)
+		source.imageInfoCache.Delete(ip.Id)
+	}
+	source.database.Flush()
+}
+
+// MoveFiles updates the paths of the file or all files within the dir
+// moved from one path to the other right away, returning the number of
+// moved files
+func (source *Source) MoveFiles(from string, to string) int {
+	from = source.Paths.Normalize(from)
+	to = source.Paths.Normalize(to)
+	ips := source.indexedAt(from)
+	for _, ip := range ips {
+		source.database.Move(ip.Id, to+strings.TrimPrefix(ip.Path, from))
+		source.pathCache.Delete(ip.Id)
+	}
+	source.database.Flush()
+	return len(ips)
+}
+
+// DecodeDate returns the date the file at the path was taken, falling back
+// to the date in its name or its modification time
+func (source *Source) DecodeDate(path string) time.Time {
+	var info Info
+	var camera Camera
+	_, err := source.decoder.DecodeInfo(path, &info, &camera)
+	if err == nil && !info.DateTime.IsZero() {
+		return info.DateTime
+	}
+	info, _ = source.heuristicFromPath(path)
+	return info.DateTime
 }
 
 func (source *Source) IndexMetadata(dirs []string, maxPhotos int, force Missing) {
-	source.metadataQueue.AppendItems(MissingInfoToInterface(source.ListMissingMetadata(dirs, maxPhotos, force)))
+	source.IndexMetadataMatching(dirs, maxPhotos, force, Globs{})
 }
 
 func (source *Source) IndexContents(dirs []string, maxPhotos int, force Missing) {
-	source.contentsQueue.AppendItems(MissingInfoToInterface(source.ListMissingContents(dirs, maxPhotos, force)))
+	source.IndexContentsMatching(dirs, maxPhotos, force, Globs{})
+}
+
+// IndexMetadataMatching queues the files within the dirs missing metadata
+// like IndexMetadata, but only the ones matching the include patterns if
+// there are any
+func (source *Source) IndexMetadataMatching(dirs []string, maxPhotos int, force Missing, include Globs) {
+	missing := filterMissingInfos(source.ListMissingMetadata(dirs, maxPhotos, force), include)
+	source.metadataQueue.AppendItems(MissingInfoToInterface(missing))
+}
+
+// IndexContentsMatching queues the files within the dirs missing contents
+// like IndexContents, but only the ones matching the include patterns if
+// there are any
+func (source *Source) IndexContentsMatching(dirs []string, maxPhotos int, force Missing, include Globs) {
+	missing := filterMissingInfos(source.ListMissingContents(dirs, maxPhotos, force), include)
+	source.contentsQueue.AppendItems(MissingInfoToInterface(missing))
+}
+
+func filterMissingInfos(in <-chan MissingInfo, include Globs) <-chan MissingInfo {
+	if include.Empty() {
+		return in
+	}
+	out := make(chan MissingInfo)
+	go func() {
+		for m := range in {
+			if include.Match(m.Path) {
+				out <- m
+			}
+		}
+		close(out)
+	}()
+	return out
 }
 
 func (source *Source) GetDir(dir string) Info {
-	dir = filepath.FromSlash(dir)
+	dir = source.Paths.Normalize(dir)
 	result, _ := source.database.GetDir(dir)
 	return result.Info
 }
 
 func (source *Source) GetDirsCount(dirs []string) int {
 	for i := range dirs {
-		dirs[i] = filepath.FromSlash(dirs[i])
+		dirs[i] = source.Paths.Normalize(dirs[i])
 	}
 	count, _ := source.database.GetDirsCount(dirs)
 	return count
@@ -549,6 +1064,11 @@ func (source *Source) GetTag(name string) (tag.Tag, bool) {
 	return source.database.GetTagByName(name)
 }
 
+// SetTagMeta sets the display metadata of the tag
+func (source *Source) SetTagMeta(id tag.Id, meta tag.Meta) error {
+	return source.database.WriteTagMeta(id, meta)
+}
+
 func (source *Source) ListImageTags(id ImageId) <-chan tag.Tag {
 	out := make(chan tag.Tag, 100)
 	go func() {
@@ -1,20 +1,24 @@
 package image
 
 import (
-	"embed"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"photofield/internal/icc"
 	"photofield/io"
 	"photofield/io/cached"
 	"photofield/io/configured"
+	"photofield/io/diskcache"
 	"photofield/io/ffmpeg"
 	"photofield/io/filtered"
 	"photofield/io/goexif"
 	"photofield/io/goimage"
+	"photofield/io/limited"
 	"photofield/io/ristretto"
 	"photofield/io/sqlite"
 	"photofield/io/thumb"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/imdario/mergo"
@@ -79,9 +83,35 @@ type SourceEnvironment struct {
 	SourceTypes SourceTypeMap
 	DataDir     string
 	FFmpegPath  string
-	Migrations  embed.FS
+	Migrations  fs.FS
 	ImageCache  *ristretto.Ristretto
 	Databases   map[string]*sqlite.Source
+
+	// Second tier of the image cache, nil if none
+	DiskCache *diskcache.Cache
+
+	// Profile decoded originals are converted to, nil to leave them as is
+	ColorProfile *icc.Profile
+
+	// Limits the images decoded at the same time, nil if unlimited
+	Limiter *limited.Limiter
+	// Size of the original of an image, as known from its info
+	Original func(id io.ImageId) io.Size
+	// Learns the latency of the sources to order them by
+	Latency SourceLatencyConfig
+}
+
+// SourceLatencyConfig configures the latency measured for each source,
+// which replaces its configured cost once known
+type SourceLatencyConfig struct {
+	// Order the sources by their measured latency, e.g. to prefer local
+	// thumbnails over ones on a slow network share
+	Learn bool `json:"learn"`
+	// Images of a similar size loaded before the latency replaces the cost
+	MinSamples int `json:"min_samples"`
+	// Latencies not measured for this long are forgotten, so that sources
+	// that were slow once are tried again
+	MaxAgeSeconds int `json:"max_age_seconds"`
 }
 
 func (c SourceConfig) NewSource(env *SourceEnvironment) (io.Source, error) {
@@ -135,6 +165,7 @@ func (c SourceConfig) NewSource(env *SourceEnvironment) (io.Source, error) {
 		s = goimage.Image{
 			Width:  c.Width,
 			Height: c.Height,
+			Color:  env.ColorProfile,
 		}
 
 	case SourceTypeFFmpeg:
@@ -149,11 +180,20 @@ func (c SourceConfig) NewSource(env *SourceEnvironment) (io.Source, error) {
 		return nil, fmt.Errorf("unknown source type: %s", c.Type)
 	}
 
+	if env.Limiter != nil {
+		// Add limiting layer below the cache, so that only decodes wait
+		s = &limited.Limited{
+			Source:   s,
+			Limiter:  env.Limiter,
+			Original: env.Original,
+		}
+	}
 	if env.ImageCache != nil {
 		// Add caching layer
 		s = &cached.Cached{
 			Source: s,
 			Cache:  *env.ImageCache,
+			Disk:   env.DiskCache,
 		}
 	}
 	// Add filtering layer
@@ -164,11 +204,19 @@ func (c SourceConfig) NewSource(env *SourceEnvironment) (io.Source, error) {
 		}
 	}
 
-	s = configured.New(
+	cs := configured.New(
 		c.Name,
 		c.Cost,
 		s,
 	)
+	if env.Latency.Learn {
+		cs.Latency = &configured.Latency{
+			MinSamples: env.Latency.MinSamples,
+			MaxAge:     time.Duration(env.Latency.MaxAgeSeconds) * time.Second,
+		}
+		cs.Original = env.Original
+	}
+	s = cs
 
 	// println(s.Name(), c.Cost.Time.String(), c.Cost.TimePerOriginalMegapixel.String(), c.Cost.TimePerResizedMegapixel.String())
 
@@ -2,9 +2,8 @@ package image
 
 import (
 	"fmt"
-	"log"
-	"os"
 	"path/filepath"
+	"photofield/io/archive"
 	"strings"
 	"time"
 )
@@ -22,13 +21,13 @@ func (source *Source) heuristicFromPath(path string) (Info, error) {
 	for _, format := range source.DateFormats {
 		date, err := time.Parse(format, name)
 		if err == nil {
-			info.DateTime = date
+			info.DateTime = source.timezones.resolve(date, newDateHints())
 			break
 		}
 	}
 
 	if info.DateTime.IsZero() {
-		fileInfo, err := os.Stat(path)
+		fileInfo, err := archive.Stat(path)
 		if err == nil {
 			info.DateTime = fileInfo.ModTime()
 		}
@@ -63,7 +62,7 @@ func (source *Source) GetInfo(id ImageId) Info {
 		source.imageInfoCache.Set(id, info)
 		cacheSetMs := time.Since(startTime).Milliseconds()
 		if logging {
-			log.Printf("image info %5d ms get cache, %5d ms get db, %5d ms set cache\n", cacheGetMs, dbGetMs, cacheSetMs)
+			indexLog.Warn("slow image info", "cache_get_ms", cacheGetMs, "db_get_ms", dbGetMs, "cache_set_ms", cacheSetMs)
 		}
 	}
 
@@ -94,7 +93,7 @@ func (source *Source) GetInfo(id ImageId) Info {
 	logging = totalMs > 1000
 
 	if logging {
-		log.Printf("image info %5d ms get cache, %5d ms get db, %5d ms get heuristic, %5d ms set cache\n", cacheGetMs, dbGetMs, heuristicGetMs, cacheSetMs)
+		indexLog.Warn("slow image info", "cache_get_ms", cacheGetMs, "db_get_ms", dbGetMs, "heuristic_get_ms", heuristicGetMs, "cache_set_ms", cacheSetMs)
 	}
 	return info
 }
@@ -0,0 +1,76 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"strconv"
+	"time"
+
+	"photofield/io/ffmpeg"
+	"photofield/io/sqlite"
+)
+
+// VideoSprite returns the scrubbing sprite of the video, along with the
+// encoded sheet of frames if withData is set. The sprite is generated with
+// ffmpeg and stored in the thumbnail database on the first request.
+func (source *Source) VideoSprite(ctx context.Context, id ImageId, withData bool) (ffmpeg.Sprite, []byte, error) {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return ffmpeg.Sprite{}, nil, err
+	}
+	if !source.IsSupportedVideo(path) {
+		return ffmpeg.Sprite{}, nil, ErrNotAVideo
+	}
+
+	sprite, b, err := source.thumbnailSink.GetSprite(ctx, uint32(id), withData)
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return sprite, b, err
+	}
+
+	key := strconv.FormatUint(uint64(id), 10)
+	_, err, _ = source.spriteLoading.Do(key, func() (interface{}, error) {
+		return nil, source.generateSprite(id, path)
+	})
+	if err != nil {
+		return ffmpeg.Sprite{}, nil, err
+	}
+	return source.thumbnailSink.GetSprite(ctx, uint32(id), withData)
+}
+
+func (source *Source) generateSprite(id ImageId, path string) error {
+	// Not canceled with the request, as other requests wait for it
+	ctx := context.Background()
+
+	source.spriteGenerating <- struct{}{}
+	defer func() { <-source.spriteGenerating }()
+
+	start := time.Now()
+	probed, err := ffmpeg.Probe(ctx, source.ffprobePath, path)
+	if err != nil {
+		return fmt.Errorf("unable to probe %d: %w", id, err)
+	}
+	if probed.Duration <= 0 {
+		return fmt.Errorf("unable to generate sprite of %d: %w", id, ErrUnavailable)
+	}
+
+	sprite := ffmpeg.NewSprite(probed.Duration)
+	img, err := ffmpeg.GenerateSprite(ctx, source.ffmpegPath, path, &sprite)
+	if err != nil {
+		return fmt.Errorf("unable to generate sprite of %d: %w", id, err)
+	}
+
+	var b bytes.Buffer
+	err = jpeg.Encode(&b, img, &jpeg.Options{Quality: 75})
+	if err != nil {
+		return err
+	}
+	err = source.thumbnailSink.WriteSprite(uint32(id), sprite, b.Bytes())
+	if err != nil {
+		return err
+	}
+	decodeLog.Info("sprite generated", "id", id, "frames", sprite.Count, "interval", sprite.Interval, "elapsed", time.Since(start).Round(time.Millisecond))
+	return nil
+}
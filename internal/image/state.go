@@ -0,0 +1,64 @@
+package image
+
+import (
+	"errors"
+	"time"
+)
+
+// Maximum number of keys stored per user
+const MaxUserStateKeys = 256
+
+var ErrVersionConflict = errors.New("version conflict")
+var ErrTooManyKeys = errors.New("too many keys")
+
+// AnyVersion replaces the state regardless of its current version
+const AnyVersion int64 = -1
+
+// UserState is a small piece of UI state of a user, e.g. the last viewed
+// collection or the layout of a panel, so that it follows the user across
+// browsers and devices
+type UserState struct {
+	Key string
+	// JSON value
+	Value []byte
+	// Incremented on every change, 0 if the key does not exist
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// VersionConflictError is returned if the state was changed since the
+// version it was based on
+type VersionConflictError struct {
+	Current UserState
+}
+
+func (e *VersionConflictError) Error() string {
+	return ErrVersionConflict.Error()
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+func (source *Source) ListUserState(user string) ([]UserState, error) {
+	return source.database.ListUserState(user)
+}
+
+func (source *Source) GetUserState(user string, key string) (UserState, bool) {
+	return source.database.GetUserState(user, key)
+}
+
+// SetUserState replaces the value of the key if its current version matches
+// the provided version, 0 if the key is expected not to exist yet or
+// AnyVersion to replace it regardless. Returns a VersionConflictError with
+// the current state otherwise.
+func (source *Source) SetUserState(user string, key string, value []byte, version int64) (UserState, error) {
+	return source.database.WriteUserState(user, key, value, version)
+}
+
+// DeleteUserState deletes the key if its current version matches the
+// provided version or AnyVersion
+func (source *Source) DeleteUserState(user string, key string, version int64) error {
+	_, err := source.database.WriteUserState(user, key, nil, version)
+	return err
+}
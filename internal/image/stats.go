@@ -0,0 +1,153 @@
+package image
+
+import (
+	"sort"
+	"time"
+)
+
+// LibraryFile is what the library statistics need to know about a file
+type LibraryFile struct {
+	Id       ImageId
+	Filename string
+	Width    int
+	Height   int
+	// Zero if the date is unknown
+	DateTime time.Time
+	// Zero if the camera is unknown
+	Camera    CameraId
+	Metadata  bool
+	Color     bool
+	Embedding bool
+	Duration  time.Duration
+}
+
+// YearCount is the number of files taken in the year
+type YearCount struct {
+	Year  int
+	Count int
+}
+
+// CameraCount is the number of files taken with the camera
+type CameraCount struct {
+	Camera
+	Count int
+}
+
+// TagCount is the number of files with the tag
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// IndexCoverage counts the files with each kind of indexed data
+type IndexCoverage struct {
+	Metadata int
+	// Files with their contents indexed, which generates their thumbnail
+	// and extracts its color
+	Thumbnails int
+	Embeddings int
+}
+
+// LibraryStats aggregates the files in the dirs of a collection, e.g. for a
+// dashboard
+type LibraryStats struct {
+	Files  int
+	Photos int
+	Videos int
+	// Total duration of the videos with a known duration
+	VideoDuration time.Duration
+	// Average of the photos with known dimensions
+	AverageMegapixels float64
+	// Files per year, oldest first, without the files of unknown date
+	Years []YearCount
+	// Most used cameras, places and tags, the most files first
+	Cameras   []CameraCount
+	Countries []Place
+	Tags      []TagCount
+	// Distinct tags of the files, excluding selections
+	TagCount int
+	Coverage IndexCoverage
+}
+
+// LibraryStats aggregates the files in the dirs, listing up to top cameras,
+// countries and tags
+func (source *Source) LibraryStats(dirs []string, top int) LibraryStats {
+	normalized := make([]string, len(dirs))
+	for i, dir := range dirs {
+		normalized[i] = source.Paths.Normalize(dir)
+	}
+	source.database.WaitForCommit()
+
+	var stats LibraryStats
+	years := make(map[int]int)
+	cameraCounts := make(map[CameraId]int)
+	var megapixels float64
+	var sized int
+	for f := range source.database.ListLibraryFiles(normalized) {
+		stats.Files++
+		if source.IsSupportedVideo(f.Filename) {
+			stats.Videos++
+			stats.VideoDuration += f.Duration
+		} else {
+			stats.Photos++
+			if f.Width > 0 && f.Height > 0 {
+				megapixels += float64(f.Width) * float64(f.Height) / 1e6
+				sized++
+			}
+		}
+		if !f.DateTime.IsZero() {
+			years[f.DateTime.Year()]++
+		}
+		if f.Camera != 0 {
+			cameraCounts[f.Camera]++
+		}
+		if f.Metadata {
+			stats.Coverage.Metadata++
+		}
+		if f.Color {
+			stats.Coverage.Thumbnails++
+		}
+		if f.Embedding {
+			stats.Coverage.Embeddings++
+		}
+	}
+	if sized > 0 {
+		stats.AverageMegapixels = megapixels / float64(sized)
+	}
+
+	stats.Years = make([]YearCount, 0, len(years))
+	for year, count := range years {
+		stats.Years = append(stats.Years, YearCount{Year: year, Count: count})
+	}
+	sort.Slice(stats.Years, func(i, j int) bool {
+		return stats.Years[i].Year < stats.Years[j].Year
+	})
+
+	stats.Cameras = make([]CameraCount, 0)
+	for _, camera := range source.database.ListCameras() {
+		if count := cameraCounts[camera.Id]; count > 0 {
+			stats.Cameras = append(stats.Cameras, CameraCount{Camera: camera, Count: count})
+		}
+	}
+	sort.SliceStable(stats.Cameras, func(i, j int) bool {
+		return stats.Cameras[i].Count > stats.Cameras[j].Count
+	})
+	if len(stats.Cameras) > top {
+		stats.Cameras = stats.Cameras[:top]
+	}
+
+	stats.Countries = make([]Place, 0)
+	for _, p := range source.ListPlaces(normalized, "", 0) {
+		if p.Kind == PlaceCountry && len(stats.Countries) < top {
+			stats.Countries = append(stats.Countries, p)
+		}
+	}
+
+	tags := source.database.ListTagCounts(normalized)
+	stats.TagCount = len(tags)
+	if len(tags) > top {
+		tags = tags[:top]
+	}
+	stats.Tags = tags
+	return stats
+}
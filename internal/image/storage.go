@@ -0,0 +1,137 @@
+package image
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StorageUsage is the size and number of files of a group of files
+type StorageUsage struct {
+	Files int
+	Bytes int64
+}
+
+func (u *StorageUsage) add(size int64) {
+	u.Files++
+	u.Bytes += size
+}
+
+// ExtensionUsage is the storage used by the files with the extension
+type ExtensionUsage struct {
+	Extension string
+	StorageUsage
+}
+
+// DirUsage is the storage used by the files directly in the dir
+type DirUsage struct {
+	Dir string
+	StorageUsage
+}
+
+// FileSize is the size of an indexed file
+type FileSize struct {
+	Id    ImageId
+	Path  string
+	Bytes int64
+}
+
+// StorageStats reports what the files in the dirs of a collection use
+// their storage for. Sizes are taken from the content hashes stored when
+// indexing, so that the files do not need to be read, and are unknown for
+// files indexed without content_hash.enable.
+type StorageStats struct {
+	StorageUsage
+	// Files without a known size
+	Unsized int
+	// Usage by extension and by dir, the largest first
+	Extensions []ExtensionUsage
+	Dirs       []DirUsage
+	Largest    []FileSize
+	// Copies of files with the same contents beyond the first, which
+	// could be removed to free their bytes
+	Duplicates StorageUsage
+}
+
+// StorageStats computes the storage statistics of the files in the dirs,
+// listing up to top dirs and largest files
+func (source *Source) StorageStats(dirs []string, top int) StorageStats {
+	normalized := make([]string, len(dirs))
+	for i, dir := range dirs {
+		normalized[i] = source.Paths.Normalize(dir)
+	}
+
+	var stats StorageStats
+	extensions := make(map[string]*StorageUsage)
+	dirUsage := make(map[string]*StorageUsage)
+	copies := make(map[ContentHash]int)
+	var files []FileSize
+
+	source.database.WaitForCommit()
+	for ip := range source.database.ListIdPaths(normalized, 0) {
+		size, ok := hashSize(ip.Hash.Fast)
+		if !ok {
+			stats.Unsized++
+			continue
+		}
+		stats.add(size)
+
+		ext := strings.ToLower(filepath.Ext(ip.Path))
+		if extensions[ext] == nil {
+			extensions[ext] = &StorageUsage{}
+		}
+		extensions[ext].add(size)
+
+		dir := filepath.Dir(ip.Path)
+		if dirUsage[dir] == nil {
+			dirUsage[dir] = &StorageUsage{}
+		}
+		dirUsage[dir].add(size)
+
+		copies[ip.Hash]++
+		if copies[ip.Hash] > 1 {
+			stats.Duplicates.add(size)
+		}
+
+		files = append(files, FileSize{Id: ip.Id, Path: ip.Path, Bytes: size})
+	}
+
+	stats.Extensions = make([]ExtensionUsage, 0, len(extensions))
+	for ext, u := range extensions {
+		stats.Extensions = append(stats.Extensions, ExtensionUsage{Extension: ext, StorageUsage: *u})
+	}
+	sort.Slice(stats.Extensions, func(i, j int) bool {
+		a, b := stats.Extensions[i], stats.Extensions[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Extension < b.Extension
+	})
+
+	stats.Dirs = make([]DirUsage, 0, len(dirUsage))
+	for dir, u := range dirUsage {
+		stats.Dirs = append(stats.Dirs, DirUsage{Dir: dir, StorageUsage: *u})
+	}
+	sort.Slice(stats.Dirs, func(i, j int) bool {
+		a, b := stats.Dirs[i], stats.Dirs[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Dir < b.Dir
+	})
+	if len(stats.Dirs) > top {
+		stats.Dirs = stats.Dirs[:top]
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Bytes != files[j].Bytes {
+			return files[i].Bytes > files[j].Bytes
+		}
+		return files[i].Id < files[j].Id
+	})
+	if len(files) > top {
+		files = files[:top]
+	}
+	stats.Largest = append([]FileSize{}, files...)
+	return stats
+}
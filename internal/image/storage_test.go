@@ -0,0 +1,28 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(path, make([]byte, 1234), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := fileHash(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, ok := hashSize(hash)
+	if !ok || size != 1234 {
+		t.Errorf("expected size 1234 from %s, got %d %v", hash, size, ok)
+	}
+
+	for _, hash := range []string{"", "zz-0123", "4d2"} {
+		if _, ok := hashSize(hash); ok {
+			t.Errorf("expected no size from %q", hash)
+		}
+	}
+}
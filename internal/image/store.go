@@ -0,0 +1,166 @@
+package image
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/io/gpano"
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+)
+
+// Store is the metadata database of the files of a Source, implemented by
+// Database on top of SQLite and by Postgres on a PostgreSQL server. Writes
+// may be queued and committed in batches, Flush waits for the queued writes
+// to be committed.
+type Store interface {
+	// Maintenance and events
+	Stats() DatabaseStats
+	Vacuum() error
+	Export(dstPath string, migrations fs.FS, files []ExportFile) (err error)
+	Query(ctx context.Context, sql string, maxRows int, columns func(names []string) error, row func(values []any) error) (bool, error)
+	Flush()
+	WaitForCommit()
+	Subscribe(listener func(Event))
+	Publish(events []Event)
+	RefreshEmbeddings() error
+	Close() error
+
+	// Paths
+	GetPathFromId(id ImageId) (string, bool)
+	GetIdFromPath(path string) (ImageId, bool)
+	ListPrefixes() []string
+	RenameDirs(rename func(string) string) (err error)
+	GetSetting(key string) (string, bool)
+	WriteSetting(key string, value string) error
+	AppendPathWithHash(path string, hash ContentHash) error
+	AppendPaths(paths []NewPath) error
+	Move(id ImageId, path string) error
+	Delete(id ImageId) error
+	ListNonexistent(dir string, paths map[string]struct{}) <-chan IdPath
+	SetIndexed(dir string)
+	GetDir(dir string) (InfoResult, bool)
+	GetDirsCount(dirs []string) (int, bool)
+	ListPaths(dirs []string, limit int) <-chan string
+	ListIdPaths(dirs []string, limit int) <-chan IdPath
+	ListDirFiles(dir string) []DirFile
+	ListIds(dirs []string, limit int, missingEmbedding bool) <-chan ImageId
+
+	// Metadata
+	Get(id ImageId) (InfoResult, bool)
+	GetBatch(ids []ImageId) <-chan InfoListResult
+	List(dirs []string, options ListOptions) <-chan InfoListResult
+	ListMissing(dirs []string, limit int, opts Missing) <-chan MissingInfo
+	ListChanges(dirs []string, cursor int64, limit int) <-chan Change
+	LatestChange(dirs []string) int64
+	ListRecentlyAdded(dirs []string, options ListOptions) <-chan AddedInfo
+	ListLibraryFiles(dirs []string) <-chan LibraryFile
+	Write(path string, info Info, writeType InfoWriteType) error
+	WriteMeta(id ImageId, path string, info Info, camera Camera) error
+	WriteDimensions(id ImageId, info Info) error
+	WriteCaption(id ImageId, caption *string) error
+	GetHash(id ImageId) (ContentHash, bool)
+	WriteHash(id ImageId, hash ContentHash) error
+	ListIdPathsByHash(hash string) []IdPath
+
+	// Media
+	GetVideo(id ImageId) (Video, bool)
+	WriteVideo(id ImageId, video Video)
+	GetAudio(id ImageId) (Audio, bool)
+	WriteAudio(id ImageId, audio Audio)
+	GetMotionPhoto(id ImageId) (MotionPhoto, bool)
+	WriteMotionPhoto(id ImageId, motion MotionPhoto)
+	GetProjection(id ImageId) (gpano.Projection, bool)
+	WriteProjection(id ImageId, projection gpano.Projection)
+	GetSidecarFile(path string) (SidecarFile, bool)
+	ListSidecarFiles(id ImageId) []SidecarFile
+	WriteSidecarFiles(id ImageId, files []SidecarFile)
+
+	// Cameras
+	ListCameras() []Camera
+	GetCamera(id CameraId) (Camera, bool)
+	GetFileCamera(id ImageId) (Camera, bool)
+	ListCameraIds(id CameraId) <-chan ImageId
+	WriteCameraClockOffset(id CameraId, offset time.Duration) error
+
+	// Orientation
+	GetOrientationProposal(id ImageId) (OrientationProposal, bool)
+	ListOrientationProposals(dirs []string, limit int) []OrientationProposal
+	ListOrientationCandidates(dirs []string, limit int) <-chan IdPath
+	ListOrientationEdits() map[ImageId]Orientation
+	WriteOrientationProposal(p OrientationProposal) error
+	WriteOrientationProposalStatus(id ImageId, status OrientationStatus) error
+	WriteOrientationEdit(id ImageId, edit Orientation) error
+
+	// Places and trips
+	GetGeotag(id ImageId) (Geotag, bool)
+	WriteGeotag(id ImageId, geotag Geotag) error
+	ResetGeotag(id ImageId, latlng s2.LatLng) error
+	ListTrips(collection string, limit int) []Trip
+	GetTrip(id int64) (Trip, bool)
+	WriteTrips(collection string, trips []Trip) error
+
+	// Panoramas
+	WritePanorama(files []ImageId) (int64, error)
+	WritePanoramaPreview(id int64, preview string)
+	RejectPanorama(id int64) error
+	ListPanoramaFrames(dir string) []panoramaFrame
+	ListPanoramas(dirs []string, limit int) []Panorama
+	GetPanorama(id int64) (Panorama, bool)
+
+	// Tags
+	WriteTags(id ImageId, tags []tag.Tag) error
+	AddTag(name string) (<-chan struct{}, error)
+	AddTagIds(id tag.Id, ids Ids) (int, error)
+	RemoveTagIds(id tag.Id, ids Ids) (int, error)
+	InvertTagIds(id tag.Id, ids Ids) (int, error)
+	RollbackTagIds(id tag.Id, revision int) (int, error)
+	WriteTagMeta(id tag.Id, meta tag.Meta) error
+	RenameTag(id tag.Id, name string) error
+	MergeTag(from tag.Id, into tag.Id) (int, error)
+	ListTagRevisions(id tag.Id, limit int) []TagRevision
+	DiffTagRevisions(id tag.Id, from int, to int) (TagDiff, error)
+	GetTagImageIds(id tag.Id) Ids
+	ListTagRanges(id tag.Id) <-chan IdRange
+	GetTagByName(name string) (tag.Tag, bool)
+	GetTagId(name string) (tag.Id, bool)
+	ListTagsWithPrefix(prefix string) []tag.Tag
+	ListImageTags(id ImageId) <-chan tag.Tag
+	ListTags(q string, limit int) <-chan tag.Tag
+	ListTagCounts(dirs []string) []TagCount
+
+	// AI
+	WriteAI(id ImageId, embedding clip.Embedding) error
+	GetImageEmbedding(id ImageId) (clip.Embedding, error)
+	ScanEmbeddings(dirs []string, options ListOptions, fn func(EmbeddingsResult))
+	ScanQuantizedEmbeddings(dirs []string, options ListOptions, fn func(QuantizedEmbedding)) bool
+
+	// Users and audit
+	WriteUserState(user string, key string, value []byte, version int64) (UserState, error)
+	ListUserState(user string) ([]UserState, error)
+	GetUserState(user string, key string) (UserState, bool)
+	WriteAudit(entry AuditEntry)
+	ListAudit(query AuditQuery) ([]AuditEntry, error)
+	WriteSearch(user string, search Search)
+	SaveSearch(user string, search Search) (Search, error)
+	DeleteSearch(user string, id int64) error
+	ListSearches(user string, saved bool, limit int) ([]Search, error)
+	WriteSelection(user string, sel Selection) (Selection, error)
+	TouchSelection(user string, sel Selection) error
+	DeleteSelection(user string, id int64) error
+	GetSelection(user string, id int64) (Selection, error)
+	ListSelections(user string, collectionId string) ([]Selection, error)
+
+	// Quarantine and verification
+	Quarantine(q Quarantined)
+	ReleaseQuarantine(id ImageId)
+	ListQuarantine(dirs []string, limit int) []Quarantined
+	WriteVerification(v Verification)
+	ListUnverified(dirs []string, limit int) []IdPath
+	ListVerificationIssues(dirs []string, limit int) []Verification
+}
+
+var _ Store = (*Database)(nil)
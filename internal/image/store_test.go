@@ -0,0 +1,482 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"photofield/tag"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+)
+
+// postgresUrlEnv is the environment variable with the url of a PostgreSQL
+// database the store tests also run against, skipped if unset. The schema
+// of the database is dropped before each test.
+const postgresUrlEnv = "PHOTOFIELD_TEST_POSTGRES_URL"
+
+var testMigrations = os.DirFS("../..")
+
+var testDatabaseConfig = DatabaseConfig{
+	CommitIntervalMs: 10,
+	TagRevisions:     10,
+}
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photofield.cache.db")
+	db := NewDatabase(path, testMigrations, false, testDatabaseConfig, EmbeddingsConfig{})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestPostgres(t *testing.T, url string) *Postgres {
+	t.Helper()
+	pg := NewPostgres(url, testMigrations, true, DatabaseConfig{}, EmbeddingsConfig{}, t.TempDir())
+	_, err := pg.pool.Exec(context.Background(), "DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+	pg.Close()
+	pg.pool.Close()
+	if err != nil {
+		t.Fatalf("unable to reset schema: %v", err)
+	}
+	pg = NewPostgres(url, testMigrations, false, testDatabaseConfig, EmbeddingsConfig{}, t.TempDir())
+	t.Cleanup(func() {
+		pg.Flush()
+		pg.Close()
+		pg.pool.Close()
+	})
+	return pg
+}
+
+// testStores runs the test against each store, the PostgreSQL one only if
+// configured
+func testStores(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestDatabase(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv(postgresUrlEnv)
+		if url == "" {
+			t.Skipf("%s not set", postgresUrlEnv)
+		}
+		test(t, newTestPostgres(t, url))
+	})
+}
+
+func appendTestPaths(t *testing.T, store Store, paths ...string) []ImageId {
+	t.Helper()
+	newPaths := make([]NewPath, len(paths))
+	for i, path := range paths {
+		newPaths[i] = NewPath{Path: path}
+	}
+	if err := store.AppendPaths(newPaths); err != nil {
+		t.Fatalf("unable to append paths: %v", err)
+	}
+	store.Flush()
+	ids := make([]ImageId, len(paths))
+	for i, path := range paths {
+		id, ok := store.GetIdFromPath(path)
+		if !ok {
+			t.Fatalf("path %s not found", path)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func TestStorePaths(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := appendTestPaths(t, store, "/photos/a.jpg", "/photos/b.jpg", "/other/c.jpg")
+
+		if path, ok := store.GetPathFromId(ids[1]); !ok || path != "/photos/b.jpg" {
+			t.Errorf("expected /photos/b.jpg, got %q %v", path, ok)
+		}
+
+		var paths []string
+		for path := range store.ListPaths([]string{"/photos/"}, 0) {
+			paths = append(paths, path)
+		}
+		if len(paths) != 2 {
+			t.Errorf("expected 2 paths in /photos/, got %v", paths)
+		}
+
+		if err := store.Delete(ids[0]); err != nil {
+			t.Fatalf("unable to delete: %v", err)
+		}
+		store.Flush()
+		if _, ok := store.GetIdFromPath("/photos/a.jpg"); ok {
+			t.Errorf("expected deleted path to be gone")
+		}
+
+		var changes []Change
+		for change := range store.ListChanges([]string{"/photos/"}, 0, 100) {
+			changes = append(changes, change)
+		}
+		if len(changes) != 2 {
+			t.Fatalf("expected 2 changes, got %+v", changes)
+		}
+		if changes[len(changes)-1].Id != ids[0] || changes[len(changes)-1].Op != ChangeRemoved {
+			t.Errorf("expected the deletion last, got %+v", changes[len(changes)-1])
+		}
+		if store.LatestChange([]string{"/photos/"}) != changes[len(changes)-1].Cursor {
+			t.Errorf("expected the latest change to be the deletion")
+		}
+	})
+}
+
+func TestStoreMetadata(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := appendTestPaths(t, store, "/photos/a.jpg")
+		taken := time.Date(2021, 5, 4, 13, 30, 0, 0, time.UTC)
+		err := store.Write("/photos/a.jpg", Info{
+			Width:       4000,
+			Height:      3000,
+			DateTime:    taken,
+			Orientation: Rotate90,
+		}, UpdateMeta)
+		if err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		store.Flush()
+
+		info, ok := store.Get(ids[0])
+		if !ok {
+			t.Fatalf("info not found")
+		}
+		if info.Width != 4000 || info.Height != 3000 || info.Orientation != Rotate90 {
+			t.Errorf("unexpected info %+v", info.Info)
+		}
+		if !info.DateTime.Equal(taken) {
+			t.Errorf("expected %v, got %v", taken, info.DateTime)
+		}
+		if info.NeedsMeta() {
+			t.Errorf("expected meta to be present")
+		}
+
+		n := 0
+		for result := range store.List([]string{"/photos/"}, ListOptions{}) {
+			if result.Id != ids[0] {
+				t.Errorf("unexpected id %v", result.Id)
+			}
+			n++
+		}
+		if n != 1 {
+			t.Errorf("expected 1 listed file, got %d", n)
+		}
+	})
+}
+
+func TestStoreTags(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := appendTestPaths(t, store, "/photos/a.jpg", "/photos/b.jpg", "/photos/c.jpg")
+
+		done, err := store.AddTag("fav")
+		if err != nil {
+			t.Fatalf("unable to add tag: %v", err)
+		}
+		<-done
+		id, ok := store.GetTagId("fav")
+		if !ok {
+			t.Fatalf("tag not found")
+		}
+
+		add := NewIds()
+		add.AddInt(int(ids[0]))
+		add.AddInt(int(ids[1]))
+		if _, err := store.AddTagIds(id, add); err != nil {
+			t.Fatalf("unable to add ids: %v", err)
+		}
+		remove := NewIds()
+		remove.AddInt(int(ids[0]))
+		if _, err := store.RemoveTagIds(id, remove); err != nil {
+			t.Fatalf("unable to remove ids: %v", err)
+		}
+
+		tagged := store.GetTagImageIds(id)
+		if countIds(tagged) != 1 || !tagged.Contains(int(ids[1])) {
+			t.Errorf("expected only %v to be tagged, got %v", ids[1], tagged.Slice())
+		}
+
+		revisions := store.ListTagRevisions(id, 10)
+		if len(revisions) != 2 {
+			t.Fatalf("expected 2 revisions, got %+v", revisions)
+		}
+		first := revisions[len(revisions)-1]
+		if _, err := store.RollbackTagIds(id, first.Revision); err != nil {
+			t.Fatalf("unable to roll back: %v", err)
+		}
+		tagged = store.GetTagImageIds(id)
+		if countIds(tagged) != 2 || !tagged.Contains(int(ids[0])) {
+			t.Errorf("expected the first revision to be restored, got %v", tagged.Slice())
+		}
+	})
+}
+
+func TestStoreUserState(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		state, err := store.WriteUserState("alice", "theme", []byte(`"dark"`), 0)
+		if err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		updated, err := store.WriteUserState("alice", "theme", []byte(`"light"`), state.Version)
+		if err != nil {
+			t.Fatalf("unable to update: %v", err)
+		}
+
+		_, err = store.WriteUserState("alice", "theme", []byte(`"blue"`), state.Version)
+		var conflict *VersionConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("expected a version conflict, got %v", err)
+		}
+		if conflict.Current.Version != updated.Version {
+			t.Errorf("expected current version %d, got %d", updated.Version, conflict.Current.Version)
+		}
+
+		current, ok := store.GetUserState("alice", "theme")
+		if !ok || string(current.Value) != `"light"` {
+			t.Errorf("expected the state to be unchanged, got %s", current.Value)
+		}
+		if _, ok := store.GetUserState("bob", "theme"); ok {
+			t.Errorf("expected the state of other users to be separate")
+		}
+	})
+}
+
+func TestStoreSelections(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		t1, err := tag.NewSelection("photos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		sel, err := store.WriteSelection("alice", Selection{
+			CollectionId: "photos",
+			Tag:          t1,
+			CreatedAt:    now,
+			ExpiresAt:    now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("unable to write selection: %v", err)
+		}
+
+		got, err := store.GetSelection("alice", sel.Id)
+		if err != nil {
+			t.Fatalf("unable to get selection: %v", err)
+		}
+		if got.Tag.Name != t1.Name || got.CollectionId != "photos" {
+			t.Errorf("unexpected selection %+v", got)
+		}
+		if _, err := store.GetSelection("bob", sel.Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the selection of another user to be not found, got %v", err)
+		}
+
+		if err := store.DeleteSelection("alice", sel.Id); err != nil {
+			t.Fatalf("unable to delete selection: %v", err)
+		}
+		if _, err := store.GetSelection("alice", sel.Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the deleted selection to be not found, got %v", err)
+		}
+	})
+}
+
+func TestStoreAudit(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := NewIds()
+		ids.AddInt(7)
+		store.WriteAudit(AuditEntry{
+			CreatedAt: time.Now(),
+			Actor:     "alice",
+			Method:    "api_key",
+			Action:    AuditTagAdd,
+			Target:    "fav",
+			Ids:       ids,
+		})
+		store.Flush()
+
+		entries, err := store.ListAudit(AuditQuery{FileId: 7, Limit: 10})
+		if err != nil {
+			t.Fatalf("unable to list audit: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 entry, got %+v", entries)
+		}
+		entry := entries[0]
+		if entry.Actor != "alice" || entry.Action != AuditTagAdd || entry.Target != "fav" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	})
+}
+
+func TestStoreQuery(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		appendTestPaths(t, store, "/photos/a.jpg")
+
+		ctx := context.Background()
+		noColumns := func([]string) error { return nil }
+		rows := 0
+		_, err := store.Query(ctx, "SELECT id FROM infos", 10, noColumns, func([]any) error {
+			rows++
+			return nil
+		})
+		if _, ok := store.(*Postgres); ok {
+			// No role to run the queries as is configured
+			if !errors.Is(err, ErrQueryRole) {
+				t.Errorf("expected %v, got %v", ErrQueryRole, err)
+			}
+		} else if err != nil || rows != 1 {
+			t.Errorf("expected 1 row, got %d, %v", rows, err)
+		}
+
+		_, err = store.Query(ctx, "DELETE FROM infos", 10, noColumns, func([]any) error { return nil })
+		if !errors.Is(err, ErrQueryNotReadOnly) {
+			t.Errorf("expected %v, got %v", ErrQueryNotReadOnly, err)
+		}
+	})
+}
+
+func TestStoreExport(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := appendTestPaths(t, store, "/photos/a.jpg", "/photos/b.jpg")
+		id := ids[0]
+
+		camera := Camera{Make: "Fujifilm", Model: "X100V", Serial: "123"}
+		store.WriteMeta(id, "/photos/a.jpg", Info{Width: 600, Height: 400, DateTime: time.Unix(1600000000, 0)}, camera)
+		store.Flush()
+		camera, ok := store.GetFileCamera(id)
+		if !ok {
+			t.Fatalf("camera not found")
+		}
+		if err := store.WriteCameraClockOffset(camera.Id, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		caption := "Sunset"
+		if err := store.WriteCaption(id, &caption); err != nil {
+			t.Fatal(err)
+		}
+		geotag := Geotag{LatLng: s2.LatLngFromDegrees(46.05, 14.5), Edited: true}
+		if err := store.WriteGeotag(id, geotag); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.WriteOrientationEdit(id, Rotate90); err != nil {
+			t.Fatal(err)
+		}
+		done, _ := store.AddTag("trip")
+		<-done
+		tagId, _ := store.GetTagId("trip")
+		tagged := NewIds()
+		tagged.AddInt(int(id))
+		tagged.AddInt(int(ids[1]))
+		if _, err := store.AddTagIds(tagId, tagged); err != nil {
+			t.Fatal(err)
+		}
+		meta := tag.Meta{Color: "#e53935", Icon: "🏖", Description: "Summer", Pinned: true}
+		if err := store.WriteTagMeta(tagId, meta); err != nil {
+			t.Fatal(err)
+		}
+		store.Flush()
+
+		dstPath := filepath.Join(t.TempDir(), "photofield.cache.db")
+		err := store.Export(dstPath, testMigrations, []ExportFile{{Id: id, Path: "/export/a.jpg"}})
+		if err != nil {
+			t.Fatalf("unable to export: %v", err)
+		}
+		dst := NewDatabase(dstPath, testMigrations, true, testDatabaseConfig, EmbeddingsConfig{})
+		defer dst.Close()
+
+		if path, ok := dst.GetPathFromId(id); !ok || path != "/export/a.jpg" {
+			t.Errorf("expected the new path, got %q %v", path, ok)
+		}
+		if _, ok := dst.GetPathFromId(ids[1]); ok {
+			t.Errorf("expected only the provided files to be exported")
+		}
+		info, ok := dst.Get(id)
+		if !ok || info.Description != caption {
+			t.Errorf("unexpected info %+v", info.Info)
+		}
+		if got, ok := dst.GetFileCamera(id); !ok || got.Make != camera.Make || got.ClockOffset != time.Hour {
+			t.Errorf("expected the camera with its offset, got %+v", got)
+		}
+		if got, ok := dst.GetGeotag(id); !ok || !got.Edited || got.LatLng.Distance(geotag.LatLng) > s1.Angle(1e-9) {
+			t.Errorf("expected %+v, got %+v", geotag, got)
+		}
+		if got := dst.ListOrientationEdits(); got[id] != Rotate90 {
+			t.Errorf("expected the orientation edit, got %v", got)
+		}
+		got, ok := dst.GetTagByName("trip")
+		if !ok || got.Meta != meta {
+			t.Errorf("expected %+v, got %+v", meta, got.Meta)
+		}
+		if ids := dst.GetTagImageIds(got.Id); countIds(ids) != 1 || !ids.Contains(int(id)) {
+			t.Errorf("expected only the exported file to be tagged, got %v", ids.Slice())
+		}
+	})
+}
+
+func TestStoreTagMerge(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ids := appendTestPaths(t, store, "/photos/a.jpg", "/photos/b.jpg", "/photos/c.jpg")
+		tagIds := make(map[string]tag.Id)
+		for i, name := range []string{"holiday", "holidays", "work"} {
+			done, _ := store.AddTag(name)
+			<-done
+			id, ok := store.GetTagId(name)
+			if !ok {
+				t.Fatalf("tag %s not found", name)
+			}
+			tagIds[name] = id
+			files := NewIds()
+			files.AddInt(int(ids[i]))
+			if name == "holidays" {
+				files.AddInt(int(ids[0]))
+			}
+			if _, err := store.AddTagIds(id, files); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		t.Run("rename", func(t *testing.T) {
+			if err := store.RenameTag(tagIds["work"], "office"); err != nil {
+				t.Fatalf("unable to rename: %v", err)
+			}
+			renamed, ok := store.GetTagByName("office")
+			if !ok || renamed.Id != tagIds["work"] {
+				t.Fatalf("expected the tag to keep its id, got %+v", renamed)
+			}
+			if _, ok := store.GetTagByName("work"); ok {
+				t.Errorf("expected the old name to be gone")
+			}
+			if files := store.GetTagImageIds(renamed.Id); !files.Contains(int(ids[2])) {
+				t.Errorf("expected the tag to keep its files, got %v", files.Slice())
+			}
+			if err := store.RenameTag(tagIds["work"], "holiday"); !errors.Is(err, ErrTagExists) {
+				t.Errorf("expected %v, got %v", ErrTagExists, err)
+			}
+		})
+
+		t.Run("merge", func(t *testing.T) {
+			if _, err := store.MergeTag(tagIds["holidays"], tagIds["holiday"]); err != nil {
+				t.Fatalf("unable to merge: %v", err)
+			}
+			if _, ok := store.GetTagByName("holidays"); ok {
+				t.Errorf("expected the merged tag to be deleted")
+			}
+			files := store.GetTagImageIds(tagIds["holiday"])
+			if countIds(files) != 2 || !files.Contains(int(ids[0])) || !files.Contains(int(ids[1])) {
+				t.Errorf("expected the files of both tags, got %v", files.Slice())
+			}
+		})
+
+		t.Run("into itself", func(t *testing.T) {
+			if _, err := store.MergeTag(tagIds["holiday"], tagIds["holiday"]); !errors.Is(err, ErrMergeIntoItself) {
+				t.Errorf("expected %v, got %v", ErrMergeIntoItself, err)
+			}
+			if files := store.GetTagImageIds(tagIds["holiday"]); countIds(files) != 2 {
+				t.Errorf("expected the files to be unchanged, got %v", files.Slice())
+			}
+		})
+	})
+}
@@ -0,0 +1,391 @@
+package image
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"photofield/tag"
+)
+
+// SubjectConfig configures the clustering of recurring subjects other than
+// people, e.g. pets and cars, by the similarity of the AI embeddings of the
+// files showing them
+type SubjectConfig struct {
+	// Classes of the subjects clustered, e.g. dog or car
+	Classes []string `json:"classes"`
+	// Text compared to the files for each class, with {class} replaced by
+	// the class
+	Prompt string `json:"prompt"`
+	// Text compared to the files alongside the classes, standing for the
+	// files showing none of them
+	Other string `json:"other"`
+	// Minimum confidence between 0 and 1 of a file showing a class to be
+	// clustered
+	MinConfidence float32 `json:"min_confidence"`
+	// Minimum cosine similarity between the embedding of a file and the
+	// average embedding of a cluster for the file to join it
+	MinSimilarity float32 `json:"min_similarity"`
+	// Minimum number of files of a subject
+	MinFiles int `json:"min_files"`
+}
+
+func (config SubjectConfig) minFiles() int {
+	if config.MinFiles <= 0 {
+		return 5
+	}
+	return config.MinFiles
+}
+
+// Subject is a recurring subject of a collection, e.g. the same dog, found
+// by clustering the files showing a class of subjects
+type Subject struct {
+	Id         int64
+	Collection string
+	// Class of the subject, e.g. dog
+	Class string
+	// Subject tag most of the labeled files of the subject have, e.g.
+	// subject:rex, empty if it is not labeled
+	Tag string
+	// Files of the subject, the most typical first
+	Files []ImageId
+}
+
+// Cover returns the most typical file of the subject
+func (s Subject) Cover() ImageId {
+	return s.Files[0]
+}
+
+// subjectDetection is comparable, so that the queue skips duplicates
+type subjectDetection struct {
+	collection string
+	// Newline-separated dirs of the collection
+	dirs string
+}
+
+type subjectFile struct {
+	Id    ImageId
+	Class int
+	// Embedding scaled to unit length
+	Vector []float32
+}
+
+type subjectCluster struct {
+	Class int
+	// Indexes of the files of the cluster
+	Files []int
+	// Sum of the vectors of the files and its length
+	sum    []float32
+	sumLen float32
+}
+
+func (c *subjectCluster) add(v []float32) {
+	if c.sum == nil {
+		c.sum = make([]float32, len(v))
+	}
+	var sq float32
+	for i := range c.sum {
+		c.sum[i] += v[i]
+		sq += c.sum[i] * c.sum[i]
+	}
+	c.sumLen = float32(math.Sqrt(float64(sq)))
+}
+
+// similarity returns the cosine similarity of the unit vector to the
+// average of the cluster
+func (c *subjectCluster) similarity(v []float32) float32 {
+	if c.sumLen == 0 {
+		return 0
+	}
+	var dot float32
+	for i := range v {
+		dot += v[i] * c.sum[i]
+	}
+	return dot / c.sumLen
+}
+
+// clusterSubjects clusters the files of each class in order, each file
+// joining the cluster of its class with the most similar average if it is
+// at least minSimilarity, or starting a new cluster otherwise. Clusters of
+// fewer than minFiles files are dropped and the rest are returned largest
+// first, with their files ordered by similarity to their average.
+func clusterSubjects(files []subjectFile, minSimilarity float32, minFiles int) []subjectCluster {
+	var clusters []subjectCluster
+	for i, f := range files {
+		best := -1
+		bestSimilarity := minSimilarity
+		for c := range clusters {
+			if clusters[c].Class != f.Class {
+				continue
+			}
+			if s := clusters[c].similarity(f.Vector); s >= bestSimilarity {
+				best = c
+				bestSimilarity = s
+			}
+		}
+		if best == -1 {
+			clusters = append(clusters, subjectCluster{Class: f.Class})
+			best = len(clusters) - 1
+		}
+		clusters[best].add(f.Vector)
+		clusters[best].Files = append(clusters[best].Files, i)
+	}
+
+	kept := clusters[:0]
+	for _, c := range clusters {
+		if len(c.Files) < minFiles {
+			continue
+		}
+		similarities := make(map[int]float32, len(c.Files))
+		for _, i := range c.Files {
+			similarities[i] = c.similarity(files[i].Vector)
+		}
+		sort.SliceStable(c.Files, func(i, j int) bool {
+			return similarities[c.Files[i]] > similarities[c.Files[j]]
+		})
+		kept = append(kept, c)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return len(kept[i].Files) > len(kept[j].Files)
+	})
+	return kept
+}
+
+// detectedSubjects holds the subjects last detected in each collection,
+// until they are detected again or the process restarts
+type detectedSubjects struct {
+	mutex        sync.RWMutex
+	lastId       int64
+	byCollection map[string][]Subject
+}
+
+func (d *detectedSubjects) set(collection string, subjects []Subject) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i := range subjects {
+		d.lastId++
+		subjects[i].Id = d.lastId
+	}
+	if d.byCollection == nil {
+		d.byCollection = make(map[string][]Subject)
+	}
+	d.byCollection[collection] = subjects
+}
+
+func (d *detectedSubjects) list(collection string, limit int) []Subject {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	subjects := d.byCollection[collection]
+	if limit > 0 && len(subjects) > limit {
+		subjects = subjects[:limit]
+	}
+	return append([]Subject(nil), subjects...)
+}
+
+// find returns the collection of the subject and its index within it
+func (d *detectedSubjects) find(id int64) (string, int, bool) {
+	for collection, subjects := range d.byCollection {
+		for i := range subjects {
+			if subjects[i].Id == id {
+				return collection, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+func (d *detectedSubjects) get(id int64) (Subject, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	collection, i, ok := d.find(id)
+	if !ok {
+		return Subject{}, false
+	}
+	return d.byCollection[collection][i], true
+}
+
+func (d *detectedSubjects) setTag(id int64, tag string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if collection, i, ok := d.find(id); ok {
+		d.byCollection[collection][i].Tag = tag
+	}
+}
+
+// ListSubjects lists the subjects last detected in the collection, the
+// largest first
+func (source *Source) ListSubjects(collection string, limit int) []Subject {
+	return source.subjects.list(collection, limit)
+}
+
+func (source *Source) GetSubject(id int64) (Subject, bool) {
+	return source.subjects.get(id)
+}
+
+// LabelSubject tags the files of the subject with the subject tag of the
+// name, e.g. subject:rex for Rex, so that they can be searched for by tag.
+// The files lose the tag the subject was labeled with before.
+func (source *Source) LabelSubject(id int64, name string) (Subject, error) {
+	s, ok := source.subjects.get(id)
+	if !ok {
+		return Subject{}, ErrNotFound
+	}
+	t := tag.NewSubject(name)
+	if t.Name == tag.SubjectPrefix {
+		return Subject{}, errors.New("empty subject name")
+	}
+	tagId, ok := source.GetTagId(t.Name)
+	if !ok {
+		source.AddTag(t.Name)
+		if tagId, ok = source.GetTagId(t.Name); !ok {
+			return Subject{}, ErrNotFound
+		}
+	}
+	ids := NewIds()
+	for _, fid := range s.Files {
+		ids.AddInt(int(fid))
+	}
+	if _, err := source.database.AddTagIds(tagId, ids); err != nil {
+		return Subject{}, err
+	}
+	if s.Tag != "" && s.Tag != t.Name {
+		if previous, ok := source.GetTagId(s.Tag); ok {
+			if _, err := source.database.RemoveTagIds(previous, ids); err != nil {
+				return Subject{}, err
+			}
+		}
+	}
+	s.Tag = t.Name
+	source.subjects.setTag(id, s.Tag)
+	return s, nil
+}
+
+// subjectTexts returns the texts the files are compared to for the classes
+// in order, followed by the other text if set
+func (source *Source) subjectTexts() []string {
+	config := source.Subjects
+	texts := make([]string, 0, len(config.Classes)+1)
+	for _, class := range config.Classes {
+		texts = append(texts, strings.ReplaceAll(config.Prompt, "{class}", class))
+	}
+	if config.Other != "" {
+		texts = append(texts, config.Other)
+	}
+	return texts
+}
+
+// findSubjects clusters the files in the dirs showing one of the classes
+// with enough confidence by the similarity of their embeddings
+func (source *Source) findSubjects(collection string, dirs []string) ([]Subject, error) {
+	config := source.Subjects
+	if len(config.Classes) == 0 {
+		return nil, errors.New("no subject classes configured")
+	}
+	prompts, err := source.subjectPrompts.get(source.Clip, source.subjectTexts())
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, len(dirs))
+	for i := range dirs {
+		normalized[i] = source.Paths.Normalize(dirs[i])
+	}
+	var files []subjectFile
+	source.database.ScanEmbeddings(normalized, ListOptions{Hide: source.Private.Tags}, func(emb EmbeddingsResult) {
+		confidences, cerr := classify(emb.Embedding, prompts)
+		if cerr != nil {
+			err = cerr
+			return
+		}
+		class := 0
+		for i := range config.Classes {
+			if confidences[i] > confidences[class] {
+				class = i
+			}
+		}
+		if confidences[class] < config.MinConfidence {
+			return
+		}
+		vector := emb.Float32()
+		invNorm := emb.InvNormFloat32()
+		for i := range vector {
+			vector[i] *= invNorm
+		}
+		files = append(files, subjectFile{
+			Id:     emb.Id,
+			Class:  class,
+			Vector: vector,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := clusterSubjects(files, config.MinSimilarity, config.minFiles())
+	subjects := make([]Subject, len(clusters))
+	for i, c := range clusters {
+		s := Subject{
+			Collection: collection,
+			Class:      config.Classes[c.Class],
+			Files:      make([]ImageId, len(c.Files)),
+		}
+		for j, f := range c.Files {
+			s.Files[j] = files[f].Id
+		}
+		s.Tag = source.subjectTag(s.Files)
+		subjects[i] = s
+	}
+	return subjects, nil
+}
+
+// subjectTag returns the subject tag most of the files are tagged with,
+// empty if none are
+func (source *Source) subjectTag(ids []ImageId) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, id := range ids {
+		for t := range source.database.ListImageTags(id) {
+			if !strings.HasPrefix(t.Name, tag.SubjectPrefix) {
+				continue
+			}
+			counts[t.Name]++
+			if counts[t.Name] > counts[best] {
+				best = t.Name
+			}
+		}
+	}
+	return best
+}
+
+// DetectSubjects queues the collection for clustering of its recurring
+// subjects, replacing the ones detected before
+func (source *Source) DetectSubjects(collection string, dirs []string) {
+	out := make(chan interface{}, 1)
+	out <- subjectDetection{
+		collection: collection,
+		dirs:       strings.Join(dirs, "\n"),
+	}
+	close(out)
+	source.subjectQueue.AppendItems(out)
+}
+
+func (source *Source) detectSubjects(in <-chan interface{}) {
+	for elem := range in {
+
+		for source.contentsQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		d := elem.(subjectDetection)
+		subjects, err := source.findSubjects(d.collection, strings.Split(d.dirs, "\n"))
+		if err != nil {
+			indexLog.Error("detect subjects failed", "collection", d.collection, "err", err)
+			continue
+		}
+		source.subjects.set(d.collection, subjects)
+		indexLog.Info("detect subjects found", "count", len(subjects), "collection", d.collection)
+	}
+}
@@ -0,0 +1,54 @@
+package image
+
+import (
+	"math"
+	"testing"
+)
+
+func unitVector(angle float64) []float32 {
+	return []float32{float32(math.Cos(angle)), float32(math.Sin(angle))}
+}
+
+func TestClusterSubjects(t *testing.T) {
+	files := []subjectFile{
+		{Id: 1, Class: 0, Vector: unitVector(0)},
+		{Id: 2, Class: 0, Vector: unitVector(0.1)},
+		{Id: 3, Class: 0, Vector: unitVector(1.5)},
+		{Id: 4, Class: 0, Vector: unitVector(0.05)},
+		// Similar, but of a different class
+		{Id: 5, Class: 1, Vector: unitVector(0.05)},
+		{Id: 6, Class: 1, Vector: unitVector(0)},
+		{Id: 7, Class: 0, Vector: unitVector(1.45)},
+	}
+
+	clusters := clusterSubjects(files, 0.9, 2)
+	if len(clusters) != 3 {
+		t.Fatalf("expected 3 clusters, got %d", len(clusters))
+	}
+
+	expected := []struct {
+		class int
+		ids   []ImageId
+	}{
+		{0, []ImageId{4, 2, 1}},
+		{0, []ImageId{3, 7}},
+		{1, []ImageId{5, 6}},
+	}
+	for i, e := range expected {
+		c := clusters[i]
+		if c.Class != e.class {
+			t.Errorf("cluster %d expected class %d, got %d", i, e.class, c.Class)
+		}
+		if len(c.Files) != len(e.ids) {
+			t.Errorf("cluster %d expected %d files, got %d", i, len(e.ids), len(c.Files))
+			continue
+		}
+		if files[c.Files[0]].Id != e.ids[0] {
+			t.Errorf("cluster %d expected cover %d, got %d", i, e.ids[0], files[c.Files[0]].Id)
+		}
+	}
+
+	if clusters := clusterSubjects(files, 0.9, 3); len(clusters) != 1 {
+		t.Errorf("expected 1 cluster of at least 3 files, got %d", len(clusters))
+	}
+}
@@ -0,0 +1,114 @@
+package image
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"photofield/internal/clip"
+	"photofield/tag"
+)
+
+// TagSuggestion is a label a file matches according to its AI embedding,
+// tagged with the tag of the label once accepted
+type TagSuggestion struct {
+	Tag        tag.Tag
+	Label      string
+	Confidence float32
+}
+
+// labelTexts returns the texts the files are compared to for the labels
+// in order, followed by the other text if set
+func (source *Source) labelTexts() []string {
+	config := source.TagConfig.Suggestions
+	texts := make([]string, 0, len(config.Labels)+1)
+	for _, label := range config.Labels {
+		texts = append(texts, strings.ReplaceAll(config.Prompt, "{label}", label))
+	}
+	if config.Other != "" {
+		texts = append(texts, config.Other)
+	}
+	return texts
+}
+
+// suggestTags returns the labels the embedding matches with at least the
+// minimum confidence, most confident first
+func (source *Source) suggestTags(embedding clip.Embedding, minConfidence float32) ([]TagSuggestion, error) {
+	if len(source.TagConfig.Suggestions.Labels) == 0 {
+		return nil, errors.New("no labels configured")
+	}
+	prompts, err := source.labelPrompts.get(source.Clip, source.labelTexts())
+	if err != nil {
+		return nil, err
+	}
+	confidences, err := classify(embedding, prompts)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []TagSuggestion
+	for i, label := range source.TagConfig.Suggestions.Labels {
+		if confidences[i] < minConfidence {
+			continue
+		}
+		suggestions = append(suggestions, TagSuggestion{
+			Tag:        tag.NewLabel(label),
+			Label:      label,
+			Confidence: confidences[i],
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	return suggestions, nil
+}
+
+// SuggestTags returns the labels the file matches with at least the
+// minimum confidence, most confident first, skipping the ones it is tagged
+// with already. Files without an AI embedding have no suggestions.
+func (source *Source) SuggestTags(id ImageId) ([]TagSuggestion, error) {
+	if _, ok := source.database.GetPathFromId(id); !ok {
+		return nil, ErrNotFound
+	}
+	embedding, err := source.database.GetImageEmbedding(id)
+	if err != nil || embedding == nil {
+		return nil, err
+	}
+	suggestions, err := source.suggestTags(embedding, source.TagConfig.Suggestions.MinConfidence)
+	if err != nil {
+		return nil, err
+	}
+	tagged := make(map[string]struct{})
+	for t := range source.database.ListImageTags(id) {
+		tagged[t.Name] = struct{}{}
+	}
+	untagged := suggestions[:0]
+	for _, s := range suggestions {
+		if _, ok := tagged[s.Tag.Name]; ok {
+			continue
+		}
+		if t, ok := source.GetTag(s.Tag.Name); ok {
+			s.Tag = t
+		}
+		untagged = append(untagged, s)
+	}
+	return untagged, nil
+}
+
+// autoApplyTags tags the file with the labels its embedding matches with
+// at least the auto apply confidence, if enabled
+func (source *Source) autoApplyTags(id ImageId, embedding clip.Embedding) {
+	config := source.TagConfig.Suggestions
+	if !config.Enable || config.AutoApply <= 0 {
+		return
+	}
+	suggestions, err := source.suggestTags(embedding, config.AutoApply)
+	if err != nil {
+		indexLog.Error("unable to suggest tags", "id", id, "err", err)
+		return
+	}
+	tags := make([]tag.Tag, len(suggestions))
+	for i, s := range suggestions {
+		tags[i] = s.Tag
+	}
+	source.database.WriteTags(id, tags)
+}
@@ -0,0 +1,67 @@
+package image
+
+import (
+	"photofield/tag"
+)
+
+// metadataFlags returns the system tags of the problems with the metadata
+// of the file
+func metadataFlags(info Info, duplicate bool) []tag.Tag {
+	var tags []tag.Tag
+	if info.DateTime.IsZero() || info.Width == 0 || info.Height == 0 {
+		tags = append(tags, tag.Tag{Name: tag.MissingMetadata})
+	}
+	if !hasLocation(info.LatLng) {
+		tags = append(tags, tag.Tag{Name: tag.NoGps})
+	}
+	if duplicate {
+		tags = append(tags, tag.Tag{Name: tag.Duplicate})
+	}
+	return tags
+}
+
+func isMetadataFlag(name string) bool {
+	switch name {
+	case tag.MissingMetadata, tag.NoGps, tag.Duplicate:
+		return true
+	}
+	return false
+}
+
+// indexSystemTags flags the file with the system tags of the problems with
+// its metadata, replacing the ones it had before
+func (source *Source) indexSystemTags(id ImageId, info Info) {
+	if !source.Config.TagConfig.System.Enable {
+		return
+	}
+	source.replaceTagsFunc(id, isMetadataFlag, metadataFlags(info, source.isDuplicate(id)))
+}
+
+// flagFile adds the system tag to the file or removes it
+func (source *Source) flagFile(id ImageId, name string, flagged bool) {
+	if !source.Config.TagConfig.System.Enable {
+		return
+	}
+	var tags []tag.Tag
+	if flagged {
+		tags = append(tags, tag.Tag{Name: name})
+	}
+	source.replaceTagsFunc(id, func(n string) bool {
+		return n == name
+	}, tags)
+}
+
+// isDuplicate reports whether a file with the same contents that still
+// exists was indexed before the file
+func (source *Source) isDuplicate(id ImageId) bool {
+	hash, ok := source.database.GetHash(id)
+	if !ok || hash.Fast == "" {
+		return false
+	}
+	for _, d := range source.findDuplicates(hash) {
+		if d.Id < id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestMetadataFlags(t *testing.T) {
+	complete := Info{
+		Width:    4000,
+		Height:   3000,
+		DateTime: time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC),
+		LatLng:   s2.LatLngFromDegrees(46.05, 14.51),
+	}
+
+	noDate := complete
+	noDate.DateTime = time.Time{}
+	noSize := complete
+	noSize.Width = 0
+	noGps := complete
+	noGps.LatLng = NaNLatLng()
+	nullIsland := complete
+	nullIsland.LatLng = s2.LatLngFromDegrees(0, 0)
+
+	tests := []struct {
+		name      string
+		info      Info
+		duplicate bool
+		want      []string
+	}{
+		{"complete", complete, false, nil},
+		{"no date", noDate, false, []string{tag.MissingMetadata}},
+		{"no size", noSize, false, []string{tag.MissingMetadata}},
+		{"no gps", noGps, false, []string{tag.NoGps}},
+		{"null island", nullIsland, false, []string{tag.NoGps}},
+		{"duplicate", complete, true, []string{tag.Duplicate}},
+		{"empty", Info{LatLng: NaNLatLng()}, true, []string{tag.MissingMetadata, tag.NoGps, tag.Duplicate}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := metadataFlags(tt.info, tt.duplicate)
+			if len(tags) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, tags)
+			}
+			for i, name := range tt.want {
+				if tags[i].Name != name {
+					t.Errorf("expected %s, got %s", name, tags[i].Name)
+				}
+				if !isMetadataFlag(tags[i].Name) {
+					t.Errorf("expected %s to be a metadata flag", tags[i].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package image
+
+import (
+	"errors"
+
+	"photofield/tag"
+)
+
+// ErrTagExists is returned when renaming a tag to the name of another tag,
+// which it can be merged into instead
+var ErrTagExists = errors.New("tag exists")
+
+// ErrMergeIntoItself is returned when merging a tag into itself
+var ErrMergeIntoItself = errors.New("unable to merge tag into itself")
+
+// RenameTag renames the tag, keeping its files and history
+func (source *Source) RenameTag(id tag.Id, name string) error {
+	return source.database.RenameTag(id, name)
+}
+
+// MergeTag moves the files of the tag to the other tag and deletes it,
+// returning the new revision of the other tag, e.g. to fold "holidays" into
+// "holiday"
+func (source *Source) MergeTag(from tag.Id, into tag.Id) (int, error) {
+	return source.database.MergeTag(from, into)
+}
+
+func (queue *writeQueue) RenameTag(id tag.Id, name string) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Path: name,
+		Type: RenameTag,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (source *Database) MergeTag(from tag.Id, into tag.Id) (int, error) {
+	if from == into {
+		return 0, ErrMergeIntoItself
+	}
+	if _, ok := source.GetTagName(from); !ok {
+		return 0, ErrNotFound
+	}
+	if _, ok := source.GetTagName(into); !ok {
+		return 0, ErrNotFound
+	}
+
+	return source.mergeTag(from, into)
+}
+
+// mergeTag queues moving the files of the tag into the other one, see
+// Source.MergeTag
+func (queue *writeQueue) mergeTag(from tag.Id, into tag.Id) (int, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:        int64(from),
+		MergeInto: into,
+		Type:      MergeTag,
+		Done:      done,
+	}
+	switch result := (<-done).(type) {
+	case error:
+		return 0, result
+	case int:
+		queue.WaitForCommit()
+		return result, nil
+	}
+	return 0, errors.New("unable to merge tag")
+}
@@ -0,0 +1,280 @@
+package image
+
+import (
+	"errors"
+	"time"
+
+	"photofield/tag"
+
+	"zombiezen.com/go/sqlite"
+)
+
+// ErrRevisionUnavailable is returned for revisions of a tag older than the
+// ones kept in its history
+var ErrRevisionUnavailable = errors.New("revision not in history")
+
+// Operations that made the revisions of tags
+const (
+	TagOpAdd      = "ADD"
+	TagOpSubtract = "SUBTRACT"
+	TagOpInvert   = "INVERT"
+	TagOpRollback = "ROLLBACK"
+	TagOpMerge    = "MERGE"
+)
+
+var tagWriteOps = map[InfoWriteType]string{
+	AddTagIds:      TagOpAdd,
+	RemoveTagIds:   TagOpSubtract,
+	InvertTagIds:   TagOpInvert,
+	RollbackTagIds: TagOpRollback,
+}
+
+// TagRevision is a revision of the files of a tag made by a bulk operation.
+// Files tagged one at a time, e.g. while indexing, are not part of the
+// history.
+type TagRevision struct {
+	Revision  int
+	Op        string
+	ChangedAt time.Time
+	// Number of files added and removed by the revision
+	Added   int
+	Removed int
+	// Number of files with the tag after the revision
+	Count int
+}
+
+// TagDiff is the files added to and removed from a tag between two of its
+// revisions
+type TagDiff struct {
+	From    int
+	To      int
+	Added   Ids
+	Removed Ids
+}
+
+// tagChange is the files added to and removed from a tag by a revision
+type tagChange struct {
+	Revision int
+	Added    Ids
+	Removed  Ids
+}
+
+// countIds returns the number of ids, as opposed to the number of ranges
+func countIds(ids Ids) int {
+	count := 0
+	for _, r := range ids.Slice() {
+		count += r.High - r.Low + 1
+	}
+	return count
+}
+
+// composeTagChanges returns the files added and removed by the changes
+// applied in order, so that files added by one change and removed by a
+// later one are neither
+func composeTagChanges(changes []tagChange) (added Ids, removed Ids) {
+	added = NewIds()
+	removed = NewIds()
+	for _, c := range changes {
+		if c.Added != nil {
+			readded := c.Added.Clone()
+			readded.SubtractTree(removed)
+			added.AddTree(readded)
+			removed.SubtractTree(c.Added)
+		}
+		if c.Removed != nil {
+			unadded := c.Removed.Clone()
+			unadded.SubtractTree(added)
+			removed.AddTree(unadded)
+			added.SubtractTree(c.Removed)
+		}
+	}
+	return added, removed
+}
+
+// ListTagRevisions lists the revisions kept in the history of the tag,
+// newest first
+func (source *Source) ListTagRevisions(id tag.Id, limit int) []TagRevision {
+	return source.database.ListTagRevisions(id, limit)
+}
+
+// DiffTagRevisions returns the files added to and removed from the tag from
+// one revision to another, ErrRevisionUnavailable if the revisions in
+// between are not kept anymore
+func (source *Source) DiffTagRevisions(id tag.Id, from int, to int) (TagDiff, error) {
+	return source.database.DiffTagRevisions(id, from, to)
+}
+
+// RollbackTagIds reverts the files of the tag to the ones it had at the
+// revision, returning the new revision. Files tagged one at a time since
+// keep the tag.
+func (source *Source) RollbackTagIds(id tag.Id, revision int) (int, error) {
+	return source.database.RollbackTagIds(id, revision)
+}
+
+func (source *Database) ListTagRevisions(id tag.Id, limit int) []TagRevision {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	if limit <= 0 {
+		limit = -1
+	}
+	stmt := conn.Prep(`
+	SELECT revision, op, changed_at_unix, added, removed, count
+	FROM tag_revision
+	WHERE tag_id = ?
+	ORDER BY revision DESC
+	LIMIT ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+	stmt.BindInt64(2, int64(limit))
+
+	var revisions []TagRevision
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("unable to list tag revisions", "tag_id", id, "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		revisions = append(revisions, TagRevision{
+			Revision:  stmt.ColumnInt(0),
+			Op:        stmt.ColumnText(1),
+			ChangedAt: time.Unix(stmt.ColumnInt64(2), 0),
+			Added:     stmt.ColumnInt(3),
+			Removed:   stmt.ColumnInt(4),
+			Count:     stmt.ColumnInt(5),
+		})
+	}
+	return revisions
+}
+
+func (source *Database) DiffTagRevisions(id tag.Id, from int, to int) (TagDiff, error) {
+	conn := source.pool.Get(nil)
+	defer source.pool.Put(conn)
+
+	low, high := min(from, to), max(from, to)
+	if err := checkTagRevisionsWithConn(conn, id, low, high); err != nil {
+		return TagDiff{}, err
+	}
+	added, removed := composeTagChanges(listTagChangesWithConn(conn, id, low, high))
+	if from > to {
+		added, removed = removed, added
+	}
+	return TagDiff{
+		From:    from,
+		To:      to,
+		Added:   added,
+		Removed: removed,
+	}, nil
+}
+
+func (source *Database) RollbackTagIds(id tag.Id, revision int) (int, error) {
+	current, err := source.GetTagRevision(id)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	conn := source.pool.Get(nil)
+	err = checkTagRevisionsWithConn(conn, id, revision, current)
+	source.pool.Put(conn)
+	if err != nil {
+		return 0, err
+	}
+	if revision == current {
+		return current, nil
+	}
+
+	return source.rollbackTagIds(id, revision)
+}
+
+// rollbackTagIds queues reverting the files of the tag to the revision
+func (queue *writeQueue) rollbackTagIds(id tag.Id, revision int) (int, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:       int64(id),
+		Revision: revision,
+		Type:     RollbackTagIds,
+		Done:     done,
+	}
+	switch result := (<-done).(type) {
+	case error:
+		return 0, result
+	case int:
+		queue.WaitForCommit()
+		return result, nil
+	}
+	return 0, errors.New("unable to roll back tag")
+}
+
+// checkTagRevisionsWithConn returns ErrRevisionUnavailable unless the
+// changes of all the revisions of the tag after low up to high are kept
+func checkTagRevisionsWithConn(conn *sqlite.Conn, id tag.Id, low int, high int) error {
+	stmt := conn.Prep(`
+	SELECT tag.revision, MIN(tag_revision.revision)
+	FROM tag
+	LEFT JOIN tag_revision ON tag_revision.tag_id = tag.id
+	WHERE tag.id = ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+	exists, err := stmt.Step()
+	if err != nil {
+		return err
+	}
+	if !exists || stmt.ColumnType(0) == sqlite.TypeNull {
+		return ErrNotFound
+	}
+	current := stmt.ColumnInt(0)
+	if low < 0 || high > current {
+		return ErrRevisionUnavailable
+	}
+	if low == high {
+		return nil
+	}
+	if stmt.ColumnType(1) == sqlite.TypeNull || low < stmt.ColumnInt(1)-1 {
+		return ErrRevisionUnavailable
+	}
+	return nil
+}
+
+// listTagChangesWithConn returns the changes of the revisions of the tag
+// after low up to high, oldest first
+func listTagChangesWithConn(conn *sqlite.Conn, id tag.Id, low int, high int) []tagChange {
+	stmt := conn.Prep(`
+	SELECT revision, removed, file_id, len
+	FROM tag_revision_range
+	WHERE tag_id = ? AND revision > ? AND revision <= ?
+	ORDER BY revision ASC;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+	stmt.BindInt64(2, int64(low))
+	stmt.BindInt64(3, int64(high))
+
+	var changes []tagChange
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			dbLog.Error("unable to list tag changes", "tag_id", id, "err", err)
+			break
+		} else if !exists {
+			break
+		}
+		revision := stmt.ColumnInt(0)
+		if len(changes) == 0 || changes[len(changes)-1].Revision != revision {
+			changes = append(changes, tagChange{
+				Revision: revision,
+				Added:    NewIds(),
+				Removed:  NewIds(),
+			})
+		}
+		c := &changes[len(changes)-1]
+		min := stmt.ColumnInt(2)
+		len := stmt.ColumnInt(3)
+		if stmt.ColumnInt(1) != 0 {
+			c.Removed.Add(IdFromTo(min, min+len))
+		} else {
+			c.Added.Add(IdFromTo(min, min+len))
+		}
+	}
+	return changes
+}
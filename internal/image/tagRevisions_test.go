@@ -0,0 +1,62 @@
+package image
+
+import (
+	"testing"
+)
+
+func idsOf(values ...int) Ids {
+	ids := NewIds()
+	for _, v := range values {
+		ids.AddInt(v)
+	}
+	return ids
+}
+
+func TestCountIds(t *testing.T) {
+	if n := countIds(idsOf(1, 2, 3, 7, 10, 11)); n != 6 {
+		t.Errorf("expected 6 ids, got %d", n)
+	}
+	if n := countIds(NewIds()); n != 0 {
+		t.Errorf("expected 0 ids, got %d", n)
+	}
+}
+
+func TestComposeTagChanges(t *testing.T) {
+	changes := []tagChange{
+		{Revision: 2, Added: idsOf(1, 2, 3), Removed: NewIds()},
+		{Revision: 3, Added: NewIds(), Removed: idsOf(2, 10)},
+		{Revision: 4, Added: idsOf(10, 20), Removed: idsOf(3)},
+	}
+
+	added, removed := composeTagChanges(changes)
+	for _, id := range []int{1, 20} {
+		if !added.Contains(id) {
+			t.Errorf("expected %d to be added", id)
+		}
+	}
+	if n := countIds(added); n != 2 {
+		t.Errorf("expected 2 added ids, got %d", n)
+	}
+	// 2 and 3 were added and removed again, 10 was removed and added again
+	if n := countIds(removed); n != 0 {
+		t.Errorf("expected no removed ids, got %d", n)
+	}
+
+	added, removed = composeTagChanges(changes[1:])
+	if n := countIds(added); n != 1 || !added.Contains(20) {
+		t.Errorf("expected only 20 to be added, got %d ids", n)
+	}
+	for _, id := range []int{2, 3} {
+		if !removed.Contains(id) {
+			t.Errorf("expected %d to be removed", id)
+		}
+	}
+	if n := countIds(removed); n != 2 {
+		t.Errorf("expected 2 removed ids, got %d", n)
+	}
+
+	added, removed = composeTagChanges(nil)
+	if countIds(added) != 0 || countIds(removed) != 0 {
+		t.Errorf("expected no changes")
+	}
+}
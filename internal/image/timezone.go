@@ -0,0 +1,141 @@
+package image
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+// Maximum offset from UTC in use, anything above is assumed to be a stale
+// GPS timestamp rather than a timezone difference
+const maxTimezoneOffset = 14 * time.Hour
+
+type TimezoneConfig struct {
+	// Infer the timezone from the GPS time or position
+	Gps bool `json:"gps"`
+	// Timezones the camera clocks are set to, matched by make and model
+	Cameras []CameraTimezone `json:"cameras"`
+	// Timezone of dates that could not be inferred otherwise
+	Default string `json:"default"`
+}
+
+type CameraTimezone struct {
+	Make     string `json:"make"`
+	Model    string `json:"model"`
+	Timezone string `json:"timezone"`
+}
+
+// dateHints are collected while decoding metadata to infer the timezone of
+// dates stored without one, which is the case for most cameras
+type dateHints struct {
+	HasTimezone bool
+	GpsTime     time.Time
+	LatLng      s2.LatLng
+	Make        string
+	Model       string
+	Serial      string
+}
+
+func newDateHints() dateHints {
+	return dateHints{
+		LatLng: NaNLatLng(),
+	}
+}
+
+type cameraLocation struct {
+	make     string
+	model    string
+	location *time.Location
+}
+
+type timezoneResolver struct {
+	gps      bool
+	cameras  []cameraLocation
+	fallback *time.Location
+}
+
+func newTimezoneResolver(config TimezoneConfig) (*timezoneResolver, error) {
+	r := &timezoneResolver{
+		gps: config.Gps,
+	}
+	for _, camera := range config.Cameras {
+		loc, err := time.LoadLocation(camera.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("camera %s %s: %w", camera.Make, camera.Model, err)
+		}
+		r.cameras = append(r.cameras, cameraLocation{
+			make:     strings.ToLower(strings.TrimSpace(camera.Make)),
+			model:    strings.ToLower(strings.TrimSpace(camera.Model)),
+			location: loc,
+		})
+	}
+	if config.Default != "" {
+		loc, err := time.LoadLocation(config.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+		r.fallback = loc
+	}
+	return r, nil
+}
+
+func (r *timezoneResolver) camera(make string, model string) *time.Location {
+	make = strings.ToLower(strings.TrimSpace(make))
+	model = strings.ToLower(strings.TrimSpace(model))
+	for _, c := range r.cameras {
+		if c.make != "" && c.make != make {
+			continue
+		}
+		if c.model != "" && c.model != model {
+			continue
+		}
+		return c.location
+	}
+	return nil
+}
+
+// withLocation reinterprets the wall clock of t in loc
+func withLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// resolve returns the date with the wall clock of t in the inferred
+// timezone, so that it's stored as UTC together with the original offset.
+// Dates without a timezone are parsed as UTC wall clock time and are
+// returned unchanged if no timezone can be inferred.
+//
+// In order of preference the timezone is inferred from the difference
+// between the GPS time (always UTC) and the local time, the configured
+// camera timezone, the longitude of the GPS position and the default.
+func (r *timezoneResolver) resolve(t time.Time, hints dateHints) time.Time {
+	if r == nil || t.IsZero() || hints.HasTimezone {
+		return t
+	}
+
+	if r.gps && !hints.GpsTime.IsZero() {
+		offset := t.Sub(hints.GpsTime).Round(15 * time.Minute)
+		if offset.Abs() <= maxTimezoneOffset {
+			return withLocation(t, time.FixedZone("", int(offset.Seconds())))
+		}
+	}
+
+	if loc := r.camera(hints.Make, hints.Model); loc != nil {
+		return withLocation(t, loc)
+	}
+
+	if r.gps && !IsNaNLatLng(hints.LatLng) {
+		// Approximates the timezone by its nautical definition, which
+		// is good enough for sorting and sectioning by day
+		hours := math.Round(hints.LatLng.Lng.Degrees() / 15)
+		return withLocation(t, time.FixedZone("", int(hours)*60*60))
+	}
+
+	if r.fallback != nil {
+		return withLocation(t, r.fallback)
+	}
+
+	return t
+}
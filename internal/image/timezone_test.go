@@ -0,0 +1,49 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestTimezoneResolve(t *testing.T) {
+	r, err := newTimezoneResolver(TimezoneConfig{
+		Gps: true,
+		Cameras: []CameraTimezone{
+			{Make: "Canon", Timezone: "America/New_York"},
+		},
+		Default: "Europe/Ljubljana",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		hints  dateHints
+		offset int
+	}{
+		{"timezone", dateHints{HasTimezone: true, LatLng: NaNLatLng()}, 0},
+		{"gps time", dateHints{GpsTime: local.Add(-9*time.Hour - 10*time.Second), LatLng: NaNLatLng()}, 9 * 60 * 60},
+		{"stale gps time", dateHints{GpsTime: local.Add(-48 * time.Hour), Make: "Canon", LatLng: NaNLatLng()}, -4 * 60 * 60},
+		{"camera", dateHints{Make: "canon ", Model: "EOS", LatLng: NaNLatLng()}, -4 * 60 * 60},
+		{"longitude", dateHints{LatLng: s2.LatLngFromDegrees(35.7, 139.7)}, 9 * 60 * 60},
+		{"default", newDateHints(), 2 * 60 * 60},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resolved := r.resolve(local, c.hints)
+			_, offset := resolved.Zone()
+			if offset != c.offset {
+				t.Errorf("expected offset %d, got %d", c.offset, offset)
+			}
+			if resolved.Hour() != local.Hour() {
+				t.Errorf("expected local hour %d, got %d", local.Hour(), resolved.Hour())
+			}
+		})
+	}
+}
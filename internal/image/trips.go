@@ -0,0 +1,230 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+type TripConfig struct {
+	// Also detect trips and events after indexing collections
+	Detect bool `json:"detect"`
+	// Longest time without photos within a trip
+	MaxGap string `json:"max_gap"`
+	// Longest distance in kilometers between consecutive photos with a
+	// location within a trip
+	MaxDistanceKm float64 `json:"max_distance_km"`
+	// Minimum number of photos of a trip
+	MinFiles int `json:"min_files"`
+}
+
+// Trip is a trip or event detected by segmenting the timeline of a
+// collection at long gaps in time and changes of location
+type Trip struct {
+	Id         int64
+	Collection string
+	// Named after the most common place and the dates, e.g. Lisbon, May 2023
+	Name  string
+	Start time.Time
+	End   time.Time
+	// Location of the most common place, NaN if no file has a location
+	LatLng s2.LatLng
+	// File taken halfway through the trip
+	Cover ImageId
+	// Files of the trip, only set when detected
+	Files []ImageId
+	// Number of files of the trip
+	Count int
+}
+
+type tripFile struct {
+	Id       ImageId
+	DateTime time.Time
+	LatLng   s2.LatLng
+}
+
+// tripDetection is comparable, so that the queue skips duplicates
+type tripDetection struct {
+	collection string
+	// Newline-separated dirs of the collection
+	dirs string
+}
+
+func (config *TripConfig) Validate() error {
+	if _, err := config.maxGap(); err != nil {
+		return fmt.Errorf("max_gap: %w", err)
+	}
+	return nil
+}
+
+func (config TripConfig) maxGap() (time.Duration, error) {
+	if config.MaxGap == "" {
+		return 24 * time.Hour, nil
+	}
+	return time.ParseDuration(config.MaxGap)
+}
+
+func (config TripConfig) maxDistanceKm() float64 {
+	if config.MaxDistanceKm <= 0 {
+		return 100
+	}
+	return config.MaxDistanceKm
+}
+
+func (config TripConfig) minFiles() int {
+	if config.MinFiles <= 0 {
+		return 10
+	}
+	return config.MinFiles
+}
+
+// ListTrips lists the trips detected in the collection, newest first
+func (source *Source) ListTrips(collection string, limit int) []Trip {
+	return source.database.ListTrips(collection, limit)
+}
+
+func (source *Source) GetTrip(id int64) (Trip, bool) {
+	return source.database.GetTrip(id)
+}
+
+// DetectTrips queues the collection for detection of trips and events,
+// replacing the ones detected before
+func (source *Source) DetectTrips(collection string, dirs []string) {
+	out := make(chan interface{}, 1)
+	out <- tripDetection{
+		collection: collection,
+		dirs:       strings.Join(dirs, "\n"),
+	}
+	close(out)
+	source.tripQueue.AppendItems(out)
+}
+
+func (source *Source) detectTrips(in <-chan interface{}) {
+	maxGap, _ := source.Trips.maxGap()
+	for elem := range in {
+
+		for source.metadataQueue.Length() > 0 {
+			time.Sleep(1 * time.Second)
+		}
+
+		d := elem.(tripDetection)
+		var files []tripFile
+		for info := range source.ListInfos(strings.Split(d.dirs, "\n"), ListOptions{OrderBy: DateAsc}) {
+			if info.DateTime.IsZero() {
+				continue
+			}
+			files = append(files, tripFile{
+				Id:       info.Id,
+				DateTime: info.DateTime,
+				LatLng:   info.LatLng,
+			})
+		}
+
+		runs := splitTrips(files, maxGap, source.Trips.maxDistanceKm(), source.Trips.minFiles())
+		trips := make([]Trip, len(runs))
+		for i, run := range runs {
+			trips[i] = source.newTrip(d.collection, run)
+		}
+		if err := source.database.WriteTrips(d.collection, trips); err != nil {
+			indexLog.Error("detect trips unable to write", "collection", d.collection, "err", err)
+			continue
+		}
+		indexLog.Info("detect trips found", "count", len(trips), "collection", d.collection)
+	}
+}
+
+// newTrip names the trip of the files after its most common place and
+// dates
+func (source *Source) newTrip(collection string, files []tripFile) Trip {
+	t := Trip{
+		Collection: collection,
+		Start:      files[0].DateTime,
+		End:        files[len(files)-1].DateTime,
+		LatLng:     NaNLatLng(),
+		Cover:      files[len(files)/2].Id,
+		Files:      make([]ImageId, len(files)),
+		Count:      len(files),
+	}
+	counts := make(map[string]int)
+	place := ""
+	for i, f := range files {
+		t.Files[i] = f.Id
+		if !hasLocation(f.LatLng) {
+			continue
+		}
+		if IsNaNLatLng(t.LatLng) {
+			t.LatLng = f.LatLng
+		}
+		loc, ok := source.reverseGeocodeLocation(f.LatLng)
+		if !ok {
+			continue
+		}
+		name := placeLocalName(loc)
+		if name == "" {
+			name = loc.Country
+		}
+		counts[name]++
+		if counts[name] > counts[place] {
+			place = name
+			t.LatLng = f.LatLng
+		}
+	}
+	t.Name = tripName(place, t.Start, t.End)
+	return t
+}
+
+// splitTrips splits the files sorted by date into runs of at least min
+// files, where consecutive files are taken within maxGap of each other and
+// consecutive files with a location within maxDistanceKm
+func splitTrips(files []tripFile, maxGap time.Duration, maxDistanceKm float64, min int) [][]tripFile {
+	if min < 1 {
+		min = 1
+	}
+	var runs [][]tripFile
+	start := 0
+	last := NaNLatLng()
+	for i := range files {
+		split := false
+		if i > start {
+			split = files[i].DateTime.Sub(files[i-1].DateTime) > maxGap
+		}
+		located := hasLocation(files[i].LatLng)
+		if !split && located && !IsNaNLatLng(last) {
+			split = AngleToKm(last.Distance(files[i].LatLng)) > maxDistanceKm
+		}
+		if split {
+			if i-start >= min {
+				runs = append(runs, files[start:i])
+			}
+			start = i
+			last = NaNLatLng()
+		}
+		if located {
+			last = files[i].LatLng
+		}
+	}
+	if len(files)-start >= min {
+		runs = append(runs, files[start:])
+	}
+	return runs
+}
+
+// tripName returns the name of a trip at the place between the dates, e.g.
+// Lisbon, May 2023 or May – June 2023 without a place
+func tripName(place string, start time.Time, end time.Time) string {
+	var dates string
+	switch {
+	case start.Year() == end.Year() && start.Month() == end.Month():
+		dates = start.Format("January 2006")
+	case start.Year() == end.Year():
+		dates = start.Format("January") + " – " + end.Format("January 2006")
+	default:
+		dates = start.Format("January 2006") + " – " + end.Format("January 2006")
+	}
+	if place == "" {
+		return dates
+	}
+	return place + ", " + dates
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestSplitTrips(t *testing.T) {
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	lisbon := s2.LatLngFromDegrees(38.72, -9.14)
+	porto := s2.LatLngFromDegrees(41.15, -8.61)
+	var files []tripFile
+	add := func(n int, offset time.Duration, latlng s2.LatLng) {
+		for i := 0; i < n; i++ {
+			files = append(files, tripFile{
+				Id:       ImageId(len(files) + 1),
+				DateTime: start.Add(offset + time.Duration(i)*time.Hour),
+				LatLng:   latlng,
+			})
+		}
+	}
+	add(3, 0, lisbon)
+	add(2, 3*time.Hour, NaNLatLng())
+	// Same day, but too far away
+	add(4, 5*time.Hour, porto)
+	// Too short after a long gap
+	add(2, 72*time.Hour, lisbon)
+
+	runs := splitTrips(files, 24*time.Hour, 100, 3)
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	if len(runs[0]) != 5 || runs[0][0].Id != 1 {
+		t.Errorf("expected first run of 5 from 1, got %d from %d", len(runs[0]), runs[0][0].Id)
+	}
+	if len(runs[1]) != 4 || runs[1][0].Id != 6 {
+		t.Errorf("expected second run of 4 from 6, got %d from %d", len(runs[1]), runs[1][0].Id)
+	}
+}
+
+func TestTripName(t *testing.T) {
+	date := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 10, 0, 0, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		place string
+		start time.Time
+		end   time.Time
+		name  string
+	}{
+		{"Lisbon", date(2023, 5), date(2023, 5), "Lisbon, May 2023"},
+		{"", date(2023, 5), date(2023, 6), "May – June 2023"},
+		{"Oslo", date(2022, 12), date(2023, 1), "Oslo, December 2022 – January 2023"},
+	}
+	for _, c := range cases {
+		if name := tripName(c.place, c.start, c.end); name != c.name {
+			t.Errorf("expected %q, got %q", c.name, name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package image
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+
+	"photofield/io/archive"
+)
+
+type VerifyConfig struct {
+	// Hash a rolling subset of the originals again on schedule and flag the
+	// ones that do not match their stored hash anymore, as an early
+	// warning of silent corruption. Requires content_hash.enable.
+	Enable bool `json:"enable"`
+	// Time between runs
+	IntervalMinutes int `json:"interval_minutes"`
+	// Files verified per run, the least recently verified first
+	Files int `json:"files"`
+}
+
+func (c VerifyConfig) interval() time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+func (c VerifyConfig) files() int {
+	if c.Files <= 0 {
+		return 1000
+	}
+	return c.Files
+}
+
+// VerificationStatus is the outcome of hashing a file again
+type VerificationStatus string
+
+const (
+	VerificationOk         VerificationStatus = "ok"
+	VerificationMismatch   VerificationStatus = "mismatch"
+	VerificationUnreadable VerificationStatus = "unreadable"
+)
+
+// Verification is the result of hashing a file again and comparing it to
+// the stored hash. The full SHA-256 hash is compared if stored, otherwise
+// only the fast hash, which covers the size and the first bytes of the
+// file.
+type Verification struct {
+	Id         ImageId
+	Path       string
+	Status     VerificationStatus
+	VerifiedAt time.Time
+	// Hash found on a mismatch, or why the file could not be read
+	Detail string
+	// Modification time of the file, a recent one on a mismatch hints at an
+	// edit rather than corruption
+	ModifiedAt time.Time
+}
+
+// verifyFile hashes the file again and compares it to its stored hash. It
+// reports false if the file does not exist anymore, which is left to
+// indexing.
+func (source *Source) verifyFile(ip IdPath) (Verification, bool) {
+	v := Verification{
+		Id:         ip.Id,
+		Path:       ip.Path,
+		Status:     VerificationOk,
+		VerifiedAt: time.Now(),
+	}
+	unreadable := func(err error) (Verification, bool) {
+		v.Status = VerificationUnreadable
+		v.Detail = err.Error()
+		return v, true
+	}
+
+	stat, err := archive.Stat(ip.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, false
+	}
+	if err != nil {
+		return unreadable(err)
+	}
+	v.ModifiedAt = stat.ModTime()
+
+	expected, actual := ip.Hash.Fast, ""
+	if ip.Hash.Sha256 != "" {
+		expected = ip.Hash.Sha256
+		actual, err = fileSha256(ip.Path)
+	} else {
+		actual, err = fileHash(ip.Path, source.ContentHash.PrefixSize)
+	}
+	if err != nil {
+		return unreadable(err)
+	}
+	if actual != expected {
+		v.Status = VerificationMismatch
+		v.Detail = actual
+	}
+	return v, true
+}
+
+// VerifyChecksums queues the least recently verified files in the dirs to
+// be hashed again, see VerifyConfig
+func (source *Source) VerifyChecksums(dirs []string, limit int) {
+	for i := range dirs {
+		dirs[i] = source.Paths.Normalize(dirs[i])
+	}
+	out := make(chan interface{}, 1000)
+	go func() {
+		for _, ip := range source.database.ListUnverified(dirs, limit) {
+			out <- ip
+		}
+		close(out)
+	}()
+	source.verifyQueue.AppendItems(out)
+}
+
+func (source *Source) verifyChecksums(in <-chan interface{}) {
+	for elem := range in {
+		ip := elem.(IdPath)
+		v, ok := source.verifyFile(ip)
+		if !ok {
+			continue
+		}
+		switch v.Status {
+		case VerificationMismatch:
+			indexLog.Warn("checksum mismatch", "id", v.Id, "path", v.Path, "modified", v.ModifiedAt)
+			source.database.Publish([]Event{{
+				Type: EventChecksumMismatch,
+				Time: v.VerifiedAt,
+				Id:   v.Id,
+				Path: v.Path,
+			}})
+		case VerificationUnreadable:
+			indexLog.Warn("unable to verify checksum", "id", v.Id, "path", v.Path, "err", v.Detail)
+		}
+		source.database.WriteVerification(v)
+	}
+}
+
+// scheduleVerification verifies a batch of files on every interval until
+// the process exits
+func (source *Source) scheduleVerification() {
+	ticker := time.NewTicker(source.Verify.interval())
+	defer ticker.Stop()
+	for range ticker.C {
+		if source.verifyQueue.Length() > 0 {
+			continue
+		}
+		source.VerifyChecksums(nil, source.Verify.files())
+	}
+}
+
+// ListVerificationIssues lists the files in the dirs that did not match
+// their stored hash or could not be read on their last verification, the
+// most recent first
+func (source *Source) ListVerificationIssues(dirs []string, limit int) []Verification {
+	normalized := make([]string, len(dirs))
+	for i, dir := range dirs {
+		normalized[i] = source.Paths.Normalize(dir)
+	}
+	source.database.WaitForCommit()
+	return source.database.ListVerificationIssues(normalized, limit)
+}
@@ -0,0 +1,56 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(path, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fast, err := fileHash(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha, err := fileSha256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &Source{}
+	cases := []struct {
+		name   string
+		hash   ContentHash
+		write  string
+		status VerificationStatus
+	}{
+		{"fast ok", ContentHash{Fast: fast}, "contents", VerificationOk},
+		{"fast mismatch", ContentHash{Fast: fast}, "contentz", VerificationMismatch},
+		{"sha256 ok", ContentHash{Fast: fast, Sha256: sha}, "contents", VerificationOk},
+		// Same size and prefix, only caught by the full hash
+		{"sha256 mismatch", ContentHash{Fast: "ignored", Sha256: sha}, "contentz", VerificationMismatch},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(path, []byte(c.write), 0644); err != nil {
+			t.Fatal(err)
+		}
+		v, ok := source.verifyFile(IdPath{Id: 1, Path: path, Hash: c.hash})
+		if !ok {
+			t.Fatalf("%s: expected the file to exist", c.name)
+		}
+		if v.Status != c.status {
+			t.Errorf("%s: expected %s, got %s", c.name, c.status, v.Status)
+		}
+		if v.ModifiedAt.IsZero() {
+			t.Errorf("%s: expected a modification time", c.name)
+		}
+	}
+
+	if _, ok := source.verifyFile(IdPath{Id: 2, Path: filepath.Join(dir, "missing.jpg")}); ok {
+		t.Errorf("expected missing files to be skipped")
+	}
+}
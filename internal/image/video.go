@@ -0,0 +1,108 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"photofield/io/ffmpeg"
+)
+
+// Video is the format of a video file as probed with ffprobe when indexing
+// its metadata
+type Video struct {
+	Duration time.Duration
+	// Name of the codec of the video stream, e.g. h264
+	Codec string
+	// Average frames per second, zero if unknown
+	FrameRate float64
+	Chapters  []ffmpeg.Chapter
+}
+
+type videoChapterJson struct {
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Title   string `json:"title,omitempty"`
+}
+
+func marshalChapters(chapters []ffmpeg.Chapter) ([]byte, error) {
+	out := make([]videoChapterJson, len(chapters))
+	for i, c := range chapters {
+		out[i] = videoChapterJson{
+			StartMs: c.Start.Milliseconds(),
+			EndMs:   c.End.Milliseconds(),
+			Title:   c.Title,
+		}
+	}
+	return json.Marshal(out)
+}
+
+func unmarshalChapters(b []byte) ([]ffmpeg.Chapter, error) {
+	var in []videoChapterJson
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, err
+	}
+	chapters := make([]ffmpeg.Chapter, len(in))
+	for i, c := range in {
+		chapters[i] = ffmpeg.Chapter{
+			Start: time.Duration(c.StartMs) * time.Millisecond,
+			End:   time.Duration(c.EndMs) * time.Millisecond,
+			Title: c.Title,
+		}
+	}
+	return chapters, nil
+}
+
+// indexVideo probes the video for its duration, codec, frame rate and
+// chapters, doing nothing if ffprobe is not available
+func (source *Source) indexVideo(id ImageId, path string) {
+	if source.ffprobePath == "" || !source.IsSupportedVideo(path) {
+		return
+	}
+	p, err := ffmpeg.Probe(context.TODO(), source.ffprobePath, path)
+	if err != nil {
+		decodeLog.Error("unable to probe video", "path", path, "err", err)
+		return
+	}
+	source.database.WriteVideo(id, Video{
+		Duration:  p.Duration,
+		Codec:     p.Codec,
+		FrameRate: p.FrameRate,
+		Chapters:  p.Chapters,
+	})
+}
+
+// GetVideo returns the format of the video, false if it is not a video or
+// it was not probed
+func (source *Source) GetVideo(id ImageId) (Video, bool) {
+	return source.database.GetVideo(id)
+}
+
+// DurationFilter matches videos with a duration compared to a value with
+// one of the operators >, >=, < or <=
+type DurationFilter struct {
+	Op    string
+	Value time.Duration
+}
+
+// ParseDurationFilter parses the value of a duration: qualifier, e.g. >5m
+// for videos longer than five minutes. A value without an operator matches
+// videos at least as long.
+func ParseDurationFilter(str string) (DurationFilter, error) {
+	f := DurationFilter{Op: ">="}
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(str, op) {
+			f.Op = op
+			str = str[len(op):]
+			break
+		}
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return f, fmt.Errorf("invalid duration filter %q: %w", str, err)
+	}
+	f.Value = d
+	return f, nil
+}
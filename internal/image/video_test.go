@@ -0,0 +1,59 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"photofield/io/ffmpeg"
+)
+
+func TestParseDurationFilter(t *testing.T) {
+	cases := []struct {
+		str   string
+		op    string
+		value time.Duration
+		ok    bool
+	}{
+		{">5m", ">", 5 * time.Minute, true},
+		{">=30s", ">=", 30 * time.Second, true},
+		{"<1h30m", "<", 90 * time.Minute, true},
+		{"<=2m", "<=", 2 * time.Minute, true},
+		{"10s", ">=", 10 * time.Second, true},
+		{">5", "", 0, false},
+		{"=5m", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, c := range cases {
+		f, err := ParseDurationFilter(c.str)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: expected ok %v, got %v", c.str, c.ok, err)
+			continue
+		}
+		if c.ok && (f.Op != c.op || f.Value != c.value) {
+			t.Errorf("%q: expected %s %s, got %s %s", c.str, c.op, c.value, f.Op, f.Value)
+		}
+	}
+}
+
+func TestChaptersRoundTrip(t *testing.T) {
+	chapters := []ffmpeg.Chapter{
+		{Start: 0, End: 1500 * time.Millisecond, Title: "Intro"},
+		{Start: 1500 * time.Millisecond, End: time.Minute},
+	}
+	b, err := marshalChapters(chapters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := unmarshalChapters(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(chapters) {
+		t.Fatalf("expected %d chapters, got %d", len(chapters), len(out))
+	}
+	for i := range chapters {
+		if out[i] != chapters[i] {
+			t.Errorf("chapter %d: expected %+v, got %+v", i, chapters[i], out[i])
+		}
+	}
+}
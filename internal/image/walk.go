@@ -0,0 +1,134 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WalkConfig configures how dirs are traversed while indexing files
+type WalkConfig struct {
+	// Index files in symlinked dirs, dirs that were already visited are
+	// skipped to avoid cycles
+	FollowSymlinks bool `json:"follow_symlinks"`
+	// Do not descend into dirs on other filesystems, e.g. mounted volumes
+	OneFilesystem bool `json:"one_filesystem"`
+	// Index files inside ZIP and CBZ archives as if the archives were dirs
+	Archives bool `json:"archives"`
+}
+
+const (
+	// Dirs containing a .nomedia file are skipped with everything in them,
+	// as on Android
+	noMediaName = ".nomedia"
+	// Dirs can leave out files and dirs within them with a .photofieldignore
+	// file in gitignore syntax
+	ignoreFileName = ".photofieldignore"
+)
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnoreFile parses the rules of an ignore file in gitignore syntax.
+// Patterns with a slash other than a trailing one are relative to the dir
+// of the ignore file, others match the name at any depth. A trailing slash
+// only matches dirs and a leading ! includes a previously ignored file
+// again.
+func parseIgnoreFile(r io.Reader) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		} else if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		re, err := compileGlob(strings.TrimPrefix(line, "/"), anchored)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", line, err)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignoreFiles are the rules of the ignore files found while walking, by the
+// dir they are in
+type ignoreFiles map[string][]ignoreRule
+
+// load reads the ignore file in the dir, if there is one
+func (files ignoreFiles) load(dir string) {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			indexLog.Warn("unable to read ignore file", "dir", dir, "err", err)
+		}
+		return
+	}
+	defer f.Close()
+	rules, err := parseIgnoreFile(f)
+	if err != nil {
+		indexLog.Warn("ignoring invalid ignore file", "dir", dir, "err", err)
+		return
+	}
+	if len(rules) > 0 {
+		files[dir] = rules
+	}
+}
+
+// ignored reports whether the file or dir at path is left out by the ignore
+// files of the dirs it is in. The ignore file in the deepest dir takes
+// precedence and within a file the last matching rule does.
+func (files ignoreFiles) ignored(path string, isDir bool) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if rules, ok := files[dir]; ok {
+			rel, err := filepath.Rel(dir, path)
+			if err == nil {
+				rel = filepath.ToSlash(rel)
+				for i := len(rules) - 1; i >= 0; i-- {
+					rule := rules[i]
+					if rule.dirOnly && !isDir {
+						continue
+					}
+					if rule.re.MatchString(rel) {
+						return !rule.negate
+					}
+				}
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+// hasNoMedia reports whether the dir contains a .nomedia file
+func hasNoMedia(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, noMediaName))
+	return err == nil
+}
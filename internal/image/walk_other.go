@@ -0,0 +1,22 @@
+//go:build !unix
+// +build !unix
+
+package image
+
+import (
+	"path/filepath"
+)
+
+// getFileKey returns a key uniquely identifying the file or dir at path,
+// following symlinks. Devices are not supported on this platform.
+func getFileKey(path string) (key interface{}, dev uint64, ok bool) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	abs, err := filepath.Abs(real)
+	if err != nil {
+		return nil, 0, false
+	}
+	return abs, 0, true
+}
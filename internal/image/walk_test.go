@@ -0,0 +1,111 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreFileRules(t *testing.T) {
+	rules, err := parseIgnoreFile(strings.NewReader(`
+# comment
+*.tmp
+/drafts
+raw/
+2020/**/*.png
+!keep.tmp
+\#literal
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := ignoreFiles{"/photos": rules}
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"/photos/a.tmp", false, true},
+		{"/photos/a/b/c.tmp", false, true},
+		{"/photos/keep.tmp", false, false},
+		{"/photos/drafts", true, true},
+		{"/photos/a/drafts", true, false},
+		{"/photos/raw", true, true},
+		{"/photos/a/raw", true, true},
+		{"/photos/raw", false, false},
+		{"/photos/2020/a/b.png", false, true},
+		{"/photos/2021/a/b.png", false, false},
+		{"/photos/#literal", false, true},
+		{"/photos/a.jpg", false, false},
+		{"/other/a.tmp", false, false},
+	}
+	for _, c := range cases {
+		if got := files.ignored(c.path, c.isDir); got != c.ignored {
+			t.Errorf("expected %s to be ignored: %v", c.path, c.ignored)
+		}
+	}
+}
+
+func TestIgnoreFilesDeepestFirst(t *testing.T) {
+	root, err := parseIgnoreFile(strings.NewReader("*.jpg\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := parseIgnoreFile(strings.NewReader("!*.jpg\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := ignoreFiles{"/photos": root, "/photos/keep": nested}
+	if !files.ignored("/photos/a.jpg", false) {
+		t.Error("expected root rule to apply")
+	}
+	if files.ignored("/photos/keep/a.jpg", false) {
+		t.Error("expected nested rule to take precedence")
+	}
+}
+
+func TestWalkFilesIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"a.jpg",
+		"b.tmp.jpg",
+		"hidden/c.jpg",
+		"private/d.jpg",
+		"private/sub/e.jpg",
+		"nested/f.jpg",
+		"nested/g.jpg",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name string, content string) {
+		err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ignoreFileName, "*.tmp.jpg\nhidden/\n")
+	write("nested/"+ignoreFileName, "g.jpg\n")
+	write("private/"+noMediaName, "")
+
+	var paths []string
+	for path := range walkFiles(dir, []string{".jpg"}, 0, WalkConfig{}, nil, nil) {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	expected := []string{"a.jpg", "nested/f.jpg"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+// +build unix
+
+package image
+
+import (
+	"os"
+	"syscall"
+)
+
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// getFileKey returns a key uniquely identifying the file or dir at path,
+// following symlinks and bind mounts, and the device it resides on
+func getFileKey(path string) (key interface{}, dev uint64, ok bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, 0, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, uint64(stat.Dev), true
+}
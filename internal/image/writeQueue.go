@@ -0,0 +1,534 @@
+package image
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"photofield/internal/clip"
+	"photofield/io/gpano"
+	"photofield/tag"
+
+	"github.com/golang/geo/s2"
+)
+
+// writeQueue queues the writes of a database for its writer, which applies
+// them in batched transactions. The write methods are shared by all the
+// database backends, only the writer applying them differs.
+type writeQueue struct {
+	pending          chan *InfoWrite
+	transactionMutex sync.RWMutex
+	// Set while the writer holds a write transaction open
+	writing atomic.Bool
+}
+
+func (queue *writeQueue) Write(path string, info Info, writeType InfoWriteType) error {
+	queue.pending <- &InfoWrite{
+		Path: path,
+		Info: info,
+		Type: writeType,
+	}
+	return nil
+}
+
+func (queue *writeQueue) WriteMeta(id ImageId, path string, info Info, camera Camera) error {
+	queue.pending <- &InfoWrite{
+		Id:     int64(id),
+		Path:   path,
+		Info:   info,
+		Camera: camera,
+		Type:   UpdateMeta,
+	}
+	return nil
+}
+
+func (queue *writeQueue) WriteVideo(id ImageId, video Video) {
+	queue.pending <- &InfoWrite{
+		Id:    int64(id),
+		Video: video,
+		Type:  UpdateVideo,
+	}
+}
+
+// WriteAudio sets the audio recorded alongside the file, removing it if
+// the path of the audio is empty
+func (queue *writeQueue) WriteAudio(id ImageId, audio Audio) {
+	queue.pending <- &InfoWrite{
+		Id:    int64(id),
+		Audio: audio,
+		Type:  UpdateAudio,
+	}
+}
+
+// WriteMotionPhoto sets the location of the video embedded in the motion
+// photo, removing it if the length is zero
+func (queue *writeQueue) WriteMotionPhoto(id ImageId, motion MotionPhoto) {
+	queue.pending <- &InfoWrite{
+		Id:     int64(id),
+		Motion: motion,
+		Type:   UpdateMotionPhoto,
+	}
+}
+
+// WriteProjection sets the projection of the 360° photo, removing it if
+// the type is empty
+func (queue *writeQueue) WriteProjection(id ImageId, projection gpano.Projection) {
+	queue.pending <- &InfoWrite{
+		Id:         int64(id),
+		Projection: projection,
+		Type:       UpdateProjection,
+	}
+}
+
+// WriteSidecarFiles replaces the sidecar files associated with the file
+func (queue *writeQueue) WriteSidecarFiles(id ImageId, files []SidecarFile) {
+	queue.pending <- &InfoWrite{
+		Id:       int64(id),
+		Sidecars: files,
+		Type:     UpdateSidecars,
+	}
+}
+
+// WriteCaption sets the edited caption of the file, taking precedence over
+// the embedded one, or reverts to the embedded one if nil
+func (queue *writeQueue) WriteCaption(id ImageId, caption *string) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:      int64(id),
+		Caption: caption,
+		Type:    UpdateCaption,
+		Done:    done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+// WriteGeotag sets the location of the file, replacing its stored location
+func (queue *writeQueue) WriteGeotag(id ImageId, geotag Geotag) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:     int64(id),
+		Geotag: geotag,
+		Type:   UpdateGeotag,
+		Done:   done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResetGeotag removes the geotag of the file, replacing its stored location
+// with the one from its metadata, NaN if it has none
+func (queue *writeQueue) ResetGeotag(id ImageId, latlng s2.LatLng) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id: int64(id),
+		Info: Info{
+			LatLng: latlng,
+		},
+		Type: ResetGeotag,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteTrips replaces the trips of the collection, keeping the ids of the
+// trips starting at the same time as before
+func (queue *writeQueue) WriteTrips(collection string, trips []Trip) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Collection: collection,
+		Trips:      trips,
+		Type:       UpdateTrips,
+		Done:       done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+// WriteTagMeta sets the display metadata of the tag
+func (queue *writeQueue) WriteTagMeta(id tag.Id, meta tag.Meta) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:      int64(id),
+		TagMeta: meta,
+		Type:    UpdateTagMeta,
+		Done:    done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+// WriteCameraClockOffset sets the clock offset of the camera, shifting the
+// dates of its files by the difference to the previous offset
+func (queue *writeQueue) WriteCameraClockOffset(id CameraId, offset time.Duration) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Camera: Camera{
+			Id:          id,
+			ClockOffset: offset,
+		},
+		Type: UpdateCamera,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (queue *writeQueue) WriteOrientationProposal(p OrientationProposal) error {
+	queue.pending <- &InfoWrite{
+		Proposal: p,
+		Type:     UpdateOrientationProposal,
+	}
+	return nil
+}
+
+func (queue *writeQueue) WriteOrientationProposalStatus(id ImageId, status OrientationStatus) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Proposal: OrientationProposal{
+			Id:     id,
+			Status: status,
+		},
+		Type: UpdateOrientationProposalStatus,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+// WriteUserState replaces or deletes the state if nil, see
+// Source.SetUserState
+func (queue *writeQueue) WriteUserState(user string, key string, value []byte, version int64) (UserState, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User: user,
+		State: UserState{
+			Key:     key,
+			Value:   value,
+			Version: version,
+		},
+		Type: UpdateUserState,
+		Done: done,
+	}
+	result := <-done
+	if err, ok := result.(error); ok {
+		return UserState{}, err
+	}
+	queue.WaitForCommit()
+	return result.(UserState), nil
+}
+
+// WriteSearch adds the search to the history of the user, see
+// Source.RecordSearch
+func (queue *writeQueue) WriteSearch(user string, search Search) {
+	queue.pending <- &InfoWrite{
+		User:   user,
+		Search: search,
+		Type:   WriteSearch,
+	}
+}
+
+// SaveSearch names the search of the user, adding it if it is not in the
+// history
+func (queue *writeQueue) SaveSearch(user string, search Search) (Search, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User:   user,
+		Search: search,
+		Type:   SaveSearch,
+		Done:   done,
+	}
+	result := <-done
+	if err, ok := result.(error); ok {
+		return Search{}, err
+	}
+	queue.WaitForCommit()
+	return result.(Search), nil
+}
+
+func (queue *writeQueue) DeleteSearch(user string, id int64) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		User:   user,
+		Search: Search{Id: id},
+		Type:   DeleteSearch,
+		Done:   done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (queue *writeQueue) WriteAudit(entry AuditEntry) {
+	queue.pending <- &InfoWrite{
+		Audit: entry,
+		Type:  WriteAudit,
+	}
+}
+
+// WriteDimensions replaces the stored width, height and orientation of the
+// file, leaving the rest of its metadata as is
+func (queue *writeQueue) WriteDimensions(id ImageId, info Info) error {
+	queue.pending <- &InfoWrite{
+		Id: int64(id),
+		Info: Info{
+			Width:       info.Width,
+			Height:      info.Height,
+			Orientation: info.Orientation,
+		},
+		Type: UpdateDimensions,
+	}
+	return nil
+}
+
+// WriteOrientationEdit replaces the edit of the file, updating its stored
+// orientation and dimensions, and resolves its pending proposal
+func (queue *writeQueue) WriteOrientationEdit(id ImageId, edit Orientation) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id: int64(id),
+		Info: Info{
+			Orientation: edit,
+		},
+		Type: UpdateOrientationEdit,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+func (queue *writeQueue) AppendPathWithHash(path string, hash ContentHash) error {
+	queue.pending <- &InfoWrite{
+		Path: path,
+		Type: AppendPath,
+		Hash: hash,
+	}
+	return nil
+}
+
+// AppendPaths appends many new files with a single write
+func (queue *writeQueue) AppendPaths(paths []NewPath) error {
+	queue.pending <- &InfoWrite{
+		NewPaths: paths,
+		Type:     AppendPaths,
+	}
+	return nil
+}
+
+func (queue *writeQueue) WriteHash(id ImageId, hash ContentHash) error {
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Type: UpdateHash,
+		Hash: hash,
+	}
+	return nil
+}
+
+func (queue *writeQueue) Move(id ImageId, path string) error {
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Path: path,
+		Type: MovePath,
+	}
+	return nil
+}
+
+func (queue *writeQueue) CompactTag(id tag.Id) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		d := make(chan any)
+		queue.pending <- &InfoWrite{
+			Id:   int64(id),
+			Type: CompactTagIds,
+			Done: d,
+		}
+		<-d
+		close(done)
+	}()
+	return done
+}
+
+func (queue *writeQueue) WriteTags(id ImageId, tags []tag.Tag) error {
+	for _, t := range tags {
+		queue.pending <- &InfoWrite{
+			Id:   int64(id),
+			Type: AddTagId,
+			Path: t.Name,
+		}
+	}
+	return nil
+}
+
+func (queue *writeQueue) Delete(id ImageId) error {
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Type: Delete,
+	}
+	return nil
+}
+
+func (queue *writeQueue) WriteAI(id ImageId, embedding clip.Embedding) error {
+	queue.pending <- &InfoWrite{
+		Id:        int64(id),
+		Type:      UpdateAI,
+		Embedding: embedding,
+	}
+	return nil
+}
+
+func (queue *writeQueue) AddTag(name string) (<-chan struct{}, error) {
+	d := make(chan any)
+	done := make(chan struct{})
+	queue.pending <- &InfoWrite{
+		Path: name,
+		Type: AddTag,
+		Done: d,
+	}
+	go func() {
+		<-d
+		queue.WaitForCommit()
+		close(done)
+	}()
+	return done, nil
+}
+
+// Flush waits until all the pending writes are committed
+func (queue *writeQueue) Flush() {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Type: Flush,
+		Done: done,
+	}
+	<-done
+	queue.WaitForCommit()
+}
+
+func (queue *writeQueue) WaitForCommit() {
+	queue.transactionMutex.RLock()
+	defer queue.transactionMutex.RUnlock()
+}
+
+func (queue *writeQueue) SetIndexed(dir string) {
+	queue.Write(dir, Info{
+		DateTime: time.Now(),
+	}, Index)
+}
+
+// WritePanorama stores the files as a new panorama set in sequence order,
+// returning its id
+func (queue *writeQueue) WritePanorama(files []ImageId) (int64, error) {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Panorama: Panorama{
+			Files:     files,
+			CreatedAt: time.Now(),
+		},
+		Type: WritePanorama,
+		Done: done,
+	}
+	result := <-done
+	if err, ok := result.(error); ok {
+		return 0, err
+	}
+	queue.WaitForCommit()
+	return result.(int64), nil
+}
+
+func (queue *writeQueue) WritePanoramaPreview(id int64, preview string) {
+	queue.pending <- &InfoWrite{
+		Panorama: Panorama{
+			Id:      id,
+			Preview: preview,
+		},
+		Type: UpdatePanoramaPreview,
+	}
+}
+
+// Quarantine records that the file failed to decode, leaving it out of
+// listings and indexing until released
+func (queue *writeQueue) Quarantine(q Quarantined) {
+	queue.pending <- &InfoWrite{
+		Quarantine: q,
+		Type:       QuarantineFile,
+	}
+}
+
+// ReleaseQuarantine lists and indexes the file again
+func (queue *writeQueue) ReleaseQuarantine(id ImageId) {
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Type: ReleaseFile,
+	}
+}
+
+// WriteVerification stores the result of hashing the file again
+func (queue *writeQueue) WriteVerification(v Verification) {
+	queue.pending <- &InfoWrite{
+		Verification: v,
+		Type:         UpdateVerification,
+	}
+}
+
+func (queue *writeQueue) RejectPanorama(id int64) error {
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Panorama: Panorama{
+			Id: id,
+		},
+		Type: RejectPanorama,
+		Done: done,
+	}
+	if err, ok := (<-done).(error); ok && err != nil {
+		return err
+	}
+	queue.WaitForCommit()
+	return nil
+}
+
+// writeTagIds queues the files added, removed or inverted by the write for
+// the tag, returning the revision of the tag after it, or the current one
+// if the files of the tag stay the same
+func (queue *writeQueue) writeTagIds(writeType InfoWriteType, id tag.Id, ids Ids, revision func(tag.Id) (int, error)) (int, error) {
+	if ids.Len() == 0 {
+		return revision(id)
+	}
+	done := make(chan any)
+	queue.pending <- &InfoWrite{
+		Id:   int64(id),
+		Ids:  ids,
+		Type: writeType,
+		Done: done,
+	}
+	rev := (<-done).(int)
+	if rev == 0 {
+		return revision(id)
+	} else {
+		queue.WaitForCommit()
+		return rev, nil
+	}
+}
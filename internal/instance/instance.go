@@ -0,0 +1,142 @@
+// Package instance coordinates multiple photofield processes sharing the same
+// data dir.
+//
+// A single writer indexes files and writes the cache database, while any
+// number of read-only peers serve the same database, e.g. to scale tile
+// rendering behind a load balancer. The writer is elected by holding an
+// advisory lock on a file in the data dir, which the operating system
+// releases when the process exits.
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Role string
+
+const (
+	// The first process to lock the data dir becomes the writer, the others
+	// read-only peers
+	RoleAuto   Role = "auto"
+	RoleWriter Role = "writer"
+	RoleReader Role = "reader"
+)
+
+type Config struct {
+	// auto, writer or reader
+	Role Role `json:"role"`
+	// Seconds between attempts of a reader started with the auto role to take
+	// over the lock of a stopped writer, 0 to never take over
+	TakeoverInterval int `json:"takeover_interval"`
+}
+
+// Name of the lock file in the data dir
+const lockName = "photofield.lock"
+
+// Environment variable with the descriptor of the lock file handed over to
+// the process replacing the writer, see Lock.Exec
+const inheritEnv = "PHOTOFIELD_LOCK_FD"
+
+var ErrLocked = errors.New("data dir is locked by another writer")
+
+// Lock is an advisory lock on the data dir held by the writer
+type Lock struct {
+	file *os.File
+}
+
+// Acquire locks the data dir without waiting, ErrLocked if another process
+// holds the lock. The lock handed over by Lock.Exec is already held.
+func Acquire(dir string) (*Lock, error) {
+	if f := inherit(); f != nil {
+		return &Lock{file: f}, nil
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Record the holder for the processes finding the lock taken
+	host, _ := os.Hostname()
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d@%s\n", os.Getpid(), host)), 0)
+	}
+	return &Lock{file: f}, nil
+}
+
+// Release unlocks the data dir
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	err := unlock(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Holder returns the pid@host of the last process to lock the data dir, empty
+// if unknown
+func Holder(dir string) string {
+	b, err := os.ReadFile(filepath.Join(dir, lockName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Elect returns the role of this process and the lock it holds as the writer
+func Elect(config Config, dir string) (Role, *Lock, error) {
+	switch config.Role {
+	case RoleReader:
+		return RoleReader, nil, nil
+	case RoleWriter:
+		l, err := Acquire(dir)
+		if errors.Is(err, ErrLocked) {
+			return "", nil, fmt.Errorf("%w (%s)", err, Holder(dir))
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return RoleWriter, l, nil
+	case RoleAuto, "":
+		l, err := Acquire(dir)
+		if errors.Is(err, ErrLocked) {
+			return RoleReader, nil, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return RoleWriter, l, nil
+	default:
+		return "", nil, fmt.Errorf("unknown instance role %q", config.Role)
+	}
+}
+
+// Takeover tries to lock the data dir every interval until it succeeds or the
+// context is done, returning the lock once the writer has stopped
+func Takeover(ctx context.Context, dir string, interval time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			l, err := Acquire(dir)
+			if errors.Is(err, ErrLocked) {
+				continue
+			}
+			return l, err
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package instance
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestElect(t *testing.T) {
+	dir := t.TempDir()
+
+	role, lock, err := Elect(Config{Role: RoleAuto}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != RoleWriter || lock == nil {
+		t.Fatalf("expected the first process to be the writer, got %s", role)
+	}
+
+	role, peer, err := Elect(Config{Role: RoleAuto}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != RoleReader || peer != nil {
+		t.Errorf("expected a reader while the writer holds the lock, got %s", role)
+	}
+
+	if _, _, err := Elect(Config{Role: RoleWriter}, dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected a second writer to fail with ErrLocked, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	role, lock, err = Elect(Config{Role: RoleAuto}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != RoleWriter {
+		t.Errorf("expected the writer after the lock was released, got %s", role)
+	}
+	lock.Release()
+
+	if _, _, err := Elect(Config{Role: "primary"}, dir); err == nil {
+		t.Error("expected an unknown role to fail")
+	}
+}
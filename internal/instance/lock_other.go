@@ -0,0 +1,29 @@
+//go:build !unix
+// +build !unix
+
+package instance
+
+import (
+	"errors"
+	"os"
+)
+
+// Advisory locks are not supported on this platform, so every process
+// started with the auto or writer role becomes the writer. Configure the
+// peers with the reader role explicitly.
+func tryLock(f *os.File) error {
+	return nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
+
+func inherit() *os.File {
+	return nil
+}
+
+// Exec is not supported on this platform, restart the process instead
+func (l *Lock) Exec() error {
+	return errors.ErrUnsupported
+}
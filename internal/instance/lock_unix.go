@@ -0,0 +1,59 @@
+//go:build unix
+// +build unix
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+func tryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// inherit returns the lock file handed over by Lock.Exec, nil if the process
+// was not started by it
+func inherit() *os.File {
+	s, ok := os.LookupEnv(inheritEnv)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(inheritEnv)
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), lockName)
+}
+
+// Exec replaces the process with a new one started with the same arguments
+// and environment, handing over the lock without releasing it in between
+func (l *Lock) Exec() error {
+	// Unlike the original, the duplicate is kept open across exec
+	fd, err := syscall.Dup(int(l.file.Fd()))
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	env := append(os.Environ(), fmt.Sprintf("%s=%d", inheritEnv, fd))
+	err = syscall.Exec(executable, os.Args, env)
+	syscall.Close(fd)
+	return err
+}
@@ -0,0 +1,43 @@
+//go:build unix
+// +build unix
+
+package instance
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestInherit(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := Acquire(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As handed over by Exec
+	fd, err := syscall.Dup(int(lock.file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.file.Close()
+	t.Setenv(inheritEnv, strconv.Itoa(fd))
+
+	inherited, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected the handed over lock, got %v", err)
+	}
+	if _, err := Acquire(dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected the handed over lock to be held, got %v", err)
+	}
+	if err := inherited.Release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected the lock once released, got %v", err)
+	}
+	lock.Release()
+}
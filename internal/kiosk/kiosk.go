@@ -0,0 +1,371 @@
+// Package kiosk serves a self-refreshing full-screen slideshow for digital
+// photo frames, which only needs a browser without JavaScript.
+package kiosk
+
+import (
+	"fmt"
+	"image/jpeg"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/collection"
+	"photofield/internal/image"
+	"photofield/internal/logging"
+	"photofield/search"
+)
+
+var serverLog = logging.Module("server")
+
+// Config sets the defaults of the slideshow, which can be overridden by
+// the query parameters of the same name
+type Config struct {
+	// How long each photo is shown
+	Interval string `json:"interval"`
+	// Order of the photos, random, newest or oldest
+	Order string `json:"order"`
+	// Size of the screen, photos are not loaded bigger than this
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// How photos are fit to the screen, contain or cover
+	Fit string `json:"fit"`
+	// Show the date of each photo
+	Caption bool `json:"caption"`
+}
+
+const (
+	OrderRandom = "random"
+	OrderNewest = "newest"
+	OrderOldest = "oldest"
+
+	FitContain = "contain"
+	FitCover   = "cover"
+)
+
+// Largest photo that can be requested
+const maxSize = 8192
+
+func (config *Config) Validate() error {
+	if _, err := config.interval(); err != nil {
+		return fmt.Errorf("interval: %w", err)
+	}
+	switch config.Order {
+	case "", OrderRandom, OrderNewest, OrderOldest:
+	default:
+		return fmt.Errorf("unsupported order %s, use random, newest or oldest", config.Order)
+	}
+	switch config.Fit {
+	case "", FitContain, FitCover:
+	default:
+		return fmt.Errorf("unsupported fit %s, use contain or cover", config.Fit)
+	}
+	if config.Width < 0 || config.Width > maxSize || config.Height < 0 || config.Height > maxSize {
+		return fmt.Errorf("width and height must be between 1 and %d", maxSize)
+	}
+	return nil
+}
+
+func (config Config) interval() (time.Duration, error) {
+	if config.Interval == "" {
+		return 30 * time.Second, nil
+	}
+	d, err := time.ParseDuration(config.Interval)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("must be at least 1s")
+	}
+	return d, nil
+}
+
+func (config Config) withDefaults() Config {
+	if config.Interval == "" {
+		config.Interval = "30s"
+	}
+	if config.Order == "" {
+		config.Order = OrderRandom
+	}
+	if config.Width == 0 {
+		config.Width = 1920
+	}
+	if config.Height == 0 {
+		config.Height = 1080
+	}
+	if config.Fit == "" {
+		config.Fit = FitContain
+	}
+	return config
+}
+
+// slideshow is the state of a slideshow carried between the refreshes in
+// the query parameters
+type slideshow struct {
+	Config
+	Collection string
+	Tag        string
+	// Position in the slideshow
+	Index int
+	// Seed of the random order
+	Seed int64
+}
+
+// parse returns the slideshow of the query parameters, using the config
+// for the ones not set
+func parse(config Config, q url.Values) (slideshow, error) {
+	s := slideshow{
+		Config:     config,
+		Collection: q.Get("collection"),
+		Tag:        q.Get("tag"),
+	}
+	if v := q.Get("interval"); v != "" {
+		s.Interval = v
+	}
+	if v := q.Get("order"); v != "" {
+		s.Order = v
+	}
+	if v := q.Get("fit"); v != "" {
+		s.Fit = v
+	}
+	if v := q.Get("caption"); v != "" {
+		s.Caption = v == "true" || v == "1"
+	}
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"width", &s.Width},
+		{"height", &s.Height},
+		{"index", &s.Index},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return s, fmt.Errorf("invalid %s", p.name)
+		}
+		*p.value = n
+	}
+	if v := q.Get("seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return s, fmt.Errorf("invalid seed")
+		}
+		s.Seed = seed
+	} else {
+		s.Seed = time.Now().UnixNano()
+	}
+	if s.Collection == "" && s.Tag == "" {
+		return s, fmt.Errorf("collection or tag required")
+	}
+	if err := s.Config.Validate(); err != nil {
+		return s, err
+	}
+	s.Config = s.Config.withDefaults()
+	return s, nil
+}
+
+// query returns the query parameters of the slideshow at the index
+func (s slideshow) query(index int) string {
+	q := url.Values{}
+	if s.Collection != "" {
+		q.Set("collection", s.Collection)
+	}
+	if s.Tag != "" {
+		q.Set("tag", s.Tag)
+	}
+	q.Set("interval", s.Interval)
+	q.Set("order", s.Order)
+	q.Set("fit", s.Fit)
+	q.Set("width", strconv.Itoa(s.Width))
+	q.Set("height", strconv.Itoa(s.Height))
+	if s.Caption {
+		q.Set("caption", "true")
+	}
+	q.Set("seed", strconv.FormatInt(s.Seed, 10))
+	q.Set("index", strconv.Itoa(index))
+	return q.Encode()
+}
+
+// at returns the position in the list of ids of the slideshow at the index.
+// Random slideshows show each photo once before reshuffling.
+func (s slideshow) at(index int, count int) int {
+	i := index % count
+	if s.Order != OrderRandom {
+		return i
+	}
+	round := int64(index / count)
+	return rand.New(rand.NewSource(s.Seed + round)).Perm(count)[i]
+}
+
+type Handler struct {
+	config      Config
+	prefix      string
+	collections func() []collection.Collection
+	source      *image.Source
+}
+
+// New returns the handler serving the slideshow page at the prefix and
+// the photos below it
+func New(config Config, prefix string, collections func() []collection.Collection, source *image.Source) *Handler {
+	return &Handler{
+		config:      config,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		collections: collections,
+		source:      source,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, h.prefix)
+	switch {
+	case p == "" || p == "/":
+		h.servePage(w, r)
+	case strings.HasPrefix(p, "/photos/"):
+		h.servePhoto(w, r, strings.TrimSuffix(strings.TrimPrefix(p, "/photos/"), ".jpg"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ids returns the ids of the photos of the slideshow in order
+func (h *Handler) ids(s slideshow) ([]image.ImageId, error) {
+	var dirs []string
+	var ignore []string
+	if s.Collection != "" {
+		var c *collection.Collection
+		for _, col := range h.collections() {
+			if col.Id == s.Collection {
+				c = &col
+				break
+			}
+		}
+		if c == nil {
+			return nil, fmt.Errorf("collection not found")
+		}
+		dirs = append(dirs, c.Dirs...)
+		ignore = c.Ignore
+	} else {
+		for _, col := range h.collections() {
+			dirs = append(dirs, col.Dirs...)
+		}
+	}
+
+	// Frames are on display, so private photos are only shown if their tag
+	// is the one of the slideshow
+	options := image.ListOptions{
+		Ignore: ignore,
+		Hide:   h.source.Private.Tags,
+	}
+	switch s.Order {
+	case OrderNewest:
+		options.OrderBy = image.DateDesc
+	case OrderOldest:
+		options.OrderBy = image.DateAsc
+	}
+	if s.Tag != "" {
+		options.Query = &search.Query{
+			Terms: []*search.Term{
+				{Qualifier: &search.Qualifier{Key: "tag", Value: s.Tag}},
+			},
+		}
+	}
+
+	var ids []image.ImageId
+	for info := range h.source.ListInfos(dirs, options) {
+		ids = append(ids, info.Id)
+	}
+	return ids, nil
+}
+
+// photo returns the photo shown at the index and the index it was found
+// at, skipping videos
+func (h *Handler) photo(s slideshow, ids []image.ImageId, index int) (image.ImageId, int, bool) {
+	for i := 0; i < len(ids); i++ {
+		id := ids[s.at(index+i, len(ids))]
+		path, err := h.source.GetImagePath(id)
+		if err != nil || h.source.IsSupportedVideo(path) {
+			continue
+		}
+		return id, index + i, true
+	}
+	return 0, 0, false
+}
+
+func (h *Handler) servePage(w http.ResponseWriter, r *http.Request) {
+	s, err := parse(h.config, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, err := h.ids(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	interval, _ := s.interval()
+	page := page{
+		Fit:     s.Fit,
+		Seconds: int(interval.Seconds()),
+		Next:    fmt.Sprintf("%s/?%s", h.prefix, s.query(0)),
+	}
+	photoUrl := func(id image.ImageId) string {
+		return fmt.Sprintf("%s/photos/%d.jpg?width=%d&height=%d", h.prefix, id, s.Width, s.Height)
+	}
+	if id, index, ok := h.photo(s, ids, s.Index); ok {
+		page.Photo = photoUrl(id)
+		page.Next = fmt.Sprintf("%s/?%s", h.prefix, s.query(index+1))
+		if next, _, ok := h.photo(s, ids, index+1); ok && next != id {
+			page.Prefetch = photoUrl(next)
+		}
+		if s.Caption {
+			info := h.source.GetInfo(id)
+			if info.DateTime.After(time.Unix(0, 0)) {
+				page.Caption = info.DateTime.Format("2 January 2006")
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := pageTemplate.Execute(w, page); err != nil {
+		serverLog.Error("unable to render kiosk page", "err", err)
+	}
+}
+
+func (h *Handler) servePhoto(w http.ResponseWriter, r *http.Request, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	size := image.Size{X: h.config.withDefaults().Width, Y: h.config.withDefaults().Height}
+	q := r.URL.Query()
+	if v, err := strconv.Atoi(q.Get("width")); err == nil && v > 0 && v <= maxSize {
+		size.X = v
+	}
+	if v, err := strconv.Atoi(q.Get("height")); err == nil && v > 0 && v <= maxSize {
+		size.Y = v
+	}
+
+	img, err := h.source.LoadImage(r.Context(), image.ImageId(id), size)
+	if err == image.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	img = image.FitInside(img, size)
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+}
@@ -0,0 +1,68 @@
+package kiosk
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	config := Config{Interval: "1m", Order: OrderNewest}
+
+	s, err := parse(config, url.Values{"collection": {"vacation"}, "index": {"3"}, "seed": {"42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Interval != "1m" || s.Order != OrderNewest || s.Width != 1920 || s.Fit != FitContain || s.Index != 3 {
+		t.Errorf("unexpected slideshow %+v", s)
+	}
+
+	// The next page keeps the state of the slideshow
+	q, _ := url.ParseQuery(s.query(4))
+	next, err := parse(Config{}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Index = 4
+	if next != s {
+		t.Errorf("expected %+v, got %+v", s, next)
+	}
+
+	for _, q := range []url.Values{
+		{},
+		{"collection": {"a"}, "order": {"sideways"}},
+		{"collection": {"a"}, "interval": {"0s"}},
+		{"collection": {"a"}, "width": {"-1"}},
+		{"collection": {"a"}, "width": {"100000"}},
+		{"tag": {"a"}, "seed": {"x"}},
+	} {
+		if _, err := parse(config, q); err == nil {
+			t.Errorf("expected error for %v", q)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	s := slideshow{Config: Config{Order: OrderRandom}, Seed: 1}
+	count := 10
+	for round := 0; round < 3; round++ {
+		seen := make([]int, 0, count)
+		for i := 0; i < count; i++ {
+			seen = append(seen, s.at(round*count+i, count))
+		}
+		sort.Ints(seen)
+		for i, v := range seen {
+			if v != i {
+				t.Fatalf("round %d: expected each photo once, got %v", round, seen)
+			}
+		}
+	}
+	if s.at(3, count) != s.at(3, count) {
+		t.Errorf("expected stable order")
+	}
+
+	s.Order = OrderNewest
+	if s.at(12, count) != 2 {
+		t.Errorf("expected wrap around, got %d", s.at(12, count))
+	}
+}
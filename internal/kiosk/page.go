@@ -0,0 +1,35 @@
+package kiosk
+
+import (
+	"html/template"
+)
+
+type page struct {
+	Photo    string
+	Prefetch string
+	Caption  string
+	Fit      string
+	Seconds  int
+	Next     string
+}
+
+var pageTemplate = template.Must(template.New("kiosk").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="{{.Seconds}}; url={{.Next}}">
+<title>Photofield</title>
+{{if .Prefetch}}<link rel="prefetch" href="{{.Prefetch}}">{{end}}
+<style>
+html, body { margin: 0; height: 100%; background: #000; overflow: hidden; cursor: none; }
+img { display: block; width: 100vw; height: 100vh; object-fit: {{.Fit}}; }
+.caption { position: fixed; right: 2vw; bottom: 2vh; color: #fff; font: 3vh sans-serif; text-shadow: 0 0 0.5vh #000; opacity: 0.8; }
+</style>
+</head>
+<body>
+{{if .Photo}}<img src="{{.Photo}}" alt="">{{else}}<div class="caption">No photos</div>{{end}}
+{{if .Caption}}<div class="caption">{{.Caption}}</div>{{end}}
+</body>
+</html>
+`))
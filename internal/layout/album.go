@@ -3,7 +3,6 @@ package layout
 import (
 	// . "photofield/internal"
 
-	"log"
 	"photofield/internal/image"
 	"photofield/internal/metrics"
 	"photofield/internal/render"
@@ -74,8 +73,8 @@ func LayoutAlbumEvent(layout Layout, rect render.Rect, event *AlbumEvent, scene
 
 func LayoutAlbum(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
 
-	layout.ImageSpacing = 0.02 * layout.ImageHeight
-	layout.LineSpacing = 0.02 * layout.ImageHeight
+	layout.ImageSpacing = layout.spacing()
+	layout.LineSpacing = layout.spacing()
 
 	sceneMargin := 10.
 
@@ -142,7 +141,7 @@ func LayoutAlbum(infos <-chan image.SourcedInfo, layout Layout, scene *render.Sc
 		eventCount++
 	}
 
-	log.Printf("layout events %d\n", eventCount)
+	renderLog.Info("layout events", "count", eventCount)
 
 	scene.Bounds.H = rect.Y + sceneMargin
 	scene.RegionSource = PhotoRegionSource{
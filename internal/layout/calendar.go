@@ -2,223 +2,176 @@ package layout
 
 import (
 	"image/color"
-	"log"
-	"photofield/internal/image"
-	"photofield/internal/render"
+	"math"
 	"time"
-)
 
-type Hour struct {
-	Section
-	Number int
-	Bounds render.Rect
-}
+	"github.com/tdewolff/canvas"
 
-type Day struct {
-	Section
-	Number int
-	Bounds render.Rect
-	Hours  map[int]*Hour
-}
+	"photofield/internal/image"
+	"photofield/internal/metrics"
+	"photofield/internal/render"
+)
 
-type Week struct {
-	Number int
-	Bounds render.Rect
-	Days   map[int]Day
+// CalendarMonth is a month with photos, laid out as a grid of weeks
+type CalendarMonth struct {
+	Year  int
+	Month time.Month
+	// Photos of each day of the month, indexed by day
+	Days [32]Section
 }
 
-func getColumnBounds(value int, total int, spacing float64, bounds render.Rect) render.Rect {
-	return render.Rect{
-		X: bounds.X,
-		Y: bounds.Y + float64(value)/float64(total)*(bounds.H+spacing),
-		W: bounds.W,
-		H: 1.0 / float64(total) * (bounds.H - spacing),
+// LayoutCalendarMonth lays out the month as a header followed by a grid of
+// weeks starting on Monday, with the photos of each day in its cell. Rows
+// of weeks are as tall as their busiest day, so days with many photos get
+// more space and are easier to see once zoomed in.
+func LayoutCalendarMonth(layout Layout, rect render.Rect, month *CalendarMonth, scene *render.Scene, source *image.Source) render.Rect {
+	headerFont := scene.Fonts.Main.Face(60, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	labelFont := scene.Fonts.Main.Face(30, canvas.Gray, canvas.FontRegular, canvas.FontNormal)
+	dayFont := scene.Fonts.Main.Face(30, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	scene.Texts = append(scene.Texts, render.NewTextFromRect(
+		render.Rect{X: rect.X, Y: rect.Y, W: rect.W, H: 40},
+		&headerFont,
+		time.Date(month.Year, month.Month, 1, 0, 0, 0, 0, time.UTC).Format("January 2006"),
+	))
+	rect.Y += 40 + 10
+
+	spacing := layout.ImageSpacing * 4
+	cellWidth := (rect.W - spacing*6) / 7
+	cellX := func(weekday int) float64 {
+		return rect.X + float64(weekday)*(cellWidth+spacing)
 	}
-}
 
-func getRowBounds(value int, total int, spacing float64, bounds render.Rect) render.Rect {
-	return render.Rect{
-		X: bounds.X + float64(value)/float64(total)*(bounds.W),
-		Y: bounds.Y,
-		W: 1.0 / float64(total) * (bounds.W - spacing),
-		H: bounds.H,
+	monday := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for weekday := 0; weekday < 7; weekday++ {
+		scene.Texts = append(scene.Texts, render.NewTextFromRect(
+			render.Rect{X: cellX(weekday), Y: rect.Y, W: cellWidth, H: 20},
+			&labelFont,
+			monday.AddDate(0, 0, weekday).Format("Mon"),
+		))
 	}
-}
-
-func LayoutCalendar(config *render.Render, scene *render.Scene, source *image.Source) {
-
-	// imageWidth := 120.
-	photoCount := len(scene.Photos)
-
-	// sort.Slice(scene.Photos, func(i, j int) bool {
-	// 	a := source.GetInfo(scene.Photos[i].GetPath(source))
-	// 	b := source.GetInfo(scene.Photos[i].GetPath(source))
-	// 	return a.DateTime.Before(b.DateTime)
-	// })
-
-	// imageWidth := 200.
-	// imageHeight := 160.
-	imageHeight := 300.
-	// imageHeight := 50.
-	// imageSpacing := 6.
-	// lineSpacing := 6.
-	sceneMargin := 10.
-
-	scene.Bounds.W = 2000
-
-	// cols := int(scene.size.width/(imageWidth+margin)) - 2
-
-	log.Println("layout")
-	lastLogTime := time.Now()
-
-	// weeks := make(map[int]Week)
-
-	// var lastHour *Hour
-
-	var week *Week
-	var day *Day
-	var hour *Hour
-
-	// x := sceneMargin
-	y := sceneMargin
-	for i := range scene.Photos {
-		photo := &scene.Photos[i]
-		info := source.GetInfo(scene.Photos[i].Id)
-		dateTime := info.DateTime
-
-		_, weekNum := info.DateTime.ISOWeek()
-
-		// lastWeek := week
-
-		if week == nil || week.Number != weekNum {
-			week = &Week{
-				Number: weekNum,
-				Bounds: getColumnBounds(weekNum, 1, 30, render.Rect{
-					X: sceneMargin,
-					Y: sceneMargin,
-					W: scene.Bounds.W - sceneMargin*2,
-					H: imageHeight,
-				}),
-				// Bounds: render.Rect{
-				// 	X: sceneMargin,
-				// 	Y: -1,
-				// 	W: scene.Bounds.Width - sceneMargin*2,
-				// 	H: imageHeight,
-				// },
+	rect.Y += 20 + 10
+
+	labelHeight := 20.
+	padding := cellWidth * 0.03
+	cellLayout := layout
+	cellLayout.ImageHeight = (cellWidth - padding*2) / 4
+	cellLayout.ImageSpacing = cellLayout.ImageHeight * 0.04
+	cellLayout.LineSpacing = cellLayout.ImageSpacing
+	minHeight := labelHeight + padding*2 + cellLayout.ImageHeight
+
+	first := time.Date(month.Year, month.Month, 1, 0, 0, 0, 0, time.UTC)
+	days := first.AddDate(0, 1, -1).Day()
+	weekday := (int(first.Weekday()) + 6) % 7
+	cells := make([]render.Rect, 0, 7)
+	for day := 1; day <= days; day++ {
+		cell := render.Rect{
+			X: cellX(weekday),
+			Y: rect.Y,
+			W: cellWidth,
+			H: minHeight,
+		}
+		section := &month.Days[day]
+		if len(section.infos) > 0 {
+			// Laid out at the left edge, as rows are fit to the width
+			// including the offset, and moved into the cell after
+			start := len(scene.Photos)
+			bounds := addSectionToScene(section, scene, render.Rect{
+				Y: cell.Y + padding + labelHeight,
+				W: cell.W - padding*2,
+			}, cellLayout, source)
+			for i := start; i < len(scene.Photos); i++ {
+				scene.Photos[i].Sprite.Rect.X += cell.X + padding
 			}
-			// y += imageHeight
-			// scene.Solids = append(scene.Solids, NewSolidFromRect(week.Bounds, color.Gray{Y: 0xFA}))
-			// scene.Texts = append(scene.Texts, NewHeaderFromRect(week.Bounds, &headerFont,
-			// 	fmt.Sprintf("CW %d", weekNum),
-			// ))
+			cell.H = math.Max(cell.H, labelHeight+padding*2+bounds.H-cellLayout.LineSpacing)
 		}
-
-		dayNum := int(dateTime.Day())
-		if day == nil || day.Number != dayNum {
-			weekdayNum := int(dateTime.Weekday()+6) % 7
-
-			// if day != nil {
-			// 	sectionEnd := layoutSection(&day.Section, day.Bounds, 20, source)
-			// 	if sectionEnd.Y > lastWeek.Bounds.Y+lastWeek.Bounds.H {
-			// 		lastWeek.Bounds.H = sectionEnd.Y - lastWeek.Bounds.Y
-			// 	}
-			// }
-			// if week.Bounds.Y == -1 {
-			// 	if lastWeek != nil {
-			// 		week.Bounds.Y = lastWeek.Bounds.Y + lastWeek.Bounds.H
-			// 	} else {
-			// 		week.Bounds.Y = sceneMargin
-			// 	}
-			// }
-
-			day = &Day{
-				Number: dayNum,
-				Bounds: getRowBounds(weekdayNum, 7, 20, week.Bounds),
+		scene.Texts = append(scene.Texts, render.NewTextFromRect(
+			render.Rect{X: cell.X + padding, Y: cell.Y + padding, W: cell.W, H: labelHeight},
+			&dayFont,
+			first.AddDate(0, 0, day-1).Format("2"),
+		))
+		cells = append(cells, cell)
+
+		weekday++
+		if weekday == 7 || day == days {
+			rowHeight := 0.
+			for _, c := range cells {
+				rowHeight = math.Max(rowHeight, c.H)
 			}
-
-			scene.Solids = append(scene.Solids, render.NewSolidFromRect(day.Bounds, color.Gray{Y: 0xF0}))
-			dayNum := dateTime.Day()
-			dayFormat := "2"
-			if dayNum == 1 {
-				dayFormat = "2 Jan"
+			for _, c := range cells {
+				c.H = rowHeight
+				scene.Solids = append(scene.Solids, render.NewSolidFromRect(c, color.Gray{Y: 0xF4}))
 			}
-			scene.Texts = append(scene.Texts, render.NewTextFromRect(day.Bounds, &scene.Fonts.Header,
-				dateTime.Format(dayFormat),
-			))
+			cells = cells[:0]
+			weekday = 0
+			rect.Y += rowHeight + spacing
 		}
-		// day.photos = append(day.photos, photo)
+	}
+	rect.Y += 40
+	return rect
+}
 
-		hourNum := dateTime.Hour()
-		if hour == nil || hour.Number != hourNum {
+// LayoutCalendar lays out the photos by day in monthly calendars, leaving
+// out months without photos
+func LayoutCalendar(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
 
-			hour = &Hour{
-				Number: hourNum,
-				Bounds: getColumnBounds(hourNum, 24, 10, day.Bounds),
-			}
+	layout.ImageSpacing = 0.02 * layout.ImageHeight
+	layout.LineSpacing = 0.02 * layout.ImageHeight
+	if layout.ImageSpacing == 0 {
+		layout.ImageSpacing = 2
+	}
 
-			hourBoundsIndent := 24.
-			hourBoundsOriginal := hour.Bounds
-			hour.Bounds.X += hourBoundsIndent
-			hour.Bounds.W -= hourBoundsIndent
+	sceneMargin := 10.
 
-			scene.Solids = append(scene.Solids, render.NewSolidFromRect(hour.Bounds, color.Gray{Y: 0xE0}))
-			scene.Texts = append(scene.Texts, render.NewTextFromRect(hourBoundsOriginal.Move(render.Point{X: 2, Y: 0}), &scene.Fonts.Hour,
-				dateTime.Format("15:00"),
-			))
+	scene.Bounds.W = layout.ViewportWidth
 
-			// if hour != nil {
-			// 	layoutSection(&hour.Section, hour.Bounds, hour.Bounds.H/3, source)
-			// }
-		}
-		// hour.photos = append(hour.photos, photo)
-
-		minuteBounds := getRowBounds(dateTime.Minute(), 60, 0, hour.Bounds)
-		// secondBounds := getColumnBounds(dateTime.Second()/10, 60/10, 0, minuteBounds)
-
-		// secondBounds := getRowBounds(dateTime.Minute()*60+dateTime.Second(), 60*60, 0, hour.Bounds)
-
-		photoBounds := minuteBounds
-
-		photo.Sprite.PlaceFit(
-			photoBounds.X,
-			photoBounds.Y,
-			photoBounds.W,
-			photoBounds.H,
-			float64(info.Width),
-			float64(info.Height),
-		)
-
-		// photo.Original.Sprite.PlaceFitHeight(
-		// 	weekdayBounds.X,
-		// 	weekdayBounds.Y,
-		// 	weekdayBounds.H,
-		// 	float64(size.X),
-		// 	float64(size.Y),
-		// )
-
-		if day.Bounds.Y+week.Bounds.H > y {
-			y = day.Bounds.Y + week.Bounds.H
-		}
+	rect := render.Rect{
+		X: sceneMargin,
+		Y: sceneMargin + 64,
+		W: scene.Bounds.W - sceneMargin*2,
+		H: 0,
+	}
 
-		// photo.Place(x, y, imageWidth, imageHeight, source)
-		// photo.Original.Sprite.PlaceFitHeight(x, y, imageHeight, float64(size.X), float64(size.Y))
+	scene.Solids = make([]render.Solid, 0)
+	scene.Texts = make([]render.Text, 0)
+	scene.Photos = scene.Photos[:0]
 
-		// x += imageWidth + imageSpacing
-		// if x+imageWidth+imageSpacing > scene.Size.Width {
-		// 	x = sceneMargin
-		// 	y += imageHeight + lineSpacing
-		// }
+	layoutPlaced := metrics.Elapsed("layout placing")
+	layoutCounter := metrics.Counter{
+		Name:     "layout",
+		Interval: 1 * time.Second,
+	}
 
-		now := time.Now()
-		if now.Sub(lastLogTime) > 10000*time.Second {
-			lastLogTime = now
-			log.Printf("layout %d / %d\n", i, photoCount)
+	var month *CalendarMonth
+	monthCount := 0
+	index := 0
+	for info := range infos {
+		year, m, day := info.DateTime.Date()
+		if month == nil || month.Year != year || month.Month != m {
+			if month != nil {
+				rect = LayoutCalendarMonth(layout, rect, month, scene, source)
+			}
+			month = &CalendarMonth{
+				Year:  year,
+				Month: m,
+			}
+			monthCount++
 		}
-	}
+		month.Days[day].infos = append(month.Days[day].infos, info)
 
-	// x = sceneMargin
-	// y += imageHeight + lineSpacing
+		layoutCounter.Set(index)
+		index++
+		scene.FileCount = index
+	}
+	if month != nil {
+		rect = LayoutCalendarMonth(layout, rect, month, scene, source)
+	}
+	layoutPlaced()
 
-	scene.Bounds.H = y + sceneMargin
+	renderLog.Info("layout calendar months", "count", monthCount)
 
+	scene.Bounds.H = rect.Y + sceneMargin
+	scene.RegionSource = PhotoRegionSource{
+		Source: source,
+	}
 }
@@ -3,9 +3,10 @@ package layout
 import (
 	"context"
 	"fmt"
-	"log"
+	"math"
 	"path/filepath"
 	"photofield/internal/image"
+	"photofield/internal/logging"
 	"photofield/internal/render"
 	"photofield/io"
 	"photofield/tag"
@@ -14,15 +15,20 @@ import (
 	"time"
 )
 
+var renderLog = logging.Module("render")
+
 type Type string
 
 const (
-	Album    Type = "ALBUM"
-	Timeline Type = "TIMELINE"
-	Square   Type = "SQUARE"
-	Wall     Type = "WALL"
-	Search   Type = "SEARCH"
-	Strip    Type = "STRIP"
+	Album      Type = "ALBUM"
+	Timeline   Type = "TIMELINE"
+	Square     Type = "SQUARE"
+	Wall       Type = "WALL"
+	Search     Type = "SEARCH"
+	Strip      Type = "STRIP"
+	Map        Type = "MAP"
+	Calendar   Type = "CALENDAR"
+	Highlights Type = "HIGHLIGHTS"
 )
 
 type Order int
@@ -44,6 +50,19 @@ func OrderFromSort(s string) Order {
 	}
 }
 
+// Panorama is how panoramas are laid out in justified rows
+type Panorama string
+
+const (
+	// Panoramas are placed in rows like any other photo
+	PanoramaInline Panorama = "INLINE"
+	// Panoramas are placed in rows of their own, spanning the full width
+	PanoramaRow Panorama = "ROW"
+)
+
+// Photos at least this many times wider than tall are panoramas
+const panoramaAspectRatio = 2.5
+
 type Layout struct {
 	Type           Type  `json:"type"`
 	Order          Order `json:"order"`
@@ -52,6 +71,25 @@ type Layout struct {
 	ImageHeight    float64
 	ImageSpacing   float64
 	LineSpacing    float64
+
+	// Spacing between photos and rows, 2% of the image height if not set
+	Spacing *float64 `json:"spacing,omitempty"`
+	// How much the height of a justified row may differ from the image
+	// height, as a fraction of it. Rows end where their height is closest
+	// to the image height, and rows that would differ by more are not
+	// stretched to the full width. If zero, rows end before the photo that
+	// does not fit anymore and are stretched as much as needed.
+	MaxRowSlop float64 `json:"max_row_slop,omitempty"`
+	// How panoramas are laid out, inline if not set
+	Panorama Panorama `json:"panorama,omitempty"`
+}
+
+// spacing returns the spacing between photos and rows of justified layouts
+func (layout Layout) spacing() float64 {
+	if layout.Spacing != nil {
+		return *layout.Spacing
+	}
+	return 0.02 * layout.ImageHeight
 }
 
 type Section struct {
@@ -86,6 +124,12 @@ type RegionTag struct {
 	Id string `json:"id"`
 }
 
+type RegionChapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title,omitempty"`
+}
+
 type PhotoRegionData struct {
 	Id         int               `json:"id"`
 	Path       string            `json:"path"`
@@ -97,6 +141,21 @@ type PhotoRegionData struct {
 	CreatedAt  string            `json:"created_at"`
 	Thumbnails []RegionThumbnail `json:"thumbnails"`
 	Tags       []tag.Tag         `json:"tags"`
+	// Caption, either embedded in the metadata or edited
+	Caption string `json:"caption,omitempty"`
+	// Duration in seconds, codec, frames per second and chapters of videos
+	Duration  float64         `json:"duration,omitempty"`
+	Codec     string          `json:"codec,omitempty"`
+	FrameRate float64         `json:"frame_rate,omitempty"`
+	Chapters  []RegionChapter `json:"chapters,omitempty"`
+	// Audio recorded alongside the file, with its duration in seconds if
+	// known
+	Audio         bool    `json:"audio,omitempty"`
+	AudioDuration float64 `json:"audio_duration,omitempty"`
+	// Motion photo with an embedded video
+	Motion bool `json:"motion,omitempty"`
+	// Projection of 360° photos, e.g. equirectangular
+	Projection string `json:"projection,omitempty"`
 	// SmallestThumbnail     string   `json:"smallest_thumbnail"`
 }
 
@@ -156,21 +215,51 @@ func (regionSource PhotoRegionSource) getRegionFromPhoto(id int, photo *render.P
 		tags = append(tags, tag)
 	}
 
+	data := PhotoRegionData{
+		Id:         int(photo.Id),
+		Path:       originalPath,
+		Filename:   filename,
+		Extension:  extension,
+		Video:      isVideo,
+		Width:      info.Width,
+		Height:     info.Height,
+		CreatedAt:  info.DateTime.Format(time.RFC3339),
+		Thumbnails: thumbnails,
+		Tags:       tags,
+		Caption:    info.Description,
+	}
+
+	if isVideo {
+		if video, ok := source.GetVideo(photo.Id); ok {
+			data.Duration = video.Duration.Seconds()
+			data.Codec = video.Codec
+			data.FrameRate = video.FrameRate
+			for _, c := range video.Chapters {
+				data.Chapters = append(data.Chapters, RegionChapter{
+					Start: c.Start.Seconds(),
+					End:   c.End.Seconds(),
+					Title: c.Title,
+				})
+			}
+		}
+	}
+
+	if audio, ok := source.GetAudio(photo.Id); ok {
+		data.Audio = true
+		data.AudioDuration = audio.Duration.Seconds()
+	}
+
+	if !isVideo {
+		_, data.Motion = source.GetMotionPhoto(photo.Id)
+		if p, ok := source.GetProjection(photo.Id); ok {
+			data.Projection = p.Type
+		}
+	}
+
 	return render.Region{
 		Id:     id,
 		Bounds: photo.Sprite.Rect,
-		Data: PhotoRegionData{
-			Id:         int(photo.Id),
-			Path:       originalPath,
-			Filename:   filename,
-			Extension:  extension,
-			Video:      isVideo,
-			Width:      info.Width,
-			Height:     info.Height,
-			CreatedAt:  info.DateTime.Format(time.RFC3339),
-			Thumbnails: thumbnails,
-			Tags:       tags,
-		},
+		Data:   data,
 	}
 }
 
@@ -212,6 +301,12 @@ func (regionSource PhotoRegionSource) GetRegionById(id int, scene *render.Scene,
 }
 
 func layoutFitRow(row []SectionPhoto, bounds render.Rect, imageSpacing float64) float64 {
+	return layoutFitRowMax(row, bounds, imageSpacing, math.Inf(1))
+}
+
+// layoutFitRowMax scales the row to fit the width of the bounds, but by no
+// more than the max scale
+func layoutFitRowMax(row []SectionPhoto, bounds render.Rect, imageSpacing float64, maxScale float64) float64 {
 	count := len(row)
 	if count == 0 {
 		return 1.
@@ -224,6 +319,9 @@ func layoutFitRow(row []SectionPhoto, bounds render.Rect, imageSpacing float64)
 
 	rowWidth := lastRect.X + lastRect.W
 	scale := (bounds.W - totalSpacing) / (rowWidth - totalSpacing)
+	if scale > maxScale {
+		scale = maxScale
+	}
 	x := firstRect.X
 	for i := range row {
 		photo := &row[i]
@@ -266,8 +364,58 @@ func addSectionToScene(section *Section, scene *render.Scene, bounds render.Rect
 		aspectRatio := float64(photo.Size.X) / float64(photo.Size.Y)
 		imageWidth := float64(config.ImageHeight) * aspectRatio
 
+		if config.Panorama == PanoramaRow && aspectRatio >= panoramaAspectRatio {
+			// The row so far is left as it is, as it is not full
+			if len(row) > 0 {
+				for _, p := range row {
+					scene.Photos = append(scene.Photos, p.Photo)
+				}
+				row = nil
+				x = 0
+				y += config.ImageHeight + config.LineSpacing
+			}
+			photo.Photo.Sprite.PlaceFitHeight(
+				bounds.X,
+				bounds.Y+y,
+				bounds.W/aspectRatio,
+				float64(photo.Size.X),
+				float64(photo.Size.Y),
+			)
+			scene.Photos = append(scene.Photos, photo.Photo)
+			y += photo.Photo.Sprite.Rect.H + config.LineSpacing
+			i++
+			continue
+		}
+
 		if x+imageWidth > bounds.W {
-			scale := layoutFitRow(row, bounds, config.ImageSpacing)
+			maxScale := math.Inf(1)
+			if config.MaxRowSlop > 0 {
+				maxScale = 1 + config.MaxRowSlop
+				// Ending the row after the photo shrinks it instead
+				count := float64(len(row) + 1)
+				shrink := (bounds.W - (count-1)*config.ImageSpacing) / (x + imageWidth - (count-1)*config.ImageSpacing)
+				grow := (bounds.W - (count-2)*config.ImageSpacing) / (x - config.ImageSpacing - (count-2)*config.ImageSpacing)
+				if len(row) == 0 || (shrink >= 1-config.MaxRowSlop && (1/shrink < grow || grow > maxScale)) {
+					photo.Photo.Sprite.PlaceFitHeight(
+						bounds.X+x,
+						bounds.Y+y,
+						config.ImageHeight,
+						float64(photo.Size.X),
+						float64(photo.Size.Y),
+					)
+					row = append(row, photo)
+					scale := layoutFitRowMax(row, bounds, config.ImageSpacing, maxScale)
+					for _, p := range row {
+						scene.Photos = append(scene.Photos, p.Photo)
+					}
+					row = nil
+					x = 0
+					y += config.ImageHeight*scale + config.LineSpacing
+					i++
+					continue
+				}
+			}
+			scale := layoutFitRowMax(row, bounds, config.ImageSpacing, maxScale)
 			for _, p := range row {
 				scene.Photos = append(scene.Photos, p.Photo)
 			}
@@ -293,7 +441,7 @@ func addSectionToScene(section *Section, scene *render.Scene, bounds render.Rect
 		now := time.Now()
 		if now.Sub(lastLogTime) > 1*time.Second {
 			lastLogTime = now
-			log.Printf("layout section %d\n", i)
+			renderLog.Info("layout section", "index", i)
 		}
 		i++
 	}
@@ -310,6 +458,8 @@ func addSectionToScene(section *Section, scene *render.Scene, bounds render.Rect
 	}
 }
 
+// SameDay reports whether a and b fall on the same calendar day, each in the
+// local time of its own timezone offset
 func SameDay(a, b time.Time) bool {
 	y1, m1, d1 := a.Date()
 	y2, m2, d2 := b.Date()
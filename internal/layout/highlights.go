@@ -0,0 +1,364 @@
+package layout
+
+import (
+	"context"
+	goimage "image"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tdewolff/canvas"
+
+	"photofield/internal/clip"
+	"photofield/internal/image"
+	"photofield/internal/metrics"
+	"photofield/internal/render"
+)
+
+// Size of the thumbnails that sharpness and exposure are measured on
+const highlightThumbnailSize = 256
+
+// Prompts that the embeddings of photos are compared against to estimate
+// how good they look
+const (
+	highlightPositivePrompt = "a beautiful, well composed, high quality photo"
+	highlightNegativePrompt = "a blurry, badly composed, low quality photo"
+)
+
+// Tag of favorite photos, which are always highlighted
+const favoriteTag = "fav"
+
+type highlight struct {
+	info      image.SourcedInfo
+	sharpness float64
+	exposure  float64
+	aesthetic float64
+	favorite  bool
+	score     float64
+}
+
+// measureQuality returns the sharpness of the image as the variance of its
+// Laplacian and how well exposed it is from 0 to 1, lower for images that
+// are too dark, too bright or have many clipped pixels
+func measureQuality(img goimage.Image) (sharpness float64, exposure float64) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 3 || h < 3 {
+		return 0, 0
+	}
+	lum := make([]float64, w*h)
+	sum := 0.
+	clipped := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			l := (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+			lum[y*w+x] = l
+			sum += l
+			if l < 0.02 || l > 0.98 {
+				clipped++
+			}
+		}
+	}
+	mean := sum / float64(w*h)
+	exposure = (1 - math.Abs(mean-0.5)*2) * (1 - float64(clipped)/float64(w*h))
+
+	var lsum, lsum2 float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			l := lum[i-w] + lum[i+w] + lum[i-1] + lum[i+1] - 4*lum[i]
+			lsum += l
+			lsum2 += l * l
+			n++
+		}
+	}
+	lmean := lsum / float64(n)
+	sharpness = lsum2/float64(n) - lmean*lmean
+	return sharpness, exposure
+}
+
+// rankNormalize replaces the values with their percentile among them
+func rankNormalize(highlights []highlight, value func(h *highlight) *float64) {
+	if len(highlights) < 2 {
+		for i := range highlights {
+			*value(&highlights[i]) = 0.5
+		}
+		return
+	}
+	order := make([]int, len(highlights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return *value(&highlights[order[i]]) < *value(&highlights[order[j]])
+	})
+	for rank, i := range order {
+		*value(&highlights[i]) = float64(rank) / float64(len(order)-1)
+	}
+}
+
+// scoreHighlights scores the photos by their sharpness, exposure, how good
+// they look according to their embeddings and whether they are favorites
+func scoreHighlights(highlights []highlight, source *image.Source) {
+	var favorites image.Ids
+	if id, ok := source.GetTagId(favoriteTag); ok {
+		favorites = source.GetTagImageIds(id)
+	}
+
+	var positive, negative clip.Embedding
+	if source.Clip != nil {
+		var err error
+		positive, err = source.Clip.EmbedText(highlightPositivePrompt)
+		if err == nil {
+			negative, err = source.Clip.EmbedText(highlightNegativePrompt)
+		}
+		if err != nil {
+			renderLog.Warn("highlights unable to embed prompts, leaving out aesthetics", "err", err)
+			positive, negative = nil, nil
+		}
+	}
+	similarity := func(text clip.Embedding, emb clip.Embedding) float64 {
+		dot, err := clip.DotProductFloat32Float(text.Float32(), emb.Float())
+		if err != nil {
+			return 0
+		}
+		return float64(dot * text.InvNormFloat32() * emb.InvNormFloat32())
+	}
+
+	measured := metrics.Elapsed("highlights measure")
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				h := &highlights[i]
+				h.favorite = favorites != nil && favorites.Contains(int(h.info.Id))
+				h.exposure = 0.5
+				img, err := source.LoadImage(context.Background(), h.info.Id, image.Size{
+					X: highlightThumbnailSize,
+					Y: highlightThumbnailSize,
+				})
+				if err == nil {
+					h.sharpness, h.exposure = measureQuality(img)
+				}
+				if positive != nil {
+					if emb, err := source.GetImageEmbedding(h.info.Id); err == nil && emb != nil {
+						h.aesthetic = similarity(positive, emb) - similarity(negative, emb)
+					}
+				}
+			}
+		}()
+	}
+	for i := range highlights {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	measured()
+
+	rankNormalize(highlights, func(h *highlight) *float64 { return &h.sharpness })
+	if positive != nil {
+		rankNormalize(highlights, func(h *highlight) *float64 { return &h.aesthetic })
+	}
+	for i := range highlights {
+		h := &highlights[i]
+		if positive != nil {
+			h.score = 0.35*h.sharpness + 0.25*h.exposure + 0.4*h.aesthetic
+		} else {
+			h.score = 0.6*h.sharpness + 0.4*h.exposure
+		}
+		if h.favorite {
+			h.score += 1
+		}
+	}
+}
+
+// highlightTiers ranks the photos of the day by score into the best one
+// (0), featured ones (1), small ones (2) and left out ones (3), returning
+// the tier of each photo and the index of the best one
+func highlightTiers(day []highlight) (tier []int, best int) {
+	ranked := make([]int, len(day))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return day[ranked[i]].score > day[ranked[j]].score
+	})
+	featured := int(math.Ceil(math.Sqrt(float64(len(day)))))
+	small := (len(day) - featured) / 2
+	tier = make([]int, len(day))
+	for rank, i := range ranked {
+		switch {
+		case rank == 0:
+			tier[i] = 0
+		case rank < featured:
+			tier[i] = 1
+		case rank < featured+small:
+			tier[i] = 2
+		default:
+			tier[i] = 3
+		}
+	}
+	return tier, ranked[0]
+}
+
+// FilterHighlights returns the photos that the highlights layout would show,
+// leaving out the worst ones of each day. The infos need to be sorted by
+// date.
+func FilterHighlights(infos []image.SourcedInfo, source *image.Source) []image.SourcedInfo {
+	highlights := make([]highlight, 0, len(infos))
+	for _, info := range infos {
+		highlights = append(highlights, highlight{info: info})
+	}
+	scoreHighlights(highlights, source)
+
+	var filtered []image.SourcedInfo
+	start := 0
+	for i := 1; i <= len(highlights); i++ {
+		if i < len(highlights) && SameDay(highlights[i].info.DateTime, highlights[start].info.DateTime) {
+			continue
+		}
+		day := highlights[start:i]
+		tier, _ := highlightTiers(day)
+		for j, h := range day {
+			if tier[j] < 3 || h.favorite {
+				filtered = append(filtered, h.info)
+			}
+		}
+		start = i
+	}
+	return filtered
+}
+
+// FilterFavorites returns the photos tagged as favorites
+func FilterFavorites(infos []image.SourcedInfo, source *image.Source) []image.SourcedInfo {
+	id, ok := source.GetTagId(favoriteTag)
+	if !ok {
+		return nil
+	}
+	favorites := source.GetTagImageIds(id)
+	var filtered []image.SourcedInfo
+	for _, info := range infos {
+		if favorites.Contains(int(info.Id)) {
+			filtered = append(filtered, info)
+		}
+	}
+	return filtered
+}
+
+// layoutHighlightDay lays out the best photo of the day across the full
+// width, the next best ones in rows below and the better half of the rest
+// as small thumbnails, leaving out the others
+func layoutHighlightDay(layout Layout, rect render.Rect, day []highlight, scene *render.Scene, source *image.Source) render.Rect {
+	font := scene.Fonts.Main.Face(70, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	text := render.NewTextFromRect(
+		render.Rect{X: rect.X, Y: rect.Y, W: rect.W, H: 30},
+		&font,
+		day[0].info.DateTime.Format("Monday, Jan 2, 2006"),
+	)
+	scene.Texts = append(scene.Texts, text)
+	rect.Y += text.Sprite.Rect.H + 15
+
+	tier, best := highlightTiers(day)
+
+	// Best photo
+	hero := day[best].info
+	maxHeight := layout.ViewportHeight * 0.8
+	if maxHeight <= 0 {
+		maxHeight = rect.W * 2 / 3
+	}
+	photo := render.Photo{Id: hero.Id}
+	photo.Sprite.PlaceFit(rect.X, rect.Y, rect.W, maxHeight, float64(hero.Width), float64(hero.Height))
+	photo.Sprite.Rect.X += (rect.W - photo.Sprite.Rect.W) / 2
+	scene.Photos = append(scene.Photos, photo)
+	rect.Y += photo.Sprite.Rect.H + layout.LineSpacing
+
+	// Featured and small photos, each in the order they were taken
+	for t, height := range []float64{layout.ImageHeight, layout.ImageHeight / 3} {
+		section := Section{}
+		for i, h := range day {
+			if tier[i] == t+1 {
+				section.infos = append(section.infos, h.info)
+			}
+		}
+		if len(section.infos) == 0 {
+			continue
+		}
+		config := layout
+		config.ImageHeight = height
+		config.ImageSpacing = layout.ImageSpacing * height / layout.ImageHeight
+		config.LineSpacing = config.ImageSpacing
+		bounds := addSectionToScene(&section, scene, rect, config, source)
+		rect.Y = bounds.Y + bounds.H
+	}
+
+	rect.Y += 40
+	return rect
+}
+
+// LayoutHighlights lays out a summary of the photos by day, with the best
+// photos of each day larger and the worst ones left out
+func LayoutHighlights(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
+
+	if layout.ImageHeight <= 0 {
+		layout.ImageHeight = 160
+	}
+	layout.ImageSpacing = layout.spacing()
+	layout.LineSpacing = layout.spacing()
+
+	sceneMargin := 10.
+
+	scene.Bounds.W = layout.ViewportWidth
+
+	rect := render.Rect{
+		X: sceneMargin,
+		Y: sceneMargin + 64,
+		W: scene.Bounds.W - sceneMargin*2,
+		H: 0,
+	}
+
+	scene.Solids = make([]render.Solid, 0)
+	scene.Texts = make([]render.Text, 0)
+	scene.Photos = scene.Photos[:0]
+
+	loadCounter := metrics.Counter{
+		Name:     "load infos",
+		Interval: 1 * time.Second,
+	}
+	var highlights []highlight
+	for info := range infos {
+		if info.Width == 0 || info.Height == 0 {
+			continue
+		}
+		highlights = append(highlights, highlight{info: info})
+		loadCounter.Set(len(highlights))
+	}
+
+	scoreHighlights(highlights, source)
+
+	layoutPlaced := metrics.Elapsed("layout placing")
+	days := 0
+	start := 0
+	for i := 1; i <= len(highlights); i++ {
+		if i < len(highlights) && SameDay(highlights[i].info.DateTime, highlights[start].info.DateTime) {
+			continue
+		}
+		rect = layoutHighlightDay(layout, rect, highlights[start:i], scene, source)
+		start = i
+		days++
+	}
+	layoutPlaced()
+
+	renderLog.Info("layout highlights", "days", days, "photos", len(scene.Photos), "highlights", len(highlights))
+
+	scene.Bounds.H = rect.Y + sceneMargin
+	scene.RegionSource = PhotoRegionSource{
+		Source: source,
+	}
+}
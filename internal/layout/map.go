@@ -0,0 +1,236 @@
+package layout
+
+import (
+	"image/color"
+	"math"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/internal/metrics"
+	"photofield/internal/render"
+)
+
+// Latitude at which Web Mercator is cut off, so that the world is square
+const mercatorMaxLat = 85.05112878
+
+// mercator projects the coordinates to Web Mercator, with the world
+// spanning 0 to 1 from west to east and north to south
+func mercator(lat, lng float64) render.Point {
+	lat = math.Max(-mercatorMaxLat, math.Min(mercatorMaxLat, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+	return render.Point{
+		X: (lng + 180) / 360,
+		Y: 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi),
+	}
+}
+
+type mapCell struct {
+	X, Y int
+}
+
+// mapGrid places photos in cells of the size of a photo, moving photos
+// that would overlap others to the nearest free cell, so that photos taken
+// at the same place cluster around it
+type mapGrid struct {
+	taken map[mapCell]bool
+	// Ring around each cell that the free cells are searched from, as
+	// all the rings within are taken
+	rings map[mapCell]int
+}
+
+func (grid *mapGrid) place(cell mapCell) mapCell {
+	for ring := grid.rings[cell]; ; ring++ {
+		best := cell
+		bestDist := math.Inf(1)
+		for dy := -ring; dy <= ring; dy++ {
+			for dx := -ring; dx <= ring; dx++ {
+				if dx != -ring && dx != ring && dy != -ring && dy != ring {
+					continue
+				}
+				c := mapCell{X: cell.X + dx, Y: cell.Y + dy}
+				if grid.taken[c] {
+					continue
+				}
+				dist := float64(dx*dx + dy*dy)
+				if dist < bestDist {
+					best = c
+					bestDist = dist
+				}
+			}
+		}
+		if !math.IsInf(bestDist, 1) {
+			grid.rings[cell] = ring
+			grid.taken[best] = true
+			return best
+		}
+	}
+}
+
+// LayoutMap places the photos with a location at their position on a Web
+// Mercator map of the area they were taken in, with lines of latitude and
+// longitude for orientation. Photos without a location are left out.
+func LayoutMap(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
+	type located struct {
+		info  image.SourcedInfo
+		point render.Point
+	}
+
+	loadCounter := metrics.Counter{
+		Name:     "load infos",
+		Interval: 1 * time.Second,
+	}
+
+	var photos []located
+	min := render.Point{X: math.Inf(1), Y: math.Inf(1)}
+	max := render.Point{X: math.Inf(-1), Y: math.Inf(-1)}
+	index := 0
+	for info := range infos {
+		loadCounter.Set(index)
+		index++
+		if image.IsNaNLatLng(info.LatLng) || info.Width == 0 || info.Height == 0 {
+			continue
+		}
+		p := mercator(info.LatLng.Lat.Degrees(), info.LatLng.Lng.Degrees())
+		photos = append(photos, located{info: info, point: p})
+		min.X = math.Min(min.X, p.X)
+		min.Y = math.Min(min.Y, p.Y)
+		max.X = math.Max(max.X, p.X)
+		max.Y = math.Max(max.Y, p.Y)
+	}
+
+	sceneMargin := 10.
+	scene.Bounds.W = layout.ViewportWidth
+	scene.Bounds.H = layout.ViewportHeight
+	scene.Solids = make([]render.Solid, 0)
+	scene.Texts = make([]render.Text, 0)
+	scene.Photos = scene.Photos[:0]
+	scene.RegionSource = PhotoRegionSource{
+		Source: source,
+	}
+	if len(photos) == 0 {
+		return
+	}
+
+	cellSize := layout.ImageHeight
+	if cellSize <= 0 {
+		cellSize = 100
+	}
+	spacing := cellSize * 0.05
+
+	// The map is large enough for all photos to fit side by side a few
+	// times over, so that only photos taken close to each other cluster.
+	// Photos taken at a single place still get a bit of the area around.
+	side := math.Max(layout.ViewportWidth, cellSize*math.Sqrt(float64(len(photos)))*4)
+	span := math.Max(max.X-min.X, max.Y-min.Y)
+	minSpan := 1e-4
+	if span < minSpan {
+		center := render.Point{X: (min.X + max.X) / 2, Y: (min.Y + max.Y) / 2}
+		min = render.Point{X: center.X - minSpan/2, Y: center.Y - minSpan/2}
+		max = render.Point{X: center.X + minSpan/2, Y: center.Y + minSpan/2}
+		span = minSpan
+	}
+	scale := side / span
+	offset := render.Point{
+		X: sceneMargin + cellSize - min.X*scale,
+		Y: sceneMargin + cellSize - min.Y*scale,
+	}
+	project := func(p render.Point) render.Point {
+		return render.Point{X: p.X*scale + offset.X, Y: p.Y*scale + offset.Y}
+	}
+
+	layoutPlaced := metrics.Elapsed("layout placing")
+	grid := mapGrid{
+		taken: make(map[mapCell]bool),
+		rings: make(map[mapCell]int),
+	}
+	extent := render.Rect{X: math.Inf(1), Y: math.Inf(1)}
+	right, bottom := math.Inf(-1), math.Inf(-1)
+	for _, p := range photos {
+		at := project(p.point)
+		cell := grid.place(mapCell{
+			X: int(math.Floor(at.X / cellSize)),
+			Y: int(math.Floor(at.Y / cellSize)),
+		})
+		x := float64(cell.X) * cellSize
+		y := float64(cell.Y) * cellSize
+		photo := render.Photo{Id: p.info.Id}
+		photo.Sprite.PlaceFit(x, y, cellSize-spacing, cellSize-spacing, float64(p.info.Width), float64(p.info.Height))
+		// Centered in the cell
+		photo.Sprite.Rect.X += (cellSize - spacing - photo.Sprite.Rect.W) / 2
+		photo.Sprite.Rect.Y += (cellSize - spacing - photo.Sprite.Rect.H) / 2
+		scene.Photos = append(scene.Photos, photo)
+
+		extent.X = math.Min(extent.X, x)
+		extent.Y = math.Min(extent.Y, y)
+		right = math.Max(right, x+cellSize)
+		bottom = math.Max(bottom, y+cellSize)
+	}
+	layoutPlaced()
+
+	// Photos moved out of the way may end up outside of the map area,
+	// so everything is shifted back into the scene
+	shift := render.Point{
+		X: math.Min(0, extent.X-sceneMargin),
+		Y: math.Min(0, extent.Y-sceneMargin),
+	}
+	for i := range scene.Photos {
+		scene.Photos[i].Sprite.Rect.X -= shift.X
+		scene.Photos[i].Sprite.Rect.Y -= shift.Y
+	}
+	offset.X -= shift.X
+	offset.Y -= shift.Y
+	scene.Bounds.W = math.Max(scene.Bounds.W, right-shift.X+sceneMargin)
+	scene.Bounds.H = math.Max(scene.Bounds.H, bottom-shift.Y+sceneMargin)
+
+	addGraticule(scene, span, scale, offset, cellSize)
+
+	renderLog.Info("layout map", "photos", len(scene.Photos), "width", math.Round(scene.Bounds.W), "height", math.Round(scene.Bounds.H))
+}
+
+// addGraticule adds lines of latitude and longitude at round degrees
+// across the scene, a few of them over the span of the map
+func addGraticule(scene *render.Scene, span float64, scale float64, offset render.Point, cellSize float64) {
+	degrees := span * 360
+	step := 90.
+	for _, s := range []float64{45, 30, 10, 5, 2, 1, 0.5, 0.2, 0.1, 0.05, 0.02, 0.01, 0.005, 0.002, 0.001} {
+		if degrees/s > 8 {
+			break
+		}
+		step = s
+	}
+
+	lineColor := color.RGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff}
+	width := math.Max(1, cellSize*0.01)
+
+	// Scene coordinates back to Web Mercator
+	west := (0 - offset.X) / scale
+	east := (scene.Bounds.W - offset.X) / scale
+	north := (0 - offset.Y) / scale
+	south := (scene.Bounds.H - offset.Y) / scale
+
+	for lng := math.Ceil((west*360-180)/step) * step; lng <= east*360-180; lng += step {
+		x := mercator(0, lng).X*scale + offset.X
+		scene.Solids = append(scene.Solids, render.NewSolidFromRect(render.Rect{
+			X: x - width/2,
+			Y: 0,
+			W: width,
+			H: scene.Bounds.H,
+		}, lineColor))
+	}
+
+	latOf := func(y float64) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*y))) * 180 / math.Pi
+	}
+	for lat := math.Ceil(latOf(south)/step) * step; lat <= latOf(north); lat += step {
+		if math.Abs(lat) > mercatorMaxLat {
+			continue
+		}
+		y := mercator(lat, 0).Y*scale + offset.Y
+		scene.Solids = append(scene.Solids, render.NewSolidFromRect(render.Rect{
+			X: 0,
+			Y: y - width/2,
+			W: scene.Bounds.W,
+			H: width,
+		}, lineColor))
+	}
+}
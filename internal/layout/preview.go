@@ -0,0 +1,76 @@
+package layout
+
+import (
+	"math"
+
+	"photofield/internal/image"
+	"photofield/internal/render"
+)
+
+// LayoutPreview lays out the photos as a collage of justified rows fitting
+// the viewport, or a single photo alone, for link previews. All photos are
+// laid out, so the infos are expected to be limited to a few.
+func LayoutPreview(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
+	width, height := layout.ViewportWidth, layout.ViewportHeight
+	scene.Bounds.W = width
+	scene.Bounds.H = height
+
+	var photos []image.SourcedInfo
+	total := 0.
+	for info := range infos {
+		if info.Width == 0 || info.Height == 0 {
+			continue
+		}
+		photos = append(photos, info)
+		total += float64(info.Width) / float64(info.Height)
+	}
+	if len(photos) == 0 {
+		return
+	}
+
+	rows := 1
+	if len(photos) >= 3 {
+		rows = 2
+	}
+	spacing := width * 0.005
+
+	// Rows with about the same sum of aspect ratios end up with about the
+	// same height once justified
+	target := total / float64(rows)
+	y := 0.
+	start := 0
+	for start < len(photos) {
+		end := start
+		sum := 0.
+		for end < len(photos) {
+			sum += float64(photos[end].Width) / float64(photos[end].Height)
+			end++
+			if sum >= target && rows > 1 {
+				break
+			}
+		}
+		rows--
+
+		rowHeight := (width - spacing*float64(end-start-1)) / sum
+		x := 0.
+		for _, info := range photos[start:end] {
+			photo := render.Photo{Id: info.Id}
+			photo.Sprite.PlaceFitHeight(x, y, rowHeight, float64(info.Width), float64(info.Height))
+			scene.Photos = append(scene.Photos, photo)
+			x += photo.Sprite.Rect.W + spacing
+		}
+		y += rowHeight + spacing
+		start = end
+	}
+	contentHeight := y - spacing
+
+	// Scaled down to fit and centered, so that no photo is cut off
+	scale := math.Min(1, height/contentHeight)
+	offset := render.Point{
+		X: (width - width*scale) / 2,
+		Y: (height - contentHeight*scale) / 2,
+	}
+	for i := range scene.Photos {
+		scene.Photos[i].Sprite.Rect = scene.Photos[i].Sprite.Rect.Scale(scale).Move(offset)
+	}
+}
@@ -1,7 +1,6 @@
 package layout
 
 import (
-	"log"
 	"math"
 	"photofield/internal/image"
 	"photofield/internal/metrics"
@@ -93,7 +92,7 @@ func LayoutSearch(infos <-chan image.SimilarityInfo, layout Layout, scene *rende
 		now := time.Now()
 		if now.Sub(lastLogTime) > 1*time.Second {
 			lastLogTime = now
-			log.Printf("layout %d\n", index)
+			renderLog.Info("layout search", "index", index)
 		}
 
 		layoutCounter.Set(index)
@@ -0,0 +1,152 @@
+package layout
+
+import (
+	"fmt"
+	"path/filepath"
+	"photofield/internal/image"
+	"photofield/internal/render"
+	"time"
+
+	"github.com/tdewolff/canvas"
+)
+
+// Sheet configures a contact sheet of photos in a grid split into pages
+// stacked on top of each other, with all sizes in the units of the page,
+// e.g. millimeters
+type Sheet struct {
+	PageWidth  float64
+	PageHeight float64
+	Margin     float64
+	Columns    int
+	Rows       int
+	// Space between the cells of the grid
+	Spacing float64
+	// Title shown at the top of each page, together with the page number
+	Title     string
+	TitleFont canvas.FontFace
+	// Captions below each photo are left out if nil
+	CaptionFont *canvas.FontFace
+}
+
+// PerPage returns the number of photos on each page
+func (sheet Sheet) PerPage() int {
+	return sheet.Columns * sheet.Rows
+}
+
+// LayoutSheet lays out the photos into pages of the sheet, so that each
+// page can be drawn on its own, returning the number of pages
+func LayoutSheet(infos <-chan image.SourcedInfo, sheet Sheet, scene *render.Scene, source *image.Source) int {
+	var all []image.SourcedInfo
+	for info := range infos {
+		all = append(all, info)
+	}
+
+	perPage := sheet.PerPage()
+	pages := (len(all) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	titleHeight := sheet.TitleFont.Metrics().LineHeight * 1.5
+	captionHeight := 0.
+	if sheet.CaptionFont != nil {
+		// File name and date
+		captionHeight = sheet.CaptionFont.Metrics().LineHeight * 2.2
+	}
+
+	gridWidth := sheet.PageWidth - 2*sheet.Margin
+	gridHeight := sheet.PageHeight - 2*sheet.Margin - titleHeight
+	cellWidth := (gridWidth - float64(sheet.Columns-1)*sheet.Spacing) / float64(sheet.Columns)
+	cellHeight := (gridHeight - float64(sheet.Rows-1)*sheet.Spacing) / float64(sheet.Rows)
+	photoHeight := cellHeight - captionHeight
+
+	scene.Bounds = render.Rect{
+		X: 0,
+		Y: 0,
+		W: sheet.PageWidth,
+		H: sheet.PageHeight * float64(pages),
+	}
+
+	for page := 0; page < pages; page++ {
+		top := float64(page) * sheet.PageHeight
+		title := fmt.Sprintf("%s  ·  %d / %d", sheet.Title, page+1, pages)
+		scene.Texts = append(scene.Texts, render.NewTextFromRect(
+			render.Rect{
+				X: sheet.Margin,
+				Y: top + sheet.Margin,
+				W: gridWidth,
+				H: sheet.TitleFont.Metrics().Ascent,
+			},
+			&sheet.TitleFont,
+			title,
+		))
+	}
+
+	for i, info := range all {
+		page := i / perPage
+		col := i % perPage % sheet.Columns
+		row := i % perPage / sheet.Columns
+
+		x := sheet.Margin + float64(col)*(cellWidth+sheet.Spacing)
+		y := float64(page)*sheet.PageHeight + sheet.Margin + titleHeight + float64(row)*(cellHeight+sheet.Spacing)
+
+		photo := render.Photo{Id: info.Id}
+		photo.Sprite.PlaceFit(x, y, cellWidth, photoHeight, float64(info.Width), float64(info.Height))
+		if info.Width == 0 || info.Height == 0 {
+			photo.Sprite.Rect = render.Rect{X: x, Y: y, W: cellWidth, H: photoHeight}
+		}
+		// Center in the cell
+		photo.Sprite.Rect.X += (cellWidth - photo.Sprite.Rect.W) * 0.5
+		photo.Sprite.Rect.Y += photoHeight - photo.Sprite.Rect.H
+		scene.Photos = append(scene.Photos, photo)
+
+		if sheet.CaptionFont == nil {
+			continue
+		}
+		lines := []string{filepath.Base(photoPath(source, info.Id))}
+		// Files without metadata yet have the unix epoch as their date
+		if info.DateTime.After(time.Unix(0, 0)) {
+			lines = append(lines, info.DateTime.Format("2 Jan 2006 15:04"))
+		}
+		lineHeight := sheet.CaptionFont.Metrics().LineHeight
+		for j, line := range lines {
+			scene.Texts = append(scene.Texts, render.NewTextFromRect(
+				render.Rect{
+					X: x,
+					Y: y + photoHeight + float64(j)*lineHeight,
+					W: cellWidth,
+					H: lineHeight,
+				},
+				sheet.CaptionFont,
+				ellipsize(*sheet.CaptionFont, line, cellWidth),
+			))
+		}
+	}
+
+	scene.FileCount = len(all)
+	return pages
+}
+
+func photoPath(source *image.Source, id image.ImageId) string {
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// ellipsize shortens the text to fit the width
+func ellipsize(font canvas.FontFace, text string, width float64) string {
+	if font.TextWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		s := string(runes) + "…"
+		if font.TextWidth(s) <= width {
+			return s
+		}
+	}
+	return ""
+}
@@ -1,7 +1,6 @@
 package layout
 
 import (
-	"log"
 	"math"
 	"photofield/internal/image"
 	"photofield/internal/render"
@@ -32,7 +31,7 @@ func LayoutSquare(scene *render.Scene, source *image.Source) {
 
 	// cols := int(scene.size.width/(imageWidth+margin)) - 2
 
-	log.Println("layout")
+	renderLog.Info("layout square")
 	lastLogTime := time.Now()
 	for i := range scene.Photos {
 		photo := &scene.Photos[i]
@@ -42,7 +41,7 @@ func LayoutSquare(scene *render.Scene, source *image.Source) {
 		now := time.Now()
 		if now.Sub(lastLogTime) > 1*time.Second {
 			lastLogTime = now
-			log.Printf("layout %d / %d\n", i, photoCount)
+			renderLog.Info("layout square", "index", i, "count", photoCount)
 		}
 	}
 
@@ -3,7 +3,6 @@ package layout
 import (
 	// . "photofield/internal"
 
-	"log"
 	"photofield/internal/image"
 	"photofield/internal/metrics"
 	"photofield/internal/render"
@@ -57,7 +56,7 @@ func LayoutStrip(infos <-chan image.SourcedInfo, layout Layout, scene *render.Sc
 		now := time.Now()
 		if now.Sub(lastLogTime) > 1*time.Second {
 			lastLogTime = now
-			log.Printf("layout strip %d\n", index)
+			renderLog.Info("layout strip", "index", index)
 		}
 
 		layoutCounter.Set(index)
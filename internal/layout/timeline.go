@@ -1,7 +1,6 @@
 package layout
 
 import (
-	"log"
 	"time"
 
 	"github.com/hako/durafmt"
@@ -69,8 +68,8 @@ func LayoutTimelineEvent(layout Layout, rect render.Rect, event *TimelineEvent,
 
 func LayoutTimeline(infos <-chan image.SourcedInfo, layout Layout, scene *render.Scene, source *image.Source) {
 
-	layout.ImageSpacing = 0.02 * layout.ImageHeight
-	layout.LineSpacing = 0.02 * layout.ImageHeight
+	layout.ImageSpacing = layout.spacing()
+	layout.LineSpacing = layout.spacing()
 
 	sceneMargin := 10.
 
@@ -144,7 +143,7 @@ func LayoutTimeline(infos <-chan image.SourcedInfo, layout Layout, scene *render
 		eventCount++
 	}
 
-	log.Printf("layout events %d\n", eventCount)
+	renderLog.Info("layout events", "count", eventCount)
 
 	scene.Bounds.H = rect.Y + sceneMargin
 	scene.RegionSource = PhotoRegionSource{
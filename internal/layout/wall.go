@@ -1,7 +1,6 @@
 package layout
 
 import (
-	"log"
 	"math"
 	"photofield/internal/image"
 	"photofield/internal/metrics"
@@ -39,12 +38,12 @@ func LayoutWall(infos <-chan image.SourcedInfo, layout Layout, scene *render.Sce
 	layoutConfig.ImageSpacing = layout.ViewportWidth / float64(edgeCount) * 0.02
 	layoutConfig.LineSpacing = layoutConfig.ImageSpacing
 
-	log.Printf("layout wall width %v cols %v\n", scene.Bounds.W, cols)
+	renderLog.Info("layout wall", "width", scene.Bounds.W, "cols", cols)
 
 	imageWidth := scene.Bounds.W / (float64(cols) - layoutConfig.ImageSpacing)
 	imageHeight := imageWidth * 2 / 3 * 1.2
 
-	log.Printf("layout wall image %f %f\n", imageWidth, imageHeight)
+	renderLog.Info("layout wall image", "width", imageWidth, "height", imageHeight)
 
 	rows := int(math.Ceil(float64(photoCount) / float64(cols)))
 
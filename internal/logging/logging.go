@@ -0,0 +1,177 @@
+// Package logging writes leveled, structured logs with log/slog, with the
+// level configurable per module, e.g. to quiet the indexer without losing
+// the errors of the database.
+//
+// Messages of the standard log package are written at the info level
+// without a module once Init is called.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	// Level of the modules not listed in modules, one of debug, info, warn
+	// and error
+	Level string `json:"level"`
+	// Output format, text or json
+	Format string `json:"format"`
+	// Level per module, e.g. indexer: warn
+	Modules map[string]string `json:"modules"`
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown level %s, use debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+func (config *Config) Validate() error {
+	if _, err := parseLevel(config.Level); err != nil {
+		return fmt.Errorf("level: %w", err)
+	}
+	switch strings.ToLower(config.Format) {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("format: unknown format %s, use text or json", config.Format)
+	}
+	for module, l := range config.Modules {
+		if _, err := parseLevel(l); err != nil {
+			return fmt.Errorf("modules.%s: %w", module, err)
+		}
+	}
+	return nil
+}
+
+type levels struct {
+	level   slog.Level
+	modules map[string]slog.Level
+}
+
+func (l *levels) of(module string) slog.Level {
+	if level, ok := l.modules[module]; ok {
+		return level
+	}
+	return l.level
+}
+
+var (
+	current atomic.Pointer[levels]
+	handler atomic.Pointer[slog.Handler]
+	output  io.Writer = os.Stderr
+)
+
+func init() {
+	current.Store(&levels{level: slog.LevelInfo})
+	var h slog.Handler = slog.NewTextHandler(output, &slog.HandlerOptions{Level: slog.LevelDebug})
+	handler.Store(&h)
+}
+
+// Init applies the levels and format of the config to all loggers and
+// redirects the standard log package
+func Init(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	l := &levels{modules: make(map[string]slog.Level, len(config.Modules))}
+	l.level, _ = parseLevel(config.Level)
+	for module, s := range config.Modules {
+		l.modules[module], _ = parseLevel(s)
+	}
+
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	if strings.ToLower(config.Format) == "json" {
+		h = slog.NewJSONHandler(output, opts)
+	} else {
+		h = slog.NewTextHandler(output, opts)
+	}
+	current.Store(l)
+	handler.Store(&h)
+
+	// Route the standard log package through the module-less default level
+	slog.SetDefault(slog.New(defaultHandler{}))
+	log.SetFlags(0)
+	return nil
+}
+
+// defaultHandler writes records without a module at the default level
+type defaultHandler struct {
+	attrs []slog.Attr
+}
+
+func (h defaultHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().level
+}
+
+func (h defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = strings.TrimSuffix(r.Message, "\n")
+	r.AddAttrs(h.attrs...)
+	return (*handler.Load()).Handle(ctx, r)
+}
+
+func (h defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return defaultHandler{attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h defaultHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+// Logger logs the messages of a module, if they are at or above the level
+// configured for the module
+type Logger struct {
+	module string
+}
+
+// Module returns the logger of the module, e.g. indexer, decode, db,
+// render, server or timing
+func Module(name string) *Logger {
+	return &Logger{module: name}
+}
+
+// Enabled reports whether messages at the level are written
+func (l *Logger) Enabled(level slog.Level) bool {
+	return level >= current.Load().of(l.module)
+}
+
+func (l *Logger) log(level slog.Level, msg string, args []any) {
+	if !l.Enabled(level) {
+		return
+	}
+	var pcs [1]uintptr
+	// Skip Callers, log and the exported method
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(slog.String("module", l.module))
+	r.Add(args...)
+	(*handler.Load()).Handle(context.Background(), r)
+}
+
+// Debug, Info, Warn and Error log the message with alternating keys and
+// values as attributes, like slog.Logger
+
+func (l *Logger) Debug(msg string, args ...any) { l.log(slog.LevelDebug, msg, args) }
+func (l *Logger) Info(msg string, args ...any)  { l.log(slog.LevelInfo, msg, args) }
+func (l *Logger) Warn(msg string, args ...any)  { l.log(slog.LevelWarn, msg, args) }
+func (l *Logger) Error(msg string, args ...any) { l.log(slog.LevelError, msg, args) }
+
+// Fatal logs the message at the error level and exits, like log.Fatal
+func (l *Logger) Fatal(msg string, args ...any) {
+	l.log(slog.LevelError, msg, args)
+	os.Exit(1)
+}
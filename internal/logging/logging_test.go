@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	output = &buf
+	err := Init(Config{
+		Level:   "info",
+		Format:  "json",
+		Modules: map[string]string{"indexer": "warn", "db": "debug"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexer := Module("indexer")
+	db := Module("db")
+	indexer.Info("indexing files", "dir", "/photos")
+	indexer.Warn("ignoring invalid timezone")
+	db.Debug("database optimizing")
+	Module("render").Debug("scene built")
+	log.Printf("config path %s\n", "configuration.yaml")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid json %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+
+	expected := []struct {
+		level  string
+		module interface{}
+		msg    string
+	}{
+		{"WARN", "indexer", "ignoring invalid timezone"},
+		{"DEBUG", "db", "database optimizing"},
+		{"INFO", nil, "config path configuration.yaml"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %s", len(expected), len(records), buf.String())
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r["level"] != e.level || r["module"] != e.module || r["msg"] != e.msg {
+			t.Errorf("record %d: expected %s %v %q, got %v", i, e.level, e.module, e.msg, r)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Config{
+		{Level: "verbose"},
+		{Format: "xml"},
+		{Modules: map[string]string{"db": "loud"}},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+	valid := Config{Level: "WARN", Format: "JSON", Modules: map[string]string{"db": "debug"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -1,6 +1,11 @@
 package metrics
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/dgraph-io/ristretto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -36,7 +41,77 @@ func addGaugeUint64(name string, function func() uint64) {
 	)
 }
 
+// Registered queues and caches, for diagnostics
+var (
+	registryMutex sync.Mutex
+	queues        = make(map[string]*queue.Queue)
+	caches        = make(map[string]*ristretto.Cache)
+)
+
+type QueueStats struct {
+	Name    string `json:"name"`
+	Pending int    `json:"pending"`
+	// Items processed next and last, if any are pending
+	Next string `json:"next,omitempty"`
+	Last string `json:"last,omitempty"`
+}
+
+type CacheStats struct {
+	Name   string  `json:"name"`
+	Keys   uint64  `json:"keys"`
+	Cost   uint64  `json:"cost"`
+	Hits   uint64  `json:"hits"`
+	Misses uint64  `json:"misses"`
+	Ratio  float64 `json:"ratio"`
+}
+
+// Queues returns the current state of the registered queues by name
+func Queues() []QueueStats {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	stats := make([]QueueStats, 0, len(queues))
+	for name, q := range queues {
+		s := QueueStats{
+			Name:    name,
+			Pending: q.Length(),
+		}
+		if next := q.Front(); next != nil {
+			s.Next = fmt.Sprintf("%+v", next)
+		}
+		if last := q.Back(); last != nil {
+			s.Last = fmt.Sprintf("%+v", last)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Caches returns the current size and hit rates of the registered caches by
+// name
+func Caches() []CacheStats {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	stats := make([]CacheStats, 0, len(caches))
+	for name, c := range caches {
+		m := c.Metrics
+		stats = append(stats, CacheStats{
+			Name:   name,
+			Keys:   m.KeysAdded() - m.KeysEvicted(),
+			Cost:   m.CostAdded() - m.CostEvicted(),
+			Hits:   m.Hits(),
+			Misses: m.Misses(),
+			Ratio:  m.Ratio(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
 func AddQueue(name string, queue *queue.Queue) {
+	registryMutex.Lock()
+	queues[name] = queue
+	registryMutex.Unlock()
 	promauto.NewGaugeFunc(prometheus.GaugeOpts{
 		Namespace: Namespace,
 		Name:      name + "_pending",
@@ -46,6 +121,9 @@ func AddQueue(name string, queue *queue.Queue) {
 }
 
 func AddRistretto(name string, cache *ristretto.Cache) {
+	registryMutex.Lock()
+	caches[name] = cache
+	registryMutex.Unlock()
 	addGauge(name+"_ratio", cache.Metrics.Ratio)
 	addCounterUint64(name+"_hits", cache.Metrics.Hits)
 	addCounterUint64(name+"_misses", cache.Metrics.Misses)
@@ -65,3 +143,51 @@ func AddRistretto(name string, cache *ristretto.Cache) {
 	addCounterUint64(name+"_gets_kept", cache.Metrics.GetsKept)
 	addCounterUint64(name+"_gets_dropped", cache.Metrics.GetsDropped)
 }
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: Namespace,
+	Name:      "cache_requests_total",
+	Help:      "Lookups in caches that are not backed by ristretto, e.g. the sqlite thumbnail database",
+}, []string{"cache", "result"})
+
+// CacheHit counts a lookup that found the item in the named cache
+func CacheHit(cache string) {
+	cacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+// CacheMiss counts a lookup that did not find the item in the named cache
+func CacheMiss(cache string) {
+	cacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+var queryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: Namespace,
+	Name:      "db_query_seconds",
+	Help:      "Latency of cache database queries, listings include streaming the results to the reader",
+	Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+}, []string{"query"})
+
+// ObserveQuery returns a function that records the time since ObserveQuery
+// was called as the latency of the named database query
+func ObserveQuery(query string) func() {
+	start := time.Now()
+	return func() {
+		queryLatency.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	}
+}
+
+var sceneBuildLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: Namespace,
+	Name:      "scene_build_seconds",
+	Help:      "Time taken to lay out a scene",
+	Buckets:   prometheus.ExponentialBuckets(0.01, 3, 10),
+}, []string{"layout"})
+
+// ObserveSceneBuild returns a function that records the time since
+// ObserveSceneBuild was called as the time taken to lay out a scene
+func ObserveSceneBuild(layout string) func() {
+	start := time.Now()
+	return func() {
+		sceneBuildLatency.WithLabelValues(layout).Observe(time.Since(start).Seconds())
+	}
+}
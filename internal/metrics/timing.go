@@ -1,14 +1,17 @@
 package metrics
 
 import (
-	"log"
 	"time"
+
+	"photofield/internal/logging"
 )
 
+var timingLog = logging.Module("timing")
+
 func Elapsed(name string) func() {
 	start := time.Now()
 	return func() {
-		log.Printf("%-20s %5d ms\n", name, time.Since(start).Milliseconds())
+		timingLog.Info("elapsed", "name", name, "ms", time.Since(start).Milliseconds())
 	}
 }
 
@@ -16,7 +19,7 @@ func ElapsedWithCount(name string, count int) func() {
 	start := time.Now()
 	return func() {
 		millis := time.Since(start).Milliseconds()
-		log.Printf("%-20s %5d ms all, %.2f ms / photo\n", name, millis, float64(millis)/float64(count))
+		timingLog.Info("elapsed", "name", name, "ms", millis, "ms_per_photo", float64(millis)/float64(count))
 	}
 }
 
@@ -33,7 +36,7 @@ func (counter *Counter) Set(value int) {
 	if elapsed >= counter.Interval {
 		speed := float64(value-counter.lastValue) / elapsed.Seconds()
 		if !counter.lastTime.IsZero() {
-			log.Printf("%v %7v, %0.2f / sec\n", counter.Name, value, speed)
+			timingLog.Info("counter", "name", counter.Name, "value", value, "per_sec", speed)
 		}
 		counter.lastTime = now
 		counter.lastValue = value
@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"photofield/internal/logging"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+var serverLog = logging.Module("server")
+
+// Longest time the offline status is waited for to be delivered on close
+const closeTimeout = 5 * time.Second
+
+type Config struct {
+	// tcp://host:1883 or ssl://host:8883, disabled if empty
+	Broker   string `json:"broker"`
+	ClientId string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Prefix of all published topics
+	TopicPrefix string `json:"topic_prefix"`
+	// How often the library stats and indexing progress are published
+	StatsInterval string `json:"stats_interval"`
+}
+
+func (config *Config) Validate() error {
+	if config.Broker == "" {
+		return nil
+	}
+	u, err := url.Parse(config.Broker)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts":
+	default:
+		return fmt.Errorf("unsupported broker scheme %s, use tcp or ssl", u.Scheme)
+	}
+	if _, err := config.statsInterval(); err != nil {
+		return fmt.Errorf("stats_interval: %w", err)
+	}
+	return nil
+}
+
+func (config Config) statsInterval() (time.Duration, error) {
+	if config.StatsInterval == "" {
+		return 1 * time.Minute, nil
+	}
+	return time.ParseDuration(config.StatsInterval)
+}
+
+// Interval returns how often stats are published
+func (config Config) Interval() time.Duration {
+	d, _ := config.statsInterval()
+	return d
+}
+
+// broker returns the broker URL with the default port of its scheme if it
+// has none
+func (config Config) broker() string {
+	u, err := url.Parse(config.Broker)
+	if err != nil || u.Port() != "" {
+		return config.Broker
+	}
+	switch u.Scheme {
+	case "ssl", "tls", "mqtts":
+		u.Host = net.JoinHostPort(u.Hostname(), "8883")
+	default:
+		u.Host = net.JoinHostPort(u.Hostname(), "1883")
+	}
+	return u.String()
+}
+
+// Client publishes messages with QoS 0 to an MQTT 3.1.1 broker, reconnecting
+// in the background whenever the connection is lost. The status topic is
+// retained as "online" while connected and "offline" otherwise.
+type Client struct {
+	config Config
+	client paho.Client
+}
+
+func NewClient(config Config) *Client {
+	if config.ClientId == "" {
+		config.ClientId = "photofield"
+	}
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = "photofield"
+	}
+	c := &Client{config: config}
+	status := c.Topic("status")
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.broker()).
+		SetClientID(config.ClientId).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetKeepAlive(30*time.Second).
+		SetWill(status, "offline", 0, true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(1 * time.Minute).
+		SetOnConnectHandler(func(client paho.Client) {
+			serverLog.Info("mqtt connected", "broker", config.Broker)
+			client.Publish(status, 0, true, "online")
+		}).
+		SetConnectionLostHandler(func(client paho.Client, err error) {
+			serverLog.Warn("mqtt connection lost", "err", err)
+		})
+	c.client = paho.NewClient(opts)
+	// Retried in the background until connected
+	c.client.Connect()
+	return c
+}
+
+// Topic returns the topic prefixed with the configured prefix
+func (c *Client) Topic(topic string) string {
+	return c.config.TopicPrefix + "/" + topic
+}
+
+// Publish sends the message without waiting for it to be delivered.
+// Messages are dropped while the broker is unreachable.
+func (c *Client) Publish(topic string, payload []byte, retain bool) {
+	c.client.Publish(c.Topic(topic), 0, retain, payload)
+}
+
+// Close publishes the offline status and disconnects from the broker
+func (c *Client) Close() {
+	if c.client.IsConnected() {
+		c.client.Publish(c.Topic("status"), 0, true, "offline").WaitTimeout(closeTimeout)
+	}
+	c.client.Disconnect(250)
+}
@@ -0,0 +1,135 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetDisconnect = 14
+)
+
+// readPacket reads a packet sent to the fake broker below
+func readPacket(r *bufio.Reader) (typ byte, body []byte, err error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header >> 4, body, err
+}
+
+type publish struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+func readPublish(t *testing.T, header byte, body []byte) publish {
+	t.Helper()
+	if header>>4 != packetPublish {
+		t.Fatalf("expected publish, got packet %d", header>>4)
+	}
+	n := int(body[0])<<8 | int(body[1])
+	return publish{
+		topic:   string(body[2 : 2+n]),
+		payload: string(body[2+n:]),
+		retain:  header&0x01 != 0,
+	}
+}
+
+func TestPublish(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	published := make(chan publish, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		typ, body, err := readPacket(r)
+		if err != nil || typ != packetConnect {
+			t.Errorf("expected connect, got %d %v", typ, err)
+			return
+		}
+		if !bytes.Contains(body, []byte("photofield/status")) || !bytes.Contains(body, []byte("user")) {
+			t.Errorf("expected will and username in connect")
+		}
+		conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+		for {
+			header, err := r.Peek(1)
+			if err != nil {
+				close(published)
+				return
+			}
+			h := header[0]
+			typ, body, err := readPacket(r)
+			if err != nil {
+				close(published)
+				return
+			}
+			switch typ {
+			case packetPublish:
+				published <- readPublish(t, h, body)
+			case packetDisconnect:
+				close(published)
+				return
+			}
+		}
+	}()
+
+	c := NewClient(Config{
+		Broker:   "tcp://" + l.Addr().String(),
+		Username: "user",
+		Password: "pass",
+	})
+	expect := func(e publish) {
+		t.Helper()
+		select {
+		case p := <-published:
+			if p != e {
+				t.Errorf("expected %+v, got %+v", e, p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", e.topic)
+		}
+	}
+	expect(publish{"photofield/status", "online", true})
+	c.Publish("photo/added", []byte(`{"file_id":1}`), false)
+	expect(publish{"photofield/photo/added", `{"file_id":1}`, false})
+
+	c.Close()
+	p := <-published
+	if p.topic != "photofield/status" || p.payload != "offline" {
+		t.Errorf("expected offline status, got %+v", p)
+	}
+}
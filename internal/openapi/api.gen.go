@@ -4,18 +4,86 @@
 package openapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/deepmap/oapi-codegen/pkg/runtime"
+	openapi_types "github.com/deepmap/oapi-codegen/pkg/types"
 	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+// Defines values for AuditAction.
+const (
+	AuditActionCAMERACALIBRATE AuditAction = "CAMERA_CALIBRATE"
+
+	AuditActionCAMERAUPDATE AuditAction = "CAMERA_UPDATE"
+
+	AuditActionCAPTIONEDIT AuditAction = "CAPTION_EDIT"
+
+	AuditActionFILEREPROCESS AuditAction = "FILE_REPROCESS"
+
+	AuditActionFILEUPLOAD AuditAction = "FILE_UPLOAD"
+
+	AuditActionGEOTAG AuditAction = "GEOTAG"
+
+	AuditActionLOCATIONEDIT AuditAction = "LOCATION_EDIT"
+
+	AuditActionORIENTATIONACCEPT AuditAction = "ORIENTATION_ACCEPT"
+
+	AuditActionORIENTATIONEDIT AuditAction = "ORIENTATION_EDIT"
+
+	AuditActionORIENTATIONREJECT AuditAction = "ORIENTATION_REJECT"
+
+	AuditActionPANORAMAREJECT AuditAction = "PANORAMA_REJECT"
+
+	AuditActionTAGADD AuditAction = "TAG_ADD"
+
+	AuditActionTAGCREATE AuditAction = "TAG_CREATE"
+
+	AuditActionTAGINVERT AuditAction = "TAG_INVERT"
+
+	AuditActionTAGMERGE AuditAction = "TAG_MERGE"
+
+	AuditActionTAGREMOVE AuditAction = "TAG_REMOVE"
+
+	AuditActionTAGRENAME AuditAction = "TAG_RENAME"
+
+	AuditActionTAGROLLBACK AuditAction = "TAG_ROLLBACK"
+
+	AuditActionTAGUPDATE AuditAction = "TAG_UPDATE"
+
+	AuditActionTASK AuditAction = "TASK"
+)
+
+// Defines values for ChangeOp.
+const (
+	ChangeOpADDED ChangeOp = "ADDED"
+
+	ChangeOpMODIFIED ChangeOp = "MODIFIED"
+
+	ChangeOpREMOVED ChangeOp = "REMOVED"
+)
+
+// Defines values for DiagnosticsInstanceRole.
+const (
+	DiagnosticsInstanceRoleReader DiagnosticsInstanceRole = "reader"
+
+	DiagnosticsInstanceRoleWriter DiagnosticsInstanceRole = "writer"
 )
 
 // Defines values for LayoutType.
 const (
 	LayoutTypeALBUM LayoutType = "ALBUM"
 
+	LayoutTypeCALENDAR LayoutType = "CALENDAR"
+
+	LayoutTypeHIGHLIGHTS LayoutType = "HIGHLIGHTS"
+
+	LayoutTypeMAP LayoutType = "MAP"
+
 	LayoutTypeSQUARE LayoutType = "SQUARE"
 
 	LayoutTypeSTRIP LayoutType = "STRIP"
@@ -25,6 +93,15 @@ const (
 	LayoutTypeWALL LayoutType = "WALL"
 )
 
+// Defines values for MemoryFilter.
+const (
+	MemoryFilterALL MemoryFilter = "ALL"
+
+	MemoryFilterFAVORITES MemoryFilter = "FAVORITES"
+
+	MemoryFilterHIGHLIGHTS MemoryFilter = "HIGHLIGHTS"
+)
+
 // Defines values for Operation.
 const (
 	OperationADD Operation = "ADD"
@@ -34,8 +111,172 @@ const (
 	OperationSUBTRACT Operation = "SUBTRACT"
 )
 
+// Defines values for OrientationProposalStatus.
+const (
+	OrientationProposalStatusAccepted OrientationProposalStatus = "accepted"
+
+	OrientationProposalStatusNone OrientationProposalStatus = "none"
+
+	OrientationProposalStatusPending OrientationProposalStatus = "pending"
+
+	OrientationProposalStatusRejected OrientationProposalStatus = "rejected"
+)
+
+// Defines values for PanoramaLayout.
+const (
+	PanoramaLayoutINLINE PanoramaLayout = "INLINE"
+
+	PanoramaLayoutROW PanoramaLayout = "ROW"
+)
+
+// Defines values for PlaceKind.
+const (
+	PlaceKindCITY PlaceKind = "CITY"
+
+	PlaceKindCOUNTRY PlaceKind = "COUNTRY"
+)
+
+// Defines values for PrefetchPostDirection.
+const (
+	PrefetchPostDirectionNEXT PrefetchPostDirection = "NEXT"
+
+	PrefetchPostDirectionPREV PrefetchPostDirection = "PREV"
+)
+
+// Defines values for ProblemCode.
+const (
+	ProblemCodeConflict ProblemCode = "conflict"
+
+	ProblemCodeConflictTag ProblemCode = "conflict.tag"
+
+	ProblemCodeConflictVersion ProblemCode = "conflict.version"
+
+	ProblemCodeForbidden ProblemCode = "forbidden"
+
+	ProblemCodeInternal ProblemCode = "internal"
+
+	ProblemCodeInvalidRequest ProblemCode = "invalid_request"
+
+	ProblemCodeInvalidRequestBody ProblemCode = "invalid_request.body"
+
+	ProblemCodeInvalidRequestParameter ProblemCode = "invalid_request.parameter"
+
+	ProblemCodeInvalidRequestQuery ProblemCode = "invalid_request.query"
+
+	ProblemCodeInvalidRequestUnsupported ProblemCode = "invalid_request.unsupported"
+
+	ProblemCodeNotFound ProblemCode = "not_found"
+
+	ProblemCodeNotFoundCamera ProblemCode = "not_found.camera"
+
+	ProblemCodeNotFoundCollection ProblemCode = "not_found.collection"
+
+	ProblemCodeNotFoundFile ProblemCode = "not_found.file"
+
+	ProblemCodeNotFoundPanorama ProblemCode = "not_found.panorama"
+
+	ProblemCodeNotFoundRegion ProblemCode = "not_found.region"
+
+	ProblemCodeNotFoundRevision ProblemCode = "not_found.revision"
+
+	ProblemCodeNotFoundScene ProblemCode = "not_found.scene"
+
+	ProblemCodeNotFoundSearch ProblemCode = "not_found.search"
+
+	ProblemCodeNotFoundSelection ProblemCode = "not_found.selection"
+
+	ProblemCodeNotFoundSource ProblemCode = "not_found.source"
+
+	ProblemCodeNotFoundState ProblemCode = "not_found.state"
+
+	ProblemCodeNotFoundSubject ProblemCode = "not_found.subject"
+
+	ProblemCodeNotFoundTag ProblemCode = "not_found.tag"
+
+	ProblemCodeNotFoundTrip ProblemCode = "not_found.trip"
+
+	ProblemCodeNotIndexed ProblemCode = "not_indexed"
+
+	ProblemCodeNotIndexedMetadata ProblemCode = "not_indexed.metadata"
+
+	ProblemCodeUnauthorized ProblemCode = "unauthorized"
+
+	ProblemCodeUnauthorizedApiKey ProblemCode = "unauthorized.api_key"
+
+	ProblemCodeUnavailable ProblemCode = "unavailable"
+
+	ProblemCodeUnavailableAi ProblemCode = "unavailable.ai"
+
+	ProblemCodeUnavailableReadOnly ProblemCode = "unavailable.read_only"
+
+	ProblemCodeUnavailableSource ProblemCode = "unavailable.source"
+)
+
+// Defines values for QuarantinedStage.
+const (
+	QuarantinedStageMetadata QuarantinedStage = "metadata"
+
+	QuarantinedStageThumbnail QuarantinedStage = "thumbnail"
+)
+
+// Defines values for SelectionConvertTo.
+const (
+	SelectionConvertToALBUM SelectionConvertTo = "ALBUM"
+
+	SelectionConvertToEXPORT SelectionConvertTo = "EXPORT"
+
+	SelectionConvertToTAG SelectionConvertTo = "TAG"
+)
+
+// Defines values for SheetPostFormat.
+const (
+	SheetPostFormatJpeg SheetPostFormat = "jpeg"
+
+	SheetPostFormatPdf SheetPostFormat = "pdf"
+)
+
+// Defines values for SheetPostPaper.
+const (
+	SheetPostPaperA3 SheetPostPaper = "a3"
+
+	SheetPostPaperA4 SheetPostPaper = "a4"
+
+	SheetPostPaperA5 SheetPostPaper = "a5"
+
+	SheetPostPaperLegal SheetPostPaper = "legal"
+
+	SheetPostPaperLetter SheetPostPaper = "letter"
+)
+
+// Defines values for TagRevisionOp.
+const (
+	TagRevisionOpADD TagRevisionOp = "ADD"
+
+	TagRevisionOpINVERT TagRevisionOp = "INVERT"
+
+	TagRevisionOpMERGE TagRevisionOp = "MERGE"
+
+	TagRevisionOpROLLBACK TagRevisionOp = "ROLLBACK"
+
+	TagRevisionOpSUBTRACT TagRevisionOp = "SUBTRACT"
+)
+
 // Defines values for TaskType.
 const (
+	TaskTypeAUDITORIENTATION TaskType = "AUDIT_ORIENTATION"
+
+	TaskTypeDETECTKINDS TaskType = "DETECT_KINDS"
+
+	TaskTypeDETECTNSFW TaskType = "DETECT_NSFW"
+
+	TaskTypeDETECTORIENTATION TaskType = "DETECT_ORIENTATION"
+
+	TaskTypeDETECTPANORAMAS TaskType = "DETECT_PANORAMAS"
+
+	TaskTypeDETECTSUBJECTS TaskType = "DETECT_SUBJECTS"
+
+	TaskTypeDETECTTRIPS TaskType = "DETECT_TRIPS"
+
 	TaskTypeINDEXCONTENTS TaskType = "INDEX_CONTENTS"
 
 	TaskTypeINDEXCONTENTSAI TaskType = "INDEX_CONTENTS_AI"
@@ -45,8 +286,45 @@ const (
 	TaskTypeINDEXFILES TaskType = "INDEX_FILES"
 
 	TaskTypeINDEXMETADATA TaskType = "INDEX_METADATA"
+
+	TaskTypeVERIFYCHECKSUMS TaskType = "VERIFY_CHECKSUMS"
+)
+
+// Defines values for VerificationStatus.
+const (
+	VerificationStatusMismatch VerificationStatus = "mismatch"
+
+	VerificationStatusUnreadable VerificationStatus = "unreadable"
 )
 
+// AuditAction defines model for AuditAction.
+type AuditAction string
+
+// AuditEntry defines model for AuditEntry.
+type AuditEntry struct {
+	Action AuditAction `json:"action"`
+
+	// Name of the API key or user, not set if anonymous
+	Actor     *string   `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Details specific to the action
+	Details *map[string]interface{} `json:"details,omitempty"`
+
+	// Number of affected files
+	FileCount int `json:"file_count"`
+
+	// Affected files as inclusive ranges of ids
+	FileRanges *[]FileRange `json:"file_ranges,omitempty"`
+	Id         int64        `json:"id"`
+
+	// Method the actor was authenticated by, e.g. api_key, proxy or oidc
+	Method *string `json:"method,omitempty"`
+
+	// Tag, collection or camera the action was applied to
+	Target *string `json:"target,omitempty"`
+}
+
 // Bounds defines model for Bounds.
 type Bounds struct {
 	H float32 `json:"h"`
@@ -55,6 +333,37 @@ type Bounds struct {
 	Y float32 `json:"y"`
 }
 
+// Camera defines model for Camera.
+type Camera struct {
+	// Seconds added to the dates of all files taken with the camera.
+	ClockOffset int      `json:"clock_offset"`
+	Id          CameraId `json:"id"`
+	Make        *string  `json:"make,omitempty"`
+	Model       *string  `json:"model,omitempty"`
+	Serial      *string  `json:"serial,omitempty"`
+}
+
+// CameraCalibratePost defines model for CameraCalibratePost.
+type CameraCalibratePost struct {
+	FileId          FileId `json:"file_id"`
+	ReferenceFileId FileId `json:"reference_file_id"`
+}
+
+// CameraCount defines model for CameraCount.
+type CameraCount struct {
+	Camera Camera `json:"camera"`
+	Count  int    `json:"count"`
+}
+
+// CameraId defines model for CameraId.
+type CameraId int
+
+// CameraPut defines model for CameraPut.
+type CameraPut struct {
+	// Seconds added to the dates of all files taken with the camera.
+	ClockOffset int `json:"clock_offset"`
+}
+
 // Capabilities defines model for Capabilities.
 type Capabilities struct {
 	Search Capability `json:"search"`
@@ -66,6 +375,30 @@ type Capability struct {
 	Supported bool `json:"supported"`
 }
 
+// Caption defines model for Caption.
+type Caption struct {
+	Caption string `json:"caption"`
+}
+
+// Change defines model for Change.
+type Change struct {
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Cursor    int64      `json:"cursor"`
+
+	// Fast content hash of the file, not set for removed files
+	Hash      *string  `json:"hash,omitempty"`
+	Height    *int     `json:"height,omitempty"`
+	Id        FileId   `json:"id"`
+	Latitude  *float32 `json:"latitude,omitempty"`
+	Longitude *float32 `json:"longitude,omitempty"`
+	Op        ChangeOp `json:"op"`
+	Path      string   `json:"path"`
+	Width     *int     `json:"width,omitempty"`
+}
+
+// ChangeOp defines model for Change.Op.
+type ChangeOp string
+
 // Collection defines model for Collection.
 type Collection struct {
 	Id CollectionId `json:"id"`
@@ -80,30 +413,395 @@ type Collection struct {
 // CollectionId defines model for CollectionId.
 type CollectionId string
 
+// Diagnostics defines model for Diagnostics.
+type Diagnostics struct {
+	Caches []struct {
+		// Size of the cached items, in bytes for most caches
+		Cost   int64   `json:"cost"`
+		Hits   int64   `json:"hits"`
+		Keys   int64   `json:"keys"`
+		Misses int64   `json:"misses"`
+		Name   string  `json:"name"`
+		Ratio  float64 `json:"ratio"`
+	} `json:"caches"`
+	Database struct {
+		// Embeddings in the embeddings store
+		Embeddings int `json:"embeddings"`
+
+		// Size of the embeddings store next to the database, in bytes
+		EmbeddingsSize int64 `json:"embeddings_size"`
+
+		// Whether the writer holds a write transaction open
+		InTransaction bool   `json:"in_transaction"`
+		MaxWrites     int    `json:"max_writes"`
+		Path          string `json:"path"`
+
+		// Writes queued for the writer, writers block once max_writes are queued
+		PendingWrites int `json:"pending_writes"`
+
+		// Connections in the pool
+		Pool int `json:"pool"`
+
+		// Whether another instance sharing the data dir writes the database
+		ReadOnly bool  `json:"read_only"`
+		Size     int64 `json:"size"`
+		WalSize  int64 `json:"wal_size"`
+	} `json:"database"`
+	Goroutines int `json:"goroutines"`
+	Instance   struct {
+		// Whether this instance indexes and writes the data dir or only reads it
+		Role DiagnosticsInstanceRole `json:"role"`
+
+		// Process id and host of the writer instance
+		Writer string `json:"writer"`
+	} `json:"instance"`
+	MaxProfileSeconds int `json:"max_profile_seconds"`
+	Memory            struct {
+		// Bytes of allocated heap objects
+		Alloc          int64   `json:"alloc"`
+		GcCount        int     `json:"gc_count"`
+		GcPauseTotalMs float64 `json:"gc_pause_total_ms"`
+		HeapObjects    int64   `json:"heap_objects"`
+
+		// Bytes obtained from the operating system
+		Sys int64 `json:"sys"`
+	} `json:"memory"`
+	Queues []struct {
+		// Item processed last
+		Last *string `json:"last,omitempty"`
+		Name string  `json:"name"`
+
+		// Item processed next
+		Next    *string `json:"next,omitempty"`
+		Pending int     `json:"pending"`
+	} `json:"queues"`
+
+	// Tile requests waiting to be rendered
+	TileRequests  int    `json:"tile_requests"`
+	UptimeSeconds int    `json:"uptime_seconds"`
+	Version       string `json:"version"`
+}
+
+// Whether this instance indexes and writes the data dir or only reads it
+type DiagnosticsInstanceRole string
+
+// DirUsage defines model for DirUsage.
+type DirUsage struct {
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files"`
+	Path  string `json:"path"`
+}
+
+// ExtensionUsage defines model for ExtensionUsage.
+type ExtensionUsage struct {
+	Bytes     int64  `json:"bytes"`
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+}
+
 // File defines model for File.
 type File string
 
 // FileId defines model for FileId.
 type FileId int
 
+// FileLocation defines model for FileLocation.
+type FileLocation struct {
+	// Omitted if the file has no location
+	Latitude *float64 `json:"latitude,omitempty"`
+
+	// Omitted if the file has no location
+	Longitude *float64 `json:"longitude,omitempty"`
+
+	// Reverse geocoded city, province or country of the location, if reverse geocoding is enabled
+	Place *string `json:"place,omitempty"`
+}
+
+// FileRange defines model for FileRange.
+type FileRange struct {
+	From FileId `json:"from"`
+	To   FileId `json:"to"`
+}
+
+// FileSize defines model for FileSize.
+type FileSize struct {
+	Bytes int64  `json:"bytes"`
+	Id    FileId `json:"id"`
+	Path  string `json:"path"`
+}
+
+// GeotagResult defines model for GeotagResult.
+type GeotagResult struct {
+	// Photos taken while the tracks were recorded with a location found
+	Geotagged []FileId `json:"geotagged"`
+
+	// Photos taken while the tracks were recorded that already had a location
+	Located int `json:"located"`
+
+	// Timestamped points read from the tracks
+	Points int `json:"points"`
+
+	// Photos taken while the tracks were recorded with no track point close enough in time
+	Unmatched int `json:"unmatched"`
+
+	// XMP sidecars written
+	XmpWritten int `json:"xmp_written"`
+}
+
 // ImageHeight defines model for ImageHeight.
 type ImageHeight float32
 
+// IndexChanges defines model for IndexChanges.
+type IndexChanges struct {
+	Count int `json:"count"`
+
+	// Paths of the first files
+	Samples []string `json:"samples"`
+}
+
+// Files with each kind of indexed data, the thumbnails counting the files with their contents indexed
+type IndexCoverage struct {
+	Embeddings int `json:"embeddings"`
+	Metadata   int `json:"metadata"`
+	Thumbnails int `json:"thumbnails"`
+}
+
+// IndexReport defines model for IndexReport.
+type IndexReport struct {
+	Added    IndexChanges `json:"added"`
+	Contents IndexChanges `json:"contents"`
+
+	// Files found with a listed extension and not ignored
+	Found    int          `json:"found"`
+	Metadata IndexChanges `json:"metadata"`
+	Rehashed IndexChanges `json:"rehashed"`
+	Removed  IndexChanges `json:"removed"`
+}
+
 // LayoutType defines model for LayoutType.
 type LayoutType string
 
+// LibraryStats defines model for LibraryStats.
+type LibraryStats struct {
+	// Average of the photos with known dimensions
+	AverageMegapixels float64 `json:"average_megapixels"`
+
+	// Most used cameras, the most files first
+	Cameras []CameraCount `json:"cameras"`
+
+	// Countries with the most photos, if places are enabled
+	Countries []Place `json:"countries"`
+
+	// Files with each kind of indexed data, the thumbnails counting the files with their contents indexed
+	Coverage IndexCoverage `json:"coverage"`
+	Files    int           `json:"files"`
+	Photos   int           `json:"photos"`
+
+	// Distinct tags of the files, excluding selections
+	TagCount int `json:"tag_count"`
+
+	// Tags of the most files, excluding selections
+	Tags []TagCount `json:"tags"`
+
+	// Total duration of the videos with a known duration
+	VideoHours float64 `json:"video_hours"`
+	Videos     int     `json:"videos"`
+
+	// Files per year, oldest first, without the files of unknown date
+	Years []YearCount `json:"years"`
+}
+
+// Location defines model for Location.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Either `file_ids` or `select_tag` is required.
+type LocationPost struct {
+	FileIds   *[]FileId `json:"file_ids,omitempty"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+
+	// Also set the location of the files with this tag, e.g. the selection tag
+	SelectTag *string `json:"select_tag,omitempty"`
+}
+
+// LocationResult defines model for LocationResult.
+type LocationResult struct {
+	// Reverse geocoded city, province or country of the location, if reverse geocoding is enabled
+	Place *string `json:"place,omitempty"`
+
+	// Files found and updated
+	Updated []FileId `json:"updated"`
+}
+
+// How much the height of a row of the album and timeline layouts may
+// differ from the image height, as a fraction of it. Rows end where
+// their height is closest to the image height, and rows that would
+// differ by more are not stretched to the full width. By default, rows
+// are stretched as much as needed.
+type MaxRowSlop float32
+
+// Memory defines model for Memory.
+type Memory struct {
+	Id       FileId    `json:"id"`
+	TakenAt  time.Time `json:"taken_at"`
+	YearsAgo int       `json:"years_ago"`
+}
+
+// Only include favorites, or the photos the highlights layout would show, leaving out the worst ones of each day
+type MemoryFilter string
+
 // Operation defines model for Operation.
 type Operation string
 
+// EXIF orientation, 1 is normal, 3, 6 and 8 rotate by 180, 90 and 270 degrees clockwise, the others additionally mirror.
+type Orientation int
+
+// OrientationEdit defines model for OrientationEdit.
+type OrientationEdit struct {
+	// EXIF orientation, 1 is normal, 3, 6 and 8 rotate by 180, 90 and 270 degrees clockwise, the others additionally mirror.
+	Orientation Orientation `json:"orientation"`
+}
+
+// OrientationProposal defines model for OrientationProposal.
+type OrientationProposal struct {
+	Confidence float32 `json:"confidence"`
+	FileId     FileId  `json:"file_id"`
+
+	// EXIF orientation, 1 is normal, 3, 6 and 8 rotate by 180, 90 and 270 degrees clockwise, the others additionally mirror.
+	Orientation Orientation               `json:"orientation"`
+	Status      OrientationProposalStatus `json:"status"`
+}
+
+// OrientationProposalStatus defines model for OrientationProposal.Status.
+type OrientationProposalStatus string
+
+// OrientationProposalsPost defines model for OrientationProposalsPost.
+type OrientationProposalsPost struct {
+	FileIds []FileId `json:"file_ids"`
+}
+
+// Panorama defines model for Panorama.
+type Panorama struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// Files of the sequence in the order they were taken
+	FileIds []FileId   `json:"file_ids"`
+	Id      PanoramaId `json:"id"`
+
+	// Whether a stitched preview is available
+	Preview bool `json:"preview"`
+}
+
+// PanoramaId defines model for PanoramaId.
+type PanoramaId int
+
+// How panoramas are laid out in the album and timeline layouts, inline
+// with other photos by default or in rows of their own spanning the
+// full width
+type PanoramaLayout string
+
+// Place defines model for Place.
+type Place struct {
+	// Photos of the collection taken at the place
+	Count   int     `json:"count"`
+	Country *string `json:"country,omitempty"`
+	Cover   FileId  `json:"cover"`
+
+	// Country, or city or province if the photos were not taken within a city
+	Kind PlaceKind `json:"kind"`
+
+	// Location of the cover, the latest photo taken at the place
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Name      string   `json:"name"`
+
+	// Tag of the photos taken at the place
+	Tag string `json:"tag"`
+}
+
+// Country, or city or province if the photos were not taken within a city
+type PlaceKind string
+
+// PrefetchPost defines model for PrefetchPost.
+type PrefetchPost struct {
+	// Number of files to load.
+	Count *int `json:"count,omitempty"`
+
+	// Navigation direction, the files following or preceding `file_id` in the scene are loaded respectively.
+	Direction *PrefetchPostDirection `json:"direction,omitempty"`
+	FileId    FileId                 `json:"file_id"`
+
+	// Height the files are displayed at, in pixels. The original size is assumed if omitted.
+	Height *int `json:"height,omitempty"`
+
+	// Width the files are displayed at, in pixels. The original size is assumed if omitted.
+	Width *int `json:"width,omitempty"`
+}
+
+// Navigation direction, the files following or preceding `file_id` in the scene are loaded respectively.
+type PrefetchPostDirection string
+
 // Problem defines model for Problem.
 type Problem struct {
+	// Machine-readable problem code. Codes are grouped by the part before the first dot, e.g. not_found.scene is in the not_found group, so that clients can handle groups of problems without knowing every code. Groups are invalid_request, unauthorized, forbidden, not_found, not_indexed, conflict, unavailable and internal.
+	Code ProblemCode `json:"code"`
+
+	// Additional machine-readable information, e.g. the invalid parameter or the missing API key scope.
+	Details *Problem_Details `json:"details,omitempty"`
+
+	// Machine-readable problem code. Codes are grouped by the part before the first dot, e.g. not_found.scene is in the not_found group, so that clients can handle groups of problems without knowing every code. Groups are invalid_request, unauthorized, forbidden, not_found, not_indexed, conflict, unavailable and internal.
+	Group ProblemCode `json:"group"`
+
+	// Description of this occurrence of the problem. Written in English and readable for engineers, usually not suited for non technical stakeholders and not localized.
+	Message string `json:"message"`
+
+	// Whether repeating the same request later can succeed, e.g. after indexing finished or a service became available again.
+	Retryable bool `json:"retryable"`
+
 	// The HTTP status code generated by the origin server for this occurrence of the problem.
-	Status *int32 `json:"status,omitempty"`
+	Status int32 `json:"status"`
 
-	// A short summary of the problem type. Written in English and readable for engineers, usually not suited for non technical stakeholders and not localized.
+	// Same as message, kept for existing clients.
 	Title *string `json:"title,omitempty"`
 }
 
+// Additional machine-readable information, e.g. the invalid parameter or the missing API key scope.
+type Problem_Details struct {
+	AdditionalProperties map[string]interface{} `json:"-"`
+}
+
+// Machine-readable problem code. Codes are grouped by the part before the first dot, e.g. not_found.scene is in the not_found group, so that clients can handle groups of problems without knowing every code. Groups are invalid_request, unauthorized, forbidden, not_found, not_indexed, conflict, unavailable and internal.
+type ProblemCode string
+
+// Quarantined defines model for Quarantined.
+type Quarantined struct {
+	Error         string    `json:"error"`
+	Id            FileId    `json:"id"`
+	Path          string    `json:"path"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+
+	// Indexing step that failed to decode the file
+	Stage QuarantinedStage `json:"stage"`
+}
+
+// Indexing step that failed to decode the file
+type QuarantinedStage string
+
+// QueryResult defines model for QueryResult.
+type QueryResult struct {
+	Columns []string `json:"columns"`
+
+	// Set if the query failed while streaming the rows
+	Error *string         `json:"error,omitempty"`
+	Rows  [][]interface{} `json:"rows"`
+
+	// True if there were more rows than the limit
+	Truncated bool `json:"truncated"`
+}
+
 // Region defines model for Region.
 type Region struct {
 	Bounds Bounds      `json:"bounds"`
@@ -117,9 +815,27 @@ type RegionData map[string]interface{}
 // RegionId defines model for RegionId.
 type RegionId int
 
+// ReprocessStep defines model for ReprocessStep.
+type ReprocessStep struct {
+	Done bool `json:"done"`
+
+	// Why the step failed. Steps that are neither done nor failed were skipped, e.g. the embedding if AI is not configured, or the color and embedding if the thumbnail failed.
+	Error *string `json:"error,omitempty"`
+}
+
+// Reprocessed defines model for Reprocessed.
+type Reprocessed struct {
+	Color     ReprocessStep `json:"color"`
+	Embedding ReprocessStep `json:"embedding"`
+	Id        FileId        `json:"id"`
+	Metadata  ReprocessStep `json:"metadata"`
+	Thumbnail ReprocessStep `json:"thumbnail"`
+}
+
 // Scene defines model for Scene.
 type Scene struct {
-	Bounds *Bounds `json:"bounds,omitempty"`
+	Bounds  *Bounds `json:"bounds,omitempty"`
+	Changed *Bounds `json:"changed,omitempty"`
 
 	// Any error encountered while loading the scene
 	Error     *string `json:"error,omitempty"`
@@ -128,6 +844,10 @@ type Scene struct {
 
 	// True while the scene is loading and the dimensions are not yet known.
 	Loading *bool `json:"loading,omitempty"`
+
+	// Latest change of the files in the scene. It increases as the scene
+	// is updated in place after files in the collection changed.
+	Revision *int64 `json:"revision,omitempty"`
 }
 
 // SceneId defines model for SceneId.
@@ -135,11 +855,30 @@ type SceneId string
 
 // SceneParams defines model for SceneParams.
 type SceneParams struct {
-	CollectionId   CollectionId   `json:"collection_id"`
-	ImageHeight    *ImageHeight   `json:"image_height,omitempty"`
-	Layout         LayoutType     `json:"layout"`
-	Search         *Search        `json:"search,omitempty"`
-	Sort           *Sort          `json:"sort,omitempty"`
+	CollectionId CollectionId `json:"collection_id"`
+	ImageHeight  *ImageHeight `json:"image_height,omitempty"`
+	Layout       LayoutType   `json:"layout"`
+
+	// How much the height of a row of the album and timeline layouts may
+	// differ from the image height, as a fraction of it. Rows end where
+	// their height is closest to the image height, and rows that would
+	// differ by more are not stretched to the full width. By default, rows
+	// are stretched as much as needed.
+	MaxRowSlop *MaxRowSlop `json:"max_row_slop,omitempty"`
+
+	// How panoramas are laid out in the album and timeline layouts, inline
+	// with other photos by default or in rows of their own spanning the
+	// full width
+	Panorama *PanoramaLayout `json:"panorama,omitempty"`
+
+	// Include the files with the tags of `media.private.tags`, which are left out otherwise unless searched for by tag
+	Private *bool   `json:"private,omitempty"`
+	Search  *Search `json:"search,omitempty"`
+	Sort    *Sort   `json:"sort,omitempty"`
+
+	// Spacing between photos and rows of the album and timeline layouts,
+	// 2% of the image height by default
+	Spacing        *Spacing       `json:"spacing,omitempty"`
 	ViewportHeight ViewportHeight `json:"viewport_height"`
 	ViewportWidth  ViewportWidth  `json:"viewport_width"`
 }
@@ -147,12 +886,181 @@ type SceneParams struct {
 // Search defines model for Search.
 type Search string
 
-// Sort defines model for Sort.
-type Sort string
+// Selection defines model for Selection.
+type Selection struct {
+	CollectionId CollectionId `json:"collection_id"`
+
+	// Number of selected files
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time the selection is deleted at unless it is changed before
+	ExpiresAt time.Time   `json:"expires_at"`
+	Id        SelectionId `json:"id"`
+
+	// Tag holding the selected files, which can be searched for, e.g. to show them in a scene
+	Tag string `json:"tag"`
+}
+
+// SelectionConversion defines model for SelectionConversion.
+type SelectionConversion struct {
+	// Link exporting the selected files as a static website
+	ExportUrl *string     `json:"export_url,omitempty"`
+	Search    *UserSearch `json:"search,omitempty"`
+	Tag       *Tag        `json:"tag,omitempty"`
+}
+
+// SelectionConvert defines model for SelectionConvert.
+type SelectionConvert struct {
+	// Name of the tag or the album the files are added to, required unless exporting
+	Name *string            `json:"name,omitempty"`
+	To   SelectionConvertTo `json:"to"`
+}
+
+// SelectionConvertTo defines model for SelectionConvert.To.
+type SelectionConvertTo string
+
+// Perform the specified operation on the selection for the specified
+// files. You need to provide either a `scene_id` & `bounds` or
+// `file_ids`.
+type SelectionFilesPost struct {
+	Bounds  *Bounds   `json:"bounds,omitempty"`
+	FileIds *[]FileId `json:"file_ids,omitempty"`
+	Op      Operation `json:"op"`
+	SceneId *SceneId  `json:"scene_id,omitempty"`
+}
+
+// SelectionId defines model for SelectionId.
+type SelectionId int64
+
+// SelectionPost defines model for SelectionPost.
+type SelectionPost struct {
+	CollectionId CollectionId `json:"collection_id"`
+}
+
+// SheetPost defines model for SheetPost.
+type SheetPost struct {
+	// Show the file name and date below each photo
+	Captions     *bool        `json:"captions,omitempty"`
+	CollectionId CollectionId `json:"collection_id"`
+	Columns      *int         `json:"columns,omitempty"`
+
+	// Resolution of the photos
+	Dpi *int `json:"dpi,omitempty"`
+
+	// Only include these files, e.g. the current selection
+	FileIds *[]FileId        `json:"file_ids,omitempty"`
+	Format  *SheetPostFormat `json:"format,omitempty"`
+
+	// Only include files taken on or after this date
+	From      *openapi_types.Date `json:"from,omitempty"`
+	Landscape *bool               `json:"landscape,omitempty"`
+
+	// Page rendered as a JPEG, starting at 1
+	Page  *int            `json:"page,omitempty"`
+	Paper *SheetPostPaper `json:"paper,omitempty"`
+	Rows  *int            `json:"rows,omitempty"`
+
+	// Only include files with this tag
+	Tag *string `json:"tag,omitempty"`
+
+	// Title shown on each page, the collection name by default
+	Title *string `json:"title,omitempty"`
+
+	// Only include files taken on or before this date
+	To *openapi_types.Date `json:"to,omitempty"`
+}
+
+// SheetPostFormat defines model for SheetPost.Format.
+type SheetPostFormat string
+
+// SheetPostPaper defines model for SheetPost.Paper.
+type SheetPostPaper string
+
+// SimilarFile defines model for SimilarFile.
+type SimilarFile struct {
+	Filename string `json:"filename"`
+	Id       FileId `json:"id"`
+
+	// Cosine similarity of the embeddings, from -1 to 1
+	Similarity float32 `json:"similarity"`
+}
+
+// Sort defines model for Sort.
+type Sort string
+
+// Spacing between photos and rows of the album and timeline layouts,
+// 2% of the image height by default
+type Spacing float32
+
+// StateKey defines model for StateKey.
+type StateKey string
+
+// Storage used by the files, the duplicates are the copies of files with the same contents beyond the first, which could be removed to free their bytes
+type StorageStats struct {
+	Bytes int64 `json:"bytes"`
+
+	// Usage of the files directly in each dir, the largest first
+	Dirs       []DirUsage   `json:"dirs"`
+	Duplicates StorageUsage `json:"duplicates"`
+
+	// Usage by lowercase extension, the largest first
+	Extensions []ExtensionUsage `json:"extensions"`
+	Files      int              `json:"files"`
+	Largest    []FileSize       `json:"largest"`
+
+	// Files without a known size, not included in the rest
+	Unsized int `json:"unsized"`
+}
+
+// StorageUsage defines model for StorageUsage.
+type StorageUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// Subject defines model for Subject.
+type Subject struct {
+	// Class of the subject
+	Class        string       `json:"class"`
+	CollectionId CollectionId `json:"collection_id"`
+	Count        int          `json:"count"`
+	Cover        FileId       `json:"cover"`
+
+	// Files of the subject, the most typical first, only included when getting a single subject
+	Files *[]FileId `json:"files,omitempty"`
+	Id    SubjectId `json:"id"`
+
+	// Search showing the photos tagged with the subject tag when creating a scene of the collection, omitted if it is not labeled
+	Search *string `json:"search,omitempty"`
+
+	// Subject tag most of the labeled files of the subject have, omitted if it is not labeled
+	Tag *string `json:"tag,omitempty"`
+}
+
+// SubjectId defines model for SubjectId.
+type SubjectId int
+
+// SubjectLabel defines model for SubjectLabel.
+type SubjectLabel struct {
+	Name string `json:"name"`
+}
 
 // Tag defines model for Tag.
 type Tag struct {
-	Id *string `json:"id,omitempty"`
+	Color       *string `json:"color,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Icon        *string `json:"icon,omitempty"`
+	Id          *string `json:"id,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	Pinned      *bool   `json:"pinned,omitempty"`
+	Revision    *int    `json:"revision,omitempty"`
+}
+
+// TagCount defines model for TagCount.
+type TagCount struct {
+	Count int    `json:"count"`
+	Name  string `json:"name"`
 }
 
 // Perform the specified tag operation for the specified files.
@@ -167,6 +1075,71 @@ type TagFilesPost struct {
 // TagId defines model for TagId.
 type TagId string
 
+// Moves the files of the tag to the `into` tag, deleting the tag.
+type TagMerge struct {
+	Into TagId `json:"into"`
+}
+
+// TagMeta defines model for TagMeta.
+type TagMeta struct {
+	// Hex color of the tag
+	Color       *string `json:"color,omitempty"`
+	Description *string `json:"description,omitempty"`
+
+	// Emoji or name of the icon shown next to the tag
+	Icon *string `json:"icon,omitempty"`
+
+	// Pinned tags are listed first
+	Pinned *bool `json:"pinned,omitempty"`
+}
+
+// TagRename defines model for TagRename.
+type TagRename struct {
+	Name string `json:"name"`
+}
+
+// TagRevision defines model for TagRevision.
+type TagRevision struct {
+	// Number of files added by the revision
+	Added     int       `json:"added"`
+	ChangedAt time.Time `json:"changed_at"`
+
+	// Number of files with the tag after the revision
+	Count int `json:"count"`
+
+	// Operation that made the revision
+	Op TagRevisionOp `json:"op"`
+
+	// Number of files removed by the revision
+	Removed  int `json:"removed"`
+	Revision int `json:"revision"`
+}
+
+// Operation that made the revision
+type TagRevisionOp string
+
+// TagRevisionDiff defines model for TagRevisionDiff.
+type TagRevisionDiff struct {
+	Added   []FileId `json:"added"`
+	From    int      `json:"from"`
+	Removed []FileId `json:"removed"`
+	To      int      `json:"to"`
+}
+
+// TagRollback defines model for TagRollback.
+type TagRollback struct {
+	// Revision the files of the tag are rolled back to
+	Revision int `json:"revision"`
+}
+
+// TagSuggestion defines model for TagSuggestion.
+type TagSuggestion struct {
+	Confidence float32 `json:"confidence"`
+	Label      string  `json:"label"`
+	Name       string  `json:"name"`
+	TagId      TagId   `json:"tag_id"`
+}
+
 // Create a new tag based on the provided parameters.
 type TagsPost struct {
 	CollectionId *CollectionId `json:"collection_id,omitempty"`
@@ -196,27 +1169,360 @@ type TaskType string
 // TileCoord defines model for TileCoord.
 type TileCoord int
 
+// Trip defines model for Trip.
+type Trip struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Count        int          `json:"count"`
+	Cover        FileId       `json:"cover"`
+	End          time.Time    `json:"end"`
+	Id           TripId       `json:"id"`
+
+	// Location of the most common place, omitted if no photo has a location
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+
+	// Named after the most common place and the dates
+	Name string `json:"name"`
+
+	// Search showing the photos of the trip as an album when creating a scene of the collection
+	Search string    `json:"search"`
+	Start  time.Time `json:"start"`
+}
+
+// TripId defines model for TripId.
+type TripId int
+
+// UploadedFile defines model for UploadedFile.
+type UploadedFile struct {
+	// Name of the uploaded file
+	Filename string `json:"filename"`
+	Id       FileId `json:"id"`
+
+	// Path the file was stored at
+	Path string `json:"path"`
+}
+
+// UserSearch defines model for UserSearch.
+type UserSearch struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Id           UserSearchId `json:"id"`
+
+	// Name of the smart album if saved
+	Name  *string `json:"name,omitempty"`
+	Query Search  `json:"query"`
+
+	// Whether the search is saved as a smart album
+	Saved      bool      `json:"saved"`
+	SearchedAt time.Time `json:"searched_at"`
+}
+
+// UserSearchId defines model for UserSearchId.
+type UserSearchId int64
+
+// UserSearchPost defines model for UserSearchPost.
+type UserSearchPost struct {
+	CollectionId CollectionId `json:"collection_id"`
+
+	// Name of the smart album
+	Name  string `json:"name"`
+	Query Search `json:"query"`
+}
+
+// UserState defines model for UserState.
+type UserState struct {
+	Key       StateKey  `json:"key"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Any JSON value
+	Value interface{} `json:"value"`
+
+	// Incremented on every change
+	Version int64 `json:"version"`
+}
+
+// UserStatePut defines model for UserStatePut.
+type UserStatePut struct {
+	// Any JSON value, at most 64 KiB encoded
+	Value interface{} `json:"value"`
+
+	// Version the value is based on, 0 if the key is expected not to exist yet. Replaces the value regardless of the current version if not set.
+	Version *int64 `json:"version,omitempty"`
+}
+
+// Verification defines model for Verification.
+type Verification struct {
+	// Hash found on a mismatch, or why the file could not be read
+	Detail *string `json:"detail,omitempty"`
+	Id     FileId  `json:"id"`
+
+	// Modification time of the file, a recent one on a mismatch hints at an edit rather than corruption
+	ModifiedAt *time.Time         `json:"modified_at,omitempty"`
+	Path       string             `json:"path"`
+	Status     VerificationStatus `json:"status"`
+	VerifiedAt time.Time          `json:"verified_at"`
+}
+
+// VerificationStatus defines model for Verification.Status.
+type VerificationStatus string
+
 // ViewportHeight defines model for ViewportHeight.
 type ViewportHeight float32
 
 // ViewportWidth defines model for ViewportWidth.
 type ViewportWidth float32
 
+// YearCount defines model for YearCount.
+type YearCount struct {
+	Count int `json:"count"`
+	Year  int `json:"year"`
+}
+
+// CameraIdPathParam defines model for CameraIdPathParam.
+type CameraIdPathParam CameraId
+
 // FileIdPathParam defines model for FileIdPathParam.
 type FileIdPathParam FileId
 
 // FilenamePathParam defines model for FilenamePathParam.
 type FilenamePathParam string
 
+// PanoramaIdPathParam defines model for PanoramaIdPathParam.
+type PanoramaIdPathParam PanoramaId
+
 // SearchParam defines model for SearchParam.
 type SearchParam Search
 
+// SelectionIdPathParam defines model for SelectionIdPathParam.
+type SelectionIdPathParam SelectionId
+
 // SizePathParam defines model for SizePathParam.
 type SizePathParam string
 
+// StateKeyPathParam defines model for StateKeyPathParam.
+type StateKeyPathParam StateKey
+
+// SubjectIdPathParam defines model for SubjectIdPathParam.
+type SubjectIdPathParam SubjectId
+
 // TagIdPathParam defines model for TagIdPathParam.
 type TagIdPathParam TagId
 
+// TripIdPathParam defines model for TripIdPathParam.
+type TripIdPathParam TripId
+
+// UserSearchIdPathParam defines model for UserSearchIdPathParam.
+type UserSearchIdPathParam UserSearchId
+
+// GetAuditParams defines parameters for GetAudit.
+type GetAuditParams struct {
+	// Only list entries of this API key or user name, empty for anonymous requests.
+	Actor *string `json:"actor,omitempty"`
+
+	// Only list entries of this action.
+	Action *AuditAction `json:"action,omitempty"`
+
+	// Only list entries affecting this file.
+	FileId *FileId `json:"file_id,omitempty"`
+
+	// Only list entries created at or after this time.
+	Since *time.Time `json:"since,omitempty"`
+
+	// Only list entries older than this cursor.
+	Before *int64 `json:"before,omitempty"`
+
+	// Maximum number of entries to return.
+	Limit *int `json:"limit,omitempty"`
+}
+
+// PostCamerasCalibrateJSONBody defines parameters for PostCamerasCalibrate.
+type PostCamerasCalibrateJSONBody CameraCalibratePost
+
+// PutCamerasIdJSONBody defines parameters for PutCamerasId.
+type PutCamerasIdJSONBody CameraPut
+
+// GetChangesParams defines parameters for GetChanges.
+type GetChangesParams struct {
+	// Opaque cursor returned from a previous request, list all changes from the beginning if omitted.
+	Cursor *int64 `json:"cursor,omitempty"`
+
+	// Maximum number of changes to return.
+	Limit *int `json:"limit,omitempty"`
+
+	// Only list changes of files within this collection.
+	CollectionId *CollectionId `json:"collection_id,omitempty"`
+}
+
+// GetCollectionsIdExportParams defines parameters for GetCollectionsIdExport.
+type GetCollectionsIdExportParams struct {
+	// Only export photos matching the query, only tag qualifiers are supported, e.g. "tag:kids".
+	Query *string `json:"query,omitempty"`
+
+	// Include the original files for download.
+	Originals *bool `json:"originals,omitempty"`
+}
+
+// GetCollectionsIdFeedParams defines parameters for GetCollectionsIdFeed.
+type GetCollectionsIdFeedParams struct {
+	// Format of the feed, Atom, RSS 2.0 or JSON Feed 1.1.
+	Format *GetCollectionsIdFeedParamsFormat `json:"format,omitempty"`
+
+	// Maximum number of files in the feed.
+	Limit *int `json:"limit,omitempty"`
+}
+
+// GetCollectionsIdFeedParamsFormat defines parameters for GetCollectionsIdFeed.
+type GetCollectionsIdFeedParamsFormat string
+
+// PostCollectionsIdGeotagParams defines parameters for PostCollectionsIdGeotag.
+type PostCollectionsIdGeotagParams struct {
+	// Seconds added to the capture times of the photos, e.g. to correct for a camera clock set to the wrong timezone
+	TimeOffset *int `json:"time_offset,omitempty"`
+
+	// Largest number of seconds between two track points to interpolate between them, or between a photo and the nearest track point otherwise
+	MaxGap *int `json:"max_gap,omitempty"`
+
+	// Replace the locations of photos that already have one
+	Overwrite *bool `json:"overwrite,omitempty"`
+
+	// Also write the locations to new XMP sidecars next to the photos, skipping photos that already have one
+	WriteXmp *bool `json:"write_xmp,omitempty"`
+
+	// Only report which photos would be geotagged
+	DryRun *bool `json:"dry_run,omitempty"`
+}
+
+// GetCollectionsIdIndexReportParams defines parameters for GetCollectionsIdIndexReport.
+type GetCollectionsIdIndexReportParams struct {
+	// Paths listed per kind of change
+	Samples *int `json:"samples,omitempty"`
+}
+
+// PostCollectionsIdSimilarParams defines parameters for PostCollectionsIdSimilar.
+type PostCollectionsIdSimilarParams struct {
+	// Maximum number of files returned
+	Limit *int `json:"limit,omitempty"`
+}
+
+// GetCollectionsIdStatsParams defines parameters for GetCollectionsIdStats.
+type GetCollectionsIdStatsParams struct {
+	// Cameras, countries and tags listed
+	Top *int `json:"top,omitempty"`
+}
+
+// GetCollectionsIdStorageParams defines parameters for GetCollectionsIdStorage.
+type GetCollectionsIdStorageParams struct {
+	// Dirs and largest files listed
+	Top *int `json:"top,omitempty"`
+}
+
+// PostFilesLocationJSONBody defines parameters for PostFilesLocation.
+type PostFilesLocationJSONBody LocationPost
+
+// PutFilesIdCaptionJSONBody defines parameters for PutFilesIdCaption.
+type PutFilesIdCaptionJSONBody Caption
+
+// PutFilesIdLocationJSONBody defines parameters for PutFilesIdLocation.
+type PutFilesIdLocationJSONBody Location
+
+// PutFilesIdOrientationJSONBody defines parameters for PutFilesIdOrientation.
+type PutFilesIdOrientationJSONBody OrientationEdit
+
+// GetFilesIdPrintParams defines parameters for GetFilesIdPrint.
+type GetFilesIdPrintParams struct {
+	Format *GetFilesIdPrintParamsFormat `json:"format,omitempty"`
+
+	// Color profile to convert the photo to, or original to keep the profile of the photo as is
+	Profile *GetFilesIdPrintParamsProfile `json:"profile,omitempty"`
+
+	// White border around the photo in percent of its longer side
+	Border *int `json:"border,omitempty"`
+
+	// Caption shown below the photo
+	Caption *string `json:"caption,omitempty"`
+
+	// Resolution stored in the file, in dots per inch
+	Dpi *int `json:"dpi,omitempty"`
+}
+
+// GetFilesIdPrintParamsFormat defines parameters for GetFilesIdPrint.
+type GetFilesIdPrintParamsFormat string
+
+// GetFilesIdPrintParamsProfile defines parameters for GetFilesIdPrint.
+type GetFilesIdPrintParamsProfile string
+
+// GetFilesIdViewJpgParams defines parameters for GetFilesIdViewJpg.
+type GetFilesIdViewJpgParams struct {
+	// Degrees right of the center of the panorama
+	Yaw *float32 `json:"yaw,omitempty"`
+
+	// Degrees above the horizon
+	Pitch *float32 `json:"pitch,omitempty"`
+
+	// Horizontal field of view in degrees
+	Fov    *float32 `json:"fov,omitempty"`
+	Width  *int     `json:"width,omitempty"`
+	Height *int     `json:"height,omitempty"`
+}
+
+// GetMemoriesParams defines parameters for GetMemories.
+type GetMemoriesParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+
+	// Day to get the memories of, today by default
+	Date   *openapi_types.Date `json:"date,omitempty"`
+	Filter *MemoryFilter       `json:"filter,omitempty"`
+	Limit  *int                `json:"limit,omitempty"`
+}
+
+// GetOrientationProposalsParams defines parameters for GetOrientationProposals.
+type GetOrientationProposalsParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
+}
+
+// PostOrientationProposalsAcceptJSONBody defines parameters for PostOrientationProposalsAccept.
+type PostOrientationProposalsAcceptJSONBody OrientationProposalsPost
+
+// PostOrientationProposalsRejectJSONBody defines parameters for PostOrientationProposalsReject.
+type PostOrientationProposalsRejectJSONBody OrientationProposalsPost
+
+// GetPanoramasParams defines parameters for GetPanoramas.
+type GetPanoramasParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
+}
+
+// GetPlacesParams defines parameters for GetPlaces.
+type GetPlacesParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+
+	// Search custom text query
+	Q     *SearchParam `json:"q,omitempty"`
+	Limit *int         `json:"limit,omitempty"`
+}
+
+// GetQuarantineParams defines parameters for GetQuarantine.
+type GetQuarantineParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
+}
+
+// PostQueryJSONBody defines parameters for PostQuery.
+type PostQueryJSONBody struct {
+	// Maximum number of rows to return, capped at the configured maximum.
+	Limit *int   `json:"limit,omitempty"`
+	Sql   string `json:"sql"`
+}
+
+// PostQueryParams defines parameters for PostQuery.
+type PostQueryParams struct {
+	// Format of the rows, overrides the Accept header.
+	Format *PostQueryParamsFormat `json:"format,omitempty"`
+}
+
+// PostQueryParamsFormat defines parameters for PostQuery.
+type PostQueryParamsFormat string
+
 // GetScenesParams defines parameters for GetScenes.
 type GetScenesParams struct {
 	// Collection ID
@@ -227,6 +1533,9 @@ type GetScenesParams struct {
 	Layout         *LayoutType     `json:"layout,omitempty"`
 	Sort           *Sort           `json:"sort,omitempty"`
 	Search         *Search         `json:"search,omitempty"`
+	Spacing        *Spacing        `json:"spacing,omitempty"`
+	MaxRowSlop     *MaxRowSlop     `json:"max_row_slop,omitempty"`
+	Panorama       *PanoramaLayout `json:"panorama,omitempty"`
 }
 
 // PostScenesJSONBody defines parameters for PostScenes.
@@ -237,6 +1546,9 @@ type GetScenesSceneIdDatesParams struct {
 	Height int `json:"height"`
 }
 
+// PostScenesSceneIdPrefetchJSONBody defines parameters for PostScenesSceneIdPrefetch.
+type PostScenesSceneIdPrefetchJSONBody PrefetchPost
+
 // GetScenesSceneIdRegionsParams defines parameters for GetScenesSceneIdRegions.
 type GetScenesSceneIdRegionsParams struct {
 	X     float32 `json:"x"`
@@ -259,8 +1571,60 @@ type GetScenesSceneIdTilesParams struct {
 	SelectTag       *string `json:"select_tag,omitempty"`
 	DebugOverdraw   *bool   `json:"debug_overdraw,omitempty"`
 	DebugThumbnails *bool   `json:"debug_thumbnails,omitempty"`
+
+	// Whether the tile is visible or prefetched ahead of being visible. Prefetched tiles are rendered only once no visible tiles are waiting.
+	Priority *GetScenesSceneIdTilesParamsPriority `json:"priority,omitempty"`
+}
+
+// GetScenesSceneIdTilesParamsPriority defines parameters for GetScenesSceneIdTiles.
+type GetScenesSceneIdTilesParamsPriority string
+
+// GetSearchesParams defines parameters for GetSearches.
+type GetSearchesParams struct {
+	// Only get the searches saved as smart albums.
+	Saved *bool `json:"saved,omitempty"`
+	Limit *int  `json:"limit,omitempty"`
+}
+
+// PostSearchesJSONBody defines parameters for PostSearches.
+type PostSearchesJSONBody UserSearchPost
+
+// GetSelectionsParams defines parameters for GetSelections.
+type GetSelectionsParams struct {
+	// Only get the selections of files of the collection.
+	CollectionId *CollectionId `json:"collection_id,omitempty"`
+}
+
+// PostSelectionsJSONBody defines parameters for PostSelections.
+type PostSelectionsJSONBody SelectionPost
+
+// PostSelectionsIdConvertJSONBody defines parameters for PostSelectionsIdConvert.
+type PostSelectionsIdConvertJSONBody SelectionConvert
+
+// PostSelectionsIdFilesJSONBody defines parameters for PostSelectionsIdFiles.
+type PostSelectionsIdFilesJSONBody SelectionFilesPost
+
+// PostSheetsJSONBody defines parameters for PostSheets.
+type PostSheetsJSONBody SheetPost
+
+// DeleteStateKeyParams defines parameters for DeleteStateKey.
+type DeleteStateKeyParams struct {
+	// Only delete the key if it was not changed since this version.
+	Version *int64 `json:"version,omitempty"`
+}
+
+// PutStateKeyJSONBody defines parameters for PutStateKey.
+type PutStateKeyJSONBody UserStatePut
+
+// GetSubjectsParams defines parameters for GetSubjects.
+type GetSubjectsParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
 }
 
+// PostSubjectsIdLabelJSONBody defines parameters for PostSubjectsIdLabel.
+type PostSubjectsIdLabelJSONBody SubjectLabel
+
 // GetTagsParams defines parameters for GetTags.
 type GetTagsParams struct {
 	// Search custom text query
@@ -270,9 +1634,34 @@ type GetTagsParams struct {
 // PostTagsJSONBody defines parameters for PostTags.
 type PostTagsJSONBody TagsPost
 
+// PutTagsIdJSONBody defines parameters for PutTagsId.
+type PutTagsIdJSONBody TagMeta
+
 // PostTagsIdFilesJSONBody defines parameters for PostTagsIdFiles.
 type PostTagsIdFilesJSONBody TagFilesPost
 
+// PostTagsIdMergeJSONBody defines parameters for PostTagsIdMerge.
+type PostTagsIdMergeJSONBody TagMerge
+
+// PostTagsIdRenameJSONBody defines parameters for PostTagsIdRename.
+type PostTagsIdRenameJSONBody TagRename
+
+// GetTagsIdRevisionsParams defines parameters for GetTagsIdRevisions.
+type GetTagsIdRevisionsParams struct {
+	Limit *int `json:"limit,omitempty"`
+}
+
+// GetTagsIdRevisionsDiffParams defines parameters for GetTagsIdRevisionsDiff.
+type GetTagsIdRevisionsDiffParams struct {
+	From int `json:"from"`
+
+	// Revision compared to, the current one if omitted
+	To *int `json:"to,omitempty"`
+}
+
+// PostTagsIdRollbackJSONBody defines parameters for PostTagsIdRollback.
+type PostTagsIdRollbackJSONBody TagRollback
+
 // GetTasksParams defines parameters for GetTasks.
 type GetTasksParams struct {
 	// Task type to filter on.
@@ -285,93 +1674,2901 @@ type GetTasksParams struct {
 // PostTasksJSONBody defines parameters for PostTasks.
 type PostTasksJSONBody struct {
 	CollectionId CollectionId `json:"collection_id"`
-	Type         TaskType     `json:"type"`
+
+	// Only index the files matching the glob pattern within the collection, where `*` matches within a directory and `**` across directories. Supported by the index tasks.
+	Glob *string `json:"glob,omitempty"`
+
+	// Only index the subdirectory at the path within the collection, either relative to one of its dirs or absolute. Supported by the index tasks.
+	Path *string  `json:"path,omitempty"`
+	Type TaskType `json:"type"`
+}
+
+// GetTripsParams defines parameters for GetTrips.
+type GetTripsParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
+}
+
+// GetVerificationParams defines parameters for GetVerification.
+type GetVerificationParams struct {
+	CollectionId CollectionId `json:"collection_id"`
+	Limit        *int         `json:"limit,omitempty"`
 }
 
+// PostCamerasCalibrateJSONRequestBody defines body for PostCamerasCalibrate for application/json ContentType.
+type PostCamerasCalibrateJSONRequestBody PostCamerasCalibrateJSONBody
+
+// PutCamerasIdJSONRequestBody defines body for PutCamerasId for application/json ContentType.
+type PutCamerasIdJSONRequestBody PutCamerasIdJSONBody
+
+// PostFilesLocationJSONRequestBody defines body for PostFilesLocation for application/json ContentType.
+type PostFilesLocationJSONRequestBody PostFilesLocationJSONBody
+
+// PutFilesIdCaptionJSONRequestBody defines body for PutFilesIdCaption for application/json ContentType.
+type PutFilesIdCaptionJSONRequestBody PutFilesIdCaptionJSONBody
+
+// PutFilesIdLocationJSONRequestBody defines body for PutFilesIdLocation for application/json ContentType.
+type PutFilesIdLocationJSONRequestBody PutFilesIdLocationJSONBody
+
+// PutFilesIdOrientationJSONRequestBody defines body for PutFilesIdOrientation for application/json ContentType.
+type PutFilesIdOrientationJSONRequestBody PutFilesIdOrientationJSONBody
+
+// PostOrientationProposalsAcceptJSONRequestBody defines body for PostOrientationProposalsAccept for application/json ContentType.
+type PostOrientationProposalsAcceptJSONRequestBody PostOrientationProposalsAcceptJSONBody
+
+// PostOrientationProposalsRejectJSONRequestBody defines body for PostOrientationProposalsReject for application/json ContentType.
+type PostOrientationProposalsRejectJSONRequestBody PostOrientationProposalsRejectJSONBody
+
+// PostQueryJSONRequestBody defines body for PostQuery for application/json ContentType.
+type PostQueryJSONRequestBody PostQueryJSONBody
+
 // PostScenesJSONRequestBody defines body for PostScenes for application/json ContentType.
 type PostScenesJSONRequestBody PostScenesJSONBody
 
+// PostScenesSceneIdPrefetchJSONRequestBody defines body for PostScenesSceneIdPrefetch for application/json ContentType.
+type PostScenesSceneIdPrefetchJSONRequestBody PostScenesSceneIdPrefetchJSONBody
+
+// PostSearchesJSONRequestBody defines body for PostSearches for application/json ContentType.
+type PostSearchesJSONRequestBody PostSearchesJSONBody
+
+// PostSelectionsJSONRequestBody defines body for PostSelections for application/json ContentType.
+type PostSelectionsJSONRequestBody PostSelectionsJSONBody
+
+// PostSelectionsIdConvertJSONRequestBody defines body for PostSelectionsIdConvert for application/json ContentType.
+type PostSelectionsIdConvertJSONRequestBody PostSelectionsIdConvertJSONBody
+
+// PostSelectionsIdFilesJSONRequestBody defines body for PostSelectionsIdFiles for application/json ContentType.
+type PostSelectionsIdFilesJSONRequestBody PostSelectionsIdFilesJSONBody
+
+// PostSheetsJSONRequestBody defines body for PostSheets for application/json ContentType.
+type PostSheetsJSONRequestBody PostSheetsJSONBody
+
+// PutStateKeyJSONRequestBody defines body for PutStateKey for application/json ContentType.
+type PutStateKeyJSONRequestBody PutStateKeyJSONBody
+
+// PostSubjectsIdLabelJSONRequestBody defines body for PostSubjectsIdLabel for application/json ContentType.
+type PostSubjectsIdLabelJSONRequestBody PostSubjectsIdLabelJSONBody
+
 // PostTagsJSONRequestBody defines body for PostTags for application/json ContentType.
 type PostTagsJSONRequestBody PostTagsJSONBody
 
-// PostTagsIdFilesJSONRequestBody defines body for PostTagsIdFiles for application/json ContentType.
-type PostTagsIdFilesJSONRequestBody PostTagsIdFilesJSONBody
+// PutTagsIdJSONRequestBody defines body for PutTagsId for application/json ContentType.
+type PutTagsIdJSONRequestBody PutTagsIdJSONBody
+
+// PostTagsIdFilesJSONRequestBody defines body for PostTagsIdFiles for application/json ContentType.
+type PostTagsIdFilesJSONRequestBody PostTagsIdFilesJSONBody
+
+// PostTagsIdMergeJSONRequestBody defines body for PostTagsIdMerge for application/json ContentType.
+type PostTagsIdMergeJSONRequestBody PostTagsIdMergeJSONBody
+
+// PostTagsIdRenameJSONRequestBody defines body for PostTagsIdRename for application/json ContentType.
+type PostTagsIdRenameJSONRequestBody PostTagsIdRenameJSONBody
+
+// PostTagsIdRollbackJSONRequestBody defines body for PostTagsIdRollback for application/json ContentType.
+type PostTagsIdRollbackJSONRequestBody PostTagsIdRollbackJSONBody
+
+// PostTasksJSONRequestBody defines body for PostTasks for application/json ContentType.
+type PostTasksJSONRequestBody PostTasksJSONBody
+
+// Getter for additional properties for Problem_Details. Returns the specified
+// element and whether it was found
+func (a Problem_Details) Get(fieldName string) (value interface{}, found bool) {
+	if a.AdditionalProperties != nil {
+		value, found = a.AdditionalProperties[fieldName]
+	}
+	return
+}
+
+// Setter for additional properties for Problem_Details
+func (a *Problem_Details) Set(fieldName string, value interface{}) {
+	if a.AdditionalProperties == nil {
+		a.AdditionalProperties = make(map[string]interface{})
+	}
+	a.AdditionalProperties[fieldName] = value
+}
+
+// Override default JSON handling for Problem_Details to handle AdditionalProperties
+func (a *Problem_Details) UnmarshalJSON(b []byte) error {
+	object := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &object)
+	if err != nil {
+		return err
+	}
+
+	if len(object) != 0 {
+		a.AdditionalProperties = make(map[string]interface{})
+		for fieldName, fieldBuf := range object {
+			var fieldVal interface{}
+			err := json.Unmarshal(fieldBuf, &fieldVal)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("error unmarshaling field %s", fieldName))
+			}
+			a.AdditionalProperties[fieldName] = fieldVal
+		}
+	}
+	return nil
+}
+
+// Override default JSON handling for Problem_Details to handle AdditionalProperties
+func (a Problem_Details) MarshalJSON() ([]byte, error) {
+	var err error
+	object := make(map[string]json.RawMessage)
+
+	for fieldName, field := range a.AdditionalProperties {
+		object[fieldName], err = json.Marshal(field)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error marshaling '%s'", fieldName))
+		}
+	}
+	return json.Marshal(object)
+}
+
+// ServerInterface represents all server handlers.
+type ServerInterface interface {
+
+	// (GET /audit)
+	GetAudit(w http.ResponseWriter, r *http.Request, params GetAuditParams)
+
+	// (GET /cameras)
+	GetCameras(w http.ResponseWriter, r *http.Request)
+
+	// (POST /cameras/calibrate)
+	PostCamerasCalibrate(w http.ResponseWriter, r *http.Request)
+
+	// (PUT /cameras/{id})
+	PutCamerasId(w http.ResponseWriter, r *http.Request, id CameraIdPathParam)
+
+	// (GET /capabilities)
+	GetCapabilities(w http.ResponseWriter, r *http.Request)
+
+	// (GET /changes)
+	GetChanges(w http.ResponseWriter, r *http.Request, params GetChangesParams)
+
+	// (GET /collections)
+	GetCollections(w http.ResponseWriter, r *http.Request)
+
+	// (GET /collections/{id})
+	GetCollectionsId(w http.ResponseWriter, r *http.Request, id CollectionId)
+
+	// (GET /collections/{id}/export)
+	GetCollectionsIdExport(w http.ResponseWriter, r *http.Request, id CollectionId, params GetCollectionsIdExportParams)
+
+	// (GET /collections/{id}/feed)
+	GetCollectionsIdFeed(w http.ResponseWriter, r *http.Request, id CollectionId, params GetCollectionsIdFeedParams)
+
+	// (POST /collections/{id}/files)
+	PostCollectionsIdFiles(w http.ResponseWriter, r *http.Request, id CollectionId)
+
+	// (POST /collections/{id}/geotag)
+	PostCollectionsIdGeotag(w http.ResponseWriter, r *http.Request, id CollectionId, params PostCollectionsIdGeotagParams)
+
+	// (GET /collections/{id}/index-report)
+	GetCollectionsIdIndexReport(w http.ResponseWriter, r *http.Request, id CollectionId, params GetCollectionsIdIndexReportParams)
+
+	// (GET /collections/{id}/preview)
+	GetCollectionsIdPreview(w http.ResponseWriter, r *http.Request, id CollectionId)
+
+	// (POST /collections/{id}/similar)
+	PostCollectionsIdSimilar(w http.ResponseWriter, r *http.Request, id CollectionId, params PostCollectionsIdSimilarParams)
+
+	// (GET /collections/{id}/stats)
+	GetCollectionsIdStats(w http.ResponseWriter, r *http.Request, id CollectionId, params GetCollectionsIdStatsParams)
+
+	// (GET /collections/{id}/storage)
+	GetCollectionsIdStorage(w http.ResponseWriter, r *http.Request, id CollectionId, params GetCollectionsIdStorageParams)
+
+	// (GET /diagnostics)
+	GetDiagnostics(w http.ResponseWriter, r *http.Request)
+
+	// (POST /files/location)
+	PostFilesLocation(w http.ResponseWriter, r *http.Request)
+
+	// (GET /files/{id})
+	GetFilesId(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/audio)
+	GetFilesIdAudio(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (DELETE /files/{id}/caption)
+	DeleteFilesIdCaption(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (PUT /files/{id}/caption)
+	PutFilesIdCaption(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/deepzoom.dzi)
+	GetFilesIdDeepzoomDzi(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/deepzoom_files/{level}/{tile})
+	GetFilesIdDeepzoomFilesLevelTile(w http.ResponseWriter, r *http.Request, id FileIdPathParam, level int, tile string)
+
+	// (DELETE /files/{id}/location)
+	DeleteFilesIdLocation(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (PUT /files/{id}/location)
+	PutFilesIdLocation(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/motion.mp4)
+	GetFilesIdMotionMp4(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (PUT /files/{id}/orientation)
+	PutFilesIdOrientation(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/original/{filename})
+	GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request, id FileIdPathParam, filename FilenamePathParam)
+
+	// (GET /files/{id}/print)
+	GetFilesIdPrint(w http.ResponseWriter, r *http.Request, id FileIdPathParam, params GetFilesIdPrintParams)
+
+	// (POST /files/{id}/reprocess)
+	PostFilesIdReprocess(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/scrub.jpg)
+	GetFilesIdScrubJpg(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/scrub.vtt)
+	GetFilesIdScrubVtt(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/tag-suggestions)
+	GetFilesIdTagSuggestions(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /files/{id}/variants/{size}/{filename})
+	GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request, id FileIdPathParam, size SizePathParam, filename FilenamePathParam)
+
+	// (GET /files/{id}/view.jpg)
+	GetFilesIdViewJpg(w http.ResponseWriter, r *http.Request, id FileIdPathParam, params GetFilesIdViewJpgParams)
+
+	// (GET /iiif/{id})
+	GetIiifId(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /iiif/{id}/info.json)
+	GetIiifIdInfoJson(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+
+	// (GET /iiif/{id}/{region}/{size}/{rotation}/{quality})
+	GetIiifIdRegionSizeRotationQuality(w http.ResponseWriter, r *http.Request, id FileIdPathParam, region string, size string, rotation string, quality string)
+
+	// (GET /memories)
+	GetMemories(w http.ResponseWriter, r *http.Request, params GetMemoriesParams)
+
+	// (GET /orientation/proposals)
+	GetOrientationProposals(w http.ResponseWriter, r *http.Request, params GetOrientationProposalsParams)
+
+	// (POST /orientation/proposals/accept)
+	PostOrientationProposalsAccept(w http.ResponseWriter, r *http.Request)
+
+	// (POST /orientation/proposals/reject)
+	PostOrientationProposalsReject(w http.ResponseWriter, r *http.Request)
+
+	// (GET /panoramas)
+	GetPanoramas(w http.ResponseWriter, r *http.Request, params GetPanoramasParams)
+
+	// (DELETE /panoramas/{id})
+	DeletePanoramasId(w http.ResponseWriter, r *http.Request, id PanoramaIdPathParam)
+
+	// (GET /panoramas/{id})
+	GetPanoramasId(w http.ResponseWriter, r *http.Request, id PanoramaIdPathParam)
+
+	// (GET /panoramas/{id}/preview)
+	GetPanoramasIdPreview(w http.ResponseWriter, r *http.Request, id PanoramaIdPathParam)
+
+	// (GET /places)
+	GetPlaces(w http.ResponseWriter, r *http.Request, params GetPlacesParams)
+
+	// (GET /quarantine)
+	GetQuarantine(w http.ResponseWriter, r *http.Request, params GetQuarantineParams)
+
+	// (POST /query)
+	PostQuery(w http.ResponseWriter, r *http.Request, params PostQueryParams)
+
+	// (GET /scenes)
+	GetScenes(w http.ResponseWriter, r *http.Request, params GetScenesParams)
+
+	// (POST /scenes)
+	PostScenes(w http.ResponseWriter, r *http.Request)
+
+	// (GET /scenes/{id})
+	GetScenesId(w http.ResponseWriter, r *http.Request, id SceneId)
+
+	// (GET /scenes/{scene_id}/dates)
+	GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdDatesParams)
+
+	// (POST /scenes/{scene_id}/prefetch)
+	PostScenesSceneIdPrefetch(w http.ResponseWriter, r *http.Request, sceneId SceneId)
+
+	// (GET /scenes/{scene_id}/regions)
+	GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdRegionsParams)
+
+	// (GET /scenes/{scene_id}/regions/{id})
+	GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request, sceneId SceneId, id RegionId)
+
+	// (GET /scenes/{scene_id}/tiles)
+	GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdTilesParams)
+
+	// (GET /searches)
+	GetSearches(w http.ResponseWriter, r *http.Request, params GetSearchesParams)
+
+	// (POST /searches)
+	PostSearches(w http.ResponseWriter, r *http.Request)
+
+	// (DELETE /searches/{id})
+	DeleteSearchesId(w http.ResponseWriter, r *http.Request, id UserSearchIdPathParam)
+
+	// (GET /selections)
+	GetSelections(w http.ResponseWriter, r *http.Request, params GetSelectionsParams)
+
+	// (POST /selections)
+	PostSelections(w http.ResponseWriter, r *http.Request)
+
+	// (DELETE /selections/{id})
+	DeleteSelectionsId(w http.ResponseWriter, r *http.Request, id SelectionIdPathParam)
+
+	// (GET /selections/{id})
+	GetSelectionsId(w http.ResponseWriter, r *http.Request, id SelectionIdPathParam)
+
+	// (POST /selections/{id}/convert)
+	PostSelectionsIdConvert(w http.ResponseWriter, r *http.Request, id SelectionIdPathParam)
+
+	// (POST /selections/{id}/files)
+	PostSelectionsIdFiles(w http.ResponseWriter, r *http.Request, id SelectionIdPathParam)
+
+	// (POST /sheets)
+	PostSheets(w http.ResponseWriter, r *http.Request)
+
+	// (GET /state)
+	GetState(w http.ResponseWriter, r *http.Request)
+
+	// (DELETE /state/{key})
+	DeleteStateKey(w http.ResponseWriter, r *http.Request, key StateKeyPathParam, params DeleteStateKeyParams)
+
+	// (GET /state/{key})
+	GetStateKey(w http.ResponseWriter, r *http.Request, key StateKeyPathParam)
+
+	// (PUT /state/{key})
+	PutStateKey(w http.ResponseWriter, r *http.Request, key StateKeyPathParam)
+
+	// (GET /subjects)
+	GetSubjects(w http.ResponseWriter, r *http.Request, params GetSubjectsParams)
+
+	// (GET /subjects/{id})
+	GetSubjectsId(w http.ResponseWriter, r *http.Request, id SubjectIdPathParam)
+
+	// (POST /subjects/{id}/label)
+	PostSubjectsIdLabel(w http.ResponseWriter, r *http.Request, id SubjectIdPathParam)
+
+	// (GET /tags)
+	GetTags(w http.ResponseWriter, r *http.Request, params GetTagsParams)
+
+	// (POST /tags)
+	PostTags(w http.ResponseWriter, r *http.Request)
+
+	// (PUT /tags/{id})
+	PutTagsId(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+
+	// (POST /tags/{id}/files)
+	PostTagsIdFiles(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+
+	// (POST /tags/{id}/merge)
+	PostTagsIdMerge(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+
+	// (POST /tags/{id}/rename)
+	PostTagsIdRename(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+
+	// (GET /tags/{id}/revisions)
+	GetTagsIdRevisions(w http.ResponseWriter, r *http.Request, id TagIdPathParam, params GetTagsIdRevisionsParams)
+
+	// (GET /tags/{id}/revisions/diff)
+	GetTagsIdRevisionsDiff(w http.ResponseWriter, r *http.Request, id TagIdPathParam, params GetTagsIdRevisionsDiffParams)
+
+	// (POST /tags/{id}/rollback)
+	PostTagsIdRollback(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+
+	// (GET /tasks)
+	GetTasks(w http.ResponseWriter, r *http.Request, params GetTasksParams)
+
+	// (POST /tasks)
+	PostTasks(w http.ResponseWriter, r *http.Request)
+
+	// (GET /trips)
+	GetTrips(w http.ResponseWriter, r *http.Request, params GetTripsParams)
+
+	// (GET /trips/{id})
+	GetTripsId(w http.ResponseWriter, r *http.Request, id TripIdPathParam)
+
+	// (GET /verification)
+	GetVerification(w http.ResponseWriter, r *http.Request, params GetVerificationParams)
+}
+
+// ServerInterfaceWrapper converts contexts to parameters.
+type ServerInterfaceWrapper struct {
+	Handler            ServerInterface
+	HandlerMiddlewares []MiddlewareFunc
+}
+
+type MiddlewareFunc func(http.HandlerFunc) http.HandlerFunc
+
+// GetAudit operation middleware
+func (siw *ServerInterfaceWrapper) GetAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetAuditParams
+
+	// ------------- Optional query parameter "actor" -------------
+	if paramValue := r.URL.Query().Get("actor"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "actor", r.URL.Query(), &params.Actor)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter actor: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "action" -------------
+	if paramValue := r.URL.Query().Get("action"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "action", r.URL.Query(), &params.Action)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter action: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "file_id" -------------
+	if paramValue := r.URL.Query().Get("file_id"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "file_id", r.URL.Query(), &params.FileId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter file_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "since" -------------
+	if paramValue := r.URL.Query().Get("since"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "since", r.URL.Query(), &params.Since)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter since: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "before" -------------
+	if paramValue := r.URL.Query().Get("before"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "before", r.URL.Query(), &params.Before)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter before: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetAudit(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCameras operation middleware
+func (siw *ServerInterfaceWrapper) GetCameras(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCameras(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostCamerasCalibrate operation middleware
+func (siw *ServerInterfaceWrapper) PostCamerasCalibrate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostCamerasCalibrate(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PutCamerasId operation middleware
+func (siw *ServerInterfaceWrapper) PutCamerasId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CameraIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutCamerasId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCapabilities operation middleware
+func (siw *ServerInterfaceWrapper) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCapabilities(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetChanges operation middleware
+func (siw *ServerInterfaceWrapper) GetChanges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetChangesParams
+
+	// ------------- Optional query parameter "cursor" -------------
+	if paramValue := r.URL.Query().Get("cursor"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter cursor: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetChanges(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollections operation middleware
+func (siw *ServerInterfaceWrapper) GetCollections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollections(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsId operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdExport operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetCollectionsIdExportParams
+
+	// ------------- Optional query parameter "query" -------------
+	if paramValue := r.URL.Query().Get("query"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "query", r.URL.Query(), &params.Query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter query: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "originals" -------------
+	if paramValue := r.URL.Query().Get("originals"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "originals", r.URL.Query(), &params.Originals)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter originals: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdExport(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdFeed operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetCollectionsIdFeedParams
+
+	// ------------- Optional query parameter "format" -------------
+	if paramValue := r.URL.Query().Get("format"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter format: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdFeed(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostCollectionsIdFiles operation middleware
+func (siw *ServerInterfaceWrapper) PostCollectionsIdFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostCollectionsIdFiles(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostCollectionsIdGeotag operation middleware
+func (siw *ServerInterfaceWrapper) PostCollectionsIdGeotag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostCollectionsIdGeotagParams
+
+	// ------------- Optional query parameter "time_offset" -------------
+	if paramValue := r.URL.Query().Get("time_offset"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "time_offset", r.URL.Query(), &params.TimeOffset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter time_offset: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "max_gap" -------------
+	if paramValue := r.URL.Query().Get("max_gap"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "max_gap", r.URL.Query(), &params.MaxGap)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter max_gap: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "overwrite" -------------
+	if paramValue := r.URL.Query().Get("overwrite"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "overwrite", r.URL.Query(), &params.Overwrite)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter overwrite: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "write_xmp" -------------
+	if paramValue := r.URL.Query().Get("write_xmp"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "write_xmp", r.URL.Query(), &params.WriteXmp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter write_xmp: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "dry_run" -------------
+	if paramValue := r.URL.Query().Get("dry_run"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "dry_run", r.URL.Query(), &params.DryRun)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter dry_run: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostCollectionsIdGeotag(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdIndexReport operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdIndexReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetCollectionsIdIndexReportParams
+
+	// ------------- Optional query parameter "samples" -------------
+	if paramValue := r.URL.Query().Get("samples"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "samples", r.URL.Query(), &params.Samples)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter samples: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdIndexReport(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdPreview operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdPreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdPreview(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostCollectionsIdSimilar operation middleware
+func (siw *ServerInterfaceWrapper) PostCollectionsIdSimilar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostCollectionsIdSimilarParams
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostCollectionsIdSimilar(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdStats operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetCollectionsIdStatsParams
+
+	// ------------- Optional query parameter "top" -------------
+	if paramValue := r.URL.Query().Get("top"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "top", r.URL.Query(), &params.Top)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter top: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdStats(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetCollectionsIdStorage operation middleware
+func (siw *ServerInterfaceWrapper) GetCollectionsIdStorage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id CollectionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetCollectionsIdStorageParams
+
+	// ------------- Optional query parameter "top" -------------
+	if paramValue := r.URL.Query().Get("top"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "top", r.URL.Query(), &params.Top)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter top: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetCollectionsIdStorage(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetDiagnostics operation middleware
+func (siw *ServerInterfaceWrapper) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetDiagnostics(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostFilesLocation operation middleware
+func (siw *ServerInterfaceWrapper) PostFilesLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostFilesLocation(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesId operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdAudio operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdAudio(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdAudio(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// DeleteFilesIdCaption operation middleware
+func (siw *ServerInterfaceWrapper) DeleteFilesIdCaption(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteFilesIdCaption(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PutFilesIdCaption operation middleware
+func (siw *ServerInterfaceWrapper) PutFilesIdCaption(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutFilesIdCaption(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdDeepzoomDzi operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdDeepzoomDzi(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdDeepzoomDzi(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdDeepzoomFilesLevelTile operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdDeepzoomFilesLevelTile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "level" -------------
+	var level int
+
+	err = runtime.BindStyledParameter("simple", false, "level", chi.URLParam(r, "level"), &level)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter level: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "tile" -------------
+	var tile string
+
+	err = runtime.BindStyledParameter("simple", false, "tile", chi.URLParam(r, "tile"), &tile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter tile: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdDeepzoomFilesLevelTile(w, r, id, level, tile)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// DeleteFilesIdLocation operation middleware
+func (siw *ServerInterfaceWrapper) DeleteFilesIdLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteFilesIdLocation(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PutFilesIdLocation operation middleware
+func (siw *ServerInterfaceWrapper) PutFilesIdLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutFilesIdLocation(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdMotionMp4 operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdMotionMp4(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdMotionMp4(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PutFilesIdOrientation operation middleware
+func (siw *ServerInterfaceWrapper) PutFilesIdOrientation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutFilesIdOrientation(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdOriginalFilename operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "filename" -------------
+	var filename FilenamePathParam
+
+	err = runtime.BindStyledParameter("simple", false, "filename", chi.URLParam(r, "filename"), &filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter filename: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdOriginalFilename(w, r, id, filename)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdPrint operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdPrint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetFilesIdPrintParams
+
+	// ------------- Optional query parameter "format" -------------
+	if paramValue := r.URL.Query().Get("format"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter format: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "profile" -------------
+	if paramValue := r.URL.Query().Get("profile"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "profile", r.URL.Query(), &params.Profile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter profile: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "border" -------------
+	if paramValue := r.URL.Query().Get("border"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "border", r.URL.Query(), &params.Border)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter border: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "caption" -------------
+	if paramValue := r.URL.Query().Get("caption"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "caption", r.URL.Query(), &params.Caption)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter caption: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "dpi" -------------
+	if paramValue := r.URL.Query().Get("dpi"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "dpi", r.URL.Query(), &params.Dpi)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter dpi: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdPrint(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostFilesIdReprocess operation middleware
+func (siw *ServerInterfaceWrapper) PostFilesIdReprocess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostFilesIdReprocess(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdScrubJpg operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdScrubJpg(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdScrubJpg(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdScrubVtt operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdScrubVtt(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdScrubVtt(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdTagSuggestions operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdTagSuggestions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdTagSuggestions(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdVariantsSizeFilename operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "size" -------------
+	var size SizePathParam
+
+	err = runtime.BindStyledParameter("simple", false, "size", chi.URLParam(r, "size"), &size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter size: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "filename" -------------
+	var filename FilenamePathParam
+
+	err = runtime.BindStyledParameter("simple", false, "filename", chi.URLParam(r, "filename"), &filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter filename: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdVariantsSizeFilename(w, r, id, size, filename)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetFilesIdViewJpg operation middleware
+func (siw *ServerInterfaceWrapper) GetFilesIdViewJpg(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetFilesIdViewJpgParams
+
+	// ------------- Optional query parameter "yaw" -------------
+	if paramValue := r.URL.Query().Get("yaw"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "yaw", r.URL.Query(), &params.Yaw)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter yaw: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "pitch" -------------
+	if paramValue := r.URL.Query().Get("pitch"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "pitch", r.URL.Query(), &params.Pitch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter pitch: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "fov" -------------
+	if paramValue := r.URL.Query().Get("fov"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "fov", r.URL.Query(), &params.Fov)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter fov: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "width" -------------
+	if paramValue := r.URL.Query().Get("width"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "width", r.URL.Query(), &params.Width)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter width: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "height" -------------
+	if paramValue := r.URL.Query().Get("height"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "height", r.URL.Query(), &params.Height)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter height: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetFilesIdViewJpg(w, r, id, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetIiifId operation middleware
+func (siw *ServerInterfaceWrapper) GetIiifId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetIiifId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetIiifIdInfoJson operation middleware
+func (siw *ServerInterfaceWrapper) GetIiifIdInfoJson(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetIiifIdInfoJson(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetIiifIdRegionSizeRotationQuality operation middleware
+func (siw *ServerInterfaceWrapper) GetIiifIdRegionSizeRotationQuality(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id FileIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "region" -------------
+	var region string
+
+	err = runtime.BindStyledParameter("simple", false, "region", chi.URLParam(r, "region"), &region)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter region: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "size" -------------
+	var size string
+
+	err = runtime.BindStyledParameter("simple", false, "size", chi.URLParam(r, "size"), &size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter size: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "rotation" -------------
+	var rotation string
+
+	err = runtime.BindStyledParameter("simple", false, "rotation", chi.URLParam(r, "rotation"), &rotation)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter rotation: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "quality" -------------
+	var quality string
+
+	err = runtime.BindStyledParameter("simple", false, "quality", chi.URLParam(r, "quality"), &quality)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter quality: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetIiifIdRegionSizeRotationQuality(w, r, id, region, size, rotation, quality)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetMemories operation middleware
+func (siw *ServerInterfaceWrapper) GetMemories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetMemoriesParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "date" -------------
+	if paramValue := r.URL.Query().Get("date"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "date", r.URL.Query(), &params.Date)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter date: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "filter" -------------
+	if paramValue := r.URL.Query().Get("filter"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "filter", r.URL.Query(), &params.Filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter filter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetMemories(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetOrientationProposals operation middleware
+func (siw *ServerInterfaceWrapper) GetOrientationProposals(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetOrientationProposalsParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetOrientationProposals(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostOrientationProposalsAccept operation middleware
+func (siw *ServerInterfaceWrapper) PostOrientationProposalsAccept(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostOrientationProposalsAccept(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostOrientationProposalsReject operation middleware
+func (siw *ServerInterfaceWrapper) PostOrientationProposalsReject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostOrientationProposalsReject(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetPanoramas operation middleware
+func (siw *ServerInterfaceWrapper) GetPanoramas(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetPanoramasParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPanoramas(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// DeletePanoramasId operation middleware
+func (siw *ServerInterfaceWrapper) DeletePanoramasId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id PanoramaIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeletePanoramasId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetPanoramasId operation middleware
+func (siw *ServerInterfaceWrapper) GetPanoramasId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id PanoramaIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPanoramasId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetPanoramasIdPreview operation middleware
+func (siw *ServerInterfaceWrapper) GetPanoramasIdPreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id PanoramaIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPanoramasIdPreview(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetPlaces operation middleware
+func (siw *ServerInterfaceWrapper) GetPlaces(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetPlacesParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "q" -------------
+	if paramValue := r.URL.Query().Get("q"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "q", r.URL.Query(), &params.Q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter q: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPlaces(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetQuarantine operation middleware
+func (siw *ServerInterfaceWrapper) GetQuarantine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetQuarantineParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetQuarantine(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostQuery operation middleware
+func (siw *ServerInterfaceWrapper) PostQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostQueryParams
+
+	// ------------- Optional query parameter "format" -------------
+	if paramValue := r.URL.Query().Get("format"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter format: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostQuery(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenes operation middleware
+func (siw *ServerInterfaceWrapper) GetScenes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetScenesParams
+
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "viewport_width" -------------
+	if paramValue := r.URL.Query().Get("viewport_width"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "viewport_width", r.URL.Query(), &params.ViewportWidth)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter viewport_width: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "viewport_height" -------------
+	if paramValue := r.URL.Query().Get("viewport_height"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "viewport_height", r.URL.Query(), &params.ViewportHeight)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter viewport_height: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "image_height" -------------
+	if paramValue := r.URL.Query().Get("image_height"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "image_height", r.URL.Query(), &params.ImageHeight)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter image_height: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "layout" -------------
+	if paramValue := r.URL.Query().Get("layout"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "layout", r.URL.Query(), &params.Layout)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter layout: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+	if paramValue := r.URL.Query().Get("sort"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter sort: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "search" -------------
+	if paramValue := r.URL.Query().Get("search"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter search: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "spacing" -------------
+	if paramValue := r.URL.Query().Get("spacing"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "spacing", r.URL.Query(), &params.Spacing)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter spacing: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "max_row_slop" -------------
+	if paramValue := r.URL.Query().Get("max_row_slop"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "max_row_slop", r.URL.Query(), &params.MaxRowSlop)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter max_row_slop: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "panorama" -------------
+	if paramValue := r.URL.Query().Get("panorama"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "panorama", r.URL.Query(), &params.Panorama)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter panorama: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenes(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostScenes operation middleware
+func (siw *ServerInterfaceWrapper) PostScenes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostScenes(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenesId operation middleware
+func (siw *ServerInterfaceWrapper) GetScenesId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenesId(w, r, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenesSceneIdDates operation middleware
+func (siw *ServerInterfaceWrapper) GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "scene_id" -------------
+	var sceneId SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetScenesSceneIdDatesParams
+
+	// ------------- Required query parameter "height" -------------
+	if paramValue := r.URL.Query().Get("height"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument height is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "height", r.URL.Query(), &params.Height)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter height: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenesSceneIdDates(w, r, sceneId, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// PostScenesSceneIdPrefetch operation middleware
+func (siw *ServerInterfaceWrapper) PostScenesSceneIdPrefetch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "scene_id" -------------
+	var sceneId SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostScenesSceneIdPrefetch(w, r, sceneId)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenesSceneIdRegions operation middleware
+func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "scene_id" -------------
+	var sceneId SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetScenesSceneIdRegionsParams
+
+	// ------------- Required query parameter "x" -------------
+	if paramValue := r.URL.Query().Get("x"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument x is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "x", r.URL.Query(), &params.X)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter x: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "y" -------------
+	if paramValue := r.URL.Query().Get("y"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument y is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "y", r.URL.Query(), &params.Y)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter y: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "w" -------------
+	if paramValue := r.URL.Query().Get("w"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument w is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "w", r.URL.Query(), &params.W)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter w: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "h" -------------
+	if paramValue := r.URL.Query().Get("h"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument h is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "h", r.URL.Query(), &params.H)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter h: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenesSceneIdRegions(w, r, sceneId, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenesSceneIdRegionsId operation middleware
+func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "scene_id" -------------
+	var sceneId SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "id" -------------
+	var id RegionId
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenesSceneIdRegionsId(w, r, sceneId, id)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetScenesSceneIdTiles operation middleware
+func (siw *ServerInterfaceWrapper) GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "scene_id" -------------
+	var sceneId SceneId
+
+	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetScenesSceneIdTilesParams
+
+	// ------------- Required query parameter "tile_size" -------------
+	if paramValue := r.URL.Query().Get("tile_size"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument tile_size is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "tile_size", r.URL.Query(), &params.TileSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter tile_size: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "background_color" -------------
+	if paramValue := r.URL.Query().Get("background_color"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "background_color", r.URL.Query(), &params.BackgroundColor)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter background_color: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "zoom" -------------
+	if paramValue := r.URL.Query().Get("zoom"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument zoom is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "zoom", r.URL.Query(), &params.Zoom)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter zoom: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "x" -------------
+	if paramValue := r.URL.Query().Get("x"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument x is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "x", r.URL.Query(), &params.X)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter x: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "y" -------------
+	if paramValue := r.URL.Query().Get("y"); paramValue != "" {
+
+	} else {
+		http.Error(w, "Query argument y is required, but not found", http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "y", r.URL.Query(), &params.Y)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter y: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "sources" -------------
+	if paramValue := r.URL.Query().Get("sources"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", false, false, "sources", r.URL.Query(), &params.Sources)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter sources: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "select_tag" -------------
+	if paramValue := r.URL.Query().Get("select_tag"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "select_tag", r.URL.Query(), &params.SelectTag)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter select_tag: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "debug_overdraw" -------------
+	if paramValue := r.URL.Query().Get("debug_overdraw"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "debug_overdraw", r.URL.Query(), &params.DebugOverdraw)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter debug_overdraw: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "debug_thumbnails" -------------
+	if paramValue := r.URL.Query().Get("debug_thumbnails"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "debug_thumbnails", r.URL.Query(), &params.DebugThumbnails)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter debug_thumbnails: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "priority" -------------
+	if paramValue := r.URL.Query().Get("priority"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "priority", r.URL.Query(), &params.Priority)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter priority: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetScenesSceneIdTiles(w, r, sceneId, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetSearches operation middleware
+func (siw *ServerInterfaceWrapper) GetSearches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetSearchesParams
+
+	// ------------- Optional query parameter "saved" -------------
+	if paramValue := r.URL.Query().Get("saved"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "saved", r.URL.Query(), &params.Saved)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter saved: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSearches(w, r, params)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
 
-// PostTasksJSONRequestBody defines body for PostTasks for application/json ContentType.
-type PostTasksJSONRequestBody PostTasksJSONBody
+	handler(w, r.WithContext(ctx))
+}
 
-// ServerInterface represents all server handlers.
-type ServerInterface interface {
+// PostSearches operation middleware
+func (siw *ServerInterfaceWrapper) PostSearches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// (GET /capabilities)
-	GetCapabilities(w http.ResponseWriter, r *http.Request)
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostSearches(w, r)
+	}
 
-	// (GET /collections)
-	GetCollections(w http.ResponseWriter, r *http.Request)
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
 
-	// (GET /collections/{id})
-	GetCollectionsId(w http.ResponseWriter, r *http.Request, id CollectionId)
+	handler(w, r.WithContext(ctx))
+}
 
-	// (GET /files/{id})
-	GetFilesId(w http.ResponseWriter, r *http.Request, id FileIdPathParam)
+// DeleteSearchesId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteSearchesId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// (GET /files/{id}/original/{filename})
-	GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request, id FileIdPathParam, filename FilenamePathParam)
+	var err error
 
-	// (GET /files/{id}/variants/{size}/{filename})
-	GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request, id FileIdPathParam, size SizePathParam, filename FilenamePathParam)
+	// ------------- Path parameter "id" -------------
+	var id UserSearchIdPathParam
 
-	// (GET /scenes)
-	GetScenes(w http.ResponseWriter, r *http.Request, params GetScenesParams)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
 
-	// (POST /scenes)
-	PostScenes(w http.ResponseWriter, r *http.Request)
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteSearchesId(w, r, id)
+	}
 
-	// (GET /scenes/{id})
-	GetScenesId(w http.ResponseWriter, r *http.Request, id SceneId)
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
 
-	// (GET /scenes/{scene_id}/dates)
-	GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdDatesParams)
+	handler(w, r.WithContext(ctx))
+}
 
-	// (GET /scenes/{scene_id}/regions)
-	GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdRegionsParams)
+// GetSelections operation middleware
+func (siw *ServerInterfaceWrapper) GetSelections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// (GET /scenes/{scene_id}/regions/{id})
-	GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request, sceneId SceneId, id RegionId)
+	var err error
 
-	// (GET /scenes/{scene_id}/tiles)
-	GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request, sceneId SceneId, params GetScenesSceneIdTilesParams)
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetSelectionsParams
 
-	// (GET /tags)
-	GetTags(w http.ResponseWriter, r *http.Request, params GetTagsParams)
+	// ------------- Optional query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
 
-	// (POST /tags)
-	PostTags(w http.ResponseWriter, r *http.Request)
+	}
 
-	// (POST /tags/{id}/files)
-	PostTagsIdFiles(w http.ResponseWriter, r *http.Request, id TagIdPathParam)
+	err = runtime.BindQueryParameter("form", true, false, "collection_id", r.URL.Query(), &params.CollectionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		return
+	}
 
-	// (GET /tasks)
-	GetTasks(w http.ResponseWriter, r *http.Request, params GetTasksParams)
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSelections(w, r, params)
+	}
 
-	// (POST /tasks)
-	PostTasks(w http.ResponseWriter, r *http.Request)
-}
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
 
-// ServerInterfaceWrapper converts contexts to parameters.
-type ServerInterfaceWrapper struct {
-	Handler            ServerInterface
-	HandlerMiddlewares []MiddlewareFunc
+	handler(w, r.WithContext(ctx))
 }
 
-type MiddlewareFunc func(http.HandlerFunc) http.HandlerFunc
-
-// GetCapabilities operation middleware
-func (siw *ServerInterfaceWrapper) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+// PostSelections operation middleware
+func (siw *ServerInterfaceWrapper) PostSelections(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetCapabilities(w, r)
+		siw.Handler.PostSelections(w, r)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -381,12 +4578,23 @@ func (siw *ServerInterfaceWrapper) GetCapabilities(w http.ResponseWriter, r *htt
 	handler(w, r.WithContext(ctx))
 }
 
-// GetCollections operation middleware
-func (siw *ServerInterfaceWrapper) GetCollections(w http.ResponseWriter, r *http.Request) {
+// DeleteSelectionsId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteSelectionsId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id SelectionIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		return
+	}
+
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetCollections(w, r)
+		siw.Handler.DeleteSelectionsId(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -396,14 +4604,14 @@ func (siw *ServerInterfaceWrapper) GetCollections(w http.ResponseWriter, r *http
 	handler(w, r.WithContext(ctx))
 }
 
-// GetCollectionsId operation middleware
-func (siw *ServerInterfaceWrapper) GetCollectionsId(w http.ResponseWriter, r *http.Request) {
+// GetSelectionsId operation middleware
+func (siw *ServerInterfaceWrapper) GetSelectionsId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// ------------- Path parameter "id" -------------
-	var id CollectionId
+	var id SelectionIdPathParam
 
 	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
@@ -412,7 +4620,7 @@ func (siw *ServerInterfaceWrapper) GetCollectionsId(w http.ResponseWriter, r *ht
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetCollectionsId(w, r, id)
+		siw.Handler.GetSelectionsId(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -422,14 +4630,14 @@ func (siw *ServerInterfaceWrapper) GetCollectionsId(w http.ResponseWriter, r *ht
 	handler(w, r.WithContext(ctx))
 }
 
-// GetFilesId operation middleware
-func (siw *ServerInterfaceWrapper) GetFilesId(w http.ResponseWriter, r *http.Request) {
+// PostSelectionsIdConvert operation middleware
+func (siw *ServerInterfaceWrapper) PostSelectionsIdConvert(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// ------------- Path parameter "id" -------------
-	var id FileIdPathParam
+	var id SelectionIdPathParam
 
 	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
@@ -438,7 +4646,7 @@ func (siw *ServerInterfaceWrapper) GetFilesId(w http.ResponseWriter, r *http.Req
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetFilesId(w, r, id)
+		siw.Handler.PostSelectionsIdConvert(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -448,14 +4656,14 @@ func (siw *ServerInterfaceWrapper) GetFilesId(w http.ResponseWriter, r *http.Req
 	handler(w, r.WithContext(ctx))
 }
 
-// GetFilesIdOriginalFilename operation middleware
-func (siw *ServerInterfaceWrapper) GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request) {
+// PostSelectionsIdFiles operation middleware
+func (siw *ServerInterfaceWrapper) PostSelectionsIdFiles(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// ------------- Path parameter "id" -------------
-	var id FileIdPathParam
+	var id SelectionIdPathParam
 
 	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
@@ -463,17 +4671,23 @@ func (siw *ServerInterfaceWrapper) GetFilesIdOriginalFilename(w http.ResponseWri
 		return
 	}
 
-	// ------------- Path parameter "filename" -------------
-	var filename FilenamePathParam
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostSelectionsIdFiles(w, r, id)
+	}
 
-	err = runtime.BindStyledParameter("simple", false, "filename", chi.URLParam(r, "filename"), &filename)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter filename: %s", err), http.StatusBadRequest)
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
+	handler(w, r.WithContext(ctx))
+}
+
+// PostSheets operation middleware
+func (siw *ServerInterfaceWrapper) PostSheets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetFilesIdOriginalFilename(w, r, id, filename)
+		siw.Handler.PostSheets(w, r)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -483,41 +4697,78 @@ func (siw *ServerInterfaceWrapper) GetFilesIdOriginalFilename(w http.ResponseWri
 	handler(w, r.WithContext(ctx))
 }
 
-// GetFilesIdVariantsSizeFilename operation middleware
-func (siw *ServerInterfaceWrapper) GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request) {
+// GetState operation middleware
+func (siw *ServerInterfaceWrapper) GetState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetState(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// DeleteStateKey operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStateKey(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
-	// ------------- Path parameter "id" -------------
-	var id FileIdPathParam
+	// ------------- Path parameter "key" -------------
+	var key StateKeyPathParam
 
-	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	err = runtime.BindStyledParameter("simple", false, "key", chi.URLParam(r, "key"), &key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter key: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Path parameter "size" -------------
-	var size SizePathParam
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteStateKeyParams
 
-	err = runtime.BindStyledParameter("simple", false, "size", chi.URLParam(r, "size"), &size)
+	// ------------- Optional query parameter "version" -------------
+	if paramValue := r.URL.Query().Get("version"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "version", r.URL.Query(), &params.Version)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter size: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter version: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Path parameter "filename" -------------
-	var filename FilenamePathParam
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteStateKey(w, r, key, params)
+	}
 
-	err = runtime.BindStyledParameter("simple", false, "filename", chi.URLParam(r, "filename"), &filename)
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetStateKey operation middleware
+func (siw *ServerInterfaceWrapper) GetStateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "key" -------------
+	var key StateKeyPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "key", chi.URLParam(r, "key"), &key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter filename: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter key: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetFilesIdVariantsSizeFilename(w, r, id, size, filename)
+		siw.Handler.GetStateKey(w, r, key)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -527,14 +4778,40 @@ func (siw *ServerInterfaceWrapper) GetFilesIdVariantsSizeFilename(w http.Respons
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenes operation middleware
-func (siw *ServerInterfaceWrapper) GetScenes(w http.ResponseWriter, r *http.Request) {
+// PutStateKey operation middleware
+func (siw *ServerInterfaceWrapper) PutStateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "key" -------------
+	var key StateKeyPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "key", chi.URLParam(r, "key"), &key)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter key: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutStateKey(w, r, key)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
+// GetSubjects operation middleware
+func (siw *ServerInterfaceWrapper) GetSubjects(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetScenesParams
+	var params GetSubjectsParams
 
 	// ------------- Required query parameter "collection_id" -------------
 	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
@@ -550,74 +4827,102 @@ func (siw *ServerInterfaceWrapper) GetScenes(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// ------------- Optional query parameter "viewport_width" -------------
-	if paramValue := r.URL.Query().Get("viewport_width"); paramValue != "" {
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "viewport_width", r.URL.Query(), &params.ViewportWidth)
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter viewport_width: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "viewport_height" -------------
-	if paramValue := r.URL.Query().Get("viewport_height"); paramValue != "" {
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSubjects(w, r, params)
+	}
 
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "viewport_height", r.URL.Query(), &params.ViewportHeight)
+	handler(w, r.WithContext(ctx))
+}
+
+// GetSubjectsId operation middleware
+func (siw *ServerInterfaceWrapper) GetSubjectsId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id SubjectIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter viewport_height: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "image_height" -------------
-	if paramValue := r.URL.Query().Get("image_height"); paramValue != "" {
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSubjectsId(w, r, id)
+	}
 
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "image_height", r.URL.Query(), &params.ImageHeight)
+	handler(w, r.WithContext(ctx))
+}
+
+// PostSubjectsIdLabel operation middleware
+func (siw *ServerInterfaceWrapper) PostSubjectsIdLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id SubjectIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter image_height: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "layout" -------------
-	if paramValue := r.URL.Query().Get("layout"); paramValue != "" {
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostSubjectsIdLabel(w, r, id)
+	}
 
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "layout", r.URL.Query(), &params.Layout)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter layout: %s", err), http.StatusBadRequest)
-		return
-	}
+	handler(w, r.WithContext(ctx))
+}
 
-	// ------------- Optional query parameter "sort" -------------
-	if paramValue := r.URL.Query().Get("sort"); paramValue != "" {
+// GetTags operation middleware
+func (siw *ServerInterfaceWrapper) GetTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	}
+	var err error
 
-	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter sort: %s", err), http.StatusBadRequest)
-		return
-	}
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTagsParams
 
-	// ------------- Optional query parameter "search" -------------
-	if paramValue := r.URL.Query().Get("search"); paramValue != "" {
+	// ------------- Optional query parameter "q" -------------
+	if paramValue := r.URL.Query().Get("q"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	err = runtime.BindQueryParameter("form", true, false, "q", r.URL.Query(), &params.Q)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter search: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter q: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenes(w, r, params)
+		siw.Handler.GetTags(w, r, params)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -627,12 +4932,12 @@ func (siw *ServerInterfaceWrapper) GetScenes(w http.ResponseWriter, r *http.Requ
 	handler(w, r.WithContext(ctx))
 }
 
-// PostScenes operation middleware
-func (siw *ServerInterfaceWrapper) PostScenes(w http.ResponseWriter, r *http.Request) {
+// PostTags operation middleware
+func (siw *ServerInterfaceWrapper) PostTags(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostScenes(w, r)
+		siw.Handler.PostTags(w, r)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -642,14 +4947,14 @@ func (siw *ServerInterfaceWrapper) PostScenes(w http.ResponseWriter, r *http.Req
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenesId operation middleware
-func (siw *ServerInterfaceWrapper) GetScenesId(w http.ResponseWriter, r *http.Request) {
+// PutTagsId operation middleware
+func (siw *ServerInterfaceWrapper) PutTagsId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// ------------- Path parameter "id" -------------
-	var id SceneId
+	var id TagIdPathParam
 
 	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
@@ -658,7 +4963,7 @@ func (siw *ServerInterfaceWrapper) GetScenesId(w http.ResponseWriter, r *http.Re
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenesId(w, r, id)
+		siw.Handler.PutTagsId(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -668,40 +4973,23 @@ func (siw *ServerInterfaceWrapper) GetScenesId(w http.ResponseWriter, r *http.Re
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenesSceneIdDates operation middleware
-func (siw *ServerInterfaceWrapper) GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request) {
+// PostTagsIdFiles operation middleware
+func (siw *ServerInterfaceWrapper) PostTagsIdFiles(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
-	// ------------- Path parameter "scene_id" -------------
-	var sceneId SceneId
-
-	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
-		return
-	}
-
-	// Parameter object where we will unmarshal all parameters from the context
-	var params GetScenesSceneIdDatesParams
-
-	// ------------- Required query parameter "height" -------------
-	if paramValue := r.URL.Query().Get("height"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument height is required, but not found", http.StatusBadRequest)
-		return
-	}
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
 
-	err = runtime.BindQueryParameter("form", true, true, "height", r.URL.Query(), &params.Height)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter height: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenesSceneIdDates(w, r, sceneId, params)
+		siw.Handler.PostTagsIdFiles(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -711,93 +4999,49 @@ func (siw *ServerInterfaceWrapper) GetScenesSceneIdDates(w http.ResponseWriter,
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenesSceneIdRegions operation middleware
-func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request) {
+// PostTagsIdMerge operation middleware
+func (siw *ServerInterfaceWrapper) PostTagsIdMerge(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
-	// ------------- Path parameter "scene_id" -------------
-	var sceneId SceneId
-
-	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
-		return
-	}
-
-	// Parameter object where we will unmarshal all parameters from the context
-	var params GetScenesSceneIdRegionsParams
-
-	// ------------- Required query parameter "x" -------------
-	if paramValue := r.URL.Query().Get("x"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument x is required, but not found", http.StatusBadRequest)
-		return
-	}
-
-	err = runtime.BindQueryParameter("form", true, true, "x", r.URL.Query(), &params.X)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter x: %s", err), http.StatusBadRequest)
-		return
-	}
-
-	// ------------- Required query parameter "y" -------------
-	if paramValue := r.URL.Query().Get("y"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument y is required, but not found", http.StatusBadRequest)
-		return
-	}
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
 
-	err = runtime.BindQueryParameter("form", true, true, "y", r.URL.Query(), &params.Y)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter y: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Required query parameter "w" -------------
-	if paramValue := r.URL.Query().Get("w"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument w is required, but not found", http.StatusBadRequest)
-		return
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostTagsIdMerge(w, r, id)
 	}
 
-	err = runtime.BindQueryParameter("form", true, true, "w", r.URL.Query(), &params.W)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter w: %s", err), http.StatusBadRequest)
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Required query parameter "h" -------------
-	if paramValue := r.URL.Query().Get("h"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument h is required, but not found", http.StatusBadRequest)
-		return
-	}
+	handler(w, r.WithContext(ctx))
+}
 
-	err = runtime.BindQueryParameter("form", true, true, "h", r.URL.Query(), &params.H)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter h: %s", err), http.StatusBadRequest)
-		return
-	}
+// PostTagsIdRename operation middleware
+func (siw *ServerInterfaceWrapper) PostTagsIdRename(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// ------------- Optional query parameter "limit" -------------
-	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+	var err error
 
-	}
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
 
-	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenesSceneIdRegions(w, r, sceneId, params)
+		siw.Handler.PostTagsIdRename(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -807,32 +5051,37 @@ func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegions(w http.ResponseWriter
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenesSceneIdRegionsId operation middleware
-func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request) {
+// GetTagsIdRevisions operation middleware
+func (siw *ServerInterfaceWrapper) GetTagsIdRevisions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
-	// ------------- Path parameter "scene_id" -------------
-	var sceneId SceneId
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
 
-	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Path parameter "id" -------------
-	var id RegionId
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTagsIdRevisionsParams
 
-	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenesSceneIdRegionsId(w, r, sceneId, id)
+		siw.Handler.GetTagsIdRevisions(w, r, id, params)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -842,137 +5091,134 @@ func (siw *ServerInterfaceWrapper) GetScenesSceneIdRegionsId(w http.ResponseWrit
 	handler(w, r.WithContext(ctx))
 }
 
-// GetScenesSceneIdTiles operation middleware
-func (siw *ServerInterfaceWrapper) GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request) {
+// GetTagsIdRevisionsDiff operation middleware
+func (siw *ServerInterfaceWrapper) GetTagsIdRevisionsDiff(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
-	// ------------- Path parameter "scene_id" -------------
-	var sceneId SceneId
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
 
-	err = runtime.BindStyledParameter("simple", false, "scene_id", chi.URLParam(r, "scene_id"), &sceneId)
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter scene_id: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetScenesSceneIdTilesParams
+	var params GetTagsIdRevisionsDiffParams
 
-	// ------------- Required query parameter "tile_size" -------------
-	if paramValue := r.URL.Query().Get("tile_size"); paramValue != "" {
+	// ------------- Required query parameter "from" -------------
+	if paramValue := r.URL.Query().Get("from"); paramValue != "" {
 
 	} else {
-		http.Error(w, "Query argument tile_size is required, but not found", http.StatusBadRequest)
+		http.Error(w, "Query argument from is required, but not found", http.StatusBadRequest)
 		return
 	}
 
-	err = runtime.BindQueryParameter("form", true, true, "tile_size", r.URL.Query(), &params.TileSize)
+	err = runtime.BindQueryParameter("form", true, true, "from", r.URL.Query(), &params.From)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter tile_size: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter from: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "background_color" -------------
-	if paramValue := r.URL.Query().Get("background_color"); paramValue != "" {
+	// ------------- Optional query parameter "to" -------------
+	if paramValue := r.URL.Query().Get("to"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "background_color", r.URL.Query(), &params.BackgroundColor)
+	err = runtime.BindQueryParameter("form", true, false, "to", r.URL.Query(), &params.To)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter background_color: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter to: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Required query parameter "zoom" -------------
-	if paramValue := r.URL.Query().Get("zoom"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument zoom is required, but not found", http.StatusBadRequest)
-		return
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetTagsIdRevisionsDiff(w, r, id, params)
 	}
 
-	err = runtime.BindQueryParameter("form", true, true, "zoom", r.URL.Query(), &params.Zoom)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter zoom: %s", err), http.StatusBadRequest)
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Required query parameter "x" -------------
-	if paramValue := r.URL.Query().Get("x"); paramValue != "" {
+	handler(w, r.WithContext(ctx))
+}
 
-	} else {
-		http.Error(w, "Query argument x is required, but not found", http.StatusBadRequest)
-		return
-	}
+// PostTagsIdRollback operation middleware
+func (siw *ServerInterfaceWrapper) PostTagsIdRollback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", true, true, "x", r.URL.Query(), &params.X)
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id TagIdPathParam
+
+	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter x: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Required query parameter "y" -------------
-	if paramValue := r.URL.Query().Get("y"); paramValue != "" {
-
-	} else {
-		http.Error(w, "Query argument y is required, but not found", http.StatusBadRequest)
-		return
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostTagsIdRollback(w, r, id)
 	}
 
-	err = runtime.BindQueryParameter("form", true, true, "y", r.URL.Query(), &params.Y)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter y: %s", err), http.StatusBadRequest)
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "sources" -------------
-	if paramValue := r.URL.Query().Get("sources"); paramValue != "" {
+	handler(w, r.WithContext(ctx))
+}
 
-	}
+// GetTasks operation middleware
+func (siw *ServerInterfaceWrapper) GetTasks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", false, false, "sources", r.URL.Query(), &params.Sources)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter sources: %s", err), http.StatusBadRequest)
-		return
-	}
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTasksParams
 
-	// ------------- Optional query parameter "select_tag" -------------
-	if paramValue := r.URL.Query().Get("select_tag"); paramValue != "" {
+	// ------------- Optional query parameter "type" -------------
+	if paramValue := r.URL.Query().Get("type"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "select_tag", r.URL.Query(), &params.SelectTag)
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter select_tag: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter type: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "debug_overdraw" -------------
-	if paramValue := r.URL.Query().Get("debug_overdraw"); paramValue != "" {
+	// ------------- Optional query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "debug_overdraw", r.URL.Query(), &params.DebugOverdraw)
+	err = runtime.BindQueryParameter("form", true, false, "collection_id", r.URL.Query(), &params.CollectionId)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter debug_overdraw: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "debug_thumbnails" -------------
-	if paramValue := r.URL.Query().Get("debug_thumbnails"); paramValue != "" {
-
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetTasks(w, r, params)
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "debug_thumbnails", r.URL.Query(), &params.DebugThumbnails)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter debug_thumbnails: %s", err), http.StatusBadRequest)
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
+	handler(w, r.WithContext(ctx))
+}
+
+// PostTasks operation middleware
+func (siw *ServerInterfaceWrapper) PostTasks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetScenesSceneIdTiles(w, r, sceneId, params)
+		siw.Handler.PostTasks(w, r)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -982,43 +5228,42 @@ func (siw *ServerInterfaceWrapper) GetScenesSceneIdTiles(w http.ResponseWriter,
 	handler(w, r.WithContext(ctx))
 }
 
-// GetTags operation middleware
-func (siw *ServerInterfaceWrapper) GetTags(w http.ResponseWriter, r *http.Request) {
+// GetTrips operation middleware
+func (siw *ServerInterfaceWrapper) GetTrips(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetTagsParams
+	var params GetTripsParams
 
-	// ------------- Optional query parameter "q" -------------
-	if paramValue := r.URL.Query().Get("q"); paramValue != "" {
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
 
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "q", r.URL.Query(), &params.Q)
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter q: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetTags(w, r, params)
-	}
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
 
-	for _, middleware := range siw.HandlerMiddlewares {
-		handler = middleware(handler)
 	}
 
-	handler(w, r.WithContext(ctx))
-}
-
-// PostTags operation middleware
-func (siw *ServerInterfaceWrapper) PostTags(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
+		return
+	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostTags(w, r)
+		siw.Handler.GetTrips(w, r, params)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1028,14 +5273,14 @@ func (siw *ServerInterfaceWrapper) PostTags(w http.ResponseWriter, r *http.Reque
 	handler(w, r.WithContext(ctx))
 }
 
-// PostTagsIdFiles operation middleware
-func (siw *ServerInterfaceWrapper) PostTagsIdFiles(w http.ResponseWriter, r *http.Request) {
+// GetTripsId operation middleware
+func (siw *ServerInterfaceWrapper) GetTripsId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// ------------- Path parameter "id" -------------
-	var id TagIdPathParam
+	var id TripIdPathParam
 
 	err = runtime.BindStyledParameter("simple", false, "id", chi.URLParam(r, "id"), &id)
 	if err != nil {
@@ -1044,7 +5289,7 @@ func (siw *ServerInterfaceWrapper) PostTagsIdFiles(w http.ResponseWriter, r *htt
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostTagsIdFiles(w, r, id)
+		siw.Handler.GetTripsId(w, r, id)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1054,54 +5299,42 @@ func (siw *ServerInterfaceWrapper) PostTagsIdFiles(w http.ResponseWriter, r *htt
 	handler(w, r.WithContext(ctx))
 }
 
-// GetTasks operation middleware
-func (siw *ServerInterfaceWrapper) GetTasks(w http.ResponseWriter, r *http.Request) {
+// GetVerification operation middleware
+func (siw *ServerInterfaceWrapper) GetVerification(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var err error
 
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetTasksParams
+	var params GetVerificationParams
 
-	// ------------- Optional query parameter "type" -------------
-	if paramValue := r.URL.Query().Get("type"); paramValue != "" {
+	// ------------- Required query parameter "collection_id" -------------
+	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
 
+	} else {
+		http.Error(w, "Query argument collection_id is required, but not found", http.StatusBadRequest)
+		return
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
+	err = runtime.BindQueryParameter("form", true, true, "collection_id", r.URL.Query(), &params.CollectionId)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter type: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	// ------------- Optional query parameter "collection_id" -------------
-	if paramValue := r.URL.Query().Get("collection_id"); paramValue != "" {
+	// ------------- Optional query parameter "limit" -------------
+	if paramValue := r.URL.Query().Get("limit"); paramValue != "" {
 
 	}
 
-	err = runtime.BindQueryParameter("form", true, false, "collection_id", r.URL.Query(), &params.CollectionId)
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid format for parameter collection_id: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format for parameter limit: %s", err), http.StatusBadRequest)
 		return
 	}
 
 	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetTasks(w, r, params)
-	}
-
-	for _, middleware := range siw.HandlerMiddlewares {
-		handler = middleware(handler)
-	}
-
-	handler(w, r.WithContext(ctx))
-}
-
-// PostTasks operation middleware
-func (siw *ServerInterfaceWrapper) PostTasks(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	var handler = func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostTasks(w, r)
+		siw.Handler.GetVerification(w, r, params)
 	}
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1148,24 +5381,159 @@ func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handl
 		HandlerMiddlewares: options.Middlewares,
 	}
 
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/audit", wrapper.GetAudit)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/cameras", wrapper.GetCameras)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/cameras/calibrate", wrapper.PostCamerasCalibrate)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/cameras/{id}", wrapper.PutCamerasId)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/capabilities", wrapper.GetCapabilities)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/changes", wrapper.GetChanges)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/collections", wrapper.GetCollections)
 	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/collections/{id}", wrapper.GetCollectionsId)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/export", wrapper.GetCollectionsIdExport)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/feed", wrapper.GetCollectionsIdFeed)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/collections/{id}/files", wrapper.PostCollectionsIdFiles)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/collections/{id}/geotag", wrapper.PostCollectionsIdGeotag)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/index-report", wrapper.GetCollectionsIdIndexReport)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/preview", wrapper.GetCollectionsIdPreview)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/collections/{id}/similar", wrapper.PostCollectionsIdSimilar)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/stats", wrapper.GetCollectionsIdStats)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/collections/{id}/storage", wrapper.GetCollectionsIdStorage)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/diagnostics", wrapper.GetDiagnostics)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/files/location", wrapper.PostFilesLocation)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/files/{id}", wrapper.GetFilesId)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/audio", wrapper.GetFilesIdAudio)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/files/{id}/caption", wrapper.DeleteFilesIdCaption)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/files/{id}/caption", wrapper.PutFilesIdCaption)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/deepzoom.dzi", wrapper.GetFilesIdDeepzoomDzi)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/deepzoom_files/{level}/{tile}", wrapper.GetFilesIdDeepzoomFilesLevelTile)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/files/{id}/location", wrapper.DeleteFilesIdLocation)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/files/{id}/location", wrapper.PutFilesIdLocation)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/motion.mp4", wrapper.GetFilesIdMotionMp4)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/files/{id}/orientation", wrapper.PutFilesIdOrientation)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/files/{id}/original/{filename}", wrapper.GetFilesIdOriginalFilename)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/print", wrapper.GetFilesIdPrint)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/files/{id}/reprocess", wrapper.PostFilesIdReprocess)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/scrub.jpg", wrapper.GetFilesIdScrubJpg)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/scrub.vtt", wrapper.GetFilesIdScrubVtt)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/tag-suggestions", wrapper.GetFilesIdTagSuggestions)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/files/{id}/variants/{size}/{filename}", wrapper.GetFilesIdVariantsSizeFilename)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/files/{id}/view.jpg", wrapper.GetFilesIdViewJpg)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/iiif/{id}", wrapper.GetIiifId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/iiif/{id}/info.json", wrapper.GetIiifIdInfoJson)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/iiif/{id}/{region}/{size}/{rotation}/{quality}", wrapper.GetIiifIdRegionSizeRotationQuality)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/memories", wrapper.GetMemories)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/orientation/proposals", wrapper.GetOrientationProposals)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/orientation/proposals/accept", wrapper.PostOrientationProposalsAccept)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/orientation/proposals/reject", wrapper.PostOrientationProposalsReject)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/panoramas", wrapper.GetPanoramas)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/panoramas/{id}", wrapper.DeletePanoramasId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/panoramas/{id}", wrapper.GetPanoramasId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/panoramas/{id}/preview", wrapper.GetPanoramasIdPreview)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/places", wrapper.GetPlaces)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/quarantine", wrapper.GetQuarantine)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/query", wrapper.PostQuery)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/scenes", wrapper.GetScenes)
 	})
@@ -1178,6 +5546,9 @@ func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handl
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/scenes/{scene_id}/dates", wrapper.GetScenesSceneIdDates)
 	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/scenes/{scene_id}/prefetch", wrapper.PostScenesSceneIdPrefetch)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/scenes/{scene_id}/regions", wrapper.GetScenesSceneIdRegions)
 	})
@@ -1187,21 +5558,99 @@ func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handl
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/scenes/{scene_id}/tiles", wrapper.GetScenesSceneIdTiles)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/searches", wrapper.GetSearches)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/searches", wrapper.PostSearches)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/searches/{id}", wrapper.DeleteSearchesId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/selections", wrapper.GetSelections)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/selections", wrapper.PostSelections)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/selections/{id}", wrapper.DeleteSelectionsId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/selections/{id}", wrapper.GetSelectionsId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/selections/{id}/convert", wrapper.PostSelectionsIdConvert)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/selections/{id}/files", wrapper.PostSelectionsIdFiles)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/sheets", wrapper.PostSheets)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/state", wrapper.GetState)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/state/{key}", wrapper.DeleteStateKey)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/state/{key}", wrapper.GetStateKey)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/state/{key}", wrapper.PutStateKey)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/subjects", wrapper.GetSubjects)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/subjects/{id}", wrapper.GetSubjectsId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/subjects/{id}/label", wrapper.PostSubjectsIdLabel)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/tags", wrapper.GetTags)
 	})
 	r.Group(func(r chi.Router) {
 		r.Post(options.BaseURL+"/tags", wrapper.PostTags)
 	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/tags/{id}", wrapper.PutTagsId)
+	})
 	r.Group(func(r chi.Router) {
 		r.Post(options.BaseURL+"/tags/{id}/files", wrapper.PostTagsIdFiles)
 	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/tags/{id}/merge", wrapper.PostTagsIdMerge)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/tags/{id}/rename", wrapper.PostTagsIdRename)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/tags/{id}/revisions", wrapper.GetTagsIdRevisions)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/tags/{id}/revisions/diff", wrapper.GetTagsIdRevisionsDiff)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/tags/{id}/rollback", wrapper.PostTagsIdRollback)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/tasks", wrapper.GetTasks)
 	})
 	r.Group(func(r chi.Router) {
 		r.Post(options.BaseURL+"/tasks", wrapper.PostTasks)
 	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/trips", wrapper.GetTrips)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/trips/{id}", wrapper.GetTripsId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/verification", wrapper.GetVerification)
+	})
 
 	return r
 }
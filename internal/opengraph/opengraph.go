@@ -0,0 +1,88 @@
+// Package opengraph adds Open Graph metadata to pages, so that links
+// posted to chat apps and social networks are previewed with a title,
+// description and image.
+package opengraph
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+)
+
+// Recommended size of preview images, which most apps crop to about 1.91:1
+const (
+	ImageWidth  = 1200
+	ImageHeight = 630
+)
+
+// Meta is the metadata of a page
+type Meta struct {
+	Title       string
+	Description string
+	SiteName    string
+	// Absolute URL of the page
+	Url string
+	// Absolute URL of the preview image
+	Image       string
+	ImageWidth  int
+	ImageHeight int
+}
+
+func (meta Meta) tags() []byte {
+	var b bytes.Buffer
+	property := func(name, content string) {
+		if content == "" {
+			return
+		}
+		fmt.Fprintf(&b, "<meta property=\"%s\" content=\"%s\">\n", name, html.EscapeString(content))
+	}
+	name := func(name, content string) {
+		if content == "" {
+			return
+		}
+		fmt.Fprintf(&b, "<meta name=\"%s\" content=\"%s\">\n", name, html.EscapeString(content))
+	}
+	property("og:type", "website")
+	property("og:title", meta.Title)
+	property("og:description", meta.Description)
+	property("og:site_name", meta.SiteName)
+	property("og:url", meta.Url)
+	property("og:image", meta.Image)
+	if meta.Image != "" && meta.ImageWidth > 0 && meta.ImageHeight > 0 {
+		property("og:image:width", strconv.Itoa(meta.ImageWidth))
+		property("og:image:height", strconv.Itoa(meta.ImageHeight))
+	}
+	card := "summary"
+	if meta.Image != "" {
+		card = "summary_large_image"
+	}
+	name("twitter:card", card)
+	name("twitter:title", meta.Title)
+	name("twitter:description", meta.Description)
+	name("twitter:image", meta.Image)
+	return b.Bytes()
+}
+
+var titleRegex = regexp.MustCompile(`(?is)<title>.*?</title>`)
+var headEndRegex = regexp.MustCompile(`(?i)</head>`)
+
+// Inject returns the HTML page with the title replaced by the one of the
+// metadata and the metadata added at the end of the head. Pages without a
+// head are returned as they are.
+func Inject(page []byte, meta Meta) []byte {
+	end := headEndRegex.FindIndex(page)
+	if end == nil {
+		return page
+	}
+	out := make([]byte, 0, len(page)+1024)
+	out = append(out, page[:end[0]]...)
+	out = append(out, meta.tags()...)
+	out = append(out, page[end[0]:]...)
+	if meta.Title != "" {
+		title := []byte("<title>" + html.EscapeString(meta.Title) + "</title>")
+		out = titleRegex.ReplaceAllLiteral(out, title)
+	}
+	return out
+}
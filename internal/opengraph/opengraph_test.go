@@ -0,0 +1,40 @@
+package opengraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInject(t *testing.T) {
+	page := []byte("<html>\n<head>\n  <title>Photos</title>\n</head>\n<body></body>\n</html>")
+	out := string(Inject(page, Meta{
+		Title:       `Tom & Jerry's "trip"`,
+		Description: "12 photos",
+		Url:         "https://photos.example.com/collections/trip",
+		Image:       "https://photos.example.com/api/collections/trip/preview",
+		ImageWidth:  ImageWidth,
+		ImageHeight: ImageHeight,
+	}))
+
+	for _, expected := range []string{
+		"<title>Tom &amp; Jerry&#39;s &#34;trip&#34;</title>",
+		`<meta property="og:title" content="Tom &amp; Jerry&#39;s &#34;trip&#34;">`,
+		`<meta property="og:image" content="https://photos.example.com/api/collections/trip/preview">`,
+		`<meta property="og:image:width" content="1200">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s in\n%s", expected, out)
+		}
+	}
+	if strings.Index(out, "og:title") > strings.Index(out, "</head>") {
+		t.Errorf("expected the metadata in the head\n%s", out)
+	}
+	if strings.Contains(out, "<title>Photos</title>") {
+		t.Errorf("expected the title to be replaced\n%s", out)
+	}
+
+	if out := Inject([]byte("no head"), Meta{Title: "x"}); string(out) != "no head" {
+		t.Errorf("expected the page as is, got %s", out)
+	}
+}
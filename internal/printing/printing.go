@@ -0,0 +1,191 @@
+// Package printing exports single photos at full resolution for printing,
+// keeping their color profile, which the resized variants used for
+// viewing do not.
+package printing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	goimage "image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+
+	"photofield/internal/icc"
+	"photofield/internal/image"
+	"photofield/internal/logging"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/rasterizer"
+)
+
+var decodeLog = logging.Module("decode")
+
+const (
+	JPEG = "jpeg"
+	TIFF = "tiff"
+)
+
+// Millimeters per point, as the font size is in points
+const mmPerPt = 25.4 / 72
+
+// Original keeps the profile of the photo
+const Original = "original"
+
+type Options struct {
+	// Format of the export, jpeg or tiff
+	Format string
+	// Profile the photo is converted to, srgb, display-p3, adobe-rgb or
+	// original to keep the profile of the photo
+	Profile string
+	// White border around the photo, in percent of its longer side
+	Border int
+	// Caption below the photo, none if empty
+	Caption string
+	// Resolution stored in the file, in dots per inch
+	DPI int
+}
+
+func (options *Options) Validate() error {
+	switch options.Format {
+	case "", JPEG, TIFF:
+	default:
+		return fmt.Errorf("unsupported format %s, use jpeg or tiff", options.Format)
+	}
+	if options.Profile != "" && options.Profile != Original {
+		if _, err := icc.Builtin(options.Profile); err != nil {
+			return err
+		}
+	}
+	if options.Border < 0 || options.Border > 25 {
+		return fmt.Errorf("border must be between 0 and 25 percent")
+	}
+	if options.DPI < 0 || options.DPI > 2400 {
+		return fmt.Errorf("dpi must be between 1 and 2400")
+	}
+	return nil
+}
+
+func (options Options) withDefaults() Options {
+	if options.Format == "" {
+		options.Format = JPEG
+	}
+	if options.Profile == "" {
+		options.Profile = Original
+	}
+	if options.DPI == 0 {
+		options.DPI = 300
+	}
+	return options
+}
+
+// Export writes the photo with the id at full resolution, with the
+// profile of the original converted or kept as is. Photos without a
+// profile are assumed to be sRGB.
+func Export(ctx context.Context, w io.Writer, source *image.Source, id image.ImageId, fonts *canvas.FontFamily, options Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	options = options.withDefaults()
+
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		return err
+	}
+	if source.IsSupportedVideo(path) {
+		return fmt.Errorf("videos are not supported")
+	}
+
+	profile := icc.SRGB()
+	data, err := icc.Read(path)
+	if err != nil {
+		decodeLog.Warn("printing unable to read profile, assuming srgb", "path", path, "err", err)
+	} else if data != nil {
+		parsed, err := icc.Parse(data)
+		switch {
+		case err == nil:
+			profile = parsed
+		case options.Profile != Original:
+			return fmt.Errorf("unable to convert from the profile of the photo: %w", err)
+		case errors.Is(err, icc.ErrUnsupported) && string(data[16:20]) == "RGB ":
+			// Kept as is even though it cannot be converted
+			profile = &icc.Profile{Data: data}
+		default:
+			// E.g. CMYK profiles, which do not match the decoded pixels
+			decodeLog.Warn("printing skipping profile", "path", path, "err", err)
+		}
+	}
+
+	// Full resolution and not yet converted to the colors of the tiles
+	img, err := source.LoadOriginal(ctx, id)
+	if err != nil {
+		return err
+	}
+	photo := goimage.NewRGBA(goimage.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	// Transparent photos are printed on white
+	draw.Draw(photo, photo.Bounds(), goimage.White, goimage.Point{}, draw.Src)
+	draw.Draw(photo, photo.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	if options.Profile != Original {
+		to, err := icc.Builtin(options.Profile)
+		if err != nil {
+			return err
+		}
+		if err := icc.Convert(photo, profile, to); err != nil {
+			return err
+		}
+		profile = to
+	}
+
+	out := frame(photo, fonts, options)
+
+	switch options.Format {
+	case TIFF:
+		return writeTIFF(w, out, profile.Data, options.DPI)
+	default:
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, out, &jpeg.Options{Quality: 95}); err != nil {
+			return err
+		}
+		return icc.WriteJPEG(w, b.Bytes(), profile.Data, options.DPI)
+	}
+}
+
+// frame adds the border and caption around the photo, returning it as is
+// if there are none
+func frame(photo *goimage.RGBA, fonts *canvas.FontFamily, options Options) *goimage.RGBA {
+	if options.Border == 0 && (options.Caption == "" || fonts == nil) {
+		return photo
+	}
+	b := photo.Bounds()
+	long := b.Dx()
+	if b.Dy() > long {
+		long = b.Dy()
+	}
+	border := int(math.Round(float64(long*options.Border) / 100))
+
+	// Font size in pixels
+	size := math.Max(float64(long)/80, 12)
+	bottom := border
+	if options.Caption != "" && fonts != nil {
+		bottom = border + int(size*3)
+	}
+
+	out := goimage.NewRGBA(goimage.Rect(0, 0, b.Dx()+2*border, b.Dy()+border+bottom))
+	draw.Draw(out, out.Bounds(), goimage.White, goimage.Point{}, draw.Src)
+	draw.Draw(out, b.Add(goimage.Pt(border, border)), photo, b.Min, draw.Src)
+
+	if options.Caption != "" && fonts != nil {
+		// One pixel per millimeter, so that sizes are in pixels, with the
+		// canvas y axis pointing up
+		c := canvas.NewContext(rasterizer.New(out, canvas.DPMM(1)))
+		face := fonts.Face(size/mmPerPt, canvas.Dimgray, canvas.FontRegular, canvas.FontNormal)
+		text := canvas.NewTextLine(face, options.Caption, canvas.Center)
+		y := float64(bottom)/2 - face.Metrics().XHeight/2
+		c.DrawText(float64(out.Bounds().Dx())/2, y, text)
+	}
+	return out
+}
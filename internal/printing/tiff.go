@@ -0,0 +1,118 @@
+package printing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// TIFF field types
+const (
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffRational  = 5
+	tiffUndefined = 7
+)
+
+type tiffField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	// Values that do not fit into the four bytes of the entry
+	data []byte
+	// Value that fits into the entry
+	value uint32
+}
+
+// writeTIFF writes the image as an uncompressed 8-bit RGB TIFF with the
+// profile embedded, which x/image/tiff has no way of doing
+func writeTIFF(w io.Writer, img *image.RGBA, profile []byte, dpi int) error {
+	le := binary.LittleEndian
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	stripSize := uint32(width * height * 3)
+
+	resolution := make([]byte, 8)
+	le.PutUint32(resolution[0:], uint32(dpi))
+	le.PutUint32(resolution[4:], 1)
+
+	fields := []tiffField{
+		{tag: 256, typ: tiffLong, count: 1, value: uint32(width)},
+		{tag: 257, typ: tiffLong, count: 1, value: uint32(height)},
+		{tag: 258, typ: tiffShort, count: 3, data: []byte{8, 0, 8, 0, 8, 0}},
+		// No compression
+		{tag: 259, typ: tiffShort, count: 1, value: 1},
+		// RGB
+		{tag: 262, typ: tiffShort, count: 1, value: 2},
+		// Strip offset, set below
+		{tag: 273, typ: tiffLong, count: 1},
+		{tag: 277, typ: tiffShort, count: 1, value: 3},
+		{tag: 278, typ: tiffLong, count: 1, value: uint32(height)},
+		{tag: 279, typ: tiffLong, count: 1, value: stripSize},
+		{tag: 282, typ: tiffRational, count: 1, data: resolution},
+		{tag: 283, typ: tiffRational, count: 1, data: resolution},
+		// Chunky
+		{tag: 284, typ: tiffShort, count: 1, value: 1},
+		// Inches
+		{tag: 296, typ: tiffShort, count: 1, value: 2},
+	}
+	if len(profile) > 0 {
+		fields = append(fields, tiffField{tag: 34675, typ: tiffUndefined, count: uint32(len(profile)), data: profile})
+	}
+
+	// Header, directory and the values that do not fit into it, followed
+	// by the image data
+	const headerSize = 8
+	dirSize := 2 + 12*len(fields) + 4
+	offset := uint32(headerSize + dirSize)
+	offsets := make([]uint32, len(fields))
+	for i, f := range fields {
+		if f.data != nil {
+			offsets[i] = offset
+			offset += uint32(len(f.data))
+			offset += offset % 2
+		}
+	}
+	fields[5].value = offset
+
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{'I', 'I', 42, 0})
+	binary.Write(bw, le, uint32(headerSize))
+	binary.Write(bw, le, uint16(len(fields)))
+	for i, f := range fields {
+		binary.Write(bw, le, f.tag)
+		binary.Write(bw, le, f.typ)
+		binary.Write(bw, le, f.count)
+		if f.data != nil {
+			binary.Write(bw, le, offsets[i])
+		} else if f.typ == tiffShort {
+			binary.Write(bw, le, uint16(f.value))
+			binary.Write(bw, le, uint16(0))
+		} else {
+			binary.Write(bw, le, f.value)
+		}
+	}
+	// No next directory
+	binary.Write(bw, le, uint32(0))
+	for _, f := range fields {
+		if f.data != nil {
+			bw.Write(f.data)
+			if len(f.data)%2 != 0 {
+				bw.WriteByte(0)
+			}
+		}
+	}
+
+	row := make([]byte, width*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := 0; x < width; x++ {
+			copy(row[x*3:x*3+3], pix[x*4:x*4+3])
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,32 @@
+package printing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestWriteTIFF(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(2, 1, color.RGBA{10, 20, 30, 255})
+
+	var b bytes.Buffer
+	// Odd length, so that the image data needs to be aligned
+	if err := writeTIFF(&b, img, []byte("abc"), 300); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := tiff.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != img.Bounds() {
+		t.Fatalf("unexpected bounds %v", decoded.Bounds())
+	}
+	r, g, bl, _ := decoded.At(2, 1).RGBA()
+	if r>>8 != 10 || g>>8 != 20 || bl>>8 != 30 {
+		t.Errorf("unexpected color %d %d %d", r>>8, g>>8, bl>>8)
+	}
+}
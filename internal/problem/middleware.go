@@ -0,0 +1,87 @@
+package problem
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Middleware converts plain text error responses, e.g. written by
+// http.Error in generated parameter parsing or http.ServeFile, into problems
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &plainErrorWriter{
+			ResponseWriter: w,
+			r:              r,
+		}
+		next.ServeHTTP(pw, r)
+		pw.flush()
+	})
+}
+
+func codeOfStatus(status int) Code {
+	switch {
+	case status == http.StatusUnauthorized:
+		return Unauthorized
+	case status == http.StatusForbidden:
+		return Forbidden
+	case status == http.StatusNotFound:
+		return NotFound
+	case status == http.StatusConflict:
+		return Conflict
+	case status == http.StatusServiceUnavailable:
+		return Unavailable
+	case status >= 500:
+		return Internal
+	default:
+		return InvalidRequest
+	}
+}
+
+type plainErrorWriter struct {
+	http.ResponseWriter
+	r *http.Request
+	// Status of the intercepted error, zero if not intercepted
+	status  int
+	message strings.Builder
+}
+
+func (pw *plainErrorWriter) WriteHeader(status int) {
+	if status >= 400 && strings.HasPrefix(pw.Header().Get("Content-Type"), "text/plain") {
+		pw.status = status
+		return
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *plainErrorWriter) Write(b []byte) (int, error) {
+	if pw.status != 0 {
+		return pw.message.Write(b)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps the sendfile optimization of the underlying writer when
+// serving files
+func (pw *plainErrorWriter) ReadFrom(r io.Reader) (int64, error) {
+	if pw.status != 0 {
+		return io.Copy(&pw.message, r)
+	}
+	if rf, ok := pw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(pw.ResponseWriter, r)
+}
+
+func (pw *plainErrorWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+func (pw *plainErrorWriter) flush() {
+	if pw.status == 0 {
+		return
+	}
+	pw.Header().Del("X-Content-Type-Options")
+	message := strings.TrimSpace(pw.message.String())
+	New(pw.status, codeOfStatus(pw.status), message).Write(pw.ResponseWriter, pw.r)
+}
@@ -0,0 +1,132 @@
+// Package problem defines the structured errors returned by the API.
+//
+// Each error has a machine-readable code, grouped by the part before the
+// first dot, e.g. "not_found.scene" is in the "not_found" group, so that
+// clients can handle whole groups of failures without knowing every code.
+package problem
+
+import (
+	"net/http"
+	"strings"
+
+	chirender "github.com/go-chi/render"
+)
+
+type Code string
+
+const (
+	// The request is malformed or has invalid parameters
+	InvalidRequest   Code = "invalid_request"
+	InvalidParameter Code = "invalid_request.parameter"
+	InvalidBody      Code = "invalid_request.body"
+	Unsupported      Code = "invalid_request.unsupported"
+	InvalidQuery     Code = "invalid_request.query"
+
+	// The request is missing a valid API key
+	Unauthorized  Code = "unauthorized"
+	InvalidApiKey Code = "unauthorized.api_key"
+
+	// The API key is missing a required scope
+	Forbidden Code = "forbidden"
+
+	// The requested resource does not exist
+	NotFound           Code = "not_found"
+	CollectionNotFound Code = "not_found.collection"
+	SceneNotFound      Code = "not_found.scene"
+	FileNotFound       Code = "not_found.file"
+	RegionNotFound     Code = "not_found.region"
+	TagNotFound        Code = "not_found.tag"
+	CameraNotFound     Code = "not_found.camera"
+	SourceNotFound     Code = "not_found.source"
+	StateNotFound      Code = "not_found.state"
+	PanoramaNotFound   Code = "not_found.panorama"
+	TripNotFound       Code = "not_found.trip"
+	SearchNotFound     Code = "not_found.search"
+	SubjectNotFound    Code = "not_found.subject"
+	RevisionNotFound   Code = "not_found.revision"
+	SelectionNotFound  Code = "not_found.selection"
+
+	// The files have not been indexed yet, retry after indexing
+	NotIndexed         Code = "not_indexed"
+	MetadataNotIndexed Code = "not_indexed.metadata"
+
+	// The request conflicts with the current state, e.g. a task in progress
+	Conflict        Code = "conflict"
+	VersionConflict Code = "conflict.version"
+	TagExists       Code = "conflict.tag"
+
+	// A service the request depends on is unavailable, retry later
+	Unavailable       Code = "unavailable"
+	AIUnavailable     Code = "unavailable.ai"
+	SourceUnavailable Code = "unavailable.source"
+	ReadOnly          Code = "unavailable.read_only"
+
+	// Unexpected server error
+	Internal Code = "internal"
+)
+
+// Group returns the group of the code, e.g. "not_found" for
+// "not_found.scene"
+func (c Code) Group() Code {
+	group, _, _ := strings.Cut(string(c), ".")
+	return Code(group)
+}
+
+// Retryable reports whether repeating the same request later can succeed
+func (c Code) Retryable() bool {
+	switch c.Group() {
+	case NotIndexed, Conflict, Unavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+type Problem struct {
+	Status  int    `json:"status"`
+	Code    Code   `json:"code"`
+	Group   Code   `json:"group"`
+	Message string `json:"message"`
+	// Same as the message, kept for existing clients
+	Title     string         `json:"title"`
+	Details   map[string]any `json:"details,omitempty"`
+	Retryable bool           `json:"retryable"`
+}
+
+func New(status int, code Code, message string) *Problem {
+	return &Problem{
+		Status:    status,
+		Code:      code,
+		Group:     code.Group(),
+		Message:   message,
+		Title:     message,
+		Retryable: code.Retryable(),
+	}
+}
+
+// With adds a detail to the problem, e.g. the invalid parameter
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Details == nil {
+		p.Details = make(map[string]any)
+	}
+	p.Details[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	return string(p.Code) + ": " + p.Message
+}
+
+func (p *Problem) Render(w http.ResponseWriter, r *http.Request) error {
+	chirender.Status(r, p.Status)
+	return nil
+}
+
+func (p *Problem) Write(w http.ResponseWriter, r *http.Request) {
+	chirender.Render(w, r, p)
+}
+
+// Write responds with a problem without details
+func Write(w http.ResponseWriter, r *http.Request, status int, code Code, message string) {
+	New(status, code, message).Write(w, r)
+}
@@ -0,0 +1,76 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		code      Code
+		group     Code
+		retryable bool
+	}{
+		{SceneNotFound, NotFound, false},
+		{NotFound, NotFound, false},
+		{MetadataNotIndexed, NotIndexed, true},
+		{SourceUnavailable, Unavailable, true},
+		{ReadOnly, Unavailable, true},
+		{InvalidParameter, InvalidRequest, false},
+		{Internal, Internal, false},
+	}
+	for _, c := range cases {
+		t.Run(string(c.code), func(t *testing.T) {
+			if got := c.code.Group(); got != c.group {
+				t.Errorf("expected group %s, got %s", c.group, got)
+			}
+			if got := c.code.Retryable(); got != c.retryable {
+				t.Errorf("expected retryable %v, got %v", c.retryable, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		code    Code
+		message string
+	}{
+		{"plain error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Invalid format for parameter id", http.StatusBadRequest)
+		}, http.StatusBadRequest, InvalidRequest, "Invalid format for parameter id"},
+		{"not found", http.NotFound, http.StatusNotFound, NotFound, "404 page not found"},
+		{"problem", func(w http.ResponseWriter, r *http.Request) {
+			Write(w, r, http.StatusNotFound, SceneNotFound, "Scene not found")
+		}, http.StatusNotFound, SceneNotFound, "Scene not found"},
+		{"ok", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("ok"))
+		}, http.StatusOK, "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			Middleware(c.handler).ServeHTTP(w, r)
+			if w.Code != c.status {
+				t.Errorf("expected %d, got %d", c.status, w.Code)
+			}
+			if c.code == "" {
+				return
+			}
+			var p Problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatalf("unable to decode problem: %s", err)
+			}
+			if p.Code != c.code || p.Message != c.message || p.Status != c.status {
+				t.Errorf("expected %d %s %q, got %d %s %q", c.status, c.code, c.message, p.Status, p.Code, p.Message)
+			}
+		})
+	}
+}
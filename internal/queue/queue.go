@@ -1,8 +1,10 @@
 package queue
 
 import (
-	"log"
+	"photofield/internal/logging"
 	"photofield/internal/metrics"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,18 +12,39 @@ import (
 	"github.com/sheerun/queue"
 )
 
+var indexLog = logging.Module("indexer")
+
 type Queue struct {
 	queue       *queue.Queue
 	ID          string
 	Name        string
 	Worker      func(<-chan interface{})
 	WorkerCount int
+
+	initOnce sync.Once
+	running  atomic.Bool
+	stopOnce sync.Once
+	stop     chan struct{}
+	stopped  chan []interface{}
+	// Last items handed out to the workers, which might still be processed
+	recent []interface{}
+}
+
+// stopSignal wakes up Run waiting for items when the queue is stopped
+type stopSignal struct{}
+
+func (q *Queue) init() {
+	q.initOnce.Do(func() {
+		if q.queue == nil {
+			q.queue = queue.New()
+		}
+		q.stop = make(chan struct{})
+		q.stopped = make(chan []interface{}, 1)
+	})
 }
 
 func (q *Queue) Run() {
-	if q.queue == nil {
-		q.queue = queue.New()
-	}
+	q.init()
 
 	loadCount := 0
 	lastLoadCount := 0
@@ -32,6 +55,11 @@ func (q *Queue) Run() {
 		Namespace: metrics.Namespace,
 		Name:      q.ID + "_done",
 	})
+	var rateGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      q.ID + "_per_second",
+		Help:      "Items processed per second since the previous progress log",
+	})
 
 	logging := false
 
@@ -46,15 +74,27 @@ func (q *Queue) Run() {
 			go q.Worker(items)
 		}
 	}
+	q.recent = make([]interface{}, q.WorkerCount)
+	q.running.Store(true)
 
 	for {
 		if q.Worker != nil {
 			item := q.queue.Pop()
 			if item == nil {
-				log.Printf("%s queue stopping\n", q.Name)
+				indexLog.Info("queue stopping", "queue", q.Name)
+				return
+			}
+			if _, ok := item.(stopSignal); ok {
+				q.stopped <- q.drain(nil)
+				return
+			}
+			select {
+			case items <- item:
+				q.recent[loadCount%len(q.recent)] = item
+			case <-q.stop:
+				q.stopped <- q.drain(item)
 				return
 			}
-			items <- item
 		}
 		doneCounter.Inc()
 
@@ -62,6 +102,7 @@ func (q *Queue) Run() {
 		elapsed := now.Sub(lastLogTime)
 		if elapsed > logInterval || q.queue.Length() == 0 {
 			perSec := float64(loadCount-lastLoadCount) / elapsed.Seconds()
+			rateGauge.Set(perSec)
 			pendingCount := q.queue.Length()
 			percent := 100
 			if loadCount+pendingCount > 0 {
@@ -73,7 +114,7 @@ func (q *Queue) Run() {
 				perSecDiv = int(perSec)
 			}
 			timeLeft := time.Duration(pendingCount/perSecDiv) * time.Second
-			log.Printf("%s %4d%% completed, %5d loaded, %5d pending, %.2f / sec, %s left\n", q.Name, percent, loadCount, pendingCount, perSec, timeLeft)
+			indexLog.Info("queue progress", "queue", q.Name, "percent", percent, "loaded", loadCount, "pending", pendingCount, "per_sec", perSec, "left", timeLeft)
 			lastLoadCount = loadCount
 			lastLogTime = now
 		}
@@ -82,11 +123,50 @@ func (q *Queue) Run() {
 
 		if logging {
 			// log.Printf("image info load for id %5d, %5d pending, %5d ms get file, %5d ms set db, %5d ms set cache\n", id, len(backlog), fileGetMs, dbSetMs, cacheSetMs)
-			log.Printf("%s queue %5d pending\n", q.Name, q.queue.Length())
+			indexLog.Info("queue pending", "queue", q.Name, "pending", q.queue.Length())
 		}
 	}
 }
 
+// drain removes and returns the items not handed out to the workers yet,
+// preceded by the recently handed out ones and the popped item if not nil
+func (q *Queue) drain(item interface{}) []interface{} {
+	var items []interface{}
+	for _, r := range q.recent {
+		if r != nil {
+			items = append(items, r)
+		}
+	}
+	if item != nil {
+		items = append(items, item)
+	}
+	for q.queue.Length() > 0 {
+		item := q.queue.Pop()
+		if _, ok := item.(stopSignal); !ok {
+			items = append(items, item)
+		}
+	}
+	indexLog.Info("queue stopped", "queue", q.Name, "left", len(items))
+	return items
+}
+
+// Stop stops handing out items to the workers and returns the ones that
+// were not processed yet, including the last ones handed out, as they might
+// still be processed. The workers finish their current items in the
+// background.
+func (q *Queue) Stop() []interface{} {
+	if !q.running.Load() || q.Worker == nil {
+		return nil
+	}
+	var items []interface{}
+	q.stopOnce.Do(func() {
+		close(q.stop)
+		q.queue.Append(stopSignal{})
+		items = <-q.stopped
+	})
+	return items
+}
+
 func (q *Queue) Length() int {
 	if q.queue == nil {
 		return 0
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStop(t *testing.T) {
+	started := make(chan int)
+	release := make(chan struct{})
+	q := Queue{
+		ID:   "test_stop",
+		Name: "test stop",
+		Worker: func(items <-chan interface{}) {
+			for item := range items {
+				started <- item.(int)
+				<-release
+			}
+		},
+		WorkerCount: 1,
+	}
+	q.init()
+	go q.Run()
+	for !q.running.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	items := make(chan interface{}, 5)
+	for i := 1; i <= 5; i++ {
+		items <- i
+	}
+	close(items)
+	q.AppendItems(items)
+
+	if first := <-started; first != 1 {
+		t.Fatalf("expected item 1 to be processed first, got %d", first)
+	}
+
+	left := q.Stop()
+	close(release)
+
+	// The item being processed is returned as well, as it might not finish
+	expected := []int{1, 2, 3, 4, 5}
+	if len(left) != len(expected) {
+		t.Fatalf("expected %v left, got %v", expected, left)
+	}
+	for i, e := range expected {
+		if left[i] != e {
+			t.Errorf("expected %v left, got %v", expected, left)
+			break
+		}
+	}
+
+	if again := q.Stop(); again != nil {
+		t.Errorf("expected nothing left after stopping twice, got %v", again)
+	}
+}
@@ -61,7 +61,7 @@ func renderImageFast(rimg draw.Image, img goimage.Image, m canvas.Matrix) {
 		m[0][0], -m[0][1], origin.X,
 		-m[1][0], m[1][1], h - origin.Y,
 	}
-	draw.ApproxBiLinear.Transform(rimg, aff3, img, bounds, draw.Src, nil)
+	transform(rimg, aff3, img, bounds)
 }
 
 func renderImageFastBounds(rimg draw.Image, img goimage.Image, m canvas.Matrix, bounds goimage.Rectangle) {
@@ -71,7 +71,7 @@ func renderImageFastBounds(rimg draw.Image, img goimage.Image, m canvas.Matrix,
 		m[0][0], -m[0][1], origin.X,
 		-m[1][0], m[1][1], h - origin.Y,
 	}
-	draw.ApproxBiLinear.Transform(rimg, aff3, img, bounds, draw.Src, nil)
+	transform(rimg, aff3, img, bounds)
 }
 
 // TODO finish implementation
@@ -99,7 +99,7 @@ func renderImageFastCropped(rimg draw.Image, img goimage.Image, m canvas.Matrix,
 	println(bounds.String(), "crop", crop.String(), "model", model.String())
 	bounds = bounds.Inset(10)
 	// bounds =
-	draw.ApproxBiLinear.Transform(rimg, aff3, img, bounds, draw.Src, nil)
+	transform(rimg, aff3, img, bounds)
 }
 
 func (bitmap *Bitmap) DrawOverdraw(c *canvas.Context, size goimage.Point) {
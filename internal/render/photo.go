@@ -3,16 +3,20 @@ package render
 import (
 	"context"
 	"fmt"
+	goimage "image"
 	"image/color"
-	"log"
 	"math"
 	"photofield/internal/image"
+	"photofield/internal/logging"
+	"photofield/internal/tracing"
 	"photofield/io"
 	"time"
 
 	"github.com/tdewolff/canvas"
 )
 
+var renderLog = logging.Module("render")
+
 type Photo struct {
 	Id     image.ImageId
 	Sprite Sprite
@@ -30,7 +34,7 @@ func (photo *Photo) GetInfo(source *image.Source) image.Info {
 func (photo *Photo) GetPath(source *image.Source) string {
 	path, err := source.GetImagePath(photo.Id)
 	if err != nil {
-		log.Fatalf("Unable to get photo path for id %v", photo.Id)
+		renderLog.Fatal("unable to get photo path", "id", photo.Id)
 	}
 	return path
 }
@@ -43,41 +47,89 @@ func (photo *Photo) Place(x float64, y float64, width float64, height float64, s
 	photo.Sprite.PlaceFit(x, y, width, height, imageWidth, imageHeight)
 }
 
-func (photo *Photo) Draw(config *Render, scene *Scene, c *canvas.Context, scales Scales, source *image.Source, selected bool) {
-	pixelArea := photo.Sprite.Rect.GetPixelArea(c, image.Size{X: 1, Y: 1})
-	if pixelArea < config.MaxSolidPixelArea {
+// DrawSolid draws the photo as a solid rectangle of its dominant color
+func (photo *Photo) DrawSolid(c *canvas.Context, source *image.Source, selected bool) {
+	style := c.Style
+
+	scale := 1.
+	if selected {
 		style := c.Style
+		style.FillColor = color.RGBA{0xe4, 0xf2, 0xff, 0xff}
+		photo.Sprite.DrawWithStyle(c, style)
+		scale = 0.8
+	}
 
-		scale := 1.
-		if selected {
-			style := c.Style
-			style.FillColor = color.RGBA{0xe4, 0xf2, 0xff, 0xff}
-			photo.Sprite.DrawWithStyle(c, style)
-			scale = 0.8
-		}
+	// TODO: this can be a bottleneck for lots of images
+	// if it ends up hitting the database for each individual image
+	info := source.GetInfo(photo.Id)
+	style.FillColor = info.GetColor()
 
-		// TODO: this can be a bottleneck for lots of images
-		// if it ends up hitting the database for each individual image
-		info := source.GetInfo(photo.Id)
-		style.FillColor = info.GetColor()
+	photo.Sprite.DrawInsetWithStyle(c, style, (1-scale)*photo.Sprite.Rect.W)
+}
+
+// Draw draws the photo, returning false if it was not drawn because the
+// deadline of the render passed while loading it
+func (photo *Photo) Draw(config *Render, scene *Scene, c *canvas.Context, scales Scales, source *image.Source, selected bool) bool {
+	pixelArea := photo.Sprite.Rect.GetPixelArea(c, image.Size{X: 1, Y: 1})
+	if pixelArea < config.MaxSolidPixelArea {
+		if !config.beginDraw() {
+			return false
+		}
+		defer config.endDraw()
+		photo.DrawSolid(c, source, selected)
+		return true
+	}
 
-		photo.Sprite.DrawInsetWithStyle(c, style, (1-scale)*photo.Sprite.Rect.W)
-		return
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.TODO()
 	}
+	ctx, span := tracing.Start(ctx, "draw photo", tracing.Int64("file_id", int64(photo.Id)))
+	defer span.End()
 
 	drawn := false
+	_, querying := tracing.Start(ctx, "get info")
 	path := photo.GetPath(source)
-
 	info := source.GetInfo(photo.Id)
+	querying.End()
 	size := info.Size()
 	rsize := photo.Sprite.Rect.RenderedSize(c, size)
+	if config.Detail > 0 && config.Detail < 1 {
+		// Loaded from smaller images and scaled up to the rendered size
+		rsize.X = int(math.Ceil(float64(rsize.X) * config.Detail))
+		rsize.Y = int(math.Ceil(float64(rsize.Y) * config.Detail))
+	}
 
+	if !selected {
+		if img, sprite, ok := photo.loadRegion(ctx, config, c, source, size, rsize); ok {
+			if !config.beginDraw() {
+				return false
+			}
+			defer config.endDraw()
+			bitmap := Bitmap{
+				Sprite:      sprite,
+				Orientation: image.Normal,
+			}
+			bitmap.DrawImage(config.CanvasImage, img, c, 1)
+			return true
+		}
+	}
+
+	_, selecting := tracing.Start(ctx, "select sources",
+		tracing.Int("width", rsize.X),
+		tracing.Int("height", rsize.Y),
+	)
 	srcs := source.Sources
 	if config.Sources != nil {
 		srcs = config.Sources
 	}
 	sources := srcs.EstimateCost(io.Size(size), io.Size(rsize))
 	sources.Sort()
+	if len(sources) > 0 {
+		selecting.SetAttributes(tracing.String("cheapest", sources[0].Name()))
+	}
+	selecting.SetAttributes(tracing.Int("candidates", len(sources)))
+	selecting.End()
 
 	var errs []error
 
@@ -85,9 +137,16 @@ func (photo *Photo) Draw(config *Render, scene *Scene, c *canvas.Context, scales
 		if drawn {
 			break
 		}
+		sctx, getting := tracing.Start(ctx, "source "+s.Name(), tracing.Int("rank", i))
 		start := time.Now()
-		r := s.Get(context.TODO(), io.ImageId(photo.Id), path)
+		r := s.Get(sctx, io.ImageId(photo.Id), path)
 		elapsed := time.Since(start)
+		getting.SetAttributes(
+			tracing.Bool("found", r.Image != nil),
+			tracing.Bool("from_cache", r.FromCache),
+		)
+		getting.RecordError(r.Error)
+		getting.End()
 
 		img, err := r.Image, r.Error
 		if img == nil || err != nil {
@@ -107,15 +166,25 @@ func (photo *Photo) Draw(config *Render, scene *Scene, c *canvas.Context, scales
 			source.SourcePerResizedMegapixelLatencyHistogram.WithLabelValues(name).Observe(elapsedus * 1e6 / float64(s.EstimatedArea))
 		}
 
+		orientation := image.Orientation(r.Orientation)
 		if r.Orientation == io.SourceInfoOrientation {
-			r.Orientation = io.Orientation(info.Orientation)
+			// Includes the orientation edit
+			orientation = info.Orientation
+		} else {
+			orientation = orientation.Compose(source.GetOrientationEdit(photo.Id))
 		}
+		source.VerifyOrientation(photo.Id, path, img, orientation)
 
 		bitmap := Bitmap{
 			Sprite:      photo.Sprite,
-			Orientation: image.Orientation(r.Orientation),
+			Orientation: orientation,
 		}
 
+		if !config.beginDraw() {
+			return false
+		}
+		defer config.endDraw()
+
 		scale := 1.
 		if selected {
 			style := c.Style
@@ -151,12 +220,65 @@ func (photo *Photo) Draw(config *Render, scene *Scene, c *canvas.Context, scales
 
 	if !drawn {
 		if len(errs) > 0 {
-			log.Printf("Unable to draw photo %v: %v", photo.Id, errs)
+			renderLog.Error("unable to draw photo", "id", photo.Id, "err", errs)
 		}
 
+		if !config.beginDraw() {
+			return false
+		}
+		defer config.endDraw()
+
 		style := c.Style
 		style.FillColor = canvas.Red
 		photo.Sprite.DrawWithStyle(c, style)
 	}
 
+	return true
+}
+
+// Largest share of a photo visible in a tile that is drawn from the tiles
+// of its deep zoom pyramid instead of the whole photo
+const maxRegionArea = 0.25
+
+// loadRegion returns the part of a large photo visible in the tile from its
+// deep zoom pyramid and the sprite to draw it in, or false if the tile is
+// not zoomed in far enough or the pyramid is not available
+func (photo *Photo) loadRegion(ctx context.Context, config *Render, c *canvas.Context, source *image.Source, size image.Size, rsize image.Size) (goimage.Image, Sprite, bool) {
+	if config.RegionMinMegapixels <= 0 || float64(size.X)*float64(size.Y) < config.RegionMinMegapixels*1e6 {
+		return nil, Sprite{}, false
+	}
+	rect := photo.Sprite.Rect
+	view := GetTileViewRect(c, config.TileSize)
+	x0 := math.Max(rect.X, view.X)
+	y0 := math.Max(rect.Y, view.Y)
+	x1 := math.Min(rect.X+rect.W, view.X+view.W)
+	y1 := math.Min(rect.Y+rect.H, view.Y+view.H)
+	if x1 <= x0 || y1 <= y0 {
+		return nil, Sprite{}, false
+	}
+	region := image.Region{
+		X: (x0 - rect.X) / rect.W,
+		Y: (y0 - rect.Y) / rect.H,
+		W: (x1 - x0) / rect.W,
+		H: (y1 - y0) / rect.H,
+	}
+	if region.W*region.H > maxRegionArea {
+		return nil, Sprite{}, false
+	}
+
+	ctx, span := tracing.Start(ctx, "load region")
+	defer span.End()
+	img, covered, err := source.LoadRegion(ctx, photo.Id, rsize, region)
+	span.SetAttributes(tracing.Bool("found", err == nil))
+	if err != nil {
+		return nil, Sprite{}, false
+	}
+	sprite := photo.Sprite
+	sprite.Rect = Rect{
+		X: rect.X + covered.X*rect.W,
+		Y: rect.Y + covered.Y*rect.H,
+		W: covered.W * rect.W,
+		H: covered.H * rect.H,
+	}
+	return img, sprite, true
 }
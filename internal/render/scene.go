@@ -1,6 +1,7 @@
 package render
 
 import (
+	"context"
 	"image/color"
 	"math"
 	"sync"
@@ -19,6 +20,13 @@ type Render struct {
 	MaxSolidPixelArea float64     `json:"max_solid_pixel_area"`
 	BackgroundColor   color.Color `json:"background_color"`
 	LogDraws          bool
+	// Photos with originals of at least this many megapixels are drawn
+	// from the tiles of their deep zoom pyramid in view once zoomed in,
+	// instead of decoding the whole original, never if 0
+	RegionMinMegapixels float64 `json:"region_min_megapixels"`
+	// Photos are loaded at this fraction of the size they are drawn at,
+	// e.g. to draw them from smaller thumbnails under load, full size if 0
+	Detail float64 `json:"-"`
 
 	Sources io.Sources
 
@@ -29,6 +37,44 @@ type Render struct {
 
 	Zoom        int
 	CanvasImage draw.Image
+
+	// Context of the request the render is for, carrying its trace
+	Context context.Context `json:"-"`
+
+	// Photos still loading once the deadline passes are drawn as
+	// placeholders, no deadline if zero
+	Deadline time.Time
+	budget   *budget
+}
+
+// budget stops photos from being drawn once the deadline of the render
+// passed, while photos that are still loading continue loading in the
+// background, so that they are cached once the tile is requested again
+type budget struct {
+	mutex  sync.RWMutex
+	sealed bool
+	drawn  sync.Map
+}
+
+// beginDraw returns true if the photo can be drawn, in which case endDraw
+// has to be called after drawing
+func (config *Render) beginDraw() bool {
+	if config.budget == nil {
+		return true
+	}
+	config.budget.mutex.RLock()
+	if config.budget.sealed {
+		config.budget.mutex.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (config *Render) endDraw() {
+	if config.budget == nil {
+		return
+	}
+	config.budget.mutex.RUnlock()
 }
 
 type Point struct {
@@ -75,6 +121,11 @@ type Scene struct {
 	Solids          []Solid        `json:"-"`
 	Texts           []Text         `json:"-"`
 	RegionSource    RegionSource   `json:"-"`
+
+	// Latest change of the laid out files, increasing as the scene is updated
+	Revision int64 `json:"revision,omitempty"`
+	// Area of the scene that changed with the latest update
+	Changed *Rect `json:"changed,omitempty"`
 }
 
 type Scales struct {
@@ -91,14 +142,35 @@ func drawPhotoRefs(id int, photoRefs <-chan PhotoRef, counts chan int, config *R
 	count := 0
 	for photoRef := range photoRefs {
 		selected := config.Selected.Contains(int(photoRef.Photo.Id))
-		photoRef.Photo.Draw(config, scene, c, scales, source, selected)
+		drawn := photoRef.Photo.Draw(config, scene, c, scales, source, selected)
+		if drawn && config.budget != nil {
+			config.budget.drawn.Store(photoRef.Index, struct{}{})
+		}
 		count++
 	}
 	wg.Done()
 	counts <- count
 }
 
-func (scene *Scene) Draw(config *Render, c *canvas.Context, scales Scales, source *image.Source) {
+// GetTileViewRect returns the area of the scene covered by a tile of the
+// provided size drawn with the provided context
+func GetTileViewRect(c *canvas.Context, tileSize int) Rect {
+	return GetViewRect(c.View(), tileSize)
+}
+
+// GetViewRect returns the area of the scene visible in a tile drawn with
+// the provided view
+func GetViewRect(view canvas.Matrix, tileSize int) Rect {
+	tileRect := Rect{X: 0, Y: 0, W: (float64)(tileSize), H: (float64)(tileSize)}
+	tileToCanvas := view.Inv()
+	tileCanvasRect := tileRect.Transform(tileToCanvas)
+	tileCanvasRect.Y = -tileCanvasRect.Y - tileCanvasRect.H
+	return tileCanvasRect
+}
+
+// Draw draws the scene, returning the number of photos drawn as
+// placeholders because the deadline of the render passed
+func (scene *Scene) Draw(config *Render, c *canvas.Context, scales Scales, source *image.Source) (missing int) {
 	for i := range scene.Solids {
 		solid := &scene.Solids[i]
 		solid.Draw(c, scales)
@@ -117,23 +189,30 @@ func (scene *Scene) Draw(config *Render, c *canvas.Context, scales Scales, sourc
 
 	// startTime := time.Now()
 
-	tileRect := Rect{X: 0, Y: 0, W: (float64)(config.TileSize), H: (float64)(config.TileSize)}
-	tileToCanvas := c.View().Inv()
-	tileCanvasRect := tileRect.Transform(tileToCanvas)
-	tileCanvasRect.Y = -tileCanvasRect.Y - tileCanvasRect.H
+	tileCanvasRect := GetTileViewRect(c, config.TileSize)
 
 	visiblePhotos := scene.GetVisiblePhotoRefs(tileCanvasRect, 0)
 	visiblePhotoCount := 0
 
+	if !config.Deadline.IsZero() {
+		config.budget = &budget{}
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(concurrent)
-	counts := make(chan int)
+	// Buffered, so that photos loading past the deadline do not block
+	counts := make(chan int, concurrent)
 	for i := 0; i < concurrent; i++ {
 		go drawPhotoRefs(i, visiblePhotos, counts, config, scene, c, scales, wg, source)
 	}
-	wg.Wait()
-	for i := 0; i < concurrent; i++ {
-		visiblePhotoCount += <-counts
+
+	if config.budget == nil {
+		wg.Wait()
+		for i := 0; i < concurrent; i++ {
+			visiblePhotoCount += <-counts
+		}
+	} else {
+		missing = scene.drawWithinBudget(config, c, source, tileCanvasRect, wg)
 	}
 
 	// micros := time.Since(startTime).Microseconds()
@@ -143,6 +222,41 @@ func (scene *Scene) Draw(config *Render, c *canvas.Context, scales Scales, sourc
 		text := &scene.Texts[i]
 		text.Draw(config, c, scales)
 	}
+	return missing
+}
+
+// drawWithinBudget waits for the photos to be drawn until the deadline,
+// after which the photos that were not drawn yet are drawn as placeholders
+func (scene *Scene) drawWithinBudget(config *Render, c *canvas.Context, source *image.Source, rect Rect, wg *sync.WaitGroup) int {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(time.Until(config.Deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return 0
+	case <-timer.C:
+	}
+
+	b := config.budget
+	b.mutex.Lock()
+	b.sealed = true
+	b.mutex.Unlock()
+
+	missing := 0
+	for photoRef := range scene.GetVisiblePhotoRefs(rect, 0) {
+		if _, ok := b.drawn.Load(photoRef.Index); ok {
+			continue
+		}
+		selected := config.Selected.Contains(int(photoRef.Photo.Id))
+		photoRef.Photo.DrawSolid(c, source, selected)
+		missing++
+	}
+	return missing
 }
 
 func (scene *Scene) GetTimestamps(height int, source *image.Source) []uint32 {
@@ -187,6 +301,30 @@ func (scene *Scene) AddPhotosFromIdSlice(ids []image.ImageId) {
 	scene.FileCount = len(scene.Photos)
 }
 
+// GetAdjacentPhotoIds returns the ids of up to count photos following the
+// photo with the provided id, or preceding it for a negative direction
+func (scene *Scene) GetAdjacentPhotoIds(id image.ImageId, direction int, count int) []image.ImageId {
+	index := -1
+	for i := range scene.Photos {
+		if scene.Photos[i].Id == id {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil
+	}
+	step := 1
+	if direction < 0 {
+		step = -1
+	}
+	ids := make([]image.ImageId, 0, count)
+	for i := index + step; i >= 0 && i < len(scene.Photos) && len(ids) < count; i += step {
+		ids = append(ids, scene.Photos[i].Id)
+	}
+	return ids
+}
+
 func (scene *Scene) GetVisiblePhotoRefs(view Rect, maxCount int) <-chan PhotoRef {
 	out := make(chan PhotoRef)
 	go func() {
@@ -0,0 +1,19 @@
+//go:build !gpu
+// +build !gpu
+
+package render
+
+import (
+	goimage "image"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// GPU reports whether the photos are composited on the GPU
+const GPU = false
+
+// transform draws the bounds of src into dst transformed by aff3
+func transform(dst draw.Image, aff3 f64.Aff3, src goimage.Image, bounds goimage.Rectangle) {
+	draw.ApproxBiLinear.Transform(dst, aff3, src, bounds, draw.Src, nil)
+}
@@ -0,0 +1,415 @@
+//go:build gpu
+// +build gpu
+
+package render
+
+/*
+#cgo LDFLAGS: -lEGL -lGLESv2
+#include <EGL/egl.h>
+#include <GLES2/gl2.h>
+
+#define EGL_PLATFORM_SURFACELESS 0x31DD
+
+static GLuint rgbaProgram, ycbcrProgram;
+static GLuint textures[3], target, framebuffer;
+static GLint maxSize;
+
+static const char* vertexSource =
+	"attribute vec2 position;\n"
+	"attribute vec2 uv;\n"
+	"varying vec2 v_uv;\n"
+	"void main() {\n"
+	"  v_uv = uv;\n"
+	"  gl_Position = vec4(position, 0.0, 1.0);\n"
+	"}\n";
+
+static const char* rgbaSource =
+	"precision highp float;\n"
+	"uniform sampler2D rgba;\n"
+	"varying vec2 v_uv;\n"
+	"void main() {\n"
+	"  gl_FragColor = vec4(texture2D(rgba, v_uv).rgb, 1.0);\n"
+	"}\n";
+
+// The planes can be wider and taller than the image, the coordinates are
+// clamped to the image to avoid sampling the padding
+static const char* ycbcrSource =
+	"precision highp float;\n"
+	"uniform sampler2D y;\n"
+	"uniform sampler2D cb;\n"
+	"uniform sampler2D cr;\n"
+	"uniform vec2 yMin, yMax, cMin, cMax, cScale;\n"
+	"varying vec2 v_uv;\n"
+	"void main() {\n"
+	"  float Y = texture2D(y, clamp(v_uv, yMin, yMax)).r;\n"
+	"  vec2 c = clamp(v_uv * cScale, cMin, cMax);\n"
+	"  float Cb = texture2D(cb, c).r - 0.5;\n"
+	"  float Cr = texture2D(cr, c).r - 0.5;\n"
+	"  gl_FragColor = vec4(\n"
+	"    clamp(Y + 1.402 * Cr, 0.0, 1.0),\n"
+	"    clamp(Y - 0.344136 * Cb - 0.714136 * Cr, 0.0, 1.0),\n"
+	"    clamp(Y + 1.772 * Cb, 0.0, 1.0),\n"
+	"    1.0);\n"
+	"}\n";
+
+static GLuint compile(GLenum type, const char* source) {
+	GLuint shader = glCreateShader(type);
+	glShaderSource(shader, 1, &source, NULL);
+	glCompileShader(shader);
+	GLint ok;
+	glGetShaderiv(shader, GL_COMPILE_STATUS, &ok);
+	return ok ? shader : 0;
+}
+
+static GLuint linkProgram(const char* fragmentSource) {
+	GLuint vertex = compile(GL_VERTEX_SHADER, vertexSource);
+	GLuint fragment = compile(GL_FRAGMENT_SHADER, fragmentSource);
+	if (!vertex || !fragment) return 0;
+	GLuint program = glCreateProgram();
+	glAttachShader(program, vertex);
+	glAttachShader(program, fragment);
+	glBindAttribLocation(program, 0, "position");
+	glBindAttribLocation(program, 1, "uv");
+	glLinkProgram(program);
+	GLint ok;
+	glGetProgramiv(program, GL_LINK_STATUS, &ok);
+	return ok ? program : 0;
+}
+
+static EGLDisplay getDisplay() {
+	EGLDisplay d = eglGetDisplay(EGL_DEFAULT_DISPLAY);
+	if (d != EGL_NO_DISPLAY && eglInitialize(d, NULL, NULL)) return d;
+	// Servers usually have no window system to get the default display from
+	d = eglGetPlatformDisplay(EGL_PLATFORM_SURFACELESS, EGL_DEFAULT_DISPLAY, NULL);
+	if (d != EGL_NO_DISPLAY && eglInitialize(d, NULL, NULL)) return d;
+	return EGL_NO_DISPLAY;
+}
+
+static const char* gpu_init() {
+	EGLDisplay d = getDisplay();
+	if (d == EGL_NO_DISPLAY) return "unable to initialize EGL display";
+	if (!eglBindAPI(EGL_OPENGL_ES_API)) return "OpenGL ES not supported";
+	EGLint configAttribs[] = {
+		EGL_SURFACE_TYPE, EGL_PBUFFER_BIT,
+		EGL_RENDERABLE_TYPE, EGL_OPENGL_ES2_BIT,
+		EGL_NONE,
+	};
+	EGLConfig config;
+	EGLint n;
+	if (!eglChooseConfig(d, configAttribs, &config, 1, &n) || n == 0) return "no EGL config";
+	EGLint contextAttribs[] = {EGL_CONTEXT_CLIENT_VERSION, 2, EGL_NONE};
+	EGLContext context = eglCreateContext(d, config, EGL_NO_CONTEXT, contextAttribs);
+	if (context == EGL_NO_CONTEXT) return "unable to create EGL context";
+	// Drawing goes to a framebuffer object, so no surface is needed
+	if (!eglMakeCurrent(d, EGL_NO_SURFACE, EGL_NO_SURFACE, context)) return "unable to make EGL context current";
+
+	rgbaProgram = linkProgram(rgbaSource);
+	ycbcrProgram = linkProgram(ycbcrSource);
+	if (!rgbaProgram || !ycbcrProgram) return "unable to compile shaders";
+	glUseProgram(ycbcrProgram);
+	glUniform1i(glGetUniformLocation(ycbcrProgram, "y"), 0);
+	glUniform1i(glGetUniformLocation(ycbcrProgram, "cb"), 1);
+	glUniform1i(glGetUniformLocation(ycbcrProgram, "cr"), 2);
+
+	glGenTextures(3, textures);
+	glGenTextures(1, &target);
+	for (int i = 0; i < 4; i++) {
+		glBindTexture(GL_TEXTURE_2D, i < 3 ? textures[i] : target);
+		glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_WRAP_S, GL_CLAMP_TO_EDGE);
+		glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_WRAP_T, GL_CLAMP_TO_EDGE);
+		glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_MIN_FILTER, GL_LINEAR);
+		glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_MAG_FILTER, GL_LINEAR);
+	}
+	glGenFramebuffers(1, &framebuffer);
+	glPixelStorei(GL_UNPACK_ALIGNMENT, 1);
+	glPixelStorei(GL_PACK_ALIGNMENT, 1);
+	glGetIntegerv(GL_MAX_TEXTURE_SIZE, &maxSize);
+	return glGetError() == GL_NO_ERROR ? NULL : "unable to set up OpenGL ES";
+}
+
+static int gpu_max_size() {
+	return maxSize;
+}
+
+static void upload(int unit, GLenum format, const void* pixels, int width, int height) {
+	glActiveTexture(GL_TEXTURE0 + unit);
+	glBindTexture(GL_TEXTURE_2D, textures[unit]);
+	glTexImage2D(GL_TEXTURE_2D, 0, format, width, height, 0, format, GL_UNSIGNED_BYTE, pixels);
+}
+
+// drawQuad renders the quad of 4 x, y, u, v vertices into a width x height
+// target and reads it back into out as RGBA
+static int drawQuad(GLuint program, const float* vertices, int width, int height, void* out) {
+	glActiveTexture(GL_TEXTURE3);
+	glBindTexture(GL_TEXTURE_2D, target);
+	glTexImage2D(GL_TEXTURE_2D, 0, GL_RGBA, width, height, 0, GL_RGBA, GL_UNSIGNED_BYTE, NULL);
+	glBindFramebuffer(GL_FRAMEBUFFER, framebuffer);
+	glFramebufferTexture2D(GL_FRAMEBUFFER, GL_COLOR_ATTACHMENT0, GL_TEXTURE_2D, target, 0);
+	if (glCheckFramebufferStatus(GL_FRAMEBUFFER) != GL_FRAMEBUFFER_COMPLETE) return 0;
+	glViewport(0, 0, width, height);
+	glClearColor(0, 0, 0, 0);
+	glClear(GL_COLOR_BUFFER_BIT);
+	glUseProgram(program);
+	glVertexAttribPointer(0, 2, GL_FLOAT, GL_FALSE, 4*sizeof(float), vertices);
+	glVertexAttribPointer(1, 2, GL_FLOAT, GL_FALSE, 4*sizeof(float), vertices+2);
+	glEnableVertexAttribArray(0);
+	glEnableVertexAttribArray(1);
+	glDrawArrays(GL_TRIANGLE_STRIP, 0, 4);
+	glReadPixels(0, 0, width, height, GL_RGBA, GL_UNSIGNED_BYTE, out);
+	return glGetError() == GL_NO_ERROR;
+}
+
+static int gpu_draw_rgba(const void* pixels, int w, int h, const float* vertices, int width, int height, void* out) {
+	upload(0, GL_RGBA, pixels, w, h);
+	return drawQuad(rgbaProgram, vertices, width, height, out);
+}
+
+// uniforms are yMin, yMax, cMin, cMax and cScale, two floats each
+static int gpu_draw_ycbcr(const void* y, int yw, int yh, const void* cb, const void* cr, int cw, int ch, const float* uniforms, const float* vertices, int width, int height, void* out) {
+	upload(0, GL_LUMINANCE, y, yw, yh);
+	upload(1, GL_LUMINANCE, cb, cw, ch);
+	upload(2, GL_LUMINANCE, cr, cw, ch);
+	glUseProgram(ycbcrProgram);
+	glUniform2fv(glGetUniformLocation(ycbcrProgram, "yMin"), 1, uniforms);
+	glUniform2fv(glGetUniformLocation(ycbcrProgram, "yMax"), 1, uniforms+2);
+	glUniform2fv(glGetUniformLocation(ycbcrProgram, "cMin"), 1, uniforms+4);
+	glUniform2fv(glGetUniformLocation(ycbcrProgram, "cMax"), 1, uniforms+6);
+	glUniform2fv(glGetUniformLocation(ycbcrProgram, "cScale"), 1, uniforms+8);
+	return drawQuad(ycbcrProgram, vertices, width, height, out);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	goimage "image"
+	"math"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// GPU reports whether the photos are composited on the GPU
+const GPU = true
+
+// The OpenGL ES context is only current on the thread that created it, so
+// all the drawing is done by one goroutine locked to that thread
+var gpu struct {
+	once    sync.Once
+	jobs    chan func()
+	maxSize int
+	err     error
+}
+
+func startGPU() {
+	gpu.jobs = make(chan func())
+	ready := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		if err := C.gpu_init(); err != nil {
+			ready <- errors.New(C.GoString(err))
+			return
+		}
+		ready <- nil
+		for job := range gpu.jobs {
+			job()
+		}
+	}()
+	gpu.err = <-ready
+	if gpu.err != nil {
+		renderLog.Warn("unable to composite on the GPU, falling back to the CPU", "err", gpu.err)
+		return
+	}
+	gpu.maxSize = int(C.gpu_max_size())
+	renderLog.Info("compositing on the GPU")
+}
+
+// transform draws the bounds of src into dst transformed by aff3
+func transform(dst draw.Image, aff3 f64.Aff3, src goimage.Image, bounds goimage.Rectangle) {
+	if !transformGPU(dst, aff3, src, bounds) {
+		draw.ApproxBiLinear.Transform(dst, aff3, src, bounds, draw.Src, nil)
+	}
+}
+
+// transformGPU draws opaque images into RGBA images on the GPU, it returns
+// false if the image has to be drawn on the CPU instead
+func transformGPU(dst draw.Image, aff3 f64.Aff3, src goimage.Image, bounds goimage.Rectangle) bool {
+	gpu.once.Do(startGPU)
+	rgba, ok := dst.(*goimage.RGBA)
+	if gpu.err != nil || !ok {
+		return false
+	}
+	bounds = bounds.Intersect(src.Bounds())
+	if bounds.Empty() {
+		return true
+	}
+
+	// Corners of the bounds in the order of a triangle strip
+	corners := [4][2]float64{
+		{float64(bounds.Min.X), float64(bounds.Min.Y)},
+		{float64(bounds.Max.X), float64(bounds.Min.Y)},
+		{float64(bounds.Min.X), float64(bounds.Max.Y)},
+		{float64(bounds.Max.X), float64(bounds.Max.Y)},
+	}
+	var points [4][2]float64
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, c := range corners {
+		x := aff3[0]*c[0] + aff3[1]*c[1] + aff3[2]
+		y := aff3[3]*c[0] + aff3[4]*c[1] + aff3[5]
+		points[i] = [2]float64{x, y}
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	if math.IsNaN(minX) || math.IsNaN(minY) || math.IsNaN(maxX) || math.IsNaN(maxY) {
+		return false
+	}
+	r := goimage.Rect(
+		int(math.Floor(math.Max(minX, math.MinInt32))),
+		int(math.Floor(math.Max(minY, math.MinInt32))),
+		int(math.Ceil(math.Min(maxX, math.MaxInt32))),
+		int(math.Ceil(math.Min(maxY, math.MaxInt32))),
+	).Intersect(rgba.Rect)
+	if r.Empty() {
+		return true
+	}
+	width, height := r.Dx(), r.Dy()
+	if width > gpu.maxSize || height > gpu.maxSize {
+		return false
+	}
+
+	// The uv coordinates are set by draw for the texture of the image
+	var vertices [16]C.float
+	for i, p := range points {
+		vertices[i*4+0] = C.float((p[0]-float64(r.Min.X))/float64(width)*2 - 1)
+		vertices[i*4+1] = C.float((p[1]-float64(r.Min.Y))/float64(height)*2 - 1)
+	}
+	out := make([]byte, 4*width*height)
+
+	var drawn bool
+	switch img := src.(type) {
+	case *goimage.YCbCr:
+		drawn = drawYCbCr(img, bounds, &vertices, width, height, out)
+	default:
+		drawn = drawRGBA(src, bounds, &vertices, width, height, out)
+	}
+	if !drawn {
+		return false
+	}
+
+	// Pixels outside of the quad are left transparent and are not copied
+	for y := 0; y < height; y++ {
+		row := out[y*4*width : (y+1)*4*width]
+		offset := rgba.PixOffset(r.Min.X, r.Min.Y+y)
+		for x := 0; x < width; x++ {
+			if row[x*4+3] != 0 {
+				copy(rgba.Pix[offset+x*4:offset+x*4+4], row[x*4:x*4+4])
+			}
+		}
+	}
+	return true
+}
+
+// run runs the job on the thread of the OpenGL ES context
+func run(job func() bool) bool {
+	done := make(chan bool)
+	gpu.jobs <- func() {
+		done <- job()
+	}
+	return <-done
+}
+
+func drawRGBA(src goimage.Image, bounds goimage.Rectangle, vertices *[16]C.float, width, height int, out []byte) bool {
+	if o, ok := src.(interface{ Opaque() bool }); !ok || !o.Opaque() {
+		return false
+	}
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > gpu.maxSize || h > gpu.maxSize {
+		return false
+	}
+	pixels, ok := src.(*goimage.RGBA)
+	if !ok || pixels.Rect != bounds || pixels.Stride != 4*w {
+		pixels = goimage.NewRGBA(goimage.Rect(0, 0, w, h))
+		draw.Draw(pixels, pixels.Rect, src, bounds.Min, draw.Src)
+	}
+	uvs := [4][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}}
+	for i, uv := range uvs {
+		vertices[i*4+2] = C.float(uv[0])
+		vertices[i*4+3] = C.float(uv[1])
+	}
+	return run(func() bool {
+		return C.gpu_draw_rgba(
+			unsafe.Pointer(&pixels.Pix[0]), C.int(w), C.int(h),
+			&vertices[0], C.int(width), C.int(height), unsafe.Pointer(&out[0]),
+		) != 0
+	})
+}
+
+// drawYCbCr uploads the planes as they are and converts them to RGB in the
+// fragment shader, which saves converting the whole image on the CPU
+func drawYCbCr(img *goimage.YCbCr, bounds goimage.Rectangle, vertices *[16]C.float, width, height int, out []byte) bool {
+	var cx, cy int
+	switch img.SubsampleRatio {
+	case goimage.YCbCrSubsampleRatio444:
+		cx, cy = 1, 1
+	case goimage.YCbCrSubsampleRatio422:
+		cx, cy = 2, 1
+	case goimage.YCbCrSubsampleRatio420:
+		cx, cy = 2, 2
+	case goimage.YCbCrSubsampleRatio440:
+		cx, cy = 1, 2
+	case goimage.YCbCrSubsampleRatio411:
+		cx, cy = 4, 1
+	case goimage.YCbCrSubsampleRatio410:
+		cx, cy = 4, 2
+	default:
+		return drawRGBA(img, bounds, vertices, width, height, out)
+	}
+
+	// The planes are uploaded including the padding of the strides
+	yw, yh := img.YStride, img.Rect.Dy()
+	cw := img.CStride
+	ch := (img.Rect.Max.Y+cy-1)/cy - img.Rect.Min.Y/cy
+	if yw > gpu.maxSize || yh > gpu.maxSize || cw > gpu.maxSize || ch > gpu.maxSize ||
+		yw*yh == 0 || cw*ch == 0 ||
+		len(img.Y) < yw*yh || len(img.Cb) < cw*ch || len(img.Cr) < cw*ch {
+		return drawRGBA(img, bounds, vertices, width, height, out)
+	}
+
+	b := bounds.Sub(img.Rect.Min)
+	fyw, fyh := float64(yw), float64(yh)
+	fcw, fch := float64(cw), float64(ch)
+	uvs := [4][2]float64{
+		{float64(b.Min.X) / fyw, float64(b.Min.Y) / fyh},
+		{float64(b.Max.X) / fyw, float64(b.Min.Y) / fyh},
+		{float64(b.Min.X) / fyw, float64(b.Max.Y) / fyh},
+		{float64(b.Max.X) / fyw, float64(b.Max.Y) / fyh},
+	}
+	for i, uv := range uvs {
+		vertices[i*4+2] = C.float(uv[0])
+		vertices[i*4+3] = C.float(uv[1])
+	}
+	c := goimage.Rect(
+		bounds.Min.X/cx-img.Rect.Min.X/cx,
+		bounds.Min.Y/cy-img.Rect.Min.Y/cy,
+		(bounds.Max.X+cx-1)/cx-img.Rect.Min.X/cx,
+		(bounds.Max.Y+cy-1)/cy-img.Rect.Min.Y/cy,
+	)
+	uniforms := [10]C.float{
+		C.float((float64(b.Min.X) + 0.5) / fyw), C.float((float64(b.Min.Y) + 0.5) / fyh),
+		C.float((float64(b.Max.X) - 0.5) / fyw), C.float((float64(b.Max.Y) - 0.5) / fyh),
+		C.float((float64(c.Min.X) + 0.5) / fcw), C.float((float64(c.Min.Y) + 0.5) / fch),
+		C.float((float64(c.Max.X) - 0.5) / fcw), C.float((float64(c.Max.Y) - 0.5) / fch),
+		C.float(fyw / float64(cx) / fcw), C.float(fyh / float64(cy) / fch),
+	}
+	return run(func() bool {
+		return C.gpu_draw_ycbcr(
+			unsafe.Pointer(&img.Y[0]), C.int(yw), C.int(yh),
+			unsafe.Pointer(&img.Cb[0]), unsafe.Pointer(&img.Cr[0]), C.int(cw), C.int(ch),
+			&uniforms[0], &vertices[0], C.int(width), C.int(height), unsafe.Pointer(&out[0]),
+		) != 0
+	})
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	goimage "image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// testImages returns the image types decoded from the thumbnails
+func testImages() map[string]goimage.Image {
+	fill := func(img *goimage.YCbCr) *goimage.YCbCr {
+		for y := 0; y < img.Rect.Dy(); y++ {
+			for x := 0; x < img.Rect.Dx(); x++ {
+				img.Y[img.YOffset(x, y)] = uint8(x * 4)
+				img.Cb[img.COffset(x, y)] = uint8(128 + y)
+				img.Cr[img.COffset(x, y)] = uint8(128 - x)
+			}
+		}
+		return img
+	}
+	ycbcr := fill(goimage.NewYCbCr(goimage.Rect(0, 0, 60, 40), goimage.YCbCrSubsampleRatio420))
+	// Decoded JPEGs have strides padded to whole blocks
+	padded := fill(goimage.NewYCbCr(goimage.Rect(0, 0, 64, 48), goimage.YCbCrSubsampleRatio420).SubImage(goimage.Rect(0, 0, 60, 40)).(*goimage.YCbCr))
+
+	rgba := goimage.NewRGBA(goimage.Rect(0, 0, 60, 40))
+	for y := 0; y < rgba.Rect.Dy(); y++ {
+		for x := 0; x < rgba.Rect.Dx(); x++ {
+			rgba.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 6), 100, 255})
+		}
+	}
+	return map[string]goimage.Image{
+		"ycbcr":        ycbcr,
+		"ycbcr padded": padded,
+		"rgba":         rgba,
+	}
+}
+
+func TestTransform(t *testing.T) {
+	transforms := map[string]f64.Aff3{
+		"identity":  {1, 0, 10, 0, 1, 10},
+		"downscale": {0.5, 0, 3.25, 0, 0.5, 7.5},
+		"upscale":   {2.5, 0, -4, 0, 2.5, 2},
+		"rotate":    {0, -1.5, 70, 1.5, 0, 5},
+		"clipped":   {2, 0, -50, 0, 2, -30},
+	}
+	for name, img := range testImages() {
+		for tname, aff3 := range transforms {
+			t.Run(name+" "+tname, func(t *testing.T) {
+				bounds := img.Bounds()
+				if tname == "identity" {
+					bounds = goimage.Rect(5, 5, 50, 30)
+				}
+				want := goimage.NewRGBA(goimage.Rect(0, 0, 100, 80))
+				draw.ApproxBiLinear.Transform(want, aff3, img, bounds, draw.Src, nil)
+				got := goimage.NewRGBA(want.Rect)
+				transform(got, aff3, img, bounds)
+
+				diff := 0
+				for i := range want.Pix {
+					d := int(want.Pix[i]) - int(got.Pix[i])
+					if d < 0 {
+						d = -d
+					}
+					// The GPU samples and converts colors at a different
+					// precision, so the pixels only have to be close
+					if d > 6 {
+						diff++
+					}
+				}
+				// Pixels on the edges of the quad can be rasterized differently
+				if diff > len(want.Pix)/100 {
+					t.Errorf("%d of %d pixel components differ", diff, len(want.Pix))
+				}
+			})
+		}
+	}
+}
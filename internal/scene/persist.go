@@ -0,0 +1,294 @@
+package scene
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tdewolff/canvas"
+
+	"photofield/internal/image"
+	"photofield/internal/layout"
+	"photofield/internal/render"
+)
+
+// persistVersion is increased whenever the layouts or the format of stored
+// scenes change, so that scenes stored before are laid out again
+const persistVersion = 1
+
+// Points per millimeter, as font sizes are stored in millimeters
+const ptPerMm = 72 / 25.4
+
+type PersistConfig struct {
+	// Store laid out scenes in the data dir, so that they do not have to be
+	// laid out again after a restart
+	Enable bool `json:"enable"`
+	// Scenes with fewer photos are quick to lay out, so they are not stored
+	MinPhotos int `json:"min_photos"`
+	// Maximum number of stored scenes, the least recently used ones are
+	// removed first
+	MaxScenes int `json:"max_scenes"`
+}
+
+type Config struct {
+	Persist PersistConfig `json:"persist"`
+	Update  UpdateConfig  `json:"update"`
+}
+
+type persistedText struct {
+	Rect    render.Rect
+	Text    string
+	Size    float64
+	Style   canvas.FontStyle
+	Variant canvas.FontVariant
+	Color   color.RGBA
+}
+
+type persistedSolid struct {
+	Rect  render.Rect
+	Color color.RGBA
+}
+
+// persistedScene is a laid out scene as stored, valid as long as the
+// latest change of the files of its collection is the revision
+type persistedScene struct {
+	Version  int
+	Revision int64
+	Bounds   render.Rect
+	Photos   []render.Photo
+	Solids   []persistedSolid
+	Texts    []persistedText
+}
+
+type sceneStore struct {
+	dir    string
+	config PersistConfig
+}
+
+// persistKey returns the key of the stored scene laid out with the config,
+// covering everything the layout depends on besides the files themselves
+func persistKey(config SceneConfig) string {
+	c := config.Collection
+	key := struct {
+		Version int
+		Dirs    []string
+		Limit   int
+		Dedup   string
+		Ignore  []string
+		Layout  layout.Layout
+		Hide    []string
+	}{
+		Version: persistVersion,
+		Dirs:    c.Dirs,
+		Limit:   c.Limit,
+		Dedup:   c.Dedup,
+		Ignore:  c.Ignore,
+		Layout:  config.Layout,
+		Hide:    config.Hide,
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:12])
+}
+
+// persistable returns true if scenes laid out with the config can be
+// stored and updated. Search results depend on the AI models and tags,
+// which are not tracked by the revision.
+func persistable(config SceneConfig) bool {
+	return config.Scene.Search == ""
+}
+
+func (store *sceneStore) path(key string) string {
+	return filepath.Join(store.dir, key+".scene")
+}
+
+// load restores the scene stored for the config into the scene, returning
+// false if there is none or it is outdated
+func (store *sceneStore) load(config SceneConfig, revision int64, scene *render.Scene) bool {
+	path := store.path(persistKey(config))
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		renderLog.Warn("scene store unable to open", "path", path, "err", err)
+		return false
+	}
+	defer f.Close()
+
+	var p persistedScene
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&p)
+	if err != nil {
+		renderLog.Warn("scene store unable to decode", "path", path, "err", err)
+		return false
+	}
+	if p.Version != persistVersion || p.Revision != revision {
+		return false
+	}
+
+	scene.Bounds = p.Bounds
+	scene.Photos = p.Photos
+	scene.Solids = make([]render.Solid, len(p.Solids))
+	for i, s := range p.Solids {
+		scene.Solids[i] = render.NewSolidFromRect(s.Rect, s.Color)
+	}
+	scene.Texts = make([]render.Text, len(p.Texts))
+	faces := make(map[persistedText]*canvas.FontFace)
+	for i, t := range p.Texts {
+		face := persistedText{Size: t.Size, Style: t.Style, Variant: t.Variant, Color: t.Color}
+		font, ok := faces[face]
+		if !ok {
+			f := scene.Fonts.Main.Face(t.Size*ptPerMm, t.Color, t.Style, t.Variant)
+			font = &f
+			faces[face] = font
+		}
+		scene.Texts[i] = render.NewTextFromRect(t.Rect, font, t.Text)
+	}
+
+	// Marked as recently used
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return true
+}
+
+// save stores the scene laid out with the config at the revision
+func (store *sceneStore) save(config SceneConfig, revision int64, scene *render.Scene) error {
+	p := persistedScene{
+		Version:  persistVersion,
+		Revision: revision,
+		Bounds:   scene.Bounds,
+		Photos:   scene.Photos,
+		Solids:   make([]persistedSolid, len(scene.Solids)),
+		Texts:    make([]persistedText, len(scene.Texts)),
+	}
+	for i, s := range scene.Solids {
+		p.Solids[i] = persistedSolid{
+			Rect:  s.Sprite.Rect,
+			Color: color.RGBAModel.Convert(s.Color).(color.RGBA),
+		}
+	}
+	for i, t := range scene.Texts {
+		p.Texts[i] = persistedText{
+			Rect: t.Sprite.Rect,
+			Text: t.Text,
+		}
+		if t.Font != nil {
+			p.Texts[i].Size = t.Font.Size
+			p.Texts[i].Style = t.Font.Style
+			p.Texts[i].Variant = t.Font.Variant
+			p.Texts[i].Color = t.Font.Color
+		}
+	}
+
+	if err := os.MkdirAll(store.dir, 0755); err != nil {
+		return err
+	}
+	path := store.path(persistKey(config))
+	// Per process, as instances can share the data dir
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = gob.NewEncoder(w).Encode(&p)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	store.prune()
+	return nil
+}
+
+// prune removes the least recently used stored scenes over the maximum
+func (store *sceneStore) prune() {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return
+	}
+	type stored struct {
+		path    string
+		modTime time.Time
+	}
+	var scenes []stored
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".scene") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		scenes = append(scenes, stored{
+			path:    filepath.Join(store.dir, e.Name()),
+			modTime: info.ModTime(),
+		})
+	}
+	if len(scenes) <= store.config.MaxScenes {
+		return
+	}
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].modTime.After(scenes[j].modTime)
+	})
+	for _, s := range scenes[store.config.MaxScenes:] {
+		os.Remove(s.path)
+	}
+}
+
+// Persist stores laid out scenes in the dir according to the config and
+// restores them instead of laying them out again while the files of their
+// collection are unchanged
+func (source *SceneSource) Persist(dir string, config PersistConfig) {
+	if !config.Enable {
+		return
+	}
+	if config.MaxScenes <= 0 {
+		config.MaxScenes = 16
+	}
+	source.store = &sceneStore{
+		dir:    dir,
+		config: config,
+	}
+}
+
+// revision returns the revision of the files of the collection of the
+// config, or false if scenes with the config are neither stored nor updated
+func (source *SceneSource) revision(config SceneConfig, imageSource *image.Source) (int64, bool) {
+	if (source.store == nil && !source.update.Enable) || !persistable(config) {
+		return 0, false
+	}
+	dirs := append([]string(nil), config.Collection.Dirs...)
+	return imageSource.LatestChange(dirs), true
+}
+
+// save stores the scene if it is large enough to be worth storing
+func (source *SceneSource) save(config SceneConfig, scene *render.Scene) {
+	if source.store == nil || len(scene.Photos) < source.store.config.MinPhotos {
+		return
+	}
+	if err := source.store.save(config, scene.Revision, scene); err != nil {
+		renderLog.Error("scene store unable to save", "collection", config.Collection.Id, "err", err)
+	}
+}
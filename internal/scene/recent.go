@@ -0,0 +1,269 @@
+package scene
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"photofield/internal/collection"
+	"photofield/internal/image"
+	"photofield/internal/layout"
+	"photofield/internal/metrics"
+	"photofield/internal/render"
+)
+
+const (
+	recentMaxScenes = 8
+	recentMaxViews  = 64
+	// Views waiting to be recorded, views are dropped if it is full
+	recentViewQueue = 256
+	warmUpMaxPhotos = 500
+)
+
+// RecentScene is a record of a recently viewed scene, kept across restarts
+// so that the scene and its most recently viewed photos can be loaded ahead
+// of the first request
+type RecentScene struct {
+	CollectionId   string        `json:"collection_id"`
+	LayoutType     layout.Type   `json:"layout_type"`
+	Order          layout.Order  `json:"order"`
+	ViewportWidth  float64       `json:"viewport_width"`
+	ViewportHeight float64       `json:"viewport_height"`
+	ImageHeight    float64       `json:"image_height"`
+	Search         string        `json:"search,omitempty"`
+	ViewedAt       time.Time     `json:"viewed_at"`
+	Views          []render.Rect `json:"views"`
+}
+
+func newRecentScene(config SceneConfig) RecentScene {
+	return RecentScene{
+		CollectionId:   config.Collection.Id,
+		LayoutType:     config.Layout.Type,
+		Order:          config.Layout.Order,
+		ViewportWidth:  config.Layout.ViewportWidth,
+		ViewportHeight: config.Layout.ViewportHeight,
+		ImageHeight:    config.Layout.ImageHeight,
+		Search:         config.Scene.Search,
+	}
+}
+
+func (r *RecentScene) sameScene(o *RecentScene) bool {
+	return r.CollectionId == o.CollectionId &&
+		r.LayoutType == o.LayoutType &&
+		r.Order == o.Order &&
+		r.ViewportWidth == o.ViewportWidth &&
+		r.ViewportHeight == o.ViewportHeight &&
+		r.ImageHeight == o.ImageHeight &&
+		r.Search == o.Search
+}
+
+func (r *RecentScene) apply(config SceneConfig) SceneConfig {
+	config.Layout.Type = r.LayoutType
+	config.Layout.Order = r.Order
+	config.Layout.ViewportWidth = r.ViewportWidth
+	config.Layout.ViewportHeight = r.ViewportHeight
+	config.Layout.ImageHeight = r.ImageHeight
+	config.Scene.Search = r.Search
+	return config
+}
+
+type recentScenes struct {
+	path   string
+	mutex  sync.Mutex
+	scenes []RecentScene
+	dirty  bool
+	views  chan recentView
+}
+
+type recentView struct {
+	id   string
+	view render.Rect
+}
+
+func loadRecentScenes(path string) *recentScenes {
+	r := &recentScenes{
+		path:  path,
+		views: make(chan recentView, recentViewQueue),
+	}
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r
+	}
+	if err != nil {
+		renderLog.Warn("recent scenes unable to read", "path", path, "err", err)
+		return r
+	}
+	err = json.Unmarshal(bytes, &r.scenes)
+	if err != nil {
+		renderLog.Warn("recent scenes unable to parse", "path", path, "err", err)
+		r.scenes = nil
+	}
+	return r
+}
+
+func (r *recentScenes) list() []RecentScene {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	scenes := make([]RecentScene, len(r.scenes))
+	copy(scenes, r.scenes)
+	return scenes
+}
+
+// touch moves the scene with the provided config to the front of the
+// recent scenes, also recording the view if provided
+func (r *recentScenes) touch(config SceneConfig, view *render.Rect) {
+	recent := newRecentScene(config)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	index := -1
+	for i := range r.scenes {
+		if r.scenes[i].sameScene(&recent) {
+			index = i
+			break
+		}
+	}
+	if index == 0 && view != nil && len(r.scenes[0].Views) > 0 && r.scenes[0].Views[0] == *view {
+		// Most tiles of a view are requested for the same area
+		r.scenes[0].ViewedAt = time.Now()
+		r.dirty = true
+		return
+	}
+	if index == -1 {
+		r.scenes = append(r.scenes, RecentScene{})
+		index = len(r.scenes) - 1
+	} else {
+		recent.Views = r.scenes[index].Views
+	}
+	copy(r.scenes[1:index+1], r.scenes[:index])
+
+	if view != nil {
+		views := make([]render.Rect, 0, recentMaxViews)
+		views = append(views, *view)
+		for _, v := range recent.Views {
+			if len(views) >= recentMaxViews {
+				break
+			}
+			if v != *view {
+				views = append(views, v)
+			}
+		}
+		recent.Views = views
+	}
+	recent.ViewedAt = time.Now()
+	r.scenes[0] = recent
+
+	if len(r.scenes) > recentMaxScenes {
+		r.scenes = r.scenes[:recentMaxScenes]
+	}
+	r.dirty = true
+}
+
+func (r *recentScenes) save() error {
+	r.mutex.Lock()
+	if !r.dirty {
+		r.mutex.Unlock()
+		return nil
+	}
+	bytes, err := json.Marshal(r.scenes)
+	r.dirty = false
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Per process, as instances can share the data dir
+	tmp := fmt.Sprintf("%s.%d.tmp", r.path, os.Getpid())
+	err = os.WriteFile(tmp, bytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *recentScenes) saveEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := r.save()
+		if err != nil {
+			renderLog.Warn("recent scenes unable to save", "path", r.path, "err", err)
+		}
+	}
+}
+
+// PersistRecent keeps a record of the recently viewed scenes in the file at
+// path and returns the scenes recorded during the previous session
+func (source *SceneSource) PersistRecent(path string) []RecentScene {
+	source.recent = loadRecentScenes(path)
+	go source.recent.saveEvery(10 * time.Second)
+	go source.recordRecentViews()
+	return source.recent.list()
+}
+
+// AddRecentView records that the provided area of the scene was viewed.
+// It is called for every tile, so the view is only queued and dropped if
+// recording falls behind, as missing some views is harmless.
+func (source *SceneSource) AddRecentView(id string, view render.Rect) {
+	if source.recent == nil {
+		return
+	}
+	select {
+	case source.recent.views <- recentView{id: id, view: view}:
+	default:
+	}
+}
+
+func (source *SceneSource) recordRecentViews() {
+	for v := range source.recent.views {
+		stored, ok := source.scenes.Load(v.id)
+		if !ok {
+			continue
+		}
+		source.recent.touch(stored.(storedScene).config, &v.view)
+	}
+}
+
+// WarmUp loads the provided recent scenes and the photos in their most
+// recently viewed areas, so that the first requests after a restart can
+// be served from the caches
+func (source *SceneSource) WarmUp(recent []RecentScene, getCollection func(id string) *collection.Collection, defaults SceneConfig, imageSource *image.Source) {
+	defer metrics.Elapsed("scene warm up")()
+
+	// Add the least recent first to retain the order of the recent scenes
+	for i := len(recent) - 1; i >= 0; i-- {
+		r := &recent[i]
+		c := getCollection(r.CollectionId)
+		if c == nil {
+			continue
+		}
+		config := defaults
+		config.Collection = *c
+		config = r.apply(config)
+
+		scene, loaded := source.add(config, imageSource)
+		<-loaded
+
+		ids := make(map[image.ImageId]struct{})
+		for _, view := range r.Views {
+			remaining := warmUpMaxPhotos - len(ids)
+			if remaining <= 0 {
+				break
+			}
+			for ref := range scene.GetVisiblePhotoRefs(view, remaining) {
+				if _, ok := ids[ref.Photo.Id]; ok {
+					continue
+				}
+				ids[ref.Photo.Id] = struct{}{}
+				err := imageSource.Prefetch(context.Background(), ref.Photo.Id, image.Size{X: 256, Y: 256})
+				if err != nil {
+					renderLog.Warn("scene warm up unable to load", "id", ref.Photo.Id, "err", err)
+				}
+			}
+		}
+		renderLog.Info("scene warm up", "collection", c.Id, "photos", len(ids))
+	}
+}
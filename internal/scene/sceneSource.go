@@ -2,7 +2,8 @@ package scene
 
 import (
 	"fmt"
-	"log"
+	"photofield/internal/logging"
+	"slices"
 	"sync"
 	"time"
 	"unsafe"
@@ -10,6 +11,7 @@ import (
 	"github.com/dgraph-io/ristretto"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 
+	"photofield/internal/clip"
 	"photofield/internal/collection"
 	"photofield/internal/image"
 	"photofield/internal/layout"
@@ -18,12 +20,18 @@ import (
 	"photofield/search"
 )
 
+var renderLog = logging.Module("render")
+
 type SceneSource struct {
 	DefaultScene render.Scene
 
 	maxSize    int64
 	sceneCache *ristretto.Cache
 	scenes     sync.Map
+	recent     *recentScenes
+	store      *sceneStore
+	update     UpdateConfig
+	built      []func(scene *render.Scene)
 }
 
 type loadingScene struct {
@@ -34,6 +42,8 @@ type loadingScene struct {
 type storedScene struct {
 	scene  *render.Scene
 	config SceneConfig
+	// Outdated, only returned by id to clients already viewing it
+	stale bool
 }
 
 type SceneConfig struct {
@@ -41,6 +51,8 @@ type SceneConfig struct {
 	Collection collection.Collection
 	Layout     layout.Layout
 	Scene      render.Scene
+	// Tags of the files left out of the scene, e.g. private ones
+	Hide []string
 }
 
 func NewSceneSource() *SceneSource {
@@ -69,15 +81,36 @@ func getSceneCost(scene *render.Scene) int64 {
 	return structCost + photosCost + solidsCost + textsCost
 }
 
-func (source *SceneSource) loadScene(config SceneConfig, imageSource *image.Source) *render.Scene {
+// embedSearch embeds the text of the search, combining the embeddings of
+// its prompts if it weighs or excludes any of them
+func embedSearch(c clip.Clip, text string, q *search.Query) (clip.Embedding, error) {
+	prompts := q.Prompts()
+	if len(prompts) == 0 || len(prompts) == 1 && prompts[0].Weight == 1 {
+		return c.EmbedText(text)
+	}
+	embeddings := make([]clip.Embedding, len(prompts))
+	weights := make([]float32, len(prompts))
+	for i, p := range prompts {
+		embedding, err := c.EmbedText(p.Text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+		weights[i] = p.Weight
+	}
+	return clip.Combine(embeddings, weights)
+}
+
+func (source *SceneSource) loadScene(config SceneConfig, imageSource *image.Source) (*render.Scene, <-chan struct{}) {
 
-	log.Printf("scene loading %v", config.Collection.Id)
+	renderLog.Info("scene loading", "id", config.Collection.Id)
 
 	scene := source.DefaultScene
 	scene.CreatedAt = time.Now()
 	scene.Loading = true
 	scene.Search = config.Scene.Search
 
+	loaded := make(chan struct{})
 	go func() {
 		finished := metrics.Elapsed("scene load " + config.Collection.Id)
 
@@ -90,20 +123,20 @@ func (source *SceneSource) loadScene(config SceneConfig, imageSource *image.Sour
 				if similar, err := q.QualifierInt("img"); err == nil {
 					embedding, err := imageSource.GetImageEmbedding(image.ImageId(similar))
 					if err != nil {
-						log.Println("search get similar failed")
+						renderLog.Error("search get similar failed")
 						scene.Error = fmt.Sprintf("Search failed: %s", err.Error())
 					}
 					scene.SearchEmbedding = embedding
-				} else if len(q.QualifierValues("tag")) > 0 {
+				} else if len(q.QualifierValues("tag")) > 0 || len(q.QualifierValues("duration")) > 0 || len(q.QualifierValues("caption")) > 0 || len(q.QualifierValues("trip")) > 0 {
 					query = q
 				}
 			}
 
 			// Fallback
 			if scene.SearchEmbedding == nil && scene.Error == "" && query == nil {
-				embedding, err := imageSource.Clip.EmbedText(scene.Search)
+				embedding, err := embedSearch(imageSource.Clip, scene.Search, q)
 				if err != nil {
-					log.Println("search embed failed")
+					renderLog.Error("search embed failed")
 					scene.Error = fmt.Sprintf("Search failed: %s", err.Error())
 				}
 				scene.SearchEmbedding = embedding
@@ -111,41 +144,16 @@ func (source *SceneSource) loadScene(config SceneConfig, imageSource *image.Sour
 			searchDone()
 		}
 
-		if scene.SearchEmbedding != nil {
-			// Similarity order
-			infos := config.Collection.GetSimilar(imageSource, scene.SearchEmbedding, image.ListOptions{
-				Limit: config.Collection.Limit,
-			})
-
-			switch config.Layout.Type {
-			case layout.Strip:
-				sinfos := image.SimilarityInfosToSourcedInfos(infos)
-				layout.LayoutStrip(sinfos, config.Layout, &scene, imageSource)
-			default:
-				layout.LayoutSearch(infos, config.Layout, &scene, imageSource)
-			}
+		revision, tracked := source.revision(config, imageSource)
+		restored := tracked && source.store != nil && source.store.load(config, revision, &scene)
+		if restored {
+			renderLog.Info("scene restored", "id", config.Collection.Id)
 		} else {
-			// Normal order
-			infos := config.Collection.GetInfos(imageSource, image.ListOptions{
-				OrderBy: image.ListOrder(config.Layout.Order),
-				Limit:   config.Collection.Limit,
-				Query:   query,
-			})
-			switch config.Layout.Type {
-			case layout.Timeline:
-				layout.LayoutTimeline(infos, config.Layout, &scene, imageSource)
-			case layout.Album:
-				layout.LayoutAlbum(infos, config.Layout, &scene, imageSource)
-			case layout.Square:
-				layout.LayoutSquare(&scene, imageSource)
-			case layout.Wall:
-				layout.LayoutWall(infos, config.Layout, &scene, imageSource)
-			case layout.Strip:
-				layout.LayoutStrip(infos, config.Layout, &scene, imageSource)
-			default:
-				layout.LayoutAlbum(infos, config.Layout, &scene, imageSource)
-			}
+			built := metrics.ObserveSceneBuild(string(config.Layout.Type))
+			source.layoutScene(config, query, &scene, imageSource)
+			built()
 		}
+		scene.Revision = revision
 
 		if scene.RegionSource == nil {
 			scene.RegionSource = &layout.PhotoRegionSource{
@@ -154,11 +162,85 @@ func (source *SceneSource) loadScene(config SceneConfig, imageSource *image.Sour
 		}
 		scene.FileCount = len(scene.Photos)
 		scene.Loading = false
+		close(loaded)
 		finished()
-		log.Printf("photos %d, scene %.0f x %.0f\n", len(scene.Photos), scene.Bounds.W, scene.Bounds.H)
+		renderLog.Info("scene built", "photos", len(scene.Photos), "w", scene.Bounds.W, "h", scene.Bounds.H)
+
+		if tracked && !restored {
+			source.save(config, &scene)
+		}
+		source.notifyBuilt(&scene)
 	}()
 
-	return &scene
+	return &scene, loaded
+}
+
+// OnBuilt calls the function whenever a scene finished loading or was
+// updated with changed files, e.g. to prepare its tiles
+func (source *SceneSource) OnBuilt(fn func(scene *render.Scene)) {
+	source.built = append(source.built, fn)
+}
+
+func (source *SceneSource) notifyBuilt(scene *render.Scene) {
+	if scene.Error != "" {
+		return
+	}
+	for _, fn := range source.built {
+		fn(scene)
+	}
+}
+
+// layoutScene lays out the photos of the collection of the config in the
+// scene, in order of similarity to the search embedding of the scene if it
+// has one
+func (source *SceneSource) layoutScene(config SceneConfig, query *search.Query, scene *render.Scene, imageSource *image.Source) {
+	if config.Layout.Type == layout.Timeline || config.Layout.Type == layout.Highlights {
+		// Kinds of files like screenshots that are not worth reminiscing
+		config.Hide = append(append([]string(nil), config.Hide...), imageSource.Kinds.Hide...)
+	}
+	if scene.SearchEmbedding != nil {
+		// Similarity order
+		infos := config.Collection.GetSimilar(imageSource, scene.SearchEmbedding, image.ListOptions{
+			Limit: config.Collection.Limit,
+			Hide:  config.Hide,
+		})
+
+		switch config.Layout.Type {
+		case layout.Strip:
+			sinfos := image.SimilarityInfosToSourcedInfos(infos)
+			layout.LayoutStrip(sinfos, config.Layout, scene, imageSource)
+		default:
+			layout.LayoutSearch(infos, config.Layout, scene, imageSource)
+		}
+	} else {
+		// Normal order
+		infos := config.Collection.GetInfos(imageSource, image.ListOptions{
+			OrderBy: image.ListOrder(config.Layout.Order),
+			Limit:   config.Collection.Limit,
+			Query:   query,
+			Hide:    config.Hide,
+		})
+		switch config.Layout.Type {
+		case layout.Timeline:
+			layout.LayoutTimeline(infos, config.Layout, scene, imageSource)
+		case layout.Album:
+			layout.LayoutAlbum(infos, config.Layout, scene, imageSource)
+		case layout.Square:
+			layout.LayoutSquare(scene, imageSource)
+		case layout.Wall:
+			layout.LayoutWall(infos, config.Layout, scene, imageSource)
+		case layout.Strip:
+			layout.LayoutStrip(infos, config.Layout, scene, imageSource)
+		case layout.Map:
+			layout.LayoutMap(infos, config.Layout, scene, imageSource)
+		case layout.Calendar:
+			layout.LayoutCalendar(infos, config.Layout, scene, imageSource)
+		case layout.Highlights:
+			layout.LayoutHighlights(infos, config.Layout, scene, imageSource)
+		default:
+			layout.LayoutAlbum(infos, config.Layout, scene, imageSource)
+		}
+	}
 }
 
 func (source *SceneSource) getOldestScene() (totalSize int64, oldestScene *render.Scene) {
@@ -175,7 +257,7 @@ func (source *SceneSource) getOldestScene() (totalSize int64, oldestScene *rende
 }
 
 func (source *SceneSource) deleteScene(id string) {
-	log.Printf("scene delete %v", id)
+	renderLog.Info("scene delete", "id", id)
 	source.scenes.Delete(id)
 	source.sceneCache.Del(id)
 }
@@ -259,6 +341,23 @@ func sceneConfigEqual(a SceneConfig, b SceneConfig) bool {
 		return false
 	}
 
+	if (a.Layout.Spacing == nil) != (b.Layout.Spacing == nil) ||
+		(a.Layout.Spacing != nil && *a.Layout.Spacing != *b.Layout.Spacing) {
+		return false
+	}
+
+	if a.Layout.MaxRowSlop != b.Layout.MaxRowSlop {
+		return false
+	}
+
+	if a.Layout.Panorama != b.Layout.Panorama {
+		return false
+	}
+
+	if !slices.Equal(a.Hide, b.Hide) {
+		return false
+	}
+
 	return true
 }
 
@@ -266,7 +365,7 @@ func (source *SceneSource) GetScenesWithConfig(config SceneConfig) []*render.Sce
 	scenes := make([]*render.Scene, 0)
 	source.scenes.Range(func(_, value interface{}) bool {
 		stored := value.(storedScene)
-		if sceneConfigEqual(stored.config, config) {
+		if !stored.stale && sceneConfigEqual(stored.config, config) {
 			scenes = append(scenes, stored.scene)
 		}
 		return true
@@ -274,7 +373,32 @@ func (source *SceneSource) GetScenesWithConfig(config SceneConfig) []*render.Sce
 	return scenes
 }
 
+// Invalidate marks the scenes with any of the layouts as outdated, so that
+// they are laid out again when requested next, e.g. after the locations the
+// timeline and map layouts depend on were edited
+func (source *SceneSource) Invalidate(types ...layout.Type) {
+	source.scenes.Range(func(key, value interface{}) bool {
+		stored := value.(storedScene)
+		for _, t := range types {
+			if stored.config.Layout.Type == t && !stored.stale {
+				stored.stale = true
+				source.scenes.Store(key, stored)
+				renderLog.Info("scene invalidate", "id", stored.scene.Id)
+				break
+			}
+		}
+		return true
+	})
+}
+
 func (source *SceneSource) Add(config SceneConfig, imageSource *image.Source) *render.Scene {
+	scene, _ := source.add(config, imageSource)
+	return scene
+}
+
+// add adds the scene like Add, also returning a channel closed once it
+// finished loading
+func (source *SceneSource) add(config SceneConfig, imageSource *image.Source) (*render.Scene, <-chan struct{}) {
 
 	id := config.Scene.Id
 	if id == "" {
@@ -287,12 +411,16 @@ func (source *SceneSource) Add(config SceneConfig, imageSource *image.Source) *r
 
 	source.pruneScenes()
 
-	scene := source.loadScene(config, imageSource)
+	scene, loaded := source.loadScene(config, imageSource)
 	scene.Id = id
 
 	source.scenes.Store(scene.Id, storedScene{
 		scene:  scene,
 		config: config,
 	})
-	return scene
+
+	if source.recent != nil {
+		source.recent.touch(config, nil)
+	}
+	return scene, loaded
 }
@@ -0,0 +1,47 @@
+package scene
+
+import (
+	"testing"
+
+	"photofield/internal/layout"
+	"photofield/internal/render"
+)
+
+func TestInvalidate(t *testing.T) {
+	source := NewSceneSource()
+	for _, c := range []struct {
+		id string
+		t  layout.Type
+	}{
+		{"timeline", layout.Timeline},
+		{"map", layout.Map},
+		{"album", layout.Album},
+	} {
+		config := SceneConfig{}
+		config.Layout.Type = c.t
+		source.scenes.Store(c.id, storedScene{
+			scene:  &render.Scene{Id: c.id},
+			config: config,
+		})
+	}
+
+	source.Invalidate(layout.Timeline, layout.Map)
+
+	for _, c := range []struct {
+		t     layout.Type
+		count int
+	}{
+		{layout.Timeline, 0},
+		{layout.Map, 0},
+		{layout.Album, 1},
+	} {
+		config := SceneConfig{}
+		config.Layout.Type = c.t
+		if scenes := source.GetScenesWithConfig(config); len(scenes) != c.count {
+			t.Errorf("%s: expected %d scenes, got %d", c.t, c.count, len(scenes))
+		}
+	}
+	if source.GetSceneById("map", nil) == nil {
+		t.Error("expected invalidated scene to still be found by id")
+	}
+}
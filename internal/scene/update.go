@@ -0,0 +1,162 @@
+package scene
+
+import (
+	"math"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/internal/metrics"
+	"photofield/internal/render"
+)
+
+type UpdateConfig struct {
+	// Update scenes in place as files in their collections are added,
+	// changed or removed, keeping their ids, instead of only showing the
+	// changes in new scenes
+	Enable bool `json:"enable"`
+	// Wait this long after a file was indexed for more files before updating
+	DelayMs int `json:"delay_ms"`
+	// Check for changes periodically, as removed files are not published
+	// as events
+	IntervalSeconds int `json:"interval_seconds"`
+}
+
+// Watch updates the scenes as the files of their collections change
+func (source *SceneSource) Watch(config UpdateConfig, imageSource *image.Source) {
+	if !config.Enable {
+		return
+	}
+	if config.DelayMs <= 0 {
+		config.DelayMs = 2000
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 60
+	}
+	source.update = config
+
+	changed := make(chan struct{}, 1)
+	imageSource.Subscribe(func(e image.Event) {
+		if e.Type != image.EventFileIndexed && e.Type != image.EventMetadataIndexed {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-changed:
+				time.Sleep(time.Duration(config.DelayMs) * time.Millisecond)
+				// Files indexed in the meantime are covered by this update
+				select {
+				case <-changed:
+				default:
+				}
+			case <-ticker.C:
+			}
+			source.Update(imageSource)
+		}
+	}()
+}
+
+// Update lays out the scenes with files that changed since they were laid
+// out again and applies the changes to them in place
+func (source *SceneSource) Update(imageSource *image.Source) {
+	source.scenes.Range(func(_, value interface{}) bool {
+		source.updateScene(value.(storedScene), imageSource)
+		return true
+	})
+}
+
+func (source *SceneSource) updateScene(stored storedScene, imageSource *image.Source) {
+	scene := stored.scene
+	if scene.Loading || scene.Error != "" {
+		return
+	}
+	revision, ok := source.revision(stored.config, imageSource)
+	if !ok || revision == scene.Revision {
+		return
+	}
+
+	finished := metrics.Elapsed("scene update " + stored.config.Collection.Id)
+	next := source.DefaultScene
+	source.layoutScene(stored.config, nil, &next, imageSource)
+	changed := applyUpdate(scene, &next)
+	scene.Revision = revision
+	finished()
+
+	if changed == nil {
+		renderLog.Info("scene update unchanged", "scene", scene.Id)
+		return
+	}
+	renderLog.Info("scene update", "scene", scene.Id, "photos", len(scene.Photos), "changed_from", math.Round(changed.Y))
+	source.save(stored.config, scene)
+	source.notifyBuilt(scene)
+}
+
+// applyUpdate applies the next layout of the scene from the first photo,
+// solid or text that differs onwards, so that the rows before stay as they
+// are for clients viewing them. The photos before are kept in a new slice,
+// as tiles may still be drawn from the previous one. It returns the area
+// of the scene that changed, or nil if the layouts are the same.
+func applyUpdate(scene *render.Scene, next *render.Scene) *render.Rect {
+	bottom := math.Max(scene.Bounds.H, next.Bounds.H)
+	top := bottom
+
+	photos := 0
+	for photos < len(scene.Photos) && photos < len(next.Photos) && scene.Photos[photos] == next.Photos[photos] {
+		photos++
+	}
+	if photos < len(scene.Photos) {
+		top = math.Min(top, scene.Photos[photos].Sprite.Rect.Y)
+	}
+	if photos < len(next.Photos) {
+		top = math.Min(top, next.Photos[photos].Sprite.Rect.Y)
+	}
+
+	solids := 0
+	for solids < len(scene.Solids) && solids < len(next.Solids) && scene.Solids[solids] == next.Solids[solids] {
+		solids++
+	}
+	if solids < len(scene.Solids) {
+		top = math.Min(top, scene.Solids[solids].Sprite.Rect.Y)
+	}
+	if solids < len(next.Solids) {
+		top = math.Min(top, next.Solids[solids].Sprite.Rect.Y)
+	}
+
+	texts := 0
+	for texts < len(scene.Texts) && texts < len(next.Texts) &&
+		scene.Texts[texts].Sprite == next.Texts[texts].Sprite &&
+		scene.Texts[texts].Text == next.Texts[texts].Text {
+		texts++
+	}
+	if texts < len(scene.Texts) {
+		top = math.Min(top, scene.Texts[texts].Sprite.Rect.Y)
+	}
+	if texts < len(next.Texts) {
+		top = math.Min(top, next.Texts[texts].Sprite.Rect.Y)
+	}
+
+	if top == bottom && scene.Bounds == next.Bounds {
+		return nil
+	}
+
+	scene.Photos = append(scene.Photos[:photos:photos], next.Photos[photos:]...)
+	scene.Solids = append(scene.Solids[:solids:solids], next.Solids[solids:]...)
+	scene.Texts = append(scene.Texts[:texts:texts], next.Texts[texts:]...)
+	scene.Bounds = next.Bounds
+	scene.FileCount = len(scene.Photos)
+	scene.Changed = &render.Rect{
+		X: 0,
+		Y: top,
+		W: scene.Bounds.W,
+		H: bottom - top,
+	}
+	return scene.Changed
+}
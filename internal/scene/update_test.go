@@ -0,0 +1,57 @@
+package scene
+
+import (
+	"testing"
+
+	"photofield/internal/image"
+	"photofield/internal/render"
+)
+
+func row(y float64, ids ...image.ImageId) []render.Photo {
+	photos := make([]render.Photo, len(ids))
+	for i, id := range ids {
+		photos[i].Id = id
+		photos[i].Sprite.Rect = render.Rect{X: float64(i) * 10, Y: y, W: 10, H: 10}
+	}
+	return photos
+}
+
+func TestApplyUpdate(t *testing.T) {
+	scene := render.Scene{
+		Bounds: render.Rect{W: 30, H: 20},
+		Photos: append(row(0, 1, 2, 3), row(10, 4)...),
+	}
+	first := scene.Photos[:3]
+
+	same := render.Scene{
+		Bounds: scene.Bounds,
+		Photos: append(row(0, 1, 2, 3), row(10, 4)...),
+	}
+	if changed := applyUpdate(&scene, &same); changed != nil {
+		t.Errorf("expected no change, got %v", changed)
+	}
+
+	next := render.Scene{
+		Bounds: render.Rect{W: 30, H: 30},
+		Photos: append(append(row(0, 1, 2, 3), row(10, 4, 5, 6)...), row(20, 7)...),
+	}
+	changed := applyUpdate(&scene, &next)
+	if changed == nil {
+		t.Fatal("expected a change")
+	}
+	expected := render.Rect{X: 0, Y: 10, W: 30, H: 20}
+	if *changed != expected {
+		t.Errorf("expected %v changed, got %v", expected, *changed)
+	}
+	if len(scene.Photos) != 7 || scene.FileCount != 7 || scene.Bounds.H != 30 {
+		t.Errorf("expected the next layout, got %d photos in %v", len(scene.Photos), scene.Bounds)
+	}
+	for i := range first {
+		if first[i] != scene.Photos[i] {
+			t.Errorf("expected photo %d to stay, got %v", i, scene.Photos[i])
+		}
+	}
+	if &first[0] == &scene.Photos[0] {
+		t.Error("expected the photos in a new slice")
+	}
+}
@@ -0,0 +1,270 @@
+// Package sheet renders photos into contact sheets for printing and
+// archiving, either as a paginated PDF or as a JPEG of a single page.
+package sheet
+
+import (
+	"context"
+	"fmt"
+	goimage "image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"runtime"
+
+	"photofield/internal/image"
+	"photofield/internal/layout"
+	"photofield/internal/logging"
+	"photofield/internal/render"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/rasterizer"
+)
+
+var renderLog = logging.Module("render")
+
+// Paper sizes in millimeters
+var papers = map[string][2]float64{
+	"a3":     {297, 420},
+	"a4":     {210, 297},
+	"a5":     {148, 210},
+	"letter": {215.9, 279.4},
+	"legal":  {215.9, 355.6},
+}
+
+const (
+	PDF  = "pdf"
+	JPEG = "jpeg"
+)
+
+type Options struct {
+	Title string
+	// Paper size, a3, a4, a5, letter or legal
+	Paper     string
+	Landscape bool
+	Columns   int
+	Rows      int
+	// Resolution of the photos, in dots per inch
+	DPI      int
+	Captions bool
+}
+
+const maxCells = 20
+
+func (options *Options) Validate() error {
+	if _, ok := papers[options.paper()]; !ok {
+		return fmt.Errorf("unsupported paper %s, use a3, a4, a5, letter or legal", options.Paper)
+	}
+	if options.Columns < 0 || options.Columns > maxCells || options.Rows < 0 || options.Rows > maxCells {
+		return fmt.Errorf("columns and rows must be between 1 and %d", maxCells)
+	}
+	if options.DPI < 0 || options.DPI > 600 {
+		return fmt.Errorf("dpi must be between 1 and 600")
+	}
+	return nil
+}
+
+func (options Options) paper() string {
+	if options.Paper == "" {
+		return "a4"
+	}
+	return options.Paper
+}
+
+func (options Options) withDefaults() Options {
+	if options.Title == "" {
+		options.Title = "Photos"
+	}
+	if options.Columns == 0 {
+		options.Columns = 4
+	}
+	if options.Rows == 0 {
+		options.Rows = 5
+	}
+	if options.DPI == 0 {
+		options.DPI = 150
+	}
+	return options
+}
+
+// dpmm returns the resolution in dots per millimeter
+func (options Options) dpmm() float64 {
+	return float64(options.DPI) / 25.4
+}
+
+// Sheet is a laid out contact sheet ready to be drawn
+type Sheet struct {
+	options Options
+	layout  layout.Sheet
+	scene   render.Scene
+	source  *image.Source
+	// Number of pages
+	Pages int
+}
+
+// New lays out the photos with the ids into a contact sheet, with the
+// titles and captions in the font family
+func New(source *image.Source, ids []image.ImageId, fonts *canvas.FontFamily, options Options) (*Sheet, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	options = options.withDefaults()
+
+	size := papers[options.paper()]
+	if options.Landscape {
+		size[0], size[1] = size[1], size[0]
+	}
+	config := layout.Sheet{
+		PageWidth:  size[0],
+		PageHeight: size[1],
+		Margin:     10,
+		Columns:    options.Columns,
+		Rows:       options.Rows,
+		Spacing:    4,
+		Title:      options.Title,
+		TitleFont:  fonts.Face(12, canvas.Black, canvas.FontRegular, canvas.FontNormal),
+	}
+	if options.Captions {
+		caption := fonts.Face(6, canvas.Dimgray, canvas.FontRegular, canvas.FontNormal)
+		config.CaptionFont = &caption
+	}
+
+	infos := make(chan image.SourcedInfo, 100)
+	go func() {
+		defer close(infos)
+		for _, id := range ids {
+			infos <- image.SourcedInfo{Id: id, Info: source.GetInfo(id)}
+		}
+	}()
+
+	s := &Sheet{
+		options: options,
+		layout:  config,
+		source:  source,
+	}
+	s.Pages = layout.LayoutSheet(infos, config, &s.scene, source)
+	return s, nil
+}
+
+// loaded is a photo of a page loaded at the resolution of the sheet
+type loaded struct {
+	photo *render.Photo
+	img   goimage.Image
+}
+
+// load loads the photos of the page in parallel, calling drawPhoto with each
+// one in the order they were loaded
+func (s *Sheet) load(ctx context.Context, page int, drawPhoto func(loaded)) error {
+	perPage := s.layout.PerPage()
+	start := page * perPage
+	end := start + perPage
+	if end > len(s.scene.Photos) {
+		end = len(s.scene.Photos)
+	}
+
+	photos := make(chan *render.Photo)
+	out := make(chan loaded)
+	workers := runtime.NumCPU()
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for photo := range photos {
+				rect := photo.Sprite.Rect
+				size := image.Size{
+					X: int(rect.W*s.options.dpmm() + 0.5),
+					Y: int(rect.H*s.options.dpmm() + 0.5),
+				}
+				img, err := s.source.LoadImage(ctx, photo.Id, size)
+				if err != nil {
+					renderLog.Warn("sheet unable to load", "id", photo.Id, "err", err)
+					continue
+				}
+				out <- loaded{photo: photo, img: image.FitInside(img, size)}
+			}
+		}()
+	}
+	go func() {
+		defer close(photos)
+		for i := start; i < end; i++ {
+			select {
+			case photos <- &s.scene.Photos[i]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		for i := 0; i < workers; i++ {
+			<-done
+		}
+		close(out)
+	}()
+
+	for l := range out {
+		drawPhoto(l)
+	}
+	return ctx.Err()
+}
+
+// drawPage draws the page of the sheet with the top left of the page at
+// the top left of the context
+func (s *Sheet) drawPage(ctx context.Context, c *canvas.Context, page int) error {
+	top := float64(page) * s.layout.PageHeight
+	c.SetView(canvas.Identity.Translate(0, s.layout.PageHeight+top))
+
+	err := s.load(ctx, page, func(l loaded) {
+		b := l.img.Bounds()
+		m := l.photo.Sprite.Rect.GetMatrixFitInside(float64(b.Dx()), float64(b.Dy()))
+		c.RenderImage(l.img, c.View().Mul(m))
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range s.scene.Texts {
+		text := &s.scene.Texts[i]
+		rect := text.Sprite.Rect
+		if rect.Y < top || rect.Y >= top+s.layout.PageHeight {
+			continue
+		}
+		line := canvas.NewTextLine(*text.Font, text.Text, canvas.Left)
+		c.RenderText(line, c.View().Mul(rect.GetMatrix()))
+	}
+	return nil
+}
+
+// WritePDF writes all pages of the sheet as a PDF
+func (s *Sheet) WritePDF(ctx context.Context, w io.Writer) error {
+	pdf := canvas.NewPDF(w, s.layout.PageWidth, s.layout.PageHeight)
+	pdf.SetImageEncoding(canvas.Lossy)
+	pdf.SetInfo(s.options.Title, "Contact sheet", "", "Photofield")
+	c := canvas.NewContext(pdf)
+	for page := 0; page < s.Pages; page++ {
+		if page > 0 {
+			pdf.NewPage(s.layout.PageWidth, s.layout.PageHeight)
+		}
+		if err := s.drawPage(ctx, c, page); err != nil {
+			return err
+		}
+	}
+	return pdf.Close()
+}
+
+// WriteJPEG writes the page of the sheet, starting at 0, as a JPEG
+func (s *Sheet) WriteJPEG(ctx context.Context, w io.Writer, page int) error {
+	if page < 0 || page >= s.Pages {
+		return fmt.Errorf("page %d out of range, the sheet has %d pages", page+1, s.Pages)
+	}
+	dpmm := s.options.dpmm()
+	img := goimage.NewRGBA(goimage.Rect(
+		0, 0,
+		int(s.layout.PageWidth*dpmm+0.5),
+		int(s.layout.PageHeight*dpmm+0.5),
+	))
+	draw.Draw(img, img.Bounds(), goimage.White, goimage.Point{}, draw.Src)
+	c := canvas.NewContext(rasterizer.New(img, canvas.DPMM(dpmm)))
+	if err := s.drawPage(ctx, c, page); err != nil {
+		return err
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+}
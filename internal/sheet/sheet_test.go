@@ -0,0 +1,34 @@
+package sheet
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	valid := []Options{
+		{},
+		{Paper: "letter", Landscape: true, Columns: 6, Rows: 8, DPI: 300},
+	}
+	for _, options := range valid {
+		if err := options.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %s", options, err)
+		}
+	}
+
+	invalid := []Options{
+		{Paper: "b5"},
+		{Columns: 21},
+		{Rows: -1},
+		{DPI: 1200},
+	}
+	for _, options := range invalid {
+		if err := options.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", options)
+		}
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	options := Options{Columns: 3}.withDefaults()
+	if options.Columns != 3 || options.Rows != 5 || options.DPI != 150 || options.paper() != "a4" {
+		t.Errorf("unexpected defaults %+v", options)
+	}
+}
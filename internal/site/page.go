@@ -0,0 +1,129 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"photofield/internal/image"
+)
+
+// photoPage is a photo as linked from the pages, with paths relative to
+// the root of the site
+type photoPage struct {
+	Id        image.ImageId
+	Name      string
+	Date      string
+	Thumbnail string
+	Image     string
+	Original  string
+	Width     int
+	Height    int
+}
+
+// Height of the rows of thumbnails on the index page, as in the style
+const rowHeight = 200
+
+func (p photoPage) Page() string {
+	return fmt.Sprintf("photos/%d.html", p.Id)
+}
+
+// RowWidth returns the width of the thumbnail scaled to the row height,
+// which the rows are justified from
+func (p photoPage) RowWidth() int {
+	if p.Height == 0 {
+		return rowHeight
+	}
+	return p.Width * rowHeight / p.Height
+}
+
+const style = `
+body { margin: 0; background: #111; color: #eee; font-family: sans-serif; }
+a { color: inherit; }
+h1 { font-weight: normal; margin: 16px; }
+.grid { display: flex; flex-wrap: wrap; gap: 4px; padding: 4px; }
+.grid a { flex-grow: 1; height: 200px; }
+.grid img { height: 100%; width: 100%; object-fit: cover; display: block; }
+.photo { display: flex; flex-direction: column; height: 100vh; }
+.photo .image { flex: 1; min-height: 0; display: flex; align-items: center; justify-content: center; }
+.photo .image img { max-width: 100%; max-height: 100%; }
+.photo nav { display: flex; gap: 16px; padding: 12px 16px; }
+.photo nav .caption { flex: 1; text-align: center; opacity: 0.8; }
+`
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="grid">
+{{range .Photos}}<a href="{{.Page}}" style="width: {{.RowWidth}}px"><img src="{{.Thumbnail}}" width="{{.Width}}" height="{{.Height}}" alt="{{.Name}}" loading="lazy"></a>
+{{end}}</div>
+</body>
+</html>
+`))
+
+var photoTemplate = template.Must(template.New("photo").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Photo.Name}} - {{.Title}}</title>
+<style>{{.Style}}</style>
+{{with .Next}}<link rel="prefetch" href="../{{.Image}}">{{end}}
+</head>
+<body class="photo">
+<div class="image"><img src="../{{.Photo.Image}}" alt="{{.Photo.Name}}"></div>
+<nav>
+{{with .Prev}}<a href="../{{.Page}}" rel="prev">Previous</a>{{end}}
+<a href="../index.html">{{.Title}}</a>
+<span class="caption">{{.Photo.Date}}</span>
+{{with .Photo.Original}}<a href="../{{.}}" download>Original</a>{{end}}
+{{with .Next}}<a href="../{{.Page}}" rel="next">Next</a>{{end}}
+</nav>
+</body>
+</html>
+`))
+
+// writePages writes the index page linking to the page of each photo
+func writePages(w Writer, title string, photos []photoPage) error {
+	css := template.CSS(style)
+	err := writeFile(w, "index.html", func(f io.Writer) error {
+		return indexTemplate.Execute(f, struct {
+			Title  string
+			Style  template.CSS
+			Photos []photoPage
+		}{title, css, photos})
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, p := range photos {
+		var prev, next *photoPage
+		if i > 0 {
+			prev = &photos[i-1]
+		}
+		if i < len(photos)-1 {
+			next = &photos[i+1]
+		}
+		err := writeFile(w, p.Page(), func(f io.Writer) error {
+			return photoTemplate.Execute(f, struct {
+				Title string
+				Style template.CSS
+				Photo photoPage
+				Prev  *photoPage
+				Next  *photoPage
+			}{title, css, p, prev, next})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
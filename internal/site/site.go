@@ -0,0 +1,258 @@
+// Package site renders photos into a static website of plain HTML pages
+// and pre-generated JPEGs, which can be hosted anywhere without running
+// the server, e.g. on S3 or GitHub Pages.
+package site
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	goimage "image"
+	"image/jpeg"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/internal/logging"
+)
+
+var serverLog = logging.Module("server")
+
+// Options configure the exported site
+type Options struct {
+	Title string
+	// Longest side of the thumbnails shown on the index page
+	ThumbnailSize int
+	// Longest side of the photos shown on their own pages
+	ImageSize int
+	// Include the original files for download
+	Originals bool
+}
+
+func (options Options) withDefaults() Options {
+	if options.Title == "" {
+		options.Title = "Photos"
+	}
+	if options.ThumbnailSize <= 0 {
+		options.ThumbnailSize = 400
+	}
+	if options.ImageSize <= 0 {
+		options.ImageSize = 2048
+	}
+	return options
+}
+
+// Writer creates the files of the site, e.g. in a dir or a zip archive.
+// Each file is closed before the next one is created.
+type Writer interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Dir writes the site into a dir
+type Dir string
+
+func (dir Dir) Create(name string) (io.WriteCloser, error) {
+	path := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// Zip writes the site into a zip archive
+type Zip struct {
+	*zip.Writer
+}
+
+func NewZip(w io.Writer) Zip {
+	return Zip{zip.NewWriter(w)}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (z Zip) Create(name string) (io.WriteCloser, error) {
+	w, err := z.CreateHeader(&zip.FileHeader{
+		Name: name,
+		// JPEGs do not compress any further
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{w}, nil
+}
+
+// rendered is a photo rendered in the sizes of the site
+type rendered struct {
+	Id        image.ImageId
+	Name      string
+	Path      string
+	DateTime  time.Time
+	Thumbnail []byte
+	Image     []byte
+	// Size of the thumbnail, so that the index can be laid out before
+	// the thumbnails are loaded
+	Width  int
+	Height int
+	Err    error
+}
+
+func encode(img goimage.Image) ([]byte, error) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func render(ctx context.Context, source *image.Source, id image.ImageId, options Options) rendered {
+	r := rendered{Id: id}
+	path, err := source.GetImagePath(id)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Path = path
+	r.Name = filepath.Base(path)
+	if source.IsSupportedVideo(path) {
+		r.Err = fmt.Errorf("videos are not supported")
+		return r
+	}
+	r.DateTime = source.GetInfo(id).DateTime
+
+	size := image.Size{X: options.ImageSize, Y: options.ImageSize}
+	img, err := source.LoadImage(ctx, id, size)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	img = image.FitInside(img, size)
+	if r.Image, err = encode(img); err != nil {
+		r.Err = err
+		return r
+	}
+
+	thumb := image.FitInside(img, image.Size{X: options.ThumbnailSize, Y: options.ThumbnailSize})
+	r.Width = thumb.Bounds().Dx()
+	r.Height = thumb.Bounds().Dy()
+	if r.Thumbnail, err = encode(thumb); err != nil {
+		r.Err = err
+	}
+	return r
+}
+
+func writeFile(w Writer, name string, write func(io.Writer) error) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return f.Close()
+}
+
+func writeBytes(w Writer, name string, b []byte) error {
+	return writeFile(w, name, func(f io.Writer) error {
+		_, err := f.Write(b)
+		return err
+	})
+}
+
+func copyOriginal(w Writer, name string, path string) error {
+	return writeFile(w, name, func(f io.Writer) error {
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(f, in)
+		return err
+	})
+}
+
+// Export renders the photos with the ids into the writer, keeping their
+// order. Videos and photos that cannot be loaded are skipped. Returns the
+// number of exported photos.
+func Export(ctx context.Context, w Writer, source *image.Source, ids []image.ImageId, options Options) (int, error) {
+	options = options.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Photos are rendered in parallel, but only a few ahead of the one
+	// being written, so that memory use does not grow with the number of
+	// photos
+	results := make([]chan rendered, len(ids))
+	for i := range results {
+		results[i] = make(chan rendered, 1)
+	}
+	ahead := make(chan struct{}, runtime.NumCPU())
+	go func() {
+		for i, id := range ids {
+			select {
+			case ahead <- struct{}{}:
+			case <-ctx.Done():
+				results[i] <- rendered{Id: id, Err: ctx.Err()}
+				continue
+			}
+			go func(i int, id image.ImageId) {
+				results[i] <- render(ctx, source, id, options)
+			}(i, id)
+		}
+	}()
+
+	var pages []photoPage
+	for i := range ids {
+		r := <-results[i]
+		if ctx.Err() != nil {
+			return len(pages), ctx.Err()
+		}
+		<-ahead
+		if r.Err != nil {
+			serverLog.Warn("site export skipping photo", "id", r.Id, "path", r.Path, "err", r.Err)
+			continue
+		}
+
+		p := photoPage{
+			Id:        r.Id,
+			Name:      r.Name,
+			Thumbnail: fmt.Sprintf("thumbs/%d.jpg", r.Id),
+			Image:     fmt.Sprintf("images/%d.jpg", r.Id),
+			Width:     r.Width,
+			Height:    r.Height,
+		}
+		// Files without metadata yet have the unix epoch as their date
+		if r.DateTime.After(time.Unix(0, 0)) {
+			p.Date = r.DateTime.Format("2 January 2006")
+		}
+		if err := writeBytes(w, p.Thumbnail, r.Thumbnail); err != nil {
+			return len(pages), err
+		}
+		if err := writeBytes(w, p.Image, r.Image); err != nil {
+			return len(pages), err
+		}
+		if options.Originals {
+			p.Original = fmt.Sprintf("originals/%d/%s", r.Id, url.PathEscape(r.Name))
+			if err := copyOriginal(w, fmt.Sprintf("originals/%d/%s", r.Id, r.Name), r.Path); err != nil {
+				return len(pages), err
+			}
+		}
+		pages = append(pages, p)
+	}
+
+	if err := writePages(w, options.Title, pages); err != nil {
+		return len(pages), err
+	}
+	return len(pages), nil
+}
@@ -0,0 +1,64 @@
+package site
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type memory map[string]*bytes.Buffer
+
+type memoryFile struct {
+	*bytes.Buffer
+}
+
+func (memoryFile) Close() error { return nil }
+
+func (m memory) Create(name string) (io.WriteCloser, error) {
+	b := &bytes.Buffer{}
+	m[name] = b
+	return memoryFile{b}, nil
+}
+
+func TestWritePages(t *testing.T) {
+	m := memory{}
+	photos := []photoPage{
+		{Id: 1, Name: "a.jpg", Thumbnail: "thumbs/1.jpg", Image: "images/1.jpg", Width: 400, Height: 300},
+		{Id: 2, Name: "b <c>.jpg", Thumbnail: "thumbs/2.jpg", Image: "images/2.jpg", Original: "originals/2/b%20%3Cc%3E.jpg", Width: 300, Height: 400},
+	}
+	if err := writePages(m, "Trip & Co", photos); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(m))
+	}
+
+	index := m["index.html"].String()
+	for _, s := range []string{
+		"<title>Trip &amp; Co</title>",
+		`<a href="photos/1.html" style="width: 266px">`,
+		`<a href="photos/2.html" style="width: 150px">`,
+		`alt="b &lt;c&gt;.jpg"`,
+	} {
+		if !strings.Contains(index, s) {
+			t.Errorf("index missing %s", s)
+		}
+	}
+
+	first := m["photos/1.html"].String()
+	if strings.Contains(first, `rel="prev"`) || !strings.Contains(first, `<a href="../photos/2.html" rel="next">`) {
+		t.Errorf("unexpected navigation of first page\n%s", first)
+	}
+	if strings.Contains(first, "download") {
+		t.Errorf("unexpected original download of first page")
+	}
+
+	last := m["photos/2.html"].String()
+	if !strings.Contains(last, `<a href="../photos/1.html" rel="prev">`) || strings.Contains(last, `rel="next"`) {
+		t.Errorf("unexpected navigation of last page\n%s", last)
+	}
+	if !strings.Contains(last, `<a href="../originals/2/b%20%3Cc%3E.jpg" download>`) {
+		t.Errorf("unexpected original download of last page\n%s", last)
+	}
+}
@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"photofield/internal/logging"
+)
+
+var serverLog = logging.Module("server")
+
+const (
+	// Maximum number of spans exported in one request
+	batchSize = 512
+	// Maximum time a span waits for other spans to be batched with
+	batchDelay = 5 * time.Second
+	// Spans queued before new spans are dropped
+	queueSize = 10000
+)
+
+type exporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	// Traces with the first 8 bytes of their id below the threshold are
+	// sampled, so that all processes make the same decision
+	threshold uint64
+	queue     chan *Span
+	client    *http.Client
+	delay     time.Duration
+}
+
+func newExporter(config Config) *exporter {
+	e := &exporter{
+		url:         strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces",
+		headers:     config.Headers,
+		serviceName: config.ServiceName,
+		threshold:   ^uint64(0),
+		queue:       make(chan *Span, queueSize),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		delay:       batchDelay,
+	}
+	if e.serviceName == "" {
+		e.serviceName = "photofield"
+	}
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		e.threshold = uint64(config.SampleRatio * float64(^uint64(0)))
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) sample(id TraceId) bool {
+	return binary.BigEndian.Uint64(id[:8]) <= e.threshold
+}
+
+// add queues the span for export without blocking, dropping it if the
+// collector is too far behind
+func (e *exporter) add(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+func (e *exporter) run() {
+	batch := make([]*Span, 0, batchSize)
+	for s := range e.queue {
+		batch = append(batch[:0], s)
+		timeout := time.After(e.delay)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+			case <-timeout:
+				break collect
+			}
+		}
+		if err := e.export(batch); err != nil {
+			serverLog.Warn("tracing dropping spans", "count", len(batch), "err", err)
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding of ExportTraceServiceRequest, with ids as hex strings
+// and 64-bit integers as decimal strings
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpPayload struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func newOtlpAttr(a Attr) otlpAttr {
+	attr := otlpAttr{Key: a.Key}
+	switch v := a.Value.(type) {
+	case string:
+		attr.Value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		attr.Value.IntValue = &s
+	case bool:
+		attr.Value.BoolValue = &v
+	case float64:
+		attr.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		attr.Value.StringValue = &s
+	}
+	return attr
+}
+
+func (e *exporter) payload(spans []*Span) otlpPayload {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, len(spans))}
+	scope.Scope.Name = "photofield"
+	for i, s := range spans {
+		o := otlpSpan{
+			TraceId:           hex.EncodeToString(s.traceId[:]),
+			SpanId:            hex.EncodeToString(s.spanId[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != (SpanId{}) {
+			o.ParentSpanId = hex.EncodeToString(s.parent[:])
+		}
+		for _, a := range s.attrs {
+			o.Attributes = append(o.Attributes, newOtlpAttr(a))
+		}
+		if s.err != "" {
+			// STATUS_CODE_ERROR
+			o.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		scope.Spans[i] = o
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttr{newOtlpAttr(String("service.name", e.serviceName))}
+	return otlpPayload{ResourceSpans: []otlpResourceSpans{resource}}
+}
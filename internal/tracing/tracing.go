@@ -0,0 +1,232 @@
+// Package tracing records spans of requests, e.g. tile renders down to the
+// sources, caches and database queries they hit, and exports them to an
+// OpenTelemetry collector with OTLP over HTTP in the JSON encoding.
+//
+// Tracing is disabled until Init is called with an endpoint, in which case
+// Start returns nil spans and all span methods are no-ops.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Config struct {
+	// OTLP/HTTP endpoint of the collector, e.g. http://localhost:4318,
+	// disabled if empty
+	Endpoint    string `json:"endpoint"`
+	ServiceName string `json:"service_name"`
+	// Fraction of traces recorded between 0 and 1, all if 0
+	SampleRatio float64           `json:"sample_ratio"`
+	Headers     map[string]string `json:"headers"`
+}
+
+func (config *Config) Validate() error {
+	if config.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("endpoint: unsupported scheme %s, use http or https", u.Scheme)
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return fmt.Errorf("sample_ratio: expected between 0 and 1, got %v", config.SampleRatio)
+	}
+	return nil
+}
+
+type Kind int
+
+// Span kinds as defined by OTLP
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+)
+
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Attr { return Attr{key, value} }
+func Int(key string, value int) Attr       { return Attr{key, int64(value)} }
+func Int64(key string, value int64) Attr   { return Attr{key, value} }
+func Bool(key string, value bool) Attr     { return Attr{key, value} }
+func Float(key string, value float64) Attr { return Attr{key, value} }
+
+type TraceId [16]byte
+type SpanId [8]byte
+
+// spanContext identifies a span, possibly of another process
+type spanContext struct {
+	traceId TraceId
+	spanId  SpanId
+	sampled bool
+}
+
+type Span struct {
+	spanContext
+	parent SpanId
+	name   string
+	kind   Kind
+	start  time.Time
+	end    time.Time
+	attrs  []Attr
+	err    string
+}
+
+type contextKey struct{}
+
+var exp *exporter
+
+// Init starts exporting the spans to the collector if the endpoint is set
+func Init(config Config) {
+	if config.Endpoint == "" {
+		return
+	}
+	exp = newExporter(config)
+}
+
+// Enabled reports whether spans are recorded
+func Enabled() bool {
+	return exp != nil
+}
+
+// Start starts a span as a child of the span of the context, or of a new
+// trace if there is none
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, Internal, attrs)
+}
+
+func start(ctx context.Context, name string, kind Kind, attrs []Attr) (context.Context, *Span) {
+	if exp == nil {
+		return ctx, nil
+	}
+	parent, hasParent := ctx.Value(contextKey{}).(spanContext)
+	if hasParent && !parent.sampled {
+		return ctx, nil
+	}
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+		attrs: attrs,
+	}
+	rand.Read(s.spanId[:])
+	if hasParent {
+		s.traceId = parent.traceId
+		s.parent = parent.spanId
+		s.sampled = true
+	} else {
+		rand.Read(s.traceId[:])
+		s.sampled = exp.sample(s.traceId)
+		if !s.sampled {
+			return context.WithValue(ctx, contextKey{}, s.spanContext), nil
+		}
+	}
+	return context.WithValue(ctx, contextKey{}, s.spanContext), s
+}
+
+// SetAttributes adds the attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed if the error is not nil
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err.Error()
+}
+
+// End ends the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	exp.add(s)
+}
+
+// parseTraceparent parses a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(header string) (spanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return spanContext{}, false
+	}
+	var sc spanContext
+	if n, err := hex.Decode(sc.traceId[:], []byte(parts[1])); err != nil || n != len(sc.traceId) || sc.traceId == (TraceId{}) {
+		return spanContext{}, false
+	}
+	if n, err := hex.Decode(sc.spanId[:], []byte(parts[2])); err != nil || n != len(sc.spanId) || sc.spanId == (SpanId{}) {
+		return spanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return spanContext{}, false
+	}
+	sc.sampled = flags[0]&0x01 != 0
+	return sc, true
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware records a span for each request, continuing the trace of the
+// traceparent header if there is one. The span is named after the route
+// pattern, e.g. GET /scenes/{scene_id}/tiles.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exp == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if sc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, contextKey{}, sc)
+		}
+		ctx, span := start(ctx, r.Method, Server, []Attr{
+			String("http.method", r.Method),
+			String("http.target", r.URL.Path),
+		})
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if span == nil {
+			return
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				span.name = r.Method + " " + pattern
+				span.SetAttributes(String("http.route", pattern))
+			}
+		}
+		span.SetAttributes(Int("http.status_code", rec.status))
+		if rec.status >= 500 {
+			span.err = http.StatusText(rec.status)
+		}
+		span.End()
+	})
+}
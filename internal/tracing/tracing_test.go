@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDisabled(t *testing.T) {
+	exp = nil
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil {
+		t.Fatalf("expected no span while disabled")
+	}
+	span.SetAttributes(Int("x", 1))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	if ctx.Value(contextKey{}) != nil {
+		t.Errorf("expected context to be unchanged")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sc.sampled {
+		t.Fatalf("expected sampled parent, got %v %+v", ok, sc)
+	}
+	if sc.traceId[0] != 0x4b || sc.spanId[7] != 0xb7 {
+		t.Errorf("unexpected ids %+v", sc)
+	}
+	if sc, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"); !ok || sc.sampled {
+		t.Errorf("expected unsampled parent")
+	}
+	for _, header := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f35-00f067aa0ba902b7-01",
+	} {
+		if _, ok := parseTraceparent(header); ok {
+			t.Errorf("expected %q to be invalid", header)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	received := make(chan otlpPayload, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		var p otlpPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		received <- p
+	}))
+	defer collector.Close()
+
+	exp = newExporter(Config{Endpoint: collector.URL})
+	exp.delay = 100 * time.Millisecond
+	defer func() { exp = nil }()
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/scenes/{scene_id}/tiles", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "draw tile", Int("zoom", 3))
+		span.RecordError(errors.New("missing photos"))
+		span.End()
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/scenes/abc/tiles", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var p otlpPayload
+	select {
+	case p = <-received:
+	case <-time.After(2 * batchDelay):
+		t.Fatal("expected spans to be exported")
+	}
+	spans := p.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name != "GET /scenes/{scene_id}/tiles" || server.Kind != Server {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	if server.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanId != "00f067aa0ba902b7" {
+		t.Errorf("expected server span to continue the trace, got %+v", server)
+	}
+	if child.TraceId != server.TraceId || child.ParentSpanId != server.SpanId {
+		t.Errorf("expected child of the server span, got %+v", child)
+	}
+	if child.Status.Code != 2 || child.Status.Message != "missing photos" {
+		t.Errorf("expected error status, got %+v", child.Status)
+	}
+	if len(child.Attributes) != 1 || *child.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("unexpected attributes %+v", child.Attributes)
+	}
+}
+
+func TestSample(t *testing.T) {
+	e := &exporter{threshold: ^uint64(0) / 4}
+	sampled := 0
+	for i := 0; i < 256; i++ {
+		if e.sample(TraceId{byte(i)}) {
+			sampled++
+		}
+	}
+	if sampled != 64 {
+		t.Errorf("expected a quarter sampled, got %d of 256", sampled)
+	}
+}
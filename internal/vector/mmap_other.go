@@ -0,0 +1,26 @@
+//go:build !unix
+// +build !unix
+
+package vector
+
+import (
+	"io"
+	"os"
+)
+
+// Memory mapping is not supported on this platform, so the file is read into
+// memory and changes are written to both
+const writeThrough = true
+
+func mmap(f *os.File, size int, writable bool) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := f.ReadAt(data, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	return data, err
+}
+
+func munmap(data []byte) error {
+	return nil
+}
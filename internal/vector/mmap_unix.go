@@ -0,0 +1,27 @@
+//go:build unix
+// +build unix
+
+package vector
+
+import (
+	"os"
+	"syscall"
+)
+
+// Changes to the mapping are written to the file by the operating system
+const writeThrough = false
+
+func mmap(f *os.File, size int, writable bool) ([]byte, error) {
+	prot := syscall.PROT_READ
+	if writable {
+		prot |= syscall.PROT_WRITE
+	}
+	return syscall.Mmap(int(f.Fd()), 0, size, prot, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
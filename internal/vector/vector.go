@@ -0,0 +1,510 @@
+// Package vector stores fixed-size vectors, e.g. AI embeddings, by id in a
+// single file that is memory-mapped where supported.
+//
+// The file starts with a header, followed by records of an id, a 16-bit
+// scale of the vector, e.g. its inverse norm, and the vector itself, so that
+// scanning many vectors reads memory sequentially instead of decoding
+// database rows. Records are only ever appended or overwritten in place,
+// deleted records are cleared and reclaimed when the file is compacted on
+// open.
+package vector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Format of the stored vector elements
+type Format uint8
+
+const (
+	// Half-precision floats, as returned by the AI server, half the size of
+	// single-precision floats
+	Float16 Format = 1
+	// Signed bytes, a quarter of the size of single-precision floats
+	Int8 Format = 2
+)
+
+// Size returns the bytes of a vector element
+func (f Format) Size() int {
+	switch f {
+	case Float16:
+		return 2
+	case Int8:
+		return 1
+	default:
+		return 0
+	}
+}
+
+var ErrDimensions = errors.New("vector dimensions do not match the store")
+var ErrFormat = errors.New("unsupported vector store file")
+var ErrReadOnly = errors.New("vector store is read-only")
+
+const (
+	magic      = "PFVECTOR"
+	version    = 1
+	headerSize = 64
+	// Id and scale, padded to keep vectors aligned
+	recordHeaderSize = 8
+	// Records added at once when the file grows
+	growRecords = 1024
+)
+
+// Store is a file of vectors by id, safe for concurrent use. A read-only
+// store follows the records another process appends with Refresh.
+type Store struct {
+	mutex    sync.RWMutex
+	path     string
+	readOnly bool
+	file     *os.File
+	data     []byte
+	format   Format
+	dims     int
+	count    int
+	deleted  int
+	index    map[uint32]int
+}
+
+// Open opens the store at path, creating it unless it is read-only. A
+// missing read-only store is empty until Refresh finds it.
+func Open(path string, format Format, readOnly bool) (*Store, error) {
+	if format.Size() == 0 {
+		return nil, ErrFormat
+	}
+	s := &Store{
+		path:     path,
+		readOnly: readOnly,
+		format:   format,
+		index:    make(map[uint32]int),
+	}
+	err := s.open()
+	if readOnly && errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !readOnly && s.deleted > growRecords && s.deleted > s.count/4 {
+		if err := s.compact(); err != nil {
+			s.close()
+			return nil, fmt.Errorf("unable to compact %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) open() error {
+	flag := os.O_RDWR | os.O_CREATE
+	if s.readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(s.path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi.Size() == 0 && !s.readOnly {
+		if err := writeHeader(f, s.format); err != nil {
+			f.Close()
+			return err
+		}
+		fi, err = f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if fi.Size() < headerSize {
+		f.Close()
+		return ErrFormat
+	}
+	data, err := mmap(f, int(fi.Size()), !s.readOnly)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.data = data
+	s.count = 0
+	s.deleted = 0
+	s.index = make(map[uint32]int)
+	if err := s.readHeader(); err != nil {
+		s.close()
+		return err
+	}
+	s.scan()
+	return nil
+}
+
+func writeHeader(f *os.File, format Format) error {
+	h := make([]byte, headerSize)
+	copy(h, magic)
+	binary.LittleEndian.PutUint32(h[8:], version)
+	h[12] = byte(format)
+	_, err := f.WriteAt(h, 0)
+	return err
+}
+
+func (s *Store) readHeader() error {
+	h := s.data[:headerSize]
+	if string(h[:8]) != magic || binary.LittleEndian.Uint32(h[8:]) != version {
+		return ErrFormat
+	}
+	if Format(h[12]) != s.format {
+		return fmt.Errorf("%w: stored format %d, expected %d", ErrFormat, h[12], s.format)
+	}
+	s.dims = int(binary.LittleEndian.Uint32(h[16:]))
+	return nil
+}
+
+// records returns the number of records in the header, which can be more
+// than are mapped if another process appended them since
+func (s *Store) records() int {
+	return int(binary.LittleEndian.Uint64(s.data[24:]))
+}
+
+func (s *Store) recordSize() int {
+	return recordHeaderSize + s.dims*s.format.Size()
+}
+
+func (s *Store) capacity() int {
+	if s.dims == 0 {
+		return 0
+	}
+	return (len(s.data) - headerSize) / s.recordSize()
+}
+
+func (s *Store) record(slot int) []byte {
+	size := s.recordSize()
+	offset := headerSize + slot*size
+	return s.data[offset : offset+size]
+}
+
+// scan indexes the records after the ones indexed already
+func (s *Store) scan() {
+	n := s.records()
+	if c := s.capacity(); n > c {
+		n = c
+	}
+	for ; s.count < n; s.count++ {
+		id := binary.LittleEndian.Uint32(s.record(s.count))
+		if id == 0 {
+			s.deleted++
+			continue
+		}
+		s.index[id] = s.count
+	}
+}
+
+// Dimensions returns the number of elements of the stored vectors, 0 if
+// none were stored yet
+func (s *Store) Dimensions() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.dims
+}
+
+// Len returns the number of stored vectors
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.index)
+}
+
+// Ids returns the ids of the stored vectors in no particular order
+func (s *Store) Ids() []uint32 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ids := make([]uint32, 0, len(s.index))
+	for id := range s.index {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Get returns a copy of the vector with the id and its inverse norm
+func (s *Store) Get(id uint32) (vector []byte, invnorm uint16, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	r, ok := s.get(id)
+	if !ok {
+		return nil, 0, false
+	}
+	vector = make([]byte, len(r)-recordHeaderSize)
+	copy(vector, r[recordHeaderSize:])
+	return vector, binary.LittleEndian.Uint16(r[4:]), true
+}
+
+func (s *Store) get(id uint32) ([]byte, bool) {
+	slot, ok := s.index[id]
+	if !ok {
+		return nil, false
+	}
+	r := s.record(slot)
+	// Deleted by another process since it was indexed
+	if binary.LittleEndian.Uint32(r) != id {
+		return nil, false
+	}
+	return r, true
+}
+
+// Range calls fn with the vectors of the ids in order, skipping the missing
+// ones, until fn returns false. The vector is only valid during the call.
+func (s *Store) Range(ids []uint32, fn func(id uint32, vector []byte, invnorm uint16) bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, id := range ids {
+		r, ok := s.get(id)
+		if !ok {
+			continue
+		}
+		if !fn(id, r[recordHeaderSize:], binary.LittleEndian.Uint16(r[4:])) {
+			return
+		}
+	}
+}
+
+// Put stores the vector with the id, replacing the previous one
+func (s *Store) Put(id uint32, vector []byte, invnorm uint16) error {
+	if id == 0 {
+		return fmt.Errorf("invalid vector id %d", id)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	size := s.format.Size()
+	if len(vector) == 0 || len(vector)%size != 0 {
+		return ErrDimensions
+	}
+	dims := len(vector) / size
+	if dims != s.dims {
+		if len(s.index) > 0 {
+			return fmt.Errorf("%w: %d instead of %d", ErrDimensions, dims, s.dims)
+		}
+		// Nothing stored yet, or only vectors of a previous model that were
+		// all deleted since
+		if err := s.reset(dims); err != nil {
+			return err
+		}
+	}
+
+	slot, exists := s.index[id]
+	if !exists {
+		if s.count >= s.capacity() {
+			if err := s.grow(s.count + growRecords); err != nil {
+				return err
+			}
+		}
+		slot = s.count
+	}
+	r := s.record(slot)
+	binary.LittleEndian.PutUint32(r, id)
+	binary.LittleEndian.PutUint16(r[4:], invnorm)
+	copy(r[recordHeaderSize:], vector)
+	if err := s.flushRange(headerSize+slot*len(r), len(r)); err != nil {
+		return err
+	}
+	if !exists {
+		// Counted once written, so that readers never index a partial record
+		s.count++
+		binary.LittleEndian.PutUint64(s.data[24:], uint64(s.count))
+		if err := s.flushRange(24, 8); err != nil {
+			return err
+		}
+	}
+	s.index[id] = slot
+	return nil
+}
+
+// Delete removes the vector with the id, if any
+func (s *Store) Delete(id uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	slot, ok := s.index[id]
+	if !ok {
+		return nil
+	}
+	r := s.record(slot)
+	for i := range r {
+		r[i] = 0
+	}
+	delete(s.index, id)
+	s.deleted++
+	return s.flushRange(headerSize+slot*len(r), len(r))
+}
+
+// reset empties the store for vectors with the dimensions
+func (s *Store) reset(dims int) error {
+	binary.LittleEndian.PutUint32(s.data[16:], uint32(dims))
+	binary.LittleEndian.PutUint64(s.data[24:], 0)
+	if err := s.flushRange(0, headerSize); err != nil {
+		return err
+	}
+	s.dims = dims
+	s.count = 0
+	s.deleted = 0
+	s.index = make(map[uint32]int)
+	return s.resize(0)
+}
+
+// grow makes room for at least n records
+func (s *Store) grow(n int) error {
+	if c := s.capacity(); n <= c {
+		return nil
+	}
+	return s.resize(n)
+}
+
+// resize truncates or extends the file to n records and maps it again
+func (s *Store) resize(n int) error {
+	size := headerSize + n*s.recordSize()
+	if err := s.file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	if err := munmap(s.data); err != nil {
+		return err
+	}
+	data, err := mmap(s.file, size, true)
+	if err != nil {
+		s.data = nil
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// flushRange writes the changed bytes to the file if it is not mapped
+func (s *Store) flushRange(offset int, n int) error {
+	if !writeThrough {
+		return nil
+	}
+	_, err := s.file.WriteAt(s.data[offset:offset+n], int64(offset))
+	return err
+}
+
+// compact rewrites the store without the deleted records
+func (s *Store) compact() error {
+	tmp := fmt.Sprintf("%s.%d.tmp", s.path, os.Getpid())
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	h := make([]byte, headerSize)
+	copy(h, s.data[:headerSize])
+	binary.LittleEndian.PutUint64(h[24:], uint64(len(s.index)))
+	_, err = f.Write(h)
+	for slot := 0; slot < s.count && err == nil; slot++ {
+		r := s.record(slot)
+		if binary.LittleEndian.Uint32(r) == 0 {
+			continue
+		}
+		_, err = f.Write(r)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.close()
+	return s.open()
+}
+
+// Refresh picks up the records another process wrote since the store was
+// opened or last refreshed, reopening it if it was replaced by compaction
+func (s *Store) Refresh() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		current, err := s.file.Stat()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(fi, current) && s.dims == int(binary.LittleEndian.Uint32(s.data[16:])) {
+			if int(fi.Size()) > len(s.data) {
+				if err := munmap(s.data); err != nil {
+					return err
+				}
+				s.data, err = mmap(s.file, int(fi.Size()), !s.readOnly)
+				if err != nil {
+					return err
+				}
+			}
+			s.scan()
+			return nil
+		}
+		s.close()
+	}
+	return s.open()
+}
+
+// Sync commits the written vectors to disk
+func (s *Store) Sync() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.file == nil || s.readOnly {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close syncs and closes the store
+func (s *Store) Close() error {
+	err := s.Sync()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cerr := s.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Store) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := munmap(s.data)
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	s.data = nil
+	s.index = make(map[uint32]int)
+	s.count = 0
+	s.deleted = 0
+	return err
+}
@@ -0,0 +1,101 @@
+package vector
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func vec(dims int, v byte) []byte {
+	b := make([]byte, dims*2)
+	for i := range b {
+		b[i] = v
+	}
+	return b
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors")
+	s, err := Open(path, Float16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(1); id <= 3000; id++ {
+		if err := s.Put(id, vec(4, byte(id)), uint16(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(4000, vec(8, 1), 0); !errors.Is(err, ErrDimensions) {
+		t.Errorf("expected ErrDimensions, got %v", err)
+	}
+	if err := s.Put(2, vec(4, 42), 42); err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(100); id < 2000; id++ {
+		if err := s.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := Open(path, Float16, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := s.Put(5000, vec(4, 5), 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := reader.Get(5000); ok {
+		t.Error("expected the reader to find new vectors only after a refresh")
+	}
+	if err := reader.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := reader.Get(5000); !ok {
+		t.Error("expected the reader to find the new vector after a refresh")
+	}
+	if err := reader.Put(1, vec(4, 1), 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compacted on open, as most records were deleted
+	s, err = Open(path, Float16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 1101 || s.deleted != 0 {
+		t.Errorf("expected 1101 vectors without deleted records, got %d and %d deleted", s.Len(), s.deleted)
+	}
+	v, invnorm, ok := s.Get(2)
+	if !ok || invnorm != 42 || !bytes.Equal(v, vec(4, 42)) {
+		t.Errorf("expected the replaced vector, got %v %d %v", v, invnorm, ok)
+	}
+	if _, _, ok := s.Get(150); ok {
+		t.Error("expected deleted vector to be missing")
+	}
+
+	var ids []uint32
+	s.Range([]uint32{1, 150, 3000, 9999}, func(id uint32, vector []byte, invnorm uint16) bool {
+		if !bytes.Equal(vector, vec(4, byte(id))) {
+			t.Errorf("unexpected vector of %d: %v", id, vector)
+		}
+		ids = append(ids, id)
+		return true
+	})
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3000 {
+		t.Errorf("expected range over 1 and 3000, got %v", ids)
+	}
+
+	if err := reader.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if reader.Len() != s.Len() {
+		t.Errorf("expected the reader to reopen the compacted store, got %d vectors instead of %d", reader.Len(), s.Len())
+	}
+}
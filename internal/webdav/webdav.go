@@ -0,0 +1,307 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photofield/internal/auth"
+	"photofield/internal/collection"
+	"photofield/internal/image"
+	"photofield/internal/logging"
+
+	xwebdav "golang.org/x/net/webdav"
+)
+
+var serverLog = logging.Module("server")
+
+// Config configures serving the upload dirs of the collections over
+// WebDAV, so that clients can sync files into them directly
+type Config struct {
+	Enable bool `json:"enable"`
+}
+
+// Methods are the WebDAV methods beyond the standard HTTP methods, which
+// need to be registered with the router before adding routes
+var Methods = []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+// Scope returns the scope required for the WebDAV method, writes require
+// the upload scope
+func Scope(method string) auth.Scope {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return auth.ScopeRead
+	}
+	return auth.ScopeUpload
+}
+
+// NewHandler serves the upload dirs of the collections as dirs named after
+// the collections. Written files are indexed right away, removed and moved
+// files are updated in the index.
+func NewHandler(prefix string, collections func() []collection.Collection, source *image.Source) http.Handler {
+	return &xwebdav.Handler{
+		Prefix: prefix,
+		FileSystem: &fileSystem{
+			collections: collections,
+			source:      source,
+		},
+		LockSystem: xwebdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				serverLog.Warn("webdav request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+}
+
+type fileSystem struct {
+	collections func() []collection.Collection
+	source      *image.Source
+}
+
+// resolve returns the collection and path of the name, or a nil collection
+// for the root listing the collections
+func (fsys *fileSystem) resolve(name string) (*collection.Collection, string, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil, "", nil
+	}
+	id, rel, _ := strings.Cut(name[1:], "/")
+	collections := fsys.collections()
+	for i := range collections {
+		c := &collections[i]
+		if c.Id != id || !c.Upload.Enabled() {
+			continue
+		}
+		if err := os.MkdirAll(c.Upload.Dir, 0755); err != nil {
+			return nil, "", err
+		}
+		return c, filepath.Join(c.Upload.Dir, filepath.FromSlash(rel)), nil
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// resolveWritable is like resolve, but rejects the root and the dirs of
+// the collections themselves
+func (fsys *fileSystem) resolveWritable(name string) (*collection.Collection, string, error) {
+	if path.Dir(path.Clean("/"+name)) == "/" {
+		return nil, "", os.ErrPermission
+	}
+	return fsys.resolve(name)
+}
+
+// index indexes the written file, unless it is hidden or not supported,
+// e.g. a temporary file of the client
+func (fsys *fileSystem) index(p string) {
+	if _, err := collection.UploadName(filepath.Base(p), fsys.source); err != nil {
+		return
+	}
+	if _, err := fsys.source.IndexFile(p); err != nil {
+		serverLog.Warn("webdav unable to index", "path", p, "err", err)
+	}
+}
+
+func (fsys *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	_, p, err := fsys.resolveWritable(name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, perm)
+}
+
+func (fsys *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (xwebdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		c, p, err := fsys.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			return &rootDir{collections: fsys.collections()}, nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	c, p, err := fsys.resolveWritable(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadFile{
+		file: f,
+		max:  c.Upload.MaxBytes(),
+		fsys: fsys,
+	}, nil
+}
+
+func (fsys *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	_, p, err := fsys.resolveWritable(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return err
+	}
+	fsys.source.RemoveFiles(p)
+	return nil
+}
+
+func (fsys *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	_, from, err := fsys.resolveWritable(oldName)
+	if err != nil {
+		return err
+	}
+	_, to, err := fsys.resolveWritable(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	// Clients often upload to a temporary name first
+	if fsys.source.MoveFiles(from, to) == 0 {
+		if info, err := os.Stat(to); err == nil && !info.IsDir() {
+			fsys.index(to)
+		}
+	}
+	return nil
+}
+
+func (fsys *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	c, p, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return dirInfo{name: "/"}, nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Clean(p) == filepath.Clean(c.Upload.Dir) {
+		return dirInfo{name: c.Id, modTime: info.ModTime()}, nil
+	}
+	return info, nil
+}
+
+// uploadFile indexes the file after it was written. The file is not
+// embedded, so that copying to it cannot skip the size check via ReadFrom
+// or WriteString.
+type uploadFile struct {
+	file     *os.File
+	written  int64
+	max      int64
+	tooLarge bool
+	fsys     *fileSystem
+}
+
+func (f *uploadFile) Write(p []byte) (int, error) {
+	if f.written+int64(len(p)) > f.max {
+		f.tooLarge = true
+		return 0, collection.ErrTooLarge
+	}
+	n, err := f.file.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+func (f *uploadFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *uploadFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *uploadFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return f.file.Readdir(count)
+}
+
+func (f *uploadFile) Stat() (fs.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *uploadFile) Close() error {
+	err := f.file.Close()
+	if f.tooLarge {
+		os.Remove(f.file.Name())
+		return collection.ErrTooLarge
+	}
+	if err != nil || f.written == 0 {
+		return err
+	}
+	f.fsys.index(f.file.Name())
+	return nil
+}
+
+// rootDir lists the collections with uploads enabled
+type rootDir struct {
+	collections []collection.Collection
+	read        bool
+}
+
+func (d *rootDir) Close() error {
+	return nil
+}
+
+func (d *rootDir) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *rootDir) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (d *rootDir) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (d *rootDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if d.read {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.read = true
+	infos := make([]fs.FileInfo, 0, len(d.collections))
+	for _, c := range d.collections {
+		if !c.Upload.Enabled() {
+			continue
+		}
+		info := dirInfo{name: c.Id}
+		if s, err := os.Stat(c.Upload.Dir); err == nil {
+			info.modTime = s.ModTime()
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) {
+	return dirInfo{name: "/"}, nil
+}
+
+type dirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (i dirInfo) Name() string       { return i.name }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (i dirInfo) ModTime() time.Time { return i.modTime }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() any           { return nil }
@@ -0,0 +1,67 @@
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"photofield/internal/collection"
+	"photofield/internal/image"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	collections := []collection.Collection{
+		{Id: "phone", Upload: collection.UploadConfig{Dir: filepath.Join(dir, "phone"), MaxSize: 8}},
+		{Id: "archive"},
+	}
+	// No supported extensions, so that nothing is indexed
+	source := &image.Source{}
+	handler := NewHandler("/webdav", func() []collection.Collection { return collections }, source)
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if method == "PROPFIND" {
+			r.Header.Set("Depth", "1")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("PROPFIND", "/webdav/", "")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("propfind root: expected %d, got %d", http.StatusMultiStatus, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "/webdav/phone/") || strings.Contains(w.Body.String(), "archive") {
+		t.Errorf("propfind root: expected only collections with uploads, got %s", w.Body.String())
+	}
+
+	if w := do("MKCOL", "/webdav/2024", ""); w.Code == http.StatusCreated {
+		t.Errorf("mkcol root: expected error, got %d", w.Code)
+	}
+	if w := do("MKCOL", "/webdav/phone/2024", ""); w.Code != http.StatusCreated {
+		t.Errorf("mkcol: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := do("PUT", "/webdav/phone/2024/a.txt", "1234"); w.Code != http.StatusCreated {
+		t.Errorf("put: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "phone", "2024", "a.txt")); err != nil || string(b) != "1234" {
+		t.Errorf("put: expected file to be written, got %q %v", b, err)
+	}
+	if w := do("PUT", "/webdav/phone/b.txt", "123456789"); w.Code == http.StatusCreated {
+		t.Errorf("put too large: expected error, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "phone", "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("put too large: expected file to be removed, got %v", err)
+	}
+	if w := do("DELETE", "/webdav/phone", ""); w.Code == http.StatusNoContent {
+		t.Errorf("delete collection: expected error, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "phone", "2024", "a.txt")); err != nil {
+		t.Errorf("delete collection: expected files to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/internal/logging"
+)
+
+var serverLog = logging.Module("server")
+
+const (
+	// Maximum number of events delivered in one request
+	batchSize = 100
+	// Maximum time an event waits for other events to be batched with
+	batchDelay = 1 * time.Second
+	// Events queued per hook before new events are dropped
+	queueSize = 10000
+)
+
+type Hook struct {
+	Url string `json:"url"`
+	// Event types delivered to the hook, all if empty
+	Events []image.EventType `json:"events"`
+	// Signs the body with HMAC-SHA256 in the X-Photofield-Signature header
+	Secret  string            `json:"secret"`
+	Headers map[string]string `json:"headers"`
+}
+
+type Config struct {
+	Hooks []Hook `json:"hooks"`
+	// Attempts to deliver a batch of events before it is dropped
+	MaxAttempts int `json:"max_attempts"`
+}
+
+func (config *Config) Validate() error {
+	for _, hook := range config.Hooks {
+		u, err := url.Parse(hook.Url)
+		if err != nil {
+			return fmt.Errorf("hook %s: %w", hook.Url, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("hook %s: unsupported scheme, use http or https", hook.Url)
+		}
+		for _, t := range hook.Events {
+			known := false
+			for _, k := range image.EventTypes {
+				if t == k {
+					known = true
+					break
+				}
+			}
+			if !known {
+				return fmt.Errorf("hook %s: unknown event %s", hook.Url, t)
+			}
+		}
+	}
+	return nil
+}
+
+type FileRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type File struct {
+	Id   image.ImageId `json:"file_id"`
+	Path string        `json:"path"`
+}
+
+type Event struct {
+	Type       image.EventType `json:"type"`
+	Time       time.Time       `json:"time"`
+	Id         image.ImageId   `json:"file_id,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Tag        string          `json:"tag,omitempty"`
+	FileRanges []FileRange     `json:"file_ranges,omitempty"`
+	FileCount  int             `json:"file_count,omitempty"`
+	Duplicates []File          `json:"duplicates,omitempty"`
+}
+
+type Payload struct {
+	Events []Event `json:"events"`
+}
+
+func newEvent(e image.Event) Event {
+	event := Event{
+		Type: e.Type,
+		Time: e.Time,
+		Id:   e.Id,
+		Path: e.Path,
+		Tag:  e.Tag,
+	}
+	if e.Ids != nil {
+		for _, r := range e.Ids.Slice() {
+			event.FileRanges = append(event.FileRanges, FileRange{From: r.Low, To: r.High})
+			event.FileCount += r.High - r.Low + 1
+		}
+	}
+	for _, d := range e.Duplicates {
+		event.Duplicates = append(event.Duplicates, File{Id: d.Id, Path: d.Path})
+	}
+	return event
+}
+
+type hook struct {
+	Hook
+	events      map[image.EventType]struct{}
+	queue       chan Event
+	client      *http.Client
+	maxAttempts int
+	// Delay before the first retry, doubled on every attempt
+	backoff time.Duration
+}
+
+// Dispatcher delivers events to the configured hooks in the background
+type Dispatcher struct {
+	hooks []*hook
+}
+
+func NewDispatcher(config Config) *Dispatcher {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	d := &Dispatcher{}
+	for _, h := range config.Hooks {
+		hk := &hook{
+			Hook:        h,
+			queue:       make(chan Event, queueSize),
+			client:      &http.Client{Timeout: 30 * time.Second},
+			maxAttempts: maxAttempts,
+			backoff:     1 * time.Second,
+		}
+		if len(h.Events) > 0 {
+			hk.events = make(map[image.EventType]struct{}, len(h.Events))
+			for _, t := range h.Events {
+				hk.events[t] = struct{}{}
+			}
+		}
+		d.hooks = append(d.hooks, hk)
+		go hk.run()
+	}
+	return d
+}
+
+// Send queues the event for delivery to all hooks subscribed to it without
+// blocking. Events are dropped if a hook is too far behind.
+func (d *Dispatcher) Send(e image.Event) {
+	var event *Event
+	for _, h := range d.hooks {
+		if h.events != nil {
+			if _, ok := h.events[e.Type]; !ok {
+				continue
+			}
+		}
+		if event == nil {
+			ev := newEvent(e)
+			event = &ev
+		}
+		select {
+		case h.queue <- *event:
+		default:
+			serverLog.Warn("webhook queue full, dropping event", "url", h.Url, "type", e.Type)
+		}
+	}
+}
+
+func (h *hook) run() {
+	batch := make([]Event, 0, batchSize)
+	for event := range h.queue {
+		batch = append(batch[:0], event)
+		timeout := time.After(batchDelay)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case event := <-h.queue:
+				batch = append(batch, event)
+			case <-timeout:
+				break collect
+			}
+		}
+		h.deliver(batch)
+	}
+}
+
+// deliver posts the events, retrying with exponential backoff on network
+// errors, server errors and rate limiting
+func (h *hook) deliver(events []Event) {
+	body, err := json.Marshal(Payload{Events: events})
+	if err != nil {
+		serverLog.Error("webhook unable to encode events", "url", h.Url, "err", err)
+		return
+	}
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= h.maxAttempts {
+			serverLog.Warn("webhook dropping events", "url", h.Url, "count", len(events), "attempts", attempt, "err", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (h *hook) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, h.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "photofield-webhook")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.Secret != "" {
+		req.Header.Set("X-Photofield-Signature", "sha256="+Sign(h.Secret, body))
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry = res.StatusCode >= 500 ||
+		res.StatusCode == http.StatusRequestTimeout ||
+		res.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %s", res.Status)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"photofield/internal/image"
+	"photofield/rangetree"
+)
+
+func TestDeliver(t *testing.T) {
+	var attempts int32
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Photofield-Signature") != "sha256="+Sign("secret", body) {
+			t.Errorf("invalid signature")
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("unable to decode payload: %s", err)
+		}
+		received <- p
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(Config{
+		Hooks: []Hook{{
+			Url:    server.URL,
+			Events: []image.EventType{image.EventTagAdded},
+			Secret: "secret",
+		}},
+	})
+	d.hooks[0].backoff = 10 * time.Millisecond
+
+	ids := rangetree.New()
+	ids.Add(rangetree.FromTo(3, 5))
+	ids.AddInt(9)
+	d.Send(image.Event{Type: image.EventFileIndexed, Id: 1, Path: "/a.jpg"})
+	d.Send(image.Event{Type: image.EventTagAdded, Tag: "fav", Ids: ids})
+
+	select {
+	case p := <-received:
+		if len(p.Events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(p.Events))
+		}
+		e := p.Events[0]
+		if e.Type != image.EventTagAdded || e.Tag != "fav" || e.FileCount != 4 || len(e.FileRanges) != 2 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		hook Hook
+		ok   bool
+	}{
+		{Hook{Url: "http://localhost:8123/api/webhook/photos"}, true},
+		{Hook{Url: "ftp://localhost"}, false},
+		{Hook{Url: "https://example.com", Events: []image.EventType{"file.unknown"}}, false},
+	}
+	for _, c := range cases {
+		config := Config{Hooks: []Hook{c.hook}}
+		if err := config.Validate(); (err == nil) != c.ok {
+			t.Errorf("%s: expected ok %v, got %v", c.hook.Url, c.ok, err)
+		}
+	}
+}
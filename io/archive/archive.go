@@ -0,0 +1,190 @@
+// Package archive reads files inside ZIP archives via virtual paths, where
+// the path of the archive is followed by the path of the entry, e.g.
+// /photos/export.zip/2021/IMG_0001.jpg
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Extensions of files read as ZIP archives
+var Extensions = []string{".zip", ".cbz"}
+
+// Entries larger than this are not read into memory
+const MaxEntrySize = 256 << 20
+
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// IsArchive reports whether the file is read as an archive based on its
+// extension
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range Extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split splits a virtual path into the path of the archive and the
+// slash-separated path of the entry within it, ok is false for regular
+// paths. The archive is not checked to exist.
+func Split(p string) (archive string, entry string, ok bool) {
+	s := strings.ReplaceAll(p, "\\", "/")
+	offset := 0
+	for {
+		i := strings.IndexByte(s[offset:], '/')
+		if i == -1 {
+			return "", "", false
+		}
+		end := offset + i
+		if end > 0 && IsArchive(s[:end]) && end+1 < len(s) {
+			return p[:end], s[end+1:], true
+		}
+		offset = end + 1
+	}
+}
+
+// IsVirtual reports whether the path refers to an entry in an archive file
+func IsVirtual(p string) bool {
+	archive, _, ok := Split(p)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(archive)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Join returns the virtual path of the entry in the archive
+func Join(archive string, entry string) string {
+	return archive + "/" + entry
+}
+
+// List returns the virtual paths of all the files in the archive with one
+// of the provided extensions, or all files if none are provided
+func List(archive string, extensions []string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var paths []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !fs.ValidPath(f.Name) {
+			continue
+		}
+		if strings.HasPrefix(path.Base(f.Name), "._") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		if len(extensions) > 0 {
+			name := strings.ToLower(f.Name)
+			found := false
+			for _, ext := range extensions {
+				if strings.HasSuffix(name, ext) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		paths = append(paths, Join(archive, f.Name))
+	}
+	return paths, nil
+}
+
+type entry struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (e entry) Close() error {
+	return nil
+}
+
+func (e entry) Stat() (fs.FileInfo, error) {
+	return e.info, nil
+}
+
+// Open opens the file at the path, which can either be a regular or a
+// virtual path. Archive entries are read into memory, as compressed
+// entries cannot be seeked.
+func Open(p string) (File, error) {
+	archive, name, ok := Split(p)
+	if !ok {
+		return os.Open(p)
+	}
+	if info, err := os.Stat(archive); err != nil || !info.Mode().IsRegular() {
+		return os.Open(p)
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: unwrap(err)}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrInvalid}
+	}
+	if info.Size() > MaxEntrySize {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrInvalid}
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: p, Err: err}
+	}
+	return entry{Reader: bytes.NewReader(b), info: info}, nil
+}
+
+// Stat returns the file info of the file at the path, which can either be
+// a regular or a virtual path
+func Stat(p string) (fs.FileInfo, error) {
+	archive, name, ok := Split(p)
+	if !ok {
+		return os.Stat(p)
+	}
+	if info, err := os.Stat(archive); err != nil || !info.Mode().IsRegular() {
+		return os.Stat(p)
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	info, err := fs.Stat(r, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: unwrap(err)}
+	}
+	return info, nil
+}
+
+// unwrap returns the underlying error of errors reported for the entry, so
+// that os.IsNotExist works with the error reported for the virtual path
+func unwrap(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		path    string
+		archive string
+		entry   string
+		ok      bool
+	}{
+		{"/photos/a.jpg", "", "", false},
+		{"/photos/export.zip", "", "", false},
+		{"/photos/export.zip/", "", "", false},
+		{"/photos/export.zip/2021/a.jpg", "/photos/export.zip", "2021/a.jpg", true},
+		{"/photos/Comic.CBZ/01.png", "/photos/Comic.CBZ", "01.png", true},
+	}
+	for _, c := range cases {
+		archive, entry, ok := Split(c.path)
+		if archive != c.archive || entry != c.entry || ok != c.ok {
+			t.Errorf("%s: expected %q %q %v, got %q %q %v", c.path, c.archive, c.entry, c.ok, archive, entry, ok)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "export.zip")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for _, name := range []string{"2021/a.jpg", "2021/notes.txt", "__MACOSX/2021/._a.jpg"} {
+		e, _ := w.Create(name)
+		e.Write([]byte("contents of " + name))
+	}
+	w.Close()
+	f.Close()
+
+	paths, err := List(p, []string{".jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != p+"/2021/a.jpg" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	r, err := Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Seek(12, io.SeekStart)
+	b, _ := io.ReadAll(r)
+	if string(b) != "2021/a.jpg" {
+		t.Errorf("unexpected contents %q", b)
+	}
+
+	if _, err := Stat(p + "/2021/b.jpg"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	if !IsVirtual(paths[0]) || IsVirtual(p) {
+		t.Errorf("expected only the entry to be virtual")
+	}
+}
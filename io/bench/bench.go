@@ -3,12 +3,14 @@ package bench
 import (
 	"context"
 	"fmt"
-	"log"
 	"math/rand"
+	"photofield/internal/logging"
 	"photofield/io"
 	"testing"
 )
 
+var decodeLog = logging.Module("decode")
+
 type Sample struct {
 	Id   io.ImageId
 	Path string
@@ -21,7 +23,7 @@ type sourceWithSamples struct {
 }
 
 func BenchmarkSources(seed int64, sources io.Sources, samples []Sample, count int) {
-	log.Printf("benchmark build samples")
+	decodeLog.Info("benchmark build samples")
 	workingSources := make([]sourceWithSamples, 0, len(sources))
 	for _, source := range sources {
 		workingSources = append(workingSources, sourceWithSamples{
@@ -29,7 +31,7 @@ func BenchmarkSources(seed int64, sources io.Sources, samples []Sample, count in
 			workingSamples(source, samples),
 		})
 	}
-	log.Printf("benchmark run")
+	decodeLog.Info("benchmark run")
 	maxLen := 20
 	for i := 0; i < count; i++ {
 		for _, s := range workingSources {
@@ -3,7 +3,9 @@ package cached
 import (
 	"context"
 	"fmt"
+	"photofield/internal/tracing"
 	"photofield/io"
+	"photofield/io/diskcache"
 	"photofield/io/ristretto"
 	"time"
 
@@ -13,8 +15,10 @@ import (
 )
 
 type Cached struct {
-	Source  io.Source
-	Cache   ristretto.Ristretto
+	Source io.Source
+	Cache  ristretto.Ristretto
+	// Second tier of images that were slow to load, nil if none
+	Disk    *diskcache.Cache
 	loading singleflight.Group
 }
 
@@ -47,7 +51,10 @@ func (c *Cached) Exists(ctx context.Context, id io.ImageId, path string) bool {
 }
 
 func (c *Cached) Get(ctx context.Context, id io.ImageId, path string) io.Result {
+	_, span := tracing.Start(ctx, "cache lookup", tracing.String("source", c.Source.Name()))
 	r := c.Cache.GetWithName(ctx, id, c.Source.Name())
+	span.SetAttributes(tracing.Bool("hit", r.Image != nil || r.Error != nil))
+	span.End()
 	// fmt.Printf("%v %v\n", r.Image, r.Error)
 	if r.Image != nil || r.Error != nil {
 		// fmt.Printf("%v cache found\n", id)
@@ -78,7 +85,27 @@ func (c *Cached) load(ctx context.Context, id io.ImageId, path string) io.Result
 	// fmt.Printf("%v cache load begin %v\n", id, key)
 	ri, _, _ := c.loading.Do(key, func() (interface{}, error) {
 		// fmt.Printf("%p %v %s %v cache get begin\n", c, c.Source, c.Source.Name(), id)
+		if c.Disk != nil {
+			_, span := tracing.Start(ctx, "disk cache lookup", tracing.String("source", c.Source.Name()))
+			r, ok := c.Disk.Get(id, c.Source.Name(), path)
+			span.SetAttributes(tracing.Bool("hit", ok))
+			span.End()
+			if ok {
+				c.Cache.SetWithName(ctx, id, c.Source.Name(), r)
+				r.FromCache = true
+				return r, nil
+			}
+		}
+		ctx, span := tracing.Start(ctx, "load", tracing.String("source", c.Source.Name()))
+		start := time.Now()
 		r := c.Source.Get(ctx, id, path)
+		elapsed := time.Since(start)
+		span.RecordError(r.Error)
+		span.End()
+		if c.Disk != nil {
+			// Stored in the background, as the image is not modified
+			go c.Disk.Set(id, c.Source.Name(), path, r, elapsed)
+		}
 		// fmt.Printf("%p %v %s %v cache get end\n", c, c.Source, c.Source.Name(), id)
 		c.Cache.SetWithName(ctx, id, c.Source.Name(), r)
 		// fmt.Printf("%v cache set\n", id)
@@ -91,3 +118,10 @@ func (c *Cached) load(ctx context.Context, id io.ImageId, path string) io.Result
 func (c *Cached) Set(ctx context.Context, id io.ImageId, path string, r io.Result) bool {
 	return false
 }
+
+func (c *Cached) Forget(id io.ImageId) {
+	c.Cache.DeleteWithName(id, c.Source.Name())
+	if c.Disk != nil {
+		c.Disk.Delete(id, c.Source.Name())
+	}
+}
@@ -44,6 +44,12 @@ type Configured struct {
 	NameStr string
 	Cost    Cost
 	Source  io.Source
+	// Measured latency replacing the cost once known, nil to only use
+	// the cost
+	Latency *Latency
+	// Original returns the size of the original of the image, required
+	// for measuring the latency
+	Original func(id io.ImageId) io.Size
 }
 
 func New(name string, cost Cost, source io.Source) *Configured {
@@ -75,6 +81,11 @@ func (c *Configured) Size(size io.Size) io.Size {
 }
 
 func (c *Configured) GetDurationEstimate(original io.Size) time.Duration {
+	if c.Latency != nil {
+		if d, ok := c.Latency.Get(original); ok {
+			return d
+		}
+	}
 	resized := c.Size(original)
 	t := c.Cost.Time
 	tomp := c.Cost.TimePerOriginalMegapixel
@@ -92,7 +103,16 @@ func (c *Configured) Exists(ctx context.Context, id io.ImageId, path string) boo
 }
 
 func (c *Configured) Get(ctx context.Context, id io.ImageId, path string) io.Result {
-	return c.Source.Get(ctx, id, path)
+	if c.Latency == nil {
+		return c.Source.Get(ctx, id, path)
+	}
+	start := time.Now()
+	r := c.Source.Get(ctx, id, path)
+	// Cached images and canceled requests say nothing about the source
+	if !r.FromCache && ctx.Err() == nil {
+		c.Latency.AddGet(c.Original(id), time.Since(start), r.Image != nil && r.Error == nil)
+	}
+	return r
 }
 
 func (c *Configured) Reader(ctx context.Context, id io.ImageId, path string, fn func(r goio.ReadSeeker, err error)) {
@@ -101,7 +121,28 @@ func (c *Configured) Reader(ctx context.Context, id io.ImageId, path string, fn
 		fn(nil, fmt.Errorf("reader not supported by %s", c.Source.Name()))
 		return
 	}
-	r.Reader(ctx, id, path, fn)
+	if c.Latency == nil {
+		r.Reader(ctx, id, path, fn)
+		return
+	}
+	start := time.Now()
+	hit := false
+	r.Reader(ctx, id, path, func(r goio.ReadSeeker, err error) {
+		hit = err == nil
+		fn(r, err)
+	})
+	if ctx.Err() == nil {
+		c.Latency.AddRead(time.Since(start), hit)
+	}
+}
+
+// GetReadEstimate returns the time usually taken to read an image, or
+// false if it is not measured
+func (c *Configured) GetReadEstimate() (time.Duration, bool) {
+	if c.Latency == nil {
+		return 0, false
+	}
+	return c.Latency.Read()
 }
 
 func (c *Configured) Decode(ctx context.Context, r goio.Reader) io.Result {
@@ -111,3 +152,9 @@ func (c *Configured) Decode(ctx context.Context, r goio.Reader) io.Result {
 	}
 	return d.Decode(ctx, r)
 }
+
+func (c *Configured) Forget(id io.ImageId) {
+	if f, ok := c.Source.(io.Forgetter); ok {
+		f.Forget(id)
+	}
+}
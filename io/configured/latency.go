@@ -0,0 +1,108 @@
+package configured
+
+import (
+	"math"
+	"math/bits"
+	"photofield/io"
+	"sync"
+	"time"
+)
+
+// Weight of the latest sample in the moving averages
+const latencyWeight = 0.1
+
+// Lowest share of hits assumed, so that sources missing all images still
+// have a finite latency
+const minHitRate = 0.01
+
+// Latency learns how long a source takes to return an image from the
+// times measured, separately for originals of different sizes, so that
+// sources are ordered by how they actually perform, e.g. on a slow NAS,
+// instead of by their configured cost
+type Latency struct {
+	// Samples of a size needed before they replace the configured cost
+	MinSamples int
+	// Samples older than this are not used, so that sources that were slow
+	// once are tried and measured again
+	MaxAge time.Duration
+
+	// Averages of getting images by the size bucket of their originals
+	gets sync.Map
+	// Average of reading images, e.g. thumbnails
+	reads average
+}
+
+type average struct {
+	mutex   sync.Mutex
+	samples int
+	last    time.Time
+	// Moving average of the nanoseconds taken by each attempt
+	duration float64
+	// Moving average of the share of attempts that returned an image
+	hits float64
+}
+
+func (a *average) add(d time.Duration, hit bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	h := 0.
+	if hit {
+		h = 1
+	}
+	if a.samples == 0 {
+		a.duration = float64(d)
+		a.hits = h
+	} else {
+		a.duration += latencyWeight * (float64(d) - a.duration)
+		a.hits += latencyWeight * (h - a.hits)
+	}
+	a.samples++
+	a.last = time.Now()
+}
+
+// perHit returns the average time per image returned, counting the time
+// spent on misses as well, or false if there are too few recent samples
+func (a *average) perHit(minSamples int, maxAge time.Duration) (time.Duration, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.samples == 0 || a.samples < minSamples {
+		return 0, false
+	}
+	if maxAge > 0 && time.Since(a.last) > maxAge {
+		return 0, false
+	}
+	return time.Duration(a.duration / math.Max(a.hits, minHitRate)), true
+}
+
+// sizeBucket returns the bucket of the size of the original, each twice
+// the area of the one before starting from a quarter megapixel
+func sizeBucket(original io.Size) int {
+	return bits.Len64(uint64(original.Area()) >> 18)
+}
+
+func (l *Latency) get(original io.Size) *average {
+	a, _ := l.gets.LoadOrStore(sizeBucket(original), &average{})
+	return a.(*average)
+}
+
+// AddGet adds the time taken to get an image with the original size
+func (l *Latency) AddGet(original io.Size, d time.Duration, hit bool) {
+	l.get(original).add(d, hit)
+}
+
+// Get returns the time usually taken to get an image with the original
+// size, or false if it is not known yet
+func (l *Latency) Get(original io.Size) (time.Duration, bool) {
+	return l.get(original).perHit(l.MinSamples, l.MaxAge)
+}
+
+// AddRead adds the time taken to read an image
+func (l *Latency) AddRead(d time.Duration, hit bool) {
+	l.reads.add(d, hit)
+}
+
+// Read returns the time usually taken to read an image, or false if it is
+// not known yet
+func (l *Latency) Read() (time.Duration, bool) {
+	return l.reads.perHit(l.MinSamples, l.MaxAge)
+}
@@ -0,0 +1,57 @@
+package configured
+
+import (
+	"photofield/io"
+	"photofield/io/goimage"
+	"testing"
+	"time"
+)
+
+func TestLatencyPerHit(t *testing.T) {
+	l := Latency{MinSamples: 2}
+	original := io.Size{X: 4000, Y: 3000}
+	l.AddGet(original, 10*time.Millisecond, true)
+	if _, ok := l.Get(original); ok {
+		t.Error("expected unknown latency with too few samples")
+	}
+	l.AddGet(original, 10*time.Millisecond, true)
+	if d, ok := l.Get(original); !ok || d != 10*time.Millisecond {
+		t.Errorf("expected 10ms, got %v %v", d, ok)
+	}
+	if _, ok := l.Get(io.Size{X: 100, Y: 100}); ok {
+		t.Error("expected unknown latency of other sizes")
+	}
+
+	// Misses make the source look slower per image returned
+	for i := 0; i < 50; i++ {
+		l.AddGet(original, 10*time.Millisecond, false)
+	}
+	if d, _ := l.Get(original); d < 100*time.Millisecond {
+		t.Errorf("expected misses to increase the latency, got %v", d)
+	}
+}
+
+func TestLatencyMaxAge(t *testing.T) {
+	l := Latency{MaxAge: time.Millisecond}
+	l.AddRead(time.Millisecond, true)
+	if _, ok := l.Read(); !ok {
+		t.Error("expected known latency")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := l.Read(); ok {
+		t.Error("expected outdated latency to be unknown")
+	}
+}
+
+func TestConfiguredDurationEstimate(t *testing.T) {
+	c := New("test", Cost{Time: Duration(time.Second)}, goimage.Image{})
+	c.Latency = &Latency{MinSamples: 1}
+	original := io.Size{X: 1000, Y: 1000}
+	if d := c.GetDurationEstimate(original); d != time.Second {
+		t.Errorf("expected configured cost, got %v", d)
+	}
+	c.Latency.AddGet(original, time.Millisecond, true)
+	if d := c.GetDurationEstimate(original); d != time.Millisecond {
+		t.Errorf("expected measured latency, got %v", d)
+	}
+}
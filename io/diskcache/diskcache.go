@@ -0,0 +1,270 @@
+package diskcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"photofield/internal/logging"
+	"photofield/io"
+	"photofield/io/archive"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var decodeLog = logging.Module("decode")
+
+// version is increased whenever the format of stored images changes, so
+// that images stored before are loaded again
+const version = 2
+
+// magic starts every stored image, so that other files are not decoded
+var magic = [4]byte{'p', 'f', 'i', 'c'}
+
+// Cache stores decoded images in a dir, so that images that are slow to
+// decode, e.g. large originals, load faster after a restart. Images are
+// stored uncompressed, as reading them is what has to be fast.
+type Cache struct {
+	dir     string
+	maxSize int64
+	// Images that loaded faster than this are not stored
+	minLoad time.Duration
+
+	mutex sync.Mutex
+	// Size of the stored images, -1 if not known yet
+	size int64
+}
+
+// header precedes the stored image, it is valid as long as the file it
+// was decoded from has the same size and modification time. It has a fixed
+// size, so that outdated images are recognized without decoding them.
+type header struct {
+	Magic       [4]byte
+	Version     uint32
+	FileSize    int64
+	FileModTime int64
+}
+
+func newHeader(info os.FileInfo) header {
+	return header{
+		Magic:       magic,
+		Version:     version,
+		FileSize:    info.Size(),
+		FileModTime: info.ModTime().UnixNano(),
+	}
+}
+
+// stored is an image as stored after the header
+type stored struct {
+	Orientation io.Orientation
+	YCbCr       *image.YCbCr
+	Gray        *image.Gray
+	RGBA        *image.RGBA
+}
+
+// New returns a cache storing images in the dir up to the max size in
+// bytes, keeping the ones that took at least the min load duration
+func New(dir string, maxSize int64, minLoad time.Duration) *Cache {
+	return &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		minLoad: minLoad,
+		size:    -1,
+	}
+}
+
+func (c *Cache) path(id io.ImageId, name string) string {
+	return filepath.Join(c.dir, name, fmt.Sprintf("%d.img", id))
+}
+
+// Get returns the image decoded by the named source from the file at the
+// path, false if it is not stored or the file changed since
+func (c *Cache) Get(id io.ImageId, name string, path string) (io.Result, bool) {
+	p := c.path(id, name)
+	f, err := os.Open(p)
+	if err != nil {
+		return io.Result{}, false
+	}
+	defer f.Close()
+
+	// Files inside archives are stated the same way as they are opened
+	info, err := archive.Stat(path)
+	if err != nil {
+		return io.Result{}, false
+	}
+	r := bufio.NewReader(f)
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil || h != newHeader(info) {
+		return io.Result{}, false
+	}
+	var s stored
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		decodeLog.Warn("unable to decode cached image", "path", p, "err", err)
+		return io.Result{}, false
+	}
+	var img image.Image
+	switch {
+	case s.YCbCr != nil:
+		img = s.YCbCr
+	case s.Gray != nil:
+		img = s.Gray
+	case s.RGBA != nil:
+		img = s.RGBA
+	default:
+		return io.Result{}, false
+	}
+
+	// Marked as recently used
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return io.Result{
+		Image:       img,
+		Orientation: s.Orientation,
+	}, true
+}
+
+// Set stores the image decoded by the named source from the file at the
+// path if it took long enough to load
+func (c *Cache) Set(id io.ImageId, name string, path string, r io.Result, elapsed time.Duration) {
+	if r.Image == nil || r.Error != nil || elapsed < c.minLoad {
+		return
+	}
+	info, err := archive.Stat(path)
+	if err != nil {
+		return
+	}
+	s := stored{
+		Orientation: r.Orientation,
+	}
+	switch img := r.Image.(type) {
+	case *image.YCbCr:
+		s.YCbCr = img
+	case *image.Gray:
+		s.Gray = img
+	case *image.RGBA:
+		s.RGBA = img
+	default:
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		s.RGBA = rgba
+	}
+
+	p := c.path(id, name)
+	n, err := write(p, newHeader(info), &s)
+	if err != nil {
+		decodeLog.Warn("unable to cache image", "path", p, "err", err)
+		return
+	}
+	c.add(n)
+}
+
+// write stores the header and the image at the path, returning the bytes
+// written
+func write(path string, h header, s *stored) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	// Per process, as instances can share the data dir
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	err = binary.Write(w, binary.LittleEndian, &h)
+	if err == nil {
+		err = gob.NewEncoder(w).Encode(s)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	var n int64
+	if err == nil {
+		var info os.FileInfo
+		info, err = f.Stat()
+		if err == nil {
+			n = info.Size()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, os.Rename(tmp, path)
+}
+
+// Delete removes the image decoded by the named source
+func (c *Cache) Delete(id io.ImageId, name string) {
+	err := os.Remove(c.path(id, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		decodeLog.Warn("unable to delete cached image", "id", id, "err", err)
+	}
+}
+
+// add accounts for the bytes stored, removing the least recently used
+// images once the cache is larger than the max size
+func (c *Cache) add(n int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.size >= 0 {
+		c.size += n
+		if c.size <= c.maxSize {
+			return
+		}
+	}
+	c.size = c.prune()
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// prune removes the least recently used images over the max size,
+// returning the size of the remaining ones
+func (c *Cache) prune() int64 {
+	var entries []entry
+	var size int64
+	filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".img") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		size += info.Size()
+		return nil
+	})
+	if size <= c.maxSize {
+		return size
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err == nil {
+			size -= e.size
+		}
+	}
+	return size
+}
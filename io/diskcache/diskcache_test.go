@@ -0,0 +1,137 @@
+package diskcache
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"photofield/io"
+	"testing"
+	"time"
+)
+
+func TestRoundtrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(filepath.Join(dir, "cache"), 1<<20, 10*time.Millisecond)
+
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420)
+	img.Y[5] = 42
+	r := io.Result{Image: img, Orientation: io.Rotate90}
+
+	c.Set(1, "original", path, r, time.Millisecond)
+	if _, ok := c.Get(1, "original", path); ok {
+		t.Error("expected fast load not to be stored")
+	}
+
+	c.Set(1, "original", path, r, time.Second)
+	got, ok := c.Get(1, "original", path)
+	if !ok {
+		t.Fatal("expected stored image")
+	}
+	ycbcr, ok := got.Image.(*image.YCbCr)
+	if !ok || ycbcr.Rect != img.Rect || ycbcr.Y[5] != 42 || got.Orientation != io.Rotate90 {
+		t.Errorf("expected stored image, got %v", got)
+	}
+	if _, ok := c.Get(1, "thumbnail", path); ok {
+		t.Error("expected images of other sources to be separate")
+	}
+
+	// Outdated once the file changes
+	if err := os.WriteFile(path, []byte("edited original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(1, "original", path); ok {
+		t.Error("expected image of changed file to be outdated")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	c := New(filepath.Join(dir, "cache"), 25000, 0)
+	for id := io.ImageId(1); id <= 3; id++ {
+		c.Set(id, "original", path, io.Result{Image: img}, time.Second)
+		// Distinct modification times to remove the oldest first
+		past := time.Now().Add(time.Duration(id-10) * time.Minute)
+		os.Chtimes(c.path(id, "original"), past, past)
+	}
+	if _, ok := c.Get(1, "original", path); ok {
+		t.Error("expected least recently used image to be removed")
+	}
+	if _, ok := c.Get(3, "original", path); !ok {
+		t.Error("expected most recently used image to be kept")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "export.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("2021/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("original"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	path := filepath.Join(zipPath, "2021", "photo.jpg")
+	c := New(filepath.Join(dir, "cache"), 1<<20, 0)
+	c.Set(1, "original", path, io.Result{Image: image.NewGray(image.Rect(0, 0, 4, 4))}, time.Second)
+	if _, ok := c.Get(1, "original", path); !ok {
+		t.Error("expected image of file inside archive to be stored")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(filepath.Join(dir, "cache"), 1<<20, 0)
+	c.Set(1, "original", path, io.Result{Image: image.NewGray(image.Rect(0, 0, 4, 4))}, time.Second)
+	p := c.path(1, "original")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other files, e.g. stored in the previous format without a header
+	if err := os.WriteFile(p, b[binary.Size(header{}):], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(1, "original", path); ok {
+		t.Error("expected image without header to be ignored")
+	}
+
+	// Truncated while being written by another instance
+	if err := os.WriteFile(p, b[:len(b)-8], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(1, "original", path); ok {
+		t.Error("expected truncated image to be ignored")
+	}
+
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(1, "original", path); !ok {
+		t.Error("expected stored image")
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"context"
 	"fmt"
 	"image"
-	"log"
 	"os/exec"
+	"photofield/internal/logging"
 	"photofield/io"
+	"photofield/io/archive"
 	"strconv"
 	"time"
 
@@ -34,6 +35,8 @@ var (
 	ErrMissingBinary = fmt.Errorf("ffmpeg binary not found")
 )
 
+var decodeLog = logging.Module("decode")
+
 type FFmpeg struct {
 	Path   string
 	Width  int
@@ -44,10 +47,10 @@ type FFmpeg struct {
 func FindPath() string {
 	path, err := exec.LookPath("ffmpeg")
 	if err != nil {
-		log.Printf("ffmpeg not found: %s\n", err.Error())
+		decodeLog.Warn("ffmpeg not found", "err", err)
 		return ""
 	}
-	log.Printf("ffmpeg found at %s\n", path)
+	decodeLog.Info("ffmpeg found", "path", path)
 	return path
 }
 
@@ -123,12 +126,25 @@ func (f FFmpeg) Get(ctx context.Context, id io.ImageId, path string) io.Result {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	input := path
+	var stdin goio.Reader
+	if archive.IsVirtual(path) {
+		// Piped as ffmpeg cannot read files inside archives
+		file, err := archive.Open(path)
+		if err != nil {
+			return io.Result{Error: err}
+		}
+		defer file.Close()
+		input = "pipe:0"
+		stdin = file
+	}
+
 	cmd := exec.CommandContext(
 		ctx,
 		f.Path,
 		"-hide_banner",
 		"-loglevel", "error",
-		"-i", path,
+		"-i", input,
 		"-vframes", "1",
 		"-vf", f.FilterGraph(),
 		// "-q:v", "2",
@@ -140,6 +156,8 @@ func (f FFmpeg) Get(ctx context.Context, id io.ImageId, path string) io.Result {
 		"-",
 	)
 
+	cmd.Stdin = stdin
+
 	// println(cmd.String())
 	b, err := cmd.Output()
 	err = formatErr(err, "ffmpeg")
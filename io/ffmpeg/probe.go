@@ -0,0 +1,220 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"photofield/io/archive"
+	"strconv"
+	"strings"
+	"time"
+
+	goio "io"
+)
+
+// Probed is the size, rotation and format of the first video stream of a
+// file, along with the chapters of the file
+type Probed struct {
+	// Size of the stream as stored, before rotating it
+	Width  int
+	Height int
+	// Clockwise rotation in degrees the stream is displayed with, one of
+	// 0, 90, 180 or 270
+	Rotation int
+	// Duration of the file, zero if unknown
+	Duration time.Duration
+	// Name of the codec of the stream, e.g. h264
+	Codec string
+	// Average frames per second, zero if unknown
+	FrameRate float64
+	Chapters  []Chapter
+}
+
+// Chapter is a titled part of a video
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// ProbePath returns the path of ffprobe next to the ffmpeg binary, empty
+// if there is none
+func ProbePath(ffmpegPath string) string {
+	if ffmpegPath == "" {
+		return ""
+	}
+	name := "ffprobe" + strings.TrimPrefix(filepath.Base(ffmpegPath), "ffmpeg")
+	path := filepath.Join(filepath.Dir(ffmpegPath), name)
+	if _, err := exec.LookPath(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Probe reads the size, rotation and format of the first video stream and
+// the chapters of the file with ffprobe
+func Probe(ctx context.Context, ffprobePath string, path string) (Probed, error) {
+	b, err := runProbe(
+		ctx, ffprobePath, path,
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,codec_name,avg_frame_rate,r_frame_rate:stream_tags=rotate:stream_side_data=rotation:format=duration",
+		"-show_chapters",
+	)
+	if err != nil {
+		return Probed{}, err
+	}
+	return parseProbe(b)
+}
+
+// ProbeDuration reads the duration of a file of any kind, e.g. audio, with
+// ffprobe, zero if unknown
+func ProbeDuration(ctx context.Context, ffprobePath string, path string) (time.Duration, error) {
+	b, err := runProbe(
+		ctx, ffprobePath, path,
+		"-show_entries", "format=duration",
+	)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return 0, fmt.Errorf("unable to parse ffprobe output: %w", err)
+	}
+	return parseSeconds(out.Format.Duration), nil
+}
+
+// runProbe runs ffprobe with the args on the file and returns its JSON
+// output
+func runProbe(ctx context.Context, ffprobePath string, path string, args ...string) ([]byte, error) {
+	if ffprobePath == "" {
+		return nil, ErrMissingBinary
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	input := path
+	var stdin goio.Reader
+	if archive.IsVirtual(path) {
+		// Piped as ffprobe cannot read files inside archives
+		file, err := archive.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = "pipe:0"
+		stdin = file
+	}
+
+	args = append([]string{"-v", "error"}, args...)
+	args = append(args, "-of", "json", input)
+	cmd := exec.CommandContext(ctx, ffprobePath, args...)
+	cmd.Stdin = stdin
+
+	b, err := cmd.Output()
+	err = formatErr(err, "ffprobe")
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func parseProbe(b []byte) (Probed, error) {
+	var out struct {
+		Streams []struct {
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			CodecName    string `json:"codec_name"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+			Tags         struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideData []struct {
+				Rotation *float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Chapters []struct {
+			StartTime string `json:"start_time"`
+			EndTime   string `json:"end_time"`
+			Tags      struct {
+				Title string `json:"title"`
+			} `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return Probed{}, fmt.Errorf("unable to parse ffprobe output: %w", err)
+	}
+	if len(out.Streams) == 0 {
+		return Probed{}, fmt.Errorf("no video stream")
+	}
+	s := out.Streams[0]
+	p := Probed{
+		Width:  s.Width,
+		Height: s.Height,
+		Codec:  s.CodecName,
+	}
+	// Newer versions report the display matrix, which rotates
+	// counterclockwise, older ones the rotate tag
+	rotation := 0.
+	if r, err := strconv.Atoi(s.Tags.Rotate); err == nil {
+		rotation = float64(r)
+	}
+	for _, sd := range s.SideData {
+		if sd.Rotation != nil {
+			rotation = -*sd.Rotation
+		}
+	}
+	p.Rotation = ((int(math.Round(rotation/90))*90)%360 + 360) % 360
+	p.Duration = parseSeconds(out.Format.Duration)
+	// The average rate is unknown for some containers, in which case the
+	// lowest rate all timestamps can be represented with is the best guess
+	p.FrameRate = parseRate(s.AvgFrameRate)
+	if p.FrameRate == 0 {
+		p.FrameRate = parseRate(s.RFrameRate)
+	}
+	for _, c := range out.Chapters {
+		p.Chapters = append(p.Chapters, Chapter{
+			Start: parseSeconds(c.StartTime),
+			End:   parseSeconds(c.EndTime),
+			Title: c.Tags.Title,
+		})
+	}
+	return p, nil
+}
+
+// parseSeconds parses a decimal number of seconds, zero if invalid
+func parseSeconds(str string) time.Duration {
+	d, err := strconv.ParseFloat(str, 64)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return time.Duration(d * float64(time.Second))
+}
+
+// parseRate parses a rational frame rate like 30000/1001, zero if unknown
+func parseRate(str string) float64 {
+	num, den, found := strings.Cut(str, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d := 1.
+	if found {
+		d, err = strconv.ParseFloat(den, 64)
+		if err != nil || d == 0 {
+			return 0
+		}
+	}
+	return n / d
+}
@@ -0,0 +1,70 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	p, err := parseProbe([]byte(`{
+		"programs": [],
+		"streams": [{
+			"codec_name": "hevc",
+			"width": 1920,
+			"height": 1080,
+			"r_frame_rate": "30/1",
+			"avg_frame_rate": "30000/1001",
+			"side_data_list": [{"rotation": -90}]
+		}],
+		"chapters": [
+			{"id": 0, "start_time": "0.000000", "end_time": "62.500000", "tags": {"title": "Intro"}},
+			{"id": 1, "start_time": "62.500000", "end_time": "301.000000", "tags": {}}
+		],
+		"format": {"duration": "301.000000"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 1920 || p.Height != 1080 || p.Rotation != 90 {
+		t.Errorf("expected 1920x1080 rotated 90, got %dx%d rotated %d", p.Width, p.Height, p.Rotation)
+	}
+	if p.Codec != "hevc" {
+		t.Errorf("expected codec hevc, got %q", p.Codec)
+	}
+	if p.FrameRate < 29.97 || p.FrameRate > 29.98 {
+		t.Errorf("expected frame rate 29.97, got %f", p.FrameRate)
+	}
+	if p.Duration != 301*time.Second {
+		t.Errorf("expected duration 301s, got %s", p.Duration)
+	}
+	expected := []Chapter{
+		{Start: 0, End: 62500 * time.Millisecond, Title: "Intro"},
+		{Start: 62500 * time.Millisecond, End: 301 * time.Second},
+	}
+	if len(p.Chapters) != len(expected) {
+		t.Fatalf("expected %d chapters, got %d", len(expected), len(p.Chapters))
+	}
+	for i, c := range expected {
+		if p.Chapters[i] != c {
+			t.Errorf("chapter %d: expected %+v, got %+v", i, c, p.Chapters[i])
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		str  string
+		rate float64
+	}{
+		{"25/1", 25},
+		{"24", 24},
+		{"0/0", 0},
+		{"", 0},
+		{"x/1", 0},
+	}
+	for _, c := range cases {
+		if rate := parseRate(c.str); rate != c.rate {
+			t.Errorf("%q: expected %f, got %f", c.str, c.rate, rate)
+		}
+	}
+}
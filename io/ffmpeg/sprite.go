@@ -0,0 +1,164 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"os/exec"
+	"photofield/io/archive"
+	"time"
+
+	goio "io"
+)
+
+const (
+	// Width of each frame of a sprite sheet
+	SpriteFrameWidth = 160
+	// Frames of a sprite sheet per row
+	SpriteCols = 10
+	// Maximum number of frames of a sprite sheet, longer videos have frames
+	// further apart
+	SpriteMaxFrames = 100
+)
+
+// Sprite is the layout of a sheet of frames of a video taken at regular
+// intervals, in rows of columns from the top left
+type Sprite struct {
+	Duration    time.Duration
+	Interval    time.Duration
+	Count       int
+	Cols        int
+	Rows        int
+	FrameWidth  int
+	FrameHeight int
+}
+
+// NewSprite returns the layout of a sprite sheet of a video of the duration
+// with frames at least a second apart
+func NewSprite(duration time.Duration) Sprite {
+	seconds := math.Ceil(duration.Seconds() / SpriteMaxFrames)
+	if seconds < 1 {
+		seconds = 1
+	}
+	s := Sprite{
+		Duration: duration,
+		Interval: time.Duration(seconds) * time.Second,
+	}
+	s.Count = int(math.Ceil(float64(duration) / float64(s.Interval)))
+	if s.Count < 1 {
+		s.Count = 1
+	}
+	s.Cols = SpriteCols
+	if s.Count < s.Cols {
+		s.Cols = s.Count
+	}
+	s.Rows = (s.Count + s.Cols - 1) / s.Cols
+	return s
+}
+
+// Frame returns the bounds of the frame in the sheet
+func (s Sprite) Frame(i int) image.Rectangle {
+	x := (i % s.Cols) * s.FrameWidth
+	y := (i / s.Cols) * s.FrameHeight
+	return image.Rect(x, y, x+s.FrameWidth, y+s.FrameHeight)
+}
+
+func formatVTTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// WriteVTT writes the WebVTT thumbnail track of the sprite, with each cue
+// pointing to its frame in the sheet at the URL using a media fragment
+func (s Sprite) WriteVTT(w goio.Writer, url string) error {
+	if _, err := fmt.Fprint(w, "WEBVTT\n"); err != nil {
+		return err
+	}
+	for i := 0; i < s.Count; i++ {
+		start := time.Duration(i) * s.Interval
+		end := start + s.Interval
+		if end > s.Duration {
+			end = s.Duration
+		}
+		f := s.Frame(i)
+		_, err := fmt.Fprintf(w, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			formatVTTTime(start), formatVTTTime(end), url,
+			f.Min.X, f.Min.Y, f.Dx(), f.Dy(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateSprite decodes the keyframes of the video nearest to each frame
+// of the sprite into a sheet, setting the size of the frames of the sprite
+func GenerateSprite(ctx context.Context, ffmpegPath string, path string, sprite *Sprite) (image.Image, error) {
+	if ffmpegPath == "" {
+		return nil, ErrMissingBinary
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	input := path
+	var stdin goio.Reader
+	if archive.IsVirtual(path) {
+		// Piped as ffmpeg cannot read files inside archives
+		file, err := archive.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = "pipe:0"
+		stdin = file
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		ffmpegPath,
+		"-hide_banner",
+		"-loglevel", "error",
+		// Only keyframes are decoded, which is plenty for seeking previews
+		"-skip_frame", "nokey",
+		"-i", input,
+		"-vf", fmt.Sprintf(
+			"fps=1000/%d,scale=%d:-2,tile=%dx%d",
+			sprite.Interval.Milliseconds(), SpriteFrameWidth, sprite.Cols, sprite.Rows,
+		),
+		"-frames:v", "1",
+		"-c:v", "pam",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-an",
+		"-",
+	)
+	cmd.Stdin = stdin
+
+	b, err := cmd.Output()
+	err = formatErr(err, "ffmpeg")
+	if err != nil {
+		return nil, err
+	}
+
+	pam, err := readPAM(b)
+	if err != nil {
+		return nil, err
+	}
+	if pam.Depth != 4 || pam.MaxValue != 255 {
+		return nil, fmt.Errorf("unexpected depth %d or max value %d", pam.Depth, pam.MaxValue)
+	}
+	if pam.Width <= 0 || pam.Height <= 0 {
+		return nil, fmt.Errorf("unexpected size %d x %d", pam.Width, pam.Height)
+	}
+
+	sprite.FrameWidth = pam.Width / sprite.Cols
+	sprite.FrameHeight = pam.Height / sprite.Rows
+	return &image.RGBA{
+		Pix:    pam.Bytes,
+		Stride: 4 * pam.Width,
+		Rect:   image.Rect(0, 0, pam.Width, pam.Height),
+	}, nil
+}
@@ -0,0 +1,54 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSprite(t *testing.T) {
+	cases := []struct {
+		duration time.Duration
+		interval time.Duration
+		count    int
+		cols     int
+		rows     int
+	}{
+		{500 * time.Millisecond, time.Second, 1, 1, 1},
+		{7500 * time.Millisecond, time.Second, 8, 8, 1},
+		{95 * time.Second, time.Second, 95, 10, 10},
+		{10 * time.Minute, 6 * time.Second, 100, 10, 10},
+		{601 * time.Second, 7 * time.Second, 86, 10, 9},
+	}
+	for _, c := range cases {
+		s := NewSprite(c.duration)
+		if s.Interval != c.interval || s.Count != c.count || s.Cols != c.cols || s.Rows != c.rows {
+			t.Errorf("%s: expected %s %d %dx%d, got %s %d %dx%d", c.duration,
+				c.interval, c.count, c.cols, c.rows,
+				s.Interval, s.Count, s.Cols, s.Rows,
+			)
+		}
+	}
+}
+
+func TestWriteVTT(t *testing.T) {
+	s := NewSprite(12500 * time.Millisecond)
+	s.FrameWidth = 160
+	s.FrameHeight = 90
+
+	var b strings.Builder
+	if err := s.WriteVTT(&b, "scrub.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	vtt := b.String()
+	for _, expected := range []string{
+		"WEBVTT\n",
+		"\n00:00:00.000 --> 00:00:01.000\nscrub.jpg#xywh=0,0,160,90\n",
+		"\n00:00:11.000 --> 00:00:12.000\nscrub.jpg#xywh=160,90,160,90\n",
+		"\n00:00:12.000 --> 00:00:12.500\nscrub.jpg#xywh=320,90,160,90\n",
+	} {
+		if !strings.Contains(vtt, expected) {
+			t.Errorf("expected %q in\n%s", expected, vtt)
+		}
+	}
+}
@@ -87,3 +87,9 @@ func (f *Filtered) Decode(ctx context.Context, r goio.Reader) io.Result {
 	}
 	return d.Decode(ctx, r)
 }
+
+func (f *Filtered) Forget(id io.ImageId) {
+	if forgetter, ok := f.Source.(io.Forgetter); ok {
+		forgetter.Forget(id)
+	}
+}
@@ -3,8 +3,8 @@ package goexif
 import (
 	"bytes"
 	"context"
-	"os"
 	"photofield/io"
+	"photofield/io/archive"
 	"strconv"
 	"time"
 
@@ -98,7 +98,7 @@ func (e Exif) Set(ctx context.Context, id io.ImageId, path string, r io.Result)
 }
 
 func load(path string) ([]byte, io.Orientation, error) {
-	f, err := os.Open(path)
+	f, err := archive.Open(path)
 	if err != nil {
 		return nil, io.Normal, err
 	}
@@ -3,22 +3,29 @@ package goimage
 import (
 	"context"
 	"image"
-	"os"
+	"path/filepath"
+	"photofield/internal/codec"
+	"photofield/internal/icc"
+	"photofield/internal/tracing"
 	"photofield/io"
+	"photofield/io/archive"
+	"strings"
 	"time"
 
 	goio "io"
 
 	_ "image/jpeg"
 	_ "image/png"
-
-	"golang.org/x/image/draw"
 )
 
 type Image struct {
 	Width   int
 	Height  int
 	Decoder func(goio.Reader) (image.Image, error)
+	// Profile the colors of decoded originals are converted to according
+	// to their embedded profile, sRGB assumed if there is none. Left as
+	// decoded if nil.
+	Color *icc.Profile
 }
 
 func (o Image) Name() string {
@@ -51,25 +58,41 @@ func (o Image) GetDurationEstimate(size io.Size) time.Duration {
 	return 30 * time.Nanosecond * time.Duration(size.Area())
 }
 
+// GetMemoryEstimate returns the bytes taken by the decoded original and
+// the resized image, if it is resized
+func (o Image) GetMemoryEstimate(size io.Size) int64 {
+	memory := 4 * size.Area()
+	if o.Resized() {
+		memory += 4 * o.Size(size).Area()
+	}
+	return memory
+}
+
 func (o Image) Rotate() bool {
 	return true
 }
 
-func resize(img image.Image, maxWidth, maxHeight int) image.Image {
-	origW := img.Bounds().Size().X
-	origH := img.Bounds().Size().Y
-	aspectRatio := float64(origW) / float64(origH)
-
-	desiredW := maxWidth
-	desiredH := maxHeight
-	if float64(desiredW)/float64(desiredH) > aspectRatio {
-		desiredW = int(float64(desiredH) * aspectRatio)
-	} else {
-		desiredH = int(float64(desiredW) / aspectRatio)
+// convert converts the colors of the image decoded from the file to the
+// profile, leaving them as they are if the embedded profile is not
+// supported
+func convert(img image.Image, path string, to *icc.Profile) (image.Image, error) {
+	from := icc.SRGB()
+	data, err := icc.Read(path)
+	if err != nil {
+		return img, nil
+	}
+	if data != nil {
+		from, err = icc.Parse(data)
+		if err != nil {
+			return img, nil
+		}
 	}
-	resized := image.NewRGBA(image.Rect(0, 0, desiredW, desiredH))
-	draw.ApproxBiLinear.Scale(resized, resized.Bounds(), img, img.Bounds(), draw.Src, nil)
-	return resized
+	return icc.ConvertImage(img, from, to)
+}
+
+func isJpeg(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
 }
 
 func (o Image) Exists(ctx context.Context, id io.ImageId, path string) bool {
@@ -77,7 +100,10 @@ func (o Image) Exists(ctx context.Context, id io.ImageId, path string) bool {
 }
 
 func (o Image) Get(ctx context.Context, id io.ImageId, path string) io.Result {
-	f, err := os.Open(path)
+	_, span := tracing.Start(ctx, "decode", tracing.String("path", path))
+	defer span.End()
+
+	f, err := archive.Open(path)
 	if err != nil {
 		return io.Result{Error: err}
 	}
@@ -86,12 +112,17 @@ func (o Image) Get(ctx context.Context, id io.ImageId, path string) io.Result {
 	var img image.Image
 	if o.Decoder != nil {
 		img, err = o.Decoder(f)
+	} else if codec.ScaledJpeg && o.Resized() && isJpeg(path) {
+		img, err = codec.DecodeJpegScaled(f, image.Point{X: o.Width, Y: o.Height})
 	} else {
 		img, _, err = image.Decode(f)
 	}
 
 	if o.Resized() && err == nil {
-		img = resize(img, o.Width, o.Height)
+		img = codec.Resize(img, o.Width, o.Height)
+	}
+	if o.Color != nil && err == nil {
+		img, err = convert(img, path, o.Color)
 	}
 
 	return io.Result{
@@ -102,7 +133,7 @@ func (o Image) Get(ctx context.Context, id io.ImageId, path string) io.Result {
 }
 
 func (o Image) Reader(ctx context.Context, id io.ImageId, path string, fn func(r goio.ReadSeeker, err error)) {
-	f, err := os.Open(path)
+	f, err := archive.Open(path)
 	if err != nil {
 		fn(nil, err)
 		return
@@ -115,7 +146,7 @@ func (o Image) Reader(ctx context.Context, id io.ImageId, path string, fn func(r
 func (o Image) Decode(ctx context.Context, r goio.Reader) io.Result {
 	img, _, err := image.Decode(r)
 	if o.Resized() && err == nil {
-		img = resize(img, o.Width, o.Height)
+		img = codec.Resize(img, o.Width, o.Height)
 	}
 	return io.Result{
 		Image:       img,
@@ -0,0 +1,104 @@
+// Package gpano reads the photo sphere metadata of 360° photos, stored as
+// GPano properties in the XMP metadata by most cameras and apps taking
+// them, see https://developers.google.com/streetview/spherical-metadata
+package gpano
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Equirectangular is the projection of 360° photos mapping longitude and
+// latitude linearly to x and y
+const Equirectangular = "equirectangular"
+
+// Size of the start of the file searched for the XMP metadata
+const scanSize = 256 << 10
+
+// Projection of a 360° photo, with the photo possibly covering only a part
+// of the full sphere
+type Projection struct {
+	Type string
+	// Size of the full panorama the photo is a part of
+	FullWidth  int
+	FullHeight int
+	// Area of the full panorama covered by the photo
+	CroppedLeft   int
+	CroppedTop    int
+	CroppedWidth  int
+	CroppedHeight int
+	// Compass heading in degrees of the center of the full panorama
+	PoseHeading float64
+}
+
+var (
+	attributeRegexp = regexp.MustCompile(`GPano:(\w+)\s*=\s*["']([^"']*)["']`)
+	elementRegexp   = regexp.MustCompile(`<GPano:(\w+)>([^<]*)</GPano:\w+>`)
+)
+
+// Read reads the projection from the XMP metadata at the start of the file,
+// false if there is none
+func Read(r io.Reader) (Projection, bool, error) {
+	b, err := io.ReadAll(io.LimitReader(r, scanSize))
+	if err != nil {
+		return Projection{}, false, err
+	}
+	start := bytes.Index(b, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return Projection{}, false, nil
+	}
+	b = b[start:]
+	if end := bytes.Index(b, []byte("</x:xmpmeta>")); end >= 0 {
+		b = b[:end]
+	}
+	p, ok := Parse(b)
+	return p, ok, nil
+}
+
+// Parse parses the projection from the XMP metadata, with the properties
+// either as attributes or elements, false if there is none
+func Parse(xmp []byte) (Projection, bool) {
+	props := make(map[string]string)
+	for _, m := range attributeRegexp.FindAllSubmatch(xmp, -1) {
+		props[string(m[1])] = string(m[2])
+	}
+	for _, m := range elementRegexp.FindAllSubmatch(xmp, -1) {
+		props[string(m[1])] = string(bytes.TrimSpace(m[2]))
+	}
+	p := Projection{
+		Type: props["ProjectionType"],
+	}
+	if p.Type == "" {
+		return Projection{}, false
+	}
+	integer := func(key string) int {
+		v, _ := strconv.ParseFloat(props[key], 64)
+		return int(v)
+	}
+	p.FullWidth = integer("FullPanoWidthPixels")
+	p.FullHeight = integer("FullPanoHeightPixels")
+	p.CroppedLeft = integer("CroppedAreaLeftPixels")
+	p.CroppedTop = integer("CroppedAreaTopPixels")
+	p.CroppedWidth = integer("CroppedAreaImageWidthPixels")
+	p.CroppedHeight = integer("CroppedAreaImageHeightPixels")
+	p.PoseHeading, _ = strconv.ParseFloat(props["PoseHeadingDegrees"], 64)
+	return p, true
+}
+
+// Normalize fills in the sizes missing from the metadata for a photo of
+// the size, assuming it covers the full sphere if the cropped area is
+// unknown
+func (p *Projection) Normalize(width, height int) {
+	if p.CroppedWidth <= 0 || p.CroppedHeight <= 0 {
+		p.CroppedWidth = width
+		p.CroppedHeight = height
+	}
+	if p.FullWidth <= 0 {
+		p.FullWidth = p.CroppedWidth
+	}
+	if p.FullHeight <= 0 {
+		p.FullHeight = p.FullWidth / 2
+	}
+}
@@ -0,0 +1,110 @@
+package gpano
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	cases := []struct {
+		name  string
+		file  string
+		found bool
+		p     Projection
+	}{
+		{
+			"attributes",
+			"\xff\xd8\xff\xe1http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta xmlns:x='adobe:ns:meta/'><rdf:Description " +
+				`GPano:ProjectionType="equirectangular" GPano:FullPanoWidthPixels="8000" GPano:FullPanoHeightPixels="4000" ` +
+				`GPano:CroppedAreaLeftPixels="0" GPano:CroppedAreaTopPixels="500" GPano:CroppedAreaImageWidthPixels="8000" ` +
+				`GPano:CroppedAreaImageHeightPixels="3000" GPano:PoseHeadingDegrees="12.5"/></x:xmpmeta>`,
+			true,
+			Projection{Type: Equirectangular, FullWidth: 8000, FullHeight: 4000, CroppedTop: 500, CroppedWidth: 8000, CroppedHeight: 3000, PoseHeading: 12.5},
+		},
+		{
+			"elements",
+			"\xff\xd8<x:xmpmeta><rdf:Description>" +
+				"<GPano:ProjectionType>equirectangular</GPano:ProjectionType>" +
+				"<GPano:FullPanoWidthPixels> 5376 </GPano:FullPanoWidthPixels>" +
+				"</rdf:Description></x:xmpmeta>",
+			true,
+			Projection{Type: Equirectangular, FullWidth: 5376},
+		},
+		{
+			"outside of the xmp",
+			"\xff\xd8<x:xmpmeta></x:xmpmeta>GPano:ProjectionType=\"equirectangular\"",
+			false,
+			Projection{},
+		},
+		{
+			"no xmp",
+			"\xff\xd8\xff\xd9",
+			false,
+			Projection{},
+		},
+	}
+	for _, c := range cases {
+		p, found, err := Read(bytes.NewReader([]byte(c.file)))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if found != c.found || p != c.p {
+			t.Errorf("%s: expected %v %+v, got %v %+v", c.name, c.found, c.p, found, p)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	p := Projection{Type: Equirectangular}
+	p.Normalize(6000, 3000)
+	expected := Projection{Type: Equirectangular, FullWidth: 6000, FullHeight: 3000, CroppedWidth: 6000, CroppedHeight: 3000}
+	if p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestPerspective(t *testing.T) {
+	// Red increasing with longitude and green with latitude from the top
+	src := image.NewRGBA(image.Rect(0, 0, 256, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 256; x++ {
+			i := src.PixOffset(x, y)
+			src.Pix[i+0] = uint8(x)
+			src.Pix[i+1] = uint8(y * 2)
+			src.Pix[i+3] = 0xff
+		}
+	}
+	p := Projection{Type: Equirectangular}
+
+	cases := []struct {
+		view View
+		r, g float64
+	}{
+		{View{Yaw: 0, Pitch: 0, Fov: 90}, 128, 128},
+		{View{Yaw: 90, Pitch: 0, Fov: 90}, 192, 128},
+		{View{Yaw: -45, Pitch: 0, Fov: 60}, 96, 128},
+		{View{Yaw: 0, Pitch: 45, Fov: 90}, 128, 64},
+	}
+	for _, c := range cases {
+		dst := Perspective(src, p, c.view, 3, 3)
+		i := dst.PixOffset(1, 1)
+		r, g := float64(dst.Pix[i]), float64(dst.Pix[i+1])
+		if math.Abs(r-c.r) > 1.5 || math.Abs(g-c.g) > 2.5 {
+			t.Errorf("%+v: expected center %.0f %.0f, got %.0f %.0f", c.view, c.r, c.g, r, g)
+		}
+	}
+
+	// Only the front half of the sphere is covered by the photo
+	half := Projection{Type: Equirectangular, FullWidth: 512, FullHeight: 256, CroppedLeft: 128, CroppedTop: 64, CroppedWidth: 256, CroppedHeight: 128}
+	front := Perspective(src, half, View{Fov: 60}, 3, 3)
+	if a := front.Pix[front.PixOffset(1, 1)+3]; a != 0xff {
+		t.Errorf("expected covered front, got alpha %d", a)
+	}
+	back := Perspective(src, half, View{Yaw: 180, Fov: 60}, 3, 3)
+	if a := back.Pix[back.PixOffset(1, 1)+3]; a != 0 {
+		t.Errorf("expected uncovered back, got alpha %d", a)
+	}
+}
@@ -0,0 +1,119 @@
+package gpano
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// View is the direction and field of view of a flat perspective view of a
+// 360° photo, all in degrees
+type View struct {
+	// Horizontal angle right of the center of the full panorama
+	Yaw float64
+	// Vertical angle above the horizon
+	Pitch float64
+	// Horizontal field of view
+	Fov float64
+}
+
+// Perspective renders the view of the equirectangular photo with the
+// projection into a flat image of the size, as a regular camera would see
+// it. Parts of the view not covered by the photo are left black.
+func Perspective(src image.Image, p Projection, view View, width, height int) *image.RGBA {
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		b := src.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	srcW := rgba.Rect.Dx()
+	srcH := rgba.Rect.Dy()
+	p.Normalize(srcW, srcH)
+
+	// Photo pixels per pixel of the full panorama
+	scaleX := float64(srcW) / float64(p.CroppedWidth)
+	scaleY := float64(srcH) / float64(p.CroppedHeight)
+	// Horizontally wrapping around if the photo covers the full circle
+	wrap := p.CroppedWidth >= p.FullWidth
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	focal := float64(width) / 2 / math.Tan(view.Fov*math.Pi/360)
+	sinYaw, cosYaw := math.Sincos(view.Yaw * math.Pi / 180)
+	sinPitch, cosPitch := math.Sincos(view.Pitch * math.Pi / 180)
+
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			// Ray through the pixel, looking down z with y up
+			x := float64(i) + 0.5 - float64(width)/2
+			y := float64(height)/2 - float64(j) - 0.5
+			z := focal
+
+			// Pitch up around x, then yaw right around y
+			y, z = y*cosPitch+z*sinPitch, z*cosPitch-y*sinPitch
+			x, z = x*cosYaw+z*sinYaw, z*cosYaw-x*sinYaw
+
+			lon := math.Atan2(x, z)
+			lat := math.Atan2(y, math.Hypot(x, z))
+
+			px := (lon/(2*math.Pi)+0.5)*float64(p.FullWidth) - float64(p.CroppedLeft)
+			py := (0.5-lat/math.Pi)*float64(p.FullHeight) - float64(p.CroppedTop)
+			sampleBilinear(dst, i, j, rgba, px*scaleX, py*scaleY, wrap)
+		}
+	}
+	return dst
+}
+
+// sampleBilinear sets the pixel of the destination to the color of the
+// source at the position, interpolated between the nearest pixels
+func sampleBilinear(dst *image.RGBA, i, j int, src *image.RGBA, x, y float64, wrap bool) {
+	w := src.Rect.Dx()
+	h := src.Rect.Dy()
+	x -= 0.5
+	y -= 0.5
+	if y < -0.5 || y > float64(h)-0.5 {
+		return
+	}
+	if !wrap && (x < -0.5 || x > float64(w)-0.5) {
+		return
+	}
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	fx := x - x0
+	fy := y - y0
+
+	clampX := func(x int) int {
+		if wrap {
+			return ((x % w) + w) % w
+		}
+		if x < 0 {
+			return 0
+		}
+		if x >= w {
+			return w - 1
+		}
+		return x
+	}
+	clampY := func(y int) int {
+		if y < 0 {
+			return 0
+		}
+		if y >= h {
+			return h - 1
+		}
+		return y
+	}
+	xa, xb := clampX(int(x0)), clampX(int(x0)+1)
+	ya, yb := clampY(int(y0)), clampY(int(y0)+1)
+
+	d := dst.PixOffset(i, j)
+	a := src.PixOffset(src.Rect.Min.X+xa, src.Rect.Min.Y+ya)
+	b := src.PixOffset(src.Rect.Min.X+xb, src.Rect.Min.Y+ya)
+	c := src.PixOffset(src.Rect.Min.X+xa, src.Rect.Min.Y+yb)
+	e := src.PixOffset(src.Rect.Min.X+xb, src.Rect.Min.Y+yb)
+	for k := 0; k < 4; k++ {
+		top := float64(src.Pix[a+k])*(1-fx) + float64(src.Pix[b+k])*fx
+		bottom := float64(src.Pix[c+k])*(1-fx) + float64(src.Pix[e+k])*fx
+		dst.Pix[d+k] = uint8(top*(1-fy) + bottom*fy + 0.5)
+	}
+}
@@ -122,6 +122,12 @@ type Decoder interface {
 	Decode(ctx context.Context, r io.Reader) Result
 }
 
+// MemoryEstimator is implemented by sources that take more memory to get
+// an image than the image itself, e.g. by decoding the original first
+type MemoryEstimator interface {
+	GetMemoryEstimate(original Size) int64
+}
+
 type ReadDecoder interface {
 	Reader
 	Decoder
@@ -204,3 +210,9 @@ func (costs SourceCosts) SortSize() {
 		return a.SizeCost < b.SizeCost
 	})
 }
+
+// Forgetter drops anything a source cached about an image, e.g. after the
+// file was replaced
+type Forgetter interface {
+	Forget(id ImageId)
+}
@@ -0,0 +1,178 @@
+// Package iptc reads the keywords from the IPTC metadata embedded in JPEG
+// photos, stored in the Photoshop resources of the APP13 segment
+package iptc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	markerSOI   = 0xd8
+	markerSOS   = 0xda
+	markerEOI   = 0xd9
+	markerAPP13 = 0xed
+
+	// Photoshop image resource with the IPTC-NAA record
+	resourceIPTC = 0x0404
+
+	recordApplication = 2
+	datasetKeywords   = 25
+)
+
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+var errTruncated = errors.New("truncated iptc data")
+
+// ReadKeywords reads the keywords from the IPTC metadata of the JPEG,
+// nil if it is not a JPEG or has none
+func ReadKeywords(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return nil, nil
+	}
+	if soi[0] != 0xff || soi[1] != markerSOI {
+		return nil, nil
+	}
+	var keywords []string
+	for {
+		marker, err := nextMarker(br)
+		if err == io.EOF {
+			return keywords, nil
+		}
+		if err != nil {
+			return keywords, err
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return keywords, nil
+		}
+		if marker >= 0xd0 && marker <= 0xd7 || marker == 0x01 {
+			// Standalone markers without a length
+			continue
+		}
+		var size uint16
+		if err := binary.Read(br, binary.BigEndian, &size); err != nil {
+			return keywords, nil
+		}
+		if size < 2 {
+			return keywords, errTruncated
+		}
+		if marker != markerAPP13 {
+			if _, err := br.Discard(int(size) - 2); err != nil {
+				return keywords, nil
+			}
+			continue
+		}
+		data := make([]byte, size-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return keywords, nil
+		}
+		if !bytes.HasPrefix(data, photoshopHeader) {
+			continue
+		}
+		k, err := parseResources(data[len(photoshopHeader):])
+		keywords = append(keywords, k...)
+		if err != nil {
+			return keywords, err
+		}
+	}
+}
+
+// nextMarker skips to the next marker and returns it
+func nextMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xff {
+		return 0, errors.New("invalid jpeg marker")
+	}
+	// Markers can be padded with any number of 0xff
+	for b == 0xff {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// parseResources parses the keywords of the IPTC resource among the
+// Photoshop image resources
+func parseResources(data []byte) ([]string, error) {
+	var keywords []string
+	for len(data) >= 4 && string(data[:4]) == "8BIM" {
+		data = data[4:]
+		if len(data) < 3 {
+			return keywords, errTruncated
+		}
+		id := binary.BigEndian.Uint16(data)
+		data = data[2:]
+		// Pascal string name, padded to an even size
+		nameSize := 1 + int(data[0])
+		if nameSize%2 == 1 {
+			nameSize++
+		}
+		if len(data) < nameSize+4 {
+			return keywords, errTruncated
+		}
+		data = data[nameSize:]
+		size := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < size {
+			return keywords, errTruncated
+		}
+		if id == resourceIPTC {
+			k, err := parseRecords(data[:size])
+			keywords = append(keywords, k...)
+			if err != nil {
+				return keywords, err
+			}
+		}
+		if size%2 == 1 {
+			size++
+		}
+		if size > len(data) {
+			break
+		}
+		data = data[size:]
+	}
+	return keywords, nil
+}
+
+// parseRecords parses the keywords among the IPTC datasets
+func parseRecords(data []byte) ([]string, error) {
+	var keywords []string
+	for len(data) >= 5 && data[0] == 0x1c {
+		record := data[1]
+		dataset := data[2]
+		size := int(binary.BigEndian.Uint16(data[3:]))
+		data = data[5:]
+		if size&0x8000 != 0 {
+			// Extended dataset with the size of the size first
+			n := size & 0x7fff
+			if n > 4 || len(data) < n {
+				return keywords, errTruncated
+			}
+			size = 0
+			for _, b := range data[:n] {
+				size = size<<8 | int(b)
+			}
+			data = data[n:]
+		}
+		if len(data) < size {
+			return keywords, errTruncated
+		}
+		if record == recordApplication && dataset == datasetKeywords {
+			if k := strings.TrimSpace(string(data[:size])); k != "" {
+				keywords = append(keywords, k)
+			}
+		}
+		data = data[size:]
+	}
+	return keywords, nil
+}
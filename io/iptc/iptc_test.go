@@ -0,0 +1,106 @@
+package iptc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func dataset(record, dataset byte, value string) []byte {
+	b := []byte{0x1c, record, dataset, 0, 0}
+	binary.BigEndian.PutUint16(b[3:], uint16(len(value)))
+	return append(b, value...)
+}
+
+func jpeg(segments ...[]byte) []byte {
+	b := []byte{0xff, 0xd8}
+	for _, s := range segments {
+		b = append(b, s...)
+	}
+	return append(b, 0xff, 0xda, 0, 2)
+}
+
+func segment(marker byte, data []byte) []byte {
+	b := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(data)+2))
+	return append(b, data...)
+}
+
+func photoshop(resources ...[]byte) []byte {
+	b := append([]byte{}, photoshopHeader...)
+	for _, r := range resources {
+		b = append(b, r...)
+	}
+	return b
+}
+
+func resource(id uint16, data []byte) []byte {
+	b := []byte("8BIM")
+	b = binary.BigEndian.AppendUint16(b, id)
+	// Empty name padded to an even size
+	b = append(b, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestReadKeywords(t *testing.T) {
+	records := bytes.Join([][]byte{
+		dataset(1, 90, "\x1b%G"),
+		dataset(2, 5, "Title"),
+		dataset(2, 25, "Beach"),
+		dataset(2, 25, "Sunset"),
+		dataset(2, 25, "Café"),
+	}, nil)
+	cases := []struct {
+		name     string
+		file     []byte
+		keywords []string
+	}{
+		{
+			"keywords",
+			jpeg(
+				segment(0xe0, []byte("JFIF\x00")),
+				segment(0xed, photoshop(resource(0x0425, make([]byte, 16)), resource(0x0404, records))),
+			),
+			[]string{"Beach", "Sunset", "Café"},
+		},
+		{
+			"odd size",
+			jpeg(segment(0xed, photoshop(resource(0x0404, dataset(2, 25, "Odd")), resource(0x0404, dataset(2, 25, "Next"))))),
+			[]string{"Odd", "Next"},
+		},
+		{
+			"no iptc",
+			jpeg(segment(0xe1, []byte("Exif\x00\x00"))),
+			nil,
+		},
+		{
+			"not a jpeg",
+			[]byte("\x89PNG\r\n\x1a\n"),
+			nil,
+		},
+	}
+	for _, c := range cases {
+		keywords, err := ReadKeywords(bytes.NewReader(c.file))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(keywords, c.keywords) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.keywords, keywords)
+		}
+	}
+}
+
+func TestReadKeywordsTruncated(t *testing.T) {
+	records := dataset(2, 25, "Beach")
+	file := jpeg(segment(0xed, photoshop(resource(0x0404, records[:len(records)-2]))))
+	if _, err := ReadKeywords(bytes.NewReader(file)); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,137 @@
+package limited
+
+import (
+	"context"
+	"fmt"
+	"photofield/internal/tracing"
+	"photofield/io"
+	"time"
+
+	goio "io"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Bytes per pixel of decoded images, as most are decoded to RGBA
+const bytesPerPixel = 4
+
+// Limiter limits the number of images decoded at the same time and the
+// memory they are estimated to take, so that many large originals
+// requested at once wait for each other instead of exhausting the memory
+type Limiter struct {
+	decodes *semaphore.Weighted
+	memory  *semaphore.Weighted
+	budget  int64
+}
+
+// NewLimiter returns a limiter of the concurrent decodes and the memory
+// they take in bytes, either of which is unlimited if 0
+func NewLimiter(concurrency int, budget int64) *Limiter {
+	l := &Limiter{
+		budget: budget,
+	}
+	if concurrency > 0 {
+		l.decodes = semaphore.NewWeighted(int64(concurrency))
+	}
+	if budget > 0 {
+		l.memory = semaphore.NewWeighted(budget)
+	}
+	return l
+}
+
+// Acquire waits until an image taking the memory in bytes can be decoded,
+// returning a function to call once it is done. Images larger than the
+// budget are decoded on their own.
+func (l *Limiter) Acquire(ctx context.Context, memory int64) (release func(), err error) {
+	if l.memory != nil && memory > l.budget {
+		memory = l.budget
+	}
+	if l.decodes != nil {
+		if err := l.decodes.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	if l.memory != nil {
+		if err := l.memory.Acquire(ctx, memory); err != nil {
+			if l.decodes != nil {
+				l.decodes.Release(1)
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		if l.memory != nil {
+			l.memory.Release(memory)
+		}
+		if l.decodes != nil {
+			l.decodes.Release(1)
+		}
+	}, nil
+}
+
+// Limited gets the images of the source within the limits of the limiter
+type Limited struct {
+	Source  io.Source
+	Limiter *Limiter
+	// Original returns the size of the original of the image, from which
+	// the memory of decoding it is estimated
+	Original func(id io.ImageId) io.Size
+}
+
+func (l *Limited) Name() string {
+	return l.Source.Name()
+}
+
+func (l *Limited) DisplayName() string {
+	return l.Source.DisplayName()
+}
+
+func (l *Limited) Ext() string {
+	return l.Source.Ext()
+}
+
+func (l *Limited) Size(size io.Size) io.Size {
+	return l.Source.Size(size)
+}
+
+func (l *Limited) GetDurationEstimate(size io.Size) time.Duration {
+	return l.Source.GetDurationEstimate(size)
+}
+
+func (l *Limited) Rotate() bool {
+	return l.Source.Rotate()
+}
+
+func (l *Limited) Exists(ctx context.Context, id io.ImageId, path string) bool {
+	return l.Source.Exists(ctx, id, path)
+}
+
+// memory returns the estimated memory in bytes taken by getting the image
+func (l *Limited) memory(id io.ImageId) int64 {
+	original := l.Original(id)
+	if e, ok := l.Source.(io.MemoryEstimator); ok {
+		return e.GetMemoryEstimate(original)
+	}
+	return bytesPerPixel * l.Source.Size(original).Area()
+}
+
+func (l *Limited) Get(ctx context.Context, id io.ImageId, path string) io.Result {
+	memory := l.memory(id)
+	_, span := tracing.Start(ctx, "wait decode", tracing.Int64("memory", memory))
+	release, err := l.Limiter.Acquire(ctx, memory)
+	span.End()
+	if err != nil {
+		return io.Result{Error: err}
+	}
+	defer release()
+	return l.Source.Get(ctx, id, path)
+}
+
+func (l *Limited) Reader(ctx context.Context, id io.ImageId, path string, fn func(r goio.ReadSeeker, err error)) {
+	r, ok := l.Source.(io.Reader)
+	if !ok {
+		fn(nil, fmt.Errorf("reader not supported by %s", l.Source.Name()))
+		return
+	}
+	r.Reader(ctx, id, path, fn)
+}
@@ -0,0 +1,58 @@
+package limited
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquired returns true if the memory can be acquired before a short
+// timeout, releasing it right away
+func acquired(l *Limiter, memory int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release, err := l.Acquire(ctx, memory)
+	if err != nil {
+		return false
+	}
+	release()
+	return true
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := NewLimiter(2, 0)
+	a, err := l.Acquire(context.Background(), 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Acquire(context.Background(), 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acquired(l, 1) {
+		t.Error("expected third decode to wait")
+	}
+	a()
+	if !acquired(l, 1) {
+		t.Error("expected decode after release")
+	}
+	b()
+}
+
+func TestLimiterMemory(t *testing.T) {
+	l := NewLimiter(0, 100)
+	a, err := l.Acquire(context.Background(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired(l, 40) {
+		t.Error("expected decode within the budget")
+	}
+	if acquired(l, 60) {
+		t.Error("expected decode over the budget to wait")
+	}
+	a()
+	if !acquired(l, 1000) {
+		t.Error("expected decode larger than the budget on its own")
+	}
+}
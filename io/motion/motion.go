@@ -0,0 +1,176 @@
+// Package motion finds the video embedded in motion photos, which store a
+// short MP4 clip after the still image in the same file, e.g. Google Motion
+// Photos, Pixel Micro Videos and Samsung Motion Photos
+package motion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Size of the start and end of the file searched for the markers of
+// motion photos, before the whole file is scanned for the video
+const markerScanSize = 64 << 10
+
+// Size of the chunks the file is scanned for the video in
+const chunkSize = 1 << 20
+
+// Markers in the XMP metadata at the start of the file or in the trailer
+// at the end of the file of motion photos
+var markers = [][]byte{
+	[]byte("MotionPhoto"),
+	[]byte("MicroVideo"),
+}
+
+// Major brands of the file type box of embedded videos
+var brands = map[string]bool{
+	"isom": true,
+	"iso2": true,
+	"iso4": true,
+	"iso5": true,
+	"iso6": true,
+	"mp41": true,
+	"mp42": true,
+	"avc1": true,
+	"qt  ": true,
+}
+
+// Video is the location of the embedded video in the file
+type Video struct {
+	Offset int64
+	Length int64
+}
+
+// Find returns the location of the video embedded in the file of the size,
+// false if it is not a motion photo
+func Find(r io.ReaderAt, size int64) (Video, bool, error) {
+	found, err := hasMarker(r, size)
+	if err != nil || !found {
+		return Video{}, false, err
+	}
+
+	// Chunks overlap so that boxes across chunk boundaries are found. The
+	// start is skipped, as the file itself may be an MP4 based format like
+	// HEIC with a file type box of its own.
+	overlap := int64(16)
+	buf := make([]byte, chunkSize+overlap)
+	for start := int64(8); start < size; start += chunkSize {
+		n, err := r.ReadAt(buf[:min64(int64(len(buf)), size-start)], start)
+		if err != nil && err != io.EOF {
+			return Video{}, false, err
+		}
+		chunk := buf[:n]
+		for i := 0; ; {
+			j := bytes.Index(chunk[i:], []byte("ftyp"))
+			if j < 0 {
+				break
+			}
+			i += j
+			offset := start + int64(i) - 4
+			if v, ok := checkVideo(r, size, offset); ok {
+				return v, true, nil
+			}
+			i++
+		}
+	}
+	return Video{}, false, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// hasMarker reports whether the start or the end of the file mention
+// motion photos
+func hasMarker(r io.ReaderAt, size int64) (bool, error) {
+	regions := []int64{0}
+	if size > markerScanSize {
+		regions = append(regions, size-markerScanSize)
+	}
+	buf := make([]byte, min64(size, markerScanSize))
+	for _, offset := range regions {
+		n, err := r.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, m := range markers {
+			if bytes.Contains(buf[:n], m) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkVideo returns the video starting with a file type box at the
+// offset, along with the boxes following it up to the first one that is
+// not valid. Videos without a movie box cannot be played and are not
+// returned.
+func checkVideo(r io.ReaderAt, size int64, offset int64) (Video, bool) {
+	if offset < 0 {
+		return Video{}, false
+	}
+	var header [16]byte
+	if _, err := r.ReadAt(header[:12], offset); err != nil {
+		return Video{}, false
+	}
+	ftypSize := binary.BigEndian.Uint32(header[0:4])
+	if ftypSize < 16 || ftypSize > 256 || ftypSize%4 != 0 {
+		return Video{}, false
+	}
+	if !brands[string(header[8:12])] {
+		return Video{}, false
+	}
+
+	end := offset
+	movie := false
+	for end+8 <= size {
+		if _, err := r.ReadAt(header[:8], end); err != nil {
+			break
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := header[4:8]
+		if !isBoxType(boxType) {
+			break
+		}
+		switch boxSize {
+		case 0:
+			// Extends to the end of the file
+			boxSize = size - end
+		case 1:
+			if _, err := r.ReadAt(header[8:16], end+8); err != nil {
+				return Video{}, false
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if boxSize < 8 || end+boxSize > size {
+			break
+		}
+		if string(boxType) == "moov" {
+			movie = true
+		}
+		end += boxSize
+	}
+	if !movie {
+		return Video{}, false
+	}
+	return Video{
+		Offset: offset,
+		Length: end - offset,
+	}, true
+}
+
+// isBoxType reports whether the type of a box is made of printable ASCII
+// characters, as all the standard ones are
+func isBoxType(t []byte) bool {
+	for _, c := range t {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
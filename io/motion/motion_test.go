@@ -0,0 +1,103 @@
+package motion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func box(t string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], t)
+	return append(b, payload...)
+}
+
+func mp4(brand string) []byte {
+	var b []byte
+	b = append(b, box("ftyp", []byte(brand+"\x00\x00\x00\x00"+brand))...)
+	b = append(b, box("moov", make([]byte, 32))...)
+	b = append(b, box("mdat", bytes.Repeat([]byte{0xab}, 100))...)
+	return b
+}
+
+func TestFind(t *testing.T) {
+	jpeg := append([]byte{0xff, 0xd8}, []byte(`<x:xmpmeta GCamera:MotionPhoto="1">`)...)
+	jpeg = append(jpeg, bytes.Repeat([]byte{0x12}, 1000)...)
+	jpeg = append(jpeg, 0xff, 0xd9)
+	video := mp4("mp42")
+	trailer := []byte{0x00, 0x00, 0xff, 0xff, 'S', 'E', 'F', 'T'}
+
+	cases := []struct {
+		name  string
+		file  []byte
+		found bool
+		video Video
+	}{
+		{
+			"motion photo",
+			append(append([]byte{}, jpeg...), video...),
+			true,
+			Video{Offset: int64(len(jpeg)), Length: int64(len(video))},
+		},
+		{
+			"motion photo with trailer",
+			append(append(append([]byte{}, jpeg...), video...), trailer...),
+			true,
+			Video{Offset: int64(len(jpeg)), Length: int64(len(video))},
+		},
+		{
+			"marker without video",
+			jpeg,
+			false,
+			Video{},
+		},
+		{
+			"video without marker",
+			append(append([]byte{0xff, 0xd8, 0xff, 0xd9}, bytes.Repeat([]byte{0x12}, 1000)...), video...),
+			false,
+			Video{},
+		},
+		{
+			"video without movie box",
+			append(append([]byte{}, jpeg...), box("ftyp", []byte("mp42\x00\x00\x00\x00mp42"))...),
+			false,
+			Video{},
+		},
+		{
+			"heic without video",
+			append(box("ftyp", []byte("heic\x00\x00\x00\x00heicmif1")), []byte("MotionPhoto")...),
+			false,
+			Video{},
+		},
+	}
+	for _, c := range cases {
+		v, found, err := Find(bytes.NewReader(c.file), int64(len(c.file)))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if found != c.found || v != c.video {
+			t.Errorf("%s: expected %v %+v, got %v %+v", c.name, c.found, c.video, found, v)
+		}
+	}
+}
+
+func TestFindAcrossChunks(t *testing.T) {
+	// Video starting right at a chunk boundary, beyond the size the
+	// markers are searched in
+	file := append([]byte{0xff, 0xd8}, []byte("MicroVideo")...)
+	file = append(file, make([]byte, chunkSize+6-len(file))...)
+	offset := len(file)
+	video := mp4("isom")
+	file = append(file, video...)
+
+	v, found, err := Find(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Video{Offset: int64(offset), Length: int64(len(video))}
+	if !found || v != expected {
+		t.Errorf("expected %+v, got %v %+v", expected, found, v)
+	}
+}
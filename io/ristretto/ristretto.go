@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"image"
-	"log"
+	"photofield/internal/logging"
 	"photofield/internal/metrics"
 	"photofield/io"
 	"reflect"
@@ -18,6 +18,8 @@ import (
 	"github.com/dgraph-io/ristretto/z"
 )
 
+var decodeLog = logging.Module("decode")
+
 type Ristretto struct {
 	cache *drist.Cache
 }
@@ -126,6 +128,13 @@ func (r Ristretto) SetWithName(ctx context.Context, id io.ImageId, name string,
 	return r.cache.SetWithTTL(idn, v, 0, 10*time.Minute)
 }
 
+func (r Ristretto) DeleteWithName(id io.ImageId, name string) {
+	r.cache.Del(IdWithName{
+		Id:   id,
+		Name: name,
+	})
+}
+
 func (r Ristretto) Set(ctx context.Context, id io.ImageId, path string, v io.Result) bool {
 	return r.cache.SetWithTTL(uint32(id), v, 0, 10*time.Minute)
 }
@@ -173,7 +182,7 @@ func cost(value interface{}) int64 {
 		return 1
 
 	default:
-		log.Printf("Unable to compute cost, unsupported image format %v", reflect.TypeOf(img))
+		decodeLog.Warn("unable to compute cost, unsupported image format", "type", reflect.TypeOf(img))
 		// Fallback image size (10MB)
 		return 10000000
 	}
@@ -4,14 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"embed"
 	"fmt"
 	"image/jpeg"
-	"log"
+	"io/fs"
 	"net/http"
 	"path/filepath"
+	"photofield/internal/deepzoom"
+	"photofield/internal/logging"
 	"photofield/internal/metrics"
+	"photofield/internal/tracing"
 	"photofield/io"
+	"photofield/io/ffmpeg"
+	"sync"
 	"time"
 
 	goio "io"
@@ -26,12 +30,20 @@ import (
 
 var (
 	ErrNotFound = fmt.Errorf("image not found")
+	ErrClosed   = fmt.Errorf("thumbnail database closed")
 )
 
+var dbLog = logging.Module("db")
+
 type Source struct {
 	path    string
 	pool    *sqlitex.Pool
 	pending chan Thumb
+	// Held for reading while queueing writes, so that none are queued after
+	// the pending ones were committed on close
+	closeMutex sync.RWMutex
+	closed     bool
+	done       chan struct{}
 }
 
 type Thumb struct {
@@ -47,6 +59,10 @@ func (s *Source) DisplayName() string {
 	return "Internal thumbnail"
 }
 
+func (s *Source) Path() string {
+	return s.path
+}
+
 func (s *Source) Ext() string {
 	return ".jpg"
 }
@@ -64,7 +80,7 @@ func (s *Source) Size(size io.Size) io.Size {
 	return io.Size{X: 256, Y: 256}.Fit(size, io.FitInside)
 }
 
-func New(path string, migrations embed.FS) *Source {
+func New(path string, migrations fs.FS) *Source {
 
 	var err error
 
@@ -89,6 +105,7 @@ func New(path string, migrations embed.FS) *Source {
 	}
 
 	source.pending = make(chan Thumb, 100)
+	source.done = make(chan struct{})
 	go source.writePending()
 
 	return &source
@@ -144,10 +161,10 @@ func (s *Source) init() {
 	}
 }
 
-func (s *Source) migrate(migrations embed.FS) {
+func (s *Source) migrate(migrations fs.FS) {
 	dbsource, err := httpfs.New(http.FS(migrations), "db/migrations-thumbs")
 	if err != nil {
-		log.Fatalf("failed to create migrate source: %v", err)
+		dbLog.Fatal("failed to create migrate source", "err", err)
 	}
 	url := fmt.Sprintf("sqlite://%v", filepath.ToSlash(s.path))
 	m, err := migrate.NewWithSourceInstance(
@@ -156,7 +173,7 @@ func (s *Source) migrate(migrations embed.FS) {
 		url,
 	)
 	if err != nil {
-		log.Fatalf("failed to create migrate instance for %s: %v", s.path, err)
+		dbLog.Fatal("failed to create migrate instance", "path", s.path, "err", err)
 	}
 
 	version, dirty, err := m.Version()
@@ -172,7 +189,7 @@ func (s *Source) migrate(migrations embed.FS) {
 	if dirty {
 		dirtystr = " (dirty)"
 	}
-	log.Printf("thumbs database version %v%s, migrating if needed", version, dirtystr)
+	dbLog.Info("thumbs database migrating if needed", "version", version, "dirty", dirtystr)
 
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
@@ -188,23 +205,51 @@ func (s *Source) migrate(migrations embed.FS) {
 	}
 }
 
+func (s *Source) queue(t Thumb) error {
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.pending <- t
+	return nil
+}
+
 func (s *Source) Write(id uint32, bytes []byte) error {
-	s.pending <- Thumb{
+	return s.queue(Thumb{
 		Id:    id,
 		Bytes: bytes,
-	}
-	return nil
+	})
 }
 
 func (s *Source) Delete(id uint32) error {
-	s.pending <- Thumb{
+	return s.queue(Thumb{
 		Id:    id,
 		Bytes: nil,
+	})
+}
+
+// Close commits the pending writes and truncates the write-ahead log.
+// Reads keep working until the process exits, so that work finishing in
+// the background does not fail.
+func (s *Source) Close() error {
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		return nil
 	}
-	return nil
+	s.closed = true
+	close(s.pending)
+	s.closeMutex.Unlock()
+	<-s.done
+
+	c := s.pool.Get(context.Background())
+	defer s.pool.Put(c)
+	return sqlitex.ExecuteTransient(c, "PRAGMA wal_checkpoint(TRUNCATE);", nil)
 }
 
 func (s *Source) writePending() {
+	defer close(s.done)
 	c := s.pool.Get(context.Background())
 	defer s.pool.Put(c)
 
@@ -217,6 +262,14 @@ func (s *Source) writePending() {
 		DELETE FROM thumb256 WHERE id = ?;`)
 	defer delete.Reset()
 
+	deleteTiles := c.Prep(`
+		DELETE FROM deepzoom_tile WHERE id = ?;`)
+	defer deleteTiles.Reset()
+
+	deleteSprite := c.Prep(`
+		DELETE FROM video_sprite WHERE id = ?;`)
+	defer deleteSprite.Reset()
+
 	lastCommit := time.Now()
 	lastOptimize := time.Time{}
 	inTransaction := false
@@ -237,16 +290,31 @@ func (s *Source) writePending() {
 			delete.BindInt64(1, int64(t.Id))
 			_, err := delete.Step()
 			if err != nil {
-				log.Printf("Unable to delete image %d: %s\n", t.Id, err)
+				dbLog.Error("unable to delete image", "id", t.Id, "err", err)
 			}
 			delete.Reset()
+
+			// Tiles are generated from the same file as the thumbnail
+			deleteTiles.BindInt64(1, int64(t.Id))
+			_, err = deleteTiles.Step()
+			if err != nil {
+				dbLog.Error("unable to delete tiles of image", "id", t.Id, "err", err)
+			}
+			deleteTiles.Reset()
+
+			deleteSprite.BindInt64(1, int64(t.Id))
+			_, err = deleteSprite.Step()
+			if err != nil {
+				dbLog.Error("unable to delete sprite of video", "id", t.Id, "err", err)
+			}
+			deleteSprite.Reset()
 		} else {
 			insert.BindInt64(1, int64(t.Id))
 			insert.BindInt64(2, now.Unix())
 			insert.BindBytes(3, t.Bytes)
 			_, err := insert.Step()
 			if err != nil {
-				log.Printf("Unable to insert image %d: %s\n", t.Id, err)
+				dbLog.Error("unable to insert image", "id", t.Id, "err", err)
 			}
 			insert.Reset()
 		}
@@ -261,7 +329,7 @@ func (s *Source) writePending() {
 
 			if time.Since(lastOptimize).Hours() >= 1 {
 				lastOptimize = time.Now()
-				log.Println("database optimizing")
+				dbLog.Info("database optimizing")
 				optimizeDone := metrics.Elapsed("database optimize")
 				err = sqlitex.Execute(c, "PRAGMA optimize;", nil)
 				if err != nil {
@@ -276,6 +344,190 @@ func (s *Source) writePending() {
 	}
 }
 
+// Export copies the thumbnails of the provided ids into the thumbnail
+// database at dstPath, creating it if needed
+func (s *Source) Export(dstPath string, migrations fs.FS, ids []uint32) (err error) {
+	dst := Source{path: dstPath}
+	dst.migrate(migrations)
+
+	c := s.pool.Get(context.Background())
+	defer s.pool.Put(c)
+
+	err = sqlitex.Execute(c, "ATTACH DATABASE ? AS dst;", &sqlitex.ExecOptions{
+		Args: []interface{}{dstPath},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to attach %s: %w", dstPath, err)
+	}
+	defer sqlitex.Execute(c, "DETACH DATABASE dst;", nil)
+
+	endFn, err := sqlitex.ImmediateTransaction(c)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	stmt := c.Prep(`
+		INSERT OR REPLACE INTO dst.thumb256(id, created_at_unix, data)
+		SELECT id, created_at_unix, data
+		FROM main.thumb256
+		WHERE id = ?;`)
+	defer stmt.Reset()
+
+	for _, id := range ids {
+		stmt.BindInt64(1, int64(id))
+		_, err = stmt.Step()
+		if err != nil {
+			return fmt.Errorf("unable to export thumbnail %d: %w", id, err)
+		}
+		err = stmt.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTiles stores the deep zoom tiles of the image, replacing existing
+// ones. Unlike thumbnails, they are written right away, so that they can
+// be read back by the next request.
+func (s *Source) WriteTiles(id uint32, tiles []deepzoom.Tile) (err error) {
+	c := s.pool.Get(context.Background())
+	defer s.pool.Put(c)
+
+	endFn, err := sqlitex.ImmediateTransaction(c)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	stmt := c.Prep(`
+		INSERT OR REPLACE INTO deepzoom_tile(id, level, col, row, created_at_unix, data)
+		VALUES (?, ?, ?, ?, ?, ?);`)
+	defer stmt.Reset()
+
+	now := time.Now().Unix()
+	for _, t := range tiles {
+		stmt.BindInt64(1, int64(id))
+		stmt.BindInt64(2, int64(t.Level))
+		stmt.BindInt64(3, int64(t.Col))
+		stmt.BindInt64(4, int64(t.Row))
+		stmt.BindInt64(5, now)
+		stmt.BindBytes(6, t.Data)
+		_, err = stmt.Step()
+		if err != nil {
+			return fmt.Errorf("unable to insert tile %d/%d_%d of image %d: %w", t.Level, t.Col, t.Row, id, err)
+		}
+		err = stmt.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTile returns the encoded deep zoom tile of the image, ErrNotFound if
+// it has not been generated
+func (s *Source) GetTile(ctx context.Context, id uint32, level, col, row int) ([]byte, error) {
+	c := s.pool.Get(ctx)
+	if c == nil {
+		return nil, ctx.Err()
+	}
+	defer s.pool.Put(c)
+
+	stmt := c.Prep(`
+		SELECT data
+		FROM deepzoom_tile
+		WHERE id == ? AND level == ? AND col == ? AND row == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+	stmt.BindInt64(2, int64(level))
+	stmt.BindInt64(3, int64(col))
+	stmt.BindInt64(4, int64(row))
+
+	exists, err := stmt.Step()
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute query: %w", err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	b := make([]byte, stmt.ColumnLen(0))
+	stmt.ColumnBytes(0, b)
+	return b, nil
+}
+
+// WriteSprite stores the encoded scrubbing sprite sheet of the video,
+// replacing an existing one
+func (s *Source) WriteSprite(id uint32, sprite ffmpeg.Sprite, data []byte) error {
+	c := s.pool.Get(context.Background())
+	defer s.pool.Put(c)
+
+	stmt := c.Prep(`
+		INSERT OR REPLACE INTO video_sprite(id, duration_ms, interval_ms, count, cols, rows, frame_width, frame_height, created_at_unix, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(id))
+	stmt.BindInt64(2, sprite.Duration.Milliseconds())
+	stmt.BindInt64(3, sprite.Interval.Milliseconds())
+	stmt.BindInt64(4, int64(sprite.Count))
+	stmt.BindInt64(5, int64(sprite.Cols))
+	stmt.BindInt64(6, int64(sprite.Rows))
+	stmt.BindInt64(7, int64(sprite.FrameWidth))
+	stmt.BindInt64(8, int64(sprite.FrameHeight))
+	stmt.BindInt64(9, time.Now().Unix())
+	stmt.BindBytes(10, data)
+	_, err := stmt.Step()
+	if err != nil {
+		return fmt.Errorf("unable to insert sprite of video %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetSprite returns the scrubbing sprite of the video and the encoded
+// sheet if withData is set, ErrNotFound if it has not been generated
+func (s *Source) GetSprite(ctx context.Context, id uint32, withData bool) (ffmpeg.Sprite, []byte, error) {
+	c := s.pool.Get(ctx)
+	if c == nil {
+		return ffmpeg.Sprite{}, nil, ctx.Err()
+	}
+	defer s.pool.Put(c)
+
+	stmt := c.Prep(`
+		SELECT duration_ms, interval_ms, count, cols, rows, frame_width, frame_height, CASE WHEN ? THEN data END
+		FROM video_sprite
+		WHERE id == ?;`)
+	defer stmt.Reset()
+
+	stmt.BindBool(1, withData)
+	stmt.BindInt64(2, int64(id))
+
+	exists, err := stmt.Step()
+	if err != nil {
+		return ffmpeg.Sprite{}, nil, fmt.Errorf("unable to execute query: %w", err)
+	}
+	if !exists {
+		return ffmpeg.Sprite{}, nil, ErrNotFound
+	}
+	sprite := ffmpeg.Sprite{
+		Duration:    time.Duration(stmt.ColumnInt64(0)) * time.Millisecond,
+		Interval:    time.Duration(stmt.ColumnInt64(1)) * time.Millisecond,
+		Count:       stmt.ColumnInt(2),
+		Cols:        stmt.ColumnInt(3),
+		Rows:        stmt.ColumnInt(4),
+		FrameWidth:  stmt.ColumnInt(5),
+		FrameHeight: stmt.ColumnInt(6),
+	}
+	var b []byte
+	if withData {
+		b = make([]byte, stmt.ColumnLen(7))
+		stmt.ColumnBytes(7, b)
+	}
+	return sprite, b, nil
+}
+
 func (s *Source) Exists(ctx context.Context, id io.ImageId, path string) bool {
 	exists := false
 	s.Reader(ctx, id, path, func(r goio.ReadSeeker, err error) {
@@ -287,6 +539,9 @@ func (s *Source) Exists(ctx context.Context, id io.ImageId, path string) bool {
 }
 
 func (s *Source) Get(ctx context.Context, id io.ImageId, path string) io.Result {
+	ctx, span := tracing.Start(ctx, "sqlite thumbnail")
+	defer span.End()
+
 	c := s.pool.Get(ctx)
 	defer s.pool.Put(c)
 
@@ -303,8 +558,12 @@ func (s *Source) Get(ctx context.Context, id io.ImageId, path string) io.Result
 		return io.Result{Error: fmt.Errorf("unable to execute query: %w", err)}
 	}
 	if !exists {
+		metrics.CacheMiss("sqlite_thumbnail")
+		span.SetAttributes(tracing.Bool("hit", false))
 		return io.Result{}
 	}
+	metrics.CacheHit("sqlite_thumbnail")
+	span.SetAttributes(tracing.Bool("hit", true))
 
 	r := stmt.ColumnReader(0)
 	return s.Decode(ctx, r)
@@ -328,9 +587,11 @@ func (s *Source) Reader(ctx context.Context, id io.ImageId, path string, fn func
 		return
 	}
 	if !exists {
+		metrics.CacheMiss("sqlite_thumbnail")
 		fn(nil, ErrNotFound)
 		return
 	}
+	metrics.CacheHit("sqlite_thumbnail")
 
 	r := stmt.ColumnReader(0)
 	fn(r, nil)
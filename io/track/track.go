@@ -0,0 +1,248 @@
+// Package track reads GPS tracks recorded by phones, watches and loggers
+// from GPX and KML files and locates points in time along them
+package track
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a location recorded at a time
+type Point struct {
+	Time time.Time
+	Lat  float64
+	Lng  float64
+}
+
+// Track is a list of points sorted by time
+type Track []Point
+
+var ErrNoPoints = errors.New("no timestamped points found")
+
+// Parse parses the timestamped points of the GPX or KML file, from track
+// points, waypoints, gx:Track elements and placemarks with a timestamp
+func Parse(r io.Reader) (Track, error) {
+	var t Track
+	d := xml.NewDecoder(r)
+	d.Strict = false
+
+	var text strings.Builder
+	// Current GPX point or KML placemark
+	var point Point
+	var hasLatLng, inPoint bool
+	// Pending gx:Track timestamps and coordinates, which are listed
+	// separately and paired in order
+	var whens []time.Time
+	var coords [][2]float64
+	inGxTrack := false
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			text.Reset()
+			switch tok.Name.Local {
+			case "trkpt", "wpt", "rtept":
+				point = Point{}
+				inPoint = true
+				hasLatLng = false
+				var latOk, lngOk bool
+				for _, a := range tok.Attr {
+					switch a.Name.Local {
+					case "lat":
+						point.Lat, latOk = parseFloat(a.Value)
+					case "lon":
+						point.Lng, lngOk = parseFloat(a.Value)
+					}
+				}
+				hasLatLng = latOk && lngOk
+			case "Placemark":
+				point = Point{}
+				inPoint = true
+				hasLatLng = false
+			case "Track":
+				inGxTrack = true
+				whens = whens[:0]
+				coords = coords[:0]
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			switch tok.Name.Local {
+			case "time":
+				if inPoint {
+					point.Time, _ = parseTime(value)
+				}
+			case "when":
+				tm, err := parseTime(value)
+				if inGxTrack {
+					whens = append(whens, tm)
+				} else if inPoint && err == nil {
+					point.Time = tm
+				}
+			case "coord":
+				if inGxTrack {
+					fields := strings.Fields(value)
+					c := [2]float64{math.NaN(), math.NaN()}
+					if len(fields) >= 2 {
+						c[0], _ = parseFloat(fields[1])
+						c[1], _ = parseFloat(fields[0])
+					}
+					coords = append(coords, c)
+				}
+			case "coordinates":
+				// The first of possibly several tuples of a point
+				tuples := strings.Fields(value)
+				if inPoint && len(tuples) > 0 {
+					fields := strings.Split(tuples[0], ",")
+					if len(fields) >= 2 {
+						var latOk, lngOk bool
+						point.Lng, lngOk = parseFloat(fields[0])
+						point.Lat, latOk = parseFloat(fields[1])
+						hasLatLng = latOk && lngOk
+					}
+				}
+			case "Track":
+				inGxTrack = false
+				for i := 0; i < len(whens) && i < len(coords); i++ {
+					c := coords[i]
+					if whens[i].IsZero() || math.IsNaN(c[0]) || math.IsNaN(c[1]) {
+						continue
+					}
+					t = append(t, Point{Time: whens[i], Lat: c[0], Lng: c[1]})
+				}
+			case "trkpt", "wpt", "rtept", "Placemark":
+				if inPoint && hasLatLng && !point.Time.IsZero() {
+					t = append(t, point)
+				}
+				inPoint = false
+			}
+		}
+	}
+	if len(t) == 0 {
+		return nil, ErrNoPoints
+	}
+	t.sort()
+	return t, nil
+}
+
+func parseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		// Some loggers leave out the timezone, which is UTC in GPX
+		t, err = time.Parse("2006-01-02T15:04:05", strings.TrimSuffix(s, "Z"))
+	}
+	return t, err
+}
+
+func (t Track) sort() {
+	sort.SliceStable(t, func(i, j int) bool {
+		return t[i].Time.Before(t[j].Time)
+	})
+}
+
+// Merge returns the points of all the tracks sorted by time
+func Merge(tracks ...Track) Track {
+	var m Track
+	for _, t := range tracks {
+		m = append(m, t...)
+	}
+	m.sort()
+	return m
+}
+
+// Start returns the time of the first point
+func (t Track) Start() time.Time {
+	if len(t) == 0 {
+		return time.Time{}
+	}
+	return t[0].Time
+}
+
+// End returns the time of the last point
+func (t Track) End() time.Time {
+	if len(t) == 0 {
+		return time.Time{}
+	}
+	return t[len(t)-1].Time
+}
+
+// Locate returns the location at the time, interpolated between the points
+// before and after it if they are at most maxGap apart, or the nearest point
+// if it is within maxGap of the time. False if there is no point close
+// enough.
+func (t Track) Locate(tm time.Time, maxGap time.Duration) (Point, bool) {
+	i := sort.Search(len(t), func(i int) bool {
+		return !t[i].Time.Before(tm)
+	})
+	var before, after *Point
+	if i > 0 {
+		before = &t[i-1]
+	}
+	if i < len(t) {
+		after = &t[i]
+	}
+	switch {
+	case after != nil && after.Time.Equal(tm):
+		return *after, true
+	case before != nil && after != nil && after.Time.Sub(before.Time) <= maxGap:
+		f := float64(tm.Sub(before.Time)) / float64(after.Time.Sub(before.Time))
+		return Point{
+			Time: tm,
+			Lat:  before.Lat + (after.Lat-before.Lat)*f,
+			Lng:  interpolateLng(before.Lng, after.Lng, f),
+		}, true
+	}
+	var nearest *Point
+	gap := maxGap
+	if before != nil && tm.Sub(before.Time) <= gap {
+		nearest, gap = before, tm.Sub(before.Time)
+	}
+	if after != nil && after.Time.Sub(tm) <= gap {
+		nearest = after
+	}
+	if nearest == nil {
+		return Point{}, false
+	}
+	return *nearest, true
+}
+
+// interpolateLng interpolates between the longitudes the short way around,
+// across the antimeridian if needed
+func interpolateLng(a, b, f float64) float64 {
+	d := b - a
+	if d > 180 {
+		d -= 360
+	} else if d < -180 {
+		d += 360
+	}
+	lng := a + d*f
+	if lng > 180 {
+		lng -= 360
+	} else if lng < -180 {
+		lng += 360
+	}
+	return lng
+}
@@ -0,0 +1,109 @@
+package track
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+ <metadata><time>2023-01-01T00:00:00Z</time></metadata>
+ <trk><trkseg>
+  <trkpt lat="46.0" lon="14.0"><ele>300</ele><time>2023-06-01T10:00:00Z</time></trkpt>
+  <trkpt lat="46.2" lon="14.4"><time>2023-06-01T10:10:00Z</time></trkpt>
+  <trkpt lat="47.0" lon="15.0"></trkpt>
+ </trkseg></trk>
+ <wpt lat="45.0" lon="13.0"><time>2023-06-01T09:00:00+02:00</time></wpt>
+</gpx>`
+
+const kml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+ <Document>
+  <Placemark>
+   <gx:Track>
+    <when>2023-06-01T12:00:00Z</when>
+    <when>2023-06-01T12:01:00Z</when>
+    <gx:coord>14.5 46.05 295</gx:coord>
+    <gx:coord>14.6 46.06 296</gx:coord>
+   </gx:Track>
+  </Placemark>
+  <Placemark>
+   <TimeStamp><when>2023-06-01T11:00:00Z</when></TimeStamp>
+   <Point><coordinates>14.1,46.1,0</coordinates></Point>
+  </Placemark>
+  <Placemark>
+   <LineString><coordinates>1,2,0 3,4,0</coordinates></LineString>
+  </Placemark>
+ </Document>
+</kml>`
+
+func TestParseGpx(t *testing.T) {
+	tr, err := Parse(strings.NewReader(gpx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr) != 3 {
+		t.Fatalf("expected 3 points, got %d: %v", len(tr), tr)
+	}
+	if tr[0].Lat != 45 || !tr[0].Time.Equal(time.Date(2023, 6, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected waypoint first, got %v", tr[0])
+	}
+}
+
+func TestParseKml(t *testing.T) {
+	tr, err := Parse(strings.NewReader(kml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr) != 3 {
+		t.Fatalf("expected 3 points, got %d: %v", len(tr), tr)
+	}
+	if tr[0].Lat != 46.1 || tr[0].Lng != 14.1 {
+		t.Errorf("expected placemark first, got %v", tr[0])
+	}
+	if tr[2].Lat != 46.06 || tr[2].Lng != 14.6 {
+		t.Errorf("expected last track coord, got %v", tr[2])
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`<gpx></gpx>`)); err != ErrNoPoints {
+		t.Errorf("expected ErrNoPoints, got %v", err)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	tr := Track{
+		{Time: start, Lat: 10, Lng: 179},
+		{Time: start.Add(10 * time.Minute), Lat: 20, Lng: -179},
+		{Time: start.Add(5 * time.Hour), Lat: 30, Lng: 0},
+	}
+	cases := []struct {
+		name string
+		t    time.Time
+		ok   bool
+		lat  float64
+		lng  float64
+	}{
+		{"exact", start, true, 10, 179},
+		{"interpolated across antimeridian", start.Add(5 * time.Minute), true, 15, 180},
+		{"near end of gap", start.Add(12 * time.Minute), true, 20, -179},
+		{"within gap", start.Add(2 * time.Hour), false, 0, 0},
+		{"before start", start.Add(-5 * time.Minute), true, 10, 179},
+		{"long before start", start.Add(-time.Hour), false, 0, 0},
+		{"after end", start.Add(5*time.Hour + 10*time.Minute), true, 30, 0},
+	}
+	for _, c := range cases {
+		p, ok := tr.Locate(c.t, 15*time.Minute)
+		if ok != c.ok {
+			t.Errorf("%s: expected %v, got %v", c.name, c.ok, ok)
+			continue
+		}
+		if ok && (math.Abs(p.Lat-c.lat) > 1e-9 || math.Abs(math.Abs(p.Lng)-math.Abs(c.lng)) > 1e-9) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", c.name, c.lat, c.lng, p.Lat, p.Lng)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package xmp reads the rating, label, keywords and description from XMP
+// metadata, as
+// written to sidecar files or embedded in the photos by photo managers like
+// Lightroom, darktable and digiKam
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Size of the start of the file searched for embedded XMP metadata
+const scanSize = 256 << 10
+
+const (
+	nsXmp = "http://ns.adobe.com/xap/1.0/"
+	nsDc  = "http://purl.org/dc/elements/1.1/"
+	nsLr  = "http://ns.adobe.com/lightroom/1.0/"
+	nsRdf = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// Metadata is the part of the XMP metadata describing how the photo was
+// rated and organized
+type Metadata struct {
+	// Stars from 1 to 5, 0 if unrated and -1 if rejected
+	Rating int
+	// Color label, e.g. Red
+	Label string
+	// Caption, in the default language if there are several
+	Description string
+	// Keywords, with the last level of hierarchical keywords
+	Keywords []string
+	// Hierarchical keywords from the outermost level, e.g. Places|Spain|Beach
+	// as [Places Spain Beach]
+	Hierarchical [][]string
+}
+
+// Read reads the metadata embedded at the start of the file, false if
+// there is none
+func Read(r io.Reader) (Metadata, bool, error) {
+	b, err := io.ReadAll(io.LimitReader(r, scanSize))
+	if err != nil {
+		return Metadata{}, false, err
+	}
+	start := bytes.Index(b, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return Metadata{}, false, nil
+	}
+	b = b[start:]
+	end := bytes.Index(b, []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return Metadata{}, false, nil
+	}
+	m, err := Parse(bytes.NewReader(b[:end+len("</x:xmpmeta>")]))
+	if err != nil {
+		return Metadata{}, false, err
+	}
+	return m, true, nil
+}
+
+// Parse parses the metadata from the XMP, with the properties either as
+// attributes or elements
+func Parse(r io.Reader) (Metadata, error) {
+	var m Metadata
+	keywords := make(map[string]struct{})
+	addKeyword := func(k string) {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return
+		}
+		if _, ok := keywords[k]; ok {
+			return
+		}
+		keywords[k] = struct{}{}
+		m.Keywords = append(m.Keywords, k)
+	}
+
+	d := xml.NewDecoder(r)
+	// Elements from the outermost one
+	var path []xml.Name
+	var text bytes.Buffer
+	// Language of the current element of language alternatives
+	var lang string
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name)
+			text.Reset()
+			lang = ""
+			for _, a := range t.Attr {
+				switch a.Name {
+				case xml.Name{Space: nsXmp, Local: "Rating"}:
+					m.Rating = parseRating(a.Value)
+				case xml.Name{Space: nsXmp, Local: "Label"}:
+					m.Label = a.Value
+				case xml.Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}:
+					lang = a.Value
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case t.Name == xml.Name{Space: nsXmp, Local: "Rating"}:
+				m.Rating = parseRating(value)
+			case t.Name == xml.Name{Space: nsXmp, Local: "Label"}:
+				m.Label = value
+			case t.Name == xml.Name{Space: nsRdf, Local: "li"} && within(path, nsDc, "description"):
+				if m.Description == "" || isDefaultLanguage(lang) {
+					m.Description = value
+				}
+			case t.Name == xml.Name{Space: nsRdf, Local: "li"} && within(path, nsDc, "subject"):
+				addKeyword(value)
+			case t.Name == xml.Name{Space: nsRdf, Local: "li"} && within(path, nsLr, "hierarchicalSubject"):
+				var levels []string
+				for _, l := range strings.Split(value, "|") {
+					if l = strings.TrimSpace(l); l != "" {
+						levels = append(levels, l)
+					}
+				}
+				if len(levels) == 0 {
+					break
+				}
+				addKeyword(levels[len(levels)-1])
+				m.Hierarchical = append(m.Hierarchical, levels)
+			}
+			text.Reset()
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+	return m, nil
+}
+
+func parseRating(s string) int {
+	r, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	if r < 0 {
+		return -1
+	}
+	if r > 5 {
+		return 5
+	}
+	return int(r)
+}
+
+func isDefaultLanguage(lang string) bool {
+	return lang == "" || lang == "x-default"
+}
+
+// within reports whether any of the elements of the path is the one
+func within(path []xml.Name, space string, local string) bool {
+	for _, n := range path {
+		if n.Space == space && n.Local == local {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package xmp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name string
+		xmp  string
+		m    Metadata
+	}{
+		{
+			"lightroom",
+			`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+			 <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+			  <rdf:Description rdf:about=""
+			    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+			    xmlns:dc="http://purl.org/dc/elements/1.1/"
+			    xmlns:lr="http://ns.adobe.com/lightroom/1.0/"
+			   xmp:Rating="4"
+			   xmp:Label="Red">
+			   <dc:subject>
+			    <rdf:Bag>
+			     <rdf:li>Beach</rdf:li>
+			     <rdf:li>Family</rdf:li>
+			    </rdf:Bag>
+			   </dc:subject>
+			   <lr:hierarchicalSubject>
+			    <rdf:Bag>
+			     <rdf:li>Places|Spain|Beach</rdf:li>
+			     <rdf:li>Places|Spain|Valencia</rdf:li>
+			    </rdf:Bag>
+			   </lr:hierarchicalSubject>
+			  </rdf:Description>
+			 </rdf:RDF>
+			</x:xmpmeta>`,
+			Metadata{
+				Rating:   4,
+				Label:    "Red",
+				Keywords: []string{"Beach", "Family", "Valencia"},
+				Hierarchical: [][]string{
+					{"Places", "Spain", "Beach"},
+					{"Places", "Spain", "Valencia"},
+				},
+			},
+		},
+		{
+			"elements",
+			`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+			  <rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+			   <xmp:Rating>-1</xmp:Rating>
+			   <xmp:Label> Green </xmp:Label>
+			  </rdf:Description>
+			 </rdf:RDF></x:xmpmeta>`,
+			Metadata{Rating: -1, Label: "Green"},
+		},
+		{
+			"description",
+			`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+			  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">
+			   <dc:description><rdf:Alt>
+			    <rdf:li xml:lang="de">Am Strand</rdf:li>
+			    <rdf:li xml:lang="x-default">At the beach</rdf:li>
+			    <rdf:li xml:lang="fr">À la plage</rdf:li>
+			   </rdf:Alt></dc:description>
+			  </rdf:Description>
+			 </rdf:RDF></x:xmpmeta>`,
+			Metadata{Description: "At the beach"},
+		},
+		{
+			"other namespaces",
+			`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+			  <rdf:Description xmlns:other="http://example.com/" other:Rating="3">
+			   <other:subject><rdf:Bag><rdf:li>Nope</rdf:li></rdf:Bag></other:subject>
+			  </rdf:Description>
+			 </rdf:RDF></x:xmpmeta>`,
+			Metadata{},
+		},
+	}
+	for _, c := range cases {
+		m, err := Parse(strings.NewReader(c.xmp))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, c.m) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.m, m)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+	 <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">
+	  <dc:subject><rdf:Bag><rdf:li>Cat</rdf:li></rdf:Bag></dc:subject>
+	 </rdf:Description>
+	</rdf:RDF></x:xmpmeta>`
+	file := "\xff\xd8\xff\xe1\x01\x00http://ns.adobe.com/xap/1.0/\x00" + packet + "\xff\xdb"
+	m, ok, err := Read(strings.NewReader(file))
+	if err != nil || !ok {
+		t.Fatalf("expected metadata, got %v %v", ok, err)
+	}
+	if !reflect.DeepEqual(m.Keywords, []string{"Cat"}) {
+		t.Errorf("expected [Cat], got %v", m.Keywords)
+	}
+
+	_, ok, err = Read(strings.NewReader("\xff\xd8\xff\xdb"))
+	if err != nil || ok {
+		t.Errorf("expected no metadata, got %v %v", ok, err)
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/csv"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	goimage "image"
 	"image/color"
 	"image/draw"
@@ -20,15 +27,20 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 
 	_ "net/http/pprof"
 
@@ -45,24 +57,50 @@ import (
 
 	"github.com/tdewolff/canvas"
 	"github.com/tdewolff/canvas/rasterizer"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/goccy/go-yaml"
+	"github.com/golang/geo/s2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 
+	"photofield/internal/auth"
 	"photofield/internal/clip"
 	"photofield/internal/codec"
 	"photofield/internal/collection"
+	"photofield/internal/deepzoom"
+	"photofield/internal/digest"
+	"photofield/internal/dlna"
+	"photofield/internal/feed"
+	"photofield/internal/icc"
+	"photofield/internal/iiif"
 	"photofield/internal/image"
+	"photofield/internal/instance"
+	"photofield/internal/kiosk"
 	"photofield/internal/layout"
+	"photofield/internal/logging"
 	"photofield/internal/metrics"
+	"photofield/internal/mqtt"
 	"photofield/internal/openapi"
+	"photofield/internal/opengraph"
+	"photofield/internal/printing"
+	"photofield/internal/problem"
 	"photofield/internal/render"
 	"photofield/internal/scene"
+	"photofield/internal/sheet"
+	"photofield/internal/site"
+	"photofield/internal/tracing"
+	"photofield/internal/webdav"
+	"photofield/internal/webhook"
 	pfio "photofield/io"
+	"photofield/io/archive"
 	"photofield/io/bench"
+	"photofield/io/ffmpeg"
+	"photofield/io/gpano"
+	"photofield/io/track"
+	"photofield/search"
 	"photofield/tag"
 )
 
@@ -72,7 +110,7 @@ var defaults AppConfig
 
 var tagsEnabled bool
 
-//go:embed db/migrations
+//go:embed db/migrations db/migrations-postgres
 var migrations embed.FS
 
 //go:embed db/migrations-thumbs
@@ -83,6 +121,13 @@ var robotoRegular []byte
 
 var staticCacheRegex = regexp.MustCompile(`.+\.\w`)
 
+var (
+	serverLog = logging.Module("server")
+	indexLog  = logging.Module("indexer")
+	decodeLog = logging.Module("decode")
+	renderLog = logging.Module("render")
+)
+
 var (
 	version = "dev"
 	commit  = "none"
@@ -96,6 +141,18 @@ var defaultSceneConfig scene.SceneConfig
 
 var tileRequestConfig TileRequestConfig
 
+var cacheControlConfig CacheControlConfig
+
+var queryConfig image.QueryConfig
+
+var feedConfig feed.Config
+
+var authenticator *auth.Authenticator
+
+// Writer or reader of the data dir shared with other instances
+var instanceRole instance.Role
+var dataDir string
+
 var tilePools sync.Map
 var imageSource *image.Source
 var sceneSource *scene.SceneSource
@@ -107,11 +164,96 @@ var tileRequestsOut chan struct{}
 var tileRequests []TileRequest
 var tileRequestsMutex sync.Mutex
 
+// Photos waiting to be loaded in response to prefetch hints, hints are
+// dropped if it is full
+var prefetchQueue = make(chan prefetchRequest, 32)
+
+// Number of photos loaded concurrently in response to prefetch hints, so
+// that they do not compete with tile rendering too much
+const prefetchConcurrency = 2
+
+type prefetchRequest struct {
+	id   image.ImageId
+	size image.Size
+}
+
 var httpLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Namespace: metrics.Namespace,
 	Name:      "http_latency",
 }, []string{"path"})
 
+// apiScope returns the scope required for the API request, the path is
+// relative to the API prefix
+func apiScope(method string, path string) auth.Scope {
+	switch {
+	case strings.HasPrefix(path, "/metrics"):
+		return auth.ScopeAdmin
+	case strings.HasPrefix(path, "/audit"):
+		return auth.ScopeAdmin
+	case strings.HasPrefix(path, "/diagnostics"):
+		return auth.ScopeAdmin
+	case strings.HasPrefix(path, "/collections/") && strings.HasSuffix(path, "/index-report"):
+		// Walks the whole collection like indexing it
+		return auth.ScopeIndex
+	case strings.HasPrefix(path, "/state"), strings.HasPrefix(path, "/searches"):
+		// Users only change their own state
+		return auth.ScopeRead
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions:
+		return auth.ScopeRead
+	case method == http.MethodPost && strings.HasPrefix(path, "/scenes"):
+		// Viewing a collection creates scenes
+		return auth.ScopeRead
+	case method == http.MethodPost && strings.HasPrefix(path, "/sheets"):
+		// Rendering only reads photos, like viewing them
+		return auth.ScopeRead
+	case method == http.MethodPost && strings.HasPrefix(path, "/collections/") && strings.HasSuffix(path, "/similar"):
+		// The image is only compared, like searching
+		return auth.ScopeRead
+	case method == http.MethodPost && strings.HasPrefix(path, "/tags"):
+		return auth.ScopeTag
+	case method == http.MethodPost && strings.HasPrefix(path, "/collections/") && strings.HasSuffix(path, "/files"):
+		return auth.ScopeUpload
+	case method == http.MethodPost && strings.HasPrefix(path, "/tasks"):
+		return auth.ScopeIndex
+	case method == http.MethodPost && strings.HasPrefix(path, "/files/") && strings.HasSuffix(path, "/reprocess"):
+		return auth.ScopeIndex
+	default:
+		return auth.ScopeAdmin
+	}
+}
+
+// sharedWrite reports whether an API request writes to the data dir shared
+// with other instances, which only the writer does
+func sharedWrite(method string, path string) bool {
+	switch {
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions:
+		return false
+	case method == http.MethodPost && strings.HasPrefix(path, "/scenes"):
+		// Scenes are kept in memory
+		return false
+	case method == http.MethodPost && strings.HasPrefix(path, "/sheets"):
+		return false
+	case method == http.MethodPost && strings.HasPrefix(path, "/collections/") && strings.HasSuffix(path, "/similar"):
+		return false
+	default:
+		return true
+	}
+}
+
+// readOnly rejects the requests the writes of which only the writer instance
+// can make, so that they can be retried there
+func readOnly(writes func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if instanceRole == instance.RoleReader && writes(r) {
+				problem.Write(w, r, http.StatusServiceUnavailable, problem.ReadOnly, "read-only instance, changes are made by the writer instance")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func instrumentationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		rctx := chi.RouteContext(r.Context())
@@ -160,66 +302,141 @@ type TileRequest struct {
 	Done     chan struct{}
 }
 
-type Problem struct {
-	Status int    `json:"status"`
-	Title  string `json:"title"`
-}
-
-func (p Problem) Render(w http.ResponseWriter, r *http.Request) error {
-	chirender.Status(r, p.Status)
-	return nil
+func respond(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	chirender.Status(r, code)
+	chirender.Respond(w, r, v)
 }
 
-func problem(w http.ResponseWriter, r *http.Request, code int, message string) {
-	chirender.Render(w, r, Problem{
-		Status: code,
-		Title:  message,
+// audit records the mutating operation of the request in the audit log
+func audit(r *http.Request, action image.AuditAction, target string, ids image.Ids, details map[string]any) {
+	p, _ := auth.FromContext(r.Context())
+	imageSource.Audit(image.AuditEntry{
+		Actor:   p.Name,
+		Method:  p.Method,
+		Action:  action,
+		Target:  target,
+		Ids:     ids,
+		Details: details,
 	})
 }
 
-func respond(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
-	chirender.Status(r, code)
-	chirender.Respond(w, r, v)
+// collectIds passes the ids through while collecting them into affected,
+// which is complete once the returned channel is closed
+func collectIds(in <-chan image.ImageId, affected image.Ids) <-chan image.ImageId {
+	out := make(chan image.ImageId, 100)
+	go func() {
+		defer close(out)
+		for id := range in {
+			affected.AddInt(int(id))
+			out <- id
+		}
+	}()
+	return out
 }
 
-func drawTile(c *canvas.Context, r *render.Render, scene *render.Scene, zoom int, x int, y int) {
+func fileIds(ids ...image.ImageId) image.Ids {
+	t := image.NewIds()
+	for _, id := range ids {
+		t.AddInt(int(id))
+	}
+	return t
+}
 
-	tileSize := float64(r.TileSize)
+// drawTile draws the tile, returning the number of photos drawn as
+// placeholders because the deadline of the render passed
+// tileView returns the view the tile at the zoom and position is drawn
+// with and its scales
+func tileView(tileSize int, scene *render.Scene, zoom int, x int, y int) (canvas.Matrix, render.Scales) {
+	size := float64(tileSize)
 	zoomPower := 1 << zoom
 
-	tx := float64(x) * tileSize
-	ty := float64(zoomPower-1-y) * tileSize
+	tx := float64(x) * size
+	ty := float64(zoomPower-1-y) * size
 
 	var scale float64
 	if 1 < scene.Bounds.W/scene.Bounds.H {
-		scale = tileSize / scene.Bounds.W
-		tx += (scale*scene.Bounds.W - tileSize) * 0.5
+		scale = size / scene.Bounds.W
+		tx += (scale*scene.Bounds.W - size) * 0.5
 	} else {
-		scale = tileSize / scene.Bounds.H
-		ty += (scale*scene.Bounds.H - tileSize) * 0.5
+		scale = size / scene.Bounds.H
+		ty += (scale*scene.Bounds.H - size) * 0.5
 	}
 
 	scale *= float64(zoomPower)
 
 	scales := render.Scales{
 		Pixel: scale,
-		Tile:  1 / float64(tileSize),
+		Tile:  1 / size,
 	}
 
+	matrix := canvas.Identity.
+		Translate(float64(-tx), float64(-ty+size*float64(zoomPower))).
+		Scale(float64(scale), float64(scale))
+
+	return matrix, scales
+}
+
+func drawTile(c *canvas.Context, r *render.Render, scene *render.Scene, zoom int, x int, y int) int {
+	matrix, scales := tileView(r.TileSize, scene, zoom, x, y)
+
 	c.ResetView()
 
 	img := r.CanvasImage
 	draw.Draw(img, img.Bounds(), &goimage.Uniform{r.BackgroundColor}, goimage.Point{}, draw.Src)
 
-	matrix := canvas.Identity.
-		Translate(float64(-tx), float64(-ty+tileSize*float64(zoomPower))).
-		Scale(float64(scale), float64(scale))
-
 	c.SetView(matrix)
 
 	c.SetFillColor(canvas.Black)
 
-	scene.Draw(r, c, scales, imageSource)
+	return scene.Draw(r, c, scales, imageSource)
+}
+
+// Files of a tile whose contents are part of its entity tag, as zoomed out
+// tiles show too many files too small for changes to them to matter
+const tileETagMaxHashes = 256
+
+// tileETag returns the entity tag of a tile, which changes with the scene
+// revision, the request parameters and the contents of the files visible
+// in the tile. The configuration affects the rendering as well, so the tags
+// also change when the server restarts.
+func tileETag(r *http.Request, scene *render.Scene, tileSize int, zoom int, x int, y int) string {
+	h := fnv.New64a()
+	// Without the priority, so that prefetched and visible requests of the
+	// same tile share the rendering and the cache
+	query := r.URL.Query()
+	query.Del("priority")
+	fmt.Fprintf(h, "%s\n%d\n%d\n%s\n", scene.Id, scene.Revision, startupTime.UnixNano(), query.Encode())
+	matrix, _ := tileView(tileSize, scene, zoom, x, y)
+	hashed := 0
+	for photo := range scene.GetVisiblePhotos(render.GetViewRect(matrix, tileSize)) {
+		hash := ""
+		if hashed < tileETagMaxHashes {
+			hash, _ = imageSource.GetStoredFileHash(photo.Id)
+			hashed++
+		}
+		fmt.Fprintf(h, "%d %s\n", photo.Id, hash)
+	}
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// setCacheControl sets the Cache-Control header, unless it is not
+// configured
+func setCacheControl(w http.ResponseWriter, value string) {
+	if value != "" {
+		w.Header().Set("Cache-Control", value)
+	}
+}
+
+// etagMatches reports whether the If-None-Match header of the request lists
+// the entity tag
+func etagMatches(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
 }
 
 func getTilePool(config *render.Render) *sync.Pool {
@@ -314,8 +531,21 @@ func processTileRequests(concurrency int) {
 	}
 }
 
+func processPrefetchRequests(concurrency int) {
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for p := range prefetchQueue {
+				err := imageSource.Prefetch(context.Background(), p.id, p.size)
+				if err != nil {
+					decodeLog.Warn("prefetch failed", "err", err)
+				}
+			}
+		}()
+	}
+}
+
 func renderSample(config render.Render, scene *render.Scene) {
-	log.Println("rendering sample")
+	renderLog.Info("rendering sample")
 	config.LogDraws = true
 
 	image, context := getTileImage(&config)
@@ -346,7 +576,7 @@ type Api struct{}
 func (*Api) PostScenes(w http.ResponseWriter, r *http.Request) {
 	data := &openapi.SceneParams{}
 	if err := chirender.Decode(r, data); err != nil {
-		problem(w, r, http.StatusBadRequest, err.Error())
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
 		return
 	}
 
@@ -354,7 +584,7 @@ func (*Api) PostScenes(w http.ResponseWriter, r *http.Request) {
 
 	collection := getCollectionById(string(data.CollectionId))
 	if collection == nil {
-		problem(w, r, http.StatusBadRequest, "Collection not found")
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
 		return
 	}
 	sceneConfig.Collection = *collection
@@ -374,15 +604,20 @@ func (*Api) PostScenes(w http.ResponseWriter, r *http.Request) {
 	if data.Sort != nil {
 		sceneConfig.Layout.Order = layout.OrderFromSort(string(*data.Sort))
 		if sceneConfig.Layout.Order == layout.None {
-			problem(w, r, http.StatusBadRequest, "Invalid sort")
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid sort").With("parameter", "sort").Write(w, r)
 			return
 		}
 	}
+	setLayoutParams(&sceneConfig.Layout, data.Spacing, data.MaxRowSlop, data.Panorama)
 	if data.Search != nil {
 		sceneConfig.Scene.Search = string(*data.Search)
 		if sceneConfig.Layout.Type != layout.Strip {
 			sceneConfig.Layout.Type = layout.Search
 		}
+		imageSource.RecordSearch(stateUser(r), collection.Id, sceneConfig.Scene.Search)
+	}
+	if data.Private != nil && *data.Private {
+		sceneConfig.Hide = nil
 	}
 
 	scene := sceneSource.Add(sceneConfig, imageSource)
@@ -390,6 +625,20 @@ func (*Api) PostScenes(w http.ResponseWriter, r *http.Request) {
 	respond(w, r, http.StatusAccepted, scene)
 }
 
+// setLayoutParams sets the optional parameters of justified layouts
+func setLayoutParams(l *layout.Layout, spacing *openapi.Spacing, maxRowSlop *openapi.MaxRowSlop, panorama *openapi.PanoramaLayout) {
+	if spacing != nil {
+		s := float64(*spacing)
+		l.Spacing = &s
+	}
+	if maxRowSlop != nil {
+		l.MaxRowSlop = float64(*maxRowSlop)
+	}
+	if panorama != nil {
+		l.Panorama = layout.Panorama(*panorama)
+	}
+}
+
 func (*Api) GetScenes(w http.ResponseWriter, r *http.Request, params openapi.GetScenesParams) {
 
 	sceneConfig := defaultSceneConfig
@@ -408,10 +657,11 @@ func (*Api) GetScenes(w http.ResponseWriter, r *http.Request, params openapi.Get
 	if params.Sort != nil {
 		sceneConfig.Layout.Order = layout.OrderFromSort(string(*params.Sort))
 		if sceneConfig.Layout.Order == layout.None {
-			problem(w, r, http.StatusBadRequest, "Invalid sort")
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid sort").With("parameter", "sort").Write(w, r)
 			return
 		}
 	}
+	setLayoutParams(&sceneConfig.Layout, params.Spacing, params.MaxRowSlop, params.Panorama)
 	if params.Search != nil {
 		sceneConfig.Scene.Search = string(*params.Search)
 		if sceneConfig.Layout.Type != layout.Strip {
@@ -420,7 +670,7 @@ func (*Api) GetScenes(w http.ResponseWriter, r *http.Request, params openapi.Get
 	}
 	collection := getCollectionById(string(params.CollectionId))
 	if collection == nil {
-		problem(w, r, http.StatusBadRequest, "Collection not found")
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
 		return
 	}
 	sceneConfig.Collection = *collection
@@ -443,7 +693,7 @@ func (*Api) GetScenesId(w http.ResponseWriter, r *http.Request, id openapi.Scene
 
 	scene := sceneSource.GetSceneById(string(id), imageSource)
 	if scene == nil {
-		problem(w, r, http.StatusNotFound, "Scene not found")
+		problem.Write(w, r, http.StatusNotFound, problem.SceneNotFound, "Scene not found")
 		return
 	}
 
@@ -472,534 +722,4242 @@ func (*Api) GetCollectionsId(w http.ResponseWriter, r *http.Request, id openapi.
 		}
 	}
 
-	problem(w, r, http.StatusNotFound, "Scene not found")
+	problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 }
 
-func gatherIntFromMetric(value *int, metric *io_prometheus_client.MetricFamily, name string) {
-	if metric.Name == nil || metric.Type == nil || *metric.Name != name {
+func (*Api) GetCollectionsIdExport(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.GetCollectionsIdExportParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 		return
 	}
-	switch *metric.Type {
-	case io_prometheus_client.MetricType_GAUGE:
-		m := metric.Metric[0]
-		if m == nil {
-			return
-		}
-		g := m.Gauge
-		if g == nil {
-			return
-		}
-		*value = int(*g.Value)
-	case io_prometheus_client.MetricType_COUNTER:
-		m := metric.Metric[0]
-		if m == nil {
-			return
-		}
-		c := m.Counter
-		if c == nil {
-			return
-		}
-		*value = int(*c.Value)
-	default:
-		panic("Unsupported gather metric type")
+
+	query := ""
+	if params.Query != nil {
+		query = *params.Query
 	}
-}
+	if _, err := parseExportQuery(query); err != nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", "query").Write(w, r)
+		return
+	}
+	originals := params.Originals != nil && *params.Originals
 
-func (*Api) GetTasks(w http.ResponseWriter, r *http.Request, params openapi.GetTasksParams) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.Id+".zip"))
+	w.WriteHeader(http.StatusOK)
 
-	metrics, err := prometheus.DefaultGatherer.Gather()
+	z := site.NewZip(w)
+	n, err := exportSite(r.Context(), c, query, z, originals)
 	if err != nil {
-		problem(w, r, http.StatusInternalServerError, "Unable to gather metrics")
+		serverLog.Error("export failed", "collection", c.Id, "err", err)
+		return
+	}
+	if err := z.Close(); err != nil {
+		serverLog.Error("export failed", "collection", c.Id, "err", err)
 		return
 	}
+	serverLog.Info("export done", "collection", c.Id, "photos", n)
+}
 
-	tasks := make([]Task, 0)
-	globalTasks.Range(func(key, value interface{}) bool {
-		t := value.(Task)
+func (*Api) PostSheets(w http.ResponseWriter, r *http.Request) {
+	data := &openapi.SheetPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
 
-		add := true
-		if params.Type != nil && t.Type != string(*params.Type) {
-			add = false
+	c := getCollectionById(string(data.CollectionId))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	var q *search.Query
+	if data.Tag != nil && *data.Tag != "" {
+		parsed, err := parseExportQuery("tag:" + *data.Tag)
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", "tag").Write(w, r)
+			return
 		}
-		if params.CollectionId != nil && t.CollectionId != string(*params.CollectionId) {
-			add = false
+		q = parsed
+	}
+
+	options := sheet.Options{
+		Title:    c.Name,
+		Captions: true,
+	}
+	if data.Title != nil {
+		options.Title = *data.Title
+	}
+	if data.Paper != nil {
+		options.Paper = string(*data.Paper)
+	}
+	if data.Landscape != nil {
+		options.Landscape = *data.Landscape
+	}
+	if data.Columns != nil {
+		options.Columns = *data.Columns
+	}
+	if data.Rows != nil {
+		options.Rows = *data.Rows
+	}
+	if data.Dpi != nil {
+		options.DPI = *data.Dpi
+	}
+	if data.Captions != nil {
+		options.Captions = *data.Captions
+	}
+	if err := options.Validate(); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	format := sheet.PDF
+	if data.Format != nil {
+		format = string(*data.Format)
+	}
+	page := 1
+	if data.Page != nil {
+		page = *data.Page
+	}
+	if format != sheet.PDF && format != sheet.JPEG {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "format must be pdf or jpeg").With("parameter", "format").Write(w, r)
+		return
+	}
+
+	var selected map[image.ImageId]struct{}
+	if data.FileIds != nil {
+		selected = make(map[image.ImageId]struct{}, len(*data.FileIds))
+		for _, id := range *data.FileIds {
+			selected[image.ImageId(id)] = struct{}{}
 		}
+	}
+	var from, to time.Time
+	if data.From != nil {
+		from = data.From.Time
+	}
+	if data.To != nil {
+		// Including the whole day
+		to = data.To.Time.AddDate(0, 0, 1)
+	}
 
-		if t.Queue != "" {
-			for _, m := range metrics {
-				gatherIntFromMetric(&t.Pending, m, fmt.Sprintf("pf_%s_pending", t.Queue))
-				gatherIntFromMetric(&t.Done, m, fmt.Sprintf("pf_%s_done", t.Queue))
-			}
-			if t.Pending > 0 {
-				t.Done -= t.Offset
-			} else {
-				t.Offset = t.Done
-				globalTasks.Store(t.Id, t)
-				add = false
+	ids := make([]image.ImageId, 0)
+	for info := range c.GetInfos(imageSource, image.ListOptions{
+		OrderBy: image.DateAsc,
+		Limit:   c.Limit,
+		Query:   q,
+		Hide:    imageSource.Private.Tags,
+	}) {
+		if selected != nil {
+			if _, ok := selected[info.Id]; !ok {
+				continue
 			}
 		}
-		if add {
-			tasks = append(tasks, t)
+		if !from.IsZero() && info.DateTime.Before(from) {
+			continue
 		}
-		return true
-	})
-
-	sort.Slice(tasks, func(i, j int) bool {
-		a := tasks[i]
-		b := tasks[j]
-		return a.Id < b.Id
-	})
-
-	respond(w, r, http.StatusOK, struct {
-		Items []Task `json:"items"`
-	}{
-		Items: tasks,
-	})
-}
+		if !to.IsZero() && !info.DateTime.Before(to) {
+			continue
+		}
+		ids = append(ids, info.Id)
+	}
 
-func (*Api) PostTasks(w http.ResponseWriter, r *http.Request) {
-	data := &openapi.PostTasksJSONBody{}
-	if err := chirender.Decode(r, data); err != nil {
-		problem(w, r, http.StatusBadRequest, err.Error())
+	fonts := defaultSceneConfig.Scene.Fonts.Main
+	s, err := sheet.New(imageSource, ids, &fonts, options)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
 		return
 	}
-
-	collection := getCollectionById(string(data.CollectionId))
-	if collection == nil {
-		problem(w, r, http.StatusBadRequest, "Collection not found")
+	if format == sheet.JPEG && (page < 1 || page > s.Pages) {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("page must be between 1 and %d", s.Pages)).With("parameter", "page").Write(w, r)
 		return
 	}
 
-	switch data.Type {
-
-	case openapi.TaskTypeINDEXFILES:
-		task, existing := indexCollection(collection)
-		if existing {
-			respond(w, r, http.StatusConflict, task)
-		} else {
-			respond(w, r, http.StatusAccepted, task)
-		}
+	// Rendered into memory first, so that errors can still be reported
+	var b bytes.Buffer
+	if format == sheet.JPEG {
+		err = s.WriteJPEG(r.Context(), &b, page-1)
+	} else {
+		err = s.WritePDF(r.Context(), &b)
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
 
-	case openapi.TaskTypeINDEXMETADATA:
-		imageSource.IndexMetadata(collection.Dirs, collection.IndexLimit, image.Missing{
-			Metadata: true,
-		})
-		stored, _ := globalTasks.Load("index-metadata")
-		task := stored.(Task)
-		respond(w, r, http.StatusAccepted, task)
+	name := c.Id
+	if format == sheet.JPEG {
+		name = fmt.Sprintf("%s-%d.jpg", name, page)
+		w.Header().Set("Content-Type", "image/jpeg")
+	} else {
+		name = name + ".pdf"
+		w.Header().Set("Content-Type", "application/pdf")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	serverLog.Info("sheet done", "collection", c.Id, "photos", len(ids), "pages", s.Pages)
+	w.Write(b.Bytes())
+}
 
-	case openapi.TaskTypeINDEXCONTENTS:
-		imageSource.IndexContents(collection.Dirs, collection.IndexLimit, image.Missing{
-			Color:     true,
-			Embedding: true,
-		})
-		stored, _ := globalTasks.Load("index-contents")
-		task := stored.(Task)
-		respond(w, r, http.StatusAccepted, task)
+// requestBaseUrl returns the scheme and host the request was made to,
+// taking reverse proxies into account
+func requestBaseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
 
-	case openapi.TaskTypeINDEXCONTENTSCOLOR:
-		imageSource.IndexContents(collection.Dirs, collection.IndexLimit, image.Missing{
-			Color: true,
-		})
-		stored, _ := globalTasks.Load("index-contents")
-		task := stored.(Task)
-		respond(w, r, http.StatusAccepted, task)
+// Number of the most recent photos in the preview of a collection
+const collectionPreviewPhotos = 5
+
+// renderCollectionPreview renders the preview image of the collection
+// shown when links to it are shared
+func renderCollectionPreview(c *collection.Collection) *goimage.RGBA {
+	scene := render.Scene{}
+	infos := c.GetInfos(imageSource, image.ListOptions{
+		OrderBy: image.DateDesc,
+		Limit:   collectionPreviewPhotos,
+		Hide:    imageSource.Private.Tags,
+	})
+	l := layout.Layout{
+		ViewportWidth:  opengraph.ImageWidth,
+		ViewportHeight: opengraph.ImageHeight,
+	}
+	layout.LayoutPreview(infos, l, &scene, imageSource)
 
-	case openapi.TaskTypeINDEXCONTENTSAI:
-		imageSource.IndexContents(collection.Dirs, collection.IndexLimit, image.Missing{
-			Embedding: true,
-		})
-		stored, _ := globalTasks.Load("index-contents")
-		task := stored.(Task)
-		respond(w, r, http.StatusAccepted, task)
+	rn := defaultSceneConfig.Render
+	rn.TileSize = opengraph.ImageWidth
+	rn.BackgroundColor = color.White
+	img := goimage.NewRGBA(goimage.Rect(0, 0, opengraph.ImageWidth, opengraph.ImageHeight))
+	draw.Draw(img, img.Bounds(), &goimage.Uniform{rn.BackgroundColor}, goimage.Point{}, draw.Src)
+	rn.CanvasImage = img
 
-	default:
-		problem(w, r, http.StatusBadRequest, "Unsupported task type")
+	context := canvas.NewContext(rasterizer.New(img, 1.0))
+	context.SetView(canvas.Identity.Translate(0, opengraph.ImageHeight))
+	scales := render.Scales{
+		Pixel: 1,
+		Tile:  1 / float64(rn.TileSize),
 	}
+	scene.Draw(&rn, context, scales, imageSource)
+	return img
 }
 
-func (*Api) GetCapabilities(w http.ResponseWriter, r *http.Request) {
-	respond(w, r, http.StatusOK, openapi.Capabilities{
-		Search: openapi.Capability{
-			Supported: imageSource.AI.Available(),
-		},
-		Tags: openapi.Capability{
-			Supported: tagsEnabled,
-		},
-	})
+func (*Api) GetCollectionsIdPreview(w http.ResponseWriter, r *http.Request, id openapi.CollectionId) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+	img := renderCollectionPreview(c)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=3600") // 1 hour, new photos show up eventually
+	encodeTile(w, img)
 }
 
-func (*Api) GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdTilesParams) {
-	startTime := time.Now()
+func (*Api) GetCollectionsIdFeed(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.GetCollectionsIdFeedParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
 
-	if tileRequestConfig.Concurrency == 0 {
-		GetScenesSceneIdTilesImpl(w, r, sceneId, params)
-	} else {
-		request := TileRequest{
-			Request:  r,
-			Response: w,
-			Priority: GetTilesRequestPriority(params),
-			Process:  make(chan struct{}),
-			Done:     make(chan struct{}),
-		}
-		pushTileRequest(request)
-		<-request.Process
-		GetScenesSceneIdTilesImpl(w, r, sceneId, params)
-		request.Done <- struct{}{}
+	format := feed.Atom
+	if params.Format != nil {
+		format = feed.Format(*params.Format)
 	}
-
-	endTime := time.Now()
-	if tileRequestConfig.LogStats {
-		millis := endTime.Sub(startTime).Milliseconds()
-		fmt.Printf("%4d, %4d, %4d, %4d\n", GetTilesRequestPriority(params), startTime.Sub(startupTime).Milliseconds(), endTime.Sub(startupTime).Milliseconds(), millis)
+	switch format {
+	case feed.Atom, feed.RSS, feed.JSON:
+	default:
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Format must be atom, rss or json").With("parameter", "format").Write(w, r)
+		return
 	}
-}
 
-func GetTilesRequestPriority(params openapi.GetScenesSceneIdTilesParams) int8 {
-	zoom := params.Zoom
-	if zoom >= 0 && zoom < 100 {
-		return int8(zoom)
+	limit := 50
+	if params.Limit != nil {
+		limit = *params.Limit
 	}
-	return 100
-}
-
-func GetScenesSceneIdTilesImpl(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdTilesParams) {
-	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
-	if scene == nil {
-		problem(w, r, http.StatusBadRequest, "Scene not found")
+	if limit < 1 || limit > 500 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Limit must be between 1 and 500").With("parameter", "limit").Write(w, r)
 		return
 	}
 
-	rn := defaultSceneConfig.Render
-	rn.TileSize = params.TileSize
-	if params.Sources != nil {
-		rn.Sources = make(pfio.Sources, len(*params.Sources))
-		for _, src := range imageSource.Sources {
-			for i, name := range *params.Sources {
-				if src.Name() == name {
-					if rn.Sources[i] != nil {
-						problem(w, r, http.StatusBadRequest, "Duplicate source")
-						return
-					}
-					rn.Sources[i] = src
-				}
-			}
+	base := requestBaseUrl(r)
+	// The API may be mounted under any prefix
+	api := base + strings.TrimSuffix(r.URL.Path, fmt.Sprintf("/collections/%s/feed", id))
+	thumbnail := feedConfig.ThumbnailSource()
+
+	f := feed.Feed{
+		Id:    fmt.Sprintf("%s/collections/%s", base, url.PathEscape(c.Id)),
+		Title: c.Name,
+		Link:  fmt.Sprintf("%s/collections/%s", base, url.PathEscape(c.Id)),
+		Self:  base + r.URL.RequestURI(),
+	}
+	options := image.ListOptions{
+		Limit:  limit,
+		Ignore: c.Ignore,
+		Hide:   imageSource.Private.Tags,
+	}
+	for added := range imageSource.ListRecentlyAdded(append([]string(nil), c.Dirs...), options) {
+		name := filepath.Base(added.Path)
+		item := feed.Item{
+			Id:        fmt.Sprintf("%s/files/%d", api, added.Id),
+			Title:     name,
+			Link:      fmt.Sprintf("%s/files/%d/original/%s", api, added.Id, url.PathEscape(name)),
+			MimeType:  mime.TypeByExtension(strings.ToLower(filepath.Ext(name))),
+			Thumbnail: fmt.Sprintf("%s/files/%d/variants/%s/%s.jpg", api, added.Id, thumbnail, url.PathEscape(name)),
+			Added:     added.AddedAt,
+			Width:     added.Width,
+			Height:    added.Height,
 		}
-		for _, src := range rn.Sources {
-			if src == nil {
-				problem(w, r, http.StatusBadRequest, "Unknown source")
-				return
-			}
+		// Files without metadata yet have the unix epoch as their date
+		if added.DateTime.After(time.Unix(0, 0)) {
+			item.Taken = added.DateTime
 		}
-	}
-
-	if params.SelectTag != nil {
-		t, err := tag.FromNameRev(string(*params.SelectTag))
-		if err != nil {
-			problem(w, r, http.StatusBadRequest, "Invalid tag id")
-			return
+		if item.MimeType == "" {
+			item.MimeType = "application/octet-stream"
 		}
-		id, ok := imageSource.GetTagId(t.Name)
-		if !ok {
-			problem(w, r, http.StatusBadRequest, "Unknown tag")
-			return
+		if item.Added.After(f.Updated) {
+			f.Updated = item.Added
 		}
-		rn.Selected = imageSource.GetTagImageIds(id)
-	}
-
-	if params.DebugOverdraw != nil {
-		rn.DebugOverdraw = *params.DebugOverdraw
+		f.Items = append(f.Items, item)
 	}
-	if params.DebugThumbnails != nil {
-		rn.DebugThumbnails = *params.DebugThumbnails
+	if f.Updated.IsZero() {
+		f.Updated = startupTime
 	}
 
-	zoom := params.Zoom
-	x := int(params.X)
-	y := int(params.Y)
-	rn.BackgroundColor = color.White
-	if params.BackgroundColor != nil {
-		c, err := hex.DecodeString(strings.TrimPrefix(*params.BackgroundColor, "#"))
-		if err != nil {
-			problem(w, r, http.StatusBadRequest, "Invalid background color")
-			return
-		}
-		rn.BackgroundColor = color.RGBA{
-			A: 0xFF,
-			R: c[0],
-			G: c[1],
-			B: c[2],
-		}
+	b, err := f.Render(format)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
 	}
-
-	img, context := getTileImage(&rn)
-	defer putTileImage(&rn, img)
-	rn.CanvasImage = img
-	rn.Zoom = zoom
-	drawTile(context, &rn, scene, zoom, x, y)
-
-	w.Header().Add("Cache-Control", "max-age=86400") // 1 day
-	codec.EncodeJpeg(w, img)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
 }
 
-func (*Api) GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdDatesParams) {
-	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
-	if scene == nil {
-		problem(w, r, http.StatusBadRequest, "Scene not found")
+func (*Api) PostCollectionsIdFiles(w http.ResponseWriter, r *http.Request, id openapi.CollectionId) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 		return
 	}
-
-	minHeight := 1
-	maxHeight := 10000
-
-	if params.Height < minHeight {
-		problem(w, r, http.StatusBadRequest, fmt.Sprintf("Minimum height is %v", minHeight))
+	if !c.Upload.Enabled() {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Uploads are not enabled for the collection")
 		return
 	}
 
-	if params.Height > maxHeight {
-		problem(w, r, http.StatusBadRequest, fmt.Sprintf("Maximum height is %v", maxHeight))
+	mr, err := r.MultipartReader()
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
 		return
 	}
 
-	timestamps := scene.GetTimestamps(params.Height, imageSource)
-	w.Header().Add("Content-Type", "application/octet-stream")
-	chirender.Status(r, http.StatusOK)
-	binary.Write(w, binary.LittleEndian, timestamps)
-}
-
-func (*Api) GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdRegionsParams) {
-
-	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
-	if scene == nil {
-		problem(w, r, http.StatusBadRequest, "Scene not found")
+	files := make([]openapi.UploadedFile, 0)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		name := part.FileName()
+		fileId, path, err := c.Ingest(name, part, imageSource)
+		part.Close()
+		switch {
+		case errors.Is(err, collection.ErrInvalidName) || errors.Is(err, collection.ErrUnsupportedType):
+			problem.New(http.StatusBadRequest, problem.Unsupported, fmt.Sprintf("%s: %s", name, err.Error())).With("filename", name).Write(w, r)
+			return
+		case errors.Is(err, collection.ErrTooLarge):
+			problem.New(http.StatusRequestEntityTooLarge, problem.InvalidBody, fmt.Sprintf("%s: %s", name, err.Error())).With("filename", name).Write(w, r)
+			return
+		case err != nil:
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+			return
+		}
+		files = append(files, openapi.UploadedFile{
+			Id:       openapi.FileId(fileId),
+			Filename: name,
+			Path:     path,
+		})
+	}
+	if len(files) == 0 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "No files uploaded").With("parameter", "file").Write(w, r)
 		return
 	}
 
-	bounds := render.Rect{
-		X: float64(params.X),
-		Y: float64(params.Y),
-		W: float64(params.W),
-		H: float64(params.H),
+	ids := make([]image.ImageId, len(files))
+	for i, f := range files {
+		ids[i] = image.ImageId(f.Id)
 	}
+	audit(r, image.AuditFileUpload, c.Id, fileIds(ids...), nil)
 
-	regions := scene.GetRegions(&defaultSceneConfig.Render, bounds, params.Limit)
-
-	respond(w, r, http.StatusOK, struct {
-		Items []render.Region `json:"items"`
+	respond(w, r, http.StatusCreated, struct {
+		Items []openapi.UploadedFile `json:"items"`
 	}{
-		Items: regions,
+		Items: files,
 	})
 }
 
-func (*Api) GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, id openapi.RegionId) {
-
-	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
-	if scene == nil {
-		problem(w, r, http.StatusBadRequest, "Scene not found")
-		return
+func newApiIndexChanges(c image.IndexChanges) openapi.IndexChanges {
+	samples := c.Samples
+	if samples == nil {
+		samples = []string{}
 	}
-
-	region := scene.GetRegion(int(id))
-	if region.Id <= 0 {
-		http.Error(w, "Region not found", http.StatusNotFound)
-		return
+	return openapi.IndexChanges{
+		Count:   c.Count,
+		Samples: samples,
 	}
+}
 
-	respond(w, r, http.StatusOK, region)
+func newApiIndexReport(report image.IndexReport) openapi.IndexReport {
+	return openapi.IndexReport{
+		Found:    report.Found,
+		Added:    newApiIndexChanges(report.Added),
+		Removed:  newApiIndexChanges(report.Removed),
+		Rehashed: newApiIndexChanges(report.Rehashed),
+		Metadata: newApiIndexChanges(report.Metadata),
+		Contents: newApiIndexChanges(report.Contents),
+	}
 }
 
-func (*Api) GetTags(w http.ResponseWriter, r *http.Request, params openapi.GetTagsParams) {
+func dryRunIndex(collection *collection.Collection, samples int) image.IndexReport {
+	return imageSource.DryRunIndex(collection.Dirs, collection.IndexLimit, collection.Walk, collection.Ignore, samples)
+}
 
-	q := ""
-	if params.Q != nil {
-		q = string(*params.Q)
+func (*Api) GetCollectionsIdIndexReport(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.GetCollectionsIdIndexReportParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
 	}
+	samples := 10
+	if params.Samples != nil {
+		if *params.Samples < 0 || *params.Samples > 1000 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Samples must be between 0 and 1000").With("parameter", "samples").Write(w, r)
+			return
+		}
+		samples = *params.Samples
+	}
+	respond(w, r, http.StatusOK, newApiIndexReport(dryRunIndex(c, samples)))
+}
 
-	tags := make([]tag.Tag, 0)
-	for t := range imageSource.ListTags(q, 10) {
-		tags = append(tags, t)
+func newApiStorageStats(stats image.StorageStats) openapi.StorageStats {
+	s := openapi.StorageStats{
+		Files:      stats.Files,
+		Bytes:      stats.Bytes,
+		Unsized:    stats.Unsized,
+		Extensions: make([]openapi.ExtensionUsage, len(stats.Extensions)),
+		Dirs:       make([]openapi.DirUsage, len(stats.Dirs)),
+		Largest:    make([]openapi.FileSize, len(stats.Largest)),
+		Duplicates: openapi.StorageUsage{
+			Files: stats.Duplicates.Files,
+			Bytes: stats.Duplicates.Bytes,
+		},
+	}
+	for i, e := range stats.Extensions {
+		s.Extensions[i] = openapi.ExtensionUsage{
+			Extension: e.Extension,
+			Files:     e.Files,
+			Bytes:     e.Bytes,
+		}
+	}
+	for i, d := range stats.Dirs {
+		s.Dirs[i] = openapi.DirUsage{
+			Path:  d.Dir,
+			Files: d.Files,
+			Bytes: d.Bytes,
+		}
 	}
+	for i, f := range stats.Largest {
+		s.Largest[i] = openapi.FileSize{
+			Id:    openapi.FileId(f.Id),
+			Path:  f.Path,
+			Bytes: f.Bytes,
+		}
+	}
+	return s
+}
 
-	respond(w, r, http.StatusOK, struct {
-		Items []tag.Tag `json:"items"`
-	}{
-		Items: tags,
-	})
+func (*Api) GetCollectionsIdStorage(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.GetCollectionsIdStorageParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+	top := 20
+	if params.Top != nil {
+		if *params.Top < 0 || *params.Top > 1000 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Top must be between 0 and 1000").With("parameter", "top").Write(w, r)
+			return
+		}
+		top = *params.Top
+	}
+	stats := imageSource.StorageStats(append([]string(nil), c.Dirs...), top)
+	respond(w, r, http.StatusOK, newApiStorageStats(stats))
 }
 
-func (*Api) PostTags(w http.ResponseWriter, r *http.Request) {
+func newApiLibraryStats(stats image.LibraryStats) openapi.LibraryStats {
+	s := openapi.LibraryStats{
+		Files:             stats.Files,
+		Photos:            stats.Photos,
+		Videos:            stats.Videos,
+		VideoHours:        stats.VideoDuration.Hours(),
+		AverageMegapixels: stats.AverageMegapixels,
+		Years:             make([]openapi.YearCount, len(stats.Years)),
+		Cameras:           make([]openapi.CameraCount, len(stats.Cameras)),
+		Countries:         make([]openapi.Place, len(stats.Countries)),
+		Tags:              make([]openapi.TagCount, len(stats.Tags)),
+		TagCount:          stats.TagCount,
+		Coverage: openapi.IndexCoverage{
+			Metadata:   stats.Coverage.Metadata,
+			Thumbnails: stats.Coverage.Thumbnails,
+			Embeddings: stats.Coverage.Embeddings,
+		},
+	}
+	for i, y := range stats.Years {
+		s.Years[i] = openapi.YearCount{Year: y.Year, Count: y.Count}
+	}
+	for i, c := range stats.Cameras {
+		s.Cameras[i] = openapi.CameraCount{Camera: newApiCamera(c.Camera), Count: c.Count}
+	}
+	for i, p := range stats.Countries {
+		s.Countries[i] = newApiPlace(p)
+	}
+	for i, t := range stats.Tags {
+		s.Tags[i] = openapi.TagCount{Name: t.Name, Count: t.Count}
+	}
+	return s
+}
 
-	data := &openapi.TagsPost{}
-	if err := chirender.Decode(r, data); err != nil {
-		problem(w, r, http.StatusBadRequest, err.Error())
+func (*Api) GetCollectionsIdStats(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.GetCollectionsIdStatsParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 		return
 	}
+	top := 20
+	if params.Top != nil {
+		if *params.Top < 0 || *params.Top > 1000 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Top must be between 0 and 1000").With("parameter", "top").Write(w, r)
+			return
+		}
+		top = *params.Top
+	}
+	stats := imageSource.LibraryStats(append([]string(nil), c.Dirs...), top)
+	respond(w, r, http.StatusOK, newApiLibraryStats(stats))
+}
 
-	if data.Selection == nil {
-		problem(w, r, http.StatusBadRequest, "Only selection supported")
+// Maximum size of an image uploaded to find similar files
+const maxSimilarImageSize = 32 << 20
+
+func (*Api) PostCollectionsIdSimilar(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.PostCollectionsIdSimilarParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 		return
 	}
-
-	if data.CollectionId == nil {
-		problem(w, r, http.StatusBadRequest, "collection_id required")
+	limit := 20
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > 1000 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Limit must be between 1 and 1000").With("parameter", "limit").Write(w, r)
+			return
+		}
+		limit = *params.Limit
+	}
+	if !imageSource.AI.Available() {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "AI server not configured")
 		return
 	}
 
-	t, err := tag.NewSelection(string(*data.CollectionId))
+	r.Body = http.MaxBytesReader(w, r.Body, maxSimilarImageSize)
+	mr, err := r.MultipartReader()
 	if err != nil {
-		problem(w, r, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
 		return
 	}
-	imageSource.AddTag(t.Name)
+	var embedding clip.Embedding
+	for embedding == nil {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "No image uploaded").With("parameter", "file").Write(w, r)
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		embedding, err = imageSource.Clip.EmbedImageReader(part)
+		part.Close()
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			problem.New(http.StatusRequestEntityTooLarge, problem.InvalidBody, fmt.Sprintf("Image larger than %d bytes", maxSimilarImageSize)).Write(w, r)
+			return
+		case err != nil:
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.AIUnavailable, err.Error())
+			return
+		}
+	}
 
-	tag, exists := imageSource.GetTag(t.Name)
-	if !exists {
-		problem(w, r, http.StatusInternalServerError, err.Error())
-		return
+	infos := c.GetSimilar(imageSource, embedding, image.ListOptions{
+		Hide: imageSource.Private.Tags,
+	})
+	items := make([]openapi.SimilarFile, 0, limit)
+	for info := range infos {
+		path, err := imageSource.GetImagePath(info.Id)
+		if err != nil {
+			continue
+		}
+		items = append(items, openapi.SimilarFile{
+			Id:         openapi.FileId(info.Id),
+			Filename:   filepath.Base(path),
+			Similarity: info.Similarity,
+		})
+		if len(items) >= limit {
+			break
+		}
 	}
+	// Sorted up front, so the rest only has to be drained
+	go func() {
+		for range infos {
+		}
+	}()
 
-	respond(w, r, http.StatusCreated, struct {
-		Id openapi.TagId `json:"id"`
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.SimilarFile `json:"items"`
 	}{
-		Id: openapi.TagId(tag.NameRev()),
+		Items: items,
 	})
 }
 
-func (*Api) PostTagsIdFiles(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
-
-	data := &openapi.TagFilesPost{}
-	if err := chirender.Decode(r, data); err != nil {
-		problem(w, r, http.StatusBadRequest, err.Error())
+func (*Api) PostCollectionsIdGeotag(w http.ResponseWriter, r *http.Request, id openapi.CollectionId, params openapi.PostCollectionsIdGeotagParams) {
+	c := getCollectionById(string(id))
+	if c == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
 		return
 	}
 
-	t, err := imageSource.GetOrCreateTagFromNameRev(string(id))
+	options := image.GeotagOptions{
+		MaxGap: 5 * time.Minute,
+	}
+	if params.TimeOffset != nil {
+		options.TimeOffset = time.Duration(*params.TimeOffset) * time.Second
+	}
+	if params.MaxGap != nil {
+		if *params.MaxGap < 1 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid max gap").With("parameter", "max_gap").Write(w, r)
+			return
+		}
+		options.MaxGap = time.Duration(*params.MaxGap) * time.Second
+	}
+	options.Overwrite = params.Overwrite != nil && *params.Overwrite
+	options.WriteXmp = params.WriteXmp != nil && *params.WriteXmp
+	options.DryRun = params.DryRun != nil && *params.DryRun
+
+	mr, err := r.MultipartReader()
 	if err != nil {
-		problem(w, r, http.StatusBadRequest, err.Error())
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
 		return
 	}
 
-	ids := make(chan image.ImageId, 100)
-	if data.SceneId != nil && data.Bounds != nil {
-		scene := sceneSource.GetSceneById(string(*data.SceneId), imageSource)
-		if scene == nil {
-			problem(w, r, http.StatusBadRequest, "Scene not found")
+	var tracks []track.Track
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
 			return
 		}
-
-		bounds := render.Rect{
-			X: float64(data.Bounds.X),
-			Y: float64(data.Bounds.Y),
-			W: float64(data.Bounds.W),
-			H: float64(data.Bounds.H),
+		if part.FormName() != "file" {
+			part.Close()
+			continue
 		}
-
-		go func() {
-			defer close(ids)
-			photos := scene.GetVisiblePhotos(bounds)
-			for p := range photos {
-				ids <- image.ImageId(p.Id)
-			}
-		}()
-	} else if data.FileId != nil {
-		go func() {
-			defer close(ids)
-			ids <- image.ImageId(*data.FileId)
-		}()
-	} else {
-		problem(w, r, http.StatusBadRequest, "Either scene_id+bounds or file_id required")
+		name := part.FileName()
+		t, err := track.Parse(part)
+		part.Close()
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.InvalidBody, fmt.Sprintf("%s: %s", name, err.Error())).With("filename", name).Write(w, r)
+			return
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "No tracks uploaded").With("parameter", "file").Write(w, r)
 		return
 	}
 
-	var rev int
-	switch data.Op {
+	points := track.Merge(tracks...)
+	result, err := imageSource.Geotag(c.Dirs, points, options)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	if !options.DryRun && len(result.Geotagged) > 0 {
+		sceneSource.Invalidate(layout.Timeline, layout.Map)
+		audit(r, image.AuditGeotag, c.Id, fileIds(result.Geotagged...), map[string]any{
+			"points":      len(points),
+			"time_offset": options.TimeOffset.Seconds(),
+			"write_xmp":   options.WriteXmp,
+		})
+	}
+
+	geotagged := make([]openapi.FileId, len(result.Geotagged))
+	for i, id := range result.Geotagged {
+		geotagged[i] = openapi.FileId(id)
+	}
+	respond(w, r, http.StatusOK, openapi.GeotagResult{
+		Points:     len(points),
+		Geotagged:  geotagged,
+		Located:    result.Located,
+		Unmatched:  result.Unmatched,
+		XmpWritten: result.XmpWritten,
+	})
+}
+
+func gatherIntFromMetric(value *int, metric *io_prometheus_client.MetricFamily, name string) {
+	if metric.Name == nil || metric.Type == nil || *metric.Name != name {
+		return
+	}
+	switch *metric.Type {
+	case io_prometheus_client.MetricType_GAUGE:
+		m := metric.Metric[0]
+		if m == nil {
+			return
+		}
+		g := m.Gauge
+		if g == nil {
+			return
+		}
+		*value = int(*g.Value)
+	case io_prometheus_client.MetricType_COUNTER:
+		m := metric.Metric[0]
+		if m == nil {
+			return
+		}
+		c := m.Counter
+		if c == nil {
+			return
+		}
+		*value = int(*c.Value)
+	default:
+		panic("Unsupported gather metric type")
+	}
+}
+
+func (*Api) GetTasks(w http.ResponseWriter, r *http.Request, params openapi.GetTasksParams) {
+	tasks, err := listTasks(func(t Task) bool {
+		if params.Type != nil && t.Type != string(*params.Type) {
+			return false
+		}
+		if params.CollectionId != nil && t.CollectionId != string(*params.CollectionId) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Unable to gather metrics")
+		return
+	}
+
+	respond(w, r, http.StatusOK, struct {
+		Items []Task `json:"items"`
+	}{
+		Items: tasks,
+	})
+}
+
+// listTasks returns the running tasks matching the filter with their
+// progress, sorted by id
+func listTasks(filter func(t Task) bool) ([]Task, error) {
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]Task, 0)
+	globalTasks.Range(func(key, value interface{}) bool {
+		t := value.(Task)
+
+		add := filter(t)
+
+		if t.Queue != "" {
+			for _, m := range metrics {
+				gatherIntFromMetric(&t.Pending, m, fmt.Sprintf("pf_%s_pending", t.Queue))
+				gatherIntFromMetric(&t.Done, m, fmt.Sprintf("pf_%s_done", t.Queue))
+			}
+			if t.Pending > 0 {
+				t.Done -= t.Offset
+			} else {
+				t.Offset = t.Done
+				globalTasks.Store(t.Id, t)
+				add = false
+			}
+		}
+		if add {
+			tasks = append(tasks, t)
+		}
+		return true
+	})
+
+	sort.Slice(tasks, func(i, j int) bool {
+		a := tasks[i]
+		b := tasks[j]
+		return a.Id < b.Id
+	})
+	return tasks, nil
+}
+
+func (*Api) PostTasks(w http.ResponseWriter, r *http.Request) {
+	data := &openapi.PostTasksJSONBody{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	collection := getCollectionById(string(data.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	scope, parameter, err := newIndexScope(collection, data.Path, data.Glob)
+	if err != nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", parameter).Write(w, r)
+		return
+	}
+	if scope.label != "" {
+		switch data.Type {
+		case openapi.TaskTypeINDEXFILES,
+			openapi.TaskTypeINDEXMETADATA,
+			openapi.TaskTypeINDEXCONTENTS,
+			openapi.TaskTypeINDEXCONTENTSCOLOR,
+			openapi.TaskTypeINDEXCONTENTSAI:
+		default:
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Only index tasks support a path or glob")
+			return
+		}
+	}
+
+	auditTask := func() {
+		details := map[string]any{
+			"type": data.Type,
+		}
+		if data.Path != nil {
+			details["path"] = *data.Path
+		}
+		if data.Glob != nil {
+			details["glob"] = *data.Glob
+		}
+		audit(r, image.AuditTask, collection.Id, nil, details)
+	}
+
+	switch data.Type {
+
+	case openapi.TaskTypeINDEXFILES:
+		task, existing := indexCollectionScope(collection, scope)
+		if existing {
+			respond(w, r, http.StatusConflict, task)
+		} else {
+			auditTask()
+			respond(w, r, http.StatusAccepted, task)
+		}
+
+	case openapi.TaskTypeINDEXMETADATA:
+		imageSource.IndexMetadataMatching(scope.dirs, collection.IndexLimit, image.Missing{
+			Metadata: true,
+		}, scope.include)
+		stored, _ := globalTasks.Load("index-metadata")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeINDEXCONTENTS:
+		imageSource.IndexContentsMatching(scope.dirs, collection.IndexLimit, image.Missing{
+			Color:     true,
+			Embedding: true,
+		}, scope.include)
+		stored, _ := globalTasks.Load("index-contents")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeINDEXCONTENTSCOLOR:
+		imageSource.IndexContentsMatching(scope.dirs, collection.IndexLimit, image.Missing{
+			Color: true,
+		}, scope.include)
+		stored, _ := globalTasks.Load("index-contents")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeINDEXCONTENTSAI:
+		imageSource.IndexContentsMatching(scope.dirs, collection.IndexLimit, image.Missing{
+			Embedding: true,
+		}, scope.include)
+		stored, _ := globalTasks.Load("index-contents")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTORIENTATION:
+		if !imageSource.AI.Available() {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "AI server not configured")
+			return
+		}
+		imageSource.DetectOrientation(collection.Dirs, collection.IndexLimit)
+		stored, _ := globalTasks.Load("detect-orientation")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTPANORAMAS:
+		imageSource.DetectPanoramas(collection.Dirs)
+		stored, _ := globalTasks.Load("detect-panoramas")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTNSFW:
+		if !imageSource.AI.Available() {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "AI server not configured")
+			return
+		}
+		nsfw := imageSource.Private.Nsfw
+		if len(nsfw.Prompts) == 0 || nsfw.Tag == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "NSFW prompts or tag not configured")
+			return
+		}
+		imageSource.DetectNsfw(collection.Dirs)
+		stored, _ := globalTasks.Load("detect-nsfw")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTKINDS:
+		imageSource.DetectKinds(collection.Dirs)
+		stored, _ := globalTasks.Load("detect-kinds")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTTRIPS:
+		imageSource.DetectTrips(collection.Id, collection.Dirs)
+		stored, _ := globalTasks.Load("detect-trips")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeDETECTSUBJECTS:
+		if !imageSource.AI.Available() {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "AI server not configured")
+			return
+		}
+		if len(imageSource.Subjects.Classes) == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Subject classes not configured")
+			return
+		}
+		imageSource.DetectSubjects(collection.Id, collection.Dirs)
+		stored, _ := globalTasks.Load("detect-subjects")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeAUDITORIENTATION:
+		imageSource.AuditOrientation(append([]string(nil), collection.Dirs...), collection.IndexLimit)
+		stored, _ := globalTasks.Load("audit-orientation")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	case openapi.TaskTypeVERIFYCHECKSUMS:
+		if !imageSource.ContentHash.Enable {
+			problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Content hashes not enabled")
+			return
+		}
+		imageSource.VerifyChecksums(append([]string(nil), collection.Dirs...), collection.IndexLimit)
+		stored, _ := globalTasks.Load("verify-checksums")
+		task := stored.(Task)
+		auditTask()
+		respond(w, r, http.StatusAccepted, task)
+
+	default:
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Unsupported task type")
+	}
+}
+
+func (*Api) PostQuery(w http.ResponseWriter, r *http.Request, params openapi.PostQueryParams) {
+	if !queryConfig.Enable {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "SQL queries are not enabled")
+		return
+	}
+
+	data := &openapi.PostQueryJSONBody{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	limit := queryConfig.Rows()
+	if data.Limit != nil && *data.Limit < limit {
+		limit = *data.Limit
+	}
+	if limit < 1 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Limit must be at least 1").With("parameter", "limit").Write(w, r)
+		return
+	}
+
+	asCsv := strings.Contains(r.Header.Get("Accept"), "text/csv")
+	if params.Format != nil {
+		asCsv = *params.Format == "csv"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), queryConfig.Duration())
+	defer cancel()
+
+	var writer queryWriter
+	if asCsv {
+		writer = newCsvQueryWriter(w)
+	} else {
+		writer = newJsonQueryWriter(w)
+	}
+
+	started := false
+	truncated, err := imageSource.Query(ctx, data.Sql, limit, func(columns []string) error {
+		started = true
+		return writer.Columns(columns)
+	}, writer.Row)
+	if err != nil && !started {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidQuery, err.Error())
+		return
+	}
+	writer.End(truncated, err)
+}
+
+// queryWriter streams the rows of a query as they are read
+type queryWriter interface {
+	Columns(names []string) error
+	Row(values []any) error
+	End(truncated bool, err error)
+}
+
+type jsonQueryWriter struct {
+	w    http.ResponseWriter
+	rows int
+}
+
+func newJsonQueryWriter(w http.ResponseWriter) *jsonQueryWriter {
+	return &jsonQueryWriter{w: w}
+}
+
+func (q *jsonQueryWriter) Columns(names []string) error {
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	q.w.Header().Set("Content-Type", "application/json")
+	q.w.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprintf(q.w, `{"columns":%s,"rows":[`, b)
+	return err
+}
+
+func (q *jsonQueryWriter) Row(values []any) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if q.rows > 0 {
+		q.w.Write([]byte(","))
+	}
+	q.rows++
+	_, err = q.w.Write(b)
+	return err
+}
+
+func (q *jsonQueryWriter) End(truncated bool, err error) {
+	fmt.Fprintf(q.w, `],"truncated":%t`, truncated)
+	if err != nil {
+		b, _ := json.Marshal(err.Error())
+		fmt.Fprintf(q.w, `,"error":%s`, b)
+	}
+	q.w.Write([]byte("}"))
+}
+
+// csvQueryWriter writes the rows as CSV with a header row. Blobs are
+// base64 encoded and nulls are empty.
+type csvQueryWriter struct {
+	w      http.ResponseWriter
+	csv    *csv.Writer
+	record []string
+}
+
+func newCsvQueryWriter(w http.ResponseWriter) *csvQueryWriter {
+	return &csvQueryWriter{w: w, csv: csv.NewWriter(w)}
+}
+
+func (q *csvQueryWriter) Columns(names []string) error {
+	q.w.Header().Set("Content-Type", "text/csv")
+	q.w.Header().Set("Trailer", "X-Query-Error, X-Query-Truncated")
+	q.w.WriteHeader(http.StatusOK)
+	q.record = make([]string, len(names))
+	return q.csv.Write(names)
+}
+
+func (q *csvQueryWriter) Row(values []any) error {
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			q.record[i] = ""
+		case []byte:
+			q.record[i] = base64.StdEncoding.EncodeToString(v)
+		case float64:
+			q.record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			q.record[i] = fmt.Sprint(v)
+		}
+	}
+	return q.csv.Write(q.record)
+}
+
+func (q *csvQueryWriter) End(truncated bool, err error) {
+	q.csv.Flush()
+	if truncated {
+		q.w.Header().Set("X-Query-Truncated", "true")
+	}
+	if err != nil {
+		q.w.Header().Set("X-Query-Error", err.Error())
+	}
+}
+
+// Longest CPU profile, execution trace or fgprof profile that can be
+// requested, so that a forgotten profile does not slow the server for long
+const maxProfileSeconds = 60
+
+// Held while a profile is recorded, as concurrent profiles skew each other
+var profiling sync.Mutex
+
+// guardProfiles limits profiles recorded over a duration to one at a time
+// and at most maxProfileSeconds long
+func guardProfiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "profile", "trace", "fgprof":
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			seconds, err := strconv.Atoi(s)
+			if err != nil || seconds < 1 || seconds > maxProfileSeconds {
+				problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Seconds must be between 1 and %d", maxProfileSeconds)).With("parameter", "seconds").Write(w, r)
+				return
+			}
+		}
+		if !profiling.TryLock() {
+			problem.Write(w, r, http.StatusConflict, problem.Conflict, "Another profile is being recorded")
+			return
+		}
+		defer profiling.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+type DiagnosticsMemory struct {
+	Alloc          uint64  `json:"alloc"`
+	Sys            uint64  `json:"sys"`
+	HeapObjects    uint64  `json:"heap_objects"`
+	GcCount        uint32  `json:"gc_count"`
+	GcPauseTotalMs float64 `json:"gc_pause_total_ms"`
+}
+
+type DiagnosticsInstance struct {
+	Role   instance.Role `json:"role"`
+	Writer string        `json:"writer"`
+}
+
+type Diagnostics struct {
+	Version           string               `json:"version"`
+	UptimeSeconds     int                  `json:"uptime_seconds"`
+	Goroutines        int                  `json:"goroutines"`
+	Memory            DiagnosticsMemory    `json:"memory"`
+	Queues            []metrics.QueueStats `json:"queues"`
+	Caches            []metrics.CacheStats `json:"caches"`
+	Database          image.DatabaseStats  `json:"database"`
+	Instance          DiagnosticsInstance  `json:"instance"`
+	TileRequests      int                  `json:"tile_requests"`
+	MaxProfileSeconds int                  `json:"max_profile_seconds"`
+}
+
+func (*Api) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	tileRequestsMutex.Lock()
+	pendingTiles := len(tileRequests)
+	tileRequestsMutex.Unlock()
+
+	respond(w, r, http.StatusOK, Diagnostics{
+		Version:       version,
+		UptimeSeconds: int(time.Since(startupTime).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: DiagnosticsMemory{
+			Alloc:          mem.Alloc,
+			Sys:            mem.Sys,
+			HeapObjects:    mem.HeapObjects,
+			GcCount:        mem.NumGC,
+			GcPauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+		},
+		Queues:   metrics.Queues(),
+		Caches:   metrics.Caches(),
+		Database: imageSource.DatabaseStats(),
+		Instance: DiagnosticsInstance{
+			Role:   instanceRole,
+			Writer: instance.Holder(dataDir),
+		},
+		TileRequests:      pendingTiles,
+		MaxProfileSeconds: maxProfileSeconds,
+	})
+}
+
+func (*Api) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, http.StatusOK, openapi.Capabilities{
+		Search: openapi.Capability{
+			Supported: imageSource.AI.Available(),
+		},
+		Tags: openapi.Capability{
+			Supported: tagsEnabled,
+		},
+	})
+}
+
+func (*Api) GetScenesSceneIdTiles(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdTilesParams) {
+	startTime := time.Now()
+
+	if tileRequestConfig.Concurrency == 0 {
+		GetScenesSceneIdTilesImpl(w, r, sceneId, params, false)
+	} else {
+		request := TileRequest{
+			Request:  r,
+			Response: w,
+			Priority: GetTilesRequestPriority(params),
+			Process:  make(chan struct{}),
+			Done:     make(chan struct{}),
+		}
+		_, waiting := tracing.Start(r.Context(), "tile queue", tracing.Int("priority", int(request.Priority)))
+		queued := time.Now()
+		pushTileRequest(request)
+		<-request.Process
+		reduced := tileRequestConfig.LoadShedding.reduces(time.Since(queued))
+		waiting.SetAttributes(tracing.Bool("reduced", reduced))
+		waiting.End()
+		GetScenesSceneIdTilesImpl(w, r, sceneId, params, reduced)
+		request.Done <- struct{}{}
+	}
+
+	endTime := time.Now()
+	if tileRequestConfig.LogStats {
+		millis := endTime.Sub(startTime).Milliseconds()
+		fmt.Printf("%4d, %4d, %4d, %4d\n", GetTilesRequestPriority(params), startTime.Sub(startupTime).Milliseconds(), endTime.Sub(startupTime).Milliseconds(), millis)
+	}
+}
+
+// Priority of prefetched tiles and above, so that tiles prefetched by
+// the client are only rendered once no visible tiles are waiting
+const PREFETCH_PRIORITY = 64
+
+func GetTilesRequestPriority(params openapi.GetScenesSceneIdTilesParams) int8 {
+	priority := params.Zoom
+	if priority < 0 || priority >= PREFETCH_PRIORITY {
+		priority = PREFETCH_PRIORITY - 1
+	}
+	if params.Priority != nil && *params.Priority == "prefetch" {
+		// Below MAX_PRIORITY, which is never picked
+		priority = PREFETCH_PRIORITY + min(priority, MAX_PRIORITY-1-PREFETCH_PRIORITY)
+	}
+	return int8(priority)
+}
+
+// GetScenesSceneIdTilesImpl writes the tile, drawn from smaller images and
+// encoded at a lower quality if reduced to catch up with the tile queue
+func GetScenesSceneIdTilesImpl(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdTilesParams, reduced bool) {
+	_, loading := tracing.Start(r.Context(), "get scene")
+	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
+	loading.End()
+	if scene == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+		return
+	}
+
+	rn := defaultSceneConfig.Render
+	rn.TileSize = params.TileSize
+	if params.Sources != nil {
+		rn.Sources = make(pfio.Sources, len(*params.Sources))
+		for _, src := range imageSource.Sources {
+			for i, name := range *params.Sources {
+				if src.Name() == name {
+					if rn.Sources[i] != nil {
+						problem.New(http.StatusBadRequest, problem.InvalidParameter, "Duplicate source").With("parameter", "sources").Write(w, r)
+						return
+					}
+					rn.Sources[i] = src
+				}
+			}
+		}
+		for _, src := range rn.Sources {
+			if src == nil {
+				problem.New(http.StatusBadRequest, problem.SourceNotFound, "Unknown source").With("parameter", "sources").Write(w, r)
+				return
+			}
+		}
+	}
+
+	if params.SelectTag != nil {
+		t, err := tag.FromNameRev(string(*params.SelectTag))
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid tag id").With("parameter", "select_tag").Write(w, r)
+			return
+		}
+		id, ok := imageSource.GetTagId(t.Name)
+		if !ok {
+			problem.New(http.StatusBadRequest, problem.TagNotFound, "Unknown tag").With("parameter", "select_tag").Write(w, r)
+			return
+		}
+		rn.Selected = imageSource.GetTagImageIds(id)
+	}
+
+	if params.DebugOverdraw != nil {
+		rn.DebugOverdraw = *params.DebugOverdraw
+	}
+	if params.DebugThumbnails != nil {
+		rn.DebugThumbnails = *params.DebugThumbnails
+	}
+
+	zoom := params.Zoom
+	x := int(params.X)
+	y := int(params.Y)
+	rn.BackgroundColor = color.White
+	if params.BackgroundColor != nil {
+		c, err := hex.DecodeString(strings.TrimPrefix(*params.BackgroundColor, "#"))
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid background color").With("parameter", "background_color").Write(w, r)
+			return
+		}
+		rn.BackgroundColor = color.RGBA{
+			A: 0xFF,
+			R: c[0],
+			G: c[1],
+			B: c[2],
+		}
+	}
+
+	// Returning viewers revalidate the tiles they have without them being
+	// drawn again, unless the scene or the files in the tile changed
+	etag := tileETag(r, scene, rn.TileSize, zoom, x, y)
+	if etagMatches(r, etag) {
+		w.Header().Set("ETag", etag)
+		setCacheControl(w, cacheControlConfig.Tiles)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	matrix, _ := tileView(rn.TileSize, scene, zoom, x, y)
+	sceneSource.AddRecentView(scene.Id, render.GetViewRect(matrix, rn.TileSize))
+
+	if jpeg, ok := tilePrerender.load(scene, &rn, zoom, x, y); ok {
+		w.Header().Set("ETag", etag)
+		setCacheControl(w, cacheControlConfig.Tiles)
+		w.Write(jpeg)
+		return
+	}
+
+	// Identical requests arriving while the tile is drawn, e.g. from several
+	// viewers or fast scrolling, wait for it instead of drawing it again. The
+	// entity tag covers the scene, the query and the photos in the tile, so
+	// it identifies the rendered tile. The render is not canceled with the
+	// first request, as the others still wait for it.
+	quality := 0
+	key := etag
+	if reduced {
+		rn.Detail = tileRequestConfig.LoadShedding.Detail
+		quality = tileRequestConfig.LoadShedding.Quality
+		key += "-reduced"
+	}
+	_, waiting := tracing.Start(r.Context(), "wait tile")
+	v, err, shared := tileRendering.Do(key, func() (interface{}, error) {
+		if tileRequestConfig.BudgetMs > 0 {
+			rn.Deadline = time.Now().Add(time.Duration(tileRequestConfig.BudgetMs) * time.Millisecond)
+		}
+		return renderTile(context.WithoutCancel(r.Context()), rn, scene, zoom, x, y, quality)
+	})
+	waiting.SetAttributes(tracing.Bool("shared", shared))
+	waiting.End()
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	tile := v.(renderedTile)
+
+	if tile.missing > 0 || reduced {
+		// The photos continue loading in the background, so the tile is
+		// expected to be complete if requested again
+		if tile.missing > 0 {
+			w.Header().Add("X-Tile-Incomplete", strconv.Itoa(tile.missing))
+		}
+		// Expected to be at full quality once the queue caught up
+		if reduced {
+			w.Header().Add("X-Tile-Reduced", "1")
+		}
+		w.Header().Add("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("ETag", etag)
+		setCacheControl(w, cacheControlConfig.Tiles)
+	}
+	w.Write(tile.jpeg)
+}
+
+// renderedTile is an encoded tile shared by the requests waiting for it
+type renderedTile struct {
+	jpeg []byte
+	// Photos drawn as placeholders, as the deadline of the render passed
+	missing int
+}
+
+var tileRendering singleflight.Group
+
+// renderTile draws and encodes the tile at the zoom and position at the JPEG
+// quality, the default one if 0
+func renderTile(ctx context.Context, rn render.Render, scene *render.Scene, zoom int, x int, y int, quality int) (renderedTile, error) {
+	img, context := getTileImage(&rn)
+	defer putTileImage(&rn, img)
+	rn.CanvasImage = img
+	rn.Zoom = zoom
+	ctx, drawing := tracing.Start(ctx, "draw tile",
+		tracing.Int("zoom", zoom),
+		tracing.Int("x", x),
+		tracing.Int("y", y),
+		tracing.Int("tile_size", rn.TileSize),
+	)
+	rn.Context = ctx
+	missing := drawTile(context, &rn, scene, zoom, x, y)
+	drawing.SetAttributes(tracing.Int("missing", missing))
+	drawing.End()
+
+	_, encoding := tracing.Start(ctx, "encode tile")
+	defer encoding.End()
+	var b bytes.Buffer
+	if err := encodeTileQuality(&b, img, quality); err != nil {
+		return renderedTile{}, err
+	}
+	return renderedTile{
+		jpeg:    b.Bytes(),
+		missing: missing,
+	}, nil
+}
+
+// encodeTile writes the tile as a JPEG, tagged with the color profile the
+// originals are decoded into, unless it is sRGB, which browsers assume
+func encodeTile(w io.Writer, img goimage.Image) error {
+	return encodeTileQuality(w, img, 0)
+}
+
+// encodeTileQuality encodes the tile like encodeTile at the JPEG quality,
+// the default one if 0
+func encodeTileQuality(w io.Writer, img goimage.Image, quality int) error {
+	encode := func(w io.Writer) error {
+		if quality > 0 {
+			return codec.EncodeJpegQuality(w, img, quality)
+		}
+		return codec.EncodeJpeg(w, img)
+	}
+	profile := imageSource.ColorProfile()
+	if profile == nil || profile.Equal(icc.SRGB()) {
+		return encode(w)
+	}
+	var b bytes.Buffer
+	if err := encode(&b); err != nil {
+		return err
+	}
+	return icc.WriteJPEG(w, b.Bytes(), profile.Data, 0)
+}
+
+// tilePrerenderer draws the zoomed out tiles of scenes in the background
+// once they are built and stores them in a dir, as these tiles show the
+// most photos and are the slowest to draw on first view
+type tilePrerenderer struct {
+	dir    string
+	config TilePrerenderConfig
+	render render.Render
+	scenes chan *render.Scene
+}
+
+// Prerendered tiles of all scenes if prerendering is enabled, nil otherwise
+var tilePrerender *tilePrerenderer
+
+func newTilePrerenderer(dir string, config TilePrerenderConfig, rn render.Render) *tilePrerenderer {
+	if config.MaxZoom <= 0 {
+		config.MaxZoom = 2
+	}
+	if config.TileSize <= 0 {
+		config.TileSize = 512
+	}
+	if config.MaxScenes <= 0 {
+		config.MaxScenes = 16
+	}
+	rn.TileSize = config.TileSize
+	rn.BackgroundColor = color.White
+	return &tilePrerenderer{
+		dir:    dir,
+		config: config,
+		render: rn,
+		scenes: make(chan *render.Scene, 100),
+	}
+}
+
+// add queues the scene to be prerendered, skipping it if it is small
+// enough to be drawn quickly or too many scenes are queued already
+func (p *tilePrerenderer) add(scene *render.Scene) {
+	if len(scene.Photos) < p.config.MinPhotos {
+		return
+	}
+	select {
+	case p.scenes <- scene:
+	default:
+		renderLog.Warn("tile prerender queue full, skipping", "scene", scene.Id)
+	}
+}
+
+func (p *tilePrerenderer) run() {
+	for scene := range p.scenes {
+		p.prerender(scene)
+	}
+}
+
+// matches returns true if tiles drawn with the render config at the zoom
+// level are the same as the prerendered ones
+func (p *tilePrerenderer) matches(rn *render.Render, zoom int) bool {
+	return zoom <= p.config.MaxZoom &&
+		rn.TileSize == p.render.TileSize &&
+		rn.Sources == nil &&
+		rn.Selected == nil &&
+		!rn.DebugOverdraw &&
+		!rn.DebugThumbnails &&
+		color.RGBAModel.Convert(rn.BackgroundColor) == color.RGBAModel.Convert(p.render.BackgroundColor)
+}
+
+func (p *tilePrerenderer) path(scene *render.Scene, zoom int, x int, y int) string {
+	name := fmt.Sprintf("%d-%d-%d-%d-%d.jpg", scene.Revision, p.render.TileSize, zoom, x, y)
+	return filepath.Join(p.dir, scene.Id, name)
+}
+
+// load returns the prerendered tile of the current revision of the scene,
+// or false if there is none for the render config
+func (p *tilePrerenderer) load(scene *render.Scene, rn *render.Render, zoom int, x int, y int) ([]byte, bool) {
+	if p == nil || !p.matches(rn, zoom) {
+		return nil, false
+	}
+	b, err := os.ReadFile(p.path(scene, zoom, x, y))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// prerender draws and stores the tiles of the scene up to the maximum zoom
+// level, replacing the ones of previous revisions
+func (p *tilePrerenderer) prerender(scene *render.Scene) {
+	revision := scene.Revision
+	dir := filepath.Join(p.dir, scene.Id)
+	// Tiles of scenes with the same id drawn by previous runs may differ
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		renderLog.Error("tile prerender unable to create dir", "dir", dir, "err", err)
+		return
+	}
+
+	finished := metrics.Elapsed("tile prerender " + scene.Id)
+	defer finished()
+	for zoom := 0; zoom <= p.config.MaxZoom; zoom++ {
+		n := 1 << zoom
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				// Updated in the meantime, so prerendered again
+				if scene.Revision != revision {
+					return
+				}
+				matrix, _ := tileView(p.render.TileSize, scene, zoom, x, y)
+				if !scene.Bounds.IsVisible(render.GetViewRect(matrix, p.render.TileSize)) {
+					continue
+				}
+				tile, err := renderTile(context.Background(), p.render, scene, zoom, x, y, 0)
+				if err != nil {
+					renderLog.Error("tile prerender unable to draw", "scene", scene.Id, "zoom", zoom, "x", x, "y", y, "err", err)
+					return
+				}
+				if err := p.save(p.path(scene, zoom, x, y), tile.jpeg); err != nil {
+					renderLog.Error("tile prerender unable to save", "scene", scene.Id, "err", err)
+					return
+				}
+			}
+		}
+	}
+	p.prune()
+}
+
+func (p *tilePrerenderer) save(path string, jpeg []byte) error {
+	// Per process, as instances can share the data dir
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, jpeg, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// prune removes the tiles of the least recently prerendered scenes over
+// the maximum
+func (p *tilePrerenderer) prune() {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return
+	}
+	type stored struct {
+		path    string
+		modTime time.Time
+	}
+	var scenes []stored
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		scenes = append(scenes, stored{
+			path:    filepath.Join(p.dir, e.Name()),
+			modTime: info.ModTime(),
+		})
+	}
+	if len(scenes) <= p.config.MaxScenes {
+		return
+	}
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].modTime.After(scenes[j].modTime)
+	})
+	for _, s := range scenes[p.config.MaxScenes:] {
+		os.RemoveAll(s.path)
+	}
+}
+
+func (*Api) GetScenesSceneIdDates(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdDatesParams) {
+	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
+	if scene == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+		return
+	}
+
+	minHeight := 1
+	maxHeight := 10000
+
+	if params.Height < minHeight {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Minimum height is %v", minHeight)).With("parameter", "height").Write(w, r)
+		return
+	}
+
+	if params.Height > maxHeight {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Maximum height is %v", maxHeight)).With("parameter", "height").Write(w, r)
+		return
+	}
+
+	timestamps := scene.GetTimestamps(params.Height, imageSource)
+	w.Header().Add("Content-Type", "application/octet-stream")
+	chirender.Status(r, http.StatusOK)
+	binary.Write(w, binary.LittleEndian, timestamps)
+}
+
+func (*Api) GetScenesSceneIdRegions(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, params openapi.GetScenesSceneIdRegionsParams) {
+
+	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
+	if scene == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+		return
+	}
+
+	bounds := render.Rect{
+		X: float64(params.X),
+		Y: float64(params.Y),
+		W: float64(params.W),
+		H: float64(params.H),
+	}
+
+	regions := scene.GetRegions(&defaultSceneConfig.Render, bounds, params.Limit)
+
+	respond(w, r, http.StatusOK, struct {
+		Items []render.Region `json:"items"`
+	}{
+		Items: regions,
+	})
+}
+
+func (*Api) GetScenesSceneIdRegionsId(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId, id openapi.RegionId) {
+
+	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
+	if scene == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+		return
+	}
+
+	region := scene.GetRegion(int(id))
+	if region.Id <= 0 {
+		problem.Write(w, r, http.StatusNotFound, problem.RegionNotFound, "Region not found")
+		return
+	}
+
+	respond(w, r, http.StatusOK, region)
+}
+
+func (*Api) PostScenesSceneIdPrefetch(w http.ResponseWriter, r *http.Request, sceneId openapi.SceneId) {
+
+	data := &openapi.PrefetchPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	scene := sceneSource.GetSceneById(string(sceneId), imageSource)
+	if scene == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+		return
+	}
+
+	direction := 1
+	if data.Direction != nil && *data.Direction == openapi.PrefetchPostDirectionPREV {
+		direction = -1
+	}
+
+	count := 3
+	if data.Count != nil {
+		count = *data.Count
+	}
+	if count < 1 || count > 10 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Count out of range").With("parameter", "count").Write(w, r)
+		return
+	}
+
+	size := image.Size{}
+	if data.Width != nil && data.Height != nil {
+		size.X = *data.Width
+		size.Y = *data.Height
+	}
+
+	ids := scene.GetAdjacentPhotoIds(image.ImageId(data.FileId), direction, count)
+	items := make([]openapi.FileId, 0, len(ids))
+queue:
+	for _, id := range ids {
+		select {
+		case prefetchQueue <- prefetchRequest{id: id, size: size}:
+			items = append(items, openapi.FileId(id))
+		default:
+			// Hints are best effort, drop the rest if loading falls behind
+			break queue
+		}
+	}
+	respond(w, r, http.StatusAccepted, struct {
+		Items []openapi.FileId `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetTags(w http.ResponseWriter, r *http.Request, params openapi.GetTagsParams) {
+
+	q := ""
+	if params.Q != nil {
+		q = string(*params.Q)
+	}
+
+	tags := make([]tag.Tag, 0)
+	for t := range imageSource.ListTags(q, 10) {
+		tags = append(tags, t)
+	}
+
+	respond(w, r, http.StatusOK, struct {
+		Items []tag.Tag `json:"items"`
+	}{
+		Items: tags,
+	})
+}
+
+func (*Api) PostTags(w http.ResponseWriter, r *http.Request) {
+
+	data := &openapi.TagsPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	if data.Selection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Only selection supported")
+		return
+	}
+
+	if data.CollectionId == nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "collection_id required").With("parameter", "collection_id").Write(w, r)
+		return
+	}
+
+	t, err := tag.NewSelection(string(*data.CollectionId))
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	imageSource.AddTag(t.Name)
+
+	tag, exists := imageSource.GetTag(t.Name)
+	if !exists {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditTagCreate, tag.Name, nil, map[string]any{
+		"collection_id": *data.CollectionId,
+	})
+
+	respond(w, r, http.StatusCreated, struct {
+		Id openapi.TagId `json:"id"`
+	}{
+		Id: openapi.TagId(tag.NameRev()),
+	})
+}
+
+func (*Api) PutTagsId(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
+
+	data := &openapi.TagMeta{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	var meta tag.Meta
+	if data.Color != nil {
+		meta.Color = strings.TrimSpace(*data.Color)
+	}
+	if data.Icon != nil {
+		meta.Icon = strings.TrimSpace(*data.Icon)
+	}
+	if data.Description != nil {
+		meta.Description = strings.TrimSpace(*data.Description)
+	}
+	if data.Pinned != nil {
+		meta.Pinned = *data.Pinned
+	}
+	if !tag.ValidColor(meta.Color) {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid color").With("parameter", "color").Write(w, r)
+		return
+	}
+	if utf8.RuneCountInString(meta.Icon) > 32 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Icon too long").With("parameter", "icon").Write(w, r)
+		return
+	}
+	if utf8.RuneCountInString(meta.Description) > 1000 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Description too long").With("parameter", "description").Write(w, r)
+		return
+	}
+
+	t, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+	err := imageSource.SetTagMeta(t.Id, meta)
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.TagNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditTagUpdate, t.Name, nil, map[string]any{
+		"color":       meta.Color,
+		"icon":        meta.Icon,
+		"description": meta.Description,
+		"pinned":      meta.Pinned,
+	})
+
+	t.Meta = meta
+	respond(w, r, http.StatusOK, t)
+}
+
+func (*Api) PostTagsIdFiles(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
+
+	data := &openapi.TagFilesPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	t, err := imageSource.GetOrCreateTagFromNameRev(string(id))
+	if err != nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", "id").Write(w, r)
+		return
+	}
+
+	ids := make(chan image.ImageId, 100)
+	if data.SceneId != nil && data.Bounds != nil {
+		scene := sceneSource.GetSceneById(string(*data.SceneId), imageSource)
+		if scene == nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+			return
+		}
+
+		bounds := render.Rect{
+			X: float64(data.Bounds.X),
+			Y: float64(data.Bounds.Y),
+			W: float64(data.Bounds.W),
+			H: float64(data.Bounds.H),
+		}
+
+		go func() {
+			defer close(ids)
+			photos := scene.GetVisiblePhotos(bounds)
+			for p := range photos {
+				ids <- image.ImageId(p.Id)
+			}
+		}()
+	} else if data.FileId != nil {
+		go func() {
+			defer close(ids)
+			ids <- image.ImageId(*data.FileId)
+		}()
+	} else {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, "Either scene_id+bounds or file_id required")
+		return
+	}
+
+	affected := image.NewIds()
+	var rev int
+	var action image.AuditAction
+	switch data.Op {
 	case "ADD":
-		rev, err = imageSource.AddTagIds(t.Id, ids)
+		action = image.AuditTagAdd
+		rev, err = imageSource.AddTagIds(t.Id, collectIds(ids, affected))
 	case "SUBTRACT":
-		rev, err = imageSource.RemoveTagIds(t.Id, ids)
+		action = image.AuditTagRemove
+		rev, err = imageSource.RemoveTagIds(t.Id, collectIds(ids, affected))
 	case "INVERT":
-		rev, err = imageSource.InvertTagIds(t.Id, ids)
+		action = image.AuditTagInvert
+		rev, err = imageSource.InvertTagIds(t.Id, collectIds(ids, affected))
+	default:
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid op").With("parameter", "op").Write(w, r)
+		return
+	}
+	t.Revision = rev
+
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, action, t.Name, affected, map[string]any{
+		"revision": rev,
+	})
+
+	respond(w, r, http.StatusOK, t)
+}
+
+// getTagByNameRev returns the tag of the id, which is its name followed by
+// any revision, writing the problem if there is none
+func getTagByNameRev(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) (tag.Tag, bool) {
+	t, err := tag.FromNameRev(string(id))
+	if err != nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", "id").Write(w, r)
+		return tag.Tag{}, false
+	}
+	t, ok := imageSource.GetTag(t.Name)
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.TagNotFound, "Tag not found")
+		return tag.Tag{}, false
+	}
+	return t, true
+}
+
+// apiFileIds returns the ids in ascending order
+func apiFileIds(ids image.Ids) []openapi.FileId {
+	fileIds := make([]openapi.FileId, 0)
+	for _, r := range ids.Slice() {
+		for id := r.Low; id <= r.High; id++ {
+			fileIds = append(fileIds, openapi.FileId(id))
+		}
+	}
+	return fileIds
+}
+
+func (*Api) PostTagsIdMerge(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
+	data := &openapi.TagMerge{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	from, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+	into, err := tag.FromNameRev(string(data.Into))
+	if err != nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).With("parameter", "into").Write(w, r)
+		return
+	}
+	into, ok = imageSource.GetTag(into.Name)
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.TagNotFound, "Tag merged into not found")
+		return
+	}
+	if into.Id == from.Id {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Unable to merge tag into itself").With("parameter", "into").Write(w, r)
+		return
+	}
+
+	affected := imageSource.GetTagImageIds(from.Id)
+	into.Revision, err = imageSource.MergeTag(from.Id, into.Id)
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.TagNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditTagMerge, from.Name, affected, map[string]any{
+		"into":     into.Name,
+		"revision": into.Revision,
+	})
+
+	respond(w, r, http.StatusOK, into)
+}
+
+func (*Api) PostTagsIdRename(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
+	data := &openapi.TagRename{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Name required").With("parameter", "name").Write(w, r)
+		return
+	}
+	t, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+	if name == t.Name {
+		respond(w, r, http.StatusOK, t)
+		return
+	}
+
+	err := imageSource.RenameTag(t.Id, name)
+	if err == image.ErrTagExists {
+		p := problem.New(http.StatusConflict, problem.TagExists, "A tag with the name exists already, merge into it instead")
+		if existing, ok := imageSource.GetTag(name); ok {
+			p = p.With("tag_id", existing.NameRev())
+		}
+		p.Write(w, r)
+		return
+	}
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.TagNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditTagRename, t.Name, nil, map[string]any{
+		"name": name,
+	})
+
+	t.Name = name
+	respond(w, r, http.StatusOK, t)
+}
+
+func (*Api) GetTagsIdRevisions(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam, params openapi.GetTagsIdRevisionsParams) {
+	t, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	revisions := imageSource.ListTagRevisions(t.Id, limit)
+	items := make([]openapi.TagRevision, len(revisions))
+	for i, rev := range revisions {
+		items[i] = openapi.TagRevision{
+			Revision:  rev.Revision,
+			Op:        openapi.TagRevisionOp(rev.Op),
+			ChangedAt: rev.ChangedAt,
+			Added:     rev.Added,
+			Removed:   rev.Removed,
+			Count:     rev.Count,
+		}
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.TagRevision `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetTagsIdRevisionsDiff(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam, params openapi.GetTagsIdRevisionsDiffParams) {
+	t, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+
+	to := t.Revision
+	if params.To != nil {
+		to = *params.To
+	}
+	diff, err := imageSource.DiffTagRevisions(t.Id, params.From, to)
+	if err == image.ErrRevisionUnavailable {
+		problem.Write(w, r, http.StatusNotFound, problem.RevisionNotFound, "Revision not in the history of the tag")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusOK, openapi.TagRevisionDiff{
+		From:    diff.From,
+		To:      diff.To,
+		Added:   apiFileIds(diff.Added),
+		Removed: apiFileIds(diff.Removed),
+	})
+}
+
+func (*Api) PostTagsIdRollback(w http.ResponseWriter, r *http.Request, id openapi.TagIdPathParam) {
+	data := &openapi.TagRollback{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	t, ok := getTagByNameRev(w, r, id)
+	if !ok {
+		return
+	}
+
+	// Diffed first to audit the files rolled back
+	diff, err := imageSource.DiffTagRevisions(t.Id, t.Revision, data.Revision)
+	if err == nil {
+		t.Revision, err = imageSource.RollbackTagIds(t.Id, data.Revision)
+	}
+	if err == image.ErrRevisionUnavailable {
+		problem.Write(w, r, http.StatusNotFound, problem.RevisionNotFound, "Revision not in the history of the tag")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	affected := diff.Added.Clone()
+	affected.AddTree(diff.Removed)
+	audit(r, image.AuditTagRollback, t.Name, affected, map[string]any{
+		"from":     diff.From,
+		"to":       diff.To,
+		"revision": t.Revision,
+	})
+
+	respond(w, r, http.StatusOK, t)
+}
+
+func (*Api) GetFilesIdTagSuggestions(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	if !tagsEnabled || !imageSource.TagConfig.Suggestions.Enable {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Tag suggestions not enabled")
+		return
+	}
+	if !imageSource.AI.Available() {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "AI server not configured")
+		return
+	}
+
+	suggestions, err := imageSource.SuggestTags(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.AIUnavailable, err.Error())
+		return
+	}
+
+	items := make([]openapi.TagSuggestion, len(suggestions))
+	for i, s := range suggestions {
+		items[i] = openapi.TagSuggestion{
+			TagId:      openapi.TagId(s.Tag.NameRev()),
+			Name:       s.Tag.Name,
+			Label:      s.Label,
+			Confidence: s.Confidence,
+		}
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.TagSuggestion `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+// Maximum size of an encoded user state value
+const maxUserStateSize = 64 * 1024
+
+var stateKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:-]{1,128}$`)
+
+// stateUser returns the user the state of the request belongs to, empty
+// for anonymous requests
+func stateUser(r *http.Request) string {
+	p, _ := auth.FromContext(r.Context())
+	return p.Name
+}
+
+func newApiUserState(s image.UserState) openapi.UserState {
+	return openapi.UserState{
+		Key:       openapi.StateKey(s.Key),
+		Value:     json.RawMessage(s.Value),
+		Version:   s.Version,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// writeStateProblem writes the problem of a failed state change
+func writeStateProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var conflict *image.VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		p := problem.New(http.StatusConflict, problem.VersionConflict, "State changed since the provided version")
+		if conflict.Current.Version > 0 {
+			p = p.With("current", newApiUserState(conflict.Current))
+		}
+		p.Write(w, r)
+	case err == image.ErrNotFound:
+		problem.Write(w, r, http.StatusNotFound, problem.StateNotFound, "State not found")
+	case err == image.ErrTooManyKeys:
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidRequest, fmt.Sprintf("At most %d keys per user", image.MaxUserStateKeys))
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+	}
+}
+
+func (*Api) GetState(w http.ResponseWriter, r *http.Request) {
+	states, err := imageSource.ListUserState(stateUser(r))
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	items := make([]openapi.UserState, len(states))
+	for i, s := range states {
+		items[i] = newApiUserState(s)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.UserState `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetStateKey(w http.ResponseWriter, r *http.Request, key openapi.StateKeyPathParam) {
+	s, ok := imageSource.GetUserState(stateUser(r), string(key))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.StateNotFound, "State not found")
+		return
+	}
+	respond(w, r, http.StatusOK, newApiUserState(s))
+}
+
+func (*Api) PutStateKey(w http.ResponseWriter, r *http.Request, key openapi.StateKeyPathParam) {
+	if !stateKeyRegexp.MatchString(string(key)) {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid key").With("parameter", "key").Write(w, r)
+		return
+	}
+
+	data := &openapi.UserStatePut{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	if data.Value == nil {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Value required, delete the key to clear it").With("parameter", "value").Write(w, r)
+		return
+	}
+	value, err := json.Marshal(data.Value)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	if len(value) > maxUserStateSize {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Value larger than %d bytes", maxUserStateSize)).With("parameter", "value").Write(w, r)
+		return
+	}
+
+	version := image.AnyVersion
+	if data.Version != nil {
+		if *data.Version < 0 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid version").With("parameter", "version").Write(w, r)
+			return
+		}
+		version = *data.Version
+	}
+
+	s, err := imageSource.SetUserState(stateUser(r), string(key), value, version)
+	if err != nil {
+		writeStateProblem(w, r, err)
+		return
+	}
+	respond(w, r, http.StatusOK, newApiUserState(s))
+}
+
+func (*Api) DeleteStateKey(w http.ResponseWriter, r *http.Request, key openapi.StateKeyPathParam, params openapi.DeleteStateKeyParams) {
+	version := image.AnyVersion
+	if params.Version != nil {
+		version = *params.Version
+	}
+	err := imageSource.DeleteUserState(stateUser(r), string(key), version)
+	if err != nil {
+		writeStateProblem(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Maximum length of the name of a saved search
+const maxSearchNameLength = 256
+
+func newApiUserSearch(s image.Search) openapi.UserSearch {
+	search := openapi.UserSearch{
+		Id:           openapi.UserSearchId(s.Id),
+		CollectionId: openapi.CollectionId(s.CollectionId),
+		Query:        openapi.Search(s.Query),
+		SearchedAt:   s.SearchedAt,
+		Saved:        s.Saved(),
+	}
+	if s.Saved() {
+		search.Name = &s.Name
+	}
+	return search
+}
+
+func (*Api) GetSearches(w http.ResponseWriter, r *http.Request, params openapi.GetSearchesParams) {
+	saved := params.Saved != nil && *params.Saved
+	limit := 20
+	if params.Limit != nil {
+		if *params.Limit < 1 {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid limit").With("parameter", "limit").Write(w, r)
+			return
+		}
+		limit = *params.Limit
+	}
+	searches, err := imageSource.ListSearches(stateUser(r), saved, limit)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	items := make([]openapi.UserSearch, len(searches))
+	for i, s := range searches {
+		items[i] = newApiUserSearch(s)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.UserSearch `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) PostSearches(w http.ResponseWriter, r *http.Request) {
+	data := &openapi.UserSearchPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	collection := getCollectionById(string(data.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+	if strings.TrimSpace(string(data.Query)) == "" {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Query required").With("parameter", "query").Write(w, r)
+		return
+	}
+	name := strings.TrimSpace(data.Name)
+	if name == "" || len(name) > maxSearchNameLength {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Name required, at most %d bytes", maxSearchNameLength)).With("parameter", "name").Write(w, r)
+		return
+	}
+
+	s, err := imageSource.SaveSearch(stateUser(r), collection.Id, string(data.Query), name)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusOK, newApiUserSearch(s))
+}
+
+func (*Api) DeleteSearchesId(w http.ResponseWriter, r *http.Request, id openapi.UserSearchIdPathParam) {
+	err := imageSource.DeleteSearch(stateUser(r), int64(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SearchNotFound, "Search not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newApiSelection(s image.Selection) openapi.Selection {
+	return openapi.Selection{
+		Id:           openapi.SelectionId(s.Id),
+		CollectionId: openapi.CollectionId(s.CollectionId),
+		Tag:          s.Tag.Name,
+		Count:        s.Count,
+		CreatedAt:    s.CreatedAt,
+		ExpiresAt:    s.ExpiresAt,
+	}
+}
+
+func (*Api) GetSelections(w http.ResponseWriter, r *http.Request, params openapi.GetSelectionsParams) {
+	collectionId := ""
+	if params.CollectionId != nil {
+		collectionId = string(*params.CollectionId)
+	}
+	selections, err := imageSource.ListSelections(stateUser(r), collectionId)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	items := make([]openapi.Selection, 0, len(selections))
+	for _, s := range selections {
+		items = append(items, newApiSelection(s))
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Selection `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) PostSelections(w http.ResponseWriter, r *http.Request) {
+	data := &openapi.SelectionPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	collection := getCollectionById(string(data.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	s, err := imageSource.CreateSelection(stateUser(r), collection.Id)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusCreated, newApiSelection(s))
+}
+
+func (*Api) DeleteSelectionsId(w http.ResponseWriter, r *http.Request, id openapi.SelectionIdPathParam) {
+	err := imageSource.DeleteSelection(stateUser(r), int64(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SelectionNotFound, "Selection not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (*Api) GetSelectionsId(w http.ResponseWriter, r *http.Request, id openapi.SelectionIdPathParam) {
+	s, err := imageSource.GetSelection(stateUser(r), int64(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SelectionNotFound, "Selection not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusOK, newApiSelection(s))
+}
+
+func (*Api) PostSelectionsIdConvert(w http.ResponseWriter, r *http.Request, id openapi.SelectionIdPathParam) {
+	data := &openapi.SelectionConvert{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	user := stateUser(r)
+	s, err := imageSource.GetSelection(user, int64(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SelectionNotFound, "Selection not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	name := ""
+	if data.Name != nil {
+		name = strings.TrimSpace(*data.Name)
+	}
+	// Same as openapi.SelectionConversion, with the tag marshaled as usual
+	conversion := struct {
+		Tag       *tag.Tag            `json:"tag,omitempty"`
+		Search    *openapi.UserSearch `json:"search,omitempty"`
+		ExportUrl *string             `json:"export_url,omitempty"`
+	}{}
+	switch data.To {
+	case openapi.SelectionConvertToEXPORT:
+		// The API may be mounted under any prefix
+		api := strings.TrimSuffix(r.URL.Path, fmt.Sprintf("/selections/%d/convert", id))
+		u := fmt.Sprintf("%s/collections/%s/export?query=%s", api, url.PathEscape(s.CollectionId), url.QueryEscape("tag:"+s.Tag.Name))
+		conversion.ExportUrl = &u
+
+	case openapi.SelectionConvertToTAG, openapi.SelectionConvertToALBUM:
+		if name == "" || len(name) > maxSearchNameLength {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, fmt.Sprintf("Name required, at most %d bytes", maxSearchNameLength)).With("parameter", "name").Write(w, r)
+			return
+		}
+		tagName := name
+		if data.To == openapi.SelectionConvertToALBUM {
+			tagName = tag.NewAlbum(name).Name
+			if tagName == tag.AlbumPrefix {
+				problem.New(http.StatusBadRequest, problem.InvalidParameter, "Name without letters or digits").With("parameter", "name").Write(w, r)
+				return
+			}
+		}
+		t, err := imageSource.TagSelection(user, s.Id, tagName)
+		if err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+			return
+		}
+		audit(r, image.AuditTagAdd, t.Name, nil, map[string]any{
+			"revision":  t.Revision,
+			"selection": s.Id,
+		})
+		conversion.Tag = &t
+		if data.To == openapi.SelectionConvertToALBUM {
+			search, err := imageSource.SaveSearch(user, s.CollectionId, "tag:"+t.Name, name)
+			if err != nil {
+				problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+				return
+			}
+			apiSearch := newApiUserSearch(search)
+			conversion.Search = &apiSearch
+		}
+
+	default:
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid conversion").With("parameter", "to").Write(w, r)
+		return
+	}
+	respond(w, r, http.StatusOK, conversion)
+}
+
+func (*Api) PostSelectionsIdFiles(w http.ResponseWriter, r *http.Request, id openapi.SelectionIdPathParam) {
+	data := &openapi.SelectionFilesPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	ids := make(chan image.ImageId, 100)
+	if data.SceneId != nil && data.Bounds != nil {
+		scene := sceneSource.GetSceneById(string(*data.SceneId), imageSource)
+		if scene == nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.SceneNotFound, "Scene not found")
+			return
+		}
+
+		bounds := render.Rect{
+			X: float64(data.Bounds.X),
+			Y: float64(data.Bounds.Y),
+			W: float64(data.Bounds.W),
+			H: float64(data.Bounds.H),
+		}
+
+		go func() {
+			defer close(ids)
+			photos := scene.GetVisiblePhotos(bounds)
+			for p := range photos {
+				ids <- image.ImageId(p.Id)
+			}
+		}()
+	} else if data.FileIds != nil {
+		go func() {
+			defer close(ids)
+			for _, id := range *data.FileIds {
+				ids <- image.ImageId(id)
+			}
+		}()
+	} else {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, "Either scene_id+bounds or file_ids required")
+		return
+	}
+
+	switch data.Op {
+	case openapi.OperationADD, openapi.OperationSUBTRACT, openapi.OperationINVERT:
+	default:
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid op").With("parameter", "op").Write(w, r)
+		return
+	}
+
+	s, err := imageSource.SelectFiles(stateUser(r), int64(id), string(data.Op), ids)
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SelectionNotFound, "Selection not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusOK, newApiSelection(s))
+}
+
+func newApiCamera(c image.Camera) openapi.Camera {
+	return openapi.Camera{
+		Id:          openapi.CameraId(c.Id),
+		Make:        &c.Make,
+		Model:       &c.Model,
+		Serial:      &c.Serial,
+		ClockOffset: int(c.ClockOffset.Seconds()),
+	}
+}
+
+func (*Api) GetCameras(w http.ResponseWriter, r *http.Request) {
+	cameras := imageSource.ListCameras()
+	items := make([]openapi.Camera, len(cameras))
+	for i, c := range cameras {
+		items[i] = newApiCamera(c)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Camera `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) PutCamerasId(w http.ResponseWriter, r *http.Request, id openapi.CameraIdPathParam) {
+
+	data := &openapi.CameraPut{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	offset := time.Duration(data.ClockOffset) * time.Second
+	camera, err := imageSource.SetCameraClockOffset(image.CameraId(id), offset)
+	if err == image.ErrNoCamera {
+		problem.Write(w, r, http.StatusNotFound, problem.CameraNotFound, "Camera not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditCameraUpdate, strconv.Itoa(int(camera.Id)), nil, map[string]any{
+		"clock_offset": data.ClockOffset,
+	})
+
+	respond(w, r, http.StatusOK, newApiCamera(camera))
+}
+
+func (*Api) PostCamerasCalibrate(w http.ResponseWriter, r *http.Request) {
+
+	data := &openapi.CameraCalibratePost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	camera, err := imageSource.CalibrateCamera(image.ImageId(data.FileId), image.ImageId(data.ReferenceFileId))
+	switch err {
+	case nil:
+	case image.ErrNoCamera:
+		problem.Write(w, r, http.StatusBadRequest, problem.CameraNotFound, "Camera of the file unknown")
+		return
+	case image.ErrSameCamera:
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidRequest, "Files taken with the same camera")
+		return
+	case image.ErrNotFound:
+		problem.Write(w, r, http.StatusBadRequest, problem.MetadataNotIndexed, "File date unknown")
+		return
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditCameraCalibrate, strconv.Itoa(int(camera.Id)), fileIds(image.ImageId(data.FileId), image.ImageId(data.ReferenceFileId)), map[string]any{
+		"clock_offset": int(camera.ClockOffset.Seconds()),
+	})
+
+	respond(w, r, http.StatusOK, newApiCamera(camera))
+}
+
+func newApiOrientationProposal(p image.OrientationProposal) openapi.OrientationProposal {
+	return openapi.OrientationProposal{
+		FileId:      openapi.FileId(p.Id),
+		Orientation: openapi.Orientation(p.Orientation),
+		Confidence:  p.Confidence,
+		Status:      openapi.OrientationProposalStatus(p.Status),
+	}
+}
+
+func respondOrientationProposals(w http.ResponseWriter, r *http.Request, proposals []image.OrientationProposal) {
+	items := make([]openapi.OrientationProposal, len(proposals))
+	for i, p := range proposals {
+		items[i] = newApiOrientationProposal(p)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.OrientationProposal `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetOrientationProposals(w http.ResponseWriter, r *http.Request, params openapi.GetOrientationProposalsParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	respondOrientationProposals(w, r, imageSource.ListOrientationProposals(collection.Dirs, limit))
+}
+
+func decodeOrientationProposalIds(r *http.Request) ([]image.ImageId, error) {
+	data := &openapi.OrientationProposalsPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		return nil, err
+	}
+	ids := make([]image.ImageId, len(data.FileIds))
+	for i, id := range data.FileIds {
+		ids[i] = image.ImageId(id)
+	}
+	return ids, nil
+}
+
+// auditOrientationProposals records the decided proposals, including the
+// ones decided before an error
+func auditOrientationProposals(r *http.Request, action image.AuditAction, proposals []image.OrientationProposal) {
+	if len(proposals) == 0 {
+		return
+	}
+	ids := image.NewIds()
+	for _, p := range proposals {
+		ids.AddInt(int(p.Id))
+	}
+	audit(r, action, "", ids, nil)
+}
+
+func (*Api) PostOrientationProposalsAccept(w http.ResponseWriter, r *http.Request) {
+	ids, err := decodeOrientationProposalIds(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	proposals, err := imageSource.AcceptOrientationProposals(ids)
+	auditOrientationProposals(r, image.AuditOrientationAccept, proposals)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	respondOrientationProposals(w, r, proposals)
+}
+
+func (*Api) PostOrientationProposalsReject(w http.ResponseWriter, r *http.Request) {
+	ids, err := decodeOrientationProposalIds(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	proposals, err := imageSource.RejectOrientationProposals(ids)
+	auditOrientationProposals(r, image.AuditOrientationReject, proposals)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	respondOrientationProposals(w, r, proposals)
+}
+
+func (*Api) PutFilesIdOrientation(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+
+	data := &openapi.OrientationEdit{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	if data.Orientation < 1 || data.Orientation > 8 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid orientation").With("parameter", "orientation").Write(w, r)
+		return
+	}
+
+	err := imageSource.SetOrientationEdit(image.ImageId(id), image.Orientation(data.Orientation))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditOrientationEdit, "", fileIds(image.ImageId(id)), map[string]any{
+		"orientation": data.Orientation,
+	})
+
+	respond(w, r, http.StatusOK, data)
+}
+
+func newApiReprocessStep(step image.ReprocessStep) openapi.ReprocessStep {
+	s := openapi.ReprocessStep{
+		Done: step.Done,
+	}
+	if step.Err != nil {
+		e := step.Err.Error()
+		s.Error = &e
+	}
+	return s
+}
+
+func (*Api) PostFilesIdReprocess(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	reprocessed, err := imageSource.Reprocess(r.Context(), image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditFileReprocess, "", fileIds(image.ImageId(id)), nil)
+
+	respond(w, r, http.StatusOK, openapi.Reprocessed{
+		Id:        openapi.FileId(id),
+		Metadata:  newApiReprocessStep(reprocessed.Metadata),
+		Thumbnail: newApiReprocessStep(reprocessed.Thumbnail),
+		Color:     newApiReprocessStep(reprocessed.Color),
+		Embedding: newApiReprocessStep(reprocessed.Embedding),
+	})
+}
+
+func (*Api) PutFilesIdCaption(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+
+	data := &openapi.Caption{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	data.Caption = strings.TrimSpace(data.Caption)
+	if utf8.RuneCountInString(data.Caption) > 10000 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Caption too long").With("parameter", "caption").Write(w, r)
+		return
+	}
+
+	err := imageSource.SetCaption(image.ImageId(id), data.Caption)
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditCaptionEdit, "", fileIds(image.ImageId(id)), map[string]any{
+		"caption": data.Caption,
+	})
+
+	respond(w, r, http.StatusOK, data)
+}
+
+func (*Api) DeleteFilesIdCaption(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	err := imageSource.ResetCaption(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditCaptionEdit, "", fileIds(image.ImageId(id)), map[string]any{
+		"reset": true,
+	})
+
+	respond(w, r, http.StatusOK, openapi.Caption{
+		Caption: imageSource.GetInfo(image.ImageId(id)).Description,
+	})
+}
+
+// parseLocation returns the location in degrees, or the name of the
+// parameter that is out of range
+func parseLocation(latitude float64, longitude float64) (s2.LatLng, string) {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return image.NaNLatLng(), "latitude"
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return image.NaNLatLng(), "longitude"
+	}
+	return s2.LatLngFromDegrees(latitude, longitude), ""
+}
+
+// reverseGeocode returns the place of the location, nil if it is unknown or
+// reverse geocoding is disabled
+func reverseGeocode(latlng s2.LatLng) *string {
+	place, err := imageSource.ReverseGeocode(latlng)
+	if err != nil || place == "" {
+		return nil
+	}
+	return &place
+}
+
+func fileLocation(latlng s2.LatLng) openapi.FileLocation {
+	if image.IsNaNLatLng(latlng) {
+		return openapi.FileLocation{}
+	}
+	lat := latlng.Lat.Degrees()
+	lng := latlng.Lng.Degrees()
+	return openapi.FileLocation{
+		Latitude:  &lat,
+		Longitude: &lng,
+		Place:     reverseGeocode(latlng),
+	}
+}
+
+func (*Api) PutFilesIdLocation(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+
+	data := &openapi.Location{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	latlng, invalid := parseLocation(data.Latitude, data.Longitude)
+	if invalid != "" {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid "+invalid).With("parameter", invalid).Write(w, r)
+		return
+	}
+
+	updated, err := imageSource.SetLocation([]image.ImageId{image.ImageId(id)}, latlng)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	if len(updated) == 0 {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	sceneSource.Invalidate(layout.Timeline, layout.Map)
+	audit(r, image.AuditLocationEdit, "", fileIds(updated...), map[string]any{
+		"latitude":  data.Latitude,
+		"longitude": data.Longitude,
+	})
+
+	respond(w, r, http.StatusOK, fileLocation(latlng))
+}
+
+func (*Api) DeleteFilesIdLocation(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	latlng, err := imageSource.ResetLocation(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	sceneSource.Invalidate(layout.Timeline, layout.Map)
+	audit(r, image.AuditLocationEdit, "", fileIds(image.ImageId(id)), map[string]any{
+		"reset": true,
+	})
+
+	respond(w, r, http.StatusOK, fileLocation(latlng))
+}
+
+func (*Api) PostFilesLocation(w http.ResponseWriter, r *http.Request) {
+
+	data := &openapi.LocationPost{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+
+	latlng, invalid := parseLocation(data.Latitude, data.Longitude)
+	if invalid != "" {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid "+invalid).With("parameter", invalid).Write(w, r)
+		return
+	}
+
+	var ids []image.ImageId
+	if data.FileIds != nil {
+		for _, id := range *data.FileIds {
+			ids = append(ids, image.ImageId(id))
+		}
+	}
+	if data.SelectTag != nil {
+		t, err := tag.FromNameRev(*data.SelectTag)
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid tag id").With("parameter", "select_tag").Write(w, r)
+			return
+		}
+		tagId, ok := imageSource.GetTagId(t.Name)
+		if !ok {
+			problem.New(http.StatusBadRequest, problem.TagNotFound, "Unknown tag").With("parameter", "select_tag").Write(w, r)
+			return
+		}
+		for rg := range imageSource.GetTagImageIds(tagId).RangeChan() {
+			for id := rg.Low; id <= rg.High; id++ {
+				ids = append(ids, image.ImageId(id))
+			}
+		}
+	}
+	if len(ids) == 0 {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, "Either file_ids or select_tag with files required")
+		return
+	}
+
+	updated, err := imageSource.SetLocation(ids, latlng)
+	if len(updated) > 0 {
+		sceneSource.Invalidate(layout.Timeline, layout.Map)
+		audit(r, image.AuditLocationEdit, "", fileIds(updated...), map[string]any{
+			"latitude":  data.Latitude,
+			"longitude": data.Longitude,
+		})
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	result := openapi.LocationResult{
+		Updated: make([]openapi.FileId, len(updated)),
+		Place:   reverseGeocode(latlng),
+	}
+	for i, id := range updated {
+		result.Updated[i] = openapi.FileId(id)
+	}
+	respond(w, r, http.StatusOK, result)
+}
+
+func newApiPanorama(p image.Panorama) openapi.Panorama {
+	ids := make([]openapi.FileId, len(p.Files))
+	for i, id := range p.Files {
+		ids[i] = openapi.FileId(id)
+	}
+	return openapi.Panorama{
+		Id:        openapi.PanoramaId(p.Id),
+		FileIds:   ids,
+		Preview:   p.Preview != "",
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+func (*Api) GetMemories(w http.ResponseWriter, r *http.Request, params openapi.GetMemoriesParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	date := time.Now()
+	if params.Date != nil {
+		date = params.Date.Time
+	}
+	limit := 12
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	filter := openapi.MemoryFilterALL
+	if params.Filter != nil {
+		filter = *params.Filter
+	}
+
+	infos := imageSource.OnThisDay(collection.Dirs, date)
+	switch filter {
+	case openapi.MemoryFilterALL:
+	case openapi.MemoryFilterFAVORITES:
+		infos = layout.FilterFavorites(infos, imageSource)
+	case openapi.MemoryFilterHIGHLIGHTS:
+		infos = layout.FilterHighlights(infos, imageSource)
+	default:
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Invalid filter").With("parameter", "filter").Write(w, r)
+		return
+	}
+
+	memories := image.PickMemories(infos, date, limit)
+	items := make([]openapi.Memory, len(memories))
+	for i, m := range memories {
+		items[i] = openapi.Memory{
+			Id:       openapi.FileId(m.Id),
+			TakenAt:  m.DateTime,
+			YearsAgo: m.YearsAgo,
+		}
+	}
+	respond(w, r, http.StatusOK, struct {
+		Date  string           `json:"date"`
+		Items []openapi.Memory `json:"items"`
+	}{
+		Date:  date.Format("2006-01-02"),
+		Items: items,
+	})
+}
+
+func newApiTrip(t image.Trip) openapi.Trip {
+	trip := openapi.Trip{
+		Id:           openapi.TripId(t.Id),
+		CollectionId: openapi.CollectionId(t.Collection),
+		Name:         t.Name,
+		Search:       fmt.Sprintf("trip:%d", t.Id),
+		Start:        t.Start,
+		End:          t.End,
+		Count:        t.Count,
+		Cover:        openapi.FileId(t.Cover),
+	}
+	if !image.IsNaNLatLng(t.LatLng) {
+		lat := t.LatLng.Lat.Degrees()
+		lng := t.LatLng.Lng.Degrees()
+		trip.Latitude = &lat
+		trip.Longitude = &lng
+	}
+	return trip
+}
+
+func (*Api) GetTrips(w http.ResponseWriter, r *http.Request, params openapi.GetTripsParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	trips := imageSource.ListTrips(collection.Id, limit)
+	items := make([]openapi.Trip, len(trips))
+	for i, t := range trips {
+		items[i] = newApiTrip(t)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Trip `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetTripsId(w http.ResponseWriter, r *http.Request, id openapi.TripIdPathParam) {
+	t, ok := imageSource.GetTrip(int64(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.TripNotFound, "Trip not found")
+		return
+	}
+	respond(w, r, http.StatusOK, newApiTrip(t))
+}
+
+func newApiSubject(s image.Subject) openapi.Subject {
+	subject := openapi.Subject{
+		Id:           openapi.SubjectId(s.Id),
+		CollectionId: openapi.CollectionId(s.Collection),
+		Class:        s.Class,
+		Count:        len(s.Files),
+		Cover:        openapi.FileId(s.Cover()),
+	}
+	if s.Tag != "" {
+		t := s.Tag
+		search := "tag:" + s.Tag
+		subject.Tag = &t
+		subject.Search = &search
+	}
+	return subject
+}
+
+func (*Api) GetSubjects(w http.ResponseWriter, r *http.Request, params openapi.GetSubjectsParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	subjects := imageSource.ListSubjects(collection.Id, limit)
+	items := make([]openapi.Subject, len(subjects))
+	for i, s := range subjects {
+		items[i] = newApiSubject(s)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Subject `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetSubjectsId(w http.ResponseWriter, r *http.Request, id openapi.SubjectIdPathParam) {
+	s, ok := imageSource.GetSubject(int64(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.SubjectNotFound, "Subject not found")
+		return
+	}
+	subject := newApiSubject(s)
+	files := make([]openapi.FileId, len(s.Files))
+	for i, f := range s.Files {
+		files[i] = openapi.FileId(f)
+	}
+	subject.Files = &files
+	respond(w, r, http.StatusOK, subject)
+}
+
+func (*Api) PostSubjectsIdLabel(w http.ResponseWriter, r *http.Request, id openapi.SubjectIdPathParam) {
+	data := &openapi.SubjectLabel{}
+	if err := chirender.Decode(r, data); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+		return
+	}
+	if tag.NewSubject(data.Name).Name == tag.SubjectPrefix {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Name required").With("parameter", "name").Write(w, r)
+		return
+	}
+
+	s, err := imageSource.LabelSubject(int64(id), data.Name)
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.SubjectNotFound, "Subject not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	respond(w, r, http.StatusOK, newApiSubject(s))
+}
+
+func newApiPlace(p image.Place) openapi.Place {
+	place := openapi.Place{
+		Tag:   p.Tag,
+		Kind:  openapi.PlaceKind(p.Kind),
+		Name:  p.Name,
+		Count: p.Count,
+		Cover: openapi.FileId(p.Cover),
+	}
+	if p.Country != "" {
+		country := p.Country
+		place.Country = &country
+	}
+	if !image.IsNaNLatLng(p.LatLng) {
+		lat := p.LatLng.Lat.Degrees()
+		lng := p.LatLng.Lng.Degrees()
+		place.Latitude = &lat
+		place.Longitude = &lng
+	}
+	return place
+}
+
+func (*Api) GetPlaces(w http.ResponseWriter, r *http.Request, params openapi.GetPlacesParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	q := ""
+	if params.Q != nil {
+		q = string(*params.Q)
+	}
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	places := imageSource.ListPlaces(collection.Dirs, q, limit)
+	items := make([]openapi.Place, len(places))
+	for i, p := range places {
+		items[i] = newApiPlace(p)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Place `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetPanoramas(w http.ResponseWriter, r *http.Request, params openapi.GetPanoramasParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	panoramas := imageSource.ListPanoramas(collection.Dirs, limit)
+	items := make([]openapi.Panorama, len(panoramas))
+	for i, p := range panoramas {
+		items[i] = newApiPanorama(p)
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Panorama `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetQuarantine(w http.ResponseWriter, r *http.Request, params openapi.GetQuarantineParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	files := imageSource.ListQuarantine(collection.Dirs, limit)
+	items := make([]openapi.Quarantined, len(files))
+	for i, f := range files {
+		items[i] = openapi.Quarantined{
+			Id:            openapi.FileId(f.Id),
+			Path:          f.Path,
+			Stage:         openapi.QuarantinedStage(f.Stage),
+			Error:         f.Error,
+			QuarantinedAt: f.QuarantinedAt,
+		}
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Quarantined `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetVerification(w http.ResponseWriter, r *http.Request, params openapi.GetVerificationParams) {
+	collection := getCollectionById(string(params.CollectionId))
+	if collection == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+		return
+	}
+
+	limit := 0
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	issues := imageSource.ListVerificationIssues(collection.Dirs, limit)
+	items := make([]openapi.Verification, len(issues))
+	for i, v := range issues {
+		item := openapi.Verification{
+			Id:         openapi.FileId(v.Id),
+			Path:       v.Path,
+			Status:     openapi.VerificationStatus(v.Status),
+			VerifiedAt: v.VerifiedAt,
+		}
+		if v.Detail != "" {
+			detail := v.Detail
+			item.Detail = &detail
+		}
+		if !v.ModifiedAt.IsZero() {
+			modified := v.ModifiedAt
+			item.ModifiedAt = &modified
+		}
+		items[i] = item
+	}
+	respond(w, r, http.StatusOK, struct {
+		Items []openapi.Verification `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+func (*Api) GetPanoramasId(w http.ResponseWriter, r *http.Request, id openapi.PanoramaIdPathParam) {
+	p, ok := imageSource.GetPanorama(int64(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.PanoramaNotFound, "Panorama not found")
+		return
+	}
+	respond(w, r, http.StatusOK, newApiPanorama(p))
+}
+
+func (*Api) DeletePanoramasId(w http.ResponseWriter, r *http.Request, id openapi.PanoramaIdPathParam) {
+	p, ok := imageSource.GetPanorama(int64(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.PanoramaNotFound, "Panorama not found")
+		return
+	}
+	err := imageSource.RejectPanorama(int64(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.PanoramaNotFound, "Panorama not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	audit(r, image.AuditPanoramaReject, fmt.Sprint(id), fileIds(p.Files...), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (*Api) GetPanoramasIdPreview(w http.ResponseWriter, r *http.Request, id openapi.PanoramaIdPathParam) {
+	p, ok := imageSource.GetPanorama(int64(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.PanoramaNotFound, "Panorama not found")
+		return
+	}
+	if p.Preview == "" {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "Panorama not stitched")
+		return
+	}
+	http.ServeFile(w, r, p.Preview)
+}
+
+func (*Api) GetFilesId(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+
+	path, err := imageSource.GetImagePath(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+
+	serveFile(w, r, path)
+}
+
+func (*Api) GetFilesIdAudio(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	audio, ok := imageSource.GetAudio(image.ImageId(id))
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "Audio not found")
+		return
+	}
+	serveFile(w, r, audio.Path)
+}
+
+func (*Api) GetFilesIdMotionMp4(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	video, modified, closer, err := imageSource.OpenMotionVideo(image.ImageId(id))
+	if errors.Is(err, image.ErrNotFound) || os.IsNotExist(err) {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "Motion photo not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	defer closer.Close()
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, r, "motion.mp4", modified, video)
+}
+
+func (*Api) GetFilesIdViewJpg(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, params openapi.GetFilesIdViewJpgParams) {
+	view := gpano.View{
+		Fov: 90,
+	}
+	if params.Yaw != nil {
+		view.Yaw = float64(*params.Yaw)
+	}
+	if params.Pitch != nil {
+		view.Pitch = float64(*params.Pitch)
+	}
+	if params.Fov != nil {
+		view.Fov = float64(*params.Fov)
+	}
+	width, height := 1024, 768
+	if params.Width != nil {
+		width = *params.Width
+	}
+	if params.Height != nil {
+		height = *params.Height
+	}
+	if view.Pitch < -90 || view.Pitch > 90 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Pitch must be between -90 and 90").With("parameter", "pitch").Write(w, r)
+		return
+	}
+	if view.Fov < 10 || view.Fov > 150 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Field of view must be between 10 and 150").With("parameter", "fov").Write(w, r)
+		return
+	}
+	if width < 16 || width > 4096 || height < 16 || height > 4096 {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, "Width and height must be between 16 and 4096")
+		return
+	}
+
+	img, err := imageSource.RenderProjectionView(r.Context(), image.ImageId(id), view, width, height)
+	if errors.Is(err, image.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "360° photo not found")
+		return
+	}
+	if errors.Is(err, image.ErrUnavailable) {
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, err.Error())
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	// Encoded like tiles, as the photo is loaded in the same colors
+	var b bytes.Buffer
+	if err := encodeTile(&b, img); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(b.Bytes())
+}
+
+// serveFile serves the file at the path, which can also be a file inside
+// an archive, with support for range and conditional requests
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := archive.Open(path)
+	if os.IsNotExist(err) {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	if info.IsDir() {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+	w.Header().Set("ETag", imageSource.ETag(path, info))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (*Api) GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, filename openapi.FilenamePathParam) {
+
+	path, err := imageSource.GetImagePath(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+
+	serveFile(w, r, path)
+}
+
+func (*Api) GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, size openapi.SizePathParam, filename openapi.FilenamePathParam) {
+	// Variants are derived from the original, so they are tagged and dated
+	// by it, so that browsers can revalidate them without fetching them. The
+	// tag is weak, as a variant can be regenerated with different bytes from
+	// the same original, which rules it out for byte ranges.
+	etag := ""
+	modified := time.Time{}
+	if path, err := imageSource.GetImagePath(image.ImageId(id)); err == nil {
+		if info, err := archive.Stat(path); err == nil {
+			etag = "W/" + strings.TrimSuffix(imageSource.ETag(path, info), `"`) + "-" + string(size) + `"`
+			modified = info.ModTime()
+		}
+	}
+	imageSource.GetImageReader(image.ImageId(id), string(size), func(rs io.ReadSeeker, err error) {
+		if err == image.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+			return
+		}
+		if err != nil {
+			problem.New(http.StatusBadRequest, problem.SourceUnavailable, err.Error()).With("source", size).Write(w, r)
+			return
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		setCacheControl(w, cacheControlConfig.Thumbnails)
+		http.ServeContent(w, r, string(filename), modified, rs)
+	})
+}
+
+// deepZoomProblem writes the problem of a deep zoom request failing with err
+func deepZoomProblem(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, image.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+	case errors.Is(err, deepzoom.ErrTileNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "Tile not found")
+	case errors.Is(err, image.ErrNotAnImage):
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Deep zoom is only supported for photos")
+	case errors.Is(err, image.ErrUnavailable):
+		problem.Write(w, r, http.StatusBadRequest, problem.MetadataNotIndexed, "Size of the photo not indexed yet")
 	default:
-		problem(w, r, http.StatusBadRequest, "Invalid op")
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+	}
+}
+
+func (*Api) GetFilesIdDeepzoomDzi(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	pyramid, err := imageSource.DeepZoomPyramid(image.ImageId(id))
+	if err != nil {
+		deepZoomProblem(w, r, err)
 		return
 	}
-	t.Revision = rev
+	w.Header().Set("Content-Type", "application/xml")
+	pyramid.WriteDescriptor(w)
+}
 
+func (*Api) GetFilesIdDeepzoomFilesLevelTile(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, level int, tile string) {
+	var col, row int
+	var ext string
+	if n, _ := fmt.Sscanf(strings.Replace(tile, ".", " ", 1), "%d_%d %s", &col, &row, &ext); n != 3 || ext != deepzoom.Format {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Tile must be col_row."+deepzoom.Format).With("parameter", "tile").Write(w, r)
+		return
+	}
+	b, err := imageSource.DeepZoomTile(r.Context(), image.ImageId(id), level, col, row)
 	if err != nil {
-		problem(w, r, http.StatusInternalServerError, err.Error())
+		deepZoomProblem(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400") // 1 day
+	w.Write(b)
+}
 
-	respond(w, r, http.StatusOK, t)
+func spriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, image.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+	case errors.Is(err, image.ErrNotAVideo):
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Scrubbing previews are only supported for videos")
+	case errors.Is(err, image.ErrUnavailable):
+		problem.Write(w, r, http.StatusBadRequest, problem.Unsupported, "Duration of the video unknown")
+	case errors.Is(err, ffmpeg.ErrMissingBinary):
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.SourceUnavailable, "ffmpeg not available")
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+	}
 }
 
-func (*Api) GetFilesId(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+func (*Api) GetFilesIdScrubVtt(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	sprite, _, err := imageSource.VideoSprite(r.Context(), image.ImageId(id), false)
+	if err != nil {
+		spriteProblem(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vtt")
+	w.Header().Set("Cache-Control", "max-age=86400") // 1 day
+	sprite.WriteVTT(w, "scrub.jpg")
+}
+
+func (*Api) GetFilesIdScrubJpg(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	_, b, err := imageSource.VideoSprite(r.Context(), image.ImageId(id), true)
+	if err != nil {
+		spriteProblem(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400") // 1 day
+	w.Write(b)
+}
+
+// iiifSize returns the size of the photo served through IIIF, writing the
+// problem if it is not available
+func iiifSize(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) (int, int, bool) {
+	if _, err := imageSource.GetImagePath(image.ImageId(id)); err != nil {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return 0, 0, false
+	}
+	info := imageSource.GetInfo(image.ImageId(id))
+	if info.Width == 0 || info.Height == 0 {
+		problem.Write(w, r, http.StatusNotFound, problem.MetadataNotIndexed, "Size of the photo not indexed yet")
+		return 0, 0, false
+	}
+	return info.Width, info.Height, true
+}
+
+func (*Api) GetIiifId(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, "/")+"/info.json", http.StatusSeeOther)
+}
+
+func (*Api) GetIiifIdInfoJson(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam) {
+	width, height, ok := iiifSize(w, r, id)
+	if !ok {
+		return
+	}
+	base := requestBaseUrl(r) + strings.TrimSuffix(r.URL.Path, "/info.json")
+	w.Header().Set("Content-Type", iiif.ContentType)
+	json.NewEncoder(w).Encode(iiif.NewInfo(base, width, height))
+}
+
+func (*Api) GetIiifIdRegionSizeRotationQuality(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, region string, size string, rotation string, quality string) {
+	width, height, ok := iiifSize(w, r, id)
+	if !ok {
+		return
+	}
+	req, err := iiif.Parse(region, size, rotation, quality, width, height)
+	if errors.Is(err, iiif.ErrUnsupported) {
+		problem.Write(w, r, http.StatusNotImplemented, problem.Unsupported, err.Error())
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	lw, lh := req.LoadSize(width, height)
+	img, err := imageSource.LoadImage(r.Context(), image.ImageId(id), image.Size{X: lw, Y: lh})
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.SourceUnavailable, err.Error())
+		return
+	}
+	out := req.Render(img, width, height)
+
+	var b bytes.Buffer
+	if err := iiif.Encode(&b, out, req.Format); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	data := b.Bytes()
+	_, gray := out.(*goimage.Gray)
+	if profile := imageSource.ColorProfile(); req.Format == "jpg" && !gray && profile != nil && !profile.Equal(icc.SRGB()) {
+		var withProfile bytes.Buffer
+		if err := icc.WriteJPEG(&withProfile, data, profile.Data, 0); err == nil {
+			data = withProfile.Bytes()
+		}
+	}
+	w.Header().Set("Content-Type", iiif.Formats[req.Format])
+	w.Header().Set("Link", fmt.Sprintf(`<%s>;rel="profile"`, iiif.Protocol+"/3/level2.json"))
+	w.Header().Set("Cache-Control", "max-age=86400") // 1 day
+	w.Write(data)
+}
+
+func (*Api) GetFilesIdPrint(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, params openapi.GetFilesIdPrintParams) {
+	path, err := imageSource.GetImagePath(image.ImageId(id))
+	if err == image.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.FileNotFound, "File not found")
+		return
+	}
+
+	options := printing.Options{}
+	if params.Format != nil {
+		options.Format = string(*params.Format)
+	}
+	if params.Profile != nil {
+		options.Profile = string(*params.Profile)
+	}
+	if params.Border != nil {
+		options.Border = *params.Border
+	}
+	if params.Caption != nil {
+		options.Caption = *params.Caption
+	}
+	if params.Dpi != nil {
+		options.DPI = *params.Dpi
+	}
+	if err := options.Validate(); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	// Rendered into memory first, so that errors can still be reported
+	var b bytes.Buffer
+	fonts := defaultSceneConfig.Scene.Fonts.Main
+	if err := printing.Export(r.Context(), &b, imageSource, image.ImageId(id), &fonts, options); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "-print"
+	if options.Format == printing.TIFF {
+		name += ".tif"
+		w.Header().Set("Content-Type", "image/tiff")
+	} else {
+		name += ".jpg"
+		w.Header().Set("Content-Type", "image/jpeg")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(b.Bytes())
+}
+
+type Change struct {
+	Cursor    int64      `json:"cursor"`
+	Op        string     `json:"op"`
+	Id        int        `json:"id"`
+	Path      string     `json:"path"`
+	Hash      string     `json:"hash,omitempty"`
+	Width     int        `json:"width,omitempty"`
+	Height    int        `json:"height,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Latitude  *float64   `json:"latitude,omitempty"`
+	Longitude *float64   `json:"longitude,omitempty"`
+}
+
+func (*Api) GetChanges(w http.ResponseWriter, r *http.Request, params openapi.GetChangesParams) {
+
+	cursor := int64(0)
+	if params.Cursor != nil {
+		cursor = *params.Cursor
+	}
+
+	limit := 1000
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > 10000 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Limit must be between 1 and 10000").With("parameter", "limit").Write(w, r)
+		return
+	}
+
+	var dirs []string
+	if params.CollectionId != nil {
+		collection := getCollectionById(string(*params.CollectionId))
+		if collection == nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CollectionNotFound, "Collection not found")
+			return
+		}
+		dirs = append(dirs, collection.Dirs...)
+	}
+
+	changes := make([]Change, 0)
+	for c := range imageSource.ListChanges(dirs, cursor, limit) {
+		change := Change{
+			Cursor: c.Cursor,
+			Op:     string(c.Op),
+			Id:     int(c.Id),
+			Path:   c.Path,
+		}
+		if c.Op != image.ChangeRemoved {
+			hash, err := imageSource.GetFileHash(c.Id)
+			if err == nil {
+				change.Hash = hash
+			}
+			change.Width = c.Width
+			change.Height = c.Height
+			if !c.DateTime.IsZero() {
+				createdAt := c.DateTime
+				change.CreatedAt = &createdAt
+			}
+			if !image.IsNaNLatLng(c.LatLng) {
+				lat := c.LatLng.Lat.Degrees()
+				lng := c.LatLng.Lng.Degrees()
+				change.Latitude = &lat
+				change.Longitude = &lng
+			}
+		}
+		changes = append(changes, change)
+		cursor = c.Cursor
+	}
+
+	respond(w, r, http.StatusOK, struct {
+		Items  []Change `json:"items"`
+		Cursor int64    `json:"cursor"`
+	}{
+		Items:  changes,
+		Cursor: cursor,
+	})
+}
+
+func (*Api) GetAudit(w http.ResponseWriter, r *http.Request, params openapi.GetAuditParams) {
+
+	query := image.AuditQuery{
+		Actor: params.Actor,
+		Limit: 100,
+	}
+	if params.Action != nil {
+		query.Action = image.AuditAction(*params.Action)
+	}
+	if params.FileId != nil {
+		query.FileId = image.ImageId(*params.FileId)
+	}
+	if params.Since != nil {
+		query.Since = *params.Since
+	}
+	if params.Before != nil {
+		query.Before = *params.Before
+	}
+	if params.Limit != nil {
+		query.Limit = *params.Limit
+	}
+	if query.Limit < 1 || query.Limit > 1000 {
+		problem.New(http.StatusBadRequest, problem.InvalidParameter, "Limit must be between 1 and 1000").With("parameter", "limit").Write(w, r)
+		return
+	}
+
+	entries, err := imageSource.ListAudit(query)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+
+	items := make([]openapi.AuditEntry, len(entries))
+	for i, e := range entries {
+		item := openapi.AuditEntry{
+			Id:        e.Id,
+			CreatedAt: e.CreatedAt,
+			Action:    openapi.AuditAction(e.Action),
+		}
+		if e.Actor != "" {
+			actor := e.Actor
+			item.Actor = &actor
+		}
+		if e.Method != "" {
+			method := e.Method
+			item.Method = &method
+		}
+		if e.Target != "" {
+			target := e.Target
+			item.Target = &target
+		}
+		if e.Ids != nil {
+			ranges := make([]openapi.FileRange, 0)
+			for r := range e.Ids.RangeChan() {
+				ranges = append(ranges, openapi.FileRange{
+					From: openapi.FileId(r.Low),
+					To:   openapi.FileId(r.High),
+				})
+				item.FileCount += r.High - r.Low + 1
+			}
+			item.FileRanges = &ranges
+		}
+		if e.Details != nil {
+			details := e.Details
+			item.Details = &details
+		}
+		items[i] = item
+	}
+
+	cursor := int64(0)
+	if len(entries) == query.Limit {
+		cursor = entries[len(entries)-1].Id
+	}
+
+	respond(w, r, http.StatusOK, struct {
+		Items  []openapi.AuditEntry `json:"items"`
+		Cursor int64                `json:"cursor"`
+	}{
+		Items:  items,
+		Cursor: cursor,
+	})
+}
+
+func AddPrefix(prefix string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rctx := chi.RouteContext(r.Context())
+
+			routePath := rctx.RoutePath
+			if routePath == "" {
+				if r.URL.RawPath != "" {
+					routePath = r.URL.RawPath
+				} else {
+					routePath = r.URL.Path
+				}
+				rctx.RoutePath = prefix + routePath
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type TileRequestConfig struct {
+	// Tiles rendered at once, visible tiles first, no limit if 0
+	Concurrency int  `json:"concurrency"`
+	LogStats    bool `json:"log_stats"`
+	// Time in milliseconds after which a tile is returned with placeholders
+	// for the photos still loading, no limit if 0
+	BudgetMs     int                    `json:"budget_ms"`
+	Prerender    TilePrerenderConfig    `json:"prerender"`
+	LoadShedding TileLoadSheddingConfig `json:"load_shedding"`
+}
+
+type TileLoadSheddingConfig struct {
+	// Tiles that waited in the queue for longer than this many milliseconds
+	// are reduced, so that the queue catches up, never if 0
+	QueueMs int `json:"queue_ms"`
+	// JPEG quality of reduced tiles
+	Quality int `json:"quality"`
+	// Fraction of the drawn size the photos of reduced tiles are loaded at
+	Detail float64 `json:"detail"`
+}
+
+// reduces returns true if a tile that waited in the queue for the duration
+// is reduced
+func (config TileLoadSheddingConfig) reduces(waited time.Duration) bool {
+	return config.QueueMs > 0 && waited > time.Duration(config.QueueMs)*time.Millisecond
+}
+
+type TilePrerenderConfig struct {
+	// Draw the zoomed out tiles of large scenes in the background once they
+	// are built and store them in the data dir, so that they show up right
+	// away instead of waiting for all of their photos to load
+	Enable bool `json:"enable"`
+	// Tiles up to this zoom level are prerendered, each level has four
+	// times as many tiles as the one before
+	MaxZoom int `json:"max_zoom"`
+	// Size of the prerendered tiles, only requests for tiles of this size
+	// are served from them
+	TileSize int `json:"tile_size"`
+	// Scenes with fewer photos are quick to draw and are not prerendered
+	MinPhotos int `json:"min_photos"`
+	// Maximum number of scenes with stored tiles, the least recently
+	// prerendered ones are removed first
+	MaxScenes int `json:"max_scenes"`
+}
+
+// CacheControlConfig are the Cache-Control headers of the rendered
+// responses, which are also tagged, so that browsers can revalidate them
+type CacheControlConfig struct {
+	// Tiles drawn with all their photos
+	Tiles string `json:"tiles"`
+	// Thumbnails and other variants of files
+	Thumbnails string `json:"thumbnails"`
+}
+
+type AppConfig struct {
+	Collections  []collection.Collection `json:"collections"`
+	Layout       layout.Layout           `json:"layout"`
+	Render       render.Render           `json:"render"`
+	Media        image.Config            `json:"media"`
+	AI           clip.AI                 `json:"ai"`
+	Geo          image.Geo               `json:"geo"`
+	Tags         tag.Config              `json:"tags"`
+	TileRequests TileRequestConfig       `json:"tile_requests"`
+	CacheControl CacheControlConfig      `json:"cache_control"`
+	Auth         auth.Config             `json:"auth"`
+	Webhooks     webhook.Config          `json:"webhooks"`
+	Mqtt         mqtt.Config             `json:"mqtt"`
+	Instance     instance.Config         `json:"instance"`
+	Digest       digest.Config           `json:"digest"`
+	Tracing      tracing.Config          `json:"tracing"`
+	Logging      logging.Config          `json:"logging"`
+	WebDAV       webdav.Config           `json:"webdav"`
+	DLNA         dlna.Config             `json:"dlna"`
+	SQL          image.QueryConfig       `json:"sql"`
+	Kiosk        kiosk.Config            `json:"kiosk"`
+	Feeds        feed.Config             `json:"feeds"`
+	Scenes       scene.Config            `json:"scenes"`
+}
+
+type MqttFile struct {
+	Id          image.ImageId `json:"file_id"`
+	Path        string        `json:"path"`
+	Time        time.Time     `json:"time"`
+	Collections []string      `json:"collections"`
+}
+
+type MqttCollectionStats struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+}
+
+type MqttStats struct {
+	Files       int                   `json:"files"`
+	Collections []MqttCollectionStats `json:"collections"`
+}
+
+// Size of the thumbnails attached to digest emails
+const digestThumbnailSize = 320
+
+// Files listed per collection to find the ones added since the last digest
+const digestMaxNew = 10000
+
+// digestPhoto returns the photo with its thumbnail to attach to a digest,
+// false if it cannot be loaded
+func digestPhoto(id image.ImageId, api string, caption string) (digest.Photo, bool) {
+	path, err := imageSource.GetImagePath(id)
+	if err != nil {
+		return digest.Photo{}, false
+	}
+	img, err := imageSource.LoadImage(context.Background(), id, image.Size{
+		X: digestThumbnailSize,
+		Y: digestThumbnailSize,
+	})
+	if err != nil {
+		serverLog.Warn("digest unable to load photo", "id", id, "err", err)
+		return digest.Photo{}, false
+	}
+	var b bytes.Buffer
+	if err := encodeTile(&b, img); err != nil {
+		return digest.Photo{}, false
+	}
+	name := filepath.Base(path)
+	return digest.Photo{
+		Name:      name,
+		Link:      fmt.Sprintf("%s/files/%d/original/%s", api, id, url.PathEscape(name)),
+		Caption:   caption,
+		Thumbnail: b.Bytes(),
+	}, true
+}
+
+// buildDigest returns the digest of the photos added to the collections
+// since the time and the ones taken on this day in earlier years
+func buildDigest(config digest.Config, apiPrefix string, since time.Time, now time.Time) digest.Digest {
+	base := strings.TrimSuffix(config.BaseUrl, "/")
+	api := base + strings.TrimSuffix(apiPrefix, "/")
+	limit := config.PhotoLimit()
+	d := digest.Digest{
+		Subject: fmt.Sprintf("Photofield: your week in photos, %s", now.Format("January 2, 2006")),
+	}
+	for _, c := range collections {
+		if !config.IncludesCollection(c.Id) {
+			continue
+		}
+		link := fmt.Sprintf("%s/collections/%s", base, url.PathEscape(c.Id))
+
+		if config.Includes(digest.New) {
+			section := digest.Section{
+				Title: fmt.Sprintf("New in %s", c.Name),
+				Link:  link,
+			}
+			options := image.ListOptions{
+				Limit:  digestMaxNew,
+				Ignore: c.Ignore,
+				Hide:   imageSource.Private.Tags,
+			}
+			for added := range imageSource.ListRecentlyAdded(append([]string(nil), c.Dirs...), options) {
+				if !added.AddedAt.After(since) {
+					continue
+				}
+				section.Count++
+				if len(section.Photos) >= limit {
+					continue
+				}
+				if p, ok := digestPhoto(added.Id, api, added.AddedAt.Format("Jan 2")); ok {
+					section.Photos = append(section.Photos, p)
+				}
+			}
+			if len(section.Photos) > 0 {
+				d.Sections = append(d.Sections, section)
+			}
+		}
 
-	path, err := imageSource.GetImagePath(image.ImageId(id))
-	if err == image.ErrNotFound {
-		problem(w, r, http.StatusNotFound, "File not found")
-		return
+		if config.Includes(digest.Memories) {
+			infos := imageSource.OnThisDay(append([]string(nil), c.Dirs...), now)
+			section := digest.Section{
+				Title: fmt.Sprintf("On this day in %s", c.Name),
+				Link:  link,
+				Count: len(infos),
+			}
+			for _, m := range image.PickMemories(infos, now, limit) {
+				caption := "1 year ago"
+				if m.YearsAgo > 1 {
+					caption = fmt.Sprintf("%d years ago", m.YearsAgo)
+				}
+				if p, ok := digestPhoto(m.Id, api, caption); ok {
+					section.Photos = append(section.Photos, p)
+				}
+			}
+			if len(section.Photos) > 0 {
+				d.Sections = append(d.Sections, section)
+			}
+		}
 	}
-
-	http.ServeFile(w, r, path)
+	return d
 }
 
-func (*Api) GetFilesIdOriginalFilename(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, filename openapi.FilenamePathParam) {
-
-	path, err := imageSource.GetImagePath(image.ImageId(id))
-	if err == image.ErrNotFound {
-		problem(w, r, http.StatusNotFound, "File not found")
-		return
-	}
-
-	http.ServeFile(w, r, path)
-}
+// startMqtt publishes newly indexed files as they are found and the library
+// stats and indexing progress periodically
+func startMqtt(config mqtt.Config) *mqtt.Client {
+	client := mqtt.NewClient(config)
 
-func (*Api) GetFilesIdVariantsSizeFilename(w http.ResponseWriter, r *http.Request, id openapi.FileIdPathParam, size openapi.SizePathParam, filename openapi.FilenamePathParam) {
-	imageSource.GetImageReader(image.ImageId(id), string(size), func(rs io.ReadSeeker, err error) {
+	imageSource.Subscribe(func(e image.Event) {
+		if e.Type != image.EventFileIndexed {
+			return
+		}
+		file := MqttFile{
+			Id:          e.Id,
+			Path:        e.Path,
+			Time:        e.Time,
+			Collections: make([]string, 0),
+		}
+		for _, c := range collections {
+			for _, dir := range c.Dirs {
+				sep := string(filepath.Separator)
+				dir = strings.TrimSuffix(imageSource.Paths.Normalize(dir), sep) + sep
+				if strings.HasPrefix(e.Path, dir) {
+					file.Collections = append(file.Collections, c.Id)
+					break
+				}
+			}
+		}
+		payload, err := json.Marshal(file)
 		if err != nil {
-			problem(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
-		http.ServeContent(w, r, string(filename), time.Time{}, rs)
+		client.Publish("photo/added", payload, false)
+		for _, id := range file.Collections {
+			client.Publish("collections/"+id+"/photo/added", payload, false)
+		}
 	})
-}
 
-func AddPrefix(prefix string) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			rctx := chi.RouteContext(r.Context())
+	go func() {
+		for {
+			stats := MqttStats{
+				Collections: make([]MqttCollectionStats, 0, len(collections)),
+			}
+			var dirs []string
+			for _, c := range collections {
+				dirs = append(dirs, c.Dirs...)
+				stats.Collections = append(stats.Collections, MqttCollectionStats{
+					Id:    c.Id,
+					Name:  c.Name,
+					Files: imageSource.GetDirsCount(append([]string(nil), c.Dirs...)),
+				})
+			}
+			stats.Files = imageSource.GetDirsCount(dirs)
+			if payload, err := json.Marshal(stats); err == nil {
+				client.Publish("stats", payload, true)
+			}
 
-			routePath := rctx.RoutePath
-			if routePath == "" {
-				if r.URL.RawPath != "" {
-					routePath = r.URL.RawPath
-				} else {
-					routePath = r.URL.Path
+			tasks, err := listTasks(func(t Task) bool { return true })
+			if err == nil {
+				payload, err := json.Marshal(struct {
+					Items []Task `json:"items"`
+				}{
+					Items: tasks,
+				})
+				if err == nil {
+					client.Publish("tasks", payload, true)
 				}
-				rctx.RoutePath = prefix + routePath
 			}
 
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-type TileRequestConfig struct {
-	Concurrency int  `json:"concurrency"`
-	LogStats    bool `json:"log_stats"`
-}
+			time.Sleep(config.Interval())
+		}
+	}()
 
-type AppConfig struct {
-	Collections  []collection.Collection `json:"collections"`
-	Layout       layout.Layout           `json:"layout"`
-	Render       render.Render           `json:"render"`
-	Media        image.Config            `json:"media"`
-	AI           clip.AI                 `json:"ai"`
-	Geo          image.Geo               `json:"geo"`
-	Tags         tag.Config              `json:"tags"`
-	TileRequests TileRequestConfig       `json:"tile_requests"`
+	return client
 }
 
 func expandCollections(collections *[]collection.Collection) {
@@ -1014,8 +4972,54 @@ func expandCollections(collections *[]collection.Collection) {
 	*collections = expanded
 }
 
+// indexScope narrows the index tasks to a subdirectory of a collection or
+// the files within it matching a glob, so that fixing one folder does not
+// require rescanning the whole collection
+type indexScope struct {
+	dirs    []string
+	include image.Globs
+	// Path and glob the scope was created from, empty for the whole
+	// collection
+	label string
+}
+
+// newIndexScope returns the scope of the path and glob within the
+// collection, or the name of the invalid parameter with an error
+func newIndexScope(collection *collection.Collection, path *string, glob *string) (indexScope, string, error) {
+	scope := indexScope{dirs: collection.Dirs}
+	var labels []string
+	if path != nil && *path != "" {
+		dir, err := collection.Subdir(*path)
+		if err != nil {
+			return scope, "path", err
+		}
+		scope.dirs = []string{dir}
+		labels = append(labels, *path)
+	}
+	if glob != nil && *glob != "" {
+		include, err := image.CompileGlobs([]string{*glob})
+		if err != nil {
+			return scope, "glob", err
+		}
+		scope.include = include
+		labels = append(labels, *glob)
+	}
+	scope.label = strings.Join(labels, " ")
+	return scope, "", nil
+}
+
 func indexCollection(collection *collection.Collection) (task Task, existing bool) {
+	return indexCollectionScope(collection, indexScope{dirs: collection.Dirs})
+}
+
+func indexCollectionScope(collection *collection.Collection, scope indexScope) (task Task, existing bool) {
 	task = newFileIndexTask(collection)
+	if scope.label != "" {
+		h := fnv.New32a()
+		h.Write([]byte(scope.label))
+		task.Id = fmt.Sprintf("%s-%08x", task.Id, h.Sum32())
+		task.Name = fmt.Sprintf("%s %s", task.Name, scope.label)
+	}
 	stored, existing := globalTasks.LoadOrStore(task.Id, task)
 	task = stored.(Task)
 	if existing {
@@ -1025,14 +5029,29 @@ func indexCollection(collection *collection.Collection) (task Task, existing boo
 	counter := task.Counter()
 
 	go func() {
-		log.Printf("indexing files %s\n", collection.Id)
-		for _, dir := range collection.Dirs {
-			log.Printf("indexing files %s dir %s\n", collection.Id, dir)
-			imageSource.IndexFiles(dir, collection.IndexLimit, counter)
+		indexLog.Info("indexing files", "collection", collection.Id, "scope", scope.label)
+		for _, dir := range scope.dirs {
+			indexLog.Info("indexing files", "collection", collection.Id, "dir", dir)
+			imageSource.IndexFilesMatching(dir, collection.IndexLimit, collection.Walk, collection.Ignore, scope.include, counter)
 		}
 		// imageSource.IndexAI(collection.Dirs, collection.IndexLimit)
-		imageSource.IndexMetadata(collection.Dirs, collection.IndexLimit, image.Missing{})
-		imageSource.IndexContents(collection.Dirs, collection.IndexLimit, image.Missing{})
+		imageSource.IndexMetadataMatching(scope.dirs, collection.IndexLimit, image.Missing{}, scope.include)
+		imageSource.IndexContentsMatching(scope.dirs, collection.IndexLimit, image.Missing{}, scope.include)
+		if scope.label != "" {
+			// Detections work on whole collections
+			globalTasks.Delete(task.Id)
+			close(counter)
+			return
+		}
+		if imageSource.Orientation.Detect && imageSource.AI.Available() {
+			imageSource.DetectOrientation(collection.Dirs, collection.IndexLimit)
+		}
+		if imageSource.Panorama.Detect {
+			imageSource.DetectPanoramas(collection.Dirs)
+		}
+		if imageSource.Trips.Detect {
+			imageSource.DetectTrips(collection.Id, collection.Dirs)
+		}
 		globalTasks.Delete(task.Id)
 		close(counter)
 	}()
@@ -1043,13 +5062,13 @@ func loadConfiguration(path string) AppConfig {
 
 	var appConfig AppConfig
 
-	log.Printf("config path %v", path)
+	serverLog.Info("config", "path", path)
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Printf("unable to open %s, using defaults (%s)\n", path, err.Error())
+		serverLog.Warn("unable to open config, using defaults", "path", path, "err", err)
 		appConfig = defaults
 	} else if err := yaml.Unmarshal(bytes, &appConfig); err != nil {
-		log.Printf("unable to parse %s, using defaults (%s)\n", path, err.Error())
+		serverLog.Warn("unable to parse config, using defaults", "path", path, "err", err)
 		appConfig = defaults
 	} else if err := mergo.Merge(&appConfig, defaults); err != nil {
 		panic("unable to merge configuration with defaults")
@@ -1060,9 +5079,63 @@ func loadConfiguration(path string) AppConfig {
 		collection := &appConfig.Collections[i]
 		collection.GenerateId()
 		collection.Layout = strings.ToUpper(collection.Layout)
+		dedup, err := image.DedupModeFromString(collection.Dedup)
+		if err != nil {
+			serverLog.Warn("ignoring invalid dedup", "collection", collection.Id, "err", err)
+		}
+		collection.Dedup = string(dedup)
+		if _, err := image.CompileGlobs(collection.Ignore); err != nil {
+			serverLog.Warn("ignoring invalid ignore patterns", "collection", collection.Id, "err", err)
+			collection.Ignore = nil
+		}
 		if collection.Limit > 0 && collection.IndexLimit == 0 {
 			collection.IndexLimit = collection.Limit
 		}
+		collection.AddUploadDir()
+	}
+
+	if err := appConfig.Media.Panorama.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "panorama", "err", err)
+	}
+
+	if err := appConfig.Media.Trips.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "trips", "err", err)
+	}
+
+	if err := appConfig.Auth.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "auth", "err", err)
+	}
+
+	if err := appConfig.Webhooks.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "webhooks", "err", err)
+	}
+
+	if err := appConfig.Mqtt.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "mqtt", "err", err)
+	}
+
+	if err := appConfig.Digest.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "digest", "err", err)
+	}
+
+	if err := appConfig.Tracing.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "tracing", "err", err)
+	}
+
+	if err := appConfig.Logging.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "logging", "err", err)
+	}
+
+	if err := appConfig.DLNA.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "dlna", "err", err)
+	}
+
+	if err := appConfig.SQL.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "sql", "err", err)
+	}
+
+	if err := appConfig.Kiosk.Validate(); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "kiosk", "err", err)
 	}
 
 	appConfig.Media.AI = appConfig.AI
@@ -1120,6 +5193,50 @@ func CacheControl() func(next http.Handler) http.Handler {
 	}
 }
 
+// OpenGraph serves the pages of collections with their Open Graph
+// metadata, so that shared links are previewed with the name of the
+// collection and a collage of its photos. Only visitors that are able to
+// view the collection get the metadata, so link previews only work for
+// collections anonymous visitors can view.
+func OpenGraph(root fs.FS, apiPrefix string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Paths of the UI, /collections/{id} and /collections/{id}/{region}
+			parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if r.Method != http.MethodGet || len(parts) < 2 || len(parts) > 3 || parts[0] != "collections" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			c := getCollectionById(parts[1])
+			if p, ok := authenticator.Authenticate(r); c == nil || !ok || !p.Has(auth.ScopeRead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			page, err := fs.ReadFile(root, "index.html")
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			base := requestBaseUrl(r)
+			api := base + strings.TrimSuffix(apiPrefix, "/")
+			count := imageSource.GetDirsCount(append([]string(nil), c.Dirs...))
+			meta := opengraph.Meta{
+				Title:       c.Name,
+				Description: fmt.Sprintf("%d photos", count),
+				SiteName:    "Photofield",
+				Url:         base + r.URL.Path,
+				Image:       fmt.Sprintf("%s/collections/%s/preview", api, url.PathEscape(c.Id)),
+				ImageWidth:  opengraph.ImageWidth,
+				ImageHeight: opengraph.ImageHeight,
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(opengraph.Inject(page, meta))
+		})
+	}
+}
+
 func IndexHTML() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1165,6 +5282,100 @@ func benchmarkSources(collection *collection.Collection, seed int64, sampleSize
 	bench.BenchmarkSources(seed, sources, samples, count)
 }
 
+// parseExportQuery parses the query the exported photos need to match,
+// nil if empty
+func parseExportQuery(query string) (*search.Query, error) {
+	if query == "" {
+		return nil, nil
+	}
+	q, err := search.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.QualifierValues("tag")) == 0 {
+		return nil, fmt.Errorf("unsupported export query %q, only tag: qualifiers are supported", query)
+	}
+	return q, nil
+}
+
+// exportSite renders the photos of a collection matching a query into a
+// static website
+func exportSite(ctx context.Context, c *collection.Collection, query string, w site.Writer, originals bool) (int, error) {
+	q, err := parseExportQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := c.GetExportIds(imageSource, image.ListOptions{
+		OrderBy: image.DateAsc,
+		Query:   q,
+	})
+
+	title := c.Name
+	if query != "" {
+		title = fmt.Sprintf("%s (%s)", title, query)
+	}
+	return site.Export(ctx, w, imageSource, ids, site.Options{
+		Title:     title,
+		Originals: originals,
+	})
+}
+
+// extractLibrary extracts the photos of a collection matching a query
+// into a new self-contained data dir, e.g. to hand over a subset of photos
+// together with their tags and thumbnails
+func extractLibrary(c *collection.Collection, query string, dir string, link bool) error {
+	var q *search.Query
+	if query != "" {
+		parsed, err := search.Parse(query)
+		if err != nil {
+			return err
+		}
+		if len(parsed.QualifierValues("tag")) == 0 {
+			return fmt.Errorf("unsupported extract query %q, only tag: qualifiers are supported", query)
+		}
+		q = parsed
+	}
+
+	ids := c.GetExportIds(imageSource, image.ListOptions{
+		Query: q,
+	})
+	serverLog.Info("extract", "files", len(ids), "query", query, "collection", c.Name)
+
+	photosDir, err := imageSource.Extract(c.Dirs, ids, image.ExtractOptions{
+		Dir:  dir,
+		Link: link,
+	}, migrations, migrationsThumbs)
+	if err != nil {
+		return err
+	}
+
+	name := c.Name
+	if query != "" {
+		name = fmt.Sprintf("%s (%s)", name, query)
+	}
+	conf := struct {
+		Collections []collection.Collection `json:"collections"`
+	}{
+		Collections: []collection.Collection{
+			{
+				Name: name,
+				Dirs: []string{photosDir},
+			},
+		},
+	}
+	bytes, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	configurationPath := filepath.Join(dir, "configuration.yaml")
+	if _, err := os.Stat(configurationPath); err == nil {
+		serverLog.Info("extract keeping existing config", "path", configurationPath)
+		return nil
+	}
+	return os.WriteFile(configurationPath, bytes, 0644)
+}
+
 func main() {
 	startupTime = time.Now()
 
@@ -1175,6 +5386,19 @@ func main() {
 	benchCollectionId := flag.String("bench.collection", "vacation-photos", "id of the collection to benchmark")
 	benchSeed := flag.Int64("bench.seed", 123, "seed for random number generator")
 	benchSample := flag.Int("bench.sample", 10000, "number of images from the collection to use as a sample")
+	extractFlag := flag.Bool("extract", false, "extract photos matching a query into a new data dir and exit")
+	extractCollectionId := flag.String("extract.collection", "", "id of the collection to extract from")
+	extractQuery := flag.String("extract.query", "", "query the extracted photos need to match, e.g. \"tag:kids\"")
+	extractDir := flag.String("extract.dir", "extract", "data dir to extract into")
+	extractLink := flag.Bool("extract.link", false, "hard link photos instead of copying them where possible")
+	exportFlag := flag.Bool("export", false, "export a collection as a static website and exit")
+	exportCollectionId := flag.String("export.collection", "", "id of the collection to export")
+	exportQuery := flag.String("export.query", "", "query the exported photos need to match, e.g. \"tag:kids\"")
+	exportDir := flag.String("export.dir", "site", "dir to export the website into")
+	exportOriginals := flag.Bool("export.originals", false, "include the original files for download")
+	dryRunFlag := flag.Bool("dryrun", false, "report what indexing a collection would add, remove and process again without writing, and exit")
+	dryRunCollectionId := flag.String("dryrun.collection", "", "id of the collection to report on")
+	dryRunSamples := flag.Int("dryrun.samples", 10, "number of paths listed per kind of change")
 	flag.Parse()
 
 	flag.Parse()
@@ -1188,12 +5412,12 @@ func main() {
 		return
 	}
 
-	log.Printf("photofield %s", version)
+	serverLog.Info("photofield", "version", version)
 
 	loadEnv()
 
 	if os.Getenv("PYROSCOPE_HOST") != "" {
-		log.Printf("pyroscope enabled at %s", os.Getenv("PYROSCOPE_HOST"))
+		serverLog.Info("pyroscope enabled", "host", os.Getenv("PYROSCOPE_HOST"))
 
 		// These 2 lines are only required if you're using mutex or block profiling
 		// Read the explanation below for how to set these rates:
@@ -1228,14 +5452,45 @@ func main() {
 		panic(err)
 	}
 
-	dataDir, exists := os.LookupEnv("PHOTOFIELD_DATA_DIR")
+	var exists bool
+	dataDir, exists = os.LookupEnv("PHOTOFIELD_DATA_DIR")
 	if !exists {
 		dataDir = "."
 	}
 	configurationPath := filepath.Join(dataDir, "configuration.yaml")
 
 	appConfig := loadConfiguration(configurationPath)
+	if err := logging.Init(appConfig.Logging); err != nil {
+		serverLog.Fatal("invalid configuration", "section", "logging", "err", err)
+	}
 	appConfig.Media.DataDir = dataDir
+
+	role, lock, err := instance.Elect(appConfig.Instance, dataDir)
+	if err != nil {
+		serverLog.Fatal("unable to elect the instance role", "err", err)
+	}
+	// Lock of the stopped writer taken over by this reader, which restarts as
+	// the writer once everything else deferred is cleaned up
+	var takenOver *instance.Lock
+	defer func() {
+		lock.Release()
+		if takenOver != nil {
+			restartAsWriter(takenOver)
+		}
+	}()
+	instanceRole = role
+	if role == instance.RoleReader {
+		if *vacuumFlag {
+			serverLog.Fatal("vacuum unable to run, data dir is in use", "writer", instance.Holder(dataDir))
+		}
+		appConfig.Media.ReadOnly = true
+		serverLog.Info("instance is a reader", "writer", instance.Holder(dataDir))
+	}
+
+	if *dryRunFlag {
+		// Do not resume indexing interrupted before
+		appConfig.Media.SkipLoadInfo = true
+	}
 	tagsEnabled = appConfig.Tags.Enable
 
 	if len(appConfig.Collections) > 0 {
@@ -1244,11 +5499,33 @@ func main() {
 	collections = appConfig.Collections
 	defaultSceneConfig.Layout = appConfig.Layout
 	defaultSceneConfig.Render = appConfig.Render
+	defaultSceneConfig.Hide = appConfig.Media.Private.Tags
 	tileRequestConfig = appConfig.TileRequests
+	cacheControlConfig = appConfig.CacheControl
+	queryConfig = appConfig.SQL
+	feedConfig = appConfig.Feeds
+	authenticator = auth.NewAuthenticator(appConfig.Auth)
+
+	if appConfig.Tracing.Endpoint != "" {
+		tracing.Init(appConfig.Tracing)
+		serverLog.Info("tracing exporting", "endpoint", appConfig.Tracing.Endpoint)
+	}
 
 	imageSource = image.NewSource(appConfig.Media, migrations, migrationsThumbs)
 	defer imageSource.Close()
 
+	if len(appConfig.Webhooks.Hooks) > 0 {
+		webhooks := webhook.NewDispatcher(appConfig.Webhooks)
+		imageSource.Subscribe(webhooks.Send)
+		serverLog.Info("webhooks", "hooks", len(appConfig.Webhooks.Hooks))
+	}
+
+	// Readers would duplicate the messages of the writer
+	if appConfig.Mqtt.Broker != "" && role == instance.RoleWriter {
+		client := startMqtt(appConfig.Mqtt)
+		defer client.Close()
+	}
+
 	if *vacuumFlag {
 		err := imageSource.Vacuum()
 		if err != nil {
@@ -1261,7 +5538,7 @@ func main() {
 
 	fontFamily := canvas.NewFontFamily("Main")
 	// fontFamily.Use(canvas.CommonLigatures)
-	err := fontFamily.LoadFont(robotoRegular, canvas.FontRegular)
+	err = fontFamily.LoadFont(robotoRegular, canvas.FontRegular)
 	if err != nil {
 		panic(err)
 	}
@@ -1275,9 +5552,9 @@ func main() {
 	sceneSource.DefaultScene = defaultSceneConfig.Scene
 
 	extensions := strings.Join(appConfig.Media.ListExtensions, ", ")
-	log.Printf("extensions %v", extensions)
+	serverLog.Info("extensions", "extensions", extensions)
 
-	log.Printf("%v collections", len(collections))
+	serverLog.Info("collections", "count", len(collections))
 	for i := range collections {
 		collection := &collections[i]
 		collection.UpdateStatus(imageSource)
@@ -1285,11 +5562,11 @@ func main() {
 		if collection.IndexedAt != nil {
 			indexedAgo = durafmt.Parse(time.Since(*collection.IndexedAt)).LimitFirstN(1).String()
 		}
-		log.Printf("  %v - %v files indexed %v ago", collection.Name, collection.IndexedCount, indexedAgo)
+		serverLog.Info("collection", "name", collection.Name, "indexed", collection.IndexedCount, "ago", indexedAgo)
 	}
 
 	if *benchFlag {
-		log.Printf("benchmark sources")
+		decodeLog.Info("benchmark sources")
 
 		count := flag.Lookup("test.count").Value.(flag.Getter).Get().(uint)
 
@@ -1301,6 +5578,54 @@ func main() {
 		return
 	}
 
+	if *extractFlag {
+		c := getCollectionById(*extractCollectionId)
+		if c == nil {
+			serverLog.Fatal("collection not found", "collection", *extractCollectionId)
+		}
+		err := extractLibrary(c, *extractQuery, *extractDir, *extractLink)
+		if err != nil {
+			serverLog.Fatal("extract failed", "err", err)
+		}
+		return
+	}
+
+	if *dryRunFlag {
+		c := getCollectionById(*dryRunCollectionId)
+		if c == nil {
+			serverLog.Fatal("collection not found", "collection", *dryRunCollectionId)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(newApiIndexReport(dryRunIndex(c, *dryRunSamples))); err != nil {
+			serverLog.Fatal("dry run failed", "err", err)
+		}
+		return
+	}
+
+	if *exportFlag {
+		c := getCollectionById(*exportCollectionId)
+		if c == nil {
+			serverLog.Fatal("collection not found", "collection", *exportCollectionId)
+		}
+		n, err := exportSite(context.Background(), c, *exportQuery, site.Dir(*exportDir), *exportOriginals)
+		if err != nil {
+			serverLog.Fatal("export failed", "err", err)
+		}
+		serverLog.Info("export done", "photos", n, "dir", *exportDir)
+		return
+	}
+
+	sceneSource.Persist(filepath.Join(dataDir, "scenes"), appConfig.Scenes.Persist)
+	sceneSource.Watch(appConfig.Scenes.Update, imageSource)
+	if tileRequestConfig.Prerender.Enable {
+		tilePrerender = newTilePrerenderer(filepath.Join(dataDir, "tiles"), tileRequestConfig.Prerender, defaultSceneConfig.Render)
+		sceneSource.OnBuilt(tilePrerender.add)
+		go tilePrerender.run()
+	}
+	recentScenes := sceneSource.PersistRecent(filepath.Join(dataDir, "photofield.recent.json"))
+	go sceneSource.WarmUp(recentScenes, getCollectionById, defaultSceneConfig, imageSource)
+
 	metadataTask := Task{
 		Type:  string(openapi.TaskTypeINDEXMETADATA),
 		Id:    "index-metadata",
@@ -1317,6 +5642,70 @@ func main() {
 	}
 	globalTasks.Store(contentsTask.Id, contentsTask)
 
+	orientationTask := Task{
+		Type:  string(openapi.TaskTypeDETECTORIENTATION),
+		Id:    "detect-orientation",
+		Name:  "Detecting orientation",
+		Queue: "detect_orientation",
+	}
+	globalTasks.Store(orientationTask.Id, orientationTask)
+
+	panoramaTask := Task{
+		Type:  string(openapi.TaskTypeDETECTPANORAMAS),
+		Id:    "detect-panoramas",
+		Name:  "Detecting panoramas",
+		Queue: "detect_panoramas",
+	}
+	globalTasks.Store(panoramaTask.Id, panoramaTask)
+
+	tripTask := Task{
+		Type:  string(openapi.TaskTypeDETECTTRIPS),
+		Id:    "detect-trips",
+		Name:  "Detecting trips",
+		Queue: "detect_trips",
+	}
+	globalTasks.Store(tripTask.Id, tripTask)
+
+	nsfwTask := Task{
+		Type:  string(openapi.TaskTypeDETECTNSFW),
+		Id:    "detect-nsfw",
+		Name:  "Detecting NSFW",
+		Queue: "detect_nsfw",
+	}
+	globalTasks.Store(nsfwTask.Id, nsfwTask)
+
+	kindTask := Task{
+		Type:  string(openapi.TaskTypeDETECTKINDS),
+		Id:    "detect-kinds",
+		Name:  "Detecting screenshots and documents",
+		Queue: "detect_kinds",
+	}
+	globalTasks.Store(kindTask.Id, kindTask)
+
+	subjectTask := Task{
+		Type:  string(openapi.TaskTypeDETECTSUBJECTS),
+		Id:    "detect-subjects",
+		Name:  "Detecting subjects",
+		Queue: "detect_subjects",
+	}
+	globalTasks.Store(subjectTask.Id, subjectTask)
+
+	orientationAuditTask := Task{
+		Type:  string(openapi.TaskTypeAUDITORIENTATION),
+		Id:    "audit-orientation",
+		Name:  "Auditing orientation",
+		Queue: "audit_orientation",
+	}
+	globalTasks.Store(orientationAuditTask.Id, orientationAuditTask)
+
+	verifyTask := Task{
+		Type:  string(openapi.TaskTypeVERIFYCHECKSUMS),
+		Id:    "verify-checksums",
+		Name:  "Verifying checksums",
+		Queue: "verify_checksums",
+	}
+	globalTasks.Store(verifyTask.Id, verifyTask)
+
 	// renderSample(defaultSceneConfig.Config, sceneSource.GetScene(defaultSceneConfig, imageSource))
 
 	addr, exists := os.LookupEnv("PHOTOFIELD_ADDRESS")
@@ -1329,17 +5718,34 @@ func main() {
 		apiPrefix = "/api"
 	}
 
+	if appConfig.Digest.Enabled() && role == instance.RoleWriter {
+		config := appConfig.Digest
+		mailer := digest.NewMailer(config, func(since, now time.Time) (digest.Digest, error) {
+			return buildDigest(config, apiPrefix, since, now), nil
+		})
+		go mailer.Run()
+		serverLog.Info("digest", "recipients", len(config.To))
+	}
+
 	if tileRequestConfig.LogStats {
-		log.Printf("logging tile request stats")
+		serverLog.Info("logging tile request stats")
 		fmt.Printf("priority,start,end,latency\n")
 	}
 
+	processPrefetchRequests(prefetchConcurrency)
+
 	tileRequestsOut = make(chan struct{}, 10000)
 	if tileRequestConfig.Concurrency > 0 {
-		log.Printf("request concurrency %v", tileRequestConfig.Concurrency)
+		serverLog.Info("request concurrency", "concurrency", tileRequestConfig.Concurrency)
 		processTileRequests(tileRequestConfig.Concurrency)
 	}
 
+	if appConfig.WebDAV.Enable {
+		for _, method := range webdav.Methods {
+			chi.RegisterMethod(method)
+		}
+	}
+
 	r := chi.NewRouter()
 
 	// r.Use(middleware.Logger)
@@ -1353,19 +5759,99 @@ func main() {
 			r.Use(cors.Handler(cors.Options{
 				AllowedOrigins: strings.Split(allowedOrigins, ","),
 				AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-				AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+				AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key", "traceparent"},
+				ExposedHeaders: []string{"X-Tile-Incomplete", "X-Tile-Reduced"},
 				MaxAge:         300, // Maximum value not ignored by any of major browsers
 			}))
 		}
 
-		var api Api
-		r.Mount("/", openapi.Handler(&api))
-		r.Mount("/metrics", promhttp.Handler())
+		r.Use(problem.Middleware)
+		r.Use(tracing.Middleware)
+
+		// Login has to be reachable without any scope
+		r.Mount("/auth", authenticator.Handler())
+
+		r.Group(func(r chi.Router) {
+			// Feed readers only support basic auth
+			r.Use(func(next http.Handler) http.Handler {
+				challenged := auth.Challenge(next)
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if strings.HasSuffix(r.URL.Path, "/feed") {
+						challenged.ServeHTTP(w, r)
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			})
+			r.Use(authenticator.Middleware(func(r *http.Request) auth.Scope {
+				path := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(apiPrefix, "/"))
+				return apiScope(r.Method, path)
+			}))
+			r.Use(readOnly(func(r *http.Request) bool {
+				path := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(apiPrefix, "/"))
+				return sharedWrite(r.Method, path)
+			}))
+
+			var api Api
+			r.Mount("/", openapi.Handler(&api))
+			r.Mount("/metrics", promhttp.Handler())
+		})
 	})
 	msg := fmt.Sprintf("api at %v%v", addr, apiPrefix)
 
-	r.Mount("/debug", middleware.Profiler())
-	r.Handle("/debug/fgprof", fgprof.Handler())
+	if appConfig.WebDAV.Enable {
+		r.Group(func(r chi.Router) {
+			r.Use(auth.Challenge)
+			r.Use(authenticator.Middleware(func(r *http.Request) auth.Scope {
+				return webdav.Scope(r.Method)
+			}))
+			r.Use(readOnly(func(r *http.Request) bool {
+				return webdav.Scope(r.Method) != auth.ScopeRead
+			}))
+			r.Mount("/webdav", webdav.NewHandler("/webdav", func() []collection.Collection {
+				return collections
+			}, imageSource))
+		})
+		msg = fmt.Sprintf("%s, webdav at %v/webdav", msg, addr)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Challenge)
+		r.Use(authenticator.Middleware(func(r *http.Request) auth.Scope {
+			return auth.ScopeRead
+		}))
+		r.Mount("/kiosk", kiosk.New(appConfig.Kiosk, "/kiosk", func() []collection.Collection {
+			return collections
+		}, imageSource))
+	})
+	msg = fmt.Sprintf("%s, kiosk at %v/kiosk", msg, addr)
+
+	if appConfig.DLNA.Enable {
+		// Renderers are unable to authenticate, so only the configured
+		// collections are exposed instead
+		server := dlna.New(appConfig.DLNA, "/dlna", func() []collection.Collection {
+			return collections
+		}, imageSource, serveFile)
+		r.Mount("/dlna", server)
+		port, err := dlna.Port(addr)
+		if err != nil {
+			serverLog.Fatal("invalid configuration", "section", "dlna", "err", err)
+		}
+		if err := server.Advertise(port); err != nil {
+			serverLog.Warn("dlna unable to advertise, renderers will not find the server", "err", err)
+		}
+		defer server.Close()
+		msg = fmt.Sprintf("%s, dlna at %v/dlna", msg, addr)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(authenticator.Middleware(func(r *http.Request) auth.Scope {
+			return auth.ScopeAdmin
+		}))
+		r.Use(guardProfiles)
+		r.Mount("/debug", middleware.Profiler())
+		r.Handle("/debug/fgprof", fgprof.Handler())
+	})
 
 	if apiPrefix != "/" {
 		// Hardcode well-known mime types, see https://github.com/golang/go/issues/32350
@@ -1391,6 +5877,7 @@ func main() {
 
 		r.Route("/", func(r chi.Router) {
 			r.Use(CacheControl())
+			r.Use(OpenGraph(subfs, apiPrefix))
 			r.Use(IndexHTML())
 			r.Handle("/*", server)
 		})
@@ -1399,6 +5886,74 @@ func main() {
 
 	// addExampleScene()
 
-	log.Println(msg)
-	log.Fatal(http.ListenAndServe(addr, r))
+	serverLog.Info(msg)
+	takenOver = serve(addr, r, takeover(appConfig.Instance))
+}
+
+// takeover returns a channel receiving the lock once the writer stopped and
+// a reader started with the auto role took it over, nil if it never can
+func takeover(config instance.Config) <-chan *instance.Lock {
+	if instanceRole != instance.RoleReader || config.Role == instance.RoleReader || config.TakeoverInterval <= 0 {
+		return nil
+	}
+	locks := make(chan *instance.Lock, 1)
+	go func() {
+		interval := time.Duration(config.TakeoverInterval) * time.Second
+		lock, err := instance.Takeover(context.Background(), dataDir, interval)
+		if err != nil {
+			serverLog.Warn("instance unable to take over", "err", err)
+			return
+		}
+		// Kept until restarted as the writer, so that the other readers keep
+		// waiting instead of taking it over in turn
+		serverLog.Info("instance writer stopped, restarting as the writer")
+		locks <- lock
+	}()
+	return locks
+}
+
+// restartAsWriter replaces the process with a new one inheriting the taken
+// over lock, which makes it the writer. If that is not supported, it exits
+// with an error instead, so that a restart policy starts it again.
+func restartAsWriter(lock *instance.Lock) {
+	err := lock.Exec()
+	serverLog.Fatal("instance unable to restart as the writer", "err", err)
+}
+
+// Longest time requests in progress are waited for on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// serve serves the handler until the process is interrupted, terminated or
+// the writer is taken over, then stops accepting requests and waits for the
+// ones in progress, so that the deferred cleanup of main runs. It returns the
+// lock if the writer was taken over.
+func serve(addr string, handler http.Handler, takeover <-chan *instance.Lock) *instance.Lock {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	var lock *instance.Lock
+	select {
+	case err := <-errs:
+		serverLog.Fatal("unable to serve", "err", err)
+	case <-ctx.Done():
+	case lock = <-takeover:
+	}
+	stop()
+
+	serverLog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		serverLog.Warn("unable to shut down gracefully", "err", err)
+	}
+	return lock
 }
@@ -3,6 +3,7 @@ package search
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
@@ -83,3 +84,68 @@ func (q *Query) QualifierValues(key string) []string {
 	}
 	return values
 }
+
+// Prompt is a text to search the embeddings for, weighted by how much it
+// counts towards the combined embedding, negative to exclude it
+type Prompt struct {
+	Text   string
+	Weight float32
+}
+
+// Prompts returns the prompts of the words of the query, leaving out the
+// qualifiers. Consecutive plain words form a single prompt, while a word
+// with a leading - is excluded and one with a trailing ^ and a number is
+// weighed by it, e.g. "sandy beach sunset^2 -people".
+func (q *Query) Prompts() []Prompt {
+	if q == nil {
+		return nil
+	}
+	var prompts []Prompt
+	var words []string
+	flush := func() {
+		if len(words) > 0 {
+			prompts = append(prompts, Prompt{Text: strings.Join(words, " "), Weight: 1})
+			words = nil
+		}
+	}
+	for _, term := range q.Terms {
+		var word string
+		switch {
+		case term.Word != nil:
+			word = *term.Word
+		case term.String != nil:
+			word = *term.String
+		default:
+			continue
+		}
+		p, ok := parsePrompt(word)
+		if !ok {
+			words = append(words, word)
+			continue
+		}
+		flush()
+		prompts = append(prompts, p)
+	}
+	flush()
+	return prompts
+}
+
+// parsePrompt returns the prompt of a word with a modifier, false if it is
+// a plain word
+func parsePrompt(word string) (Prompt, bool) {
+	p := Prompt{Text: word, Weight: 1}
+	modified := false
+	if i := strings.LastIndex(p.Text, "^"); i > 0 {
+		if w, err := strconv.ParseFloat(p.Text[i+1:], 32); err == nil {
+			p.Text = p.Text[:i]
+			p.Weight = float32(w)
+			modified = true
+		}
+	}
+	if len(p.Text) > 1 && strings.HasPrefix(p.Text, "-") {
+		p.Text = p.Text[1:]
+		p.Weight = -p.Weight
+		modified = true
+	}
+	return p, modified
+}
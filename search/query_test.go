@@ -52,3 +52,21 @@ func TestQualifierValues(t *testing.T) {
 		query.QualifierValues("tag"),
 	)
 }
+
+func TestPrompts(t *testing.T) {
+	query, err := Parse("tag:trip sandy beach sunset^2 -people -dog^0.5 t-shirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(
+		t,
+		[]Prompt{
+			{Text: "sandy beach", Weight: 1},
+			{Text: "sunset", Weight: 2},
+			{Text: "people", Weight: -1},
+			{Text: "dog", Weight: -0.5},
+			{Text: "t-shirt", Weight: 1},
+		},
+		query.Prompts(),
+	)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"photofield/internal/image"
+	"photofield/internal/openapi"
+	"photofield/internal/problem"
+
+	"github.com/goccy/go-yaml"
+)
+
+var testSourceOnce sync.Once
+
+// useTestSource sets up the image source of the handlers with the default
+// configuration and an empty data dir. The source is shared by the tests, as
+// its metrics can only be registered once.
+func useTestSource(t *testing.T) {
+	t.Helper()
+	testSourceOnce.Do(func() {
+		var appConfig AppConfig
+		if err := yaml.Unmarshal(defaultsYaml, &appConfig); err != nil {
+			t.Fatal(err)
+		}
+		dir, err := os.MkdirTemp("", "photofield-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		appConfig.Media.DataDir = dir
+		appConfig.Media.SkipLoadInfo = true
+		imageSource = image.NewSource(appConfig.Media, migrations, migrationsThumbs)
+	})
+}
+
+func putState(t *testing.T, key string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/state/"+key, bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	(&Api{}).PutStateKey(w, r, openapi.StateKeyPathParam(key))
+	return w
+}
+
+func TestPutStateConflict(t *testing.T) {
+	useTestSource(t)
+	t.Cleanup(func() {
+		imageSource.DeleteUserState("", "theme", image.AnyVersion)
+	})
+
+	w := putState(t, "theme", `{"value": "dark", "version": 0}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var state openapi.UserState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+
+	w = putState(t, "theme", fmt.Sprintf(`{"value": "light", "version": %d}`, state.Version))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	// The first version is stale now
+	w = putState(t, "theme", fmt.Sprintf(`{"value": "blue", "version": %d}`, state.Version))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body)
+	}
+	var p struct {
+		problem.Problem
+		Details struct {
+			Current openapi.UserState `json:"current"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != problem.VersionConflict {
+		t.Errorf("expected code %s, got %s", problem.VersionConflict, p.Code)
+	}
+	if p.Details.Current.Version != state.Version+1 || p.Details.Current.Value != "light" {
+		t.Errorf("expected the current state in the details, got %+v", p.Details.Current)
+	}
+
+	current, ok := imageSource.GetUserState("", "theme")
+	if !ok || string(current.Value) != `"light"` || current.Version != state.Version+1 {
+		t.Errorf("expected the state to be unchanged, got %s version %d", current.Value, current.Version)
+	}
+}
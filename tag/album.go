@@ -0,0 +1,10 @@
+package tag
+
+// Prefix of the tags holding the files of albums made from selections,
+// which are shown as smart albums searching for the tag
+const AlbumPrefix = "album:"
+
+// NewAlbum returns the tag of the album, e.g. album:summer-2023
+func NewAlbum(name string) Tag {
+	return newHierarchical(AlbumPrefix, []string{name})
+}
@@ -9,4 +9,35 @@ type Config struct {
 	Exif struct {
 		Enable bool `json:"enable"`
 	} `json:"exif"`
+
+	// Tags from the rating, label and keywords of XMP sidecars, e.g.
+	// xmp:rating:5 or xmp:keyword:beach
+	Xmp struct {
+		Enable bool `json:"enable"`
+	} `json:"xmp"`
+
+	// Tags from the IPTC and XMP keywords embedded in the files, e.g.
+	// kw:beach or kw:places:spain:beach for hierarchical keywords
+	Keywords struct {
+		Enable bool `json:"enable"`
+	} `json:"keywords"`
+
+	// Tags from the reverse geocoded location, e.g. place:germany and
+	// place:germany:berlin, requires geo.reverse_geocode
+	Places struct {
+		Enable bool `json:"enable"`
+	} `json:"places"`
+
+	// Selections kept on the server, see SelectionsConfig
+	Selections SelectionsConfig `json:"selections"`
+
+	// System tags flagging files with problems found while indexing, e.g.
+	// sys:no-gps or sys:duplicate
+	System struct {
+		Enable bool `json:"enable"`
+	} `json:"system"`
+
+	// Tags of the labels the files match according to their AI embeddings,
+	// e.g. label:food, suggested for review or applied right away
+	Suggestions SuggestionsConfig `json:"suggestions"`
 }
@@ -0,0 +1,30 @@
+package tag
+
+import (
+	"strings"
+
+	"github.com/gosimple/slug"
+)
+
+// Prefix of the tags read from the keywords embedded in the files
+const KeywordPrefix = "kw:"
+
+// NewKeyword returns the tag of the keyword with the levels from the
+// outermost one, e.g. kw:beach or kw:places:spain:beach
+func NewKeyword(levels ...string) Tag {
+	return newHierarchical(KeywordPrefix, levels)
+}
+
+// newHierarchical returns the tag with the prefix and the slugs of the
+// levels separated by colons, skipping empty levels
+func newHierarchical(prefix string, levels []string) Tag {
+	var t Tag
+	slugs := make([]string, 0, len(levels))
+	for _, l := range levels {
+		if s := slug.Make(l); s != "" {
+			slugs = append(slugs, s)
+		}
+	}
+	t.Name = prefix + strings.Join(slugs, ":")
+	return t
+}
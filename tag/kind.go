@@ -0,0 +1,10 @@
+package tag
+
+// Prefix of the tags of the kinds of files that are not photos, e.g.
+// kind:screenshot, which are classified automatically
+const KindPrefix = "kind:"
+
+// NewKind returns the tag of the kind, e.g. kind:document
+func NewKind(kind string) Tag {
+	return newHierarchical(KindPrefix, []string{kind})
+}
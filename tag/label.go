@@ -0,0 +1,27 @@
+package tag
+
+// Prefix of the tags of the labels the files were found to match by
+// comparing their AI embeddings to the labels
+const LabelPrefix = "label:"
+
+// NewLabel returns the tag of the label, e.g. label:food
+func NewLabel(label string) Tag {
+	return newHierarchical(LabelPrefix, []string{label})
+}
+
+type SuggestionsConfig struct {
+	Enable bool `json:"enable"`
+	// Labels the files are compared to, e.g. food or screenshot
+	Labels []string `json:"labels"`
+	// Text compared to the files for each label, with {label} replaced by
+	// the label
+	Prompt string `json:"prompt"`
+	// Text compared to the files alongside the labels, standing for the
+	// files matching none of them
+	Other string `json:"other"`
+	// Minimum confidence between 0 and 1 of a label to be suggested
+	MinConfidence float32 `json:"min_confidence"`
+	// Minimum confidence between 0 and 1 of a label to be tagged without
+	// review as the embeddings of the files are indexed, never if 0
+	AutoApply float32 `json:"auto_apply"`
+}
@@ -0,0 +1,11 @@
+package tag
+
+// Prefix of the tags of the places the files were taken at, named by
+// reverse geocoding their location
+const PlacePrefix = "place:"
+
+// NewPlace returns the tag of the place with the levels from the country
+// inwards, e.g. place:germany or place:germany:berlin
+func NewPlace(levels ...string) Tag {
+	return newHierarchical(PlacePrefix, levels)
+}
@@ -1,6 +1,13 @@
 package tag
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
+
+// Prefix of the tags of persistent selections, which are hidden from the
+// lists of tags
+const SelectionPrefix = SystemPrefix + "select:"
 
 func NewSelection(collectionId string) (Tag, error) {
 	var t Tag
@@ -10,6 +17,19 @@ func NewSelection(collectionId string) (Tag, error) {
 		return t, err
 	}
 
-	t.Name = fmt.Sprintf("sys:select:col:%s:%s", collectionId, rand)
+	t.Name = fmt.Sprintf("%scol:%s:%s", SelectionPrefix, collectionId, rand)
 	return t, nil
 }
+
+type SelectionsConfig struct {
+	// Hours a selection is kept after it was last changed, 24 if 0
+	TTLHours int `json:"ttl_hours"`
+}
+
+// TTL returns how long a selection is kept after it was last changed
+func (c SelectionsConfig) TTL() time.Duration {
+	if c.TTLHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.TTLHours) * time.Hour
+}
@@ -0,0 +1,11 @@
+package tag
+
+// Prefix of the tags of recurring subjects other than people, e.g.
+// subject:rex for a dog, labeled by naming a cluster of similar files
+const SubjectPrefix = "subject:"
+
+// NewSubject returns the tag of the subject with the name, e.g. subject:rex
+// for Rex
+func NewSubject(name string) Tag {
+	return newHierarchical(SubjectPrefix, []string{name})
+}
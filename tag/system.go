@@ -0,0 +1,17 @@
+package tag
+
+// Prefix of the system tags maintained by photofield itself
+const SystemPrefix = "sys:"
+
+// Tags of the files flagged by the indexer, listed like any other tags, so
+// that problem files can be found and acted on, e.g. with tag:sys:no-gps
+const (
+	// Files without a date, width or height in their metadata
+	MissingMetadata = SystemPrefix + "missing-metadata"
+	// Files that failed to decode and were quarantined
+	DecodeError = SystemPrefix + "decode-error"
+	// Files without a location
+	NoGps = SystemPrefix + "no-gps"
+	// Copies of files with the same contents indexed before
+	Duplicate = SystemPrefix + "duplicate"
+)
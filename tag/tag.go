@@ -16,12 +16,46 @@ type Tag struct {
 	Id       Id
 	Name     string
 	Revision int
+	Meta
+}
+
+// Meta is the display metadata of a tag, so that important tags can be
+// told apart in the UI
+type Meta struct {
+	// Hex color, e.g. #e53935
+	Color string
+	// Emoji or name of the icon shown next to the tag
+	Icon        string
+	Description string
+	// Pinned tags are listed first
+	Pinned bool
+}
+
+// ValidColor returns true if the color is empty or a hex color, e.g. #e53935
+// or #fff
+func ValidColor(color string) bool {
+	if color == "" {
+		return true
+	}
+	if len(color) != 4 && len(color) != 7 || color[0] != '#' {
+		return false
+	}
+	for _, c := range color[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
 }
 
 type ExternalTag struct {
-	Id       string `json:"id"`
-	Name     string `json:"name"`
-	Revision int    `json:"revision"`
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Revision    int    `json:"revision"`
+	Color       string `json:"color,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Description string `json:"description,omitempty"`
+	Pinned      bool   `json:"pinned,omitempty"`
 }
 
 func randomId() (string, error) {
@@ -30,9 +64,13 @@ func randomId() (string, error) {
 
 func (t Tag) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ExternalTag{
-		Id:       t.NameRev(),
-		Name:     t.Name,
-		Revision: t.Revision,
+		Id:          t.NameRev(),
+		Name:        t.Name,
+		Revision:    t.Revision,
+		Color:       t.Color,
+		Icon:        t.Icon,
+		Description: t.Description,
+		Pinned:      t.Pinned,
 	})
 }
 
@@ -46,6 +84,12 @@ func (t *Tag) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	tag.Meta = Meta{
+		Color:       externalTag.Color,
+		Icon:        externalTag.Icon,
+		Description: externalTag.Description,
+		Pinned:      externalTag.Pinned,
+	}
 	*t = tag
 	return nil
 }
@@ -0,0 +1,25 @@
+package tag
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gosimple/slug"
+)
+
+// Prefix of the tags read from XMP sidecars, which are replaced whenever
+// the sidecars change
+const XmpPrefix = "xmp:"
+
+func NewXmp(name string, value string) Tag {
+	var t Tag
+	v := ""
+	_, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		v = value
+	} else {
+		v = slug.Make(value)
+	}
+	t.Name = fmt.Sprintf("%s%s:%s", XmpPrefix, name, v)
+	return t
+}
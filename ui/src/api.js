@@ -111,6 +111,18 @@ export function getFileUrl(id, filename) {
   return `${host}/files/${id}/original/${filename}`;
 }
 
+export function getAudioUrl(id) {
+  return `${host}/files/${id}/audio`;
+}
+
+export function getMotionUrl(id) {
+  return `${host}/files/${id}/motion.mp4`;
+}
+
+export function getProjectionViewUrl(id, params) {
+  return `${host}/files/${id}/view.jpg?${qs.stringify(params)}`;
+}
+
 export async function getFileBlob(id) {
   return getBlob(`/files/` + id);
 }
@@ -273,3 +285,246 @@ export async function addTag(body) {
 export async function postTagFiles(id, body) {
   return await post(`/tags/${id}/files`, body);
 }
+
+export async function putTag(id, { color, icon, description, pinned }) {
+  const response = await fetch(host + `/tags/${encodeURIComponent(id)}`, {
+    method: "PUT",
+    body: JSON.stringify({ color, icon, description, pinned }),
+    headers: {
+      "Content-Type": "application/json; charset=utf-8",
+    }
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function renameTag(id, name) {
+  return await post(`/tags/${encodeURIComponent(id)}/rename`, { name });
+}
+
+export async function mergeTag(id, into) {
+  return await post(`/tags/${encodeURIComponent(id)}/merge`, { into });
+}
+
+export async function getSelections(collectionId) {
+  const params = collectionId ? `?collection_id=${encodeURIComponent(collectionId)}` : "";
+  const response = await get(`/selections${params}`);
+  return response.items;
+}
+
+export async function createSelection(collectionId) {
+  return await post(`/selections`, { collection_id: collectionId });
+}
+
+export async function selectFiles(id, op, fileIds) {
+  return await post(`/selections/${id}/files`, { op, file_ids: fileIds });
+}
+
+export async function convertSelection(id, to, name) {
+  return await post(`/selections/${id}/convert`, { to, name });
+}
+
+export async function deleteSelection(id) {
+  const response = await fetch(host + `/selections/${id}`, {
+    method: "DELETE",
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+}
+
+export async function getTagSuggestions(fileId) {
+  return await get(`/files/${fileId}/tag-suggestions`, { items: [] });
+}
+
+export async function getPlaces(collectionId, q) {
+  const params = new URLSearchParams({ collection_id: collectionId });
+  if (q) params.set("q", q);
+  return await get(`/places?${params}`);
+}
+
+export async function getMemories(collectionId, filter) {
+  const params = new URLSearchParams({ collection_id: collectionId });
+  if (filter) params.set("filter", filter);
+  return await get(`/memories?${params}`);
+}
+
+export async function getTrips(collectionId) {
+  const params = new URLSearchParams({ collection_id: collectionId });
+  return await get(`/trips?${params}`);
+}
+
+export async function getSubjects(collectionId) {
+  const params = new URLSearchParams({ collection_id: collectionId });
+  return await get(`/subjects?${params}`);
+}
+
+export async function labelSubject(id, name) {
+  return await post(`/subjects/${id}/label`, { name });
+}
+
+export async function prefetchFiles(sceneId, body) {
+  return await post(`/scenes/${sceneId}/prefetch`, body, null);
+}
+
+export async function getCameras() {
+  return await get(`/cameras`);
+}
+
+export async function calibrateCamera(fileId, referenceFileId) {
+  return await post(`/cameras/calibrate`, {
+    file_id: fileId,
+    reference_file_id: referenceFileId,
+  });
+}
+
+export async function getOrientationProposals(collectionId, limit) {
+  return await get(`/orientation/proposals?` + qs.stringify({
+    collection_id: collectionId,
+    limit,
+  }));
+}
+
+export async function acceptOrientationProposals(fileIds) {
+  return await post(`/orientation/proposals/accept`, {
+    file_ids: fileIds,
+  });
+}
+
+export async function rejectOrientationProposals(fileIds) {
+  return await post(`/orientation/proposals/reject`, {
+    file_ids: fileIds,
+  });
+}
+
+export async function putCaption(fileId, caption) {
+  const response = await fetch(host + `/files/${fileId}/caption`, {
+    method: "PUT",
+    body: JSON.stringify({ caption }),
+    headers: {
+      "Content-Type": "application/json; charset=utf-8",
+    }
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function resetCaption(fileId) {
+  const response = await fetch(host + `/files/${fileId}/caption`, {
+    method: "DELETE",
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function putLocation(fileId, latitude, longitude) {
+  const response = await fetch(host + `/files/${fileId}/location`, {
+    method: "PUT",
+    body: JSON.stringify({ latitude, longitude }),
+    headers: {
+      "Content-Type": "application/json; charset=utf-8",
+    }
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function resetLocation(fileId) {
+  const response = await fetch(host + `/files/${fileId}/location`, {
+    method: "DELETE",
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function postLocation({ latitude, longitude, fileIds, selectTag }) {
+  const response = await fetch(host + `/files/location`, {
+    method: "POST",
+    body: JSON.stringify({
+      latitude,
+      longitude,
+      file_ids: fileIds,
+      select_tag: selectTag,
+    }),
+    headers: {
+      "Content-Type": "application/json; charset=utf-8",
+    }
+  });
+  if (!response.ok) {
+    console.error(response);
+    throw new Error(response.statusText);
+  }
+  return await response.json();
+}
+
+export async function getUserState(key) {
+  return await get(`/state/${encodeURIComponent(key)}`, null);
+}
+
+export async function putUserState(key, value, version) {
+  const response = await fetch(host + `/state/${encodeURIComponent(key)}`, {
+    method: "PUT",
+    body: JSON.stringify({ value, version }),
+    headers: {
+      "Content-Type": "application/json; charset=utf-8",
+    }
+  });
+  return { status: response.status, body: await response.json() };
+}
+
+// Returns a ref synced with the state of the current user, so that it
+// follows them across browsers and devices. Concurrent changes from other
+// devices are overwritten by the latest local change.
+export function useUserState(key, defaultValue) {
+  const state = ref(defaultValue);
+  let version = 0;
+  let synced = JSON.stringify(defaultValue);
+  let timer = null;
+
+  getUserState(key).then(s => {
+    if (!s) return;
+    version = s.version;
+    synced = JSON.stringify(s.value);
+    state.value = s.value;
+  });
+
+  const save = async (retry) => {
+    const value = state.value;
+    const { status, body } = await putUserState(key, value, version);
+    if (status == 200) {
+      version = body.version;
+      synced = JSON.stringify(body.value);
+      return;
+    }
+    if (status == 409 && retry) {
+      version = body.details?.current?.version || 0;
+      await save(false);
+      return;
+    }
+    console.error("Unable to save state", key, body);
+  };
+
+  watch(state, value => {
+    if (JSON.stringify(value) == synced) return;
+    clearTimeout(timer);
+    timer = setTimeout(() => save(true), 500);
+  }, { deep: true });
+
+  return state;
+}